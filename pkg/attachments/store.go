@@ -0,0 +1,232 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package attachments keeps on disk what plugins record per attachment,
+// such as the users of a resource shared by several attachments, which is
+// released once the last of them is gone.
+//
+// The records are files named after the attachment, in a directory per
+// group, the group usually being named after the shared resource:
+//
+//	<dir>/lock
+//	<dir>/<group>/<attachment>
+//
+// All the records of a store are guarded by one lock, held from Open to
+// Close, so that a plugin can read the records, change the resources and
+// update the records as a whole.
+package attachments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexflint/go-filemutex"
+)
+
+const lockFileName = "lock"
+
+// ID identifies an attachment by its container ID and interface name
+func ID(containerID, ifName string) string {
+	return containerID + "_" + ifName
+}
+
+// Store holds the records of a directory under its lock
+type Store struct {
+	dir  string
+	lock *filemutex.FileMutex
+}
+
+// Open creates the directory of the store unless it exists and locks it
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create %q: %v", dir, err)
+	}
+	lock, err := filemutex.New(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock: %v", err)
+	}
+	if err := lock.Lock(); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("failed to lock: %v", err)
+	}
+	return &Store{dir: dir, lock: lock}, nil
+}
+
+// Close releases the lock
+func (s *Store) Close() error {
+	if err := s.lock.Unlock(); err != nil {
+		s.lock.Close()
+		return err
+	}
+	return s.lock.Close()
+}
+
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || name == lockFileName || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("invalid record name %q", name)
+	}
+	return nil
+}
+
+func (s *Store) path(group, id string) (string, error) {
+	if err := validName(group); err != nil {
+		return "", err
+	}
+	if err := validName(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, group, id), nil
+}
+
+// Put records the attachment in the group with data, replacing its
+// previous record
+func (s *Store) Put(group, id string, data []byte) error {
+	p, err := s.path(group, id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return fmt.Errorf("failed to create %q: %v", filepath.Dir(p), err)
+	}
+	// The temporary file is named so that it can't be taken for a record
+	tmp := filepath.Join(filepath.Dir(p), "."+id+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// PutJSON records the attachment in the group with v encoded as JSON
+func (s *Store) PutJSON(group, id string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(group, id, data)
+}
+
+// Get returns the record of the attachment in the group, and whether there
+// is one
+func (s *Store) Get(group, id string) ([]byte, bool, error) {
+	p, err := s.path(group, id)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// GetJSON decodes the record of the attachment in the group into v, and
+// reports whether there is one
+func (s *Store) GetJSON(group, id string, v interface{}) (bool, error) {
+	data, ok, err := s.Get(group, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse record %s/%s: %v", group, id, err)
+	}
+	return true, nil
+}
+
+// Remove drops the attachment from the group and returns the number of
+// attachments left in it. The group is removed along with its last
+// attachment.
+func (s *Store) Remove(group, id string) (int, error) {
+	p, err := s.path(group, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	left, err := s.Refs(group)
+	if err != nil || len(left) > 0 {
+		return len(left), err
+	}
+	if err := os.Remove(filepath.Dir(p)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// HasGroup reports whether the group holds attachments
+func (s *Store) HasGroup(group string) (bool, error) {
+	refs, err := s.Refs(group)
+	return len(refs) > 0, err
+}
+
+// Refs returns the attachments of the group
+func (s *Store) Refs(group string) ([]string, error) {
+	if err := validName(group); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, group))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			refs = append(refs, e.Name())
+		}
+	}
+	return refs, nil
+}
+
+// Groups returns the groups of the store
+func (s *Store) Groups() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, e := range entries {
+		if e.IsDir() {
+			groups = append(groups, e.Name())
+		}
+	}
+	return groups, nil
+}
+
+// GroupsOf returns the groups the attachment is recorded in
+func (s *Store) GroupsOf(id string) ([]string, error) {
+	if err := validName(id); err != nil {
+		return nil, err
+	}
+	groups, err := s.Groups()
+	if err != nil {
+		return nil, err
+	}
+	var of []string
+	for _, g := range groups {
+		if _, err := os.Stat(filepath.Join(s.dir, g, id)); err == nil {
+			of = append(of, g)
+		}
+	}
+	return of, nil
+}
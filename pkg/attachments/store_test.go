@@ -0,0 +1,118 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attachments_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+var _ = Describe("Store", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "attachments")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("counts the attachments of a group and removes it with the last one", func() {
+		s, err := attachments.Open(dir)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+
+		a := attachments.ID("ctr1", "eth0")
+		b := attachments.ID("ctr2", "eth0")
+		Expect(s.Put("eth1", a, nil)).To(Succeed())
+		Expect(s.Put("eth1", b, nil)).To(Succeed())
+		Expect(s.Refs("eth1")).To(ConsistOf(a, b))
+		Expect(s.GroupsOf(a)).To(ConsistOf("eth1"))
+
+		left, err := s.Remove("eth1", a)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(left).To(Equal(1))
+		Expect(s.HasGroup("eth1")).To(BeTrue())
+
+		left, err = s.Remove("eth1", b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(left).To(Equal(0))
+		Expect(s.HasGroup("eth1")).To(BeFalse())
+		_, err = os.Stat(filepath.Join(dir, "eth1"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		// Removing twice is not an error
+		_, err = s.Remove("eth1", b)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("keeps JSON records", func() {
+		s, err := attachments.Open(dir)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+
+		type record struct {
+			MTU int `json:"mtu"`
+		}
+		id := attachments.ID("ctr", "eth0")
+		Expect(s.PutJSON("mtu", id, &record{MTU: 1500})).To(Succeed())
+
+		r := &record{}
+		found, err := s.GetJSON("mtu", id, r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(r.MTU).To(Equal(1500))
+
+		found, err = s.GetJSON("mtu", attachments.ID("other", "eth0"), r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("rejects names escaping the store", func() {
+		s, err := attachments.Open(dir)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+
+		Expect(s.Put("..", "id", nil)).NotTo(Succeed())
+		Expect(s.Put("group", "../id", nil)).NotTo(Succeed())
+		Expect(s.Put("lock", "id", nil)).NotTo(Succeed())
+	})
+
+	It("serializes the users of the store", func() {
+		s, err := attachments.Open(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		opened := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			other, err := attachments.Open(dir)
+			Expect(err).NotTo(HaveOccurred())
+			close(opened)
+			other.Close()
+		}()
+
+		Consistently(opened, "100ms").ShouldNot(BeClosed())
+		Expect(s.Close()).To(Succeed())
+		Eventually(opened).Should(BeClosed())
+	})
+})
@@ -0,0 +1,164 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const (
+	ethPArp  = 0x0806
+	ethPIPv6 = 0x86dd
+)
+
+// AnnounceIPs sends a gratuitous ARP for every IPv4 address and an
+// unsolicited neighbor advertisement for every IPv6 address in ips out of
+// the named interface, so that L2 peers learn the location of the addresses
+// immediately. It must be called from the namespace owning the interface.
+func AnnounceIPs(ifName string, ips []net.IP) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	hwAddr := link.Attrs().HardwareAddr
+	if len(hwAddr) != 6 {
+		return fmt.Errorf("interface %q has no ethernet hardware address", ifName)
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open packet socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	for _, addr := range ips {
+		var frame []byte
+		var proto uint16
+		if addr.To4() != nil {
+			frame, proto = garpFrame(hwAddr, addr.To4()), ethPArp
+		} else {
+			frame, proto = unsolicitedNAFrame(hwAddr, addr.To16()), ethPIPv6
+		}
+
+		sa := &unix.SockaddrLinklayer{
+			Protocol: htons(proto),
+			Ifindex:  link.Attrs().Index,
+			Halen:    6,
+		}
+		copy(sa.Addr[:], frame[0:6])
+		if err := unix.Sendto(fd, frame, 0, sa); err != nil {
+			return fmt.Errorf("failed to announce %s on %q: %v", addr, ifName, err)
+		}
+	}
+	return nil
+}
+
+// AnnounceIPsRepeatedly sends the announcements of AnnounceIPs count
+// times, interval apart, as a single announcement is easily lost while
+// switches dampen MAC moves
+func AnnounceIPsRepeatedly(ifName string, ips []net.IP, count int, interval time.Duration) error {
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		if err := AnnounceIPs(ifName, ips); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// garpFrame builds a broadcast gratuitous ARP request for addr
+func garpFrame(hwAddr net.HardwareAddr, addr net.IP) []byte {
+	b := make([]byte, 14+28)
+	copy(b[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(b[6:12], hwAddr)
+	binary.BigEndian.PutUint16(b[12:14], ethPArp)
+
+	arp := b[14:]
+	binary.BigEndian.PutUint16(arp[0:2], 1)      // ethernet
+	binary.BigEndian.PutUint16(arp[2:4], 0x0800) // IPv4
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:8], 1) // request
+	copy(arp[8:14], hwAddr)
+	copy(arp[14:18], addr)
+	copy(arp[24:28], addr)
+	return b
+}
+
+// unsolicitedNAFrame builds an unsolicited neighbor advertisement for addr
+// sent to the all-nodes multicast group with the override flag set
+func unsolicitedNAFrame(hwAddr net.HardwareAddr, addr net.IP) []byte {
+	allNodes := net.IPv6linklocalallnodes
+
+	b := make([]byte, 14+40+32)
+	copy(b[0:6], []byte{0x33, 0x33, 0, 0, 0, 1})
+	copy(b[6:12], hwAddr)
+	binary.BigEndian.PutUint16(b[12:14], ethPIPv6)
+
+	ip6 := b[14:54]
+	ip6[0] = 0x60
+	binary.BigEndian.PutUint16(ip6[4:6], 32)
+	ip6[6] = unix.IPPROTO_ICMPV6
+	ip6[7] = 255
+	copy(ip6[8:24], addr)
+	copy(ip6[24:40], allNodes)
+
+	icmp := b[54:]
+	icmp[0] = 136 // neighbor advertisement
+	icmp[4] = 0x20
+	copy(icmp[8:24], addr)
+	icmp[24] = 2 // target link-layer address option
+	icmp[25] = 1
+	copy(icmp[26:32], hwAddr)
+
+	binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(addr, allNodes, icmp))
+	return b
+}
+
+func icmpv6Checksum(src, dst net.IP, payload []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	add(src)
+	add(dst)
+	pseudo := make([]byte, 8)
+	binary.BigEndian.PutUint32(pseudo[0:4], uint32(len(payload)))
+	pseudo[7] = unix.IPPROTO_ICMPV6
+	add(pseudo)
+	add(payload)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,56 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Address announcements", func() {
+	hwAddr, _ := net.ParseMAC("02:42:ac:11:00:02")
+
+	It("builds a gratuitous ARP request", func() {
+		addr := net.ParseIP("10.1.2.3").To4()
+		frame := garpFrame(hwAddr, addr)
+
+		Expect(frame).To(HaveLen(42))
+		Expect(frame[0:6]).To(Equal([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+		Expect(net.HardwareAddr(frame[6:12])).To(Equal(hwAddr))
+		Expect(frame[12:14]).To(Equal([]byte{0x08, 0x06}))
+		Expect(frame[20:22]).To(Equal([]byte{0, 1}))
+		Expect(net.IP(frame[28:32])).To(Equal(addr))
+		Expect(net.IP(frame[38:42])).To(Equal(addr))
+	})
+
+	It("builds an unsolicited neighbor advertisement with a valid checksum", func() {
+		addr := net.ParseIP("2001:db8::5")
+		frame := unsolicitedNAFrame(hwAddr, addr)
+
+		Expect(frame).To(HaveLen(86))
+		Expect(frame[0:6]).To(Equal([]byte{0x33, 0x33, 0, 0, 0, 1}))
+		Expect(frame[12:14]).To(Equal([]byte{0x86, 0xdd}))
+		Expect(frame[21]).To(Equal(byte(255)))
+		Expect(net.IP(frame[22:38])).To(Equal(addr))
+
+		icmp := frame[54:]
+		Expect(icmp[0]).To(Equal(byte(136)))
+		Expect(net.IP(icmp[8:24])).To(Equal(addr))
+		Expect(net.HardwareAddr(icmp[26:32])).To(Equal(hwAddr))
+		Expect(icmpv6Checksum(addr, net.IPv6linklocalallnodes, icmp)).To(BeZero())
+	})
+})
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"regexp"
 	"strings"
 
 	"github.com/coreos/go-iptables/iptables"
@@ -156,17 +157,50 @@ func TeardownIPMasq(ipn *net.IPNet, chain string, comment string) error {
 	return nil
 }
 
-// gcIPMasqIPTables is the iptables-based implementation of GCIPMasqForNetwork
-func gcIPMasqIPTables(_ string, _ []types.GCAttachment) error {
-	// FIXME: The iptables implementation does not support GC.
-	//
-	// (In theory, it _could_ backward-compatibly support it, by adding a no-op rule
-	// with a comment indicating the network to each chain it creates, so that it
-	// could later figure out which chains corresponded to which networks; older
-	// implementations would ignore the extra rule but would still correctly delete
-	// the chain on teardown (because they ClearChain() before doing DeleteChain()).
+// gcIPMasqIPTables is the iptables-based implementation of GCIPMasqForNetwork.
+// The iptables implementation ignores ifname, so the rules of a container are
+// kept as long as one of its attachments is valid.
+func gcIPMasqIPTables(network string, attachments []types.GCAttachment) error {
+	valid := make(map[string]bool, len(attachments))
+	for _, a := range attachments {
+		valid[a.ContainerID] = true
+	}
 
-	return nil
+	// The POSTROUTING rules name the container in their comment, e.g.
+	// -A POSTROUTING -s 10.1.2.3/32 -m comment --comment "name: \"net\" id: \"ctr\"" -j CNI-...
+	jump := regexp.MustCompile(`^-A POSTROUTING -s (\S+) -m comment --comment "name: \\"` +
+		regexp.QuoteMeta(network) + `\\" id: \\"(.+)\\"" -j (\S+)$`)
+
+	var errs []string
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := iptables.NewWithProtocol(proto)
+		if err != nil {
+			return fmt.Errorf("failed to locate iptables: %v", err)
+		}
+		rules, err := ipt.List("nat", "POSTROUTING")
+		if err != nil {
+			return fmt.Errorf("failed to list POSTROUTING rules: %v", err)
+		}
+		for _, rule := range rules {
+			m := jump.FindStringSubmatch(rule)
+			if m == nil || valid[m[2]] || m[3] != utils.FormatChainName(network, m[2]) {
+				continue
+			}
+			addr, ipn, err := net.ParseCIDR(m[1])
+			if err != nil {
+				continue
+			}
+			ipn.IP = addr
+			if err := TeardownIPMasq(ipn, m[3], utils.FormatComment(network, m[2])); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if errs == nil {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
 }
 
 // isNotExist returnst true if the error is from iptables indicating
@@ -0,0 +1,45 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Plugins give the qdiscs they create a major handle within
+// [OwnedQdiscMajorMin, OwnedQdiscMajorMax] so that they can tell them from
+// those of others
+const (
+	OwnedQdiscMajorMin uint16 = 0xc000
+	OwnedQdiscMajorMax uint16 = 0xcfff
+)
+
+// OwnedQdiscHandle returns the handle of the qdisc at offset within the
+// owned range
+func OwnedQdiscHandle(offset uint16) (uint32, error) {
+	if offset > OwnedQdiscMajorMax-OwnedQdiscMajorMin {
+		return 0, fmt.Errorf("qdisc handle offset %d out of the owned range", offset)
+	}
+	return netlink.MakeHandle(OwnedQdiscMajorMin+offset, 0), nil
+}
+
+// OwnsQdisc reports whether the qdisc major handle lies within the owned
+// range
+func OwnsQdisc(qdisc netlink.Qdisc) bool {
+	major, _ := netlink.MajorMinor(qdisc.Attrs().Handle)
+	return major >= OwnedQdiscMajorMin && major <= OwnedQdiscMajorMax
+}
@@ -0,0 +1,36 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+)
+
+var _ = Describe("Ownership tags", func() {
+	It("allocates qdisc handles within the owned range", func() {
+		handle, err := OwnedQdiscHandle(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(handle).To(Equal(netlink.MakeHandle(0xc001, 0)))
+		Expect(OwnsQdisc(&netlink.Tbf{QdiscAttrs: netlink.QdiscAttrs{Handle: handle}})).To(BeTrue())
+
+		_, err = OwnedQdiscHandle(0x1000)
+		Expect(err).To(HaveOccurred())
+
+		ingress := &netlink.Ingress{QdiscAttrs: netlink.QdiscAttrs{Handle: netlink.MakeHandle(0xffff, 0)}}
+		Expect(OwnsQdisc(ingress)).To(BeFalse())
+	})
+})
@@ -0,0 +1,275 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// ProbeNeighbor reports whether addr is in use on the link of the named
+// interface, by sending an ARP probe (RFC 5227) for an IPv4 address or a
+// duplicate address detection neighbor solicitation (RFC 4862) for an IPv6
+// address, and waiting up to timeout for an answer. Like DAD, the probes
+// don't use an address of the interface, which doesn't need one.
+func ProbeNeighbor(ifName string, addr net.IP, timeout time.Duration) (bool, error) {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return false, fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	hwAddr := link.Attrs().HardwareAddr
+	if len(hwAddr) != 6 {
+		return false, fmt.Errorf("interface %q has no ethernet hardware address", ifName)
+	}
+
+	var frame []byte
+	var proto uint16
+	var conflict func([]byte) bool
+	if addr.To4() != nil {
+		addr = addr.To4()
+		frame, proto = arpProbeFrame(hwAddr, addr), ethPArp
+		conflict = func(b []byte) bool { return isARPConflict(b, hwAddr, addr) }
+	} else {
+		addr = addr.To16()
+		frame, proto = dadNSFrame(hwAddr, addr), ethPIPv6
+		conflict = func(b []byte) bool { return isNDPConflict(b, hwAddr, addr) }
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(proto)))
+	if err != nil {
+		return false, fmt.Errorf("failed to open packet socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	sa := &unix.SockaddrLinklayer{
+		Protocol: htons(proto),
+		Ifindex:  link.Attrs().Index,
+		Halen:    6,
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		return false, fmt.Errorf("failed to bind packet socket to %q: %v", ifName, err)
+	}
+	copy(sa.Addr[:], frame[0:6])
+	if err := unix.Sendto(fd, frame, 0, sa); err != nil {
+		return false, fmt.Errorf("failed to probe %s on %q: %v", addr, ifName, err)
+	}
+	return awaitAnswer(fd, timeout, func(b []byte, _ unix.Sockaddr) bool { return conflict(b) })
+}
+
+// ProbeICMP reports whether addr answers an ICMP echo request within
+// timeout. The request is sent out of the named interface, or as routed
+// when ifName is empty.
+func ProbeICMP(ifName string, addr net.IP, timeout time.Duration) (bool, error) {
+	family, proto := unix.AF_INET, unix.IPPROTO_ICMP
+	var sa unix.Sockaddr
+	if ip4 := addr.To4(); ip4 != nil {
+		sa4 := &unix.SockaddrInet4{}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		family, proto = unix.AF_INET6, unix.IPPROTO_ICMPV6
+		sa6 := &unix.SockaddrInet6{}
+		copy(sa6.Addr[:], addr.To16())
+		sa = sa6
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_RAW, proto)
+	if err != nil {
+		return false, fmt.Errorf("failed to open ICMP socket: %v", err)
+	}
+	defer unix.Close(fd)
+	if ifName != "" {
+		if err := unix.BindToDevice(fd, ifName); err != nil {
+			return false, fmt.Errorf("failed to bind ICMP socket to %q: %v", ifName, err)
+		}
+	}
+
+	id := uint16(os.Getpid())
+	if err := unix.Sendto(fd, echoRequest(family == unix.AF_INET6, id), 0, sa); err != nil {
+		return false, fmt.Errorf("failed to probe %s: %v", addr, err)
+	}
+	return awaitAnswer(fd, timeout, func(b []byte, from unix.Sockaddr) bool {
+		switch from := from.(type) {
+		case *unix.SockaddrInet4:
+			// Raw IPv4 sockets receive the IP header
+			if len(b) < 20 || !net.IP(from.Addr[:]).Equal(addr) {
+				return false
+			}
+			return isEchoReply(b[int(b[0]&0x0f)*4:], false, id)
+		case *unix.SockaddrInet6:
+			return net.IP(from.Addr[:]).Equal(addr) && isEchoReply(b, true, id)
+		}
+		return false
+	})
+}
+
+// awaitAnswer receives from fd until match accepts a packet, or timeout
+func awaitAnswer(fd int, timeout time.Duration, match func([]byte, unix.Sockaddr) bool) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return false, err
+		}
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to receive the answer: %v", err)
+		}
+		if match(buf[:n], from) {
+			return true, nil
+		}
+	}
+}
+
+// arpProbeFrame builds a broadcast ARP probe for addr, whose sender
+// address is unspecified
+func arpProbeFrame(hwAddr net.HardwareAddr, addr net.IP) []byte {
+	b := garpFrame(hwAddr, addr)
+	copy(b[28:32], net.IPv4zero.To4())
+	return b
+}
+
+// isARPConflict reports whether the ARP frame shows that another host uses
+// addr, or probes for it
+func isARPConflict(b []byte, hwAddr net.HardwareAddr, addr net.IP) bool {
+	if len(b) < 42 || binary.BigEndian.Uint16(b[12:14]) != ethPArp {
+		return false
+	}
+	arp := b[14:]
+	senderHw, senderIP, targetIP := arp[8:14], net.IP(arp[14:18]), net.IP(arp[24:28])
+	if bytes.Equal(senderHw, hwAddr) {
+		return false
+	}
+	return senderIP.Equal(addr) ||
+		(binary.BigEndian.Uint16(arp[6:8]) == 1 && senderIP.Equal(net.IPv4zero) && targetIP.Equal(addr))
+}
+
+// solicitedNodeAddr returns the solicited-node multicast address of addr
+func solicitedNodeAddr(addr net.IP) net.IP {
+	snm := net.ParseIP("ff02::1:ff00:0")
+	copy(snm[13:], addr[13:16])
+	return snm
+}
+
+// dadNSFrame builds a duplicate address detection neighbor solicitation for
+// addr, sent from the unspecified address to its solicited-node group
+func dadNSFrame(hwAddr net.HardwareAddr, addr net.IP) []byte {
+	dst := solicitedNodeAddr(addr)
+
+	b := make([]byte, 14+40+24)
+	copy(b[0:6], []byte{0x33, 0x33, dst[12], dst[13], dst[14], dst[15]})
+	copy(b[6:12], hwAddr)
+	binary.BigEndian.PutUint16(b[12:14], ethPIPv6)
+
+	ip6 := b[14:54]
+	ip6[0] = 0x60
+	binary.BigEndian.PutUint16(ip6[4:6], 24)
+	ip6[6] = unix.IPPROTO_ICMPV6
+	ip6[7] = 255
+	copy(ip6[8:24], net.IPv6unspecified)
+	copy(ip6[24:40], dst)
+
+	icmp := b[54:]
+	icmp[0] = 135 // neighbor solicitation
+	copy(icmp[8:24], addr)
+
+	binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(net.IPv6unspecified, dst, icmp))
+	return b
+}
+
+// isNDPConflict reports whether the frame is a neighbor advertisement for
+// addr, or a solicitation of another host probing for it
+func isNDPConflict(b []byte, hwAddr net.HardwareAddr, addr net.IP) bool {
+	if len(b) < 14+40+24 || binary.BigEndian.Uint16(b[12:14]) != ethPIPv6 {
+		return false
+	}
+	if bytes.Equal(b[6:12], hwAddr) {
+		return false
+	}
+	ip6 := b[14:54]
+	if ip6[6] != unix.IPPROTO_ICMPV6 {
+		return false
+	}
+	icmp := b[54:]
+	if !net.IP(icmp[8:24]).Equal(addr) {
+		return false
+	}
+	switch icmp[0] {
+	case 136:
+		return true
+	case 135:
+		return net.IP(ip6[8:24]).Equal(net.IPv6unspecified)
+	}
+	return false
+}
+
+// echoRequest builds an ICMP echo request. The kernel computes the
+// checksum of ICMPv6.
+func echoRequest(v6 bool, id uint16) []byte {
+	b := make([]byte, 8+8)
+	b[0] = 8
+	if v6 {
+		b[0] = 128
+	}
+	binary.BigEndian.PutUint16(b[4:6], id)
+	binary.BigEndian.PutUint16(b[6:8], 1)
+	copy(b[8:], "cni-prob")
+	if !v6 {
+		binary.BigEndian.PutUint16(b[2:4], inetChecksum(b))
+	}
+	return b
+}
+
+func isEchoReply(b []byte, v6 bool, id uint16) bool {
+	if len(b) < 8 {
+		return false
+	}
+	reply := byte(0)
+	if v6 {
+		reply = 129
+	}
+	return b[0] == reply && binary.BigEndian.Uint16(b[4:6]) == id
+}
+
+func inetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,164 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+var _ = Describe("Address probes", func() {
+	hwAddr, _ := net.ParseMAC("02:42:ac:11:00:02")
+	otherHwAddr, _ := net.ParseMAC("02:42:ac:11:00:03")
+
+	It("builds an ARP probe", func() {
+		addr := net.ParseIP("10.1.2.3").To4()
+		frame := arpProbeFrame(hwAddr, addr)
+
+		Expect(frame).To(HaveLen(42))
+		Expect(net.IP(frame[28:32])).To(Equal(net.IPv4zero.To4()))
+		Expect(net.IP(frame[38:42])).To(Equal(addr))
+
+		// Our own probe is no conflict, the same probe of another host is
+		Expect(isARPConflict(frame, hwAddr, addr)).To(BeFalse())
+		Expect(isARPConflict(arpProbeFrame(otherHwAddr, addr), hwAddr, addr)).To(BeTrue())
+		Expect(isARPConflict(garpFrame(otherHwAddr, addr), hwAddr, addr)).To(BeTrue())
+		Expect(isARPConflict(garpFrame(otherHwAddr, net.ParseIP("10.1.2.4").To4()), hwAddr, addr)).To(BeFalse())
+	})
+
+	It("builds a duplicate address detection neighbor solicitation with a valid checksum", func() {
+		addr := net.ParseIP("2001:db8::1:2345")
+		frame := dadNSFrame(hwAddr, addr)
+		snm := net.ParseIP("ff02::1:ff01:2345")
+
+		Expect(frame).To(HaveLen(78))
+		Expect(frame[0:6]).To(Equal([]byte{0x33, 0x33, 0xff, 0x01, 0x23, 0x45}))
+		Expect(net.IP(frame[22:38])).To(Equal(net.IPv6unspecified))
+		Expect(net.IP(frame[38:54])).To(Equal(snm))
+
+		icmp := frame[54:]
+		Expect(icmp[0]).To(Equal(byte(135)))
+		Expect(net.IP(icmp[8:24])).To(Equal(addr))
+		Expect(icmpv6Checksum(net.IPv6unspecified, snm, icmp)).To(BeZero())
+
+		Expect(isNDPConflict(frame, hwAddr, addr)).To(BeFalse())
+		Expect(isNDPConflict(dadNSFrame(otherHwAddr, addr), hwAddr, addr)).To(BeTrue())
+		Expect(isNDPConflict(unsolicitedNAFrame(otherHwAddr, addr), hwAddr, addr)).To(BeTrue())
+		Expect(isNDPConflict(unsolicitedNAFrame(otherHwAddr, net.ParseIP("2001:db8::1")), hwAddr, addr)).To(BeFalse())
+	})
+
+	It("builds an ICMP echo request with a valid checksum", func() {
+		request := echoRequest(false, 42)
+		Expect(request[0]).To(Equal(byte(8)))
+		Expect(inetChecksum(request)).To(BeZero())
+		Expect(echoRequest(true, 42)[0]).To(Equal(byte(128)))
+
+		reply := append([]byte{0}, request[1:]...)
+		Expect(isEchoReply(reply, false, 42)).To(BeTrue())
+		Expect(isEchoReply(reply, false, 43)).To(BeFalse())
+		Expect(isEchoReply(request, false, 42)).To(BeFalse())
+	})
+
+	Context("on a link", func() {
+		var hostNS, peerNS ns.NetNS
+		var hostVethName string
+
+		BeforeEach(func() {
+			var err error
+			hostNS, err = testutils.NewNS()
+			Expect(err).NotTo(HaveOccurred())
+			peerNS, err = testutils.NewNS()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = peerNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				hostVeth, peerVeth, err := SetupVeth("eth0", 1500, "", hostNS)
+				Expect(err).NotTo(HaveOccurred())
+				hostVethName = hostVeth.Name
+
+				link, err := netlinksafe.LinkByName(peerVeth.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.LinkSetUp(link)).To(Succeed())
+				for _, a := range []string{"10.9.0.2/24", "2001:db8:9::2/64"} {
+					addr, err := netlink.ParseAddr(a)
+					Expect(err).NotTo(HaveOccurred())
+					addr.Flags = unix.IFA_F_NODAD
+					Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = hostNS.Do(func(ns.NetNS) error {
+				link, err := netlinksafe.LinkByName(hostVethName)
+				if err != nil {
+					return err
+				}
+				addr, err := netlink.ParseAddr("10.9.0.1/24")
+				if err != nil {
+					return err
+				}
+				return netlink.AddrAdd(link, addr)
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(hostNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(hostNS)).To(Succeed())
+			Expect(peerNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(peerNS)).To(Succeed())
+		})
+
+		It("finds the addresses in use", func() {
+			err := hostNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				for _, tc := range []struct {
+					addr  string
+					inUse bool
+				}{
+					{"10.9.0.2", true},
+					{"10.9.0.3", false},
+					{"2001:db8:9::2", true},
+					{"2001:db8:9::3", false},
+				} {
+					inUse, err := ProbeNeighbor(hostVethName, net.ParseIP(tc.addr), 200*time.Millisecond)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(inUse).To(Equal(tc.inUse), tc.addr)
+				}
+
+				inUse, err := ProbeICMP(hostVethName, net.ParseIP("10.9.0.2"), 200*time.Millisecond)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inUse).To(BeTrue())
+				inUse, err = ProbeICMP("", net.ParseIP("10.9.0.3"), 200*time.Millisecond)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inUse).To(BeFalse())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,63 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// ErrAddressesExhausted is the code of the error result of an IPAM plugin
+// which has no address left to allocate, in the range of the codes
+// specific to plugins. Retrying only helps once addresses are released.
+const ErrAddressesExhausted uint = 110
+
+// The details of the errors, telling the runtime whether to retry
+const (
+	exhaustedDetails  = "no address is available until others are released"
+	contentionDetails = "the IPAM store is busy, try again later"
+)
+
+// NewExhaustedError returns the error of an IPAM plugin with no address
+// left to allocate
+func NewExhaustedError(err error) *types.Error {
+	return types.NewError(ErrAddressesExhausted, err.Error(), exhaustedDetails)
+}
+
+// NewContentionError returns the error of an IPAM plugin which couldn't
+// access its store, e.g. held by another invocation. The runtime may try
+// again later.
+func NewContentionError(err error) *types.Error {
+	return types.NewError(types.ErrTryAgainLater, err.Error(), contentionDetails)
+}
+
+// NewConfigError returns the error of an IPAM plugin whose configuration
+// is invalid, which retrying won't fix
+func NewConfigError(err error) *types.Error {
+	return types.NewError(types.ErrInvalidNetworkConfig, err.Error(), "")
+}
+
+// WrapError prefixes the message of an error of an IPAM delegate, keeping
+// its code and details in the error result of the calling plugin, unlike
+// fmt.Errorf. Other errors are wrapped as fmt.Errorf does.
+func WrapError(err error, msg string) error {
+	var e *types.Error
+	if errors.As(err, &e) {
+		return types.NewError(e.Code, fmt.Sprintf("%s: %s", msg, e.Msg), e.Details)
+	}
+	return fmt.Errorf("%s: %v", msg, err)
+}
@@ -0,0 +1,60 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+var _ = Describe("IPAM errors", func() {
+	It("carries the code of the kind of failure", func() {
+		err := errors.New("no IP addresses available")
+		Expect(NewExhaustedError(err).Code).To(Equal(ErrAddressesExhausted))
+		Expect(NewContentionError(err).Code).To(Equal(types.ErrTryAgainLater))
+		Expect(NewConfigError(err).Code).To(Equal(types.ErrInvalidNetworkConfig))
+		Expect(NewConfigError(err).Error()).To(Equal("no IP addresses available"))
+	})
+
+	It("keeps the code of the delegate error when wrapping it", func() {
+		delegateErr := NewExhaustedError(errors.New("no IP addresses available"))
+		err := WrapError(fmt.Errorf("netplugin failed: %w", delegateErr), "failed to execute IPAM delegate")
+
+		var e *types.Error
+		Expect(errors.As(err, &e)).To(BeTrue())
+		Expect(e.Code).To(Equal(ErrAddressesExhausted))
+		Expect(e.Msg).To(Equal("failed to execute IPAM delegate: no IP addresses available"))
+		Expect(e.Details).To(Equal(delegateErr.Details))
+	})
+
+	It("wraps other errors as they are", func() {
+		err := WrapError(errors.New("plugin not found"), "failed to execute IPAM delegate")
+		Expect(err).To(MatchError("failed to execute IPAM delegate: plugin not found"))
+		Expect(errors.As(err, new(*types.Error))).To(BeFalse())
+	})
+
+	It("tells the runtime to try again later on contention", func() {
+		err := WrapError(NewContentionError(errors.New("failed to lock store")), "delegate")
+		var e *types.Error
+		Expect(errors.As(err, &e)).To(BeTrue())
+		Expect(e.Code).To(Equal(uint(types.ErrTryAgainLater)))
+		Expect(e.Msg).To(Equal("delegate: failed to lock store"))
+	})
+})
@@ -33,12 +33,21 @@ const (
 	DisableIPv6SysctlTemplate    = "net/ipv6/conf/%s/disable_ipv6"
 	KeepAddrOnDownSysctlTemplate = "net/ipv6/conf/%s/keep_addr_on_down"
 
-	dadSettleTimeout = 5 * time.Second
+	// DADSettleTimeout is how long ConfigureIface waits for IPv6 duplicate
+	// address detection to complete
+	DADSettleTimeout = 5 * time.Second
 )
 
 // ConfigureIface takes the result of IPAM plugin and
 // applies to the ifName interface
 func ConfigureIface(ifName string, res *current.Result) error {
+	return ConfigureIfaceWithDADTimeout(ifName, res, DADSettleTimeout)
+}
+
+// ConfigureIfaceWithDADTimeout is like ConfigureIface but waits at most
+// dadTimeout for the IPv6 addresses to leave the tentative state. A zero
+// dadTimeout does not wait at all, leaving DAD to complete asynchronously.
+func ConfigureIfaceWithDADTimeout(ifName string, res *current.Result, dadTimeout time.Duration) error {
 	if len(res.Interfaces) == 0 {
 		return fmt.Errorf("no interfaces to configure")
 	}
@@ -113,8 +122,8 @@ func ConfigureIface(ifName string, res *current.Result) error {
 		return fmt.Errorf("failed to set %q UP: %v", ifName, err)
 	}
 
-	if v6gw != nil {
-		err = ip.SettleAddresses(ifName, dadSettleTimeout)
+	if v6gw != nil && dadTimeout > 0 {
+		err = ip.SettleAddresses(ifName, dadTimeout)
 		if err != nil {
 			return fmt.Errorf("failed to settle addresses for %q: %v", ifName, err)
 		}
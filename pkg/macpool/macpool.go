@@ -0,0 +1,269 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package macpool allocates MAC addresses to attachments out of a range
+// sharing a prefix.
+//
+// The allocations of all the pools and of all the plugins drawing from them
+// are kept in one store, recorded both by MAC address and by attachment, so
+// that an address is never handed out twice on the node. The store defaults
+// to persistent storage so that the addresses survive a reboot.
+package macpool
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+// DefaultDataDir keeps the allocations of the pools without a DataDir
+const DefaultDataDir = "/var/lib/cni/macpool"
+
+// The groups of the store
+const (
+	macsGroup        = "macs"
+	attachmentsGroup = "attachments"
+)
+
+// Pool is a range of MAC addresses sharing a prefix
+type Pool struct {
+	// Prefix is the leading bytes shared by the pool, such as an OUI
+	Prefix string `json:"prefix"`
+	// RangeStart and RangeEnd optionally restrict the pool within the
+	// prefix
+	RangeStart string `json:"rangeStart,omitempty"`
+	RangeEnd   string `json:"rangeEnd,omitempty"`
+	// DataDir keeps the allocations, DefaultDataDir if unset
+	DataDir string `json:"dataDir,omitempty"`
+
+	start, end uint64
+}
+
+func (p *Pool) dataDir() string {
+	if p.DataDir == "" {
+		return DefaultDataDir
+	}
+	return p.DataDir
+}
+
+func macToUint64(mac net.HardwareAddr) uint64 {
+	var v uint64
+	for _, b := range mac {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func uint64ToMAC(v uint64) net.HardwareAddr {
+	mac := make(net.HardwareAddr, 6)
+	for i := 5; i >= 0; i-- {
+		mac[i] = byte(v)
+		v >>= 8
+	}
+	return mac
+}
+
+// ParsePrefix parses a unicast MAC prefix of one to five colon separated
+// bytes
+func ParsePrefix(prefix string) ([]byte, error) {
+	parts := strings.Split(prefix, ":")
+	if len(parts) > 5 {
+		return nil, fmt.Errorf("MAC prefix %q is longer than 5 bytes", prefix)
+	}
+	b := make([]byte, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 16, 8)
+		if err != nil || len(p) != 2 {
+			return nil, fmt.Errorf("invalid MAC prefix %q", prefix)
+		}
+		b[i] = byte(v)
+	}
+	if b[0]&0x01 != 0 {
+		return nil, fmt.Errorf("MAC prefix %q is multicast", prefix)
+	}
+	return b, nil
+}
+
+// Canonicalize validates the pool and computes its bounds
+func (p *Pool) Canonicalize() error {
+	prefix, err := ParsePrefix(p.Prefix)
+	if err != nil {
+		return err
+	}
+	hostBits := uint(8 * (6 - len(prefix)))
+	var base uint64
+	for _, b := range prefix {
+		base = base<<8 | uint64(b)
+	}
+	p.start = base << hostBits
+	p.end = p.start | (1<<hostBits - 1)
+
+	bound := func(s string, v *uint64) error {
+		if s == "" {
+			return nil
+		}
+		mac, err := net.ParseMAC(s)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("invalid MAC pool bound %q", s)
+		}
+		m := macToUint64(mac)
+		if m < p.start || m > p.end {
+			return fmt.Errorf("MAC pool bound %s is outside of prefix %s", s, p.Prefix)
+		}
+		*v = m
+		return nil
+	}
+	if err := bound(p.RangeStart, &p.start); err != nil {
+		return err
+	}
+	if err := bound(p.RangeEnd, &p.end); err != nil {
+		return err
+	}
+	if p.start > p.end {
+		return fmt.Errorf("MAC pool rangeStart %s is after rangeEnd %s", p.RangeStart, p.RangeEnd)
+	}
+	return nil
+}
+
+// contains reports whether the address lies within the bounds of the pool
+func (p *Pool) contains(mac net.HardwareAddr) bool {
+	m := macToUint64(mac)
+	return len(mac) == 6 && m >= p.start && m <= p.end
+}
+
+func (p *Pool) open() (*attachments.Store, error) {
+	store, err := attachments.Open(p.dataDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MAC pool: %v", err)
+	}
+	return store, nil
+}
+
+// lookup returns the address allocated to the attachment, if any
+func lookup(store *attachments.Store, id string) (net.HardwareAddr, error) {
+	data, found, err := store.Get(attachmentsGroup, id)
+	if err != nil || !found {
+		return nil, err
+	}
+	mac, err := net.ParseMAC(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAC address recorded for %s: %v", id, err)
+	}
+	return mac, nil
+}
+
+// release drops the allocation of the attachment, if any
+func release(store *attachments.Store, id string) error {
+	mac, err := lookup(store, id)
+	if err != nil || mac == nil {
+		return err
+	}
+	if _, err := store.Remove(macsGroup, mac.String()); err != nil {
+		return fmt.Errorf("failed to release MAC address %s: %v", mac, err)
+	}
+	if _, err := store.Remove(attachmentsGroup, id); err != nil {
+		return fmt.Errorf("failed to release MAC address %s: %v", mac, err)
+	}
+	return nil
+}
+
+// Allocate returns the address of the attachment, allocating one when it
+// has none or when its address is outside of the pool, e.g. as the pool
+// changed. The search starts at an offset derived from the attachment so
+// that the address is stable across retries.
+func (p *Pool) Allocate(containerID, ifName string) (net.HardwareAddr, error) {
+	store, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	id := attachments.ID(containerID, ifName)
+	mac, err := lookup(store, id)
+	if err != nil {
+		return nil, err
+	}
+	if mac != nil {
+		if p.contains(mac) {
+			return mac, nil
+		}
+		if err := release(store, id); err != nil {
+			return nil, err
+		}
+	}
+
+	size := p.end - p.start + 1
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	offset := h.Sum64() % size
+	for i := uint64(0); i < size; i++ {
+		mac := uint64ToMAC(p.start + (offset+i)%size)
+		_, taken, err := store.Get(macsGroup, mac.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MAC pool: %v", err)
+		}
+		if taken {
+			continue
+		}
+		if err := store.Put(macsGroup, mac.String(), []byte(id)); err != nil {
+			return nil, fmt.Errorf("failed to record MAC address %s: %v", mac, err)
+		}
+		if err := store.Put(attachmentsGroup, id, []byte(mac.String())); err != nil {
+			_, _ = store.Remove(macsGroup, mac.String())
+			return nil, fmt.Errorf("failed to record MAC address %s: %v", mac, err)
+		}
+		return mac, nil
+	}
+	return nil, fmt.Errorf("no MAC address left in pool %s", p.Prefix)
+}
+
+// Allocated returns the address allocated to the attachment within the
+// pool, or nil if none
+func (p *Pool) Allocated(containerID, ifName string) (net.HardwareAddr, error) {
+	if _, err := os.Stat(p.dataDir()); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	store, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	mac, err := lookup(store, attachments.ID(containerID, ifName))
+	if err != nil || mac == nil || !p.contains(mac) {
+		return nil, err
+	}
+	return mac, nil
+}
+
+// Release frees the address of the attachment. Releasing an attachment
+// without an address is not an error.
+func (p *Pool) Release(containerID, ifName string) error {
+	if _, err := os.Stat(p.dataDir()); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	store, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return release(store, attachments.ID(containerID, ifName))
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package macpool_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/plugins/pkg/macpool"
+)
+
+var _ = Describe("Pool", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "macpool")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	It("validates the pool", func() {
+		pool := &macpool.Pool{Prefix: "02:42:0a"}
+		Expect(pool.Canonicalize()).To(Succeed())
+
+		for _, p := range []macpool.Pool{
+			{Prefix: "01:00:5e"},
+			{Prefix: "02:42:0a:00:00:00"},
+			{Prefix: "2:42"},
+			{Prefix: "02:42", RangeStart: "02:43:00:00:00:00"},
+			{Prefix: "02:42", RangeStart: "02:42:00:00:00:10", RangeEnd: "02:42:00:00:00:01"},
+		} {
+			Expect(p.Canonicalize()).NotTo(Succeed(), p.Prefix)
+		}
+	})
+
+	It("allocates stable and unique addresses", func() {
+		pool := &macpool.Pool{
+			Prefix:     "02:42:0a",
+			RangeStart: "02:42:0a:00:00:01",
+			RangeEnd:   "02:42:0a:00:00:02",
+			DataDir:    dataDir,
+		}
+		Expect(pool.Canonicalize()).To(Succeed())
+
+		macA, err := pool.Allocate("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		again, err := pool.Allocate("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(macA))
+		allocated, err := pool.Allocated("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allocated).To(Equal(macA))
+
+		macB, err := pool.Allocate("b", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(macB).NotTo(Equal(macA))
+		for _, mac := range []net.HardwareAddr{macA, macB} {
+			Expect(mac.String()).To(HavePrefix("02:42:0a:00:00:0"))
+		}
+
+		_, err = pool.Allocate("c", "net1")
+		Expect(err).To(MatchError("no MAC address left in pool 02:42:0a"))
+
+		Expect(pool.Release("a", "net1")).To(Succeed())
+		allocated, err = pool.Allocated("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allocated).To(BeNil())
+		macC, err := pool.Allocate("c", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(macC).To(Equal(macA))
+
+		// Releasing an unknown attachment is a no-op
+		Expect(pool.Release("a", "net1")).To(Succeed())
+	})
+
+	It("shares the addresses between the pools of a data directory", func() {
+		wide := &macpool.Pool{Prefix: "02:42:0a:00:00", DataDir: dataDir}
+		Expect(wide.Canonicalize()).To(Succeed())
+		narrow := &macpool.Pool{
+			Prefix:     "02:42:0a",
+			RangeStart: "02:42:0a:00:00:01",
+			RangeEnd:   "02:42:0a:00:00:01",
+			DataDir:    dataDir,
+		}
+		Expect(narrow.Canonicalize()).To(Succeed())
+
+		mac, err := narrow.Allocate("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mac.String()).To(Equal("02:42:0a:00:00:01"))
+
+		for i := 0; i < 255; i++ {
+			mac, err := wide.Allocate("b", fmt.Sprintf("net%d", i))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mac.String()).NotTo(Equal("02:42:0a:00:00:01"))
+		}
+		_, err = wide.Allocate("c", "net1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reallocates an address left outside of the pool by a change of the pool", func() {
+		pool := &macpool.Pool{
+			Prefix:     "02:42:0a",
+			RangeStart: "02:42:0a:00:00:01",
+			RangeEnd:   "02:42:0a:00:00:01",
+			DataDir:    dataDir,
+		}
+		Expect(pool.Canonicalize()).To(Succeed())
+		mac, err := pool.Allocate("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mac.String()).To(Equal("02:42:0a:00:00:01"))
+
+		pool = &macpool.Pool{
+			Prefix:     "02:42:0b",
+			RangeStart: "02:42:0b:00:00:01",
+			RangeEnd:   "02:42:0b:00:00:01",
+			DataDir:    dataDir,
+		}
+		Expect(pool.Canonicalize()).To(Succeed())
+		// The address of the earlier pool is not one of this pool
+		allocated, err := pool.Allocated("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allocated).To(BeNil())
+
+		mac, err = pool.Allocate("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mac.String()).To(Equal("02:42:0b:00:00:01"))
+
+		// The address of the earlier pool is free again
+		Expect(filepath.Join(dataDir, "macs", "02:42:0a:00:00:01")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(dataDir, "attachments", "a_net1")).To(BeAnExistingFile())
+	})
+
+	It("releases nothing before the first allocation", func() {
+		pool := &macpool.Pool{Prefix: "02:42:0a", DataDir: filepath.Join(dataDir, "none")}
+		Expect(pool.Canonicalize()).To(Succeed())
+		Expect(pool.Release("a", "net1")).To(Succeed())
+		allocated, err := pool.Allocated("a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allocated).To(BeNil())
+		Expect(pool.DataDir).NotTo(BeADirectory())
+	})
+})
@@ -210,6 +210,39 @@ func (h *Handle) QdiscList(link netlink.Link) ([]netlink.Qdisc, error) {
 	return qdisc, err
 }
 
+// ClassList calls netlink.ClassList, retrying if necessary.
+func ClassList(link netlink.Link, parent uint32) ([]netlink.Class, error) {
+	var classes []netlink.Class
+	var err error
+	retryOnIntr(func() error {
+		classes, err = netlink.ClassList(link, parent) //nolint:forbidigo
+		return err
+	})
+	return classes, discardErrDumpInterrupted(err)
+}
+
+// ClassList calls h.Handle.ClassList, retrying if necessary.
+func (h *Handle) ClassList(link netlink.Link, parent uint32) ([]netlink.Class, error) {
+	var classes []netlink.Class
+	var err error
+	retryOnIntr(func() error {
+		classes, err = h.Handle.ClassList(link, parent) //nolint:forbidigo
+		return err
+	})
+	return classes, err
+}
+
+// RdmaLinkByName calls netlink.RdmaLinkByName, retrying if necessary.
+func RdmaLinkByName(name string) (*netlink.RdmaLink, error) {
+	var link *netlink.RdmaLink
+	var err error
+	retryOnIntr(func() error {
+		link, err = netlink.RdmaLinkByName(name) //nolint:forbidigo
+		return err
+	})
+	return link, discardErrDumpInterrupted(err)
+}
+
 // LinkGetProtinfo calls netlink.LinkGetProtinfo, retrying if necessary.
 func LinkGetProtinfo(link netlink.Link) (netlink.Protinfo, error) {
 	var protinfo netlink.Protinfo
@@ -319,3 +352,47 @@ func (h *Handle) ConntrackDeleteFilters(table netlink.ConntrackTableType, family
 	})
 	return deleted, err
 }
+
+// NeighList calls netlink.NeighList, retrying if necessary.
+func NeighList(linkIndex, family int) ([]netlink.Neigh, error) {
+	var neighs []netlink.Neigh
+	var err error
+	retryOnIntr(func() error {
+		neighs, err = netlink.NeighList(linkIndex, family) //nolint:forbidigo
+		return err
+	})
+	return neighs, discardErrDumpInterrupted(err)
+}
+
+// NeighProxyList calls netlink.NeighProxyList, retrying if necessary.
+func NeighProxyList(linkIndex, family int) ([]netlink.Neigh, error) {
+	var neighs []netlink.Neigh
+	var err error
+	retryOnIntr(func() error {
+		neighs, err = netlink.NeighProxyList(linkIndex, family) //nolint:forbidigo
+		return err
+	})
+	return neighs, discardErrDumpInterrupted(err)
+}
+
+// XfrmStateList calls netlink.XfrmStateList, retrying if necessary.
+func XfrmStateList(family int) ([]netlink.XfrmState, error) {
+	var states []netlink.XfrmState
+	var err error
+	retryOnIntr(func() error {
+		states, err = netlink.XfrmStateList(family) //nolint:forbidigo
+		return err
+	})
+	return states, discardErrDumpInterrupted(err)
+}
+
+// XfrmPolicyList calls netlink.XfrmPolicyList, retrying if necessary.
+func XfrmPolicyList(family int) ([]netlink.XfrmPolicy, error) {
+	var policies []netlink.XfrmPolicy
+	var err error
+	retryOnIntr(func() error {
+		policies, err = netlink.XfrmPolicyList(family) //nolint:forbidigo
+		return err
+	})
+	return policies, discardErrDumpInterrupted(err)
+}
@@ -0,0 +1,170 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlinksafe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// LinkSelector identifies a link by the identifiers recorded for it, some of
+// which may be stale by the time it is looked up: the link may have been
+// renamed, or moved away and back and got a new index.
+type LinkSelector struct {
+	// Name is the name or an alternative name of the link
+	Name string
+	// Index is the index of the link. It is only trusted when the
+	// permanent MAC address, if set, matches too, since indexes are reused.
+	Index int
+	// PermHardwareAddr is the permanent MAC address of the link, as
+	// reported by ethtool -P. Virtual links have none.
+	PermHardwareAddr net.HardwareAddr
+}
+
+func (s LinkSelector) String() string {
+	var ids []string
+	if s.Name != "" {
+		ids = append(ids, "name "+s.Name)
+	}
+	if s.Index != 0 {
+		ids = append(ids, fmt.Sprintf("index %d", s.Index))
+	}
+	if len(s.PermHardwareAddr) > 0 {
+		ids = append(ids, "permanent MAC "+s.PermHardwareAddr.String())
+	}
+	return strings.Join(ids, ", ")
+}
+
+// LinkNotFoundError is returned by LinkByAny when no link matches
+type LinkNotFoundError struct {
+	Selector LinkSelector
+}
+
+func (e *LinkNotFoundError) Error() string {
+	return fmt.Sprintf("no link found with %s", e.Selector)
+}
+
+// AmbiguousLinkError is returned by LinkByAny when several links match
+// the permanent MAC address
+type AmbiguousLinkError struct {
+	Selector LinkSelector
+	// Links are the names of the matching links
+	Links []string
+}
+
+func (e *AmbiguousLinkError) Error() string {
+	return fmt.Sprintf("links %s all match %s", strings.Join(e.Links, ", "), e.Selector)
+}
+
+// linkGetter holds the lookups of the package functions or of a Handle
+type linkGetter struct {
+	byName  func(string) (netlink.Link, error)
+	byIndex func(int) (netlink.Link, error)
+	list    func() ([]netlink.Link, error)
+}
+
+// LinkByAny looks up the link of the selector by name or alternative name,
+// then by index, then by permanent MAC address. It returns a
+// *LinkNotFoundError when nothing matches and an *AmbiguousLinkError when
+// the permanent MAC address matches several links.
+func LinkByAny(s LinkSelector) (netlink.Link, error) {
+	return linkGetter{
+		byName:  LinkByName,
+		byIndex: netlink.LinkByIndex,
+		list:    LinkList,
+	}.linkByAny(s)
+}
+
+// LinkByAny is LinkByAny in the namespace of the handle
+func (h Handle) LinkByAny(s LinkSelector) (netlink.Link, error) {
+	return linkGetter{
+		byName:  h.LinkByName,
+		byIndex: h.Handle.LinkByIndex,
+		list:    h.LinkList,
+	}.linkByAny(s)
+}
+
+func (g linkGetter) linkByAny(s LinkSelector) (netlink.Link, error) {
+	if s.Name == "" && s.Index == 0 && len(s.PermHardwareAddr) == 0 {
+		return nil, fmt.Errorf("empty link selector")
+	}
+
+	notFound := func(err error) bool {
+		var nf netlink.LinkNotFoundError
+		return errors.As(err, &nf)
+	}
+
+	// The kernel resolves the alternative names too
+	if s.Name != "" {
+		link, err := g.byName(s.Name)
+		if err == nil {
+			return link, nil
+		}
+		if !notFound(err) {
+			return nil, err
+		}
+	}
+
+	if s.Index != 0 {
+		link, err := g.byIndex(s.Index)
+		if err == nil && (len(s.PermHardwareAddr) == 0 || bytes.Equal(link.Attrs().PermHWAddr, s.PermHardwareAddr)) {
+			return link, nil
+		}
+		if err != nil && !notFound(err) {
+			return nil, err
+		}
+	}
+
+	// Scan the links, for the permanent MAC address and for the alternative
+	// names on kernels not resolving them
+	if len(s.PermHardwareAddr) == 0 && s.Name == "" {
+		return nil, &LinkNotFoundError{Selector: s}
+	}
+	links, err := g.list()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %v", err)
+	}
+	var matches []netlink.Link
+	for _, link := range links {
+		attrs := link.Attrs()
+		if s.Name != "" {
+			for _, alt := range attrs.AltNames {
+				if alt == s.Name {
+					return link, nil
+				}
+			}
+		}
+		if len(s.PermHardwareAddr) > 0 && bytes.Equal(attrs.PermHWAddr, s.PermHardwareAddr) {
+			matches = append(matches, link)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, &LinkNotFoundError{Selector: s}
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, link := range matches {
+		names = append(names, link.Attrs().Name)
+	}
+	return nil, &AmbiguousLinkError{Selector: s, Links: names}
+}
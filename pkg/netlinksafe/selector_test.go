@@ -0,0 +1,155 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlinksafe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+var _ = Describe("LinkByAny", func() {
+	var testNS ns.NetNS
+	var index int
+
+	BeforeEach(func() {
+		var err error
+		testNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "eth0"
+			Expect(netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: "eth1"})).To(Succeed())
+			link, err := LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkAddAltName(link, "uplink")).To(Succeed())
+			index = link.Attrs().Index
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(testNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(testNS)).To(Succeed())
+	})
+
+	lookup := func(s LinkSelector) (netlink.Link, error) {
+		var link netlink.Link
+		err := testNS.Do(func(ns.NetNS) error {
+			var err error
+			link, err = LinkByAny(s)
+			return err
+		})
+		return link, err
+	}
+
+	It("finds a link by name", func() {
+		link, err := lookup(LinkSelector{Name: "eth0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link.Attrs().Index).To(Equal(index))
+	})
+
+	It("finds a link by alternative name", func() {
+		link, err := lookup(LinkSelector{Name: "uplink"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link.Attrs().Name).To(Equal("eth0"))
+	})
+
+	It("falls back to the index of a renamed link", func() {
+		link, err := lookup(LinkSelector{Name: "old0", Index: index})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link.Attrs().Name).To(Equal("eth0"))
+	})
+
+	It("does not trust an index whose permanent MAC differs", func() {
+		mac, _ := net.ParseMAC("02:00:00:00:00:01")
+		_, err := lookup(LinkSelector{Name: "old0", Index: index, PermHardwareAddr: mac})
+		var notFound *LinkNotFoundError
+		Expect(errors.As(err, &notFound)).To(BeTrue())
+		Expect(err).To(MatchError(fmt.Sprintf("no link found with name old0, index %d, permanent MAC 02:00:00:00:00:01", index)))
+	})
+
+	It("reports a missing link", func() {
+		_, err := lookup(LinkSelector{Name: "missing0"})
+		var notFound *LinkNotFoundError
+		Expect(errors.As(err, &notFound)).To(BeTrue())
+		Expect(err).To(MatchError("no link found with name missing0"))
+	})
+
+	It("rejects an empty selector", func() {
+		_, err := lookup(LinkSelector{})
+		Expect(err).To(MatchError("empty link selector"))
+	})
+
+	Context("by permanent MAC address", func() {
+		mac, _ := net.ParseMAC("0c:42:a1:00:00:01")
+		withPermMac := func(name string, index int, permMac net.HardwareAddr) netlink.Link {
+			attrs := netlink.NewLinkAttrs()
+			attrs.Name = name
+			attrs.Index = index
+			attrs.PermHWAddr = permMac
+			return &netlink.Device{LinkAttrs: attrs}
+		}
+		getter := func(links ...netlink.Link) linkGetter {
+			notFound := func() error {
+				_, err := LinkByName("no-such-link-anywhere")
+				return err
+			}
+			return linkGetter{
+				byName: func(string) (netlink.Link, error) {
+					return nil, notFound()
+				},
+				byIndex: func(i int) (netlink.Link, error) {
+					for _, l := range links {
+						if l.Attrs().Index == i {
+							return l, nil
+						}
+					}
+					return nil, notFound()
+				},
+				list: func() ([]netlink.Link, error) {
+					return links, nil
+				},
+			}
+		}
+
+		It("finds the link with the permanent MAC", func() {
+			g := getter(withPermMac("ens1", 5, nil), withPermMac("ens2", 6, mac))
+			link, err := g.linkByAny(LinkSelector{Name: "eth0", Index: 5, PermHardwareAddr: mac})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().Name).To(Equal("ens2"))
+		})
+
+		It("reports several links with the permanent MAC", func() {
+			g := getter(withPermMac("ens1", 5, mac), withPermMac("ens2", 6, mac))
+			_, err := g.linkByAny(LinkSelector{PermHardwareAddr: mac})
+			var ambiguous *AmbiguousLinkError
+			Expect(errors.As(err, &ambiguous)).To(BeTrue())
+			Expect(ambiguous.Links).To(Equal([]string{"ens1", "ens2"}))
+			Expect(err).To(MatchError("links ens1, ens2 all match permanent MAC 0c:42:a1:00:00:01"))
+		})
+	})
+})
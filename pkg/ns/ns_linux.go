@@ -20,6 +20,7 @@ import (
 	"runtime"
 	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -141,9 +142,45 @@ func IsNSorErr(nspath string) error {
 	}
 }
 
-// Returns an object representing the namespace referred to by @path
-func GetNS(nspath string) (NetNS, error) {
+// retryInterval is how often a missing namespace path is polled when
+// RetryOnNotExist is in effect
+const retryInterval = 50 * time.Millisecond
+
+type nsOptions struct {
+	retryTimeout time.Duration
+}
+
+// NSOption tunes how GetNS and WithNetNSPath open a namespace path
+type NSOption func(*nsOptions)
+
+// RetryOnNotExist makes opening the namespace retry for up to timeout while
+// the path does not exist yet or is not yet bind-mounted, which happens when
+// the runtime invokes the plugin before it finished setting up the netns.
+func RetryOnNotExist(timeout time.Duration) NSOption {
+	return func(o *nsOptions) {
+		o.retryTimeout = timeout
+	}
+}
+
+// Returns an object representing the namespace referred to by @path. The
+// path may also refer to a pidfd of this process, e.g. /proc/self/fd/3, in
+// which case the namespace is the one of the process of the pidfd.
+func GetNS(nspath string, opts ...NSOption) (NetNS, error) {
+	if pidfd, ok := pidfdFromPath(nspath); ok {
+		return GetNSFromPidfd(pidfd)
+	}
+
+	o := nsOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	deadline := time.Now().Add(o.retryTimeout)
 	err := IsNSorErr(nspath)
+	for err != nil && isRetriableNSErr(err) && time.Now().Before(deadline) {
+		time.Sleep(retryInterval)
+		err = IsNSorErr(nspath)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +193,14 @@ func GetNS(nspath string) (NetNS, error) {
 	return &netNS{file: fd}, nil
 }
 
+func isRetriableNSErr(err error) bool {
+	switch err.(type) {
+	case NSPathNotExistErr, NSPathNotNSErr:
+		return true
+	}
+	return false
+}
+
 // Returns a new empty NetNS.
 // Calling Close() let the kernel garbage collect the network namespace.
 func TempNetNS() (NetNS, error) {
@@ -276,8 +321,8 @@ func (ns *netNS) Do(toRun func(NetNS) error) error {
 
 // WithNetNSPath executes the passed closure under the given network
 // namespace, restoring the original namespace afterwards.
-func WithNetNSPath(nspath string, toRun func(NetNS) error) error {
-	ns, err := GetNS(nspath)
+func WithNetNSPath(nspath string, toRun func(NetNS) error, opts ...NSOption) error {
+	ns, err := GetNS(nspath, opts...)
 	if err != nil {
 		return err
 	}
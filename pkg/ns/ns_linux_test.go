@@ -18,8 +18,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sync"
+	"syscall"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -252,6 +255,92 @@ var _ = Describe("Linux namespace operations", func() {
 		})
 	})
 
+	Describe("GetNS with RetryOnNotExist", func() {
+		It("waits for the namespace path to appear", func() {
+			tempDir, err := os.MkdirTemp("", "nstest")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tempDir)
+
+			nspath := filepath.Join(tempDir, "netns")
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(200 * time.Millisecond)
+				Expect(os.Symlink("/proc/self/ns/net", nspath)).To(Succeed())
+			}()
+
+			netns, err := ns.GetNS(nspath, ns.RetryOnNotExist(5*time.Second))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netns.Close()).To(Succeed())
+		})
+
+		It("gives up after the timeout", func() {
+			start := time.Now()
+			_, err := ns.GetNS("/tmp/IDoNotExist", ns.RetryOnNotExist(200*time.Millisecond))
+			Expect(err).To(BeAssignableToTypeOf(ns.NSPathNotExistErr{}))
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+	})
+
+	Describe("GetNSFromPidfd", func() {
+		var (
+			cmd   *exec.Cmd
+			pidfd int
+		)
+
+		BeforeEach(func() {
+			cmd = exec.Command("sleep", "60")
+			cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: unix.CLONE_NEWNET}
+			Expect(cmd.Start()).To(Succeed())
+
+			var err error
+			pidfd, err = unix.PidfdOpen(cmd.Process.Pid, 0)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			unix.Close(pidfd)
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+
+		It("returns the network namespace of the process", func() {
+			expectedInode, err := getInode(fmt.Sprintf("/proc/%d/ns/net", cmd.Process.Pid))
+			Expect(err).NotTo(HaveOccurred())
+
+			netns, err := ns.GetNSFromPidfd(pidfd)
+			Expect(err).NotTo(HaveOccurred())
+			defer netns.Close()
+			Expect(getInodeNS(netns)).To(Equal(expectedInode))
+
+			var actualInode uint64
+			err = netns.Do(func(ns.NetNS) error {
+				var err error
+				actualInode, err = getInodeCurNetNS()
+				return err
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actualInode).To(Equal(expectedInode))
+		})
+
+		It("accepts the path of the pidfd", func() {
+			expectedInode, err := getInode(fmt.Sprintf("/proc/%d/ns/net", cmd.Process.Pid))
+			Expect(err).NotTo(HaveOccurred())
+
+			netns, err := ns.GetNS(fmt.Sprintf("/proc/self/fd/%d", pidfd))
+			Expect(err).NotTo(HaveOccurred())
+			defer netns.Close()
+			Expect(getInodeNS(netns)).To(Equal(expectedInode))
+		})
+
+		It("reports a process that has exited as a missing namespace", func() {
+			Expect(cmd.Process.Kill()).To(Succeed())
+			_ = cmd.Wait()
+
+			_, err := ns.GetNSFromPidfd(pidfd)
+			Expect(err).To(BeAssignableToTypeOf(ns.NSPathNotExistErr{}))
+		})
+	})
+
 	Describe("IsNSorErr", func() {
 		It("should detect a namespace", func() {
 			createdNetNS, err := testutils.NewNS()
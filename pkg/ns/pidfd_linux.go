@@ -0,0 +1,144 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ns
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// https://github.com/torvalds/linux/blob/master/include/uapi/linux/magic.h
+	PIDFS_MAGIC = 0x50494446
+
+	// PIDFD_GET_NET_NAMESPACE from include/uapi/linux/pidfd.h, available
+	// since Linux 6.11
+	pidfdGetNetNamespace = 0xFF<<8 | 4
+)
+
+// fdPathRegexp matches the paths of the file descriptors of the process,
+// through which a runtime may hand over a pidfd
+var fdPathRegexp = regexp.MustCompile(`^/(?:proc/(self|thread-self|\d+)|dev)/fd/(\d+)$`)
+
+// GetNSFromPidfd returns an object representing the network namespace of
+// the process referred to by pidfd. Unlike /proc/<pid>/ns/net, a pidfd
+// keeps referring to the same process even if its PID is recycled. The
+// pidfd is not closed.
+func GetNSFromPidfd(pidfd int) (NetNS, error) {
+	nsfd, err := unix.IoctlRetInt(pidfd, pidfdGetNetNamespace)
+	switch err {
+	case nil:
+		return &netNS{file: os.NewFile(uintptr(nsfd), fmt.Sprintf("/proc/self/fd/%d", nsfd))}, nil
+	case unix.ESRCH:
+		return nil, NSPathNotExistErr{msg: fmt.Sprintf("process of pidfd %d has exited", pidfd)}
+	case unix.ENOTTY, unix.EINVAL, unix.EOPNOTSUPP:
+		// Older kernel, go through procfs
+	default:
+		return nil, fmt.Errorf("failed to get the network namespace of pidfd %d: %v", pidfd, err)
+	}
+
+	pid, err := pidfdPid(pidfd)
+	if err != nil {
+		return nil, err
+	}
+	nspath := fmt.Sprintf("/proc/%d/ns/net", pid)
+	file, err := os.Open(nspath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NSPathNotExistErr{msg: fmt.Sprintf("process of pidfd %d has exited", pidfd)}
+		}
+		return nil, err
+	}
+	// The PID may have been recycled between reading and opening it. The
+	// pidfd can no longer be signaled once its process has exited, so the
+	// namespace opened is the right one if the signal is delivered.
+	if err := unix.PidfdSendSignal(pidfd, 0, nil, 0); err != nil {
+		file.Close()
+		if err == unix.ESRCH {
+			return nil, NSPathNotExistErr{msg: fmt.Sprintf("process of pidfd %d has exited", pidfd)}
+		}
+		return nil, fmt.Errorf("failed to check process of pidfd %d: %v", pidfd, err)
+	}
+	return &netNS{file: file}, nil
+}
+
+// pidfdPid returns the PID of the process referred to by pidfd, as seen in
+// the PID namespace of the caller
+func pidfdPid(pidfd int) (int, error) {
+	fdinfo, err := os.Open(fmt.Sprintf("/proc/self/fdinfo/%d", pidfd))
+	if err != nil {
+		return 0, err
+	}
+	defer fdinfo.Close()
+
+	scanner := bufio.NewScanner(fdinfo)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "Pid:")
+		if !found {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return 0, fmt.Errorf("invalid PID in fdinfo of pidfd %d: %v", pidfd, err)
+		}
+		switch {
+		case pid < 0:
+			return 0, NSPathNotExistErr{msg: fmt.Sprintf("process of pidfd %d has exited", pidfd)}
+		case pid == 0:
+			return 0, fmt.Errorf("process of pidfd %d is not in the PID namespace of the caller", pidfd)
+		}
+		return pid, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("fd %d is not a pidfd", pidfd)
+}
+
+// pidfdFromPath returns the file descriptor referred to by nspath if it is
+// a path to a pidfd of this process, such as /proc/self/fd/<pidfd>
+func pidfdFromPath(nspath string) (int, bool) {
+	m := fdPathRegexp.FindStringSubmatch(nspath)
+	if m == nil {
+		return 0, false
+	}
+	if owner := m[1]; owner != "" && owner != "self" && owner != "thread-self" && owner != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	fd, err := strconv.Atoi(m[2])
+	if err != nil {
+		return 0, false
+	}
+	return fd, isPidfd(fd)
+}
+
+func isPidfd(fd int) bool {
+	stat := unix.Statfs_t{}
+	if err := unix.Fstatfs(fd, &stat); err != nil {
+		return false
+	}
+	if stat.Type == PIDFS_MAGIC {
+		return true
+	}
+	// Before Linux 6.9, pidfds are anonymous inodes
+	target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	return err == nil && target == "anon_inode:[pidfd]"
+}
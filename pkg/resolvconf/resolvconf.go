@@ -0,0 +1,132 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resolvconf reads and writes the DNS configuration of the CNI
+// results in the resolv.conf format, and merges the DNS of several
+// attachments.
+package resolvconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// Parse parses the resolv.conf format
+func Parse(r io.Reader) (*types.DNS, error) {
+	dns := types.DNS{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip comments, empty lines
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			dns.Nameservers = append(dns.Nameservers, fields[1])
+		case "domain":
+			dns.Domain = fields[1]
+		case "search":
+			dns.Search = append(dns.Search, fields[1:]...)
+		case "options":
+			dns.Options = append(dns.Options, fields[1:]...)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &dns, nil
+}
+
+// ParseFile parses an existing resolv.conf in to a DNS struct
+func ParseFile(filename string) (*types.DNS, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	return Parse(fp)
+}
+
+// Format renders the DNS in the resolv.conf format
+func Format(dns *types.DNS) []byte {
+	var b strings.Builder
+	if dns.Domain != "" {
+		fmt.Fprintf(&b, "domain %s\n", dns.Domain)
+	}
+	if len(dns.Search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Search, " "))
+	}
+	for _, ns := range dns.Nameservers {
+		fmt.Fprintf(&b, "nameserver %s\n", ns)
+	}
+	if len(dns.Options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+	}
+	return []byte(b.String())
+}
+
+// Merge merges the DNS configurations in order. The first domain wins, the
+// nameservers and search domains are appended unless already there, and
+// for options, the first value of an option wins.
+func Merge(configs ...types.DNS) types.DNS {
+	merged := types.DNS{}
+	optionSet := map[string]bool{}
+	for _, dns := range configs {
+		if merged.Domain == "" {
+			merged.Domain = dns.Domain
+		}
+		merged.Nameservers = AppendUnique(merged.Nameservers, dns.Nameservers...)
+		merged.Search = AppendUnique(merged.Search, dns.Search...)
+		for _, o := range dns.Options {
+			name, _, _ := strings.Cut(o, ":")
+			if !optionSet[name] {
+				optionSet[name] = true
+				merged.Options = append(merged.Options, o)
+			}
+		}
+	}
+	return merged
+}
+
+// AppendUnique appends the values not in the list yet
+func AppendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -12,15 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package resolvconf_test
 
 import (
-	"os"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/pkg/resolvconf"
 )
 
 var _ = Describe("parsing resolv.conf", func() {
@@ -63,17 +64,42 @@ options four
 	})
 })
 
-func parse(contents string) (*types.DNS, error) {
-	f, err := os.CreateTemp("", "host_local_resolv")
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	defer os.Remove(f.Name())
+var _ = Describe("formatting resolv.conf", func() {
+	It("formats what it parses", func() {
+		dns := &types.DNS{
+			Nameservers: []string{"192.0.2.0", "192.0.2.2"},
+			Domain:      "example.com",
+			Search:      []string{"example.net", "example.org"},
+			Options:     []string{"ndots:2", "edns0"},
+		}
+		Expect(string(resolvconf.Format(dns))).To(Equal(`domain example.com
+search example.net example.org
+nameserver 192.0.2.0
+nameserver 192.0.2.2
+options ndots:2 edns0
+`))
+		parsed, err := parse(string(resolvconf.Format(dns)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(dns))
+	})
+})
 
-	if _, err := f.WriteString(contents); err != nil {
-		return nil, err
-	}
+var _ = Describe("merging DNS configurations", func() {
+	It("keeps the first domain and option values", func() {
+		merged := resolvconf.Merge(
+			types.DNS{Nameservers: []string{"10.0.0.1"}, Search: []string{"a.example"}, Options: []string{"ndots:2"}},
+			types.DNS{Nameservers: []string{"10.0.0.2", "10.0.0.1"}, Domain: "example.com", Search: []string{"b.example", "a.example"}, Options: []string{"ndots:5", "edns0"}},
+			types.DNS{Domain: "example.org"},
+		)
+		Expect(merged).To(Equal(types.DNS{
+			Nameservers: []string{"10.0.0.1", "10.0.0.2"},
+			Domain:      "example.com",
+			Search:      []string{"a.example", "b.example"},
+			Options:     []string{"ndots:2", "edns0"},
+		}))
+	})
+})
 
-	return parseResolvConf(f.Name())
+func parse(contents string) (*types.DNS, error) {
+	return resolvconf.Parse(strings.NewReader(contents))
 }
@@ -0,0 +1,145 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sriov
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Settings are the settings of a VF set through its PF. The settings left
+// unset are not changed.
+type Settings struct {
+	MAC       string `json:"mac,omitempty"`
+	VLAN      *int   `json:"vlan,omitempty"`
+	VLANQoS   *int   `json:"vlanQoS,omitempty"`
+	VLANProto int    `json:"vlanProto,omitempty"`
+	SpoofChk  *bool  `json:"spoofchk,omitempty"`
+	Trust     *bool  `json:"trust,omitempty"`
+	// MinTxRate and MaxTxRate are in Mbps, 0 for no limit
+	MinTxRate *int    `json:"minTxRate,omitempty"`
+	MaxTxRate *int    `json:"maxTxRate,omitempty"`
+	LinkState *uint32 `json:"linkState,omitempty"`
+}
+
+// VFInfo returns the settings of the VF reported by its PF, or nil if the
+// PF reports none
+func VFInfo(pf netlink.Link, vf int) *netlink.VfInfo {
+	for i := range pf.Attrs().Vfs {
+		if pf.Attrs().Vfs[i].ID == vf {
+			return &pf.Attrs().Vfs[i]
+		}
+	}
+	return nil
+}
+
+// Current returns the current values of the settings set in s, so that
+// they can be restored once the VF is released
+func Current(info *netlink.VfInfo, s *Settings) *Settings {
+	current := &Settings{}
+	if s.MAC != "" {
+		current.MAC = info.Mac.String()
+	}
+	if s.VLAN != nil {
+		vlan, qos := info.Vlan, info.Qos
+		current.VLAN = &vlan
+		current.VLANQoS = &qos
+		current.VLANProto = info.VlanProto
+	}
+	if s.SpoofChk != nil {
+		spoofChk := info.Spoofchk
+		current.SpoofChk = &spoofChk
+	}
+	if s.Trust != nil {
+		trust := info.Trust != 0
+		current.Trust = &trust
+	}
+	if s.MinTxRate != nil || s.MaxTxRate != nil {
+		minRate, maxRate := int(info.MinTxRate), int(info.MaxTxRate)
+		current.MinTxRate = &minRate
+		current.MaxTxRate = &maxRate
+	}
+	if s.LinkState != nil {
+		linkState := info.LinkState
+		current.LinkState = &linkState
+	}
+	return current
+}
+
+// Configure applies the settings to the VF through its PF
+func Configure(pf netlink.Link, vf int, s *Settings) error {
+	if s == nil {
+		return nil
+	}
+	pfName := pf.Attrs().Name
+	if s.MAC != "" {
+		mac, err := net.ParseMAC(s.MAC)
+		if err != nil {
+			return fmt.Errorf("invalid MAC address %q: %v", s.MAC, err)
+		}
+		if err := netlink.LinkSetVfHardwareAddr(pf, vf, mac); err != nil {
+			return fmt.Errorf("failed to set MAC address of VF %d of %q: %v", vf, pfName, err)
+		}
+	}
+	if s.VLAN != nil {
+		qos := 0
+		if s.VLANQoS != nil {
+			qos = *s.VLANQoS
+		}
+		var err error
+		if s.VLANProto == 0 {
+			err = netlink.LinkSetVfVlanQos(pf, vf, *s.VLAN, qos)
+		} else {
+			err = netlink.LinkSetVfVlanQosProto(pf, vf, *s.VLAN, qos, s.VLANProto)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set VLAN of VF %d of %q: %v", vf, pfName, err)
+		}
+	}
+	if s.SpoofChk != nil {
+		if err := netlink.LinkSetVfSpoofchk(pf, vf, *s.SpoofChk); err != nil {
+			return fmt.Errorf("failed to set spoof checking of VF %d of %q: %v", vf, pfName, err)
+		}
+	}
+	if s.Trust != nil {
+		if err := netlink.LinkSetVfTrust(pf, vf, *s.Trust); err != nil {
+			return fmt.Errorf("failed to set trust of VF %d of %q: %v", vf, pfName, err)
+		}
+	}
+	if s.MinTxRate != nil || s.MaxTxRate != nil {
+		info := VFInfo(pf, vf)
+		if info == nil {
+			return fmt.Errorf("failed to find VF %d of %q", vf, pfName)
+		}
+		minRate, maxRate := int(info.MinTxRate), int(info.MaxTxRate)
+		if s.MinTxRate != nil {
+			minRate = *s.MinTxRate
+		}
+		if s.MaxTxRate != nil {
+			maxRate = *s.MaxTxRate
+		}
+		if err := netlink.LinkSetVfRate(pf, vf, minRate, maxRate); err != nil {
+			return fmt.Errorf("failed to set rate of VF %d of %q: %v", vf, pfName, err)
+		}
+	}
+	if s.LinkState != nil {
+		if err := netlink.LinkSetVfState(pf, vf, *s.LinkState); err != nil {
+			return fmt.Errorf("failed to set link state of VF %d of %q: %v", vf, pfName, err)
+		}
+	}
+	return nil
+}
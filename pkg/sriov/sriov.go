@@ -0,0 +1,167 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sriov looks up the SR-IOV virtual functions (VFs) of a physical
+// function (PF) and reserves them to attachments.
+//
+// The reservations of all the plugins handing VFs to containers are kept in
+// one store, so that they never hand out the same VF. A VF is reserved
+// under its PCI address, which is unique on the host and stays the same
+// when the PF is renamed.
+package sriov
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+var (
+	SysBusPCI   = "/sys/bus/pci/devices"
+	SysClassNet = "/sys/class/net"
+
+	// ReservationDir is the store of the VF reservations. It is on tmpfs,
+	// as no VF is in use by a container after a reboot.
+	ReservationDir = "/run/cni/vf-reservations"
+)
+
+// PFVFs returns the PCI addresses of the VFs of the PF, by VF index
+func PFVFs(pf string) (map[int]string, error) {
+	links, err := filepath.Glob(filepath.Join(SysClassNet, pf, "device", "virtfn*"))
+	if err != nil {
+		return nil, err
+	}
+	vfs := map[int]string{}
+	for _, link := range links {
+		index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(link), "virtfn"))
+		if err != nil {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve VF %d of %q: %v", index, pf, err)
+		}
+		vfs[index] = filepath.Base(target)
+	}
+	if len(vfs) == 0 {
+		return nil, fmt.Errorf("%q has no SR-IOV VFs", pf)
+	}
+	return vfs, nil
+}
+
+// VFOfDevice returns the PF and the index of the VF at the PCI address
+func VFOfDevice(pciAddr string) (string, int, error) {
+	pfs, err := os.ReadDir(filepath.Join(SysBusPCI, pciAddr, "physfn", "net"))
+	if err != nil || len(pfs) == 0 {
+		return "", 0, fmt.Errorf("%s is not an SR-IOV VF with a PF network interface", pciAddr)
+	}
+	pf := pfs[0].Name()
+	vfs, err := PFVFs(pf)
+	if err != nil {
+		return "", 0, err
+	}
+	for index, addr := range vfs {
+		if addr == pciAddr {
+			return pf, index, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%s is not a VF of %q", pciAddr, pf)
+}
+
+// VFNetdev returns the name of the network interface of the VF in the
+// current namespace, or "" if it has none, e.g. as it is in use by a
+// container or bound to a userspace driver
+func VFNetdev(pciAddr string) string {
+	entries, err := os.ReadDir(filepath.Join(SysBusPCI, pciAddr, "net"))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(SysClassNet, entry.Name())); err == nil {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+// ReserveVF reserves to the attachment the VF of the PF with the index if
+// set, or else the first VF which is neither reserved nor in use. VFs
+// without a network interface in the current namespace are in use. It
+// returns the index of the VF and its PCI address.
+func ReserveVF(pf string, index *int, containerID, ifName string) (int, string, error) {
+	vfs, err := PFVFs(pf)
+	if err != nil {
+		return 0, "", err
+	}
+	indexes := make([]int, 0, len(vfs))
+	if index != nil {
+		if _, ok := vfs[*index]; !ok {
+			return 0, "", fmt.Errorf("%q has no VF %d", pf, *index)
+		}
+		indexes = append(indexes, *index)
+	} else {
+		for i := range vfs {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+	}
+
+	store, err := attachments.Open(ReservationDir)
+	if err != nil {
+		return 0, "", err
+	}
+	defer store.Close()
+
+	for _, i := range indexes {
+		pciAddr := vfs[i]
+		if VFNetdev(pciAddr) == "" {
+			continue
+		}
+		reserved, err := store.HasGroup(pciAddr)
+		if err != nil {
+			return 0, "", err
+		}
+		if reserved {
+			continue
+		}
+		if err := store.Put(pciAddr, attachments.ID(containerID, ifName), nil); err != nil {
+			return 0, "", fmt.Errorf("failed to reserve VF %d of %q: %v", i, pf, err)
+		}
+		return i, pciAddr, nil
+	}
+	if index != nil {
+		return 0, "", fmt.Errorf("VF %d of %q is in use", *index, pf)
+	}
+	return 0, "", fmt.Errorf("no free VF on %q", pf)
+}
+
+// ReleaseVF drops the reservation of the VF at the PCI address by the
+// attachment. Releasing a VF which is not reserved is not an error.
+func ReleaseVF(pciAddr, containerID, ifName string) error {
+	store, err := attachments.Open(ReservationDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if _, err := store.Remove(pciAddr, attachments.ID(containerID, ifName)); err != nil {
+		return fmt.Errorf("failed to release VF %s: %v", pciAddr, err)
+	}
+	return nil
+}
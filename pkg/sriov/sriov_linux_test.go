@@ -0,0 +1,152 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sriov_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/sriov"
+)
+
+var _ = Describe("VFs", func() {
+	// A PF "pf0" with three VFs. VF 0 has no network interface in the
+	// namespace, as if in use by a container.
+	BeforeEach(func() {
+		root, err := os.MkdirTemp("", "sriov")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, root)
+
+		for _, dir := range []string{
+			"sys/bus/pci/devices/0000:00:01.0/physfn/net/pf0",
+			"sys/bus/pci/devices/0000:00:01.1/physfn/net/pf0",
+			"sys/bus/pci/devices/0000:00:01.1/net/vf1",
+			"sys/bus/pci/devices/0000:00:01.2/physfn/net/pf0",
+			"sys/bus/pci/devices/0000:00:01.2/net/vf2",
+			"sys/bus/pci/devices/0000:00:02.0",
+			"sys/class/net/pf0/device",
+			"sys/class/net/vf1",
+			"sys/class/net/vf2",
+		} {
+			Expect(os.MkdirAll(filepath.Join(root, dir), 0o755)).To(Succeed())
+		}
+		for vf := 0; vf < 3; vf++ {
+			Expect(os.Symlink(
+				fmt.Sprintf("../../../../bus/pci/devices/0000:00:01.%d", vf),
+				filepath.Join(root, fmt.Sprintf("sys/class/net/pf0/device/virtfn%d", vf)),
+			)).To(Succeed())
+		}
+
+		origBusPCI, origClassNet, origReservations := sriov.SysBusPCI, sriov.SysClassNet, sriov.ReservationDir
+		sriov.SysBusPCI = filepath.Join(root, "sys/bus/pci/devices")
+		sriov.SysClassNet = filepath.Join(root, "sys/class/net")
+		sriov.ReservationDir = filepath.Join(root, "run/cni/vf-reservations")
+		DeferCleanup(func() {
+			sriov.SysBusPCI, sriov.SysClassNet, sriov.ReservationDir = origBusPCI, origClassNet, origReservations
+		})
+	})
+
+	It("finds the VFs of a PF and the PF of a VF", func() {
+		vfs, err := sriov.PFVFs("pf0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vfs).To(Equal(map[int]string{0: "0000:00:01.0", 1: "0000:00:01.1", 2: "0000:00:01.2"}))
+
+		pf, index, err := sriov.VFOfDevice("0000:00:01.2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf).To(Equal("pf0"))
+		Expect(index).To(Equal(2))
+		Expect(sriov.VFNetdev("0000:00:01.2")).To(Equal("vf2"))
+		Expect(sriov.VFNetdev("0000:00:01.0")).To(BeEmpty())
+
+		_, _, err = sriov.VFOfDevice("0000:00:02.0")
+		Expect(err).To(MatchError("0000:00:02.0 is not an SR-IOV VF with a PF network interface"))
+	})
+
+	It("reserves each free VF once", func() {
+		vf, pciAddr, err := sriov.ReserveVF("pf0", nil, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(1))
+		Expect(pciAddr).To(Equal("0000:00:01.1"))
+
+		vf, pciAddr, err = sriov.ReserveVF("pf0", nil, "container2", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(2))
+		Expect(pciAddr).To(Equal("0000:00:01.2"))
+
+		_, _, err = sriov.ReserveVF("pf0", nil, "container3", "net1")
+		Expect(err).To(MatchError(`no free VF on "pf0"`))
+
+		_, _, err = sriov.ReserveVF("pf1", nil, "container3", "net1")
+		Expect(err).To(MatchError(`"pf1" has no SR-IOV VFs`))
+	})
+
+	It("reserves the VF of the index", func() {
+		index := 2
+		vf, pciAddr, err := sriov.ReserveVF("pf0", &index, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(2))
+		Expect(pciAddr).To(Equal("0000:00:01.2"))
+
+		_, _, err = sriov.ReserveVF("pf0", &index, "container2", "net1")
+		Expect(err).To(MatchError(`VF 2 of "pf0" is in use`))
+
+		index = 0
+		_, _, err = sriov.ReserveVF("pf0", &index, "container2", "net1")
+		Expect(err).To(MatchError(`VF 0 of "pf0" is in use`))
+
+		index = 5
+		_, _, err = sriov.ReserveVF("pf0", &index, "container2", "net1")
+		Expect(err).To(MatchError(`"pf0" has no VF 5`))
+	})
+
+	It("releases the VF", func() {
+		_, pciAddr, err := sriov.ReserveVF("pf0", nil, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Only the attachment holding the VF releases it
+		Expect(sriov.ReleaseVF(pciAddr, "container2", "net1")).To(Succeed())
+		vf, _, err := sriov.ReserveVF("pf0", nil, "container2", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(2))
+
+		Expect(sriov.ReleaseVF(pciAddr, "container1", "net1")).To(Succeed())
+		Expect(sriov.ReleaseVF(pciAddr, "container1", "net1")).To(Succeed())
+		vf, _, err = sriov.ReserveVF("pf0", nil, "container3", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(1))
+	})
+})
+
+var _ = Describe("Settings", func() {
+	It("records the current values of the settings to change only", func() {
+		vlan, trust, maxRate := 100, false, 1000
+		info := &netlink.VfInfo{ID: 1, Vlan: 10, Qos: 1, Spoofchk: true, Trust: 1, MinTxRate: 10, MaxTxRate: 500}
+
+		current := sriov.Current(info, &sriov.Settings{VLAN: &vlan, Trust: &trust, MaxTxRate: &maxRate})
+		Expect(*current.VLAN).To(Equal(10))
+		Expect(*current.VLANQoS).To(Equal(1))
+		Expect(*current.Trust).To(BeTrue())
+		Expect(*current.MinTxRate).To(Equal(10))
+		Expect(*current.MaxTxRate).To(Equal(500))
+		Expect(current.MAC).To(BeEmpty())
+		Expect(current.SpoofChk).To(BeNil())
+		Expect(current.LinkState).To(BeNil())
+	})
+})
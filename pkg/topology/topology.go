@@ -0,0 +1,121 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package topology describes where the interfaces of a result are attached,
+// in an extra field of the interfaces of the result. The field is not part
+// of the CNI types: runtimes parsing the result into them, such as libcni,
+// drop it, while the ones passing the result through keep it for the
+// chained plugins.
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// PortField is the key of the Port in the interfaces of the result
+const PortField = "bridgePort"
+
+// Port is the bridge port an interface is attached to
+type Port struct {
+	// Bridge is the name of the bridge
+	Bridge string `json:"bridge"`
+	// IfIndex is the index of the port in the host network namespace
+	IfIndex int `json:"ifIndex"`
+	// VLAN is the untagged VLAN of the port, 0 without VLAN filtering
+	VLAN int `json:"vlan,omitempty"`
+	// Trunk are the tagged VLANs of the port
+	Trunk []int `json:"trunk,omitempty"`
+}
+
+// Marshal marshals the result in the version, adding the ports to the
+// interfaces by index. Versions without interfaces have no ports.
+func Marshal(result types.Result, version string, ports map[int]*Port) ([]byte, error) {
+	r, err := result.GetAsVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var ifaces []map[string]json.RawMessage
+	if raw, ok := fields["interfaces"]; ok {
+		if err := json.Unmarshal(raw, &ifaces); err != nil {
+			return nil, err
+		}
+	}
+	for i, port := range ports {
+		if i < 0 || i >= len(ifaces) {
+			continue
+		}
+		if ifaces[i][PortField], err = json.Marshal(port); err != nil {
+			return nil, err
+		}
+	}
+	if ifaces != nil {
+		if fields["interfaces"], err = json.Marshal(ifaces); err != nil {
+			return nil, err
+		}
+	}
+	return json.MarshalIndent(fields, "", "    ")
+}
+
+// PrintResult prints the result with the ports like types.PrintResult
+func PrintResult(result types.Result, version string, ports map[int]*Port) error {
+	data, err := Marshal(result, version, ports)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// PrevResultPorts returns the ports of the interfaces of the prevResult of
+// a network configuration, by interface index
+func PrevResultPorts(stdinData []byte) (map[int]*Port, error) {
+	conf := struct {
+		PrevResult *struct {
+			Interfaces []map[string]json.RawMessage `json:"interfaces"`
+		} `json:"prevResult"`
+	}{}
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return nil, fmt.Errorf("failed to parse network configuration: %v", err)
+	}
+
+	ports := map[int]*Port{}
+	if conf.PrevResult == nil {
+		return ports, nil
+	}
+	for i, iface := range conf.PrevResult.Interfaces {
+		raw, ok := iface[PortField]
+		if !ok {
+			continue
+		}
+		port := &Port{}
+		if err := json.Unmarshal(raw, port); err != nil {
+			return nil, fmt.Errorf("failed to parse %s of interface %d: %v", PortField, i, err)
+		}
+		ports[i] = port
+	}
+	return ports, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topology_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/topology"
+)
+
+var _ = Describe("topology", func() {
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{
+			{Name: "cni0"},
+			{Name: "veth0"},
+			{Name: "eth0", Sandbox: "/var/run/netns/test"},
+		},
+		IPs: []*current.IPConfig{{
+			Interface: current.Int(2),
+			Address:   net.IPNet{IP: net.IPv4(10, 1, 2, 3), Mask: net.CIDRMask(24, 32)},
+		}},
+	}
+	port := &topology.Port{Bridge: "cni0", IfIndex: 7, VLAN: 100, Trunk: []int{200, 201}}
+
+	It("adds the ports to the interfaces of the result", func() {
+		for _, ver := range []string{"0.3.1", "0.4.0", "1.0.0", "1.1.0"} {
+			data, err := topology.Marshal(result, ver, map[int]*topology.Port{1: port, 2: port, 5: port})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The result still parses as a result of the version
+			parsed := &current.Result{}
+			Expect(json.Unmarshal(data, parsed)).To(Succeed())
+			Expect(parsed.Interfaces).To(HaveLen(3))
+			Expect(parsed.IPs).To(HaveLen(1))
+
+			ports, err := topology.PrevResultPorts([]byte(fmt.Sprintf(`{"prevResult": %s}`, data)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ports).To(Equal(map[int]*topology.Port{1: port, 2: port}), ver)
+		}
+	})
+
+	It("leaves results without interfaces alone", func() {
+		data, err := topology.Marshal(result, "0.2.0", map[int]*topology.Port{1: port})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring(topology.PortField))
+	})
+
+	It("returns no ports without prevResult", func() {
+		ports, err := topology.PrevResultPorts([]byte(`{"cniVersion": "1.0.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ports).To(BeEmpty())
+
+		_, err = topology.PrevResultPorts([]byte(`{"prevResult": {"interfaces": [{"name": "eth0", "bridgePort": 1}]}}`))
+		Expect(err).To(MatchError(ContainSubstring("failed to parse bridgePort of interface 0")))
+	})
+})
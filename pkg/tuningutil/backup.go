@@ -0,0 +1,204 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuningutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// configToRestore will contain interface attributes that should be restored on cmdDel
+type configToRestore struct {
+	Mac      string `json:"mac,omitempty"`
+	Promisc  *bool  `json:"promisc,omitempty"`
+	Mtu      int    `json:"mtu,omitempty"`
+	Allmulti *bool  `json:"allmulti,omitempty"`
+	TxQLen   *int   `json:"txQLen,omitempty"`
+	// Pacing is set when the fq root qdisc was installed by the plugin
+	Pacing bool `json:"pacing,omitempty"`
+
+	// Index and PermMac identify the interface when it was renamed in the
+	// container after ADD
+	Index   int    `json:"index,omitempty"`
+	PermMac string `json:"permMac,omitempty"`
+}
+
+func backupFile(backupPath, containerID, ifName string) string {
+	return path.Join(backupPath, containerID+"_"+ifName+".json")
+}
+
+func createBackup(ifName, containerID, backupPath string, tuningConf *Config) error {
+	config := configToRestore{}
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+	config.Index = link.Attrs().Index
+	if len(link.Attrs().PermHWAddr) > 0 {
+		config.PermMac = link.Attrs().PermHWAddr.String()
+	}
+	if tuningConf.Mac != "" {
+		config.Mac = link.Attrs().HardwareAddr.String()
+	}
+	if tuningConf.Promisc {
+		config.Promisc = new(bool)
+		*config.Promisc = (link.Attrs().Promisc != 0)
+	}
+	if tuningConf.Mtu != 0 {
+		config.Mtu = link.Attrs().MTU
+	}
+	if tuningConf.Allmulti != nil {
+		config.Allmulti = new(bool)
+		*config.Allmulti = (link.Attrs().RawFlags&unix.IFF_ALLMULTI != 0)
+	}
+	if tuningConf.TxQLen != nil {
+		qlen := link.Attrs().TxQLen
+		config.TxQLen = &qlen
+	}
+	if tuningConf.PacingRate != 0 {
+		config.Pacing = true
+	}
+
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		if err = os.MkdirAll(backupPath, 0o600); err != nil {
+			return fmt.Errorf("failed to create backup directory: %v", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to marshall data for %q: %v", ifName, err)
+	}
+	if err = os.WriteFile(backupFile(backupPath, containerID, ifName), data, 0o600); err != nil {
+		return fmt.Errorf("failed to save file %s.json: %v", ifName, err)
+	}
+
+	return nil
+}
+
+// Restore reverts the interface attributes changed by Apply, as saved in
+// dataDir, or DefaultDataDir when empty. It must be called from the
+// namespace of the interface, and does nothing when nothing was saved or
+// the interface is gone.
+func Restore(ifName, containerID, dataDir string) error {
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+	filePath := backupFile(dataDir, containerID, ifName)
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		// No backup file - nothing to revert
+		return nil
+	}
+
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %v", filePath, err)
+	}
+
+	config := configToRestore{}
+	if err = json.Unmarshal(file, &config); err != nil {
+		return nil
+	}
+
+	var errStr []string
+
+	link, err := findBackupLink(ifName, &config)
+	if err != nil || link == nil {
+		return err
+	}
+	// The interface may have been renamed, the attributes are restored on
+	// its current name
+	ifName = link.Attrs().Name
+
+	if config.Mtu != 0 {
+		if err = changeMtu(ifName, config.Mtu); err != nil {
+			err = fmt.Errorf("failed to restore MTU: %v", err)
+			errStr = append(errStr, err.Error())
+		}
+	}
+	if config.Mac != "" {
+		if err = changeMacAddr(ifName, config.Mac); err != nil {
+			err = fmt.Errorf("failed to restore MAC address: %v", err)
+			errStr = append(errStr, err.Error())
+		}
+	}
+	if config.Promisc != nil {
+		if err = changePromisc(ifName, *config.Promisc); err != nil {
+			err = fmt.Errorf("failed to restore promiscuous mode: %v", err)
+			errStr = append(errStr, err.Error())
+		}
+	}
+	if config.Allmulti != nil {
+		if err = changeAllmulti(ifName, *config.Allmulti); err != nil {
+			err = fmt.Errorf("failed to restore all-multicast mode: %v", err)
+			errStr = append(errStr, err.Error())
+		}
+	}
+
+	if config.TxQLen != nil {
+		if err = changeTxQLen(ifName, *config.TxQLen); err != nil {
+			err = fmt.Errorf("failed to restore transmit queue length: %v", err)
+			errStr = append(errStr, err.Error())
+		}
+	}
+
+	if config.Pacing {
+		if err = removePacing(ifName); err != nil {
+			err = fmt.Errorf("failed to restore qdisc: %v", err)
+			errStr = append(errStr, err.Error())
+		}
+	}
+
+	if len(errStr) > 0 {
+		return errors.New(strings.Join(errStr, "; "))
+	}
+
+	if err = os.Remove(filePath); err != nil {
+		return fmt.Errorf("failed to remove file %v: %v", filePath, err)
+	}
+
+	return nil
+}
+
+// findBackupLink returns the interface the backup was made for, looking it
+// up by name first, then by the index and permanent MAC address recorded in
+// the backup. It returns a nil link when the interface is gone.
+func findBackupLink(ifName string, config *configToRestore) (netlink.Link, error) {
+	selector := netlinksafe.LinkSelector{Name: ifName, Index: config.Index}
+	if config.PermMac != "" {
+		permMac, err := net.ParseMAC(config.PermMac)
+		if err != nil {
+			return nil, fmt.Errorf("invalid permanent MAC address %q in backup: %v", config.PermMac, err)
+		}
+		selector.PermHardwareAddr = permMac
+	}
+	link, err := netlinksafe.LinkByAny(selector)
+	var notFound *netlinksafe.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	return link, err
+}
@@ -0,0 +1,97 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuningutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"golang.org/x/sys/unix"
+)
+
+// Status is the configuration the tuning is applied with, for node agents
+// to spot a misconfiguration before pods fail
+type Status struct {
+	// AllowlistHash is the sha256 of the allowlist in force, or empty when
+	// there is no allowlist and all the net sysctls are allowed
+	AllowlistHash string
+	// PendingRestores is the number of attachments whose original
+	// attributes are saved in the data directory, to be restored on DEL
+	PendingRestores int
+}
+
+func (s *Status) String() string {
+	allowlist := "no allowlist"
+	if s.AllowlistHash != "" {
+		allowlist = "allowlist sha256:" + s.AllowlistHash
+	}
+	return fmt.Sprintf("%s, %d attachments pending restore", allowlist, s.PendingRestores)
+}
+
+// GetStatus checks the allowlist and the data directory, DefaultDataDir
+// when empty. It fails when the allowlist can't be read or holds an invalid
+// regular expression, or when the original attributes can't be saved in
+// the data directory.
+func GetStatus(allowlistPath, dataDir string) (*Status, error) {
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+	status := &Status{}
+
+	isPresent, allowlist, err := readAllowlist(allowlistPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowlist %s: %v", allowlistPath, err)
+	}
+	if isPresent {
+		for _, expr := range allowlist {
+			if _, err := regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("invalid allowlist %s: %v", allowlistPath, err)
+			}
+		}
+		data, err := os.ReadFile(allowlistPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read allowlist %s: %v", allowlistPath, err)
+		}
+		sum := sha256.Sum256(data)
+		status.AllowlistHash = hex.EncodeToString(sum[:])
+	}
+
+	// The data directory is created on the first ADD
+	info, err := os.Stat(dataDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return status, nil
+		}
+		return nil, fmt.Errorf("failed to check data directory %s: %v", dataDir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("data directory %s is not a directory", dataDir)
+	}
+	if err := unix.Access(dataDir, unix.W_OK|unix.X_OK); err != nil {
+		return nil, fmt.Errorf("data directory %s is not writable: %v", dataDir, err)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	status.PendingRestores = len(backups)
+	return status, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuningutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ValidateSysctls verifies that the sysctls match one of the regular
+// expressions of the allowlist file, one per line. Note that if the
+// allowlist file is missing no validation takes place.
+func ValidateSysctls(sysctls map[string]string, allowlistPath string) error {
+	isPresent, allowlist, err := readAllowlist(allowlistPath)
+	if err != nil {
+		return err
+	}
+	if !isPresent {
+		return nil
+	}
+	for sysctl := range sysctls {
+		match, err := contains(sysctl, allowlist)
+		if err != nil {
+			return err
+		}
+		if !match {
+			return fmt.Errorf("Sysctl %s is not allowed. Only the following sysctls are allowed: %+v", sysctl, allowlist)
+		}
+	}
+	return nil
+}
+
+// Validate the allowList contains the given sysctl
+func contains(sysctl string, allowList []string) (bool, error) {
+	for _, allowListElement := range allowList {
+		match, err := regexp.MatchString(allowListElement, sysctl)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Read the systctl allowlist from file. Return info if the file is present and the read allowList if it is
+func readAllowlist(allowlistPath string) (bool, []string, error) {
+	if _, err := os.Stat(allowlistPath); os.IsNotExist(err) {
+		return false, nil, nil
+	}
+	dat, err := os.ReadFile(allowlistPath)
+	if err != nil {
+		return false, nil, err
+	}
+
+	lines := strings.Split(string(dat), "\n")
+	allowList := []string{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			allowList = append(allowList, line)
+		}
+	}
+	return true, allowList, nil
+}
+
+// SysctlFileName returns the /proc/sys file of a net sysctl key, in which
+// IFNAME stands for the interface name
+func SysctlFileName(key, ifName string) (string, error) {
+	key = strings.ReplaceAll(key, ".", string(os.PathSeparator))
+
+	// If the key contains `IFNAME` - substitute it with args.IfName
+	// to allow setting sysctls on a particular interface, on which
+	// other operations (like mac/mtu setting) are performed
+	key = strings.Replace(key, "IFNAME", ifName, 1)
+
+	fileName := filepath.Join("/proc/sys", key)
+
+	// Refuse to modify sysctl parameters that don't belong
+	// to the network subsystem.
+	if !strings.HasPrefix(fileName, "/proc/sys/net/") {
+		return "", fmt.Errorf("invalid net sysctl key: %q", key)
+	}
+
+	return fileName, nil
+}
+
+// sysctlWriter writes the sysctls to /proc/sys, or to a private proc mount
+// once /proc/sys turned out to be read-only, e.g. in the mount namespace of
+// a containerized runtime
+type sysctlWriter struct {
+	writableProcSys bool
+	// procDir is the private proc mount, if any
+	procDir string
+}
+
+func (w *sysctlWriter) write(fileName, value string) error {
+	if w.procDir != "" {
+		return os.WriteFile(filepath.Join(w.procDir, strings.TrimPrefix(fileName, "/proc/")), []byte(value), 0o644)
+	}
+
+	err := os.WriteFile(fileName, []byte(value), 0o644)
+	if !errors.Is(err, syscall.EROFS) {
+		return err
+	}
+	// Nothing to write when the sysctl is set already, e.g. by the runtime
+	if contents, readErr := os.ReadFile(fileName); readErr == nil && strings.TrimSuffix(string(contents), "\n") == value {
+		return nil
+	}
+	if !w.writableProcSys {
+		return fmt.Errorf("failed to set %s to %q: /proc/sys is mounted read-only; mount it read-write for the plugin, set the sysctl from the runtime, or set writableProcSys", fileName, value)
+	}
+	if err := w.mountProc(); err != nil {
+		return fmt.Errorf("failed to set %s to %q: /proc/sys is mounted read-only and %v", fileName, value, err)
+	}
+	return w.write(fileName, value)
+}
+
+// mountProc mounts a private proc, whose /proc/sys is writable, in a mount
+// namespace of the current thread. The thread is left locked so that it
+// exits with its goroutine rather than running other goroutines in that
+// mount namespace.
+func (w *sysctlWriter) mountProc() error {
+	runtime.LockOSThread()
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("failed to unshare the mount namespace: %v", err)
+	}
+	if err := unix.Mount("", "/", "", unix.MS_PRIVATE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to make the mounts private: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "cni-proc-")
+	if err != nil {
+		return fmt.Errorf("failed to create the private proc directory: %v", err)
+	}
+	if err := unix.Mount("proc", dir, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		os.Remove(dir)
+		return fmt.Errorf("failed to mount a private proc: %v", err)
+	}
+	w.procDir = dir
+	return nil
+}
+
+func (w *sysctlWriter) close() {
+	if w.procDir == "" {
+		return
+	}
+	_ = unix.Unmount(w.procDir, unix.MNT_DETACH)
+	_ = os.Remove(w.procDir)
+	w.procDir = ""
+}
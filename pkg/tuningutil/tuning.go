@@ -0,0 +1,458 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tuningutil implements the interface tuning of the tuning plugin,
+// so that other plugins can embed it rather than chaining the plugin.
+//
+// A plugin embeds Config in its network configuration, calls Apply from
+// the container namespace on ADD, Check on CHECK and Restore on DEL.
+package tuningutil
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// DefaultDataDir is where the original interface attributes are saved
+// when Config.DataDir is empty
+const DefaultDataDir = "/run/cni/tuning"
+
+// Config is the tuning of an interface. Its fields use the JSON keys of
+// the tuning plugin configuration.
+type Config struct {
+	DataDir  string            `json:"dataDir,omitempty"`
+	SysCtl   map[string]string `json:"sysctl"`
+	Mac      string            `json:"mac,omitempty"`
+	Promisc  bool              `json:"promisc,omitempty"`
+	Mtu      int               `json:"mtu,omitempty"`
+	TxQLen   *int              `json:"txQLen,omitempty"`
+	Allmulti *bool             `json:"allmulti,omitempty"`
+	// PacingRate caps the egress rate of each flow, in bits per second,
+	// by installing an fq root qdisc on the interface
+	PacingRate uint64 `json:"pacingRate,omitempty"`
+	// OnlyIfType restricts the tuning to interfaces of the listed link
+	// types, such as "veth" or "ipvlan"; others are left untouched
+	OnlyIfType []string `json:"onlyIfType,omitempty"`
+	// WritableProcSys writes the sysctls through a private proc mount when
+	// /proc/sys is mounted read-only, rather than failing
+	WritableProcSys bool `json:"writableProcSys,omitempty"`
+}
+
+// Args override the Config, as found in the "cni" args of the network
+// configuration
+type Args struct {
+	SysCtl   *map[string]string `json:"sysctl"`
+	Mac      *string            `json:"mac,omitempty"`
+	Promisc  *bool              `json:"promisc,omitempty"`
+	Mtu      *int               `json:"mtu,omitempty"`
+	Allmulti *bool              `json:"allmulti,omitempty"`
+	TxQLen   *int               `json:"txQLen,omitempty"`
+	// PacingRate in bits per second
+	PacingRate *uint64 `json:"pacingRate,omitempty"`
+}
+
+// Merge overrides the configuration with the args that are set
+func (c *Config) Merge(a *Args) {
+	if a == nil {
+		return
+	}
+
+	if a.SysCtl != nil {
+		if c.SysCtl == nil {
+			c.SysCtl = make(map[string]string)
+		}
+		for k, v := range *a.SysCtl {
+			c.SysCtl[k] = v
+		}
+	}
+	if a.Mac != nil {
+		c.Mac = *a.Mac
+	}
+	if a.Promisc != nil {
+		c.Promisc = *a.Promisc
+	}
+	if a.Mtu != nil {
+		c.Mtu = *a.Mtu
+	}
+	if a.Allmulti != nil {
+		c.Allmulti = a.Allmulti
+	}
+	if a.TxQLen != nil {
+		c.TxQLen = a.TxQLen
+	}
+	if a.PacingRate != nil {
+		c.PacingRate = *a.PacingRate
+	}
+}
+
+// Validate verifies the configuration. The sysctls are verified against
+// an allowlist with ValidateSysctls.
+func (c *Config) Validate() error {
+	// fq takes the maximum rate in bytes per second as a 32 bit value
+	if c.PacingRate/8 > math.MaxUint32 {
+		return fmt.Errorf("pacingRate %d exceeds the maximum of %d bits per second", c.PacingRate, uint64(math.MaxUint32)*8)
+	}
+	return nil
+}
+
+func (c *Config) dataDir() string {
+	if c.DataDir == "" {
+		return DefaultDataDir
+	}
+	return c.DataDir
+}
+
+// changesLink reports whether the configuration changes attributes of the
+// link, which are saved to be restored
+func (c *Config) changesLink() bool {
+	return c.Mac != "" || c.Mtu != 0 || c.Promisc || c.Allmulti != nil || c.TxQLen != nil || c.PacingRate != 0
+}
+
+// NamespaceWide reports whether the configuration only sets sysctls of the
+// network namespace, which do not need the interface to exist
+func (c *Config) NamespaceWide() bool {
+	if c.changesLink() || len(c.OnlyIfType) > 0 {
+		return false
+	}
+	for key := range c.SysCtl {
+		if strings.Contains(key, "IFNAME") {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply tunes the interface, saving the original attributes in the data
+// directory so that Restore can revert them. It must be called from the
+// namespace of the interface. Interfaces not matching OnlyIfType are left
+// untouched, which is reported by returning false.
+func Apply(ifName, containerID string, c *Config) (bool, error) {
+	if match, err := matchesLinkType(ifName, c.OnlyIfType); err != nil || !match {
+		return false, err
+	}
+	return true, apply(ifName, containerID, c)
+}
+
+// ApplySysctls sets the sysctls of the configuration. It must be called
+// from the network namespace of the interface.
+func ApplySysctls(ifName string, c *Config) error {
+	w := &sysctlWriter{writableProcSys: c.WritableProcSys}
+	defer w.close()
+	for key, value := range c.SysCtl {
+		fileName, err := SysctlFileName(key, ifName)
+		if err != nil {
+			return err
+		}
+		if err := w.write(fileName, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckSysctls verifies the sysctls of the configuration. It must be
+// called from the network namespace of the interface.
+func CheckSysctls(ifName string, c *Config) error {
+	// Check each configured value vs what's currently in the container
+	for key, confValue := range c.SysCtl {
+		fileName, err := SysctlFileName(key, ifName)
+		if err != nil {
+			return err
+		}
+
+		contents, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		curValue := strings.TrimSuffix(string(contents), "\n")
+		if confValue != curValue {
+			return fmt.Errorf("Error: Tuning configured value of %s is %s, current value is %s", fileName, confValue, curValue)
+		}
+	}
+	return nil
+}
+
+func apply(ifName, containerID string, c *Config) error {
+	if err := ApplySysctls(ifName, c); err != nil {
+		return err
+	}
+
+	if c.changesLink() {
+		if err := createBackup(ifName, containerID, c.dataDir(), c); err != nil {
+			return err
+		}
+	}
+
+	if c.Mac != "" {
+		if err := changeMacAddr(ifName, c.Mac); err != nil {
+			return err
+		}
+	}
+	if c.Promisc {
+		if err := changePromisc(ifName, true); err != nil {
+			return err
+		}
+	}
+	if c.Mtu != 0 {
+		if err := changeMtu(ifName, c.Mtu); err != nil {
+			return err
+		}
+	}
+	if c.Allmulti != nil {
+		if err := changeAllmulti(ifName, *c.Allmulti); err != nil {
+			return err
+		}
+	}
+	if c.TxQLen != nil {
+		if err := changeTxQLen(ifName, *c.TxQLen); err != nil {
+			return err
+		}
+	}
+	if c.PacingRate != 0 {
+		if err := changePacingRate(ifName, c.PacingRate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check verifies that the interface is tuned as configured. It must be
+// called from the namespace of the interface.
+func Check(ifName string, c *Config) error {
+	if match, err := matchesLinkType(ifName, c.OnlyIfType); err != nil || !match {
+		return err
+	}
+
+	if err := CheckSysctls(ifName, c); err != nil {
+		return err
+	}
+
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("Cannot find container link %v", ifName)
+	}
+
+	if c.Mac != "" {
+		if c.Mac != link.Attrs().HardwareAddr.String() {
+			return fmt.Errorf("Error: Tuning configured Ethernet of %s is %s, current value is %s",
+				ifName, c.Mac, link.Attrs().HardwareAddr)
+		}
+	}
+
+	if c.Promisc {
+		if link.Attrs().Promisc == 0 {
+			return fmt.Errorf("Error: Tuning link %s configured promisc is %v, current value is %d",
+				ifName, c.Promisc, link.Attrs().Promisc)
+		}
+	} else {
+		if link.Attrs().Promisc != 0 {
+			return fmt.Errorf("Error: Tuning link %s configured promisc is %v, current value is %d",
+				ifName, c.Promisc, link.Attrs().Promisc)
+		}
+	}
+
+	if c.Mtu != 0 {
+		if c.Mtu != link.Attrs().MTU {
+			return fmt.Errorf("Error: Tuning configured MTU of %s is %d, current value is %d",
+				ifName, c.Mtu, link.Attrs().MTU)
+		}
+	}
+
+	if c.Allmulti != nil {
+		allmulti := (link.Attrs().RawFlags&unix.IFF_ALLMULTI != 0)
+		if allmulti != *c.Allmulti {
+			return fmt.Errorf("Error: Tuning configured all-multicast mode of %s is %v, current value is %v",
+				ifName, c.Allmulti, allmulti)
+		}
+	}
+
+	if c.TxQLen != nil {
+		if *c.TxQLen != link.Attrs().TxQLen {
+			return fmt.Errorf("Error: Tuning configured Transmit Queue Length of %s is %d, current value is %d",
+				ifName, c.TxQLen, link.Attrs().TxQLen)
+		}
+	}
+
+	if c.PacingRate != 0 {
+		if err := checkPacingRate(link, c.PacingRate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesLinkType reports whether the interface is of one of the types,
+// any type matching when none is given
+func matchesLinkType(ifName string, linkTypes []string) (bool, error) {
+	if len(linkTypes) == 0 {
+		return true, nil
+	}
+
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+	for _, t := range linkTypes {
+		if link.Type() == t {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func changeMacAddr(ifName string, newMacAddr string) error {
+	addr, err := net.ParseMAC(newMacAddr)
+	if err != nil {
+		return fmt.Errorf("invalid args %v for MAC addr: %v", newMacAddr, err)
+	}
+
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+
+	return netlink.LinkSetHardwareAddr(link, addr)
+}
+
+func changePromisc(ifName string, val bool) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+
+	if val {
+		return netlink.SetPromiscOn(link)
+	}
+	return netlink.SetPromiscOff(link)
+}
+
+func changeMtu(ifName string, mtu int) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+	return netlink.LinkSetMTU(link, mtu)
+}
+
+func changeAllmulti(ifName string, val bool) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+
+	if val {
+		return netlink.LinkSetAllmulticastOn(link)
+	}
+	return netlink.LinkSetAllmulticastOff(link)
+}
+
+func changeTxQLen(ifName string, txQLen int) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+	return netlink.LinkSetTxQLen(link, txQLen)
+}
+
+// pacingQdiscOffset is the offset of the fq qdisc within the owned qdisc
+// handles, apart from those of the bandwidth plugin
+const pacingQdiscOffset = 1
+
+// changePacingRate installs an fq root qdisc pacing each flow at the given
+// rate in bits per second. It refuses to replace a root qdisc configured by
+// someone else, leaving only the default one of the interface to replace.
+func changePacingRate(ifName string, rate uint64) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+
+	root, err := rootQdisc(link)
+	if err != nil {
+		return err
+	}
+	if root != nil && root.Attrs().Handle != 0 && !ip.OwnsQdisc(root) {
+		return fmt.Errorf("%q already has a %s root qdisc, refusing to replace it with fq", ifName, root.Type())
+	}
+
+	handle, err := ip.OwnedQdiscHandle(pacingQdiscOffset)
+	if err != nil {
+		return err
+	}
+	qdisc := netlink.NewFq(netlink.QdiscAttrs{
+		LinkIndex: link.Attrs().Index,
+		Handle:    handle,
+		Parent:    netlink.HANDLE_ROOT,
+	})
+	qdisc.FlowMaxRate = uint32(rate / 8)
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return fmt.Errorf("failed to set fq qdisc on %q: %v", ifName, err)
+	}
+	return nil
+}
+
+// removePacing removes the fq root qdisc, reverting to the default qdisc
+func removePacing(ifName string) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get %q: %v", ifName, err)
+	}
+
+	root, err := rootQdisc(link)
+	if err != nil {
+		return err
+	}
+	if root == nil || root.Type() != "fq" || !ip.OwnsQdisc(root) {
+		return nil
+	}
+	return netlink.QdiscDel(root)
+}
+
+// rootQdisc returns the root qdisc of the link, if any
+func rootQdisc(link netlink.Link) (netlink.Qdisc, error) {
+	qdiscs, err := netlinksafe.QdiscList(link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list qdiscs of %q: %v", link.Attrs().Name, err)
+	}
+	for _, q := range qdiscs {
+		if q.Attrs().Parent == netlink.HANDLE_ROOT {
+			return q, nil
+		}
+	}
+	return nil, nil
+}
+
+func checkPacingRate(link netlink.Link, rate uint64) error {
+	root, err := rootQdisc(link)
+	if err != nil {
+		return err
+	}
+	if fq, ok := root.(*netlink.Fq); ok && ip.OwnsQdisc(fq) {
+		if uint64(fq.FlowMaxRate) != rate/8 {
+			return fmt.Errorf("Error: Tuning configured pacing rate of %s is %d, current value is %d",
+				link.Attrs().Name, rate, uint64(fq.FlowMaxRate)*8)
+		}
+		return nil
+	}
+	return fmt.Errorf("Error: Tuning configured pacing rate of %s is %d, but no fq root qdisc found", link.Attrs().Name, rate)
+}
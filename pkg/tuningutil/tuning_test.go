@@ -0,0 +1,306 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuningutil_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/containernetworking/plugins/pkg/tuningutil"
+)
+
+var _ = Describe("tuning configuration", func() {
+	It("merges the args over the configuration", func() {
+		mtu := 1400
+		promisc := true
+		c := &tuningutil.Config{Mtu: 1500, Mac: "c2:11:22:33:44:55"}
+		c.Merge(&tuningutil.Args{
+			SysCtl:  &map[string]string{"net.ipv4.conf.IFNAME.arp_filter": "1"},
+			Mtu:     &mtu,
+			Promisc: &promisc,
+		})
+		Expect(c.Mtu).To(Equal(1400))
+		Expect(c.Promisc).To(BeTrue())
+		Expect(c.Mac).To(Equal("c2:11:22:33:44:55"))
+		Expect(c.SysCtl).To(HaveKeyWithValue("net.ipv4.conf.IFNAME.arp_filter", "1"))
+
+		c.Merge(nil)
+		Expect(c.Mtu).To(Equal(1400))
+	})
+
+	It("validates the pacing rate", func() {
+		Expect((&tuningutil.Config{PacingRate: 1000000}).Validate()).To(Succeed())
+		Expect((&tuningutil.Config{PacingRate: (math.MaxUint32 + 1) * 8}).Validate()).To(MatchError(ContainSubstring("exceeds the maximum")))
+	})
+
+	It("only allows net sysctls", func() {
+		fileName, err := tuningutil.SysctlFileName("net.ipv4.conf.IFNAME.arp_filter", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fileName).To(Equal("/proc/sys/net/ipv4/conf/eth0/arp_filter"))
+
+		_, err = tuningutil.SysctlFileName("kernel.hostname", "eth0")
+		Expect(err).To(MatchError(ContainSubstring("invalid net sysctl key")))
+		_, err = tuningutil.SysctlFileName("net.ipv4.conf.IFNAME.arp_filter", "../../../kernel")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("validates the sysctls against the allowlist", func() {
+		dir, err := os.MkdirTemp("", "tuningutil")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		allowlist := filepath.Join(dir, "allowlist.conf")
+		sysctls := map[string]string{"net.ipv4.conf.IFNAME.arp_filter": "1"}
+		Expect(tuningutil.ValidateSysctls(sysctls, allowlist)).To(Succeed())
+
+		Expect(os.WriteFile(allowlist, []byte("^net\\.ipv6\\..*$\n"), 0o644)).To(Succeed())
+		Expect(tuningutil.ValidateSysctls(sysctls, allowlist)).To(MatchError(ContainSubstring("is not allowed")))
+
+		Expect(os.WriteFile(allowlist, []byte("^net\\.ipv4\\.conf\\.IFNAME\\.[a-z_]*$\n"), 0o644)).To(Succeed())
+		Expect(tuningutil.ValidateSysctls(sysctls, allowlist)).To(Succeed())
+	})
+})
+
+var _ = Describe("tuning status", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "tuningutil")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+	})
+
+	It("reports the allowlist in force and the attachments pending restore", func() {
+		allowlist := filepath.Join(dir, "allowlist.conf")
+		dataDir := filepath.Join(dir, "data")
+
+		status, err := tuningutil.GetStatus(allowlist, dataDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.String()).To(Equal("no allowlist, 0 attachments pending restore"))
+
+		Expect(os.WriteFile(allowlist, []byte("^net\\.ipv4\\..*$\n"), 0o644)).To(Succeed())
+		Expect(os.Mkdir(dataDir, 0o700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dataDir, "container1_eth0.json"), []byte("{}"), 0o600)).To(Succeed())
+		status, err = tuningutil.GetStatus(allowlist, dataDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.AllowlistHash).To(Equal("94cc9e1a448e38eff920d0bd82fbe9f962c3059cb63d980ee2cf4aa75edad670"))
+		Expect(status.PendingRestores).To(Equal(1))
+	})
+
+	It("fails on an invalid allowlist or data directory", func() {
+		allowlist := filepath.Join(dir, "allowlist.conf")
+		Expect(os.WriteFile(allowlist, []byte("^net\\.(ipv4\n"), 0o644)).To(Succeed())
+		_, err := tuningutil.GetStatus(allowlist, dir)
+		Expect(err).To(MatchError(ContainSubstring("invalid allowlist")))
+
+		dataDir := filepath.Join(dir, "data")
+		Expect(os.WriteFile(dataDir, nil, 0o600)).To(Succeed())
+		_, err = tuningutil.GetStatus(filepath.Join(dir, "missing.conf"), dataDir)
+		Expect(err).To(MatchError(ContainSubstring("is not a directory")))
+	})
+})
+
+var _ = Describe("tuning an interface", func() {
+	var targetNS ns.NetNS
+	var dataDir string
+
+	const ifName = "eth0"
+
+	BeforeEach(func() {
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "tuningutil")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			return netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: ifName},
+				PeerName:  "peer0",
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("applies, checks and restores the tuning", func() {
+		txQLen := 42
+		c := &tuningutil.Config{
+			DataDir: dataDir,
+			SysCtl:  map[string]string{"net.ipv4.conf.IFNAME.arp_filter": "1"},
+			Mac:     "c2:11:22:33:44:55",
+			Mtu:     1400,
+			TxQLen:  &txQLen,
+		}
+
+		err := targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			before, err := netlinksafe.LinkByName(ifName)
+			Expect(err).NotTo(HaveOccurred())
+
+			applied, err := tuningutil.Apply(ifName, "dummy", c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(BeTrue())
+			Expect(tuningutil.Check(ifName, c)).To(Succeed())
+
+			link, err := netlinksafe.LinkByName(ifName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().HardwareAddr.String()).To(Equal("c2:11:22:33:44:55"))
+			Expect(link.Attrs().MTU).To(Equal(1400))
+
+			other := *c
+			other.Mtu = 1300
+			Expect(tuningutil.Check(ifName, &other)).To(MatchError(ContainSubstring("MTU")))
+
+			Expect(tuningutil.Restore(ifName, "dummy", dataDir)).To(Succeed())
+			link, err = netlinksafe.LinkByName(ifName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().HardwareAddr).To(Equal(before.Attrs().HardwareAddr))
+			Expect(link.Attrs().MTU).To(Equal(before.Attrs().MTU))
+			Expect(link.Attrs().TxQLen).To(Equal(before.Attrs().TxQLen))
+
+			// Nothing is left to restore
+			Expect(tuningutil.Restore(ifName, "dummy", dataDir)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("restores the tuning of an interface renamed after ADD", func() {
+		c := &tuningutil.Config{DataDir: dataDir, Mtu: 1400}
+
+		err := targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := tuningutil.Apply(ifName, "dummy", c)
+			Expect(err).NotTo(HaveOccurred())
+
+			link, err := netlinksafe.LinkByName(ifName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetName(link, "renamed0")).To(Succeed())
+
+			Expect(tuningutil.Restore(ifName, "dummy", dataDir)).To(Succeed())
+			link, err = netlinksafe.LinkByName("renamed0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().MTU).To(Equal(1500))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("leaves interfaces of other types untouched", func() {
+		c := &tuningutil.Config{DataDir: dataDir, Mtu: 1400, OnlyIfType: []string{"ipvlan"}}
+
+		err := targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			applied, err := tuningutil.Apply(ifName, "dummy", c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(BeFalse())
+
+			link, err := netlinksafe.LinkByName(ifName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().MTU).To(Equal(1500))
+			Expect(tuningutil.Check(ifName, c)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("with a read-only /proc/sys", func() {
+		// readOnlyProcSys mounts /proc/sys read-only in a mount namespace
+		// of the thread, left locked so that it exits afterwards
+		readOnlyProcSys := func() {
+			runtime.LockOSThread()
+			Expect(unix.Unshare(unix.CLONE_NEWNS)).To(Succeed())
+			Expect(unix.Mount("", "/", "", unix.MS_PRIVATE|unix.MS_REC, "")).To(Succeed())
+			Expect(unix.Mount("/proc/sys", "/proc/sys", "", unix.MS_BIND, "")).To(Succeed())
+			Expect(unix.Mount("", "/proc/sys", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, "")).To(Succeed())
+		}
+
+		It("reports the read-only mount", func() {
+			c := &tuningutil.Config{SysCtl: map[string]string{"net.ipv4.conf.IFNAME.arp_filter": "1"}}
+
+			err := targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				readOnlyProcSys()
+				err := tuningutil.ApplySysctls(ifName, c)
+				Expect(err).To(MatchError(ContainSubstring("/proc/sys is mounted read-only")))
+				Expect(err).To(MatchError(ContainSubstring("/proc/sys/net/ipv4/conf/eth0/arp_filter")))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("leaves the sysctls set already", func() {
+			c := &tuningutil.Config{SysCtl: map[string]string{"net.ipv4.conf.IFNAME.arp_filter": "0"}}
+
+			err := targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				readOnlyProcSys()
+				Expect(tuningutil.ApplySysctls(ifName, c)).To(Succeed())
+				Expect(tuningutil.CheckSysctls(ifName, c)).To(Succeed())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("writes the sysctls through a private proc with writableProcSys", func() {
+			c := &tuningutil.Config{
+				SysCtl: map[string]string{
+					"net.ipv4.conf.IFNAME.arp_filter": "1",
+					"net.ipv4.conf.all.arp_filter":    "1",
+				},
+				WritableProcSys: true,
+			}
+
+			err := targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				readOnlyProcSys()
+				Expect(tuningutil.ApplySysctls(ifName, c)).To(Succeed())
+				Expect(tuningutil.CheckSysctls(ifName, c)).To(Succeed())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The sysctls are set in the network namespace
+			err = targetNS.Do(func(ns.NetNS) error {
+				return tuningutil.CheckSysctls(ifName, c)
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -18,7 +18,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"net/rpc"
@@ -41,19 +43,24 @@ var errNoMoreTries = errors.New("no more tries")
 type DHCP struct {
 	mux                 sync.Mutex
 	leases              map[string]*DHCPLease
+	linkLocal           map[string]*net.IPNet
 	hostNetnsPrefix     string
 	clientTimeout       time.Duration
 	clientResendMax     time.Duration
 	clientResendTimeout time.Duration
 	broadcast           bool
+	acquireQueue        *acquireQueue
+	acquireTimeout      time.Duration
 }
 
 func newDHCP(clientTimeout, clientResendMax time.Duration, resendTimeout time.Duration) *DHCP {
 	return &DHCP{
 		leases:              make(map[string]*DHCPLease),
+		linkLocal:           make(map[string]*net.IPNet),
 		clientTimeout:       clientTimeout,
 		clientResendMax:     clientResendMax,
 		clientResendTimeout: resendTimeout,
+		acquireQueue:        newAcquireQueue(0),
 	}
 }
 
@@ -81,6 +88,21 @@ func (d *DHCP) Allocate(args *skel.CmdArgs, result *current.Result) error {
 		return err
 	}
 
+	if len(conf.IPAM.UserClass) > 0 {
+		opt, err := optUserClass(conf.IPAM.UserClass)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, opt)
+	}
+	if conf.IPAM.ClientFQDN != "" {
+		opt, err := optClientFQDN(conf.IPAM.ClientFQDN)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, opt)
+	}
+
 	clientID := generateClientID(args.ContainerID, conf.Name, args.IfName)
 
 	// If we already have an active lease for this clientID, do not create
@@ -88,13 +110,32 @@ func (d *DHCP) Allocate(args *skel.CmdArgs, result *current.Result) error {
 	l := d.getLease(clientID)
 	if l != nil {
 		l.Check()
+	} else if ipn := d.getLinkLocal(clientID); ipn != nil {
+		result.IPs = []*current.IPConfig{{Address: *ipn}}
+		return nil
 	} else {
 		hostNetns := d.hostNetnsPrefix + args.Netns
+		done, err := d.acquireQueue.wait(args.Netns, d.acquireTimeout)
+		if err != nil {
+			return fmt.Errorf("%v: %v", clientID, err)
+		}
 		l, err = AcquireLease(clientID, hostNetns, args.IfName,
 			opts,
 			d.clientTimeout, d.clientResendMax, d.clientResendTimeout, d.broadcast)
+		done()
 		if err != nil {
-			return err
+			if !conf.IPAM.LinkLocalFallback {
+				return err
+			}
+			log.Printf("%v: falling back to a link-local address: %v", clientID, err)
+			ipn, err := selectLinkLocal(hostNetns, args.IfName)
+			if err != nil {
+				return err
+			}
+			d.setLinkLocal(clientID, ipn)
+			// The link-local address has neither gateway nor routes
+			result.IPs = []*current.IPConfig{{Address: *ipn}}
+			return nil
 		}
 	}
 
@@ -133,6 +174,7 @@ func (d *DHCP) Release(args *skel.CmdArgs, _ *struct{}) error {
 		l.Stop()
 		d.clearLease(clientID)
 	}
+	d.clearLinkLocal(clientID)
 
 	return nil
 }
@@ -166,6 +208,24 @@ func (d *DHCP) clearLease(clientID string) {
 	delete(d.leases, clientID)
 }
 
+func (d *DHCP) getLinkLocal(clientID string) *net.IPNet {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.linkLocal[clientID]
+}
+
+func (d *DHCP) setLinkLocal(clientID string, ipn *net.IPNet) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.linkLocal[clientID] = ipn
+}
+
+func (d *DHCP) clearLinkLocal(clientID string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	delete(d.linkLocal, clientID)
+}
+
 func getListener(socketPath string) (net.Listener, error) {
 	l, err := activation.Listeners()
 	if err != nil {
@@ -193,7 +253,7 @@ func getListener(socketPath string) (net.Listener, error) {
 func runDaemon(
 	pidfilePath, hostPrefix, socketPath string,
 	dhcpClientTimeout time.Duration, resendMax time.Duration, resendTimeout time.Duration,
-	broadcast bool,
+	broadcast bool, maxAcquires int, acquireTimeout time.Duration,
 ) error {
 	// since other goroutines (on separate threads) will change namespaces,
 	// ensure the RPC server does not get scheduled onto those
@@ -231,6 +291,12 @@ func runDaemon(
 	dhcp := newDHCP(dhcpClientTimeout, resendMax, resendTimeout)
 	dhcp.hostNetnsPrefix = hostPrefix
 	dhcp.broadcast = broadcast
+	dhcp.acquireQueue = newAcquireQueue(maxAcquires)
+	dhcp.acquireTimeout = acquireTimeout
+	// The metrics are served with the RPCs, at /debug/vars
+	expvar.Publish("acquireQueue", expvar.Func(func() any {
+		return dhcp.acquireQueue.stats()
+	}))
 	rpc.Register(dhcp)
 	rpc.HandleHTTP()
 	srv.Serve(l)
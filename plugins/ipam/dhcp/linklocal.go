@@ -0,0 +1,211 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// RFC 3927 timing, variables so that tests can shorten them
+var (
+	llProbeWait    = 1 * time.Second
+	llProbeMin     = 1 * time.Second
+	llProbeMax     = 2 * time.Second
+	llAnnounceWait = 2 * time.Second
+)
+
+const (
+	llProbeNum     = 3
+	llMaxConflicts = 10
+
+	ethPArp = 0x0806
+)
+
+// linkLocalCandidate returns the n-th candidate address of the interface,
+// in 169.254.1.0 to 169.254.254.255 as required by RFC 3927. The sequence
+// is seeded with the hardware address, so that an interface gets the same
+// address again as long as it does not conflict.
+func linkLocalCandidate(hwAddr net.HardwareAddr, n int) net.IP {
+	h := fnv.New64a()
+	h.Write(hwAddr)
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	var v int
+	for i := 0; i <= n; i++ {
+		v = r.Intn(254 * 256)
+	}
+	return net.IPv4(169, 254, byte(1+v/256), byte(v%256)).To4()
+}
+
+// selectLinkLocal claims an IPv4 link-local address for the interface by
+// ARP probing, as specified by RFC 3927. The address is not assigned.
+func selectLinkLocal(netns, ifName string) (*net.IPNet, error) {
+	var addr net.IP
+	err := ns.WithNetNSPath(netns, func(_ ns.NetNS) error {
+		link, err := netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("error looking up %q: %v", ifName, err)
+		}
+		if err := netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("failed to set %q up: %v", ifName, err)
+		}
+		hwAddr := link.Attrs().HardwareAddr
+		if len(hwAddr) != 6 {
+			return fmt.Errorf("interface %q has no ethernet hardware address", ifName)
+		}
+
+		fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(ethPArp)))
+		if err != nil {
+			return fmt.Errorf("failed to open packet socket: %v", err)
+		}
+		defer unix.Close(fd)
+		if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(ethPArp), Ifindex: link.Attrs().Index}); err != nil {
+			return fmt.Errorf("failed to bind packet socket to %q: %v", ifName, err)
+		}
+
+		time.Sleep(randDuration(0, llProbeWait))
+		for n := 0; n < llMaxConflicts; n++ {
+			candidate := linkLocalCandidate(hwAddr, n)
+			conflict, err := probeLinkLocal(fd, link.Attrs().Index, hwAddr, candidate)
+			if err != nil {
+				return err
+			}
+			if !conflict {
+				addr = candidate
+				return nil
+			}
+			log.Printf("%s: link-local address %s is in use", ifName, candidate)
+		}
+		return fmt.Errorf("no free link-local address found for %q after %d conflicts", ifName, llMaxConflicts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(16, 32)}, nil
+}
+
+// probeLinkLocal sends the ARP probes for candidate and reports whether
+// another host uses or probes for it
+func probeLinkLocal(fd, ifIndex int, hwAddr net.HardwareAddr, candidate net.IP) (bool, error) {
+	probe := arpProbeFrame(hwAddr, candidate)
+	sa := &unix.SockaddrLinklayer{Protocol: htons(ethPArp), Ifindex: ifIndex, Halen: 6}
+	copy(sa.Addr[:], probe[0:6])
+
+	for i := 0; i < llProbeNum; i++ {
+		if err := unix.Sendto(fd, probe, 0, sa); err != nil {
+			return false, fmt.Errorf("failed to send ARP probe for %s: %v", candidate, err)
+		}
+		wait := randDuration(llProbeMin, llProbeMax)
+		if i == llProbeNum-1 {
+			wait = llAnnounceWait
+		}
+		conflict, err := waitConflict(fd, hwAddr, candidate, wait)
+		if conflict || err != nil {
+			return conflict, err
+		}
+	}
+	return false, nil
+}
+
+// waitConflict reads the ARP packets received within wait and reports
+// whether one of them conflicts with candidate
+func waitConflict(fd int, hwAddr net.HardwareAddr, candidate net.IP, wait time.Duration) (bool, error) {
+	deadline := time.Now().Add(wait)
+	buf := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return false, err
+		}
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to receive ARP packets: %v", err)
+		}
+		if ll, ok := from.(*unix.SockaddrLinklayer); ok && ll.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		if arpConflicts(buf[:n], hwAddr, candidate) {
+			return true, nil
+		}
+	}
+}
+
+// arpConflicts reports whether the ARP packet, with its ethernet header,
+// comes from another host using candidate, or probing for it
+func arpConflicts(frame []byte, hwAddr net.HardwareAddr, candidate net.IP) bool {
+	if len(frame) < 14+28 {
+		return false
+	}
+	arp := frame[14:]
+	senderHw := net.HardwareAddr(arp[8:14])
+	senderIP := net.IP(arp[14:18])
+	targetIP := net.IP(arp[24:28])
+	if bytes.Equal(senderHw, hwAddr) {
+		return false
+	}
+	if senderIP.Equal(candidate) {
+		return true
+	}
+	return senderIP.Equal(net.IPv4zero) && targetIP.Equal(candidate)
+}
+
+// arpProbeFrame builds a broadcast ARP probe for addr, with an all-zero
+// sender address
+func arpProbeFrame(hwAddr net.HardwareAddr, addr net.IP) []byte {
+	b := make([]byte, 14+28)
+	copy(b[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(b[6:12], hwAddr)
+	binary.BigEndian.PutUint16(b[12:14], ethPArp)
+
+	arp := b[14:]
+	binary.BigEndian.PutUint16(arp[0:2], 1)      // ethernet
+	binary.BigEndian.PutUint16(arp[2:4], 0x0800) // IPv4
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:8], 1) // request
+	copy(arp[8:14], hwAddr)
+	copy(arp[24:28], addr.To4())
+	return b
+}
+
+func randDuration(low, high time.Duration) time.Duration {
+	if high <= low {
+		return low
+	}
+	return low + time.Duration(rand.Int63n(int64(high-low)))
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
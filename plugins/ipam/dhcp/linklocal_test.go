@@ -0,0 +1,124 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+var _ = Describe("IPv4 link-local fallback", func() {
+	const (
+		contVethName = "eth0"
+		peerVethName = "peer0"
+	)
+	var contNS, peerNS ns.NetNS
+	var contMAC net.HardwareAddr
+
+	BeforeEach(func() {
+		var err error
+		contNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		peerNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		llProbeWait = 0
+		llProbeMin = 50 * time.Millisecond
+		llProbeMax = 100 * time.Millisecond
+		llAnnounceWait = 200 * time.Millisecond
+
+		err = contNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = contVethName
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs:     linkAttrs,
+				PeerName:      peerVethName,
+				PeerNamespace: netlink.NsFd(int(peerNS.Fd())),
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(contVethName)
+			Expect(err).NotTo(HaveOccurred())
+			contMAC = link.Attrs().HardwareAddr
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = peerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(peerVethName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		llProbeWait = 1 * time.Second
+		llProbeMin = 1 * time.Second
+		llProbeMax = 2 * time.Second
+		llAnnounceWait = 2 * time.Second
+
+		Expect(contNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(contNS)).To(Succeed())
+		Expect(peerNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(peerNS)).To(Succeed())
+	})
+
+	It("derives the candidates from the hardware address", func() {
+		first := linkLocalCandidate(contMAC, 0)
+		Expect(linkLocalCandidate(contMAC, 0)).To(Equal(first))
+		for n := 0; n < llMaxConflicts; n++ {
+			ip := linkLocalCandidate(contMAC, n)
+			Expect(ip[0:2]).To(Equal(net.IP{169, 254}))
+			Expect(ip[2]).To(BeNumerically(">=", 1))
+			Expect(ip[2]).To(BeNumerically("<=", 254))
+		}
+	})
+
+	It("claims the first candidate when it is free", func() {
+		ipn, err := selectLinkLocal(contNS.Path(), contVethName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipn.IP).To(Equal(linkLocalCandidate(contMAC, 0)))
+		Expect(ipn.Mask).To(Equal(net.CIDRMask(16, 32)))
+	})
+
+	It("moves to the next candidate on conflict", func() {
+		taken := linkLocalCandidate(contMAC, 0)
+		err := peerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(peerVethName)
+			Expect(err).NotTo(HaveOccurred())
+			return netlink.AddrAdd(link, &netlink.Addr{IPNet: &net.IPNet{IP: taken, Mask: net.CIDRMask(16, 32)}})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		ipn, err := selectLinkLocal(contNS.Path(), contVethName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipn.IP).NotTo(Equal(taken))
+		Expect(ipn.IP).To(Equal(linkLocalCandidate(contMAC, 1)))
+	})
+})
@@ -53,6 +53,15 @@ type IPAMConfig struct {
 	RequestOptions []RequestOption `json:"request"`
 	// The metric of routes
 	Priority int `json:"priority,omitempty"`
+	// UserClass is sent as RFC 3004 user class option, one instance per item
+	UserClass []string `json:"userClass,omitempty"`
+	// ClientFQDN is sent as RFC 4702 client FQDN option, asking the server to
+	// register the leased address under that name in DNS
+	ClientFQDN string `json:"clientFQDN,omitempty"`
+	// LinkLocalFallback claims an RFC 3927 IPv4 link-local address when no
+	// lease can be acquired. The address is returned in 169.254.0.0/16
+	// without gateway nor routes, which tells it apart from a lease.
+	LinkLocalFallback bool `json:"linkLocalFallback,omitempty"`
 }
 
 // DHCPOption represents a DHCP option. It can be a number, or a string defined in manual dhcp-options(5).
@@ -81,6 +90,8 @@ func main() {
 		var timeout time.Duration
 		var resendMax time.Duration
 		var resendTimeout time.Duration
+		var maxAcquires int
+		var acquireTimeout time.Duration
 		daemonFlags := flag.NewFlagSet("daemon", flag.ExitOnError)
 		daemonFlags.StringVar(&pidfilePath, "pidfile", "", "optional path to write daemon PID to")
 		daemonFlags.StringVar(&hostPrefix, "hostprefix", "", "optional prefix to host root")
@@ -89,13 +100,15 @@ func main() {
 		daemonFlags.DurationVar(&timeout, "timeout", 10*time.Second, "optional dhcp client timeout duration for each request")
 		daemonFlags.DurationVar(&resendMax, "resendmax", resendDelayMax, "optional dhcp client max resend delay between requests")
 		daemonFlags.DurationVar(&resendTimeout, "resendtimeout", defaultResendTimeout, "optional dhcp client resend timeout, no more retries after this timeout")
+		daemonFlags.IntVar(&maxAcquires, "maxacquires", defaultMaxAcquires, "optional maximum of leases acquired at once, 0 for no limit")
+		daemonFlags.DurationVar(&acquireTimeout, "acquiretimeout", defaultAcquireTimeout, "optional time an ADD waits for a lease acquisition to start, 0 for no limit")
 		daemonFlags.Parse(os.Args[2:])
 
 		if socketPath == "" {
 			socketPath = defaultSocketPath
 		}
 
-		if err := runDaemon(pidfilePath, hostPrefix, socketPath, timeout, resendMax, resendTimeout, broadcast); err != nil {
+		if err := runDaemon(pidfilePath, hostPrefix, socketPath, timeout, resendMax, resendTimeout, broadcast, maxAcquires, acquireTimeout); err != nil {
 			log.Print(err.Error())
 			os.Exit(1)
 		}
@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 
 	dhcp4 "github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/rfc1035label"
 
 	"github.com/containernetworking/cni/pkg/types"
 )
@@ -44,6 +46,58 @@ func parseOptionName(option string) (dhcp4.OptionCode, error) {
 	return dhcp4.GenericOptionCode(i), nil
 }
 
+// optUserClass builds an RFC 3004 user class option, where each class is
+// carried as a length-prefixed instance
+func optUserClass(classes []string) (dhcp4.Option, error) {
+	total := 0
+	for _, c := range classes {
+		if len(c) == 0 || len(c) > 255 {
+			return dhcp4.Option{}, fmt.Errorf("invalid user class %q", c)
+		}
+		total += 1 + len(c)
+	}
+	if total > 255 {
+		return dhcp4.Option{}, fmt.Errorf("user classes too long: %d bytes", total)
+	}
+	return dhcp4.OptRFC3004UserClass(classes), nil
+}
+
+// Client FQDN option flags, see RFC 4702 section 2.1
+const (
+	fqdnFlagServerUpdate = 0x01
+	fqdnFlagEncoded      = 0x04
+)
+
+// rawOptionValue is an option value sent as is
+type rawOptionValue []byte
+
+func (v rawOptionValue) ToBytes() []byte {
+	return v
+}
+
+func (v rawOptionValue) String() string {
+	return fmt.Sprintf("%v", []byte(v))
+}
+
+// optClientFQDN builds an RFC 4702 client FQDN option with the name in
+// canonical wire format, asking the server to perform the DNS updates
+func optClientFQDN(fqdn string) (dhcp4.Option, error) {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	if fqdn == "" || len(fqdn) > 253 {
+		return dhcp4.Option{}, fmt.Errorf("invalid client FQDN %q", fqdn)
+	}
+	for _, label := range strings.Split(fqdn, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return dhcp4.Option{}, fmt.Errorf("invalid client FQDN %q", fqdn)
+		}
+	}
+
+	labels := rfc1035label.Labels{Labels: []string{fqdn}}
+	// The two RCODE fields are deprecated and sent as zero by clients
+	value := append([]byte{fqdnFlagServerUpdate | fqdnFlagEncoded, 0, 0}, labels.ToBytes()...)
+	return dhcp4.Option{Code: dhcp4.OptionFQDN, Value: rawOptionValue(value)}, nil
+}
+
 func classfulSubnet(sn net.IP) net.IPNet {
 	return net.IPNet{
 		IP:   sn,
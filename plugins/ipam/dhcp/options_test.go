@@ -97,3 +97,41 @@ func TestParseOptionName(t *testing.T) {
 		})
 	}
 }
+
+func TestOptUserClass(t *testing.T) {
+	opt, err := optUserClass([]string{"ab", "c"})
+	if err != nil {
+		t.Fatalf("optUserClass() error = %v", err)
+	}
+	if opt.Code != dhcp4.OptionUserClassInformation {
+		t.Errorf("optUserClass() code = %v", opt.Code)
+	}
+	want := []byte{2, 'a', 'b', 1, 'c'}
+	if got := opt.Value.ToBytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("optUserClass() = %v, want %v", got, want)
+	}
+
+	if _, err := optUserClass([]string{""}); err == nil {
+		t.Errorf("optUserClass() accepted an empty class")
+	}
+}
+
+func TestOptClientFQDN(t *testing.T) {
+	opt, err := optClientFQDN("pod.example.com.")
+	if err != nil {
+		t.Fatalf("optClientFQDN() error = %v", err)
+	}
+	if opt.Code != dhcp4.OptionFQDN {
+		t.Errorf("optClientFQDN() code = %v", opt.Code)
+	}
+	want := []byte{0x05, 0, 0, 3, 'p', 'o', 'd', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+	if got := opt.Value.ToBytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("optClientFQDN() = %v, want %v", got, want)
+	}
+
+	for _, fqdn := range []string{"", "a..b"} {
+		if _, err := optClientFQDN(fqdn); err == nil {
+			t.Errorf("optClientFQDN(%q) did not fail", fqdn)
+		}
+	}
+}
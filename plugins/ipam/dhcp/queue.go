@@ -0,0 +1,205 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAcquires    = 16
+	defaultAcquireTimeout = 2 * defaultResendTimeout
+)
+
+// acquireQueue bounds the number of leases acquired at once. A burst of
+// ADDs would otherwise run as many DHCP exchanges in parallel, each on its
+// own OS thread, and delay the renewals of the existing leases until the
+// server or the network catches up. Renewals and rebinds do not go through
+// the queue.
+//
+// The ADDs waiting for a slot are queued by network namespace and the
+// namespaces are served in turn, so that a pod with many interfaces does
+// not hold back the others.
+type acquireQueue struct {
+	mu       sync.Mutex
+	workers  int
+	inFlight int
+	// order is the namespaces with waiters, in the order they are served
+	order   []string
+	waiters map[string][]*acquireWaiter
+
+	acquired uint64
+	queued   uint64
+	timedOut uint64
+	waited   time.Duration
+	maxWait  time.Duration
+}
+
+type acquireWaiter struct {
+	ready chan struct{}
+	// granted is set under the queue lock when the waiter gets a slot
+	granted bool
+}
+
+// QueueStats are the metrics of the acquisition queue, published by the
+// daemon as the "acquireQueue" expvar
+type QueueStats struct {
+	// Workers is the maximum of acquisitions at once, 0 without limit
+	Workers int `json:"workers"`
+	// InFlight is the number of acquisitions running
+	InFlight int `json:"inFlight"`
+	// Queued is the number of ADDs waiting for a slot, QueuedByNetns the
+	// same by network namespace
+	Queued        int            `json:"queued"`
+	QueuedByNetns map[string]int `json:"queuedByNetns,omitempty"`
+	// AcquiredTotal counts the slots given out, QueuedTotal the ones that
+	// had to wait and TimedOutTotal the ADDs that gave up waiting
+	AcquiredTotal uint64 `json:"acquiredTotal"`
+	QueuedTotal   uint64 `json:"queuedTotal"`
+	TimedOutTotal uint64 `json:"timedOutTotal"`
+	// WaitSecondsTotal and MaxWaitSeconds are the time spent in the queue
+	WaitSecondsTotal float64 `json:"waitSecondsTotal"`
+	MaxWaitSeconds   float64 `json:"maxWaitSeconds"`
+}
+
+// newAcquireQueue returns a queue running at most workers acquisitions at
+// once, or any number with 0
+func newAcquireQueue(workers int) *acquireQueue {
+	return &acquireQueue{
+		workers: workers,
+		waiters: make(map[string][]*acquireWaiter),
+	}
+}
+
+// wait blocks until an acquisition for the namespace may run, or the
+// timeout expires if not 0. The returned function gives the slot back.
+func (q *acquireQueue) wait(netns string, timeout time.Duration) (func(), error) {
+	q.mu.Lock()
+	if q.workers <= 0 || (q.inFlight < q.workers && len(q.order) == 0) {
+		q.inFlight++
+		q.acquired++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+
+	w := &acquireWaiter{ready: make(chan struct{})}
+	if len(q.waiters[netns]) == 0 {
+		q.order = append(q.order, netns)
+	}
+	q.waiters[netns] = append(q.waiters[netns], w)
+	q.queued++
+	q.mu.Unlock()
+
+	start := time.Now()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-w.ready:
+	case <-expired:
+		q.mu.Lock()
+		if !w.granted {
+			q.remove(netns, w)
+			q.timedOut++
+			q.mu.Unlock()
+			return nil, fmt.Errorf("timed out after %v waiting to acquire a lease, %d acquisitions running", timeout, q.workers)
+		}
+		q.mu.Unlock()
+	}
+
+	q.mu.Lock()
+	waited := time.Since(start)
+	q.waited += waited
+	if waited > q.maxWait {
+		q.maxWait = waited
+	}
+	q.mu.Unlock()
+	return q.release, nil
+}
+
+// release hands the slot to the next waiter, taking the namespaces in turn
+func (q *acquireQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.order) == 0 {
+		q.inFlight--
+		return
+	}
+	netns := q.order[0]
+	q.order = q.order[1:]
+	w := q.waiters[netns][0]
+	if rest := q.waiters[netns][1:]; len(rest) > 0 {
+		q.waiters[netns] = rest
+		q.order = append(q.order, netns)
+	} else {
+		delete(q.waiters, netns)
+	}
+	q.acquired++
+	w.granted = true
+	close(w.ready)
+}
+
+// remove drops a waiter that gave up, with the queue locked
+func (q *acquireQueue) remove(netns string, w *acquireWaiter) {
+	waiters := q.waiters[netns]
+	for i := range waiters {
+		if waiters[i] == w {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) > 0 {
+		q.waiters[netns] = waiters
+		return
+	}
+	delete(q.waiters, netns)
+	for i := range q.order {
+		if q.order[i] == netns {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// stats returns the current metrics of the queue
+func (q *acquireQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := QueueStats{
+		Workers:          q.workers,
+		InFlight:         q.inFlight,
+		AcquiredTotal:    q.acquired,
+		QueuedTotal:      q.queued,
+		TimedOutTotal:    q.timedOut,
+		WaitSecondsTotal: q.waited.Seconds(),
+		MaxWaitSeconds:   q.maxWait.Seconds(),
+	}
+	if len(q.waiters) > 0 {
+		s.QueuedByNetns = make(map[string]int, len(q.waiters))
+		for netns, waiters := range q.waiters {
+			s.QueuedByNetns[netns] = len(waiters)
+			s.Queued += len(waiters)
+		}
+	}
+	return s
+}
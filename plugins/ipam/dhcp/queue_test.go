@@ -0,0 +1,112 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("acquisition queue", func() {
+	// enqueue starts a waiter for the namespace and returns the channel
+	// it reports on once it gets a slot
+	enqueue := func(q *acquireQueue, netns string) <-chan func() {
+		ch := make(chan func(), 1)
+		queued := q.stats().Queued
+		go func() {
+			defer GinkgoRecover()
+			done, err := q.wait(netns, 0)
+			Expect(err).NotTo(HaveOccurred())
+			ch <- done
+		}()
+		Eventually(func() int {
+			return q.stats().Queued
+		}).Should(Equal(queued + 1))
+		return ch
+	}
+
+	It("does not queue without limit", func() {
+		q := newAcquireQueue(0)
+		for i := 0; i < 10; i++ {
+			_, err := q.wait("/var/run/netns/a", time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		s := q.stats()
+		Expect(s.InFlight).To(Equal(10))
+		Expect(s.QueuedTotal).To(BeZero())
+	})
+
+	It("bounds the acquisitions running at once", func() {
+		q := newAcquireQueue(2)
+		done1, err := q.wait("a", 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = q.wait("a", 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		ch := enqueue(q, "b")
+		Consistently(ch).ShouldNot(Receive())
+		Expect(q.stats().InFlight).To(Equal(2))
+		Expect(q.stats().Queued).To(Equal(1))
+
+		done1()
+		Eventually(ch).Should(Receive())
+		s := q.stats()
+		Expect(s.InFlight).To(Equal(2))
+		Expect(s.Queued).To(BeZero())
+		Expect(s.AcquiredTotal).To(BeEquivalentTo(3))
+		Expect(s.QueuedTotal).To(BeEquivalentTo(1))
+	})
+
+	It("serves the namespaces in turn", func() {
+		q := newAcquireQueue(1)
+		done, err := q.wait("busy", 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		// A pod with three interfaces queues before a pod with one
+		busy := []<-chan func(){enqueue(q, "busy"), enqueue(q, "busy"), enqueue(q, "busy")}
+		other := enqueue(q, "other")
+		Expect(q.stats().QueuedByNetns).To(Equal(map[string]int{"busy": 3, "other": 1}))
+
+		done()
+		var next func()
+		Eventually(busy[0]).Should(Receive(&next))
+		next()
+		Eventually(other).Should(Receive(&next))
+		Expect(busy[1]).NotTo(Receive())
+		next()
+		Eventually(busy[1]).Should(Receive(&next))
+		next()
+		Eventually(busy[2]).Should(Receive(&next))
+		next()
+		Expect(q.stats().InFlight).To(BeZero())
+	})
+
+	It("gives up after the timeout", func() {
+		q := newAcquireQueue(1)
+		done, err := q.wait("a", 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = q.wait("b", 50*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("timed out after 50ms waiting to acquire a lease")))
+		s := q.stats()
+		Expect(s.Queued).To(BeZero())
+		Expect(s.TimedOutTotal).To(BeEquivalentTo(1))
+
+		done()
+		Expect(q.stats().InFlight).To(BeZero())
+	})
+})
@@ -15,6 +15,7 @@
 package allocator
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -26,10 +27,26 @@ import (
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend"
 )
 
+// ErrExhausted is returned by Get when all the addresses of the range set
+// are allocated
+var ErrExhausted = errors.New("no IP addresses available")
+
+// ErrLocked is returned by Get and Release when the store cannot be locked
+var ErrLocked = errors.New("failed to lock store")
+
+// InUseFunc reports whether an address is used by a host the store doesn't
+// know about
+type InUseFunc func(ip net.IP) (bool, error)
+
+// probeIDPrefix prefixes the container ID a candidate is reserved under
+// while it is probed
+const probeIDPrefix = "probe-"
+
 type IPAllocator struct {
 	rangeset *RangeSet
 	store    backend.Store
 	rangeID  string // Used for tracking last reserved ip
+	inUse    InUseFunc
 }
 
 func NewIPAllocator(s *RangeSet, store backend.Store, id int) *IPAllocator {
@@ -40,13 +57,50 @@ func NewIPAllocator(s *RangeSet, store backend.Store, id int) *IPAllocator {
 	}
 }
 
+// VerifyFree makes Get probe the candidates with inUse before allocating
+// them, and skip the ones in use
+func (a *IPAllocator) VerifyFree(inUse InUseFunc) {
+	a.inUse = inUse
+}
+
+// reserve reserves ip for the container, unless it is found in use. The
+// candidate is held under a probe ID while it is probed, since the store
+// can only release all the addresses of a container.
+func (a *IPAllocator) reserve(id string, ifname string, ip net.IP) (reserved bool, inUse bool, err error) {
+	if a.inUse == nil {
+		reserved, err := a.store.Reserve(id, ifname, ip, a.rangeID)
+		return reserved, false, err
+	}
+
+	probeID := probeIDPrefix + id
+	reserved, err = a.store.Reserve(probeID, ifname, ip, a.rangeID)
+	if err != nil || !reserved {
+		return false, false, err
+	}
+	inUse, err = a.inUse(ip)
+	if releaseErr := a.store.ReleaseByID(probeID, ifname); releaseErr != nil {
+		return false, false, releaseErr
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to verify that %s is free: %v", ip, err)
+	}
+	if inUse {
+		return false, true, nil
+	}
+	reserved, err = a.store.Reserve(id, ifname, ip, a.rangeID)
+	return reserved, false, err
+}
+
 // Get allocates an IP
 func (a *IPAllocator) Get(id string, ifname string, requestedIP net.IP) (*current.IPConfig, error) {
-	a.store.Lock()
+	if err := a.store.Lock(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLocked, err)
+	}
 	defer a.store.Unlock()
 
 	var reservedIP *net.IPNet
 	var gw net.IP
+	inUseIPs := 0
 
 	if requestedIP != nil {
 		if err := canonicalizeIP(&requestedIP); err != nil {
@@ -62,10 +116,17 @@ func (a *IPAllocator) Get(id string, ifname string, requestedIP net.IP) (*curren
 			return nil, fmt.Errorf("requested ip %s is subnet's gateway", requestedIP.String())
 		}
 
-		reserved, err := a.store.Reserve(id, ifname, requestedIP, a.rangeID)
+		if r.Excludes(requestedIP) {
+			return nil, fmt.Errorf("requested ip %s is excluded from range %s", requestedIP.String(), r.String())
+		}
+
+		reserved, inUse, err := a.reserve(id, ifname, requestedIP)
 		if err != nil {
 			return nil, err
 		}
+		if inUse {
+			return nil, fmt.Errorf("requested IP address %s is in use on the network", requestedIP)
+		}
 		if !reserved {
 			return nil, fmt.Errorf("requested IP address %s is not available in range set %s", requestedIP, a.rangeset.String())
 		}
@@ -94,10 +155,15 @@ func (a *IPAllocator) Get(id string, ifname string, requestedIP net.IP) (*curren
 				break
 			}
 
-			reserved, err := a.store.Reserve(id, ifname, reservedIP.IP, a.rangeID)
+			reserved, inUse, err := a.reserve(id, ifname, reservedIP.IP)
 			if err != nil {
 				return nil, err
 			}
+			if inUse {
+				inUseIPs++
+				log.Printf("Skipping %s, which is in use on the network", reservedIP.IP)
+				continue
+			}
 
 			if reserved {
 				break
@@ -106,7 +172,10 @@ func (a *IPAllocator) Get(id string, ifname string, requestedIP net.IP) (*curren
 	}
 
 	if reservedIP == nil {
-		return nil, fmt.Errorf("no IP addresses available in range set: %s", a.rangeset.String())
+		if inUseIPs > 0 {
+			return nil, fmt.Errorf("%w in range set: %s, %d found in use on the network", ErrExhausted, a.rangeset.String(), inUseIPs)
+		}
+		return nil, fmt.Errorf("%w in range set: %s", ErrExhausted, a.rangeset.String())
 	}
 
 	return &current.IPConfig{
@@ -117,7 +186,9 @@ func (a *IPAllocator) Get(id string, ifname string, requestedIP net.IP) (*curren
 
 // Release clears all IPs allocated for the container with given ID
 func (a *IPAllocator) Release(id string, ifname string) error {
-	a.store.Lock()
+	if err := a.store.Lock(); err != nil {
+		return fmt.Errorf("%w: %v", ErrLocked, err)
+	}
 	defer a.store.Unlock()
 
 	return a.store.ReleaseByID(id, ifname)
@@ -180,41 +251,41 @@ func (a *IPAllocator) GetIter() (*RangeIter, error) {
 // Next returns the next IP, its mask, and its gateway. Returns nil
 // if the iterator has been exhausted
 func (i *RangeIter) Next() (*net.IPNet, net.IP) {
-	r := (*i.rangeset)[i.rangeIdx]
-
-	// If this is the first time iterating and we're not starting in the middle
-	// of the range, then start at rangeStart, which is inclusive
-	if i.cur == nil {
-		i.cur = r.RangeStart
-		i.startIP = i.cur
-		if i.cur.Equal(r.Gateway) {
-			return i.Next()
-		}
-		return &net.IPNet{IP: i.cur, Mask: r.Subnet.Mask}, r.Gateway
-	}
-
-	// If we've reached the end of this range, we need to advance the range
-	// RangeEnd is inclusive as well
-	if i.cur.Equal(r.RangeEnd) {
-		i.rangeIdx++
-		i.rangeIdx %= len(*i.rangeset)
-		r = (*i.rangeset)[i.rangeIdx]
+	// Skip the gateway and the excluded addresses in a loop rather than by
+	// recursion, as an excluded span may be large
+	for {
+		r := (*i.rangeset)[i.rangeIdx]
+
+		// If this is the first time iterating and we're not starting in the middle
+		// of the range, then start at rangeStart, which is inclusive
+		if i.cur == nil {
+			i.cur = r.RangeStart
+			i.startIP = i.cur
+		} else {
+			// If we've reached the end of this range, we need to advance the range
+			// RangeEnd is inclusive as well
+			if i.cur.Equal(r.RangeEnd) {
+				i.rangeIdx++
+				i.rangeIdx %= len(*i.rangeset)
+				r = (*i.rangeset)[i.rangeIdx]
+
+				i.cur = r.RangeStart
+			} else {
+				i.cur = ip.NextIP(i.cur)
+			}
 
-		i.cur = r.RangeStart
-	} else {
-		i.cur = ip.NextIP(i.cur)
-	}
+			if i.startIP == nil {
+				i.startIP = i.cur
+			} else if i.cur.Equal(i.startIP) {
+				// IF we've looped back to where we started, give up
+				return nil, nil
+			}
+		}
 
-	if i.startIP == nil {
-		i.startIP = i.cur
-	} else if i.cur.Equal(i.startIP) {
-		// IF we've looped back to where we started, give up
-		return nil, nil
-	}
+		if i.cur.Equal(r.Gateway) || r.Excludes(i.cur) {
+			continue
+		}
 
-	if i.cur.Equal(r.Gateway) {
-		return i.Next()
+		return &net.IPNet{IP: i.cur, Mask: r.Subnet.Mask}, r.Gateway
 	}
-
-	return &net.IPNet{IP: i.cur, Mask: r.Subnet.Mask}, r.Gateway
 }
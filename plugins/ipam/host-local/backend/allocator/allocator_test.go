@@ -368,6 +368,109 @@ var _ = Describe("host-local ip allocator", func() {
 			Expect(r.startIP).To(Equal(net.IP{192, 168, 1, 0}))
 		})
 	})
+
+	Context("when the range has an exclusion policy", func() {
+		mkExcludeAlloc := func() IPAllocator {
+			p := RangeSet{
+				Range{
+					Subnet: mustSubnet("192.168.1.0/28"),
+					Exclude: &Exclude{
+						LastOctetBelow: 10,
+						LastOctets:     []int{12},
+						Regexp:         `\.14$`,
+					},
+				},
+			}
+			Expect(p.Canonicalize()).To(Succeed())
+			store := fakestore.NewFakeStore(map[string]string{}, map[string]net.IP{})
+			return IPAllocator{
+				rangeset: &p,
+				store:    store,
+				rangeID:  "rangeid",
+			}
+		}
+
+		It("should skip excluded addresses when iterating", func() {
+			a := mkExcludeAlloc()
+			r, err := a.GetIter()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.nextip()).To(Equal(net.IP{192, 168, 1, 10}))
+			Expect(r.nextip()).To(Equal(net.IP{192, 168, 1, 11}))
+			Expect(r.nextip()).To(Equal(net.IP{192, 168, 1, 13}))
+			Expect(r.nextip()).To(BeNil())
+		})
+
+		It("should skip a large excluded span", func() {
+			p := RangeSet{
+				Range{
+					Subnet:  mustSubnet("10.1.0.0/16"),
+					Exclude: &Exclude{Regexp: `^10\.1\.([0-9]|[1-9][0-9]|1[0-9][0-9]|2[0-4][0-9])\.`},
+				},
+			}
+			Expect(p.Canonicalize()).To(Succeed())
+			a := IPAllocator{
+				rangeset: &p,
+				store:    fakestore.NewFakeStore(map[string]string{}, map[string]net.IP{}),
+				rangeID:  "rangeid",
+			}
+			r, err := a.GetIter()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.nextip()).To(Equal(net.IP{10, 1, 250, 0}))
+		})
+
+		It("should refuse to allocate a requested excluded address", func() {
+			a := mkExcludeAlloc()
+			_, err := a.Get("ID", "eth0", net.IP{192, 168, 1, 12})
+			Expect(err).To(MatchError("requested ip 192.168.1.12 is excluded from range 192.168.1.1-192.168.1.14"))
+
+			res, err := a.Get("ID", "eth0", net.IP{192, 168, 1, 11})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Address.IP).To(Equal(net.IP{192, 168, 1, 11}))
+		})
+	})
+
+	Context("when verifying that the addresses are free", func() {
+		// 192.168.1.2 and 192.168.1.3 are used out of band
+		inUse := func(ip net.IP) (bool, error) {
+			return ip.Equal(net.IP{192, 168, 1, 2}) || ip.Equal(net.IP{192, 168, 1, 3}), nil
+		}
+
+		It("should skip the addresses in use", func() {
+			a := mkalloc()
+			a.VerifyFree(inUse)
+			res, err := a.Get("ID", "eth0", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Address.IP).To(Equal(net.IP{192, 168, 1, 4}))
+
+			// Only the allocated address is left reserved
+			Expect(a.store.GetByID("ID", "eth0")).To(Equal([]net.IP{net.ParseIP("192.168.1.4")}))
+			Expect(a.store.GetByID(probeIDPrefix+"ID", "eth0")).To(BeEmpty())
+		})
+
+		It("should refuse to allocate a requested address in use", func() {
+			a := mkalloc()
+			a.VerifyFree(inUse)
+			_, err := a.Get("ID", "eth0", net.IP{192, 168, 1, 3})
+			Expect(err).To(MatchError("requested IP address 192.168.1.3 is in use on the network"))
+			Expect(a.store.GetByID(probeIDPrefix+"ID", "eth0")).To(BeEmpty())
+		})
+
+		It("should count the addresses in use when out of ips", func() {
+			a := mkalloc()
+			a.VerifyFree(func(net.IP) (bool, error) { return true, nil })
+			_, err := a.Get("ID", "eth0", nil)
+			Expect(err).To(MatchError(ErrExhausted))
+			Expect(err).To(MatchError(ContainSubstring("5 found in use on the network")))
+		})
+
+		It("should fail when the probe fails", func() {
+			a := mkalloc()
+			a.VerifyFree(func(net.IP) (bool, error) { return false, fmt.Errorf("no route") })
+			_, err := a.Get("ID", "eth0", nil)
+			Expect(err).To(MatchError("failed to verify that 192.168.1.2 is free: no route"))
+			Expect(a.store.GetByID(probeIDPrefix+"ID", "eth0")).To(BeEmpty())
+		})
+	})
 })
 
 // nextip is a convenience function used for testing
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"regexp"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/version"
@@ -48,10 +49,61 @@ type IPAMConfig struct {
 	Name       string
 	Type       string         `json:"type"`
 	Routes     []*types.Route `json:"routes"`
-	DataDir    string         `json:"dataDir"`
+	DataDir    string         `json:"dataDir"` // May contain {network}
 	ResolvConf string         `json:"resolvConf"`
 	Ranges     []RangeSet     `json:"ranges"`
 	IPArgs     []net.IP       `json:"-"` // Requested IPs from CNI_ARGS, args and capabilities
+
+	// Store selects the store keeping the allocations, backend.DefaultStore
+	// when empty, and StoreOptions configures it
+	Store        string          `json:"store,omitempty"`
+	StoreOptions json.RawMessage `json:"storeOptions,omitempty"`
+
+	// FamilyPolicy is whether ADD may succeed without the addresses of a
+	// family whose ranges are exhausted, see the FamilyPolicy constants
+	FamilyPolicy string `json:"familyPolicy,omitempty"`
+
+	// VerifyFree is whether the candidate addresses are probed on the
+	// network before being allocated, see the VerifyFree constants, and
+	// VerifyInterface the interface of the host they are probed on
+	VerifyFree      string `json:"verifyFree,omitempty"`
+	VerifyInterface string `json:"verifyInterface,omitempty"`
+}
+
+const (
+	// FamilyPolicyRequireDual fails ADD when any range set is exhausted,
+	// this is the default
+	FamilyPolicyRequireDual = "require-dual"
+	// FamilyPolicyPreferIPv4 requires the IPv4 addresses, and drops the
+	// IPv6 ones when their range sets are exhausted
+	FamilyPolicyPreferIPv4 = "prefer-ipv4"
+	// FamilyPolicyPreferIPv6 requires the IPv6 addresses, and drops the
+	// IPv4 ones when their range sets are exhausted
+	FamilyPolicyPreferIPv6 = "prefer-ipv6"
+)
+
+const (
+	// VerifyFreeOff allocates the addresses without probing them, this
+	// is the default
+	VerifyFreeOff = "off"
+	// VerifyFreeARP probes the addresses with ARP, or neighbor
+	// solicitations for IPv6, on the link of the addresses
+	VerifyFreeARP = "arp"
+	// VerifyFreeICMP probes the addresses with ICMP echo requests
+	VerifyFreeICMP = "icmp"
+)
+
+// Optional reports whether ADD may succeed without an address of the range
+// set when it is exhausted, per the family policy
+func (c *IPAMConfig) Optional(rangeset *RangeSet) bool {
+	isV4 := (*rangeset)[0].RangeStart.To4() != nil
+	switch c.FamilyPolicy {
+	case FamilyPolicyPreferIPv4:
+		return !isV4
+	case FamilyPolicyPreferIPv6:
+		return isV4
+	}
+	return false
 }
 
 type IPAMEnvArgs struct {
@@ -70,6 +122,22 @@ type Range struct {
 	RangeEnd   net.IP      `json:"rangeEnd,omitempty"`   // The last ip, inclusive
 	Subnet     types.IPNet `json:"subnet"`
 	Gateway    net.IP      `json:"gateway,omitempty"`
+	Exclude    *Exclude    `json:"exclude,omitempty"`
+}
+
+// Exclude describes addresses inside a range that must never be allocated,
+// e.g. low octets reserved by convention for network gear.
+type Exclude struct {
+	// Regexp is matched against the textual form of each candidate address
+	Regexp string `json:"regexp,omitempty"`
+	// LastOctets lists last-octet values that are never allocated (e.g. 0, 255).
+	// IPv4 ranges only.
+	LastOctets []int `json:"lastOctets,omitempty"`
+	// LastOctetBelow excludes addresses whose last octet is lower than this value.
+	// IPv4 ranges only.
+	LastOctetBelow int `json:"lastOctetBelow,omitempty"`
+
+	re *regexp.Regexp
 }
 
 // NewIPAMConfig creates a NetworkConfig from the given network name.
@@ -132,6 +200,20 @@ func LoadIPAMConfig(bytes []byte, envArgs string) (*IPAMConfig, string, error) {
 		return nil, "", fmt.Errorf("no IP ranges specified")
 	}
 
+	switch n.IPAM.FamilyPolicy {
+	case "", FamilyPolicyRequireDual, FamilyPolicyPreferIPv4, FamilyPolicyPreferIPv6:
+	default:
+		return nil, "", fmt.Errorf("invalid familyPolicy %q, must be %s, %s or %s",
+			n.IPAM.FamilyPolicy, FamilyPolicyRequireDual, FamilyPolicyPreferIPv4, FamilyPolicyPreferIPv6)
+	}
+
+	switch n.IPAM.VerifyFree {
+	case "", VerifyFreeOff, VerifyFreeARP, VerifyFreeICMP:
+	default:
+		return nil, "", fmt.Errorf("invalid verifyFree %q, must be %s, %s or %s",
+			n.IPAM.VerifyFree, VerifyFreeARP, VerifyFreeICMP, VerifyFreeOff)
+	}
+
 	// Validate all ranges
 	numV4 := 0
 	numV6 := 0
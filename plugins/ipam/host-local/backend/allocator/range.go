@@ -17,6 +17,7 @@ package allocator
 import (
 	"fmt"
 	"net"
+	"regexp"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/plugins/pkg/ip"
@@ -84,6 +85,15 @@ func (r *Range) Canonicalize() error {
 		r.RangeEnd = lastIP(r.Subnet)
 	}
 
+	if r.Exclude != nil {
+		if err := r.Exclude.canonicalize(); err != nil {
+			return err
+		}
+		if r.Subnet.IP.To4() == nil && (len(r.Exclude.LastOctets) > 0 || r.Exclude.LastOctetBelow > 0) {
+			return fmt.Errorf("last octet exclusions only apply to IPv4 ranges, not %s", (*net.IPNet)(&r.Subnet).String())
+		}
+	}
+
 	return nil
 }
 
@@ -123,6 +133,15 @@ func (r *Range) Contains(addr net.IP) bool {
 	return true
 }
 
+// Excludes returns true if the given address is covered by the range's
+// exclusion policy and must not be allocated
+func (r *Range) Excludes(addr net.IP) bool {
+	if r.Exclude == nil {
+		return false
+	}
+	return r.Exclude.matches(addr)
+}
+
 // Overlaps returns true if there is any overlap between ranges
 func (r *Range) Overlaps(r1 *Range) bool {
 	// different families
@@ -164,3 +183,46 @@ func lastIP(subnet types.IPNet) net.IP {
 
 	return end
 }
+
+// canonicalize validates the exclusion policy and compiles its regexp
+func (e *Exclude) canonicalize() error {
+	for _, o := range e.LastOctets {
+		if o < 0 || o > 255 {
+			return fmt.Errorf("invalid excluded last octet %d", o)
+		}
+	}
+	if e.LastOctetBelow < 0 || e.LastOctetBelow > 256 {
+		return fmt.Errorf("invalid lastOctetBelow %d", e.LastOctetBelow)
+	}
+	if e.Regexp != "" {
+		re, err := regexp.Compile(e.Regexp)
+		if err != nil {
+			return fmt.Errorf("invalid exclude regexp %q: %v", e.Regexp, err)
+		}
+		e.re = re
+	}
+	return nil
+}
+
+// matches reports whether the address is excluded. The last octet policy
+// only applies to IPv4 addresses; the regexp, compiled when the range is
+// canonicalized, applies to both families.
+func (e *Exclude) matches(addr net.IP) bool {
+	if err := canonicalizeIP(&addr); err != nil {
+		return false
+	}
+
+	if len(addr) == net.IPv4len {
+		last := int(addr[len(addr)-1])
+		if last < e.LastOctetBelow {
+			return true
+		}
+		for _, o := range e.LastOctets {
+			if last == o {
+				return true
+			}
+		}
+	}
+
+	return e.re != nil && e.re.MatchString(addr.String())
+}
@@ -220,6 +220,48 @@ var _ = Describe("IP ranges", func() {
 			},
 			true),
 	)
+
+	It("should reject an invalid exclusion policy", func() {
+		r := Range{
+			Subnet:  mustSubnet("192.0.2.0/24"),
+			Exclude: &Exclude{LastOctets: []int{256}},
+		}
+		Expect(r.Canonicalize()).To(MatchError("invalid excluded last octet 256"))
+
+		r = Range{
+			Subnet:  mustSubnet("192.0.2.0/24"),
+			Exclude: &Exclude{Regexp: "("},
+		}
+		Expect(r.Canonicalize()).To(HaveOccurred())
+	})
+
+	It("should match addresses against the exclusion policy", func() {
+		r := Range{
+			Subnet:  mustSubnet("192.0.2.0/24"),
+			Exclude: &Exclude{LastOctets: []int{0xff}, LastOctetBelow: 0x10},
+		}
+		Expect(r.Canonicalize()).To(Succeed())
+		Expect(r.Excludes(net.ParseIP("192.0.2.5"))).To(BeTrue())
+		Expect(r.Excludes(net.ParseIP("192.0.2.16"))).To(BeFalse())
+		Expect(r.Excludes(net.ParseIP("192.0.2.255"))).To(BeTrue())
+
+		r = Range{
+			Subnet:  mustSubnet("2001:db8:1::/64"),
+			Exclude: &Exclude{Regexp: `::1?f$`},
+		}
+		Expect(r.Canonicalize()).To(Succeed())
+		Expect(r.Excludes(net.ParseIP("2001:db8:1::f"))).To(BeTrue())
+		Expect(r.Excludes(net.ParseIP("2001:db8:1::1f"))).To(BeTrue())
+		Expect(r.Excludes(net.ParseIP("2001:db8:1::2f"))).To(BeFalse())
+	})
+
+	It("should reject last octet exclusions in IPv6 ranges", func() {
+		r := Range{
+			Subnet:  mustSubnet("2001:db8:1::/64"),
+			Exclude: &Exclude{LastOctetBelow: 0x10},
+		}
+		Expect(r.Canonicalize()).To(MatchError("last octet exclusions only apply to IPv4 ranges, not 2001:db8:1::/64"))
+	})
 })
 
 func mustSubnet(s string) types.IPNet {
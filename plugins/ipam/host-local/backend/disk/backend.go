@@ -41,11 +41,48 @@ type Store struct {
 // Store implements the Store interface
 var _ backend.Store = &Store{}
 
-func New(network, dataDir string) (*Store, error) {
+// networkPlaceholder is replaced by the network name in a dataDir template
+const networkPlaceholder = "{network}"
+
+// DataDir returns the directory holding the allocations of a network. By
+// default it is a subdirectory of dataDir named after the network; dataDir
+// may instead be a template in which {network} is replaced by the network
+// name.
+func DataDir(network, dataDir string) string {
 	if dataDir == "" {
 		dataDir = defaultDataDir
 	}
-	dir := filepath.Join(dataDir, network)
+	if !strings.Contains(dataDir, networkPlaceholder) {
+		return filepath.Join(dataDir, network)
+	}
+	return strings.ReplaceAll(dataDir, networkPlaceholder, network)
+}
+
+func init() {
+	backend.Register(backend.DefaultStore, open)
+}
+
+func open(conf *backend.StoreConfig) (backend.Store, error) {
+	dir := DataDir(conf.Network, conf.DataDir)
+	var s *Store
+	var err error
+	if conf.ReadOnly {
+		s, err = OpenInDir(dir)
+	} else {
+		s, err = NewInDir(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func New(network, dataDir string) (*Store, error) {
+	return NewInDir(DataDir(network, dataDir))
+}
+
+// NewInDir returns a store keeping its allocations in dir
+func NewInDir(dir string) (*Store, error) {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, err
 	}
@@ -57,6 +94,16 @@ func New(network, dataDir string) (*Store, error) {
 	return &Store{lk, dir}, nil
 }
 
+// OpenInDir returns the existing store in dir, without creating it, for
+// read-only use. The error satisfies os.IsNotExist when there is none.
+func OpenInDir(dir string) (*Store, error) {
+	lk, err := NewFileLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{lk, dir}, nil
+}
+
 func (s *Store) Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error) {
 	fname := GetEscapedPath(s.dataDir, ip.String())
 
@@ -114,9 +161,11 @@ func (s *Store) FindByKey(match string) (bool, error) {
 	return found, err
 }
 
+// FindByID reports whether an IP is allocated to id. It only takes the
+// shared lock, so that concurrent lookups do not serialize.
 func (s *Store) FindByID(id string, ifname string) bool {
-	s.Lock()
-	defer s.Unlock()
+	s.RLock()
+	defer s.RUnlock()
 
 	match := strings.TrimSpace(id) + LineBreak + ifname
 	found, err := s.FindByKey(match)
@@ -194,6 +243,12 @@ func (s *Store) GetByID(id string, ifname string) []net.IP {
 	return ips
 }
 
+// Status checks that the allocations can be read
+func (s *Store) Status() error {
+	_, err := os.ReadDir(s.dataDir)
+	return err
+}
+
 func GetEscapedPath(dataDir string, fname string) string {
 	if runtime.GOOS == "windows" {
 		fname = strings.ReplaceAll(fname, ":", "_")
@@ -34,7 +34,7 @@ func NewFileLock(lockPath string) (*FileLock, error) {
 	}
 
 	if fi.IsDir() {
-		lockPath = path.Join(lockPath, "lock")
+		lockPath = path.Join(lockPath, lockFileName)
 	}
 
 	f, err := filemutex.New(lockPath)
@@ -58,3 +58,14 @@ func (l *FileLock) Lock() error {
 func (l *FileLock) Unlock() error {
 	return l.f.Unlock()
 }
+
+// RLock acquires a shared lock, which only excludes the holders of the
+// exclusive lock
+func (l *FileLock) RLock() error {
+	return l.f.RLock()
+}
+
+// RUnlock releases the shared lock
+func (l *FileLock) RUnlock() error {
+	return l.f.RUnlock()
+}
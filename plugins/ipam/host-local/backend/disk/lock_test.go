@@ -59,4 +59,24 @@ var _ = Describe("Lock Operations", func() {
 		err = m.Unlock()
 		Expect(err).ToNot(HaveOccurred())
 	})
+
+	It("shares the lock between readers", func() {
+		dir, err := os.MkdirTemp("", "")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		m1, err := NewFileLock(dir)
+		Expect(err).ToNot(HaveOccurred())
+		defer m1.Close()
+		m2, err := NewFileLock(dir)
+		Expect(err).ToNot(HaveOccurred())
+		defer m2.Close()
+
+		Expect(m1.RLock()).To(Succeed())
+		done := make(chan error, 1)
+		go func() { done <- m2.RLock() }()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(m2.RUnlock()).To(Succeed())
+		Expect(m1.RUnlock()).To(Succeed())
+	})
 })
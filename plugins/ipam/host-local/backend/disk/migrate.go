@@ -0,0 +1,110 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const lockFileName = "lock"
+
+// Migrate moves the allocations of every network found in dataDir into the
+// directory given by the dataDir template of the new layout. Only
+// directories created by a Store, i.e. holding a lock file, are considered
+// networks. It is meant to be run while no plugin is running, as the old
+// directories are removed once emptied.
+func Migrate(dataDir, template string) error {
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %v", dataDir, err)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		src := filepath.Join(dataDir, e.Name())
+		if _, err := os.Stat(filepath.Join(src, lockFileName)); err != nil {
+			continue
+		}
+		dst := DataDir(e.Name(), template)
+		if filepath.Clean(src) == filepath.Clean(dst) {
+			continue
+		}
+		if err := migrateNetwork(src, dst); err != nil {
+			return fmt.Errorf("failed to migrate network %q: %v", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+func migrateNetwork(src, dst string) error {
+	if err := moveAllocations(src, dst); err != nil {
+		return err
+	}
+
+	// The lock is released and closed by now
+	if err := os.Remove(filepath.Join(src, lockFileName)); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// moveAllocations moves the files of src to dst holding the locks of both
+func moveAllocations(src, dst string) error {
+	from, err := NewInDir(src)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	if err := from.Lock(); err != nil {
+		return err
+	}
+	defer from.Unlock()
+
+	to, err := NewInDir(dst)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+	if err := to.Lock(); err != nil {
+		return err
+	}
+	defer to.Unlock()
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == lockFileName {
+			continue
+		}
+		target := filepath.Join(dst, e.Name())
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%q already exists", target)
+		}
+		if err := os.Rename(filepath.Join(src, e.Name()), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
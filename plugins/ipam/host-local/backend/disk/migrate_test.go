@@ -0,0 +1,62 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Data directory layout", func() {
+	It("expands dataDir templates", func() {
+		Expect(DataDir("mynet", "/data")).To(Equal("/data/mynet"))
+		Expect(DataDir("mynet", "/data/{network}/ipam")).To(Equal("/data/mynet/ipam"))
+		Expect(DataDir("mynet", "")).To(Equal(filepath.Join(defaultDataDir, "mynet")))
+	})
+
+	It("migrates allocations into the new layout", func() {
+		dir, err := os.MkdirTemp("", "")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		oldDir := filepath.Join(dir, "networks")
+		store, err := New("mynet", oldDir)
+		Expect(err).ToNot(HaveOccurred())
+		ok, err := store.Reserve("ctr", "eth0", net.ParseIP("10.0.0.2"), "0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(store.Close()).To(Succeed())
+
+		template := filepath.Join(dir, "{network}", "ipam")
+		Expect(Migrate(oldDir, template)).To(Succeed())
+
+		_, err = os.Stat(filepath.Join(oldDir, "mynet"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		store, err = NewInDir(DataDir("mynet", template))
+		Expect(err).ToNot(HaveOccurred())
+		defer store.Close()
+		ips := store.GetByID("ctr", "eth0")
+		Expect(ips).To(HaveLen(1))
+		Expect(ips[0].Equal(net.ParseIP("10.0.0.2"))).To(BeTrue())
+		last, err := store.LastReservedIP("0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(last.String()).To(Equal("10.0.0.2"))
+	})
+})
@@ -0,0 +1,158 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory is a store keeping the allocations in memory, for tests
+// running the plugin in process. The allocations are lost when the process
+// exits, so it is not linked in the plugin; importing the package registers
+// it as "memory".
+package memory
+
+import (
+	"net"
+	"os"
+	"sync"
+
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend"
+)
+
+// Name is the store name in the IPAM configuration
+const Name = "memory"
+
+type allocation struct {
+	id     string
+	ifname string
+}
+
+// network holds the allocations of a network, shared by the stores opened
+// for it
+type network struct {
+	mu             sync.RWMutex
+	ips            map[string]allocation
+	lastReservedIP map[string]net.IP
+}
+
+// Store is a handle on the allocations of a network
+type Store struct {
+	*network
+}
+
+// Store implements the Store interface
+var _ backend.Store = &Store{}
+
+var (
+	networksMu sync.Mutex
+	networks   = map[string]*network{}
+)
+
+func init() {
+	backend.Register(Name, open)
+}
+
+func open(conf *backend.StoreConfig) (backend.Store, error) {
+	networksMu.Lock()
+	defer networksMu.Unlock()
+
+	n, ok := networks[conf.Network]
+	if !ok {
+		if conf.ReadOnly {
+			return nil, os.ErrNotExist
+		}
+		n = &network{
+			ips:            map[string]allocation{},
+			lastReservedIP: map[string]net.IP{},
+		}
+		networks[conf.Network] = n
+	}
+	return &Store{n}, nil
+}
+
+// Reset forgets the allocations of all the networks
+func Reset() {
+	networksMu.Lock()
+	defer networksMu.Unlock()
+	networks = map[string]*network{}
+}
+
+func (s *Store) Lock() error {
+	s.mu.Lock()
+	return nil
+}
+
+func (s *Store) Unlock() error {
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) RLock() error {
+	s.mu.RLock()
+	return nil
+}
+
+func (s *Store) RUnlock() error {
+	s.mu.RUnlock()
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) Status() error {
+	return nil
+}
+
+func (s *Store) Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error) {
+	key := ip.String()
+	if _, ok := s.ips[key]; ok {
+		return false, nil
+	}
+	s.ips[key] = allocation{id: id, ifname: ifname}
+	s.lastReservedIP[rangeID] = ip
+	return true, nil
+}
+
+func (s *Store) LastReservedIP(rangeID string) (net.IP, error) {
+	ip, ok := s.lastReservedIP[rangeID]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ip, nil
+}
+
+func (s *Store) ReleaseByID(id string, ifname string) error {
+	for key, a := range s.ips {
+		if a.id == id && a.ifname == ifname {
+			delete(s.ips, key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetByID(id string, ifname string) []net.IP {
+	var ips []net.IP
+	for key, a := range s.ips {
+		if a.id == id && a.ifname == ifname {
+			ips = append(ips, net.ParseIP(key))
+		}
+	}
+	return ips
+}
+
+// FindByID reports whether an IP is allocated to id. It takes the shared
+// lock, like the disk store.
+func (s *Store) FindByID(id string, ifname string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.GetByID(id, ifname)) > 0
+}
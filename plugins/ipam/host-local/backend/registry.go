@@ -0,0 +1,88 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultStore is the store of the networks which do not select one
+const DefaultStore = "disk"
+
+// StoreConfig locates the store of a network
+type StoreConfig struct {
+	Network string
+	// DataDir is the dataDir of the IPAM configuration, which file-based
+	// stores are kept in
+	DataDir string
+	// Options are the storeOptions of the IPAM configuration, specific to
+	// the store
+	Options json.RawMessage
+	// ReadOnly opens an existing store without creating it, for the
+	// commands which do not allocate. The error satisfies os.IsNotExist
+	// when there is none.
+	ReadOnly bool
+}
+
+// Opener opens the store of a network
+type Opener func(conf *StoreConfig) (Store, error)
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]Opener{}
+)
+
+// Register makes a store available by name to the "store" of the IPAM
+// configuration. Stores register themselves on init, so that the stores
+// linked in the binary are available; downstream builds add theirs with a
+// blank import in main.
+func Register(name string, open Opener) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if _, ok := stores[name]; ok {
+		panic(fmt.Sprintf("store %q registered twice", name))
+	}
+	stores[name] = open
+}
+
+// Stores returns the names of the registered stores
+func Stores() []string {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the named store, DefaultStore when empty
+func Open(name string, conf *StoreConfig) (Store, error) {
+	if name == "" {
+		name = DefaultStore
+	}
+	storesMu.Lock()
+	open, ok := stores[name]
+	storesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store %q, must be one of %s", name, strings.Join(Stores(), ", "))
+	}
+	return open(conf)
+}
@@ -16,12 +16,22 @@ package backend
 
 import "net"
 
+// Store keeps the allocations of a network. Stores are opened by name, see
+// Register.
 type Store interface {
 	Lock() error
 	Unlock() error
+	// RLock and RUnlock take the shared lock, for the commands which do
+	// not allocate
+	RLock() error
+	RUnlock() error
 	Close() error
 	Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error)
 	LastReservedIP(rangeID string) (net.IP, error)
 	ReleaseByID(id string, ifname string) error
 	GetByID(id string, ifname string) []net.IP
+	// FindByID reports whether an IP is allocated to id
+	FindByID(id string, ifname string) bool
+	// Status checks that the allocations can be read
+	Status() error
 }
@@ -41,6 +41,18 @@ func (s *FakeStore) Unlock() error {
 	return nil
 }
 
+func (s *FakeStore) RLock() error {
+	return nil
+}
+
+func (s *FakeStore) RUnlock() error {
+	return nil
+}
+
+func (s *FakeStore) Status() error {
+	return nil
+}
+
 func (s *FakeStore) Close() error {
 	return nil
 }
@@ -86,6 +98,10 @@ func (s *FakeStore) GetByID(id string, _ string) []net.IP {
 	return ips
 }
 
+func (s *FakeStore) FindByID(id string, ifname string) bool {
+	return len(s.GetByID(id, ifname)) > 0
+}
+
 func (s *FakeStore) SetIPMap(m map[string]string) {
 	s.ipMap = m
 }
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -23,12 +24,18 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/disk"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/memory"
 )
 
 const LineBreak = "\r\n"
@@ -680,6 +687,380 @@ var _ = Describe("host-local Operations", func() {
 	}
 })
 
+var _ = Describe("host-local read-only commands", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "host-local_test")
+		Expect(err).NotTo(HaveOccurred())
+		tmpDir = filepath.ToSlash(tmpDir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	newArgs := func(dataDir string) *skel.CmdArgs {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ipvlan",
+			"master": "foo0",
+			"ipam": {
+				"type": "host-local",
+				"subnet": "10.1.2.0/24",
+				"dataDir": "%s"
+			}
+		}`, dataDir)
+		return &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       "/some/where",
+			IfName:      "eth0",
+			StdinData:   []byte(conf),
+		}
+	}
+
+	It("checks while another reader holds the store lock", func() {
+		args := newArgs(tmpDir)
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := disk.NewFileLock(filepath.Join(tmpDir, "mynet"))
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+		Expect(reader.RLock()).To(Succeed())
+		defer reader.RUnlock()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- testutils.CmdCheckWithArgs(args, func() error {
+				return cmdCheck(args)
+			})
+		}()
+		Eventually(done).Should(Receive(BeNil()))
+
+		Expect(cmdStatus(args)).To(Succeed())
+	})
+
+	It("fails CHECK without creating the store", func() {
+		args := newArgs(tmpDir)
+		err := testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})
+		Expect(err).To(MatchError("host-local: Failed to find address added by container dummy"))
+		Expect(filepath.Join(tmpDir, "mynet")).NotTo(BeAnExistingFile())
+	})
+
+	It("reports STATUS before the first allocation", func() {
+		Expect(cmdStatus(newArgs(tmpDir))).To(Succeed())
+		Expect(filepath.Join(tmpDir, "mynet")).NotTo(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("host-local family policy", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "host-local_test")
+		Expect(err).NotTo(HaveOccurred())
+		tmpDir = filepath.ToSlash(tmpDir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	// The IPv6 range has a single address, exhausted by the first ADD
+	add := func(containerID, policy string) (*types100.Result, error) {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ipvlan",
+			"master": "foo0",
+			"ipam": {
+				"type": "host-local",
+				"dataDir": "%s",
+				"familyPolicy": "%s",
+				"ranges": [
+					[{"subnet": "10.1.2.0/24"}],
+					[{"subnet": "2001:db8:1::/64", "rangeStart": "2001:db8:1::10", "rangeEnd": "2001:db8:1::10"}]
+				]
+			}
+		}`, tmpDir, policy)
+		args := &skel.CmdArgs{
+			ContainerID: containerID,
+			Netns:       "/some/where",
+			IfName:      "eth0",
+			StdinData:   []byte(conf),
+		}
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return types100.GetResult(r)
+	}
+
+	It("requires both families by default", func() {
+		result, err := add("first", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs).To(HaveLen(2))
+
+		_, err = add("second", "")
+		var e *types.Error
+		Expect(errors.As(err, &e)).To(BeTrue())
+		Expect(e.Code).To(Equal(ipam.ErrAddressesExhausted))
+		Expect(e.Msg).To(Equal("failed to allocate for range 1: no IP addresses available in range set: 2001:db8:1::10-2001:db8:1::10"))
+	})
+
+	It("drops the exhausted family when the other one is preferred", func() {
+		_, err := add("first", "prefer-ipv4")
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := add("second", "prefer-ipv4")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs).To(HaveLen(1))
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.3/24"))
+	})
+
+	It("fails when the preferred family is exhausted", func() {
+		_, err := add("first", "prefer-ipv6")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = add("second", "prefer-ipv6")
+		Expect(err).To(MatchError(ContainSubstring("no IP addresses available")))
+
+		// The IPv4 address of the failed container is released
+		Expect(filepath.Join(tmpDir, "mynet", "10.1.2.3")).NotTo(BeAnExistingFile())
+	})
+
+	It("rejects unknown policies", func() {
+		_, err := add("first", "ipv4-only")
+		Expect(err).To(MatchError(ContainSubstring(`invalid familyPolicy "ipv4-only"`)))
+	})
+})
+
+var _ = Describe("host-local stores", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "host-local_test")
+		Expect(err).NotTo(HaveOccurred())
+		tmpDir = filepath.ToSlash(tmpDir)
+		memory.Reset()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	newArgs := func(containerID, store string) *skel.CmdArgs {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ipvlan",
+			"master": "foo0",
+			"ipam": {
+				"type": "host-local",
+				"subnet": "10.1.2.0/24",
+				"dataDir": "%s",
+				"store": "%s"
+			}
+		}`, tmpDir, store)
+		return &skel.CmdArgs{
+			ContainerID: containerID,
+			Netns:       "/some/where",
+			IfName:      "eth0",
+			StdinData:   []byte(conf),
+		}
+	}
+
+	It("allocates from the selected store with ADD/CHECK/DEL", func() {
+		args := newArgs("dummy", memory.Name)
+		Expect(cmdStatus(args)).To(Succeed())
+
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := types100.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.2/24"))
+
+		// Nothing is written to the data dir
+		Expect(filepath.Join(tmpDir, "mynet")).NotTo(BeAnExistingFile())
+
+		second := newArgs("second", memory.Name)
+		r, _, err = testutils.CmdAddWithArgs(second, func() error {
+			return cmdAdd(second)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err = types100.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.3/24"))
+
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(Succeed())
+		Expect(cmdStatus(args)).To(Succeed())
+
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+		err = testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})
+		Expect(err).To(MatchError("host-local: Failed to find address added by container dummy"))
+	})
+
+	It("defaults to the disk store", func() {
+		args := newArgs("dummy", "")
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(tmpDir, "mynet", "10.1.2.2")).To(BeAnExistingFile())
+	})
+
+	It("rejects unknown stores", func() {
+		args := newArgs("dummy", "sqlite")
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError(`unknown store "sqlite", must be one of disk, memory`))
+	})
+})
+
+var _ = Describe("host-local free address verification", func() {
+	var tmpDir string
+	var hostNS, peerNS ns.NetNS
+	var hostVethName string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "host-local_test")
+		Expect(err).NotTo(HaveOccurred())
+		tmpDir = filepath.ToSlash(tmpDir)
+
+		hostNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		peerNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		// A host of the network uses the first address of the range
+		err = peerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			hostVeth, peerVeth, err := ip.SetupVeth("eth0", 1500, "", hostNS)
+			Expect(err).NotTo(HaveOccurred())
+			hostVethName = hostVeth.Name
+
+			link, err := netlinksafe.LinkByName(peerVeth.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			addr, err := netlink.ParseAddr("10.1.2.2/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+		Expect(hostNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(hostNS)).To(Succeed())
+		Expect(peerNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(peerNS)).To(Succeed())
+	})
+
+	add := func(verifyFree, verifyInterface string) (*types100.Result, error) {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "macvlan",
+			"master": "foo0",
+			"ipam": {
+				"type": "host-local",
+				"subnet": "10.1.2.0/24",
+				"dataDir": "%s",
+				"verifyFree": "%s",
+				"verifyInterface": "%s"
+			}
+		}`, tmpDir, verifyFree, verifyInterface)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       "/some/where",
+			IfName:      "eth0",
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := hostNS.Do(func(ns.NetNS) error {
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			if err != nil {
+				return err
+			}
+			result, err = types100.GetResult(r)
+			return err
+		})
+		return result, err
+	}
+
+	It("skips the addresses answering ARP", func() {
+		result, err := add("arp", hostVethName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.3/24"))
+		Expect(filepath.Join(tmpDir, "mynet", "10.1.2.2")).NotTo(BeAnExistingFile())
+	})
+
+	It("probes on the interface on the link of the addresses", func() {
+		err := hostNS.Do(func(ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(hostVethName)
+			if err != nil {
+				return err
+			}
+			addr, err := netlink.ParseAddr("10.1.2.1/24")
+			if err != nil {
+				return err
+			}
+			return netlink.AddrAdd(link, addr)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, verifyFree := range []string{"arp", "icmp"} {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+			result, err := add(verifyFree, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.3/24"), verifyFree)
+		}
+	})
+
+	It("fails without an interface on the link of the addresses", func() {
+		_, err := add("arp", "")
+		Expect(err).To(MatchError(ContainSubstring("failed to verify that 10.1.2.2 is free")))
+	})
+
+	It("allocates without probing by default", func() {
+		result, err := add("off", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.2/24"))
+	})
+
+	It("rejects unknown probes", func() {
+		_, err := add("ping", "")
+		Expect(err).To(MatchError(`invalid verifyFree "ping", must be arp, icmp or off`))
+	})
+})
+
 func mustCIDR(s string) net.IPNet {
 	ip, n, err := net.ParseCIDR(s)
 	n.IP = ip
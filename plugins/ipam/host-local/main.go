@@ -16,38 +16,98 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net"
+	"os"
 	"strings"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/resolvconf"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/disk"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := cmdMigrate(os.Args[2:]); err != nil {
+			e, ok := err.(*types.Error)
+			if !ok {
+				e = types.NewError(types.ErrInternal, err.Error(), "")
+			}
+			if err := e.Print(); err != nil {
+				log.Print("Error writing error JSON to stdout: ", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	skel.PluginMainFuncs(skel.CNIFuncs{
 		Add:   cmdAdd,
 		Check: cmdCheck,
 		Del:   cmdDel,
 		/* FIXME GC */
-		/* FIXME Status */
+		Status: cmdStatus,
 	}, version.All, bv.BuildString("host-local"))
 }
 
+// cmdMigrate moves the allocations of every network into the layout given
+// by a dataDir template
+func cmdMigrate(argv []string) error {
+	var dataDir string
+	var template string
+	migrateFlags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	migrateFlags.StringVar(&dataDir, "datadir", "", "directory holding the existing allocations, one subdirectory per network")
+	migrateFlags.StringVar(&template, "to", "", "dataDir of the new layout, may contain {network}")
+	if err := migrateFlags.Parse(argv); err != nil {
+		return types.NewError(types.ErrInvalidNetworkConfig, "invalid migrate arguments", err.Error())
+	}
+
+	if template == "" {
+		return types.NewError(types.ErrInvalidNetworkConfig, "missing -to", "")
+	}
+	return disk.Migrate(dataDir, template)
+}
+
+func storeConfig(ipamConf *allocator.IPAMConfig, readOnly bool) *backend.StoreConfig {
+	return &backend.StoreConfig{
+		Network:  ipamConf.Name,
+		DataDir:  ipamConf.DataDir,
+		Options:  ipamConf.StoreOptions,
+		ReadOnly: readOnly,
+	}
+}
+
+func openStore(ipamConf *allocator.IPAMConfig) (backend.Store, error) {
+	return backend.Open(ipamConf.Store, storeConfig(ipamConf, false))
+}
+
+// openStoreReadOnly opens the existing store without creating it, for the
+// commands which do not allocate
+func openStoreReadOnly(ipamConf *allocator.IPAMConfig) (backend.Store, error) {
+	return backend.Open(ipamConf.Store, storeConfig(ipamConf, true))
+}
+
 func cmdCheck(args *skel.CmdArgs) error {
 	ipamConf, _, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
-		return err
+		return ipam.NewConfigError(err)
 	}
 
 	// Look to see if there is at least one IP address allocated to the container
 	// in the data dir, irrespective of what that address actually is
-	store, err := disk.New(ipamConf.Name, ipamConf.DataDir)
+	store, err := openStoreReadOnly(ipamConf)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("host-local: Failed to find address added by container %v", args.ContainerID)
+	}
 	if err != nil {
 		return err
 	}
@@ -61,23 +121,52 @@ func cmdCheck(args *skel.CmdArgs) error {
 	return nil
 }
 
+// cmdStatus reports whether the store can be read. Like CHECK it only takes
+// the shared lock, so that health checks do not wait for each other.
+func cmdStatus(args *skel.CmdArgs) error {
+	ipamConf, _, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
+	if err != nil {
+		return ipam.NewConfigError(err)
+	}
+
+	store, err := openStoreReadOnly(ipamConf)
+	if os.IsNotExist(err) {
+		// Nothing allocated yet, ADD creates the store
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("host-local: failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.RLock(); err != nil {
+		return ipam.NewContentionError(fmt.Errorf("host-local: failed to lock store: %v", err))
+	}
+	defer store.RUnlock()
+
+	if err := store.Status(); err != nil {
+		return fmt.Errorf("host-local: failed to read store: %v", err)
+	}
+	return nil
+}
+
 func cmdAdd(args *skel.CmdArgs) error {
 	ipamConf, confVersion, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
-		return err
+		return ipam.NewConfigError(err)
 	}
 
 	result := &current.Result{CNIVersion: current.ImplementedSpecVersion}
 
 	if ipamConf.ResolvConf != "" {
-		dns, err := parseResolvConf(ipamConf.ResolvConf)
+		dns, err := resolvconf.ParseFile(ipamConf.ResolvConf)
 		if err != nil {
 			return err
 		}
 		result.DNS = *dns
 	}
 
-	store, err := disk.New(ipamConf.Name, ipamConf.DataDir)
+	store, err := openStore(ipamConf)
 	if err != nil {
 		return err
 	}
@@ -95,8 +184,14 @@ func cmdAdd(args *skel.CmdArgs) error {
 		requestedIPs[ip.String()] = ip
 	}
 
+	inUse := inUseFunc(ipamConf)
+
+	var skipErr error
 	for idx, rangeset := range ipamConf.Ranges {
-		allocator := allocator.NewIPAllocator(&rangeset, store, idx)
+		ipAllocator := allocator.NewIPAllocator(&rangeset, store, idx)
+		if inUse != nil {
+			ipAllocator.VerifyFree(inUse)
+		}
 
 		// Check to see if there are any custom IPs requested in this range.
 		var requestedIP net.IP
@@ -108,20 +203,30 @@ func cmdAdd(args *skel.CmdArgs) error {
 			}
 		}
 
-		ipConf, err := allocator.Get(args.ContainerID, args.IfName, requestedIP)
+		ipConf, err := ipAllocator.Get(args.ContainerID, args.IfName, requestedIP)
+		if errors.Is(err, allocator.ErrExhausted) && ipamConf.Optional(&rangeset) {
+			// The family policy allows going without this family
+			skipErr = allocationError(fmt.Errorf("failed to allocate for range %d: %w", idx, err))
+			continue
+		}
 		if err != nil {
 			// Deallocate all already allocated IPs
 			for _, alloc := range allocs {
 				_ = alloc.Release(args.ContainerID, args.IfName)
 			}
-			return fmt.Errorf("failed to allocate for range %d: %v", idx, err)
+			return allocationError(fmt.Errorf("failed to allocate for range %d: %w", idx, err))
 		}
 
-		allocs = append(allocs, allocator)
+		allocs = append(allocs, ipAllocator)
 
 		result.IPs = append(result.IPs, ipConf)
 	}
 
+	// The policy only allows dropping a family, not all the addresses
+	if len(result.IPs) == 0 && skipErr != nil {
+		return skipErr
+	}
+
 	// If an IP was requested that wasn't fulfilled, fail
 	if len(requestedIPs) != 0 {
 		for _, alloc := range allocs {
@@ -142,10 +247,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 func cmdDel(args *skel.CmdArgs) error {
 	ipamConf, _, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
-		return err
+		return ipam.NewConfigError(err)
 	}
 
-	store, err := disk.New(ipamConf.Name, ipamConf.DataDir)
+	store, err := openStore(ipamConf)
 	if err != nil {
 		return err
 	}
@@ -153,17 +258,36 @@ func cmdDel(args *skel.CmdArgs) error {
 
 	// Loop through all ranges, releasing all IPs, even if an error occurs
 	var errs []string
+	locked := false
 	for idx, rangeset := range ipamConf.Ranges {
 		ipAllocator := allocator.NewIPAllocator(&rangeset, store, idx)
 
 		err := ipAllocator.Release(args.ContainerID, args.IfName)
 		if err != nil {
 			errs = append(errs, err.Error())
+			locked = locked || errors.Is(err, allocator.ErrLocked)
 		}
 	}
 
 	if errs != nil {
-		return errors.New(strings.Join(errs, ";"))
+		err := errors.New(strings.Join(errs, ";"))
+		if locked {
+			return ipam.NewContentionError(err)
+		}
+		return err
 	}
 	return nil
 }
+
+// allocationError returns the error of the allocator with the code telling
+// the runtime whether retrying may help: an exhausted range set needs
+// addresses released first, a locked store may be available later
+func allocationError(err error) error {
+	switch {
+	case errors.Is(err, allocator.ErrExhausted):
+		return ipam.NewExhaustedError(err)
+	case errors.Is(err, allocator.ErrLocked):
+		return ipam.NewContentionError(err)
+	}
+	return err
+}
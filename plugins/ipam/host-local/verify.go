@@ -0,0 +1,69 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+// probeTimeout is how long the answer to a probe is waited for
+const probeTimeout = 500 * time.Millisecond
+
+// inUseFunc returns the probe of the verifyFree of the configuration, nil
+// when the addresses are not verified
+func inUseFunc(ipamConf *allocator.IPAMConfig) allocator.InUseFunc {
+	switch ipamConf.VerifyFree {
+	case allocator.VerifyFreeARP:
+		return func(addr net.IP) (bool, error) {
+			ifName, err := probeInterface(ipamConf.VerifyInterface, addr)
+			if err != nil {
+				return false, err
+			}
+			return ip.ProbeNeighbor(ifName, addr, probeTimeout)
+		}
+	case allocator.VerifyFreeICMP:
+		return func(addr net.IP) (bool, error) {
+			return ip.ProbeICMP(ipamConf.VerifyInterface, addr, probeTimeout)
+		}
+	}
+	return nil
+}
+
+// probeInterface returns the interface of the host on the link of addr,
+// which is ifName when given
+func probeInterface(ifName string, addr net.IP) (string, error) {
+	if ifName != "" {
+		return ifName, nil
+	}
+	routes, err := netlink.RouteGet(addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup the route to %s: %v", addr, err)
+	}
+	if len(routes) == 0 || routes[0].Gw != nil {
+		return "", fmt.Errorf("no interface of the host is on the link of %s, set verifyInterface", addr)
+	}
+	link, err := netlink.LinkByIndex(routes[0].LinkIndex)
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup the interface of the route to %s: %v", addr, err)
+	}
+	return link.Attrs().Name, nil
+}
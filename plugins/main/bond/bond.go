@@ -0,0 +1,426 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating a bond device in the container from interfaces
+// already in the container, such as VFs added by previous plugins.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	defaultMode   = "active-backup"
+	defaultMiimon = 100
+)
+
+type NetConf struct {
+	types.NetConf
+	// Links are the interfaces of the container enslaved to the bond
+	Links []string `json:"links"`
+	// Mode is the bonding mode, such as "active-backup" or "802.3ad",
+	// active-backup by default
+	Mode string `json:"mode,omitempty"`
+	// Miimon is the link monitoring interval in milliseconds, 100 by
+	// default
+	Miimon int `json:"miimon,omitempty"`
+	// XmitHashPolicy selects the slave of a packet in the balance-xor,
+	// 802.3ad and balance-tlb modes, such as "layer2" or "layer3+4"
+	XmitHashPolicy string `json:"xmitHashPolicy,omitempty"`
+	MTU            int    `json:"mtu,omitempty"`
+
+	mode           netlink.BondMode
+	xmitHashPolicy netlink.BondXmitHashPolicy
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	if len(n.Links) == 0 {
+		return nil, fmt.Errorf(`"links" field is required. It specifies the interfaces to enslave to the bond`)
+	}
+	seen := make(map[string]bool, len(n.Links))
+	for _, l := range n.Links {
+		if l == "" || seen[l] {
+			return nil, fmt.Errorf("invalid links %v, the interface names must be unique and not empty", n.Links)
+		}
+		seen[l] = true
+	}
+
+	if n.Mode == "" {
+		n.Mode = defaultMode
+	}
+	n.mode = netlink.StringToBondMode(n.Mode)
+	if n.mode == netlink.BOND_MODE_UNKNOWN {
+		return nil, fmt.Errorf("invalid bond mode %q", n.Mode)
+	}
+	if n.Miimon == 0 {
+		n.Miimon = defaultMiimon
+	}
+	if n.Miimon < 0 {
+		return nil, fmt.Errorf("invalid miimon %d", n.Miimon)
+	}
+	if n.XmitHashPolicy != "" {
+		n.xmitHashPolicy = netlink.StringToBondXmitHashPolicy(n.XmitHashPolicy)
+		if n.xmitHashPolicy == netlink.BOND_XMIT_HASH_POLICY_UNKNOWN {
+			return nil, fmt.Errorf("invalid xmitHashPolicy %q", n.XmitHashPolicy)
+		}
+		switch n.mode {
+		case netlink.BOND_MODE_BALANCE_XOR, netlink.BOND_MODE_802_3AD, netlink.BOND_MODE_BALANCE_TLB:
+		default:
+			return nil, fmt.Errorf("xmitHashPolicy is not used in bond mode %q", n.Mode)
+		}
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the bond
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// lookupLinks returns the interfaces to enslave, which must not be
+// enslaved already. It must be called in the container namespace.
+func lookupLinks(names []string) ([]netlink.Link, error) {
+	links := make([]netlink.Link, 0, len(names))
+	for _, name := range names {
+		link, err := netlinksafe.LinkByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup link %q: %v", name, err)
+		}
+		if link.Attrs().MasterIndex != 0 {
+			return nil, fmt.Errorf("link %q is already enslaved", name)
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// createBond creates the bond in the current namespace and enslaves the
+// links to it. The bond is deleted on error.
+func createBond(conf *NetConf, ifName string) (netlink.Link, error) {
+	links, err := lookupLinks(conf.Links)
+	if err != nil {
+		return nil, err
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.Name = ifName
+	linkAttrs.MTU = conf.MTU
+	bond := netlink.NewLinkBond(linkAttrs)
+	bond.Mode = conf.mode
+	bond.Miimon = conf.Miimon
+	if conf.XmitHashPolicy != "" {
+		bond.XmitHashPolicy = conf.xmitHashPolicy
+	}
+	if err := netlink.LinkAdd(bond); err != nil {
+		return nil, fmt.Errorf("failed to create bond %q: %v", ifName, err)
+	}
+
+	err = func() error {
+		// The bonding driver only accepts links which are down, and
+		// brings them up itself with the bond
+		for _, link := range links {
+			name := link.Attrs().Name
+			if link.Attrs().Flags&net.FlagUp != 0 {
+				if err := netlink.LinkSetDown(link); err != nil {
+					return fmt.Errorf("failed to set %q down: %v", name, err)
+				}
+			}
+			if err := netlink.LinkSetMasterByIndex(link, bond.Attrs().Index); err != nil {
+				return fmt.Errorf("failed to enslave %q to bond %q: %v", name, ifName, err)
+			}
+		}
+		if err := netlink.LinkSetUp(bond); err != nil {
+			return fmt.Errorf("failed to set %q up: %v", ifName, err)
+		}
+		return nil
+	}()
+	if err != nil {
+		_ = netlink.LinkDel(bond)
+		return nil, err
+	}
+
+	// Re-fetch the bond for the MAC it took from its first slave
+	return netlinksafe.LinkByName(ifName)
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	var bond netlink.Link
+	err = netns.Do(func(_ ns.NetNS) error {
+		var err error
+		bond, err = createBond(n, args.IfName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Delete the bond, releasing its slaves, if the addresses can't be
+	// configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{{
+			Name:    args.IfName,
+			Mac:     bond.Attrs().HardwareAddr.String(),
+			Sandbox: netns.Path(),
+		}},
+	}
+
+	if !n.hasIPAM() {
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the bond
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	// Deleting the bond releases its slaves, which stay in the container
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("bond: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("bond: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	bond, isBond := link.(*netlink.Bond)
+	if !isBond {
+		return fmt.Errorf("bond: Container interface %s not of type bond", intf.Name)
+	}
+	if bond.Mode != n.mode {
+		return fmt.Errorf("bond: Interface %s mode %s doesn't match configured mode %s", intf.Name, bond.Mode, n.Mode)
+	}
+	if bond.Miimon != n.Miimon {
+		return fmt.Errorf("bond: Interface %s miimon %d doesn't match configured miimon %d", intf.Name, bond.Miimon, n.Miimon)
+	}
+	if n.XmitHashPolicy != "" && bond.XmitHashPolicy != n.xmitHashPolicy {
+		return fmt.Errorf("bond: Interface %s xmitHashPolicy %s doesn't match configured xmitHashPolicy %s", intf.Name, bond.XmitHashPolicy, n.XmitHashPolicy)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("bond: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+
+	for _, name := range n.Links {
+		slave, err := netlinksafe.LinkByName(name)
+		if err != nil {
+			return fmt.Errorf("bond: link %s of %s not found", name, intf.Name)
+		}
+		if slave.Attrs().MasterIndex != link.Attrs().Index {
+			return fmt.Errorf("bond: link %s is not enslaved to %s", name, intf.Name)
+		}
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("bond"))
+}
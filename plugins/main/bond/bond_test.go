@@ -0,0 +1,315 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	IFNAME = "bond0"
+	SLAVE1 = "net1"
+	SLAVE2 = "net2"
+)
+
+var _ = Describe("bond configuration", func() {
+	It("applies the defaults", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "bond", "links": ["net1", "net2"]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Mode).To(Equal("active-backup"))
+		Expect(n.mode).To(Equal(netlink.BOND_MODE_ACTIVE_BACKUP))
+		Expect(n.Miimon).To(Equal(defaultMiimon))
+		Expect(n.hasIPAM()).To(BeFalse())
+	})
+
+	It("parses the transmit hash policy", func() {
+		n, err := loadConf([]byte(`{"links": ["net1", "net2"], "mode": "802.3ad", "xmitHashPolicy": "layer3+4"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.mode).To(Equal(netlink.BOND_MODE_802_3AD))
+		Expect(n.xmitHashPolicy).To(Equal(netlink.BOND_XMIT_HASH_POLICY_LAYER3_4))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("without links", `{}`, `"links" field is required`),
+		Entry("with a duplicate link", `{"links": ["net1", "net1"]}`, "must be unique"),
+		Entry("with an invalid mode", `{"links": ["net1"], "mode": "foo"}`, `invalid bond mode "foo"`),
+		Entry("with a negative miimon", `{"links": ["net1"], "miimon": -1}`, "invalid miimon -1"),
+		Entry("with an invalid hash policy", `{"links": ["net1"], "mode": "balance-xor", "xmitHashPolicy": "foo"}`, `invalid xmitHashPolicy "foo"`),
+		Entry("with a hash policy in active-backup mode", `{"links": ["net1"], "xmitHashPolicy": "layer2"}`, `not used in bond mode "active-backup"`),
+		Entry("with a negative MTU", `{"links": ["net1"], "mtu": -1}`, "invalid MTU -1"),
+	)
+})
+
+var _ = Describe("bond Operations", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir, err = os.MkdirTemp("", "bond_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		// The slaves are veths added to the container by previous plugins
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			for _, name := range []string{SLAVE1, SLAVE2} {
+				linkAttrs := netlink.NewLinkAttrs()
+				linkAttrs.Name = name
+				Expect(netlink.LinkAdd(&netlink.Veth{
+					LinkAttrs: linkAttrs,
+					PeerName:  name + "-peer",
+				})).To(Succeed())
+				link, err := netlinksafe.LinkByName(name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.LinkSetUp(link)).To(Succeed())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("refuses to enslave a link already enslaved", func() {
+		conf, err := loadConf([]byte(`{"links": ["net1", "net2"]}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := createBond(conf, IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = createBond(conf, "bond1")
+			return err
+		})
+		Expect(err).To(MatchError(`link "net1" is already enslaved`))
+	})
+
+	It("fails without deleting anything when a link is missing", func() {
+		conf, err := loadConf([]byte(`{"links": ["net1", "net3"]}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := createBond(conf, IFNAME)
+			Expect(err).To(MatchError(ContainSubstring(`failed to lookup link "net3"`)))
+			_, err = netlinksafe.LinkByName(IFNAME)
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	for _, ver := range testutils.AllSpecVersions {
+		// Redefine ver inside for scope so real value is picked up by each dynamically defined It()
+		// See Gingkgo's "Patterns for dynamically generating tests" documentation.
+		ver := ver
+
+		It(fmt.Sprintf("[%s] configures and deconfigures a bond with ADD/CHECK/DEL", ver), func() {
+			conf := fmt.Sprintf(`{
+				"cniVersion": "%s",
+				"name": "bondTest",
+				"type": "bond",
+				"links": ["%s", "%s"],
+				"mode": "balance-xor",
+				"miimon": 200,
+				"xmitHashPolicy": "layer2+3",
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.1.2.0/24",
+					"dataDir": "%s"
+				}
+			}`, ver, SLAVE1, SLAVE2, dataDir)
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       targetNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   []byte(conf),
+			}
+
+			var result types.Result
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				var err error
+				if testutils.SpecVersionHasSTATUS(ver) {
+					err = testutils.CmdStatus(func() error {
+						return cmdStatus(args)
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				result, _, err = testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				bond, ok := link.(*netlink.Bond)
+				Expect(ok).To(BeTrue())
+				Expect(bond.Mode).To(Equal(netlink.BOND_MODE_BALANCE_XOR))
+				Expect(bond.Miimon).To(Equal(200))
+				Expect(bond.XmitHashPolicy).To(Equal(netlink.BOND_XMIT_HASH_POLICY_LAYER2_3))
+				Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+				addrs, err := netlinksafe.AddrList(link, unix.AF_INET)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(addrs).To(HaveLen(1))
+
+				for _, name := range []string{SLAVE1, SLAVE2} {
+					slave, err := netlinksafe.LinkByName(name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(slave.Attrs().MasterIndex).To(Equal(link.Attrs().Index))
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// CHECK against the result converted to the current version
+			r, err := types100.GetResult(result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.IPs).To(HaveLen(1))
+			confMap := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+			prevResult, err := r.GetAsVersion(ver)
+			Expect(err).NotTo(HaveOccurred())
+			confMap["prevResult"] = prevResult
+			args.StdinData, err = json.Marshal(confMap)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+			})
+			if testutils.SpecVersionHasCHECK(ver) {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError("config version does not allow CHECK"))
+			}
+
+			args.StdinData = []byte(conf)
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The slaves are released and stay in the container
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				_, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).To(HaveOccurred())
+				for _, name := range []string{SLAVE1, SLAVE2} {
+					slave, err := netlinksafe.LinkByName(name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(slave.Attrs().MasterIndex).To(BeZero())
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// DEL can be called multiple times
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	}
+
+	It("fails CHECK when a link left the bond", func() {
+		conf := `{
+			"cniVersion": "1.0.0",
+			"name": "bondTest",
+			"type": "bond",
+			"links": ["net1", "net2"]
+		}`
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result types.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			var err error
+			result, _, err = testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			slave, err := netlinksafe.LinkByName(SLAVE2)
+			if err != nil {
+				return err
+			}
+			return netlink.LinkSetNoMaster(slave)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err := types100.GetResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		confMap := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+		confMap["prevResult"] = r
+		args.StdinData, err = json.Marshal(confMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			return testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+		})
+		Expect(err).To(MatchError("bond: link net2 is not enslaved to bond0"))
+	})
+})
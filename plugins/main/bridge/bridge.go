@@ -22,6 +22,7 @@ import (
 	"os"
 	"runtime"
 	"sort"
+	"strings"
 	"syscall"
 	"time"
 
@@ -36,6 +37,7 @@ import (
 	"github.com/containernetworking/plugins/pkg/link"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/topology"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 	"github.com/containernetworking/plugins/pkg/utils/sysctl"
 )
@@ -54,6 +56,7 @@ type NetConf struct {
 	IPMasq                    bool         `json:"ipMasq"`
 	IPMasqBackend             *string      `json:"ipMasqBackend,omitempty"`
 	MTU                       int          `json:"mtu"`
+	PortMTU                   int          `json:"portMTU,omitempty"`
 	HairpinMode               bool         `json:"hairpinMode"`
 	PromiscMode               bool         `json:"promiscMode"`
 	Vlan                      int          `json:"vlan"`
@@ -63,6 +66,16 @@ type NetConf struct {
 	EnableDad                 bool         `json:"enabledad,omitempty"`
 	DisableContainerInterface bool         `json:"disableContainerInterface,omitempty"`
 	PortIsolation             bool         `json:"portIsolation,omitempty"`
+	NeighSuppress             bool         `json:"neighSuppress,omitempty"`
+	GratuitousArp             bool         `json:"gratuitousArp,omitempty"`
+	BridgeVlanGateway         bool         `json:"bridgeVlanGateway,omitempty"`
+	DadTimeoutMs              int          `json:"dadTimeoutMs,omitempty"`
+	AsyncDad                  bool         `json:"asyncDad,omitempty"`
+	ProxyArp                  bool         `json:"proxyArp,omitempty"`
+
+	// TxQueueLen is the transmit queue length of the bridge and of both
+	// ends of the veth pair, set when they are created
+	TxQueueLen *int `json:"txQueueLen,omitempty"`
 
 	Args struct {
 		Cni BridgeArgs `json:"cni,omitempty"`
@@ -71,8 +84,9 @@ type NetConf struct {
 		Mac string `json:"mac,omitempty"`
 	} `json:"runtimeConfig,omitempty"`
 
-	mac   string
-	vlans []int
+	mac     string
+	portMTU int
+	vlans   []int
 }
 
 type VlanTrunk struct {
@@ -83,6 +97,7 @@ type VlanTrunk struct {
 
 type BridgeArgs struct {
 	Mac string `json:"mac,omitempty"`
+	MTU int    `json:"mtu,omitempty"`
 }
 
 // MacEnvArgs represents CNI_ARGS
@@ -114,6 +129,12 @@ func loadNetConf(bytes []byte, envArgs string) (*NetConf, string, error) {
 	if n.Vlan < 0 || n.Vlan > 4094 {
 		return nil, "", fmt.Errorf("invalid VLAN ID %d (must be between 0 and 4094)", n.Vlan)
 	}
+	if n.DadTimeoutMs < 0 {
+		return nil, "", fmt.Errorf("invalid dadTimeoutMs %d", n.DadTimeoutMs)
+	}
+	if n.BridgeVlanGateway && n.Vlan == 0 {
+		return nil, "", fmt.Errorf("bridgeVlanGateway requires a VLAN ID")
+	}
 	var err error
 	n.vlans, err = collectVlanTrunk(n.VlanTrunk)
 	if err != nil {
@@ -140,9 +161,47 @@ func loadNetConf(bytes []byte, envArgs string) (*NetConf, string, error) {
 		n.mac = mac
 	}
 
+	// The veth MTU defaults to the bridge MTU but may be overridden per
+	// network or per attachment, e.g. jumbo frames only for storage pods
+	n.portMTU = n.MTU
+	if n.PortMTU != 0 {
+		n.portMTU = n.PortMTU
+	}
+	if mtu := n.Args.Cni.MTU; mtu != 0 {
+		n.portMTU = mtu
+	}
+	if n.portMTU < 0 {
+		return nil, "", fmt.Errorf("invalid port MTU %d", n.portMTU)
+	}
+	if n.TxQueueLen != nil && *n.TxQueueLen < 0 {
+		return nil, "", fmt.Errorf("invalid txQueueLen %d", *n.TxQueueLen)
+	}
+
 	return n, n.CNIVersion, nil
 }
 
+// txQLen returns the configured transmit queue length, or -1 to keep the
+// kernel default
+func (n *NetConf) txQLen() int {
+	if n.TxQueueLen == nil {
+		return -1
+	}
+	return *n.TxQueueLen
+}
+
+// dadTimeout returns how long ADD waits for IPv6 DAD to complete. With
+// asyncDad it does not wait, and CHECK reports DAD still being in progress.
+func (n *NetConf) dadTimeout() time.Duration {
+	switch {
+	case n.AsyncDad:
+		return 0
+	case n.DadTimeoutMs > 0:
+		return time.Duration(n.DadTimeoutMs) * time.Millisecond
+	default:
+		return ipam.DADSettleTimeout
+	}
+}
+
 // This method is copied from https://github.com/k8snetworkplumbingwg/ovs-cni/blob/v0.27.2/pkg/plugin/plugin.go
 func collectVlanTrunk(vlanTrunk []*VlanTrunk) ([]int, error) {
 	if vlanTrunk == nil {
@@ -329,10 +388,11 @@ func bridgeByName(name string) (*netlink.Bridge, error) {
 	return br, nil
 }
 
-func ensureBridge(brName string, mtu int, promiscMode, vlanFiltering bool) (*netlink.Bridge, error) {
+func ensureBridge(brName string, mtu, txQLen int, promiscMode, vlanFiltering bool) (*netlink.Bridge, error) {
 	linkAttrs := netlink.NewLinkAttrs()
 	linkAttrs.Name = brName
 	linkAttrs.MTU = mtu
+	linkAttrs.TxQLen = txQLen
 	br := &netlink.Bridge{
 		LinkAttrs: linkAttrs,
 	}
@@ -358,6 +418,13 @@ func ensureBridge(brName string, mtu int, promiscMode, vlanFiltering bool) (*net
 		return nil, err
 	}
 
+	// An existing bridge keeps its queue length unless one is configured
+	if txQLen >= 0 && br.TxQLen != txQLen {
+		if err := netlink.LinkSetTxQLen(br, txQLen); err != nil {
+			return nil, fmt.Errorf("could not set transmit queue length on %q: %v", brName, err)
+		}
+	}
+
 	// we want to own the routes for this interface
 	_, _ = sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/accept_ra", brName), "0")
 
@@ -382,7 +449,7 @@ func ensureVlanInterface(br *netlink.Bridge, vlanID int, preserveDefaultVlan boo
 			return nil, fmt.Errorf("faild to find host namespace: %v", err)
 		}
 
-		_, brGatewayIface, err := setupVeth(hostNS, br, name, br.MTU, false, vlanID, nil, preserveDefaultVlan, "", false)
+		_, brGatewayIface, err := setupVeth(hostNS, br, name, br.MTU, -1, false, vlanID, nil, preserveDefaultVlan, "", false, false)
 		if err != nil {
 			return nil, fmt.Errorf("faild to create vlan gateway %q: %v", name, err)
 		}
@@ -401,17 +468,63 @@ func ensureVlanInterface(br *netlink.Bridge, vlanID int, preserveDefaultVlan boo
 	return brGatewayVeth, nil
 }
 
+// ensureBridgeVlanSubinterface creates a VLAN subinterface on top of the
+// bridge device itself to hold the gateway address of a tagged VLAN, and
+// makes the bridge accept the tagged frames for it.
+func ensureBridgeVlanSubinterface(br *netlink.Bridge, vlanID int) (netlink.Link, error) {
+	name := fmt.Sprintf("%s.%d", br.Name, vlanID)
+
+	if err := netlink.BridgeVlanAdd(br, uint16(vlanID), false, false, true, false); err != nil {
+		return nil, fmt.Errorf("failed to add vlan %d to bridge %q: %v", vlanID, br.Name, err)
+	}
+
+	vlanLink, err := netlinksafe.LinkByName(name)
+	if err == nil {
+		if _, ok := vlanLink.(*netlink.Vlan); !ok {
+			return nil, fmt.Errorf("%q already exists but is not a vlan interface", name)
+		}
+		return vlanLink, nil
+	}
+	if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return nil, fmt.Errorf("failed to find interface %q: %v", name, err)
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.Name = name
+	linkAttrs.ParentIndex = br.Index
+	linkAttrs.MTU = br.MTU
+	if err := netlink.LinkAdd(&netlink.Vlan{LinkAttrs: linkAttrs, VlanId: vlanID}); err != nil && err != syscall.EEXIST {
+		return nil, fmt.Errorf("failed to create vlan interface %q: %v", name, err)
+	}
+
+	vlanLink, err = netlinksafe.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup %q: %v", name, err)
+	}
+
+	// we want to own the routes for this interface
+	_, _ = sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/accept_ra", name), "0")
+
+	if err := netlink.LinkSetUp(vlanLink); err != nil {
+		return nil, fmt.Errorf("failed to up %q: %v", name, err)
+	}
+
+	return vlanLink, nil
+}
+
 func setupVeth(
 	netns ns.NetNS,
 	br *netlink.Bridge,
 	ifName string,
 	mtu int,
+	txQLen int,
 	hairpinMode bool,
 	vlanID int,
 	vlans []int,
 	preserveDefaultVlan bool,
 	mac string,
 	portIsolation bool,
+	neighSuppress bool,
 ) (*current.Interface, *current.Interface, error) {
 	contIface := &current.Interface{}
 	hostIface := &current.Interface{}
@@ -422,6 +535,15 @@ func setupVeth(
 		if err != nil {
 			return err
 		}
+		if txQLen >= 0 {
+			contVeth, err := netlinksafe.LinkByName(containerVeth.Name)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", containerVeth.Name, err)
+			}
+			if err := netlink.LinkSetTxQLen(contVeth, txQLen); err != nil {
+				return fmt.Errorf("failed to set transmit queue length on %q: %v", containerVeth.Name, err)
+			}
+		}
 		contIface.Name = containerVeth.Name
 		contIface.Mac = containerVeth.HardwareAddr.String()
 		contIface.Sandbox = netns.Path()
@@ -439,6 +561,12 @@ func setupVeth(
 	}
 	hostIface.Mac = hostVeth.Attrs().HardwareAddr.String()
 
+	if txQLen >= 0 {
+		if err := netlink.LinkSetTxQLen(hostVeth, txQLen); err != nil {
+			return nil, nil, fmt.Errorf("failed to set transmit queue length on %q: %v", hostIface.Name, err)
+		}
+	}
+
 	// connect host veth end to the bridge
 	if err := netlink.LinkSetMaster(hostVeth, br); err != nil {
 		return nil, nil, fmt.Errorf("failed to connect %q to bridge %v: %v", hostVeth.Attrs().Name, br.Attrs().Name, err)
@@ -454,6 +582,14 @@ func setupVeth(
 		return nil, nil, fmt.Errorf("failed to set isolated on for %v: %v", hostVeth.Attrs().Name, err)
 	}
 
+	// With neighbor suppression the bridge answers ARP and ND requests for
+	// the port from its neighbor table instead of flooding them
+	if neighSuppress {
+		if err = netlink.LinkSetBrNeighSuppress(hostVeth, true); err != nil {
+			return nil, nil, fmt.Errorf("failed to set neighbor suppression on for %v: %v", hostVeth.Attrs().Name, err)
+		}
+	}
+
 	if (vlanID != 0 || len(vlans) > 0) && !preserveDefaultVlan {
 		err = removeDefaultVlan(hostVeth)
 		if err != nil {
@@ -506,6 +642,72 @@ func removeDefaultVlan(hostVeth netlink.Link) error {
 	return nil
 }
 
+// gatewayName returns the name of the interface holding the gateway
+// addresses
+func (n *NetConf) gatewayName() string {
+	if n.Vlan != 0 {
+		return fmt.Sprintf("%s.%d", n.BrName, n.Vlan)
+	}
+	return n.BrName
+}
+
+// setupProxyArp makes the gateway interface answer ARP and neighbor
+// solicitations on behalf of the containers, so that they can reach each
+// other through the node when direct L2 traffic is blocked, e.g. with port
+// isolation. IPv6 needs an explicit proxy entry per container address.
+func setupProxyArp(gwName string, ips []*current.IPConfig) error {
+	// proxy_arp_pvlan answers for hosts reached through the same interface
+	for _, key := range []string{"proxy_arp", "proxy_arp_pvlan"} {
+		if _, err := sysctl.Sysctl(fmt.Sprintf("net/ipv4/conf/%s/%s", gwName, key), "1"); err != nil {
+			return fmt.Errorf("failed to enable %s on %q: %v", key, gwName, err)
+		}
+	}
+
+	gwLink, err := netlinksafe.LinkByName(gwName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", gwName, err)
+	}
+
+	for _, ipc := range ips {
+		if ipc.Address.IP.To4() != nil {
+			continue
+		}
+		if _, err := sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/proxy_ndp", gwName), "1"); err != nil {
+			return fmt.Errorf("failed to enable proxy_ndp on %q: %v", gwName, err)
+		}
+		neigh := &netlink.Neigh{
+			LinkIndex: gwLink.Attrs().Index,
+			Family:    netlink.FAMILY_V6,
+			Flags:     netlink.NTF_PROXY,
+			IP:        ipc.Address.IP,
+		}
+		if err := netlink.NeighSet(neigh); err != nil {
+			return fmt.Errorf("failed to add proxy neighbor %s on %q: %v", ipc.Address.IP, gwName, err)
+		}
+	}
+	return nil
+}
+
+// teardownProxyNdp removes the IPv6 proxy entries of the container
+// addresses; errors are ignored as the entries may already be gone
+func teardownProxyNdp(gwName string, ipnets []*net.IPNet) {
+	gwLink, err := netlinksafe.LinkByName(gwName)
+	if err != nil {
+		return
+	}
+	for _, ipn := range ipnets {
+		if ipn.IP.To4() != nil {
+			continue
+		}
+		_ = netlink.NeighDel(&netlink.Neigh{
+			LinkIndex: gwLink.Attrs().Index,
+			Family:    netlink.FAMILY_V6,
+			Flags:     netlink.NTF_PROXY,
+			IP:        ipn.IP,
+		})
+	}
+}
+
 func calcGatewayIP(ipn *net.IPNet) net.IP {
 	nid := ipn.IP.Mask(ipn.Mask)
 	return ip.NextIP(nid)
@@ -514,7 +716,7 @@ func calcGatewayIP(ipn *net.IPNet) net.IP {
 func setupBridge(n *NetConf) (*netlink.Bridge, *current.Interface, error) {
 	vlanFiltering := n.Vlan != 0 || n.VlanTrunk != nil
 	// create bridge if necessary
-	br, err := ensureBridge(n.BrName, n.MTU, n.PromiscMode, vlanFiltering)
+	br, err := ensureBridge(n.BrName, n.MTU, n.txQLen(), n.PromiscMode, vlanFiltering)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create bridge %q: %v", n.BrName, err)
 	}
@@ -554,6 +756,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return fmt.Errorf("cannot set hairpin mode and promiscuous mode at the same time")
 	}
 
+	if n.ProxyArp && !n.IsGW {
+		return fmt.Errorf("proxyArp requires isGateway")
+	}
+
 	br, brInterface, err := setupBridge(n)
 	if err != nil {
 		return err
@@ -565,11 +771,15 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	defer netns.Close()
 
-	hostInterface, containerInterface, err := setupVeth(netns, br, args.IfName, n.MTU, n.HairpinMode, n.Vlan, n.vlans, n.PreserveDefaultVlan, n.mac, n.PortIsolation)
+	hostInterface, containerInterface, err := setupVeth(netns, br, args.IfName, n.portMTU, n.txQLen(), n.HairpinMode, n.Vlan, n.vlans, n.PreserveDefaultVlan, n.mac, n.PortIsolation, n.NeighSuppress)
 	if err != nil {
 		return err
 	}
 
+	if err := setPortOwner(hostInterface.Name, args.ContainerID, args.IfName); err != nil {
+		return err
+	}
+
 	// Assume L2 interface only
 	result := &current.Result{
 		CNIVersion: current.ImplementedSpecVersion,
@@ -639,7 +849,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 			_, _ = sysctl.Sysctl(fmt.Sprintf("net/ipv4/conf/%s/arp_notify", args.IfName), "1")
 
 			// Add the IP to the interface
-			return ipam.ConfigureIface(args.IfName, result)
+			return ipam.ConfigureIfaceWithDADTimeout(args.IfName, result, n.dadTimeout())
 		}); err != nil {
 			return err
 		}
@@ -650,7 +860,12 @@ func cmdAdd(args *skel.CmdArgs) error {
 			for _, gws := range []*gwInfo{gwsV4, gwsV6} {
 				for _, gw := range gws.gws {
 					if n.Vlan != 0 {
-						vlanIface, err := ensureVlanInterface(br, n.Vlan, n.PreserveDefaultVlan)
+						var vlanIface netlink.Link
+						if n.BridgeVlanGateway {
+							vlanIface, err = ensureBridgeVlanSubinterface(br, n.Vlan)
+						} else {
+							vlanIface, err = ensureVlanInterface(br, n.Vlan, n.PreserveDefaultVlan)
+						}
 						if err != nil {
 							return fmt.Errorf("failed to create vlan interface: %v", err)
 						}
@@ -681,6 +896,16 @@ func cmdAdd(args *skel.CmdArgs) error {
 					}
 				}
 			}
+
+			if n.ProxyArp {
+				gwName := br.Name
+				if vlanInterface != nil {
+					gwName = vlanInterface.Name
+				}
+				if err := setupProxyArp(gwName, result.IPs); err != nil {
+					return err
+				}
+			}
 		}
 
 		if n.IPMasq {
@@ -734,6 +959,20 @@ func cmdAdd(args *skel.CmdArgs) error {
 		}
 	}
 
+	// Announce the container addresses once the port is forwarding so that
+	// L2 peers learn their new location right away
+	if n.GratuitousArp && isLayer3 {
+		ips := make([]net.IP, 0, len(result.IPs))
+		for _, ipc := range result.IPs {
+			ips = append(ips, ipc.Address.IP)
+		}
+		if err := netns.Do(func(_ ns.NetNS) error {
+			return ip.AnnounceIPs(args.IfName, ips)
+		}); err != nil {
+			return err
+		}
+	}
+
 	// In certain circumstances, the host-side of the veth may change addrs
 	hostInterface.Mac = hostVeth.Attrs().HardwareAddr.String()
 
@@ -758,7 +997,14 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 	success = true
 
-	return types.PrintResult(result, cniVersion)
+	// Both ends of the veth are on the bridge port
+	port := &topology.Port{
+		Bridge:  br.Name,
+		IfIndex: hostVeth.Attrs().Index,
+		VLAN:    n.Vlan,
+		Trunk:   n.vlans,
+	}
+	return topology.PrintResult(result, cniVersion, map[int]*topology.Port{1: port, 2: port})
 }
 
 func dnsConfSet(dnsConf types.DNS) bool {
@@ -824,6 +1070,10 @@ func cmdDel(args *skel.CmdArgs) error {
 		}
 	}
 
+	if isLayer3 && n.ProxyArp {
+		teardownProxyNdp(n.gatewayName(), ipnets)
+	}
+
 	if isLayer3 && n.IPMasq {
 		if err := ip.TeardownIPMasqForNetworks(ipnets, n.Name, args.IfName, args.ContainerID); err != nil {
 			return err
@@ -838,8 +1088,8 @@ func main() {
 		Add:    cmdAdd,
 		Check:  cmdCheck,
 		Del:    cmdDel,
+		GC:     cmdGC,
 		Status: cmdStatus,
-		/* FIXME GC */
 	}, version.All, bv.BuildString("bridge"))
 }
 
@@ -1094,14 +1344,132 @@ func cmdCheck(args *skel.CmdArgs) error {
 		if err != nil {
 			return err
 		}
+
+		if n.AsyncDad {
+			return checkDADComplete(args.IfName)
+		}
 		return nil
 	})
 }
 
+// checkDADComplete reports addresses of the interface for which duplicate
+// address detection is still pending or has failed
+func checkDADComplete(ifName string) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_V6)
+	if err != nil {
+		return fmt.Errorf("could not list addresses of %q: %v", ifName, err)
+	}
+	for _, addr := range addrs {
+		if addr.Flags&syscall.IFA_F_DADFAILED != 0 {
+			return fmt.Errorf("address %s on %q failed DAD", addr.IP, ifName)
+		}
+		if addr.Flags&syscall.IFA_F_TENTATIVE != 0 {
+			return fmt.Errorf("DAD still in progress for address %s on %q", addr.IP, ifName)
+		}
+	}
+	return nil
+}
+
 func uniqueID(containerID, cniIface string) string {
 	return containerID + "-" + cniIface
 }
 
+// portOwnerPrefix prefixes the alias of the host-side veths created for
+// an attachment, so that GC can tell which ones are still in use
+const portOwnerPrefix = "cni-bridge:"
+
+// setPortOwner records the attachment owning a bridge port in its alias
+func setPortOwner(hostIfName, containerID, ifName string) error {
+	hostVeth, err := netlinksafe.LinkByName(hostIfName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", hostIfName, err)
+	}
+	if err := netlink.LinkSetAlias(hostVeth, portOwnerPrefix+containerID+"/"+ifName); err != nil {
+		return fmt.Errorf("failed to set alias of %q: %v", hostIfName, err)
+	}
+	return nil
+}
+
+// parsePortOwner returns the attachment recorded in a port alias. Interface
+// names cannot contain '/', so the last one separates the container ID.
+func parsePortOwner(alias string) (types.GCAttachment, bool) {
+	if !strings.HasPrefix(alias, portOwnerPrefix) {
+		return types.GCAttachment{}, false
+	}
+	owner := strings.TrimPrefix(alias, portOwnerPrefix)
+	i := strings.LastIndex(owner, "/")
+	if i <= 0 || i == len(owner)-1 {
+		return types.GCAttachment{}, false
+	}
+	return types.GCAttachment{ContainerID: owner[:i], IfName: owner[i+1:]}, true
+}
+
+// cmdGC removes the host-side veths of the bridge whose attachment is not
+// in the list of valid attachments, e.g. left behind by an interrupted ADD
+// or a netns that was never cleaned up. Ports created by other means carry
+// no owner alias and are left alone. The veth of an attachment whose netns
+// is gone went with it, so the masquerade rules are collected by attachment
+// rather than by port.
+func cmdGC(args *skel.CmdArgs) error {
+	n, _, err := loadNetConf(args.StdinData, args.Args)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[types.GCAttachment]bool, len(n.ValidAttachments))
+	for _, a := range n.ValidAttachments {
+		valid[a] = true
+	}
+
+	var errs []error
+	br, err := bridgeByName(n.BrName)
+	if err == nil {
+		links, err := netlinksafe.LinkList()
+		if err != nil {
+			return fmt.Errorf("failed to list links: %v", err)
+		}
+		for _, l := range links {
+			if _, ok := l.(*netlink.Veth); !ok || l.Attrs().MasterIndex != br.Attrs().Index {
+				continue
+			}
+			owner, ok := parsePortOwner(l.Attrs().Alias)
+			if !ok || valid[owner] {
+				continue
+			}
+			if err := netlink.LinkDel(l); err != nil {
+				if _, ok := err.(netlink.LinkNotFoundError); !ok {
+					errs = append(errs, fmt.Errorf("failed to delete stale port %q: %v", l.Attrs().Name, err))
+					continue
+				}
+			}
+			if n.MacSpoofChk {
+				sc := link.NewSpoofChecker("", "", uniqueID(owner.ContainerID, owner.IfName))
+				if err := sc.Teardown(); err != nil {
+					fmt.Fprintf(os.Stderr, "%v", err)
+				}
+			}
+		}
+	}
+
+	if n.IPAM.Type != "" && n.IPMasq {
+		if err := ip.GCIPMasqForNetwork(n.Name, n.ValidAttachments); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if n.IPAM.Type != "" {
+		if err := ipam.ExecGC(n.IPAM.Type, args.StdinData); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func cmdStatus(args *skel.CmdArgs) error {
 	conf := NetConf{}
 	if err := json.Unmarshal(args.StdinData, &conf); err != nil {
@@ -21,6 +21,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/coreos/go-iptables/iptables"
 	"github.com/networkplumbing/go-nft/nft"
@@ -35,9 +36,12 @@ import (
 	types040 "github.com/containernetworking/cni/pkg/types/040"
 	types100 "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/containernetworking/plugins/pkg/topology"
+	"github.com/containernetworking/plugins/pkg/utils/sysctl"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
 )
 
@@ -84,6 +88,7 @@ type testCase struct {
 	macspoofchk       bool
 	disableContIface  bool
 	portIsolation     bool
+	neighSuppress     bool
 
 	AddErr020 string
 	DelErr020 string
@@ -167,6 +172,9 @@ const (
 	portIsolation = `,
     "portIsolation": true`
 
+	neighSuppress = `,
+    "neighSuppress": true`
+
 	ipamStartStr = `,
     "ipam": {
         "type":    "host-local"`
@@ -275,6 +283,10 @@ func (tc testCase) netConfJSON(dataDir string) string {
 		conf += portIsolation
 	}
 
+	if tc.neighSuppress {
+		conf += neighSuppress
+	}
+
 	if !tc.isLayer2 {
 		conf += netDefault
 		if tc.subnet != "" || tc.ranges != nil {
@@ -583,6 +595,15 @@ func (tester *testerV10x) cmdAddTest(tc testCase, dataDir string) (types.Result,
 		}
 		Expect(result.Interfaces[2].Sandbox).To(Equal(tester.targetNS.Path()))
 
+		// Both ends of the veth report the bridge port
+		hostVeth, err := netlinksafe.LinkByName(result.Interfaces[1].Name)
+		Expect(err).NotTo(HaveOccurred())
+		ports, err := topology.PrevResultPorts([]byte(fmt.Sprintf(`{"prevResult": %s}`, raw)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ports).To(HaveLen(2))
+		Expect(ports[1]).To(Equal(&topology.Port{Bridge: BRNAME, IfIndex: hostVeth.Attrs().Index, VLAN: tc.vlan, Trunk: ports[1].Trunk}))
+		Expect(ports[2]).To(Equal(ports[1]))
+
 		// Make sure bridge link exists
 		link, err := netlinksafe.LinkByName(result.Interfaces[0].Name)
 		Expect(err).NotTo(HaveOccurred())
@@ -661,6 +682,7 @@ func (tester *testerV10x) cmdAddTest(tc testCase, dataDir string) (types.Result,
 		protInfo, err := netlinksafe.LinkGetProtinfo(link)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(protInfo.Isolated).To(Equal(tc.portIsolation), "link isolation should be on when portIsolation is set")
+		Expect(protInfo.NeighSuppress).To(Equal(tc.neighSuppress), "neighbor suppression should be on when neighSuppress is set")
 
 		// check vlan exist on the veth interface
 		if tc.vlan != 0 {
@@ -2672,6 +2694,21 @@ var _ = Describe("bridge Operations", func() {
 				return nil
 			})).To(Succeed())
 		})
+
+		It(fmt.Sprintf("[%s] when neigh-suppress is on, should set the veth peer on node with neighbor suppression on", ver), func() {
+			Expect(originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				tc := testCase{
+					cniVersion:    ver,
+					neighSuppress: true,
+					isLayer2:      true,
+					AddErr020:     "cannot convert: no valid IP addresses",
+					AddErr010:     "cannot convert: no valid IP addresses",
+				}
+				cmdAddDelTest(originalNS, targetNS, tc, dataDir)
+				return nil
+			})).To(Succeed())
+		})
 	}
 
 	It("check vlan id when loading net conf", func() {
@@ -2707,6 +2744,269 @@ var _ = Describe("bridge Operations", func() {
 			}
 		}
 	})
+
+	It("resolves the port MTU from the network and per-attachment config", func() {
+		conf := `{"cniVersion": "1.0.0", "name": "testConfig", "type": "bridge", "mtu": 9000%s}`
+
+		n, _, err := loadNetConf([]byte(fmt.Sprintf(conf, "")), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.portMTU).To(Equal(9000))
+
+		n, _, err = loadNetConf([]byte(fmt.Sprintf(conf, `, "portMTU": 1500`)), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.portMTU).To(Equal(1500))
+
+		n, _, err = loadNetConf([]byte(fmt.Sprintf(conf, `, "portMTU": 1500, "args": {"cni": {"mtu": 8000}}`)), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.portMTU).To(Equal(8000))
+
+		_, _, err = loadNetConf([]byte(fmt.Sprintf(conf, `, "portMTU": -1`)), "")
+		Expect(err).To(MatchError("invalid port MTU -1"))
+	})
+
+	It("resolves how long to wait for DAD", func() {
+		conf := `{"cniVersion": "1.0.0", "name": "testConfig", "type": "bridge"%s}`
+
+		n, _, err := loadNetConf([]byte(fmt.Sprintf(conf, "")), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.dadTimeout()).To(Equal(ipam.DADSettleTimeout))
+
+		n, _, err = loadNetConf([]byte(fmt.Sprintf(conf, `, "dadTimeoutMs": 1500`)), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.dadTimeout()).To(Equal(1500 * time.Millisecond))
+
+		n, _, err = loadNetConf([]byte(fmt.Sprintf(conf, `, "dadTimeoutMs": 1500, "asyncDad": true`)), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.dadTimeout()).To(BeZero())
+
+		_, _, err = loadNetConf([]byte(fmt.Sprintf(conf, `, "dadTimeoutMs": -1`)), "")
+		Expect(err).To(MatchError("invalid dadTimeoutMs -1"))
+	})
+
+	It("sets the transmit queue length of the bridge and veth pair", func() {
+		conf := `{"cniVersion": "1.0.0", "name": "testConfig", "type": "bridge", "bridge": "%s", "txQueueLen": 5000}`
+		n, _, err := loadNetConf([]byte(fmt.Sprintf(conf, BRNAME)), "")
+		Expect(err).NotTo(HaveOccurred())
+
+		var hostIface, contIface *types100.Interface
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			br, _, err := setupBridge(n)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(br.TxQLen).To(Equal(5000))
+
+			hostIface, contIface, err = setupVeth(targetNS, br, IFNAME, 0, n.txQLen(), false, 0, nil, false, "", false, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			link, err := netlinksafe.LinkByName(hostIface.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().TxQLen).To(Equal(5000))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(contIface.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().TxQLen).To(Equal(5000))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = loadNetConf([]byte(`{"cniVersion": "1.0.0", "name": "testConfig", "type": "bridge", "txQueueLen": -1}`), "")
+		Expect(err).To(MatchError("invalid txQueueLen -1"))
+	})
+
+	// withConf adds the keys to the network configuration of args
+	withConf := func(args *skel.CmdArgs, keys map[string]interface{}) *skel.CmdArgs {
+		conf := map[string]interface{}{}
+		Expect(json.Unmarshal(args.StdinData, &conf)).To(Succeed())
+		for k, v := range keys {
+			conf[k] = v
+		}
+		data, err := json.Marshal(conf)
+		Expect(err).NotTo(HaveOccurred())
+		withArgs := *args
+		withArgs.StdinData = data
+		return &withArgs
+	}
+
+	It("holds the gateway address of a VLAN on a subinterface of the bridge", func() {
+		tc := testCase{
+			cniVersion: "1.0.0",
+			vlan:       100,
+			ranges:     []rangeInfo{{subnet: "10.1.2.0/24"}},
+		}
+		args := withConf(tc.createCmdArgs(targetNS, dataDir), map[string]interface{}{"bridgeVlanGateway": true})
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces[0].Name).To(Equal(BRNAME))
+			Expect(result.Interfaces[1].Name).To(Equal(BRNAMEVLAN))
+
+			br, err := netlinksafe.LinkByName(BRNAME)
+			Expect(err).NotTo(HaveOccurred())
+			link, err := netlinksafe.LinkByName(BRNAMEVLAN)
+			Expect(err).NotTo(HaveOccurred())
+			vlanLink, ok := link.(*netlink.Vlan)
+			Expect(ok).To(BeTrue())
+			Expect(vlanLink.VlanId).To(Equal(100))
+			Expect(vlanLink.ParentIndex).To(Equal(br.Attrs().Index))
+			Expect(vlanLink.Flags & net.FlagUp).To(Equal(net.FlagUp))
+
+			addrs, err := netlinksafe.AddrList(vlanLink, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(1))
+			Expect(addrs[0].IPNet.String()).To(Equal("10.1.2.1/24"))
+
+			// The bridge itself accepts the tagged frames of the VLAN
+			vlans, err := netlink.BridgeVlanList()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vlans[int32(br.Attrs().Index)]).To(ContainElement(HaveField("Vid", uint16(100))))
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+
+			// The subinterface is shared by the ports of the VLAN
+			_, err = netlinksafe.LinkByName(BRNAMEVLAN)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("answers ARP and neighbor solicitations for the containers with proxyArp", func() {
+		tc := testCase{
+			cniVersion: "1.0.0",
+			ranges: []rangeInfo{
+				{subnet: "10.1.2.0/24"},
+				{subnet: "2001:db8:1::/64"},
+			},
+		}
+		args := withConf(tc.createCmdArgs(targetNS, dataDir), map[string]interface{}{"isGateway": true, "proxyArp": true})
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.IPs).To(HaveLen(2))
+
+			for _, key := range []string{
+				"net/ipv4/conf/" + BRNAME + "/proxy_arp",
+				"net/ipv4/conf/" + BRNAME + "/proxy_arp_pvlan",
+				"net/ipv6/conf/" + BRNAME + "/proxy_ndp",
+			} {
+				value, err := sysctl.Sysctl(key)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(value).To(Equal("1"), key)
+			}
+
+			proxies := func() []net.IP {
+				br, err := netlinksafe.LinkByName(BRNAME)
+				Expect(err).NotTo(HaveOccurred())
+				neighs, err := netlinksafe.NeighProxyList(br.Attrs().Index, netlink.FAMILY_V6)
+				Expect(err).NotTo(HaveOccurred())
+				var ips []net.IP
+				for _, n := range neighs {
+					ips = append(ips, n.IP)
+				}
+				return ips
+			}
+			var ipv6 net.IP
+			for _, ipc := range result.IPs {
+				if ipc.Address.IP.To4() == nil {
+					ipv6 = ipc.Address.IP
+				}
+			}
+			Expect(proxies()).To(ContainElement(ipv6))
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+			Expect(proxies()).NotTo(ContainElement(ipv6))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("collects the ports and masquerade rules of stale attachments with GC", func() {
+		tc := testCase{
+			cniVersion:    "1.1.0",
+			ranges:        []rangeInfo{{subnet: "10.1.2.0/24"}},
+			ipMasq:        true,
+			ipMasqBackend: "nftables",
+		}
+		args := tc.createCmdArgs(targetNS, dataDir)
+		gcArgs := func(valid ...types.GCAttachment) *skel.CmdArgs {
+			return withConf(args, map[string]interface{}{"cni.dev/valid-attachments": valid})
+		}
+		masqRules := func() int {
+			nft, err := knftables.New(knftables.InetFamily, "cni_plugins_masquerade")
+			Expect(err).NotTo(HaveOccurred())
+			rules, err := nft.ListRules(context.TODO(), "masq_checks")
+			Expect(err).NotTo(HaveOccurred())
+			count := 0
+			for _, r := range rules {
+				if r.Comment != nil {
+					count++
+				}
+			}
+			return count
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(masqRules()).To(Equal(1))
+
+			// A valid attachment is left alone
+			Expect(cmdGC(gcArgs(types.GCAttachment{ContainerID: args.ContainerID, IfName: args.IfName}))).To(Succeed())
+			Expect(masqRules()).To(Equal(1))
+
+			// The veth went with the netns of the attachment, but the
+			// masquerade rules are still collected
+			Expect(targetNS.Do(func(ns.NetNS) error {
+				_, err := ip.DelLinkByNameAddr(IFNAME)
+				return err
+			})).To(Succeed())
+			Expect(cmdGC(gcArgs())).To(Succeed())
+			Expect(masqRules()).To(Equal(0))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("parses the attachment owning a bridge port", func() {
+		owner, ok := parsePortOwner(portOwnerPrefix + "dummy-ctr/eth0")
+		Expect(ok).To(BeTrue())
+		Expect(owner.ContainerID).To(Equal("dummy-ctr"))
+		Expect(owner.IfName).To(Equal("eth0"))
+
+		for _, alias := range []string{"", "some port", portOwnerPrefix + "dummy-ctr", portOwnerPrefix + "/eth0", portOwnerPrefix + "dummy-ctr/"} {
+			_, ok = parsePortOwner(alias)
+			Expect(ok).To(BeFalse(), alias)
+		}
+	})
 })
 
 func assertMacSpoofCheckRulesExist() {
@@ -33,20 +33,117 @@ import (
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 )
 
-func parseNetConf(bytes []byte) (*types.NetConf, error) {
-	conf := &types.NetConf{}
+type NetConf struct {
+	types.NetConf
+	// Mac is the address of the dummy, random when empty
+	Mac string `json:"mac,omitempty"`
+	// Routes go through the dummy as configured, without the gateway the
+	// IPAM routes get
+	Routes []Route `json:"routes,omitempty"`
+
+	RuntimeConfig struct {
+		Mac string `json:"mac,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+
+	mac    net.HardwareAddr
+	routes []*netlink.Route
+}
+
+// Route is a route through the dummy, such as the route of an anycast
+// prefix the dummy anchors
+type Route struct {
+	Dst string `json:"dst"`
+	GW  string `json:"gw,omitempty"`
+	// Scope is "global", "link" or "host"; link without gateway and
+	// global with one by default
+	Scope  string `json:"scope,omitempty"`
+	Metric int    `json:"metric,omitempty"`
+}
+
+// MacEnvArgs represents CNI_ARGS
+type MacEnvArgs struct {
+	types.CommonArgs
+	MAC types.UnmarshallableString `json:"mac,omitempty"`
+}
+
+var routeScopes = map[string]netlink.Scope{
+	"global": netlink.SCOPE_UNIVERSE,
+	"link":   netlink.SCOPE_LINK,
+	"host":   netlink.SCOPE_HOST,
+}
+
+func (r *Route) parse() (*netlink.Route, error) {
+	_, dst, err := net.ParseCIDR(r.Dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route dst %q: %v", r.Dst, err)
+	}
+	route := &netlink.Route{Dst: dst, Priority: r.Metric, Scope: netlink.SCOPE_LINK}
+	if r.GW != "" {
+		route.Gw = net.ParseIP(r.GW)
+		if route.Gw == nil {
+			return nil, fmt.Errorf("invalid route gw %q", r.GW)
+		}
+		if (route.Gw.To4() == nil) != (dst.IP.To4() == nil) {
+			return nil, fmt.Errorf("route gw %s is not of the family of %s", r.GW, r.Dst)
+		}
+		route.Scope = netlink.SCOPE_UNIVERSE
+	}
+	if r.Scope != "" {
+		scope, ok := routeScopes[r.Scope]
+		if !ok {
+			return nil, fmt.Errorf("invalid route scope %q, must be global, link or host", r.Scope)
+		}
+		route.Scope = scope
+	}
+	if r.Metric < 0 {
+		return nil, fmt.Errorf("invalid route metric %d", r.Metric)
+	}
+	return route, nil
+}
+
+func parseNetConf(bytes []byte, envArgs string) (*NetConf, error) {
+	conf := &NetConf{}
 	if err := json.Unmarshal(bytes, conf); err != nil {
 		return nil, fmt.Errorf("failed to parse network config: %v", err)
 	}
+
+	if envArgs != "" {
+		e := MacEnvArgs{}
+		if err := types.LoadArgs(envArgs, &e); err != nil {
+			return nil, err
+		}
+		if e.MAC != "" {
+			conf.Mac = string(e.MAC)
+		}
+	}
+	if conf.RuntimeConfig.Mac != "" {
+		conf.Mac = conf.RuntimeConfig.Mac
+	}
+	if conf.Mac != "" {
+		mac, err := net.ParseMAC(conf.Mac)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mac %q: %v", conf.Mac, err)
+		}
+		conf.mac = mac
+	}
+
+	for i := range conf.Routes {
+		route, err := conf.Routes[i].parse()
+		if err != nil {
+			return nil, err
+		}
+		conf.routes = append(conf.routes, route)
+	}
 	return conf, nil
 }
 
-func createDummy(ifName string, netns ns.NetNS) (*current.Interface, error) {
+func createDummy(ifName string, mac net.HardwareAddr, netns ns.NetNS) (*current.Interface, error) {
 	dummy := &current.Interface{}
 
 	err := netns.Do(func(_ ns.NetNS) error {
 		linkAttrs := netlink.NewLinkAttrs()
 		linkAttrs.Name = ifName
+		linkAttrs.HardwareAddr = mac
 
 		dm := &netlink.Dummy{
 			LinkAttrs: linkAttrs,
@@ -75,8 +172,35 @@ func createDummy(ifName string, netns ns.NetNS) (*current.Interface, error) {
 	return dummy, nil
 }
 
+// addRoutes adds the configured routes through the dummy, once it is up,
+// and reports them in the result
+func addRoutes(ifName string, conf *NetConf, result *current.Result) error {
+	if len(conf.routes) == 0 {
+		return nil
+	}
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	for _, r := range conf.routes {
+		route := *r
+		route.LinkIndex = link.Attrs().Index
+		if err := netlink.RouteAdd(&route); err != nil {
+			return fmt.Errorf("failed to add route %v via %v dev %v metric %d (Scope: %v): %v", route.Dst, route.Gw, ifName, route.Priority, route.Scope, err)
+		}
+		scope := int(route.Scope)
+		result.Routes = append(result.Routes, &types.Route{
+			Dst:      *route.Dst,
+			GW:       route.Gw,
+			Priority: route.Priority,
+			Scope:    &scope,
+		})
+	}
+	return nil
+}
+
 func cmdAdd(args *skel.CmdArgs) error {
-	conf, err := parseNetConf(args.StdinData)
+	conf, err := parseNetConf(args.StdinData, args.Args)
 	if err != nil {
 		return err
 	}
@@ -91,7 +215,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	defer netns.Close()
 
-	dummyInterface, err := createDummy(args.IfName, netns)
+	dummyInterface, err := createDummy(args.IfName, conf.mac, netns)
 	if err != nil {
 		return err
 	}
@@ -135,7 +259,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 	result.Interfaces = []*current.Interface{dummyInterface}
 
 	err = netns.Do(func(_ ns.NetNS) error {
-		return ipam.ConfigureIface(args.IfName, result)
+		if err := ipam.ConfigureIface(args.IfName, result); err != nil {
+			return err
+		}
+		return addRoutes(args.IfName, conf, result)
 	})
 	if err != nil {
 		return err
@@ -145,7 +272,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 }
 
 func cmdDel(args *skel.CmdArgs) error {
-	conf, err := parseNetConf(args.StdinData)
+	conf, err := parseNetConf(args.StdinData, args.Args)
 	if err != nil {
 		return err
 	}
@@ -190,7 +317,7 @@ func main() {
 }
 
 func cmdCheck(args *skel.CmdArgs) error {
-	conf, err := parseNetConf(args.StdinData)
+	conf, err := parseNetConf(args.StdinData, args.Args)
 	if err != nil {
 		return err
 	}
@@ -215,7 +342,7 @@ func cmdCheck(args *skel.CmdArgs) error {
 		return fmt.Errorf("dummy: Required prevResult missing")
 	}
 
-	if err := version.ParsePrevResult(conf); err != nil {
+	if err := version.ParsePrevResult(&conf.NetConf); err != nil {
 		return err
 	}
 
@@ -255,7 +382,8 @@ func cmdCheck(args *skel.CmdArgs) error {
 		if err != nil {
 			return err
 		}
-		return nil
+
+		return ip.ValidateExpectedRoute(result.Routes)
 	}); err != nil {
 		return err
 	}
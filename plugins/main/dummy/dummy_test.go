@@ -215,7 +215,7 @@ var _ = Describe("dummy Operations", func() {
 			err := originalNS.Do(func(ns.NetNS) error {
 				defer GinkgoRecover()
 
-				_, err := createDummy("foobar0", targetNS)
+				_, err := createDummy("foobar0", nil, targetNS)
 				Expect(err).NotTo(HaveOccurred())
 				return nil
 			})
@@ -246,7 +246,7 @@ var _ = Describe("dummy Operations", func() {
 				err := netlink.LinkAdd(dm)
 				Expect(err).NotTo(HaveOccurred())
 
-				_, err = createDummy(ifName, targetNS)
+				_, err = createDummy(ifName, nil, targetNS)
 				Expect(err).NotTo(HaveOccurred())
 				return nil
 			})
@@ -411,3 +411,150 @@ var _ = Describe("dummy Operations", func() {
 		})
 	}
 })
+
+var _ = Describe("dummy anchor", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "dummy_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("parses the MAC and the routes", func() {
+		conf, err := parseNetConf([]byte(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "dummy",
+			"mac": "02:00:00:00:00:01",
+			"routes": [
+				{"dst": "192.0.2.0/24"},
+				{"dst": "198.51.100.0/24", "gw": "10.1.2.1", "metric": 100},
+				{"dst": "2001:db8:f::/48", "scope": "host"}
+			],
+			"runtimeConfig": {"mac": "02:00:00:00:00:02"}
+		}`), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conf.mac.String()).To(Equal("02:00:00:00:00:02"))
+		Expect(conf.routes).To(HaveLen(3))
+		Expect(conf.routes[0].Scope).To(Equal(netlink.SCOPE_LINK))
+		Expect(conf.routes[1].Scope).To(Equal(netlink.SCOPE_UNIVERSE))
+		Expect(conf.routes[1].Priority).To(Equal(100))
+		Expect(conf.routes[2].Scope).To(Equal(netlink.SCOPE_HOST))
+
+		for _, routes := range []string{
+			`[{"dst": "192.0.2.1"}]`,
+			`[{"dst": "192.0.2.0/24", "gw": "2001:db8::1"}]`,
+			`[{"dst": "192.0.2.0/24", "scope": "site"}]`,
+			`[{"dst": "192.0.2.0/24", "metric": -1}]`,
+		} {
+			_, err := parseNetConf([]byte(fmt.Sprintf(`{"name": "mynet", "type": "dummy", "routes": %s}`, routes)), "")
+			Expect(err).To(HaveOccurred(), routes)
+		}
+
+		_, err = parseNetConf([]byte(`{"name": "mynet", "type": "dummy"}`), "MAC=02:00:00:00:00")
+		Expect(err).To(MatchError(ContainSubstring(`invalid mac "02:00:00:00:00"`)))
+	})
+
+	It("anchors addresses of several ranges and routes with ADD/CHECK/DEL", func() {
+		const IFNAME = "anchor0"
+
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "dummyAnchor",
+			"type": "dummy",
+			"mac": "02:00:00:00:00:01",
+			"routes": [
+				{"dst": "192.0.2.0/24", "metric": 50},
+				{"dst": "2001:db8:f::/48"}
+			],
+			"ipam": {
+				"type": "host-local",
+				"dataDir": "%s",
+				"ranges": [
+					[{"subnet": "10.1.2.0/24"}],
+					[{"subnet": "10.1.3.0/24"}],
+					[{"subnet": "2001:db8:1::/64"}]
+				]
+			}
+		}`, dataDir)
+		args := &skel.CmdArgs{
+			ContainerID: "contAnchor",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Interfaces[0].Mac).To(Equal("02:00:00:00:00:01"))
+		Expect(result.IPs).To(HaveLen(3))
+		Expect(result.Routes).To(HaveLen(2))
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			addrs, err := netlinksafe.AddrList(link, syscall.AF_INET)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(2))
+
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{
+				Dst: &net.IPNet{IP: net.IPv4(192, 0, 2, 0).To4(), Mask: net.CIDRMask(24, 32)},
+			}, netlink.RT_FILTER_DST)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].LinkIndex).To(Equal(link.Attrs().Index))
+			Expect(routes[0].Gw).To(BeNil())
+			Expect(routes[0].Scope).To(Equal(netlink.SCOPE_LINK))
+			Expect(routes[0].Priority).To(Equal(50))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		checkConf := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(conf), &checkConf)).To(Succeed())
+		checkConf["prevResult"] = result
+		checkArgs := *args
+		checkArgs.StdinData, err = json.Marshal(checkConf)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdCheckWithArgs(&checkArgs, func() error {
+				return cmdCheck(&checkArgs)
+			})).To(Succeed())
+
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
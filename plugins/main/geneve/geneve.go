@@ -0,0 +1,462 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating a Geneve device in the container, terminating a
+// tunnel whose endpoint is the host.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	// defaultDstPort is the IANA assigned Geneve port
+	defaultDstPort = 6081
+	maxVNI         = 1<<24 - 1
+
+	// The encapsulation overhead without options: outer Ethernet, IP, UDP
+	// and Geneve headers
+	overheadIPv4 = 50
+	overheadIPv6 = 70
+
+	dfUnset   = "unset"
+	dfSet     = "set"
+	dfInherit = "inherit"
+)
+
+type NetConf struct {
+	types.NetConf
+	// VNI is the Geneve virtual network identifier
+	VNI int `json:"vni"`
+	// Remote is the unicast address of the remote endpoint
+	Remote string `json:"remote"`
+	// DstPort is the UDP port of the remote endpoint, 6081 by default
+	DstPort int `json:"dstPort,omitempty"`
+	// MTU defaults to the MTU of the device of the route to the remote
+	// minus the overhead
+	MTU int `json:"mtu,omitempty"`
+	TTL int `json:"ttl,omitempty"`
+	// DF is the Don't Fragment bit of the encapsulated IPv4 packets, "unset"
+	// (default), "set" or "inherit" from the inner packets
+	DF string `json:"df,omitempty"`
+
+	remote net.IP
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	if n.VNI <= 0 || n.VNI > maxVNI {
+		return nil, fmt.Errorf("invalid VNI %d, must be [1, %d]", n.VNI, maxVNI)
+	}
+	if n.Remote == "" {
+		return nil, fmt.Errorf(`"remote" field is required. It specifies the address of the remote endpoint`)
+	}
+	n.remote = net.ParseIP(n.Remote)
+	if n.remote == nil {
+		return nil, fmt.Errorf("invalid remote address %q", n.Remote)
+	}
+	if n.remote.IsMulticast() {
+		return nil, fmt.Errorf("remote %s must be a unicast address", n.remote)
+	}
+	if n.DstPort == 0 {
+		n.DstPort = defaultDstPort
+	}
+	if n.DstPort < 0 || n.DstPort > 65535 {
+		return nil, fmt.Errorf("invalid dstPort %d", n.DstPort)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	if n.TTL < 0 || n.TTL > 255 {
+		return nil, fmt.Errorf("invalid TTL %d, must be [0, 255]", n.TTL)
+	}
+	switch n.DF {
+	case "":
+		n.DF = dfUnset
+	case dfUnset, dfSet, dfInherit:
+	default:
+		return nil, fmt.Errorf("invalid df %q, must be %s, %s or %s", n.DF, dfUnset, dfSet, dfInherit)
+	}
+	if n.DF != dfUnset && n.remote.To4() == nil {
+		return nil, fmt.Errorf("df only applies to an IPv4 remote")
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the device. Without
+// IPAM the plugin only provides L2 connectivity.
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+func (n *NetConf) df() netlink.GeneveDf {
+	switch n.DF {
+	case dfSet:
+		return netlink.GENEVE_DF_SET
+	case dfInherit:
+		return netlink.GENEVE_DF_INHERIT
+	}
+	return netlink.GENEVE_DF_UNSET
+}
+
+// mtu returns the MTU of the device, which fits in the one of the device of
+// the route to the remote. Geneve devices are not bound to an underlay
+// device, so the MTU is left to the kernel when there is no route.
+func (n *NetConf) mtu() (int, error) {
+	routes, err := netlink.RouteGet(n.remote)
+	if err != nil || len(routes) == 0 || routes[0].LinkIndex == 0 {
+		return n.MTU, nil
+	}
+	underlay, err := netlink.LinkByIndex(routes[0].LinkIndex)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lookup the device of the route to %s: %v", n.remote, err)
+	}
+
+	overhead := overheadIPv4
+	if n.remote.To4() == nil {
+		overhead = overheadIPv6
+	}
+	maxMTU := underlay.Attrs().MTU - overhead
+	if n.MTU > maxMTU {
+		return 0, fmt.Errorf("invalid MTU %d, must be [0, %s MTU(%d) - %d]", n.MTU, underlay.Attrs().Name, underlay.Attrs().MTU, overhead)
+	}
+	if n.MTU == 0 {
+		return maxMTU, nil
+	}
+	return n.MTU, nil
+}
+
+func createGeneve(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	geneve := &current.Interface{}
+
+	mtu, err := conf.mtu()
+	if err != nil {
+		return nil, err
+	}
+
+	// due to kernel bug we have to create with tmpname or it might
+	// collide with the name on the host and error out
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.MTU = mtu
+	linkAttrs.Name = tmpName
+	linkAttrs.Namespace = netlink.NsFd(int(netns.Fd()))
+
+	g := &netlink.Geneve{
+		LinkAttrs: linkAttrs,
+		ID:        uint32(conf.VNI),
+		Remote:    conf.remote,
+		Ttl:       uint8(conf.TTL),
+		Dport:     uint16(conf.DstPort),
+		Df:        conf.df(),
+	}
+
+	// The device is created in the host namespace, where its socket stays,
+	// and moved to the container in the same request
+	if err := netlink.LinkAdd(g); err != nil {
+		if errors.Is(err, unix.EEXIST) {
+			return nil, fmt.Errorf("failed to create geneve: VNI %d to %s is already in use on port %d: %v", conf.VNI, conf.remote, conf.DstPort, err)
+		}
+		return nil, fmt.Errorf("failed to create geneve: %v", err)
+	}
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		err := ip.RenameLink(tmpName, ifName)
+		if err != nil {
+			_ = ip.DelLinkByName(tmpName)
+			return fmt.Errorf("failed to rename geneve to %q: %v", ifName, err)
+		}
+		geneve.Name = ifName
+
+		// Re-fetch interface to get all properties/attributes
+		contGeneve, err := netlinksafe.LinkByName(geneve.Name)
+		if err != nil {
+			return fmt.Errorf("failed to refetch geneve %q: %v", geneve.Name, err)
+		}
+		geneve.Mac = contGeneve.Attrs().HardwareAddr.String()
+		geneve.Sandbox = netns.Path()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return geneve, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	geneveInterface, err := createGeneve(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{geneveInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the geneve interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("geneve: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+// validateCniContainerInterface checks the device against the
+// configuration. The kernel does not report the DF setting.
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("geneve: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	geneve, isGeneve := link.(*netlink.Geneve)
+	if !isGeneve {
+		return fmt.Errorf("geneve: Container interface %s not of type geneve", intf.Name)
+	}
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("geneve: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	if int(geneve.ID) != n.VNI {
+		return fmt.Errorf("geneve: Interface %s VNI %d doesn't match configured VNI %d", intf.Name, geneve.ID, n.VNI)
+	}
+	if int(geneve.Dport) != n.DstPort {
+		return fmt.Errorf("geneve: Interface %s port %d doesn't match configured port %d", intf.Name, geneve.Dport, n.DstPort)
+	}
+	if !n.remote.Equal(geneve.Remote) {
+		return fmt.Errorf("geneve: Interface %s remote %s doesn't match configured remote %s", intf.Name, geneve.Remote, n.remote)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("geneve: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("geneve"))
+}
@@ -0,0 +1,307 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	UNDERLAY_NAME = "eth0"
+	IFNAME        = "gnv0"
+)
+
+var _ = Describe("geneve configuration", func() {
+	It("applies the defaults", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "geneve", "vni": 42, "remote": "10.0.0.2"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.DstPort).To(Equal(defaultDstPort))
+		Expect(n.df()).To(Equal(netlink.GENEVE_DF_UNSET))
+		Expect(n.hasIPAM()).To(BeFalse())
+	})
+
+	It("parses the DF setting", func() {
+		n, err := loadConf([]byte(`{"vni": 42, "remote": "10.0.0.2", "df": "inherit"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.df()).To(Equal(netlink.GENEVE_DF_INHERIT))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("without VNI", `{"remote": "10.0.0.2"}`, "invalid VNI 0"),
+		Entry("with a VNI too large", `{"vni": 16777216, "remote": "10.0.0.2"}`, "invalid VNI 16777216"),
+		Entry("without remote", `{"vni": 1}`, `"remote" field is required`),
+		Entry("with an invalid remote", `{"vni": 1, "remote": "foo"}`, `invalid remote address "foo"`),
+		Entry("with a multicast remote", `{"vni": 1, "remote": "239.1.1.1"}`, "must be a unicast address"),
+		Entry("with an invalid port", `{"vni": 1, "remote": "10.0.0.2", "dstPort": 70000}`, "invalid dstPort 70000"),
+		Entry("with an invalid df", `{"vni": 1, "remote": "10.0.0.2", "df": "maybe"}`, `invalid df "maybe"`),
+		Entry("with df and an IPv6 remote", `{"vni": 1, "remote": "2001:db8::2", "df": "set"}`, "df only applies to an IPv4 remote"),
+	)
+})
+
+var _ = Describe("geneve Operations", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir, err = os.MkdirTemp("", "geneve_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			// The underlay is a veth towards the remote endpoints
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = UNDERLAY_NAME
+			linkAttrs.MTU = 9000
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: linkAttrs,
+				PeerName:  "peer0",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(UNDERLAY_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			addr, err := netlink.ParseAddr("10.0.0.1/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("creates a geneve link fitting in the device of the route to the remote", func() {
+		conf, err := loadConf([]byte(`{"vni": 42, "remote": "10.0.0.2", "ttl": 64}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			iface, err := createGeneve(conf, IFNAME, targetNS)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(iface.Name).To(Equal(IFNAME))
+			Expect(iface.Sandbox).To(Equal(targetNS.Path()))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			geneve, ok := link.(*netlink.Geneve)
+			Expect(ok).To(BeTrue())
+			Expect(geneve.ID).To(BeEquivalentTo(42))
+			Expect(geneve.Dport).To(BeEquivalentTo(defaultDstPort))
+			Expect(geneve.Remote.Equal(net.ParseIP("10.0.0.2"))).To(BeTrue())
+			Expect(geneve.Ttl).To(BeEquivalentTo(64))
+			Expect(link.Attrs().MTU).To(Equal(9000 - overheadIPv4))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects an MTU larger than the underlay allows", func() {
+		conf, err := loadConf([]byte(`{"vni": 42, "remote": "10.0.0.2", "mtu": 9000}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			_, err := createGeneve(conf, IFNAME, targetNS)
+			return err
+		})
+		Expect(err).To(MatchError("invalid MTU 9000, must be [0, eth0 MTU(9000) - 50]"))
+	})
+
+	for _, ver := range testutils.AllSpecVersions {
+		// Redefine ver inside for scope so real value is picked up by each dynamically defined It()
+		// See Gingkgo's "Patterns for dynamically generating tests" documentation.
+		ver := ver
+
+		It(fmt.Sprintf("[%s] configures and deconfigures a geneve link with ADD/CHECK/DEL", ver), func() {
+			conf := fmt.Sprintf(`{
+				"cniVersion": "%s",
+				"name": "geneveTest",
+				"type": "geneve",
+				"vni": 100,
+				"remote": "10.0.0.2",
+				"df": "set",
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.1.2.0/24",
+					"dataDir": "%s"
+				}
+			}`, ver, dataDir)
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       targetNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   []byte(conf),
+			}
+
+			var result types.Result
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				var err error
+				if testutils.SpecVersionHasSTATUS(ver) {
+					err = testutils.CmdStatus(func() error {
+						return cmdStatus(args)
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				result, _, err = testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+				addrs, err := netlinksafe.AddrList(link, unix.AF_INET)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(addrs).To(HaveLen(1))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// CHECK against the result converted to the current version
+			r, err := types100.GetResult(result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.IPs).To(HaveLen(1))
+			confMap := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+			prevResult, err := r.GetAsVersion(ver)
+			Expect(err).NotTo(HaveOccurred())
+			confMap["prevResult"] = prevResult
+			args.StdinData, err = json.Marshal(confMap)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+			})
+			if testutils.SpecVersionHasCHECK(ver) {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError("config version does not allow CHECK"))
+			}
+
+			args.StdinData = []byte(conf)
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				_, err := netlinksafe.LinkByName(IFNAME)
+				return err
+			})
+			Expect(err).To(HaveOccurred())
+
+			// DEL can be called multiple times
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	}
+
+	It("provides an L2 attachment without ipam", func() {
+		conf := `{
+			"cniVersion": "1.0.0",
+			"name": "geneveTest",
+			"type": "geneve",
+			"vni": 100,
+			"remote": "10.0.0.2"
+		}`
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			result, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			r, err := types100.GetResult(result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Interfaces).To(HaveLen(1))
+			Expect(r.IPs).To(BeEmpty())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+			_, ok := link.(*netlink.Geneve)
+			Expect(ok).To(BeTrue())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
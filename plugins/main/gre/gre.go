@@ -0,0 +1,445 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating a GRE or GRETAP tunnel in the container, whose
+// endpoint is the host.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	// modeGRE tunnels IP packets, modeGRETAP Ethernet frames
+	modeGRE    = "gre"
+	modeGRETAP = "gretap"
+)
+
+type NetConf struct {
+	types.NetConf
+	// Mode is "gre" (default) or "gretap"
+	Mode string `json:"mode,omitempty"`
+	// Remote is the address of the remote endpoint, Local the source
+	// address of the encapsulated packets
+	Remote string `json:"remote"`
+	Local  string `json:"local,omitempty"`
+	// Key identifies the tunnel between the endpoints, none by default
+	Key uint32 `json:"key,omitempty"`
+	TTL int    `json:"ttl,omitempty"`
+	// MTU defaults to the MTU of the device of the route to the remote
+	// minus the overhead, computed by the kernel
+	MTU int `json:"mtu,omitempty"`
+
+	remote, local net.IP
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	switch n.Mode {
+	case "":
+		n.Mode = modeGRE
+	case modeGRE, modeGRETAP:
+	default:
+		return nil, fmt.Errorf("invalid mode %q, must be %s or %s", n.Mode, modeGRE, modeGRETAP)
+	}
+	if n.Remote == "" {
+		return nil, fmt.Errorf(`"remote" field is required. It specifies the address of the remote endpoint`)
+	}
+	n.remote = net.ParseIP(n.Remote)
+	if n.remote == nil {
+		return nil, fmt.Errorf("invalid remote address %q", n.Remote)
+	}
+	if n.remote.IsMulticast() || n.remote.IsUnspecified() {
+		return nil, fmt.Errorf("remote %s must be a unicast address", n.remote)
+	}
+	if n.Local != "" {
+		n.local = net.ParseIP(n.Local)
+		if n.local == nil {
+			return nil, fmt.Errorf("invalid local address %q", n.Local)
+		}
+		if (n.local.To4() == nil) != (n.remote.To4() == nil) {
+			return nil, fmt.Errorf("the remote and local addresses must be of the same family")
+		}
+	} else if n.remote.To4() != nil {
+		// The family of the tunnel is the one of the local address
+		n.local = net.IPv4zero
+	} else {
+		n.local = net.IPv6zero
+	}
+	if n.TTL < 0 || n.TTL > 255 {
+		return nil, fmt.Errorf("invalid TTL %d, must be [0, 255]", n.TTL)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the device
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// link returns the tunnel device to create
+func (n *NetConf) link(linkAttrs netlink.LinkAttrs) netlink.Link {
+	// Path MTU discovery is on by default, as with iproute2
+	if n.Mode == modeGRETAP {
+		return &netlink.Gretap{
+			LinkAttrs: linkAttrs,
+			Local:     n.local,
+			Remote:    n.remote,
+			IKey:      n.Key,
+			OKey:      n.Key,
+			Ttl:       uint8(n.TTL),
+			PMtuDisc:  1,
+		}
+	}
+	return &netlink.Gretun{
+		LinkAttrs: linkAttrs,
+		Local:     n.local,
+		Remote:    n.remote,
+		IKey:      n.Key,
+		OKey:      n.Key,
+		Ttl:       uint8(n.TTL),
+		PMtuDisc:  1,
+	}
+}
+
+func createGre(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	gre := &current.Interface{}
+
+	// due to kernel bug we have to create with tmpname or it might
+	// collide with the name on the host and error out
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.MTU = conf.MTU
+	linkAttrs.Name = tmpName
+	linkAttrs.Namespace = netlink.NsFd(int(netns.Fd()))
+
+	// The device is created in the host namespace, where the encapsulated
+	// packets are routed, and moved to the container in the same request
+	if err := netlink.LinkAdd(conf.link(linkAttrs)); err != nil {
+		if errors.Is(err, unix.EEXIST) {
+			return nil, fmt.Errorf("failed to create %s: a tunnel from %s to %s with key %d already exists: %v", conf.Mode, conf.local, conf.remote, conf.Key, err)
+		}
+		return nil, fmt.Errorf("failed to create %s: %v", conf.Mode, err)
+	}
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		err := ip.RenameLink(tmpName, ifName)
+		if err != nil {
+			_ = ip.DelLinkByName(tmpName)
+			return fmt.Errorf("failed to rename %s to %q: %v", conf.Mode, ifName, err)
+		}
+		gre.Name = ifName
+
+		// Re-fetch interface to get all properties/attributes
+		contGre, err := netlinksafe.LinkByName(gre.Name)
+		if err != nil {
+			return fmt.Errorf("failed to refetch %s %q: %v", conf.Mode, gre.Name, err)
+		}
+		// The hardware address of a GRE device is its local address
+		if conf.Mode == modeGRETAP {
+			gre.Mac = contGre.Attrs().HardwareAddr.String()
+		}
+		gre.Sandbox = netns.Path()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gre, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	greInterface, err := createGre(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{greInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the tunnel interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("gre: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("gre: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	var local, remote net.IP
+	var key uint32
+	var ttl uint8
+	switch l := link.(type) {
+	case *netlink.Gretun:
+		if n.Mode != modeGRE {
+			return fmt.Errorf("gre: Container interface %s not of type %s", intf.Name, n.Mode)
+		}
+		local, remote, key, ttl = l.Local, l.Remote, l.OKey, l.Ttl
+	case *netlink.Gretap:
+		if n.Mode != modeGRETAP {
+			return fmt.Errorf("gre: Container interface %s not of type %s", intf.Name, n.Mode)
+		}
+		local, remote, key, ttl = l.Local, l.Remote, l.OKey, l.Ttl
+	default:
+		return fmt.Errorf("gre: Container interface %s not of type %s", intf.Name, n.Mode)
+	}
+
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("gre: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	if !remote.Equal(n.remote) {
+		return fmt.Errorf("gre: Interface %s remote %s doesn't match configured remote %s", intf.Name, remote, n.remote)
+	}
+	if !n.local.IsUnspecified() && !local.Equal(n.local) {
+		return fmt.Errorf("gre: Interface %s local %s doesn't match configured local %s", intf.Name, local, n.local)
+	}
+	if key != n.Key {
+		return fmt.Errorf("gre: Interface %s key %d doesn't match configured key %d", intf.Name, key, n.Key)
+	}
+	if int(ttl) != n.TTL {
+		return fmt.Errorf("gre: Interface %s TTL %d doesn't match configured TTL %d", intf.Name, ttl, n.TTL)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("gre: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("gre"))
+}
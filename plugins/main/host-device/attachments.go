@@ -0,0 +1,211 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// attachment records the namespace an ADD moved devices to, so that GC
+// can return them to the host once the runtime lost track of the container
+type attachment struct {
+	Network     string        `json:"network"`
+	ContainerID string        `json:"containerID"`
+	IfName      string        `json:"ifName"`
+	Netns       string        `json:"netns"`
+	Devices     []movedDevice `json:"devices,omitempty"`
+}
+
+// movedDevice is a device moved to the container, under IfName
+type movedDevice struct {
+	IfName string `json:"ifName"`
+	Device string `json:"device"`
+}
+
+// attachmentsGroup is the group of the attachments in the attachment store
+const attachmentsGroup = "attachments"
+
+// saveAttachment records the interfaces moved to the container with the
+// names they had on the host, kept in their alias by moveLinkIn
+func saveAttachment(cfg *NetConf, containerNs ns.NetNS, containerID, ifName string, interfaces []*current.Interface) error {
+	a := &attachment{
+		Network:     cfg.Name,
+		ContainerID: containerID,
+		IfName:      ifName,
+		Netns:       containerNs.Path(),
+	}
+	err := containerNs.Do(func(_ ns.NetNS) error {
+		for _, intf := range interfaces {
+			link, err := netlinksafe.LinkByName(intf.Name)
+			if err != nil {
+				if _, ok := err.(netlink.LinkNotFoundError); ok {
+					// Not a network interface, e.g. a vhost-vdpa device
+					continue
+				}
+				return fmt.Errorf("failed to lookup %q: %v", intf.Name, err)
+			}
+			if link.Attrs().Alias == "" {
+				continue
+			}
+			a.Devices = append(a.Devices, movedDevice{IfName: intf.Name, Device: link.Attrs().Alias})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := putRecord(cfg.DataDir, attachmentsGroup, containerID, ifName, a); err != nil {
+		return fmt.Errorf("failed to record attachment %s/%s: %v", containerID, ifName, err)
+	}
+	return nil
+}
+
+func removeAttachment(dataDir, containerID, ifName string) error {
+	return removeRecord(dataDir, attachmentsGroup, containerID, ifName)
+}
+
+// listAttachments returns the attachments recorded for the network
+func listAttachments(dataDir, network string) ([]*attachment, error) {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	ids, err := store.Refs(attachmentsGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %v", err)
+	}
+	var list []*attachment
+	for _, id := range ids {
+		a := &attachment{}
+		if _, err := store.GetJSON(attachmentsGroup, id, a); err != nil {
+			return nil, fmt.Errorf("failed to read attachment record %q: %v", id, err)
+		}
+		if a.Network == network {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+// releaseAttachment returns the devices of a stale attachment to the host
+// and restores what the ADD changed, like DEL without a configuration to
+// select the devices again
+func releaseAttachment(cfg *NetConf, a *attachment) error {
+	if err := restoreDriver(cfg.DataDir, a.ContainerID, a.IfName); err != nil {
+		return err
+	}
+
+	if len(a.Devices) > 0 {
+		containerNs, err := ns.GetNS(a.Netns)
+		if err == nil {
+			defer containerNs.Close()
+		}
+		var errs []error
+		for _, d := range a.Devices {
+			if err != nil {
+				// The devices went back to the host with the namespace
+				errs = append(errs, recoverDevice(cfg.DataDir, a.ContainerID, d))
+				continue
+			}
+			errs = append(errs, returnDevice(cfg, containerNs, a.ContainerID, d))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+
+	if err := restoreVdpaDriver(cfg.DataDir, a.ContainerID, a.IfName); err != nil {
+		return err
+	}
+	if err := releaseVF(cfg.DataDir, a.ContainerID, a.IfName); err != nil {
+		return err
+	}
+	return removeAttachment(cfg.DataDir, a.ContainerID, a.IfName)
+}
+
+// returnDevice moves the device out of the namespace, unless it is
+// no longer there
+func returnDevice(cfg *NetConf, containerNs ns.NetNS, containerID string, d movedDevice) error {
+	var found bool
+	err := containerNs.Do(func(_ ns.NetNS) error {
+		link, err := netlinksafe.LinkByName(d.IfName)
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				return nil
+			}
+			return err
+		}
+		found = link.Attrs().Alias == d.Device
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find %q in container: %v", d.IfName, err)
+	}
+	if !found {
+		return recoverDevice(cfg.DataDir, containerID, d)
+	}
+	return moveDeviceOut(cfg, containerNs, containerID, d.IfName)
+}
+
+// recoverDevice renames the device returned to the host by the kernel
+// along with the namespace back to its host name, found in its alias, and
+// restores what the ADD changed. The kernel keeps the name the device had
+// in the container, or picks a devN name if it is taken.
+func recoverDevice(dataDir, containerID string, d movedDevice) error {
+	links, err := netlinksafe.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links: %v", err)
+	}
+	for _, link := range links {
+		if link.Attrs().Alias != d.Device {
+			continue
+		}
+		if link.Attrs().Name != d.Device {
+			if err := netlink.LinkSetName(link, d.Device); err != nil {
+				return fmt.Errorf("failed to rename device %q to %q: %v", link.Attrs().Name, d.Device, err)
+			}
+		}
+		if err := netlink.LinkSetAlias(link, ""); err != nil {
+			return fmt.Errorf("failed to unset alias of %q: %v", d.Device, err)
+		}
+		break
+	}
+	if _, err := netlinksafe.LinkByName(d.Device); err != nil {
+		return fmt.Errorf("failed to find device %q on the host: %v", d.Device, err)
+	}
+
+	// The RDMA device went back to the host with the namespace too
+	if err := removeRecord(dataDir, rdmaGroup, containerID, d.IfName); err != nil {
+		return err
+	}
+	if err := restoreLinkSettings(dataDir, containerID, d.IfName); err != nil {
+		return err
+	}
+	if err := restoreIPState(dataDir, containerID, d.IfName); err != nil {
+		return err
+	}
+	return restoreBondMembership(dataDir, containerID, d.IfName)
+}
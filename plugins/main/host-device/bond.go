@@ -0,0 +1,144 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const defaultDataDir = "/run/cni/host-device"
+
+// bondMembership records the host bond a device was detached from, so
+// that DEL can enslave it again once it is back in the host namespace
+type bondMembership struct {
+	Bond   string `json:"bond"`
+	Device string `json:"device"`
+}
+
+// bondsGroup is the group of the bond memberships in the attachment store
+const bondsGroup = "bonds"
+
+// bondOf returns the bond the device is enslaved to, or nil
+func bondOf(dev netlink.Link) (*netlink.Bond, error) {
+	masterIndex := dev.Attrs().MasterIndex
+	if masterIndex == 0 {
+		return nil, nil
+	}
+	master, err := netlink.LinkByIndex(masterIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup master of %q: %v", dev.Attrs().Name, err)
+	}
+	bond, ok := master.(*netlink.Bond)
+	if !ok {
+		return nil, nil
+	}
+	return bond, nil
+}
+
+// detachFromBond removes the device from its host bond, if any, and
+// records the membership. It returns the bond name, empty when the device
+// was not enslaved.
+func detachFromBond(cfg *NetConf, dev netlink.Link, containerID, ifName string) (string, error) {
+	bond, err := bondOf(dev)
+	if err != nil || bond == nil {
+		return "", err
+	}
+	devName := dev.Attrs().Name
+	bondName := bond.Attrs().Name
+	if !cfg.DetachFromBond {
+		return "", fmt.Errorf("%q is enslaved to bond %q, set detachFromBond to move it anyway", devName, bondName)
+	}
+
+	store, err := attachments.Open(cfg.DataDir)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	id := attachments.ID(containerID, ifName)
+	if err := store.PutJSON(bondsGroup, id, &bondMembership{Bond: bondName, Device: devName}); err != nil {
+		return "", fmt.Errorf("failed to record bond membership of %q: %v", devName, err)
+	}
+
+	if err := netlink.LinkSetNoMaster(dev); err != nil {
+		_, _ = store.Remove(bondsGroup, id)
+		return "", fmt.Errorf("failed to detach %q from bond %q: %v", devName, bondName, err)
+	}
+	return bondName, nil
+}
+
+// enslave adds the device back to the bond. The bonding driver only
+// accepts devices which are down, and brings them up itself when the bond
+// is up.
+func enslave(bond, dev netlink.Link) error {
+	if dev.Attrs().MasterIndex == bond.Attrs().Index {
+		return nil
+	}
+	if dev.Attrs().Flags&net.FlagUp != 0 {
+		if err := netlink.LinkSetDown(dev); err != nil {
+			return fmt.Errorf("failed to set %q down: %v", dev.Attrs().Name, err)
+		}
+	}
+	if err := netlink.LinkSetMasterByIndex(dev, bond.Attrs().Index); err != nil {
+		return fmt.Errorf("failed to enslave %q to bond %q: %v", dev.Attrs().Name, bond.Attrs().Name, err)
+	}
+	return nil
+}
+
+// restoreBondMembership enslaves the device moved back to the host to the
+// bond recorded at ADD time. A missing record means the device was not
+// detached from a bond.
+func restoreBondMembership(dataDir, containerID, ifName string) error {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	id := attachments.ID(containerID, ifName)
+	m := &bondMembership{}
+	found, err := store.GetJSON(bondsGroup, id, m)
+	if err != nil {
+		return fmt.Errorf("failed to read bond membership: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	bond, err := netlinksafe.LinkByName(m.Bond)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+			return fmt.Errorf("failed to lookup bond %q: %v", m.Bond, err)
+		}
+		// The bond was deleted meanwhile, there is nothing to restore
+		_, err = store.Remove(bondsGroup, id)
+		return err
+	}
+	dev, err := netlinksafe.LinkByName(m.Device)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", m.Device, err)
+	}
+	if err := enslave(bond, dev); err != nil {
+		return err
+	}
+	_, err = store.Remove(bondsGroup, id)
+	return err
+}
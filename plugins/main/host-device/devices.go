@@ -0,0 +1,162 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// DeviceSelector selects one of the devices moved by a single ADD
+type DeviceSelector struct {
+	Device  string `json:"device,omitempty"`
+	HWAddr  string `json:"hwaddr,omitempty"`
+	PCIAddr string `json:"pciBusID,omitempty"`
+}
+
+func (d *DeviceSelector) String() string {
+	switch {
+	case d.Device != "":
+		return d.Device
+	case d.HWAddr != "":
+		return d.HWAddr
+	}
+	return d.PCIAddr
+}
+
+// validateDevices checks the devices list, which replaces the other ways
+// to select the device
+func validateDevices(n *NetConf) error {
+	if len(n.Devices) == 0 {
+		if n.IfNameTemplate != "" {
+			return fmt.Errorf(`"ifNameTemplate" requires "devices"`)
+		}
+		return nil
+	}
+	if n.Device != "" || n.HWAddr != "" || n.KernelPath != "" || n.PCIAddr != "" || n.auxDevice != "" ||
+		n.PCIVendorDevice != "" || len(n.UdevProperties) > 0 || n.PFName != "" || n.VfioMode || n.VDPA != nil {
+		return fmt.Errorf(`"devices" can't be combined with another way to select the device`)
+	}
+	for i, d := range n.Devices {
+		if d.Device == "" && d.HWAddr == "" && d.PCIAddr == "" {
+			return fmt.Errorf(`device %d: specify either "device", "hwaddr" or "pciBusID"`, i)
+		}
+	}
+	if n.IfNameTemplate != "" && len(n.Devices) > 1 && !strings.Contains(n.IfNameTemplate, "{index}") {
+		return fmt.Errorf(`"ifNameTemplate" %q must contain {index} to name several devices`, n.IfNameTemplate)
+	}
+	return nil
+}
+
+// deviceIfNames returns the container interface names of the devices. The
+// template replaces {ifname} by the interface name of the attachment and
+// {index} by the index of the device. Without template, the first device
+// is named after the attachment and the index is appended for the others.
+func deviceIfNames(n *NetConf, ifName string) []string {
+	names := make([]string, len(n.Devices))
+	for i := range n.Devices {
+		switch {
+		case n.IfNameTemplate != "":
+			names[i] = strings.NewReplacer("{ifname}", ifName, "{index}", strconv.Itoa(i)).Replace(n.IfNameTemplate)
+		case i == 0:
+			names[i] = ifName
+		default:
+			names[i] = ifName + strconv.Itoa(i)
+		}
+	}
+	return names
+}
+
+// moveDevicesIn moves all the devices to the container, or none of them,
+// and returns their interfaces
+func moveDevicesIn(cfg *NetConf, containerNs ns.NetNS, containerID, ifName string) ([]*current.Interface, error) {
+	names := deviceIfNames(cfg, ifName)
+	for _, name := range names {
+		if len(name) == 0 || len(name) > 15 {
+			return nil, fmt.Errorf("invalid interface name %q", name)
+		}
+	}
+
+	// Look all the devices up before moving any of them
+	hostDevs := make([]netlink.Link, len(cfg.Devices))
+	for i, d := range cfg.Devices {
+		err := waitForDevice(cfg.deviceWaitTimeout(), func() error {
+			var err error
+			hostDevs[i], err = getLink(d.Device, d.HWAddr, "", d.PCIAddr, "")
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find host device %s: %v", d.String(), err)
+		}
+	}
+
+	var interfaces []*current.Interface
+	for i, hostDev := range hostDevs {
+		contDev, err := moveDeviceIn(cfg, hostDev, containerNs, containerID, names[i])
+		if err != nil {
+			// Move the devices already moved back
+			for j := i - 1; j >= 0; j-- {
+				_ = moveDeviceOut(cfg, containerNs, containerID, names[j])
+			}
+			return nil, fmt.Errorf("device %s: %v", cfg.Devices[i].String(), err)
+		}
+		interfaces = append(interfaces, &current.Interface{
+			Name:    contDev.Attrs().Name,
+			Mac:     contDev.Attrs().HardwareAddr.String(),
+			Sandbox: containerNs.Path(),
+			PciID:   cfg.Devices[i].PCIAddr,
+		})
+	}
+	return interfaces, nil
+}
+
+// moveDevicesOut moves the devices back to the host. Those no longer in
+// the container were moved out by a previous DEL.
+func moveDevicesOut(cfg *NetConf, containerNs ns.NetNS, containerID, ifName string) error {
+	var errs []error
+	for _, name := range deviceIfNames(cfg, ifName) {
+		var found bool
+		err := containerNs.Do(func(_ ns.NetNS) error {
+			_, err := netlinksafe.LinkByName(name)
+			if err != nil {
+				if _, ok := err.(netlink.LinkNotFoundError); ok {
+					return nil
+				}
+				return err
+			}
+			found = true
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find %q in container: %v", name, err))
+			continue
+		}
+		if !found {
+			continue
+		}
+		if err := moveDeviceOut(cfg, containerNs, containerID, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -58,6 +58,50 @@ type NetConf struct {
 		DeviceID string `json:"deviceID,omitempty"`
 	} `json:"runtimeConfig,omitempty"`
 
+	// DetachFromBond allows moving a device enslaved to a host bond: it is
+	// removed from the bond on ADD and enslaved again on DEL
+	DetachFromBond bool   `json:"detachFromBond,omitempty"`
+	DataDir        string `json:"dataDir,omitempty"`
+
+	// PCIVendorDevice selects the device by PCI vendor and device ID, such
+	// as "15b3:1018" or "15b3:*". PCIDeviceIndex picks the device among the
+	// matching ones in PCI address order, instead of the first unused one.
+	PCIVendorDevice string `json:"pciVendorDevice,omitempty"`
+	PCIDeviceIndex  *int   `json:"pciDeviceIndex,omitempty"`
+
+	// VfioMode hands the PCI device over to vfio-pci for DPDK workloads
+	// instead of moving its network interface, and binds it back to its
+	// kernel driver on DEL
+	VfioMode bool `json:"vfioMode,omitempty"`
+
+	// UdevProperties selects the device whose udev properties, such as
+	// ID_PATH or ID_NET_NAME_ONBOARD, include all the given ones
+	UdevProperties map[string]string `json:"udevProperties,omitempty"`
+
+	// PFName allocates a free VF of the SR-IOV physical function, which is
+	// configured through the PF with VF, if set, and released on DEL
+	PFName string    `json:"pfName,omitempty"`
+	VF     *VFConfig `json:"vf,omitempty"`
+
+	// DeviceWaitTimeoutMs is how long ADD waits for a hot-plugged device to
+	// show up, or for udev to rename it, before failing
+	DeviceWaitTimeoutMs int `json:"deviceWaitTimeoutMs,omitempty"`
+
+	// Devices moves several devices in one ADD, all reported in the result.
+	// IfNameTemplate names them, see deviceIfNames.
+	Devices        []DeviceSelector `json:"devices,omitempty"`
+	IfNameTemplate string           `json:"ifNameTemplate,omitempty"`
+
+	// VDPA selects a vDPA device and binds it to virtio_vdpa, to move its
+	// interface, or to vhost_vdpa, to hand its character device over
+	VDPA *VDPAConfig `json:"vdpa,omitempty"`
+
+	// MTU, Promisc and AllMulti are set on the device once in the
+	// container, and their host values restored on DEL
+	MTU      int   `json:"mtu,omitempty"`
+	Promisc  *bool `json:"promisc,omitempty"`
+	AllMulti *bool `json:"allmulti,omitempty"`
+
 	// for internal use
 	auxDevice string `json:"-"` // Auxiliary device name as appears on Auxiliary bus (/sys/bus/auxiliary)
 }
@@ -94,20 +138,101 @@ func handleDeviceID(netconf *NetConf) error {
 	return fmt.Errorf("runtime config DeviceID %s not found or unsupported", deviceID)
 }
 
-func loadConf(bytes []byte) (*NetConf, error) {
+// handlePCIVendorDevice resolves pciVendorDevice into the PCI address of
+// the device. After ADD, the device is the one recorded in prevResult.
+func handlePCIVendorDevice(n *NetConf, command string) error {
+	if n.PCIVendorDevice == "" || n.Device != "" || n.HWAddr != "" || n.KernelPath != "" || n.PCIAddr != "" || n.auxDevice != "" {
+		return nil
+	}
+
+	if n.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&n.NetConf); err != nil {
+			return err
+		}
+		prevResult, err := current.NewResultFromResult(n.PrevResult)
+		if err != nil {
+			return err
+		}
+		if len(prevResult.Interfaces) > 0 && prevResult.Interfaces[0].PciID != "" {
+			n.PCIAddr = prevResult.Interfaces[0].PciID
+			return nil
+		}
+	}
+
+	// Only ADD needs a device that is still unused, DEL and CHECK are left
+	// with the first matching one to find out whether it is a DPDK device
+	pciAddr, err := selectPCIDevice(n.PCIVendorDevice, n.PCIDeviceIndex, command == "ADD")
+	if err != nil {
+		return err
+	}
+	n.PCIAddr = pciAddr
+	return nil
+}
+
+// handleUdevProperties resolves udevProperties into the name of the device.
+// Only ADD looks the device up, it is in the container afterwards.
+func handleUdevProperties(n *NetConf, command string) error {
+	if len(n.UdevProperties) == 0 || command != "ADD" || n.Device != "" || n.HWAddr != "" || n.KernelPath != "" || n.PCIAddr != "" || n.auxDevice != "" {
+		return nil
+	}
+	// udev records the properties once it is done with a new device
+	return waitForDevice(n.deviceWaitTimeout(), func() error {
+		device, err := findDeviceByUdevProperties(n.UdevProperties)
+		if err != nil {
+			return err
+		}
+		n.Device = device
+		return nil
+	})
+}
+
+func loadConf(bytes []byte, command string) (*NetConf, error) {
 	n := &NetConf{}
 	var err error
 	if err = json.Unmarshal(bytes, n); err != nil {
 		return nil, fmt.Errorf("failed to load netconf: %v", err)
 	}
 
+	if n.DeviceWaitTimeoutMs < 0 {
+		return nil, fmt.Errorf("invalid deviceWaitTimeoutMs %d", n.DeviceWaitTimeoutMs)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid mtu %d", n.MTU)
+	}
+
 	// Override device with the standardized DeviceID if provided in Runtime Config.
 	if err := handleDeviceID(n); err != nil {
 		return nil, err
 	}
 
-	if n.Device == "" && n.HWAddr == "" && n.KernelPath == "" && n.PCIAddr == "" && n.auxDevice == "" {
-		return nil, fmt.Errorf(`specify either "device", "hwaddr", "kernelpath" or "pciBusID"`)
+	if err := handlePCIVendorDevice(n, command); err != nil {
+		return nil, err
+	}
+
+	if err := handleUdevProperties(n, command); err != nil {
+		return nil, err
+	}
+
+	if n.Device == "" && n.HWAddr == "" && n.KernelPath == "" && n.PCIAddr == "" && n.auxDevice == "" && len(n.UdevProperties) == 0 && n.PFName == "" && len(n.Devices) == 0 && n.VDPA == nil {
+		return nil, fmt.Errorf(`specify either "device", "hwaddr", "kernelpath", "pciBusID", "pciVendorDevice", "udevProperties", "pfName", "devices" or "vdpa"`)
+	}
+
+	if err := validateDevices(n); err != nil {
+		return nil, err
+	}
+	if err := n.VDPA.validate(); err != nil {
+		return nil, err
+	}
+
+	if n.VF != nil && n.PFName == "" {
+		return nil, fmt.Errorf(`"vf" requires "pfName"`)
+	}
+	if err := n.VF.validate(); err != nil {
+		return nil, err
+	}
+
+	if n.DataDir == "" {
+		n.DataDir = defaultDataDir
 	}
 
 	if len(n.PCIAddr) > 0 {
@@ -116,12 +241,15 @@ func loadConf(bytes []byte) (*NetConf, error) {
 			return nil, fmt.Errorf("error with host device: %v", err)
 		}
 	}
+	if (n.DPDKMode || n.VfioMode) && hasLinkSettings(n) {
+		return nil, fmt.Errorf(`"mtu", "promisc" and "allmulti" require a network interface to move`)
+	}
 
 	return n, nil
 }
 
-func cmdAdd(args *skel.CmdArgs) error {
-	cfg, err := loadConf(args.StdinData)
+func cmdAdd(args *skel.CmdArgs) (err error) {
+	cfg, err := loadConf(args.StdinData, "ADD")
 	if err != nil {
 		return err
 	}
@@ -136,17 +264,76 @@ func cmdAdd(args *skel.CmdArgs) error {
 		Name:    args.IfName,
 		Sandbox: containerNs.Path(),
 	}}
+	if cfg.VDPA != nil && cfg.Device == "" {
+		var devPath string
+		devPath, err = attachVdpa(cfg, args.ContainerID, args.IfName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = restoreVdpaDriver(cfg.DataDir, args.ContainerID, args.IfName)
+			}
+		}()
+		if devPath != "" {
+			// The character device is handed over instead of an interface
+			cfg.DPDKMode = true
+			result.Interfaces[0].SocketPath = devPath
+		}
+	}
+
+	if cfg.PFName != "" && cfg.PCIAddr == "" && cfg.Device == "" && cfg.HWAddr == "" && cfg.KernelPath == "" && cfg.auxDevice == "" {
+		cfg.PCIAddr, err = allocateVF(cfg.DataDir, cfg.PFName, cfg.VF, args.ContainerID, args.IfName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = releaseVF(cfg.DataDir, args.ContainerID, args.IfName)
+			}
+		}()
+	}
+	if cfg.PCIVendorDevice != "" || cfg.PFName != "" {
+		// Recorded for DEL and CHECK, which can't select the device again
+		result.Interfaces[0].PciID = cfg.PCIAddr
+	}
+
+	if cfg.VfioMode {
+		if !cfg.DPDKMode {
+			if err := handOverToVfio(cfg, args.ContainerID, args.IfName); err != nil {
+				return err
+			}
+			cfg.DPDKMode = true
+			defer func() {
+				if err != nil {
+					_ = restoreDriver(cfg.DataDir, args.ContainerID, args.IfName)
+				}
+			}()
+		}
+		var group string
+		group, err = iommuGroup(cfg.PCIAddr)
+		if err != nil {
+			return err
+		}
+		result.Interfaces[0].PciID = cfg.PCIAddr
+		result.Interfaces[0].SocketPath = filepath.Join("/dev/vfio", group)
+	}
 
 	var contDev netlink.Link
-	if !cfg.DPDKMode {
-		hostDev, err := getLink(cfg.Device, cfg.HWAddr, cfg.KernelPath, cfg.PCIAddr, cfg.auxDevice)
+	if len(cfg.Devices) > 0 {
+		result.Interfaces, err = moveDevicesIn(cfg, containerNs, args.ContainerID, args.IfName)
+		if err != nil {
+			return err
+		}
+	} else if !cfg.DPDKMode {
+		hostDev, err := waitForLink(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to find host device: %v", err)
 		}
 
-		contDev, err = moveLinkIn(hostDev, containerNs, args.IfName)
+		contDev, err = moveDeviceIn(cfg, hostDev, containerNs, args.ContainerID, args.IfName)
 		if err != nil {
-			return fmt.Errorf("failed to move link %v", err)
+			return err
 		}
 
 		// Override the device name with the name in the container namespace
@@ -155,8 +342,18 @@ func cmdAdd(args *skel.CmdArgs) error {
 		result.Interfaces[0].Mac = contDev.Attrs().HardwareAddr.String()
 	}
 
+	// Recorded for GC, and kept if the ADD fails from now on since the
+	// devices stay in the container until DEL
+	var moved []*current.Interface
+	if !cfg.DPDKMode {
+		moved = result.Interfaces
+	}
+	if err = saveAttachment(cfg, containerNs, args.ContainerID, args.IfName, moved); err != nil {
+		return err
+	}
+
 	if cfg.IPAM.Type == "" {
-		if cfg.DPDKMode {
+		if cfg.DPDKMode || len(cfg.Devices) > 0 {
 			return types.PrintResult(result, cfg.CNIVersion)
 		}
 		return printLink(contDev, cfg.CNIVersion, containerNs)
@@ -194,7 +391,8 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 	if !cfg.DPDKMode {
 		err = containerNs.Do(func(_ ns.NetNS) error {
-			return ipam.ConfigureIface(args.IfName, newResult)
+			// The addresses go to the first device
+			return ipam.ConfigureIface(result.Interfaces[0].Name, newResult)
 		})
 		if err != nil {
 			return err
@@ -206,14 +404,42 @@ func cmdAdd(args *skel.CmdArgs) error {
 	return types.PrintResult(newResult, cfg.CNIVersion)
 }
 
-func cmdDel(args *skel.CmdArgs) error {
-	cfg, err := loadConf(args.StdinData)
+func cmdDel(args *skel.CmdArgs) (err error) {
+	cfg, err := loadConf(args.StdinData, "DEL")
 	if err != nil {
 		return err
 	}
-	if args.Netns == "" {
+	defer func() {
+		if err == nil {
+			err = removeAttachment(cfg.DataDir, args.ContainerID, args.IfName)
+		}
+	}()
+	// The device bound to vfio-pci has no network interface to move out
+	if err := restoreDriver(cfg.DataDir, args.ContainerID, args.IfName); err != nil {
+		return err
+	}
+	// The vDPA device bound to vhost_vdpa has no network interface to move out
+	vdpa, err := vdpaBindingOf(cfg.DataDir, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if cfg.VDPA != nil && vdpa == nil {
+		// Released by a previous DEL, or never attached
 		return nil
 	}
+	vhostVdpa := vdpa != nil && vdpa.Driver == vdpaVhostDriver
+	if vhostVdpa {
+		if err := restoreVdpaDriver(cfg.DataDir, args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+	}
+	if args.Netns == "" {
+		// The VF or the vDPA interface went back to the host with the namespace
+		if err := restoreVdpaDriver(cfg.DataDir, args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+		return releaseVF(cfg.DataDir, args.ContainerID, args.IfName)
+	}
 	containerNs, err := ns.GetNS(args.Netns)
 	if err != nil {
 		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
@@ -226,13 +452,104 @@ func cmdDel(args *skel.CmdArgs) error {
 		}
 	}
 
-	if !cfg.DPDKMode {
-		if err := moveLinkOut(containerNs, args.IfName); err != nil {
+	if len(cfg.Devices) > 0 {
+		return moveDevicesOut(cfg, containerNs, args.ContainerID, args.IfName)
+	}
+
+	if !cfg.DPDKMode && !cfg.VfioMode && !vhostVdpa {
+		if err := moveDeviceOut(cfg, containerNs, args.ContainerID, args.IfName); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if err := restoreVdpaDriver(cfg.DataDir, args.ContainerID, args.IfName); err != nil {
+		return err
+	}
+
+	return releaseVF(cfg.DataDir, args.ContainerID, args.IfName)
+}
+
+// moveDeviceIn moves the host device to the container under ifName, along
+// with its RDMA device, once detached from its bond and its IP
+// configuration recorded, and applies the link settings of the
+// configuration. The state is kept under ifName for moveDeviceOut.
+func moveDeviceIn(cfg *NetConf, hostDev netlink.Link, containerNs ns.NetNS, containerID, ifName string) (netlink.Link, error) {
+	bondName, err := detachFromBond(cfg, hostDev, containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	if bondName != "" {
+		// Leaving the bond changes the device state, look it up again
+		hostDev, err = netlinksafe.LinkByName(hostDev.Attrs().Name)
+		if err != nil {
+			_ = restoreBondMembership(cfg.DataDir, containerID, ifName)
+			return nil, fmt.Errorf("failed to find host device: %v", err)
+		}
+	}
+
+	// The RDMA device is found through the sysfs entry of the network
+	// device, which is gone once it is moved
+	rdmaDev, err := rdmaDeviceOf(hostDev.Attrs().Name)
+	if err != nil {
+		if bondName != "" {
+			_ = restoreBondMembership(cfg.DataDir, containerID, ifName)
+		}
+		return nil, err
+	}
+
+	if err := saveIPState(cfg.DataDir, containerID, ifName, hostDev); err != nil {
+		if bondName != "" {
+			_ = restoreBondMembership(cfg.DataDir, containerID, ifName)
+		}
+		return nil, err
+	}
+
+	contDev, err := moveLinkIn(hostDev, containerNs, ifName)
+	if err != nil {
+		_ = removeRecord(cfg.DataDir, ipGroup, containerID, ifName)
+		if bondName != "" {
+			_ = restoreBondMembership(cfg.DataDir, containerID, ifName)
+		}
+		return nil, fmt.Errorf("failed to move link %v", err)
+	}
+
+	if err := moveRdmaIn(cfg.DataDir, rdmaDev, containerNs, containerID, ifName); err != nil {
+		_ = moveLinkOut(containerNs, ifName)
+		_ = restoreIPState(cfg.DataDir, containerID, ifName)
+		if bondName != "" {
+			_ = restoreBondMembership(cfg.DataDir, containerID, ifName)
+		}
+		return nil, err
+	}
+
+	if err := applyLinkSettings(cfg, hostDev, containerNs, containerID, ifName); err != nil {
+		_ = moveRdmaOut(cfg.DataDir, containerNs, containerID, ifName)
+		_ = moveLinkOut(containerNs, ifName)
+		_ = restoreIPState(cfg.DataDir, containerID, ifName)
+		if bondName != "" {
+			_ = restoreBondMembership(cfg.DataDir, containerID, ifName)
+		}
+		return nil, err
+	}
+	return contDev, nil
+}
+
+// moveDeviceOut moves the device named ifName in the container back to the
+// host, and restores what moveDeviceIn changed
+func moveDeviceOut(cfg *NetConf, containerNs ns.NetNS, containerID, ifName string) error {
+	if err := moveRdmaOut(cfg.DataDir, containerNs, containerID, ifName); err != nil {
+		return err
+	}
+	if err := moveLinkOut(containerNs, ifName); err != nil {
+		return err
+	}
+	if err := restoreLinkSettings(cfg.DataDir, containerID, ifName); err != nil {
+		return err
+	}
+	if err := restoreIPState(cfg.DataDir, containerID, ifName); err != nil {
+		return err
+	}
+	return restoreBondMembership(cfg.DataDir, containerID, ifName)
 }
 
 func moveLinkIn(hostDev netlink.Link, containerNs ns.NetNS, containerIfName string) (netlink.Link, error) {
@@ -512,7 +829,8 @@ func getLink(devname, hwaddr, kernelpath, pciaddr string, auxDev string) (netlin
 	switch {
 
 	case len(devname) > 0:
-		return netlinksafe.LinkByName(devname)
+		// device may be an alternative name of the link
+		return netlinksafe.LinkByAny(netlinksafe.LinkSelector{Name: devname})
 	case len(hwaddr) > 0:
 		hwAddr, err := net.ParseMAC(hwaddr)
 		if err != nil {
@@ -560,12 +878,12 @@ func main() {
 		Check:  cmdCheck,
 		Del:    cmdDel,
 		Status: cmdStatus,
-		/* FIXME GC */
+		GC:     cmdGC,
 	}, version.All, bv.BuildString("host-device"))
 }
 
 func cmdCheck(args *skel.CmdArgs) error {
-	cfg, err := loadConf(args.StdinData)
+	cfg, err := loadConf(args.StdinData, "CHECK")
 	if err != nil {
 		return err
 	}
@@ -600,34 +918,57 @@ func cmdCheck(args *skel.CmdArgs) error {
 	if cfg.DPDKMode {
 		return nil
 	}
+	// The vDPA device bound to vhost_vdpa has no interface in the container
+	vdpa, err := vdpaBindingOf(cfg.DataDir, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if vdpa != nil && vdpa.Driver == vdpaVhostDriver {
+		return nil
+	}
 
-	var contMap current.Interface
-	// Find interfaces for name we know, that of host-device inside container
-	for _, intf := range result.Interfaces {
-		if args.IfName == intf.Name {
-			if args.Netns == intf.Sandbox {
-				contMap = *intf
-				continue
+	ifNames := []string{args.IfName}
+	if len(cfg.Devices) > 0 {
+		ifNames = deviceIfNames(cfg, args.IfName)
+	}
+
+	contMaps := make([]current.Interface, len(ifNames))
+	for i, ifName := range ifNames {
+		// Find interfaces for name we know, that of host-device inside container
+		for _, intf := range result.Interfaces {
+			if ifName == intf.Name {
+				if args.Netns == intf.Sandbox {
+					contMaps[i] = *intf
+					continue
+				}
 			}
 		}
-	}
 
-	// The namespace must be the same as what was configured
-	if args.Netns != contMap.Sandbox {
-		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
-			contMap.Sandbox, args.Netns)
+		// The namespace must be the same as what was configured
+		if args.Netns != contMaps[i].Sandbox {
+			return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+				contMaps[i].Sandbox, args.Netns)
+		}
 	}
 
 	//
 	// Check prevResults for ips, routes and dns against values found in the container
 	if err := netns.Do(func(_ ns.NetNS) error {
-		// Check interface against values found in the container
-		err := validateCniContainerInterface(contMap)
-		if err != nil {
-			return err
+		// Check interfaces against values found in the container
+		for _, contMap := range contMaps {
+			if err := validateCniContainerInterface(contMap); err != nil {
+				return err
+			}
+		}
+		if hasLinkSettings(cfg) {
+			for _, ifName := range ifNames {
+				if err := checkLinkSettings(cfg, ifName); err != nil {
+					return err
+				}
+			}
 		}
 
-		err = ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs)
+		err := ip.ValidateExpectedInterfaceIPs(ifNames[0], result.IPs)
 		if err != nil {
 			return err
 		}
@@ -685,3 +1026,43 @@ func cmdStatus(args *skel.CmdArgs) error {
 
 	return nil
 }
+
+// cmdGC returns the devices of the attachments of the network that are not
+// in the list of valid attachments to the host, e.g. after the runtime
+// crashed, and releases what they held. The configuration doesn't select
+// the devices, they are found through the attachment records.
+func cmdGC(args *skel.CmdArgs) error {
+	conf := NetConf{}
+	if err := json.Unmarshal(args.StdinData, &conf); err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+	if conf.DataDir == "" {
+		conf.DataDir = defaultDataDir
+	}
+
+	if conf.IPAM.Type != "" {
+		if err := ipam.ExecGC(conf.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	valid := make(map[types.GCAttachment]bool, len(conf.ValidAttachments))
+	for _, a := range conf.ValidAttachments {
+		valid[a] = true
+	}
+
+	attachments, err := listAttachments(conf.DataDir, conf.Name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, a := range attachments {
+		if valid[types.GCAttachment{ContainerID: a.ContainerID, IfName: a.IfName}] {
+			continue
+		}
+		if err := releaseAttachment(&conf, a); err != nil {
+			errs = append(errs, fmt.Errorf("attachment %s/%s: %v", a.ContainerID, a.IfName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
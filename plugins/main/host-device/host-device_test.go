@@ -22,18 +22,22 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	types040 "github.com/containernetworking/cni/pkg/types/040"
 	types100 "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/attachments"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/sriov"
 	"github.com/containernetworking/plugins/pkg/testutils"
 )
 
@@ -736,7 +740,7 @@ var _ = Describe("base functionality", func() {
 				StdinData:   []byte(conf),
 			}
 			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
-			Expect(err).To(MatchError(`specify either "device", "hwaddr", "kernelpath" or "pciBusID"`))
+			Expect(err).To(MatchError(`specify either "device", "hwaddr", "kernelpath", "pciBusID", "pciVendorDevice", "udevProperties", "pfName", "devices" or "vdpa"`))
 		})
 
 		It(fmt.Sprintf("[%s] works with a valid config without IPAM", ver), func() {
@@ -1350,9 +1354,1226 @@ var _ = Describe("base functionality", func() {
 	}
 })
 
+var _ = Describe("bond members", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	const (
+		bondName   = "bond-test"
+		memberName = "member0"
+	)
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			bond := netlink.NewLinkBond(netlink.LinkAttrs{Name: bondName})
+			bond.Mode = netlink.BOND_MODE_ACTIVE_BACKUP
+			Expect(netlink.LinkAdd(bond)).To(Succeed())
+			Expect(netlink.LinkSetUp(bond)).To(Succeed())
+
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: memberName},
+				PeerName:  "peer0",
+			})).To(Succeed())
+			member, err := netlinksafe.LinkByName(memberName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetMasterByIndex(member, bond.Attrs().Index)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	conf := func(detach bool) []byte {
+		return []byte(fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"device": %q,
+			"detachFromBond": %t,
+			"dataDir": %q
+		}`, memberName, detach, dataDir))
+	}
+
+	masterOf := func(name string) int {
+		link, err := netlinksafe.LinkByName(name)
+		Expect(err).NotTo(HaveOccurred())
+		return link.Attrs().MasterIndex
+	}
+
+	It("refuses to move a bond member by default", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "eth0",
+			StdinData:   conf(false),
+		}
+		_ = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).To(MatchError(ContainSubstring(`"member0" is enslaved to bond "bond-test"`)))
+			Expect(masterOf(memberName)).NotTo(BeZero())
+			return nil
+		})
+	})
+
+	It("detaches the device from its bond on ADD and enslaves it again on DEL", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "eth0",
+			StdinData:   conf(true),
+		}
+		_ = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			bond, err := netlinksafe.LinkByName(bondName)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path.Join(dataDir, bondsGroup, attachments.ID(args.ContainerID, args.IfName))).To(BeAnExistingFile())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				Expect(masterOf("eth0")).To(BeZero())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(masterOf(memberName)).To(Equal(bond.Attrs().Index))
+			Expect(path.Join(dataDir, bondsGroup, attachments.ID(args.ContainerID, args.IfName))).NotTo(BeAnExistingFile())
+			return nil
+		})
+	})
+
+	It("does not fail DEL when the bond is gone", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "eth0",
+			StdinData:   conf(true),
+		}
+		_ = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+
+			bond, err := netlinksafe.LinkByName(bondName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkDel(bond)).To(Succeed())
+
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(masterOf(memberName)).To(BeZero())
+			Expect(path.Join(dataDir, bondsGroup, attachments.ID(args.ContainerID, args.IfName))).NotTo(BeAnExistingFile())
+			return nil
+		})
+	})
+})
+
+var _ = Describe("PCI device selection", func() {
+	var fs *fakeFilesystem
+
+	BeforeEach(func() {
+		fs = &fakeFilesystem{
+			dirs: []string{
+				"sys/bus/pci/devices/0000:00:00.1/net/nonexistent0",
+				"sys/bus/pci/devices/0000:00:00.2/net/lo",
+				"sys/bus/pci/devices/0000:00:00.3",
+				"sys/bus/pci/devices/0000:01:00.0",
+				"sys/bus/pci/drivers/mlx5_core",
+			},
+			symlinks: map[string]string{
+				"sys/bus/pci/devices/0000:00:00.1/driver": "../../../../bus/pci/drivers/mlx5_core",
+				"sys/bus/pci/devices/0000:00:00.2/driver": "../../../../bus/pci/drivers/mlx5_core",
+			},
+			files: map[string]string{
+				"sys/bus/pci/devices/0000:00:00.1/vendor": "0x15b3\n",
+				"sys/bus/pci/devices/0000:00:00.1/device": "0x1018\n",
+				"sys/bus/pci/devices/0000:00:00.2/vendor": "0x15b3\n",
+				"sys/bus/pci/devices/0000:00:00.2/device": "0x1018\n",
+				"sys/bus/pci/devices/0000:00:00.3/vendor": "0x15b3\n",
+				"sys/bus/pci/devices/0000:00:00.3/device": "0x101e\n",
+				"sys/bus/pci/devices/0000:01:00.0/vendor": "0x8086\n",
+				"sys/bus/pci/devices/0000:01:00.0/device": "0x154c\n",
+			},
+		}
+		DeferCleanup(fs.use())
+	})
+
+	index := func(i int) *int { return &i }
+
+	It("selects the devices by vendor and device ID in PCI address order", func() {
+		Expect(selectPCIDevice("15b3:1018", index(0), false)).To(Equal("0000:00:00.1"))
+		Expect(selectPCIDevice("15b3:1018", index(1), false)).To(Equal("0000:00:00.2"))
+		Expect(selectPCIDevice("15b3:*", index(2), false)).To(Equal("0000:00:00.3"))
+		Expect(selectPCIDevice("*:154C", nil, false)).To(Equal("0000:01:00.0"))
+	})
+
+	It("selects the first device still in the current namespace", func() {
+		Expect(selectPCIDevice("15b3:1018", nil, true)).To(Equal("0000:00:00.2"))
+		_, err := selectPCIDevice("15b3:101e", nil, true)
+		Expect(err).To(MatchError(`all the PCI devices matching "15b3:101e" are in use`))
+	})
+
+	It("fails on invalid selectors and indexes", func() {
+		_, err := selectPCIDevice("15b3", nil, false)
+		Expect(err).To(MatchError(`invalid pciVendorDevice "15b3", must be <vendor>:<device>`))
+		_, err = selectPCIDevice("mlx:1018", nil, false)
+		Expect(err).To(MatchError(`invalid pciVendorDevice "mlx:1018", IDs must be 4 hex digits or *`))
+		_, err = selectPCIDevice("15b3:1018", index(2), false)
+		Expect(err).To(MatchError(`pciDeviceIndex 2 out of range, 2 PCI devices match "15b3:1018"`))
+		_, err = selectPCIDevice("1af4:*", nil, false)
+		Expect(err).To(MatchError(`no PCI device matches "1af4:*"`))
+	})
+
+	It("uses the device of the previous result after ADD", func() {
+		conf := []byte(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"pciVendorDevice": "15b3:1018",
+			"prevResult": {
+				"cniVersion": "1.0.0",
+				"interfaces": [{"name": "eth0", "sandbox": "/var/run/netns/test", "pciID": "0000:00:00.1"}]
+			}
+		}`)
+		cfg, err := loadConf(conf, "DEL")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.PCIAddr).To(Equal("0000:00:00.1"))
+
+		conf = []byte(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"pciVendorDevice": "15b3:1018"
+		}`)
+		cfg, err = loadConf(conf, "ADD")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.PCIAddr).To(Equal("0000:00:00.2"))
+	})
+})
+
+var _ = Describe("vfio handover", func() {
+	const pciAddr = "0000:00:00.1"
+	var (
+		fs       *fakeFilesystem
+		targetNS ns.NetNS
+		dataDir  string
+	)
+
+	BeforeEach(func() {
+		fs = &fakeFilesystem{
+			dirs: []string{
+				"sys/bus/pci/devices/" + pciAddr,
+				"sys/bus/pci/drivers/mlx5_core",
+				"sys/bus/pci/drivers/vfio-pci",
+				"sys/kernel/iommu_groups/42",
+			},
+			symlinks: map[string]string{
+				"sys/bus/pci/devices/" + pciAddr + "/driver":      "../../../../bus/pci/drivers/mlx5_core",
+				"sys/bus/pci/devices/" + pciAddr + "/iommu_group": "../../../../kernel/iommu_groups/42",
+			},
+		}
+		DeferCleanup(fs.use())
+
+		// Mimic the PCI core binding the device to its override on probe
+		origWriteSysfs := writeSysfs
+		writeSysfs = func(p, value string) error {
+			driverLink := path.Join(sysBusPCI, pciAddr, "driver")
+			switch path.Base(p) {
+			case "unbind":
+				return os.Remove(driverLink)
+			case "drivers_probe":
+				override, err := os.ReadFile(path.Join(sysBusPCI, pciAddr, "driver_override"))
+				if err != nil {
+					return err
+				}
+				driver := strings.TrimSpace(string(override))
+				if driver == "" {
+					driver = "mlx5_core"
+				}
+				return os.Symlink("../../../../bus/pci/drivers/"+driver, driverLink)
+			}
+			return os.WriteFile(p, []byte(value), 0o600)
+		}
+		DeferCleanup(func() { writeSysfs = origWriteSysfs })
+
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device-vfio")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("binds the device to vfio-pci and back to its driver", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"pciBusID": %q,
+			"vfioMode": true,
+			"dataDir": %q
+		}`, pciAddr, dataDir)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "net1",
+			Netns:       targetNS.Path(),
+			StdinData:   []byte(conf),
+		}
+
+		resI, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+		Expect(err).NotTo(HaveOccurred())
+		res, err := types100.NewResultFromResult(resI)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Interfaces).To(Equal([]*types100.Interface{{
+			Name:       "net1",
+			Sandbox:    targetNS.Path(),
+			PciID:      pciAddr,
+			SocketPath: "/dev/vfio/42",
+		}}))
+		Expect(pciDriver(pciAddr)).To(Equal("vfio-pci"))
+		Expect(hasRecord(dataDir, vfioGroup, "dummy", "net1")).To(BeTrue())
+
+		err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pciDriver(pciAddr)).To(Equal("mlx5_core"))
+		Expect(hasRecord(dataDir, vfioGroup, "dummy", "net1")).To(BeFalse())
+
+		// DEL is idempotent
+		err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pciDriver(pciAddr)).To(Equal("mlx5_core"))
+	})
+
+	It("requires a PCI device", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"device": "eth5",
+			"vfioMode": true,
+			"dataDir": %q
+		}`, dataDir)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "net1",
+			Netns:       targetNS.Path(),
+			StdinData:   []byte(conf),
+		}
+		_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+		Expect(err).To(MatchError(`vfioMode requires a PCI device, set "pciBusID" or "pciVendorDevice"`))
+	})
+})
+
+var _ = Describe("vDPA devices", func() {
+	const mgmtDev = "0000:65:00.2"
+	var (
+		targetNS ns.NetNS
+		dataDir  string
+	)
+
+	BeforeEach(func() {
+		fs := &fakeFilesystem{
+			dirs: []string{
+				"sys/devices/pci0000:00/" + mgmtDev + "/vdpa0",
+				"sys/devices/pci0000:00/" + mgmtDev + "/vdpa1",
+				"sys/devices/vdpasim_net/vdpa2",
+				"sys/bus/vdpa/devices",
+				"sys/bus/vdpa/drivers/virtio_vdpa",
+				"sys/bus/vdpa/drivers/vhost_vdpa",
+			},
+			symlinks: map[string]string{
+				"sys/bus/vdpa/devices/vdpa0":                          "../../../devices/pci0000:00/" + mgmtDev + "/vdpa0",
+				"sys/bus/vdpa/devices/vdpa1":                          "../../../devices/pci0000:00/" + mgmtDev + "/vdpa1",
+				"sys/bus/vdpa/devices/vdpa2":                          "../../../devices/vdpasim_net/vdpa2",
+				"sys/devices/pci0000:00/" + mgmtDev + "/vdpa0/driver": "../../../../bus/vdpa/drivers/virtio_vdpa",
+			},
+		}
+		DeferCleanup(fs.use())
+
+		// Mimic the vDPA bus creating the device of the driver on bind
+		origWriteSysfs := writeSysfs
+		writeSysfs = func(p, value string) error {
+			dev := path.Join(sysBusVdpa, "devices", value)
+			driver := path.Base(path.Dir(p))
+			switch path.Base(p) {
+			case "unbind":
+				for _, child := range []string{"driver", "virtio0", "vhost-vdpa-0"} {
+					if err := os.RemoveAll(path.Join(dev, child)); err != nil {
+						return err
+					}
+				}
+				return nil
+			case "bind":
+				if err := os.Symlink("../../../../bus/vdpa/drivers/"+driver, path.Join(dev, "driver")); err != nil {
+					return err
+				}
+				if driver == "vhost_vdpa" {
+					return os.Mkdir(path.Join(dev, "vhost-vdpa-0"), 0o755)
+				}
+				return os.MkdirAll(path.Join(dev, "virtio0", "net", "eth-"+value), 0o755)
+			}
+			return fmt.Errorf("unexpected write to %s", p)
+		}
+		DeferCleanup(func() { writeSysfs = origWriteSysfs })
+
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device-vdpa")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("binds the device to vhost_vdpa and publishes its character device", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"vdpa": {"name": "vdpa0", "driver": "vhost_vdpa"},
+			"dataDir": %q
+		}`, dataDir)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "net1",
+			Netns:       targetNS.Path(),
+			StdinData:   []byte(conf),
+		}
+
+		resI, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+		Expect(err).NotTo(HaveOccurred())
+		res, err := types100.NewResultFromResult(resI)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Interfaces).To(Equal([]*types100.Interface{{
+			Name:       "net1",
+			Sandbox:    targetNS.Path(),
+			SocketPath: "/dev/vhost-vdpa-0",
+		}}))
+		Expect(vdpaDriver("vdpa0")).To(Equal("vhost_vdpa"))
+		Expect(hasRecord(dataDir, vdpaGroup, "dummy", "net1")).To(BeTrue())
+
+		err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vdpaDriver("vdpa0")).To(Equal("virtio_vdpa"))
+		Expect(hasRecord(dataDir, vdpaGroup, "dummy", "net1")).To(BeFalse())
+
+		// DEL is idempotent
+		err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vdpaDriver("vdpa0")).To(Equal("virtio_vdpa"))
+	})
+
+	It("selects the unused devices of the management device in turn", func() {
+		cfg := &NetConf{DataDir: dataDir, VDPA: &VDPAConfig{MgmtDev: "pci/" + mgmtDev, Driver: "vhost_vdpa"}}
+		devPath, err := attachVdpa(cfg, "dummy", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devPath).To(Equal("/dev/vhost-vdpa-0"))
+
+		findVdpa := func(c *VDPAConfig) (string, error) {
+			store, err := attachments.Open(dataDir)
+			Expect(err).NotTo(HaveOccurred())
+			defer store.Close()
+			return findVdpaDevice(store, c)
+		}
+
+		name, err := findVdpa(cfg.VDPA)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("vdpa1"))
+
+		_, err = attachVdpa(cfg, "dummy", "net2")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = findVdpa(cfg.VDPA)
+		Expect(err).To(MatchError("no unused vDPA device on pci/" + mgmtDev))
+
+		name, err = findVdpa(&VDPAConfig{MgmtDev: "vdpasim_net"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("vdpa2"))
+	})
+
+	It("moves the interface of a device bound to virtio_vdpa", func() {
+		cfg := &NetConf{DataDir: dataDir, VDPA: &VDPAConfig{Name: "vdpa1", Driver: "virtio_vdpa"}}
+		devPath, err := attachVdpa(cfg, "dummy", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devPath).To(BeEmpty())
+		Expect(cfg.Device).To(Equal("eth-vdpa1"))
+		Expect(vdpaDriver("vdpa1")).To(Equal("virtio_vdpa"))
+
+		// vdpa1 was not bound to any driver
+		Expect(restoreVdpaDriver(dataDir, "dummy", "net1")).To(Succeed())
+		Expect(vdpaDriver("vdpa1")).To(BeEmpty())
+	})
+
+	It("requires a driver for an unbound device", func() {
+		cfg := &NetConf{DataDir: dataDir, VDPA: &VDPAConfig{Name: "vdpa1"}}
+		_, err := attachVdpa(cfg, "dummy", "net1")
+		Expect(err).To(MatchError(`vDPA device vdpa1 is bound to "", set the vdpa "driver"`))
+		Expect(hasRecord(dataDir, vdpaGroup, "dummy", "net1")).To(BeFalse())
+	})
+
+	It("validates the configuration", func() {
+		Expect((&VDPAConfig{}).validate()).To(MatchError(`vdpa: specify either "name" or "mgmtDev"`))
+		Expect((&VDPAConfig{Name: "vdpa0", MgmtDev: "vdpasim_net"}).validate()).To(HaveOccurred())
+		Expect((&VDPAConfig{Name: "vdpa0", Driver: "vfio"}).validate()).To(MatchError(`vdpa: invalid driver "vfio", must be "virtio_vdpa" or "vhost_vdpa"`))
+	})
+})
+
+var _ = Describe("udev properties selection", func() {
+	var targetNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("selects the device matching all the udev properties", func() {
+		err := targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: "eno1"},
+				PeerName:  "eno2",
+			})).To(Succeed())
+			eno1, err := netlinksafe.LinkByName("eno1")
+			Expect(err).NotTo(HaveOccurred())
+			eno2, err := netlinksafe.LinkByName("eno2")
+			Expect(err).NotTo(HaveOccurred())
+
+			fs := &fakeFilesystem{
+				dirs: []string{"run/udev/data"},
+				files: map[string]string{
+					fmt.Sprintf("run/udev/data/n%d", eno1.Attrs().Index): "I:1234\nE:ID_PATH=pci-0000:00:1f.6\nE:ID_NET_NAME_ONBOARD=eno1\nG:systemd\n",
+					fmt.Sprintf("run/udev/data/n%d", eno2.Attrs().Index): "I:1235\nE:ID_PATH=pci-0000:00:1f.6\nE:ID_NET_NAME_ONBOARD=eno2\n",
+				},
+			}
+			defer fs.use()()
+
+			conf := func(props string) []byte {
+				return []byte(fmt.Sprintf(`{
+					"cniVersion": "1.0.0",
+					"name": "cni-plugin-host-device-test",
+					"type": "host-device",
+					"udevProperties": %s
+				}`, props))
+			}
+
+			cfg, err := loadConf(conf(`{"ID_PATH": "pci-0000:00:1f.6", "ID_NET_NAME_ONBOARD": "eno2"}`), "ADD")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Device).To(Equal("eno2"))
+
+			_, err = loadConf(conf(`{"ID_PATH": "pci-0000:00:1f.6"}`), "ADD")
+			Expect(err).To(MatchError("several devices match udev properties map[ID_PATH:pci-0000:00:1f.6]: eno1, eno2"))
+
+			_, err = loadConf(conf(`{"ID_NET_NAME_ONBOARD": "eno3"}`), "ADD")
+			Expect(err).To(MatchError("no device matches udev properties map[ID_NET_NAME_ONBOARD:eno3]"))
+
+			// The device is in the container after ADD
+			cfg, err = loadConf(conf(`{"ID_NET_NAME_ONBOARD": "eno3"}`), "DEL")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Device).To(BeEmpty())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("host IP configuration", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device-ip")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("restores the addresses and routes of the device on DEL", func() {
+		const uplink = "uplink0"
+		_, dst, _ := net.ParseCIDR("198.51.100.0/24")
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: uplink},
+				PeerName:  "uplink-peer",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(uplink)
+			Expect(err).NotTo(HaveOccurred())
+			addr, err := netlink.ParseAddr("192.0.2.10/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			Expect(netlink.RouteAdd(&netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       dst,
+				Gw:        net.ParseIP("192.0.2.1"),
+			})).To(Succeed())
+
+			conf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-host-device-test",
+				"type": "host-device",
+				"device": %q,
+				"dataDir": %q
+			}`, uplink, dataDir)
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   []byte(conf),
+			}
+			_, _, err = testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hasRecord(dataDir, ipGroup, "dummy", "net1")).To(BeTrue())
+
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hasRecord(dataDir, ipGroup, "dummy", "net1")).To(BeFalse())
+
+			link, err = netlinksafe.LinkByName(uplink)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+			addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(1))
+			Expect(addrs[0].IPNet.String()).To(Equal("192.0.2.10/24"))
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       dst,
+			}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Gw.String()).To(Equal("192.0.2.1"))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("link settings", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device-link")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("applies the MTU and modes in the container and restores them on DEL", func() {
+		const uplink = "uplink0"
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: uplink, MTU: 1500},
+				PeerName:  "uplink-peer",
+			})).To(Succeed())
+
+			conf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-host-device-test",
+				"type": "host-device",
+				"device": %q,
+				"dataDir": %q,
+				"mtu": 1400,
+				"promisc": true,
+				"allmulti": true
+			}`, uplink, dataDir)
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   []byte(conf),
+			}
+			r, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hasRecord(dataDir, linkGroup, "dummy", "net1")).To(BeTrue())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName("net1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Attrs().MTU).To(Equal(1400))
+				Expect(link.Attrs().RawFlags & unix.IFF_PROMISC).NotTo(BeZero())
+				Expect(link.Attrs().RawFlags & unix.IFF_ALLMULTI).NotTo(BeZero())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			checkConf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-host-device-test",
+				"type": "host-device",
+				"device": %q,
+				"dataDir": %q,
+				"mtu": %%d,
+				"prevResult": {
+					"cniVersion": "1.0.0",
+					"interfaces": [{"name": "net1", "mac": %q, "sandbox": %q}]
+				}
+			}`, uplink, dataDir, result.Interfaces[0].Mac, targetNS.Path())
+			args.StdinData = []byte(fmt.Sprintf(checkConf, 1400))
+			Expect(testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })).To(Succeed())
+			args.StdinData = []byte(fmt.Sprintf(checkConf, 1300))
+			err = testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+			Expect(err).To(MatchError("interface net1 MTU 1400 doesn't match the configured 1300"))
+
+			args.StdinData = []byte(conf)
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hasRecord(dataDir, linkGroup, "dummy", "net1")).To(BeFalse())
+
+			link, err := netlinksafe.LinkByName(uplink)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().MTU).To(Equal(1500))
+			Expect(link.Attrs().RawFlags & unix.IFF_PROMISC).To(BeZero())
+			Expect(link.Attrs().RawFlags & unix.IFF_ALLMULTI).To(BeZero())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects an invalid MTU", func() {
+		_, err := loadConf([]byte(`{"name": "mynet", "device": "eth0", "mtu": -1}`), "ADD")
+		Expect(err).To(MatchError("invalid mtu -1"))
+	})
+})
+
+var _ = Describe("garbage collection", func() {
+	const uplink = "uplink0"
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device-gc")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: uplink},
+				PeerName:  "uplink-peer",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(uplink)
+			Expect(err).NotTo(HaveOccurred())
+			addr, err := netlink.ParseAddr("10.1.2.3/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+	})
+
+	conf := func() []byte {
+		return []byte(fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"device": %q,
+			"dataDir": %q
+		}`, uplink, dataDir))
+	}
+	gcConf := func(valid string) []byte {
+		return []byte(fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"dataDir": %q,
+			"cni.dev/valid-attachments": [%s]
+		}`, dataDir, valid))
+	}
+	expectRestored := func() {
+		link, err := netlinksafe.LinkByName(uplink)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link.Attrs().Alias).To(BeEmpty())
+		addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_V4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addrs).To(HaveLen(1))
+		Expect(addrs[0].IPNet.String()).To(Equal("10.1.2.3/24"))
+		Expect(hasRecord(dataDir, attachmentsGroup, "dummy", "net1")).To(BeFalse())
+	}
+
+	It("moves the devices of the stale attachments out of their namespace", func() {
+		defer func() {
+			Expect(targetNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+		}()
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   conf(),
+			}
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hasRecord(dataDir, attachmentsGroup, "dummy", "net1")).To(BeTrue())
+
+			// The attachment is still valid
+			Expect(cmdGC(&skel.CmdArgs{
+				StdinData: gcConf(`{"containerID": "dummy", "ifname": "net1"}`),
+			})).To(Succeed())
+			_, err = netlinksafe.LinkByName(uplink)
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+
+			// The attachments of the other networks are left alone
+			other := &skel.CmdArgs{StdinData: []byte(strings.Replace(string(gcConf("")),
+				"cni-plugin-host-device-test", "other-network", 1))}
+			Expect(cmdGC(other)).To(Succeed())
+			Expect(hasRecord(dataDir, attachmentsGroup, "dummy", "net1")).To(BeTrue())
+
+			Expect(cmdGC(&skel.CmdArgs{StdinData: gcConf("")})).To(Succeed())
+			expectRestored()
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := netlinksafe.LinkByName("net1")
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("renames the devices returned to the host with a dead namespace", func() {
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   conf(),
+			}
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+
+			// Return the device as the kernel does when the namespace is
+			// destroyed, with its name in the container
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName("net1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.LinkSetDown(link)).To(Succeed())
+				Expect(netlink.LinkSetNsFd(link, int(originalNS.Fd()))).To(Succeed())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targetNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+
+			Expect(cmdGC(&skel.CmdArgs{StdinData: gcConf("")})).To(Succeed())
+			expectRestored()
+			_, err = netlinksafe.LinkByName("net1")
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("forgets the attachment on DEL", func() {
+		defer func() {
+			Expect(targetNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+		}()
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   conf(),
+			}
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+			expectRestored()
+
+			attachments, err := listAttachments(dataDir, "cni-plugin-host-device-test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attachments).To(BeEmpty())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("multiple devices", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "host-device-multi")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			for _, name := range []string{"deva", "devb"} {
+				Expect(netlink.LinkAdd(&netlink.Veth{
+					LinkAttrs: netlink.LinkAttrs{Name: name},
+					PeerName:  name + "-peer",
+				})).To(Succeed())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("moves all the devices in one ADD and back on DEL", func() {
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			devb, err := netlinksafe.LinkByName("devb")
+			Expect(err).NotTo(HaveOccurred())
+			conf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-host-device-test",
+				"type": "host-device",
+				"devices": [{"device": "deva"}, {"hwaddr": %q}],
+				"dataDir": %q
+			}`, devb.Attrs().HardwareAddr, dataDir)
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   []byte(conf),
+			}
+			r, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces).To(HaveLen(2))
+			Expect(result.Interfaces[0].Name).To(Equal("net1"))
+			Expect(result.Interfaces[1].Name).To(Equal("net11"))
+			Expect(result.Interfaces[1].Mac).To(Equal(devb.Attrs().HardwareAddr.String()))
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				for _, name := range []string{"net1", "net11"} {
+					_, err := netlinksafe.LinkByName(name)
+					Expect(err).NotTo(HaveOccurred())
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			prevResult, err := json.Marshal(result)
+			Expect(err).NotTo(HaveOccurred())
+			checkConf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-host-device-test",
+				"type": "host-device",
+				"devices": [{"device": "deva"}, {"hwaddr": %q}],
+				"dataDir": %q,
+				"prevResult": %s
+			}`, devb.Attrs().HardwareAddr, dataDir, prevResult)
+			checkArgs := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   []byte(checkConf),
+			}
+			err = testutils.CmdCheckWithArgs(checkArgs, func() error { return cmdCheck(checkArgs) })
+			Expect(err).NotTo(HaveOccurred())
+
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+			for _, name := range []string{"deva", "devb"} {
+				_, err := netlinksafe.LinkByName(name)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("moves none of the devices when one is missing", func() {
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			conf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-host-device-test",
+				"type": "host-device",
+				"devices": [{"device": "deva"}, {"device": "devc"}],
+				"ifNameTemplate": "{ifname}-{index}",
+				"dataDir": %q
+			}`, dataDir)
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      "net1",
+				Netns:       targetNS.Path(),
+				StdinData:   []byte(conf),
+			}
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).To(MatchError(ContainSubstring("failed to find host device devc")))
+			_, err = netlinksafe.LinkByName("deva")
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("validates the devices", func() {
+		_, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "host-device", "device": "eth0", "devices": [{"device": "eth1"}]}`), "ADD")
+		Expect(err).To(MatchError(`"devices" can't be combined with another way to select the device`))
+		_, err = loadConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "host-device", "devices": [{"device": "eth1"}, {}]}`), "ADD")
+		Expect(err).To(MatchError(`device 1: specify either "device", "hwaddr" or "pciBusID"`))
+		_, err = loadConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "host-device", "devices": [{"device": "eth0"}, {"device": "eth1"}], "ifNameTemplate": "{ifname}"}`), "ADD")
+		Expect(err).To(MatchError(`"ifNameTemplate" "{ifname}" must contain {index} to name several devices`))
+
+		cfg, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "host-device", "devices": [{"device": "eth0"}, {"device": "eth1"}], "ifNameTemplate": "{ifname}-{index}"}`), "ADD")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deviceIfNames(cfg, "net1")).To(Equal([]string{"net1-0", "net1-1"}))
+	})
+})
+
+var _ = Describe("RDMA devices", func() {
+	It("finds the RDMA device of a network device", func() {
+		fs := &fakeFilesystem{
+			dirs: []string{
+				"sys/devices/pci0000:00/0000:00:00.1/infiniband/mlx5_0",
+				"sys/devices/pci0000:00/0000:00:00.1/net/ens1f0",
+				"sys/devices/pci0000:00/0000:00:00.2/net/ens1f1",
+				"sys/class/net",
+			},
+			symlinks: map[string]string{
+				"sys/class/net/ens1f0": "../../devices/pci0000:00/0000:00:00.1/net/ens1f0",
+				"sys/class/net/ens1f1": "../../devices/pci0000:00/0000:00:00.2/net/ens1f1",
+				"sys/devices/pci0000:00/0000:00:00.1/net/ens1f0/device": "../../../0000:00:00.1",
+				"sys/devices/pci0000:00/0000:00:00.2/net/ens1f1/device": "../../../0000:00:00.2",
+			},
+		}
+		defer fs.use()()
+
+		Expect(rdmaDeviceOf("ens1f0")).To(Equal("mlx5_0"))
+		Expect(rdmaDeviceOf("ens1f1")).To(BeEmpty())
+	})
+
+	It("does nothing on DEL when no RDMA device was moved", func() {
+		dataDir, err := os.MkdirTemp("", "host-device-rdma")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dataDir)
+		Expect(moveRdmaOut(dataDir, nil, "dummy", "net1")).To(Succeed())
+	})
+})
+
+var _ = Describe("SR-IOV VF allocation", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		fs := &fakeFilesystem{
+			dirs: []string{
+				"sys/bus/pci/devices/0000:00:01.1/net/nonexistent0",
+				"sys/bus/pci/devices/0000:00:01.2/net/lo",
+				"sys/bus/pci/devices/0000:00:01.3/net/lo",
+				"sys/class/net/pf0/device",
+				"sys/class/net/lo",
+			},
+			symlinks: map[string]string{
+				"sys/class/net/pf0/device/virtfn0": "../../../../bus/pci/devices/0000:00:01.1",
+				"sys/class/net/pf0/device/virtfn1": "../../../../bus/pci/devices/0000:00:01.2",
+				"sys/class/net/pf0/device/virtfn2": "../../../../bus/pci/devices/0000:00:01.3",
+			},
+		}
+		DeferCleanup(fs.use())
+
+		var err error
+		dataDir, err = os.MkdirTemp("", "host-device-vf")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dataDir)
+	})
+
+	It("releases the VF on DEL", func() {
+		vf, pciAddr, err := sriov.ReserveVF("pf0", nil, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(1))
+		Expect(putRecord(dataDir, vfsGroup, "container1", "net1", &vfAllocation{PF: "pf0", VF: vf, PCIAddr: pciAddr})).To(Succeed())
+
+		_, _, err = sriov.ReserveVF("pf0", nil, "container2", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = sriov.ReserveVF("pf0", nil, "container3", "net1")
+		Expect(err).To(MatchError(`no free VF on "pf0"`))
+
+		Expect(releaseVF(dataDir, "container1", "net1")).To(Succeed())
+		Expect(hasRecord(dataDir, vfsGroup, "container1", "net1")).To(BeFalse())
+		Expect(releaseVF(dataDir, "container1", "net1")).To(Succeed())
+
+		vf, _, err = sriov.ReserveVF("pf0", nil, "container3", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(1))
+	})
+
+	It("validates the VF configuration", func() {
+		conf := []byte(`{
+			"cniVersion": "1.0.0",
+			"name": "cni-plugin-host-device-test",
+			"type": "host-device",
+			"pfName": "pf0",
+			"vf": {"mac": "02:00:00:00:00:01", "vlan": 100, "spoofchk": false}
+		}`)
+		cfg, err := loadConf(conf, "ADD")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.PFName).To(Equal("pf0"))
+		Expect(*cfg.VF.VLAN).To(Equal(100))
+
+		_, err = loadConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "host-device", "pfName": "pf0", "vf": {"vlan": 4095}}`), "ADD")
+		Expect(err).To(MatchError("invalid VF VLAN 4095, must be between 0 and 4094"))
+		_, err = loadConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "host-device", "device": "eth0", "vf": {"vlan": 10}}`), "ADD")
+		Expect(err).To(MatchError(`"vf" requires "pfName"`))
+	})
+})
+
+var _ = Describe("hot-plugged devices", func() {
+	BeforeEach(func() {
+		interval := devicePollInterval
+		devicePollInterval = 10 * time.Millisecond
+		DeferCleanup(func() { devicePollInterval = interval })
+	})
+
+	It("looks the device up until it shows up", func() {
+		calls := 0
+		err := waitForDevice(time.Second, func() error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("not yet")
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal(3))
+	})
+
+	It("fails with the last error once the timeout expires", func() {
+		start := time.Now()
+		_, err := waitForLink(&NetConf{Device: "hotplug0", DeviceWaitTimeoutMs: 50})
+		Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("does not wait by default", func() {
+		calls := 0
+		err := waitForDevice((&NetConf{}).deviceWaitTimeout(), func() error {
+			calls++
+			return fmt.Errorf("not found")
+		})
+		Expect(err).To(MatchError("not found"))
+		Expect(calls).To(Equal(1))
+	})
+})
+
+// hasRecord reports whether the attachment has a record in the group
+func hasRecord(dataDir, group, containerID, ifName string) bool {
+	var v interface{}
+	found, err := getRecord(dataDir, group, containerID, ifName, &v)
+	Expect(err).NotTo(HaveOccurred())
+	return found
+}
+
 type fakeFilesystem struct {
 	rootDir  string
 	dirs     []string
+	files    map[string]string
 	symlinks map[string]string
 }
 
@@ -1371,6 +2592,13 @@ func (fs *fakeFilesystem) use() func() {
 		}
 	}
 
+	for file, content := range fs.files {
+		err = os.WriteFile(path.Join(fs.rootDir, file), []byte(content), 0o644)
+		if err != nil {
+			panic(fmt.Errorf("error creating fake file: %s", err.Error()))
+		}
+	}
+
 	for link, target := range fs.symlinks {
 		err = os.Symlink(target, path.Join(fs.rootDir, link))
 		if err != nil {
@@ -1380,6 +2608,12 @@ func (fs *fakeFilesystem) use() func() {
 
 	sysBusPCI = path.Join(fs.rootDir, "/sys/bus/pci/devices")
 	sysBusAuxiliary = path.Join(fs.rootDir, "/sys/bus/auxiliary/devices")
+	udevDataDir = path.Join(fs.rootDir, "/run/udev/data")
+	sysClassNet = path.Join(fs.rootDir, "/sys/class/net")
+	sysBusVdpa = path.Join(fs.rootDir, "/sys/bus/vdpa")
+	sriov.SysBusPCI = sysBusPCI
+	sriov.SysClassNet = sysClassNet
+	sriov.ReservationDir = path.Join(fs.rootDir, "/run/cni/vf-reservations")
 
 	return func() {
 		// remove temporary fake fs
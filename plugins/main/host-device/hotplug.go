@@ -0,0 +1,54 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// devicePollInterval is how often a hot-plugged device is looked up again
+var devicePollInterval = 100 * time.Millisecond
+
+// deviceWaitTimeout returns how long ADD waits for the device to show up
+func (n *NetConf) deviceWaitTimeout() time.Duration {
+	return time.Duration(n.DeviceWaitTimeoutMs) * time.Millisecond
+}
+
+// waitForDevice calls lookup until it succeeds or the timeout expires, and
+// returns the last error. A hot-plugged device may show up after the ADD
+// call, or under a transient name until udev renames it.
+func waitForDevice(timeout time.Duration, lookup func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := lookup()
+		if err == nil || !time.Now().Before(deadline) {
+			return err
+		}
+		time.Sleep(min(devicePollInterval, time.Until(deadline)))
+	}
+}
+
+// waitForLink is getLink waiting for the device to show up
+func waitForLink(cfg *NetConf) (netlink.Link, error) {
+	var link netlink.Link
+	err := waitForDevice(cfg.deviceWaitTimeout(), func() error {
+		var err error
+		link, err = getLink(cfg.Device, cfg.HWAddr, cfg.KernelPath, cfg.PCIAddr, cfg.auxDevice)
+		return err
+	})
+	return link, err
+}
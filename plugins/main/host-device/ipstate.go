@@ -0,0 +1,182 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// ipState is the IP configuration of a host device before it was moved to
+// the container, moving a device to another namespace flushes it
+type ipState struct {
+	Device    string       `json:"device"`
+	Up        bool         `json:"up,omitempty"`
+	Addresses []savedAddr  `json:"addresses,omitempty"`
+	Routes    []savedRoute `json:"routes,omitempty"`
+}
+
+type savedAddr struct {
+	Address string `json:"address"`
+	Flags   int    `json:"flags,omitempty"`
+}
+
+type savedRoute struct {
+	Family   int    `json:"family"`
+	Dst      string `json:"dst,omitempty"`
+	Gw       string `json:"gw,omitempty"`
+	Src      string `json:"src,omitempty"`
+	Table    int    `json:"table,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	Scope    uint8  `json:"scope,omitempty"`
+	Protocol int    `json:"protocol,omitempty"`
+}
+
+// ipGroup is the group of the IP configurations in the attachment store
+const ipGroup = "ip"
+
+// saveIPState records the addresses and routes of the device. Link-local
+// addresses and the routes the kernel derives from the addresses are left
+// out, they come back with the addresses. Nothing is recorded for a device
+// without IP configuration.
+func saveIPState(dataDir, containerID, ifName string, dev netlink.Link) error {
+	devName := dev.Attrs().Name
+	state := &ipState{
+		Device: devName,
+		Up:     dev.Attrs().Flags&net.FlagUp != 0,
+	}
+
+	addrs, err := netlinksafe.AddrList(dev, netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list addresses of %q: %v", devName, err)
+	}
+	for _, addr := range addrs {
+		if addr.Scope == unix.RT_SCOPE_LINK {
+			continue
+		}
+		state.Addresses = append(state.Addresses, savedAddr{Address: addr.IPNet.String(), Flags: addr.Flags})
+	}
+
+	routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{
+		LinkIndex: dev.Attrs().Index,
+		Table:     unix.RT_TABLE_UNSPEC,
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of %q: %v", devName, err)
+	}
+	for _, r := range routes {
+		if r.Protocol == unix.RTPROT_KERNEL || r.Table == unix.RT_TABLE_LOCAL || r.Type != unix.RTN_UNICAST {
+			continue
+		}
+		// IPv6 routes to multicast and link-local prefixes are added by
+		// the kernel with the link
+		if r.Dst != nil && (r.Dst.IP.IsLinkLocalUnicast() || r.Dst.IP.IsMulticast()) {
+			continue
+		}
+		saved := savedRoute{
+			Family:   r.Family,
+			Table:    r.Table,
+			Priority: r.Priority,
+			Scope:    uint8(r.Scope),
+			Protocol: int(r.Protocol),
+		}
+		if r.Dst != nil {
+			saved.Dst = r.Dst.String()
+		}
+		if r.Gw != nil {
+			saved.Gw = r.Gw.String()
+		}
+		if r.Src != nil {
+			saved.Src = r.Src.String()
+		}
+		state.Routes = append(state.Routes, saved)
+	}
+
+	if len(state.Addresses) == 0 && len(state.Routes) == 0 {
+		return nil
+	}
+
+	if err := putRecord(dataDir, ipGroup, containerID, ifName, state); err != nil {
+		return fmt.Errorf("failed to record IP configuration of %q: %v", devName, err)
+	}
+	return nil
+}
+
+// restoreIPState applies the IP configuration recorded at ADD time to the
+// device moved back to the host. A missing record means there is nothing
+// to restore, and the device is left down.
+func restoreIPState(dataDir, containerID, ifName string) error {
+	state := &ipState{}
+	found, err := getRecord(dataDir, ipGroup, containerID, ifName, state)
+	if err != nil || !found {
+		return err
+	}
+
+	dev, err := netlinksafe.LinkByName(state.Device)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", state.Device, err)
+	}
+
+	var errs []error
+	for _, a := range state.Addresses {
+		addr, err := netlink.ParseAddr(a.Address)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		addr.Flags = a.Flags
+		if err := netlink.AddrReplace(dev, addr); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore address %s on %q: %v", a.Address, state.Device, err))
+		}
+	}
+
+	if state.Up {
+		if err := netlink.LinkSetUp(dev); err != nil {
+			return errors.Join(append(errs, fmt.Errorf("failed to set %q up: %v", state.Device, err))...)
+		}
+	}
+
+	for _, r := range state.Routes {
+		route := &netlink.Route{
+			LinkIndex: dev.Attrs().Index,
+			Family:    r.Family,
+			Table:     r.Table,
+			Priority:  r.Priority,
+			Scope:     netlink.Scope(r.Scope),
+			Protocol:  netlink.RouteProtocol(r.Protocol),
+			Gw:        net.ParseIP(r.Gw),
+			Src:       net.ParseIP(r.Src),
+		}
+		if r.Dst != "" {
+			if _, route.Dst, err = net.ParseCIDR(r.Dst); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if err := netlink.RouteReplace(route); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore route %s on %q: %v", route, state.Device, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return removeRecord(dataDir, ipGroup, containerID, ifName)
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// linkState is the MTU and the promiscuous and all-multicast modes of a
+// host device before they were changed in the container
+type linkState struct {
+	Device   string `json:"device"`
+	MTU      int    `json:"mtu"`
+	Promisc  bool   `json:"promisc"`
+	AllMulti bool   `json:"allmulti"`
+}
+
+// linkGroup is the group of the link settings in the attachment store
+const linkGroup = "link"
+
+func hasLinkSettings(cfg *NetConf) bool {
+	return cfg.MTU != 0 || cfg.Promisc != nil || cfg.AllMulti != nil
+}
+
+func linkStateOf(dev netlink.Link) *linkState {
+	return &linkState{
+		Device:   dev.Attrs().Name,
+		MTU:      dev.Attrs().MTU,
+		Promisc:  dev.Attrs().RawFlags&unix.IFF_PROMISC != 0,
+		AllMulti: dev.Attrs().RawFlags&unix.IFF_ALLMULTI != 0,
+	}
+}
+
+// setLinkState changes the MTU and the modes of the device which differ
+// from the wanted ones
+func setLinkState(dev netlink.Link, mtu int, promisc, allMulti *bool) error {
+	name := dev.Attrs().Name
+	cur := linkStateOf(dev)
+	if mtu != 0 && mtu != cur.MTU {
+		if err := netlink.LinkSetMTU(dev, mtu); err != nil {
+			return fmt.Errorf("failed to set MTU of %q to %d: %v", name, mtu, err)
+		}
+	}
+	if promisc != nil && *promisc != cur.Promisc {
+		var err error
+		if *promisc {
+			err = netlink.SetPromiscOn(dev)
+		} else {
+			err = netlink.SetPromiscOff(dev)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set promiscuous mode of %q: %v", name, err)
+		}
+	}
+	if allMulti != nil && *allMulti != cur.AllMulti {
+		var err error
+		if *allMulti {
+			err = netlink.LinkSetAllmulticastOn(dev)
+		} else {
+			err = netlink.LinkSetAllmulticastOff(dev)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set all-multicast mode of %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// applyLinkSettings sets the configured MTU and modes on the device moved
+// to the container as ifName, once its host values are recorded from
+// hostDev. Nothing is recorded without settings.
+func applyLinkSettings(cfg *NetConf, hostDev netlink.Link, containerNs ns.NetNS, containerID, ifName string) error {
+	if !hasLinkSettings(cfg) {
+		return nil
+	}
+	orig := linkStateOf(hostDev)
+	if err := putRecord(cfg.DataDir, linkGroup, containerID, ifName, orig); err != nil {
+		return fmt.Errorf("failed to record link settings of %q: %v", orig.Device, err)
+	}
+
+	err := containerNs.Do(func(_ ns.NetNS) error {
+		dev, err := netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to find %q in container NS: %v", ifName, err)
+		}
+		if err := setLinkState(dev, cfg.MTU, cfg.Promisc, cfg.AllMulti); err != nil {
+			// Undo the settings applied before the failure
+			if dev, lerr := netlinksafe.LinkByName(ifName); lerr == nil {
+				_ = setLinkState(dev, orig.MTU, &orig.Promisc, &orig.AllMulti)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		_ = removeRecord(cfg.DataDir, linkGroup, containerID, ifName)
+		return err
+	}
+	return nil
+}
+
+// restoreLinkSettings sets the MTU and modes recorded at ADD time back on
+// the device moved back to the host. A missing record means they were not
+// changed.
+func restoreLinkSettings(dataDir, containerID, ifName string) error {
+	state := &linkState{}
+	found, err := getRecord(dataDir, linkGroup, containerID, ifName, state)
+	if err != nil || !found {
+		return err
+	}
+
+	dev, err := netlinksafe.LinkByName(state.Device)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", state.Device, err)
+	}
+	if err := setLinkState(dev, state.MTU, &state.Promisc, &state.AllMulti); err != nil {
+		return err
+	}
+	return removeRecord(dataDir, linkGroup, containerID, ifName)
+}
+
+// checkLinkSettings verifies the configured MTU and modes of the device
+// named ifName in the current namespace
+func checkLinkSettings(cfg *NetConf, ifName string) error {
+	dev, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	cur := linkStateOf(dev)
+	if cfg.MTU != 0 && cfg.MTU != cur.MTU {
+		return fmt.Errorf("interface %s MTU %d doesn't match the configured %d", ifName, cur.MTU, cfg.MTU)
+	}
+	if cfg.Promisc != nil && *cfg.Promisc != cur.Promisc {
+		return fmt.Errorf("interface %s promiscuous mode is %t, configured %t", ifName, cur.Promisc, *cfg.Promisc)
+	}
+	if cfg.AllMulti != nil && *cfg.AllMulti != cur.AllMulti {
+		return fmt.Errorf("interface %s all-multicast mode is %t, configured %t", ifName, cur.AllMulti, *cfg.AllMulti)
+	}
+	return nil
+}
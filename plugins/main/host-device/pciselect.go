@@ -0,0 +1,103 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pciSelector matches PCI devices by vendor and device ID, either of which
+// may be a "*" wildcard
+type pciSelector struct {
+	vendor string
+	device string
+}
+
+func parsePCISelector(s string) (*pciSelector, error) {
+	vendor, device, found := strings.Cut(strings.ToLower(s), ":")
+	if !found || vendor == "" || device == "" {
+		return nil, fmt.Errorf("invalid pciVendorDevice %q, must be <vendor>:<device>", s)
+	}
+	for _, id := range []string{vendor, device} {
+		if id == "*" {
+			continue
+		}
+		if len(id) != 4 || strings.Trim(id, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("invalid pciVendorDevice %q, IDs must be 4 hex digits or *", s)
+		}
+	}
+	return &pciSelector{vendor: vendor, device: device}, nil
+}
+
+func (p *pciSelector) matches(pciAddr string) bool {
+	for _, id := range []struct{ file, want string }{{"vendor", p.vendor}, {"device", p.device}} {
+		if id.want == "*" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(sysBusPCI, pciAddr, id.file))
+		if err != nil {
+			return false
+		}
+		if strings.TrimPrefix(strings.TrimSpace(string(data)), "0x") != id.want {
+			return false
+		}
+	}
+	return true
+}
+
+// selectPCIDevice returns the PCI address of the index-th device matching
+// the selector, in PCI address order. Without an index, it returns the first
+// matching device with a network interface in the current namespace, i.e.
+// not moved to a container yet, or any matching device if unusedOnly is not
+// set.
+func selectPCIDevice(selector string, index *int, unusedOnly bool) (string, error) {
+	p, err := parsePCISelector(selector)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(sysBusPCI)
+	if err != nil {
+		return "", fmt.Errorf("failed to list PCI devices: %v", err)
+	}
+
+	var matches []string
+	for _, e := range entries {
+		if p.matches(e.Name()) {
+			matches = append(matches, e.Name())
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no PCI device matches %q", selector)
+	}
+
+	if index != nil {
+		if *index < 0 || *index >= len(matches) {
+			return "", fmt.Errorf("pciDeviceIndex %d out of range, %d PCI devices match %q", *index, len(matches), selector)
+		}
+		return matches[*index], nil
+	}
+	if !unusedOnly {
+		return matches[0], nil
+	}
+	for _, pciAddr := range matches {
+		if _, err := getLink("", "", "", pciAddr, ""); err == nil {
+			return pciAddr, nil
+		}
+	}
+	return "", fmt.Errorf("all the PCI devices matching %q are in use", selector)
+}
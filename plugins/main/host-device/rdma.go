@@ -0,0 +1,110 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+var sysClassNet = "/sys/class/net"
+
+// rdmaMove records the RDMA device moved to the container along with the
+// network device, so that DEL can move it back
+type rdmaMove struct {
+	Device string `json:"device"`
+}
+
+// rdmaGroup is the group of the RDMA device moves in the attachment store
+const rdmaGroup = "rdma"
+
+// rdmaDeviceOf returns the RDMA device of the network device, such as the
+// mlx5_0 of a ConnectX port, or an empty string when it has none
+func rdmaDeviceOf(netdev string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(sysClassNet, netdev, "device", "infiniband"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to find RDMA device of %q: %v", netdev, err)
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	return entries[0].Name(), nil
+}
+
+// moveRdmaIn moves the RDMA device to the container. RDMA devices can only
+// be moved when the RDMA subsystem is in exclusive netns mode, in shared
+// mode they are visible from all the namespaces.
+func moveRdmaIn(dataDir, rdmaDev string, containerNs ns.NetNS, containerID, ifName string) error {
+	if rdmaDev == "" {
+		return nil
+	}
+	mode, err := netlink.RdmaSystemGetNetnsMode()
+	if err != nil {
+		return fmt.Errorf("failed to get RDMA netns mode: %v", err)
+	}
+	if mode != "exclusive" {
+		return nil
+	}
+	link, err := netlinksafe.RdmaLinkByName(rdmaDev)
+	if err != nil {
+		return fmt.Errorf("failed to find RDMA device %q: %v", rdmaDev, err)
+	}
+
+	if err := putRecord(dataDir, rdmaGroup, containerID, ifName, &rdmaMove{Device: rdmaDev}); err != nil {
+		return fmt.Errorf("failed to record RDMA device %q: %v", rdmaDev, err)
+	}
+
+	if err := netlink.RdmaLinkSetNsFd(link, uint32(containerNs.Fd())); err != nil {
+		_ = removeRecord(dataDir, rdmaGroup, containerID, ifName)
+		return fmt.Errorf("failed to move RDMA device %q to container: %v", rdmaDev, err)
+	}
+	return nil
+}
+
+// moveRdmaOut moves the RDMA device recorded at ADD time back to the host.
+// A missing record means no RDMA device was moved.
+func moveRdmaOut(dataDir string, containerNs ns.NetNS, containerID, ifName string) error {
+	m := &rdmaMove{}
+	found, err := getRecord(dataDir, rdmaGroup, containerID, ifName, m)
+	if err != nil || !found {
+		return err
+	}
+
+	err = containerNs.Do(func(hostNS ns.NetNS) error {
+		link, err := netlinksafe.RdmaLinkByName(m.Device)
+		if err != nil {
+			// The device went back to the host with the namespace
+			return nil
+		}
+		if err := netlink.RdmaLinkSetNsFd(link, uint32(hostNS.Fd())); err != nil {
+			return fmt.Errorf("failed to move RDMA device %q to host: %v", m.Device, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return removeRecord(dataDir, rdmaGroup, containerID, ifName)
+}
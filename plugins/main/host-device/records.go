@@ -0,0 +1,67 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+// The records of an attachment, such as the settings a device had before
+// ADD, are kept in the attachment store of the data directory, in a group
+// per kind of record. putRecord, getRecord and removeRecord hold the lock
+// of the store for the record only.
+
+func putRecord(dataDir, group, containerID, ifName string, v interface{}) error {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.PutJSON(group, attachments.ID(containerID, ifName), v)
+}
+
+// getRecord decodes the record of the attachment into v, and reports
+// whether there is one
+func getRecord(dataDir, group, containerID, ifName string, v interface{}) (bool, error) {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return false, err
+	}
+	defer store.Close()
+
+	found, err := store.GetJSON(group, attachments.ID(containerID, ifName), v)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s record of %s/%s: %v", group, containerID, ifName, err)
+	}
+	return found, nil
+}
+
+// removeRecord drops the record of the attachment. A missing record is
+// not an error.
+func removeRecord(dataDir, group, containerID, ifName string) error {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if _, err := store.Remove(group, attachments.ID(containerID, ifName)); err != nil {
+		return fmt.Errorf("failed to remove %s record of %s/%s: %v", group, containerID, ifName, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/sriov"
+)
+
+// vfsGroup is the group of the VF allocations in the attachment store
+const vfsGroup = "vf"
+
+// VFConfig is the configuration of the allocated VF set through its PF
+type VFConfig struct {
+	MAC      string `json:"mac,omitempty"`
+	VLAN     *int   `json:"vlan,omitempty"`
+	SpoofChk *bool  `json:"spoofchk,omitempty"`
+}
+
+func (c *VFConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.MAC != "" {
+		if _, err := net.ParseMAC(c.MAC); err != nil {
+			return fmt.Errorf("invalid VF MAC address %q: %v", c.MAC, err)
+		}
+	}
+	if c.VLAN != nil && (*c.VLAN < 0 || *c.VLAN > 4094) {
+		return fmt.Errorf("invalid VF VLAN %d, must be between 0 and 4094", *c.VLAN)
+	}
+	return nil
+}
+
+func (c *VFConfig) settings() *sriov.Settings {
+	if c == nil {
+		return nil
+	}
+	return &sriov.Settings{MAC: c.MAC, VLAN: c.VLAN, SpoofChk: c.SpoofChk}
+}
+
+// vfAllocation records the VF allocated to an attachment, along with the
+// original values of the VF settings changed on the PF, so that DEL can
+// restore them and release the VF
+type vfAllocation struct {
+	PF       string          `json:"pf"`
+	VF       int             `json:"vf"`
+	PCIAddr  string          `json:"pciBusID"`
+	Original *sriov.Settings `json:"original,omitempty"`
+}
+
+// allocateVF reserves a free VF of the PF for the attachment and applies
+// the VF configuration through the PF. It returns the PCI address of the
+// VF.
+func allocateVF(dataDir, pfName string, config *VFConfig, containerID, ifName string) (string, error) {
+	pf, err := netlinksafe.LinkByName(pfName)
+	if err != nil {
+		return "", fmt.Errorf("failed to find PF %q: %v", pfName, err)
+	}
+	index, pciAddr, err := sriov.ReserveVF(pfName, nil, containerID, ifName)
+	if err != nil {
+		return "", err
+	}
+
+	settings := config.settings()
+	alloc := &vfAllocation{PF: pfName, VF: index, PCIAddr: pciAddr}
+	if settings != nil {
+		info := sriov.VFInfo(pf, index)
+		if info == nil {
+			_ = sriov.ReleaseVF(pciAddr, containerID, ifName)
+			return "", fmt.Errorf("failed to find VF %d of %q", index, pfName)
+		}
+		alloc.Original = sriov.Current(info, settings)
+	}
+
+	if err := putRecord(dataDir, vfsGroup, containerID, ifName, alloc); err != nil {
+		_ = sriov.ReleaseVF(pciAddr, containerID, ifName)
+		return "", fmt.Errorf("failed to record VF %d of %q: %v", index, pfName, err)
+	}
+
+	if err := sriov.Configure(pf, index, settings); err != nil {
+		_ = releaseVF(dataDir, containerID, ifName)
+		return "", err
+	}
+	return pciAddr, nil
+}
+
+// releaseVF restores the VF settings changed at ADD time and releases the
+// VF. A missing record means no VF was allocated.
+func releaseVF(dataDir, containerID, ifName string) error {
+	alloc := &vfAllocation{}
+	found, err := getRecord(dataDir, vfsGroup, containerID, ifName, alloc)
+	if err != nil || !found {
+		return err
+	}
+
+	// The VFs are gone with the PF, there is nothing to restore
+	if pf, err := netlinksafe.LinkByName(alloc.PF); err == nil {
+		if err := sriov.Configure(pf, alloc.VF, alloc.Original); err != nil {
+			return err
+		}
+	}
+
+	if err := sriov.ReleaseVF(alloc.PCIAddr, containerID, ifName); err != nil {
+		return err
+	}
+	return removeRecord(dataDir, vfsGroup, containerID, ifName)
+}
@@ -0,0 +1,98 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// udevDataDir is the udev database, where the properties of a network
+// interface are stored in a file named n<ifindex>
+var udevDataDir = "/run/udev/data"
+
+// udevProperties reads the properties of the network interface from the
+// udev database, or nil when udev did not record any
+func udevProperties(ifIndex int) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(udevDataDir, fmt.Sprintf("n%d", ifIndex)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	props := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Properties are recorded as E:<key>=<value>
+		prop, ok := strings.CutPrefix(scanner.Text(), "E:")
+		if !ok {
+			continue
+		}
+		if key, value, ok := strings.Cut(prop, "="); ok {
+			props[key] = value
+		}
+	}
+	return props, scanner.Err()
+}
+
+// findDeviceByUdevProperties returns the name of the network interface
+// whose udev properties include all the given ones. It fails when none or
+// several interfaces match.
+func findDeviceByUdevProperties(match map[string]string) (string, error) {
+	links, err := netlinksafe.LinkList()
+	if err != nil {
+		return "", fmt.Errorf("failed to list node links: %v", err)
+	}
+
+	var found []string
+	for _, link := range links {
+		props, err := udevProperties(link.Attrs().Index)
+		if err != nil {
+			return "", fmt.Errorf("failed to read udev properties of %q: %v", link.Attrs().Name, err)
+		}
+		if props == nil {
+			continue
+		}
+		matches := true
+		for key, value := range match {
+			if v, ok := props[key]; !ok || v != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, link.Attrs().Name)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no device matches udev properties %v", match)
+	case 1:
+		return found[0], nil
+	}
+	sort.Strings(found)
+	return "", fmt.Errorf("several devices match udev properties %v: %s", match, strings.Join(found, ", "))
+}
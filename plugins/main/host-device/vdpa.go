@@ -0,0 +1,294 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+var sysBusVdpa = "/sys/bus/vdpa"
+
+const (
+	// vdpaVirtioDriver exposes the vDPA device as a virtio-net interface,
+	// which is moved to the container
+	vdpaVirtioDriver = "virtio_vdpa"
+	// vdpaVhostDriver exposes the vDPA device as a vhost-vdpa character
+	// device, for VMs and DPDK
+	vdpaVhostDriver = "vhost_vdpa"
+
+	// vdpaBindTimeout is how long the interface of a vDPA device bound to
+	// virtio_vdpa takes to show up at most
+	vdpaBindTimeout = 2 * time.Second
+)
+
+// VDPAConfig selects a vDPA device, by name or as the first unused device
+// of a management device, and the driver it is bound to
+type VDPAConfig struct {
+	// Name is the name of the vDPA device, such as vdpa0
+	Name string `json:"name,omitempty"`
+	// MgmtDev is the management device the vDPA device is created on, such
+	// as pci/0000:65:00.2 or vdpasim_net
+	MgmtDev string `json:"mgmtDev,omitempty"`
+	// Driver is virtio_vdpa or vhost_vdpa, the device keeps its driver
+	// when not set
+	Driver string `json:"driver,omitempty"`
+}
+
+func (c *VDPAConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if (c.Name == "") == (c.MgmtDev == "") {
+		return fmt.Errorf(`vdpa: specify either "name" or "mgmtDev"`)
+	}
+	switch c.Driver {
+	case "", vdpaVirtioDriver, vdpaVhostDriver:
+		return nil
+	}
+	return fmt.Errorf("vdpa: invalid driver %q, must be %q or %q", c.Driver, vdpaVirtioDriver, vdpaVhostDriver)
+}
+
+// vdpaBinding records the vDPA device of the attachment and the driver it
+// was bound to before ADD, so that DEL can bind it back
+type vdpaBinding struct {
+	Device     string `json:"device"`
+	Driver     string `json:"driver"`
+	OrigDriver string `json:"origDriver,omitempty"`
+}
+
+// vdpaGroup is the group of the vDPA bindings in the attachment store
+const vdpaGroup = "vdpa"
+
+// vdpaDriver returns the driver the vDPA device is bound to, or an empty
+// string when it is not bound
+func vdpaDriver(name string) (string, error) {
+	driverPath, err := filepath.EvalSymlinks(filepath.Join(sysBusVdpa, "devices", name, "driver"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return filepath.Base(driverPath), nil
+}
+
+// bindVdpaDriver unbinds the vDPA device from its driver, if any, and
+// binds it to the given one
+func bindVdpaDriver(name, driver string) error {
+	current, err := vdpaDriver(name)
+	if err != nil {
+		return err
+	}
+	if current == driver {
+		return nil
+	}
+	if current != "" {
+		if err := writeSysfs(filepath.Join(sysBusVdpa, "drivers", current, "unbind"), name); err != nil {
+			return fmt.Errorf("failed to unbind %s from %s: %v", name, current, err)
+		}
+	}
+	if driver == "" {
+		return nil
+	}
+	if err := writeSysfs(filepath.Join(sysBusVdpa, "drivers", driver, "bind"), name); err != nil {
+		return fmt.Errorf("failed to bind %s to %s, is the module loaded? %v", name, driver, err)
+	}
+	return nil
+}
+
+// usedVdpaDevices returns the vDPA devices recorded for attachments
+func usedVdpaDevices(store *attachments.Store) (map[string]bool, error) {
+	ids, err := store.Refs(vdpaGroup)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, id := range ids {
+		b := &vdpaBinding{}
+		if _, err := store.GetJSON(vdpaGroup, id, b); err != nil {
+			return nil, fmt.Errorf("failed to read vDPA binding %q: %v", id, err)
+		}
+		used[b.Device] = true
+	}
+	return used, nil
+}
+
+// findVdpaDevice returns the name of the configured vDPA device, or of the
+// first vDPA device of the management device not used by an attachment.
+// vDPA devices are children of their management device in sysfs.
+func findVdpaDevice(store *attachments.Store, c *VDPAConfig) (string, error) {
+	if c.Name != "" {
+		if _, err := os.Stat(filepath.Join(sysBusVdpa, "devices", c.Name)); err != nil {
+			return "", fmt.Errorf("vDPA device %s not found: %v", c.Name, err)
+		}
+		return c.Name, nil
+	}
+
+	mgmtDev := c.MgmtDev
+	if _, dev, found := strings.Cut(mgmtDev, "/"); found {
+		mgmtDev = dev
+	}
+	entries, err := os.ReadDir(filepath.Join(sysBusVdpa, "devices"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list vDPA devices: %v", err)
+	}
+	used, err := usedVdpaDevices(store)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		devPath, err := filepath.EvalSymlinks(filepath.Join(sysBusVdpa, "devices", name))
+		if err != nil {
+			return "", err
+		}
+		if filepath.Base(filepath.Dir(devPath)) == mgmtDev && !used[name] {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no unused vDPA device on %s", c.MgmtDev)
+}
+
+// vdpaNetdev returns the interface of the vDPA device bound to virtio_vdpa
+func vdpaNetdev(name string) (string, error) {
+	netdevs, err := filepath.Glob(filepath.Join(sysBusVdpa, "devices", name, "virtio*", "net", "*"))
+	if err != nil {
+		return "", err
+	}
+	if len(netdevs) == 0 {
+		return "", fmt.Errorf("no network interface for vDPA device %s", name)
+	}
+	return filepath.Base(netdevs[0]), nil
+}
+
+// vdpaCharDev returns the vhost-vdpa character device of the vDPA device
+// bound to vhost_vdpa
+func vdpaCharDev(name string) (string, error) {
+	chardevs, err := filepath.Glob(filepath.Join(sysBusVdpa, "devices", name, "vhost-vdpa-*"))
+	if err != nil {
+		return "", err
+	}
+	if len(chardevs) == 0 {
+		return "", fmt.Errorf("no vhost-vdpa device for vDPA device %s", name)
+	}
+	return filepath.Join("/dev", filepath.Base(chardevs[0])), nil
+}
+
+// attachVdpa binds the vDPA device to the requested driver and records its
+// original driver. With virtio_vdpa, the device to move becomes the
+// interface of the vDPA device. With vhost_vdpa, the path of the character
+// device is returned.
+func attachVdpa(cfg *NetConf, containerID, ifName string) (string, error) {
+	name, driver, err := reserveVdpa(cfg, containerID, ifName)
+	if err != nil {
+		return "", err
+	}
+	devPath, err := bindVdpa(cfg, name, driver)
+	if err != nil {
+		_ = restoreVdpaDriver(cfg.DataDir, containerID, ifName)
+		return "", err
+	}
+	return devPath, nil
+}
+
+// reserveVdpa selects the vDPA device of the attachment and records it
+// with its original driver, under the lock of the store so that concurrent
+// ADDs select different devices. It returns the device and the driver to
+// bind it to.
+func reserveVdpa(cfg *NetConf, containerID, ifName string) (string, string, error) {
+	store, err := attachments.Open(cfg.DataDir)
+	if err != nil {
+		return "", "", err
+	}
+	defer store.Close()
+
+	name, err := findVdpaDevice(store, cfg.VDPA)
+	if err != nil {
+		return "", "", err
+	}
+	origDriver, err := vdpaDriver(name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find driver of vDPA device %s: %v", name, err)
+	}
+	driver := cfg.VDPA.Driver
+	if driver == "" {
+		driver = origDriver
+	}
+	if driver != vdpaVirtioDriver && driver != vdpaVhostDriver {
+		return "", "", fmt.Errorf(`vDPA device %s is bound to %q, set the vdpa "driver"`, name, origDriver)
+	}
+
+	b := &vdpaBinding{Device: name, Driver: driver, OrigDriver: origDriver}
+	if err := store.PutJSON(vdpaGroup, attachments.ID(containerID, ifName), b); err != nil {
+		return "", "", fmt.Errorf("failed to record vDPA device %s: %v", name, err)
+	}
+	return name, driver, nil
+}
+
+func bindVdpa(cfg *NetConf, name, driver string) (string, error) {
+	if err := bindVdpaDriver(name, driver); err != nil {
+		return "", err
+	}
+	if driver == vdpaVhostDriver {
+		return vdpaCharDev(name)
+	}
+	return "", waitForDevice(max(cfg.deviceWaitTimeout(), vdpaBindTimeout), func() error {
+		netdev, err := vdpaNetdev(name)
+		if err != nil {
+			return err
+		}
+		cfg.Device = netdev
+		return nil
+	})
+}
+
+// vdpaBindingOf returns the vDPA binding recorded at ADD time, if any
+func vdpaBindingOf(dataDir, containerID, ifName string) (*vdpaBinding, error) {
+	b := &vdpaBinding{}
+	found, err := getRecord(dataDir, vdpaGroup, containerID, ifName, b)
+	if err != nil || !found {
+		return nil, err
+	}
+	return b, nil
+}
+
+// restoreVdpaDriver binds the vDPA device back to the driver recorded at
+// ADD time. A missing record means no vDPA device was attached.
+func restoreVdpaDriver(dataDir, containerID, ifName string) error {
+	b, err := vdpaBindingOf(dataDir, containerID, ifName)
+	if err != nil || b == nil {
+		return err
+	}
+	// The device may have been deleted meanwhile
+	if _, err := os.Stat(filepath.Join(sysBusVdpa, "devices", b.Device)); err == nil {
+		if err := bindVdpaDriver(b.Device, b.OrigDriver); err != nil {
+			return err
+		}
+	}
+	return removeRecord(dataDir, vdpaGroup, containerID, ifName)
+}
@@ -0,0 +1,147 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const vfioDriver = "vfio-pci"
+
+// writeSysfs writes a sysfs attribute, overridden in tests
+var writeSysfs = func(path, value string) error {
+	return os.WriteFile(path, []byte(value), 0o200)
+}
+
+// driverBinding records the kernel driver a device was bound to before it
+// was handed over to vfio-pci, so that DEL can bind it back
+type driverBinding struct {
+	PCIAddr string `json:"pciBusID"`
+	Driver  string `json:"driver,omitempty"`
+}
+
+// vfioGroup is the group of the driver bindings in the attachment store
+const vfioGroup = "vfio"
+
+// pciDriver returns the name of the driver bound to the device, or an
+// empty string when the device is not bound
+func pciDriver(pciAddr string) (string, error) {
+	driverPath, err := filepath.EvalSymlinks(filepath.Join(sysBusPCI, pciAddr, "driver"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return filepath.Base(driverPath), nil
+}
+
+// iommuGroup returns the IOMMU group of the device, whose VFIO character
+// device is /dev/vfio/<group>
+func iommuGroup(pciAddr string) (string, error) {
+	groupPath, err := filepath.EvalSymlinks(filepath.Join(sysBusPCI, pciAddr, "iommu_group"))
+	if err != nil {
+		return "", fmt.Errorf("failed to find IOMMU group of %s: %v", pciAddr, err)
+	}
+	return filepath.Base(groupPath), nil
+}
+
+// bindPCIDriver unbinds the device from its current driver, if any, and
+// binds it to the given driver through driver_override, which also keeps
+// the original driver from claiming the device back. An empty driver
+// clears the override and leaves the device to the kernel.
+func bindPCIDriver(pciAddr, driver string) error {
+	devPath := filepath.Join(sysBusPCI, pciAddr)
+	override := driver
+	if override == "" {
+		override = "\n"
+	}
+	if err := writeSysfs(filepath.Join(devPath, "driver_override"), override); err != nil {
+		return fmt.Errorf("failed to set driver override of %s: %v", pciAddr, err)
+	}
+
+	current, err := pciDriver(pciAddr)
+	if err != nil {
+		return err
+	}
+	if current != "" {
+		if err := writeSysfs(filepath.Join(devPath, "driver", "unbind"), pciAddr); err != nil {
+			return fmt.Errorf("failed to unbind %s from %s: %v", pciAddr, current, err)
+		}
+	}
+	if err := writeSysfs(filepath.Join(sysBusPCI, "..", "drivers_probe"), pciAddr); err != nil {
+		return fmt.Errorf("failed to probe driver of %s: %v", pciAddr, err)
+	}
+
+	if driver == "" {
+		return nil
+	}
+	if current, err = pciDriver(pciAddr); err != nil {
+		return err
+	}
+	if current != driver {
+		return fmt.Errorf("failed to bind %s to %s, is the module loaded?", pciAddr, driver)
+	}
+	return nil
+}
+
+// handOverToVfio binds the device to vfio-pci and records the driver it
+// was bound to
+func handOverToVfio(cfg *NetConf, containerID, ifName string) error {
+	if cfg.PCIAddr == "" {
+		return fmt.Errorf(`vfioMode requires a PCI device, set "pciBusID" or "pciVendorDevice"`)
+	}
+	driver, err := pciDriver(cfg.PCIAddr)
+	if err != nil {
+		return fmt.Errorf("failed to find driver of %s: %v", cfg.PCIAddr, err)
+	}
+
+	if err := putRecord(cfg.DataDir, vfioGroup, containerID, ifName, &driverBinding{PCIAddr: cfg.PCIAddr, Driver: driver}); err != nil {
+		return fmt.Errorf("failed to record driver of %s: %v", cfg.PCIAddr, err)
+	}
+
+	if err := bindPCIDriver(cfg.PCIAddr, vfioDriver); err != nil {
+		_ = restoreDriver(cfg.DataDir, containerID, ifName)
+		return err
+	}
+	return nil
+}
+
+// restoreDriver binds the device back to the driver recorded at ADD time.
+// A missing record means the device was not handed over to vfio-pci.
+func restoreDriver(dataDir, containerID, ifName string) error {
+	b := &driverBinding{}
+	found, err := getRecord(dataDir, vfioGroup, containerID, ifName, b)
+	if err != nil || !found {
+		return err
+	}
+
+	if err := bindPCIDriver(b.PCIAddr, ""); err != nil {
+		return err
+	}
+	if b.Driver != "" {
+		current, err := pciDriver(b.PCIAddr)
+		if err != nil {
+			return err
+		}
+		if current != b.Driver {
+			return fmt.Errorf("failed to bind %s back to %s, bound to %q", b.PCIAddr, b.Driver, current)
+		}
+	}
+	return removeRecord(dataDir, vfioGroup, containerID, ifName)
+}
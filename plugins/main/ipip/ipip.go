@@ -0,0 +1,545 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating an IPIP or SIT (6in4) tunnel in the container,
+// whose endpoint is the host.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	// modeIPIP tunnels IPv4 packets over IPv4, modeSIT IPv6 packets
+	modeIPIP = "ipip"
+	modeSIT  = "sit"
+)
+
+// SixRD is the IPv6 Rapid Deployment (RFC 5969) configuration of a SIT
+// tunnel, whose IPv4 remote endpoint is then taken from the IPv6
+// destination of each packet
+type SixRD struct {
+	// Prefix is the IPv6 prefix of the 6rd domain
+	Prefix string `json:"prefix"`
+	// RelayPrefix is the IPv4 prefix common to the addresses of the domain,
+	// left out of the IPv6 addresses. Defaults to 0.0.0.0/0.
+	RelayPrefix string `json:"relayPrefix,omitempty"`
+
+	prefix, relayPrefix *net.IPNet
+}
+
+type NetConf struct {
+	types.NetConf
+	// Mode is "ipip" (default) or "sit"
+	Mode string `json:"mode,omitempty"`
+	// Remote is the IPv4 address of the remote endpoint, Local the source
+	// address of the encapsulated packets
+	Remote string `json:"remote,omitempty"`
+	Local  string `json:"local,omitempty"`
+	TTL    int    `json:"ttl,omitempty"`
+	// MTU defaults to the MTU of the device of the route to the remote
+	// minus the overhead, computed by the kernel
+	MTU   int    `json:"mtu,omitempty"`
+	SixRD *SixRD `json:"6rd,omitempty"`
+
+	remote, local net.IP
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func parseIPv4(field, addr string) (net.IP, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid %s address %q, must be an IPv4 address", field, addr)
+	}
+	return ip.To4(), nil
+}
+
+func (s *SixRD) parse() error {
+	_, prefix, err := net.ParseCIDR(s.Prefix)
+	if err != nil || prefix.IP.To4() != nil {
+		return fmt.Errorf("invalid 6rd prefix %q, must be an IPv6 prefix", s.Prefix)
+	}
+	s.prefix = prefix
+
+	relayPrefix := "0.0.0.0/0"
+	if s.RelayPrefix != "" {
+		relayPrefix = s.RelayPrefix
+	}
+	_, s.relayPrefix, err = net.ParseCIDR(relayPrefix)
+	if err != nil || s.relayPrefix.IP.To4() == nil {
+		return fmt.Errorf("invalid 6rd relayPrefix %q, must be an IPv4 prefix", s.RelayPrefix)
+	}
+
+	// The delegated prefixes are made of the prefix and the IPv4 address
+	// without the relay prefix, within the 64 bits of a subnet
+	prefixLen, _ := s.prefix.Mask.Size()
+	relayPrefixLen, _ := s.relayPrefix.Mask.Size()
+	if prefixLen+32-relayPrefixLen > 64 {
+		return fmt.Errorf("6rd prefix %s with relayPrefix %s delegate prefixes longer than /64", s.prefix, s.relayPrefix)
+	}
+	return nil
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	switch n.Mode {
+	case "":
+		n.Mode = modeIPIP
+	case modeIPIP, modeSIT:
+	default:
+		return nil, fmt.Errorf("invalid mode %q, must be %s or %s", n.Mode, modeIPIP, modeSIT)
+	}
+
+	var err error
+	if n.SixRD != nil {
+		if n.Mode != modeSIT {
+			return nil, fmt.Errorf("6rd requires mode %s", modeSIT)
+		}
+		if n.Remote != "" {
+			return nil, fmt.Errorf(`"remote" must not be set with 6rd, the remote endpoint of each packet is taken from its destination`)
+		}
+		if err := n.SixRD.parse(); err != nil {
+			return nil, err
+		}
+	} else {
+		if n.Remote == "" {
+			return nil, fmt.Errorf(`"remote" field is required. It specifies the address of the remote endpoint`)
+		}
+		if n.remote, err = parseIPv4("remote", n.Remote); err != nil {
+			return nil, err
+		}
+		if n.remote.IsMulticast() || n.remote.IsUnspecified() || n.remote.Equal(net.IPv4bcast) {
+			return nil, fmt.Errorf("remote %s must be a unicast address", n.remote)
+		}
+	}
+	if n.Local != "" {
+		if n.local, err = parseIPv4("local", n.Local); err != nil {
+			return nil, err
+		}
+	}
+	if n.TTL < 0 || n.TTL > 255 {
+		return nil, fmt.Errorf("invalid TTL %d, must be [0, 255]", n.TTL)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the device
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// endpoints describes the endpoints of the tunnel, which identify it
+func (n *NetConf) endpoints() string {
+	local, remote := "any", "any"
+	if n.local != nil {
+		local = n.local.String()
+	}
+	if n.remote != nil {
+		remote = n.remote.String()
+	}
+	return fmt.Sprintf("from %s to %s", local, remote)
+}
+
+// link returns the tunnel device to create
+func (n *NetConf) link(linkAttrs netlink.LinkAttrs) netlink.Link {
+	// Path MTU discovery is on by default, as with iproute2
+	if n.Mode == modeSIT {
+		return &netlink.Sittun{
+			LinkAttrs: linkAttrs,
+			Local:     n.local,
+			Remote:    n.remote,
+			Ttl:       uint8(n.TTL),
+			PMtuDisc:  1,
+			Proto:     unix.IPPROTO_IPV6,
+		}
+	}
+	return &netlink.Iptun{
+		LinkAttrs: linkAttrs,
+		Local:     n.local,
+		Remote:    n.remote,
+		Ttl:       uint8(n.TTL),
+		PMtuDisc:  1,
+		Proto:     unix.IPPROTO_IPIP,
+	}
+}
+
+// addTunnel creates the tunnel device in the current namespace
+func (n *NetConf) addTunnel(name string) error {
+	if n.SixRD != nil {
+		return addSixRDTunnel(name, n)
+	}
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.Name = name
+	linkAttrs.MTU = n.MTU
+	return netlink.LinkAdd(n.link(linkAttrs))
+}
+
+// addSixRDTunnel creates a SIT tunnel with its 6rd configuration, which the
+// netlink library has no attributes for
+func addSixRDTunnel(name string, n *NetConf) error {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(name)))
+	if n.MTU > 0 {
+		req.AddData(nl.NewRtAttr(unix.IFLA_MTU, nl.Uint32Attr(uint32(n.MTU))))
+	}
+
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated(modeSIT))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	if n.local != nil {
+		data.AddRtAttr(nl.IFLA_IPTUN_LOCAL, []byte(n.local.To4()))
+	}
+	if n.TTL > 0 {
+		data.AddRtAttr(nl.IFLA_IPTUN_TTL, nl.Uint8Attr(uint8(n.TTL)))
+	}
+	data.AddRtAttr(nl.IFLA_IPTUN_PROTO, nl.Uint8Attr(unix.IPPROTO_IPV6))
+	data.AddRtAttr(nl.IFLA_IPTUN_PMTUDISC, nl.Uint8Attr(1))
+
+	prefixLen, _ := n.SixRD.prefix.Mask.Size()
+	relayPrefixLen, _ := n.SixRD.relayPrefix.Mask.Size()
+	data.AddRtAttr(nl.IFLA_IPTUN_6RD_PREFIX, []byte(n.SixRD.prefix.IP.To16()))
+	data.AddRtAttr(nl.IFLA_IPTUN_6RD_PREFIXLEN, nl.Uint16Attr(uint16(prefixLen)))
+	data.AddRtAttr(nl.IFLA_IPTUN_6RD_RELAY_PREFIX, []byte(n.SixRD.relayPrefix.IP.To4()))
+	data.AddRtAttr(nl.IFLA_IPTUN_6RD_RELAY_PREFIXLEN, nl.Uint16Attr(uint16(relayPrefixLen)))
+
+	req.AddData(linkInfo)
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func createTunnel(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	tunnel := &current.Interface{}
+
+	// The device is created with a temporary name so as not to collide
+	// with the devices of the host
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+
+	// Unlike other links, IP tunnels created directly in the container
+	// route the encapsulated packets there on older kernels. The device is
+	// rather created in the host namespace and then moved to the container,
+	// so that the host stays the endpoint.
+	if err := conf.addTunnel(tmpName); err != nil {
+		if errors.Is(err, unix.EEXIST) {
+			return nil, fmt.Errorf("failed to create %s: a tunnel %s already exists: %v", conf.Mode, conf.endpoints(), err)
+		}
+		return nil, fmt.Errorf("failed to create %s: %v", conf.Mode, err)
+	}
+	link, err := netlinksafe.LinkByName(tmpName)
+	if err != nil {
+		_ = ip.DelLinkByName(tmpName)
+		return nil, fmt.Errorf("failed to lookup %s %q: %v", conf.Mode, tmpName, err)
+	}
+	if err := netlink.LinkSetNsFd(link, int(netns.Fd())); err != nil {
+		_ = netlink.LinkDel(link)
+		return nil, fmt.Errorf("failed to move %s %q to the container: %v", conf.Mode, tmpName, err)
+	}
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		err := ip.RenameLink(tmpName, ifName)
+		if err != nil {
+			_ = ip.DelLinkByName(tmpName)
+			return fmt.Errorf("failed to rename %s to %q: %v", conf.Mode, ifName, err)
+		}
+		tunnel.Name = ifName
+		// The hardware address of an IP tunnel is its local address, so
+		// it isn't reported
+		tunnel.Sandbox = netns.Path()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tunnel, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	tunnelInterface, err := createTunnel(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{tunnelInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the tunnel interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("ipip: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("ipip: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	var local, remote net.IP
+	var ttl uint8
+	switch l := link.(type) {
+	case *netlink.Iptun:
+		if n.Mode != modeIPIP {
+			return fmt.Errorf("ipip: Container interface %s not of type %s", intf.Name, n.Mode)
+		}
+		local, remote, ttl = l.Local, l.Remote, l.Ttl
+	case *netlink.Sittun:
+		if n.Mode != modeSIT {
+			return fmt.Errorf("ipip: Container interface %s not of type %s", intf.Name, n.Mode)
+		}
+		local, remote, ttl = l.Local, l.Remote, l.Ttl
+	default:
+		return fmt.Errorf("ipip: Container interface %s not of type %s", intf.Name, n.Mode)
+	}
+
+	if n.remote != nil && !remote.Equal(n.remote) {
+		return fmt.Errorf("ipip: Interface %s remote %s doesn't match configured remote %s", intf.Name, remote, n.remote)
+	}
+	if n.remote == nil && remote != nil && !remote.IsUnspecified() {
+		return fmt.Errorf("ipip: Interface %s remote %s doesn't match configured 6rd", intf.Name, remote)
+	}
+	if n.local != nil && !local.Equal(n.local) {
+		return fmt.Errorf("ipip: Interface %s local %s doesn't match configured local %s", intf.Name, local, n.local)
+	}
+	if int(ttl) != n.TTL {
+		return fmt.Errorf("ipip: Interface %s TTL %d doesn't match configured TTL %d", intf.Name, ttl, n.TTL)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("ipip: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("ipip"))
+}
@@ -0,0 +1,310 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	UNDERLAY_NAME = "eth0"
+	IFNAME        = "ipip1"
+)
+
+var _ = Describe("ipip configuration", func() {
+	It("applies the defaults", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "ipip", "remote": "10.0.0.2"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Mode).To(Equal(modeIPIP))
+		Expect(n.local).To(BeNil())
+		Expect(n.hasIPAM()).To(BeFalse())
+		Expect(n.link(netlink.NewLinkAttrs()).Type()).To(Equal("ipip"))
+		Expect(n.endpoints()).To(Equal("from any to 10.0.0.2"))
+	})
+
+	It("parses the 6rd configuration", func() {
+		n, err := loadConf([]byte(`{"mode": "sit", "local": "192.0.2.10", "6rd": {"prefix": "2001:db8::/32", "relayPrefix": "192.0.2.0/24"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.remote).To(BeNil())
+		Expect(n.SixRD.prefix.String()).To(Equal("2001:db8::/32"))
+		Expect(n.SixRD.relayPrefix.String()).To(Equal("192.0.2.0/24"))
+
+		n, err = loadConf([]byte(`{"mode": "sit", "6rd": {"prefix": "2001:db8::/32"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.SixRD.relayPrefix.String()).To(Equal("0.0.0.0/0"))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid mode", `{"mode": "gre", "remote": "10.0.0.2"}`, `invalid mode "gre"`),
+		Entry("without remote", `{}`, `"remote" field is required`),
+		Entry("with an IPv6 remote", `{"remote": "2001:db8::2"}`, `invalid remote address "2001:db8::2"`),
+		Entry("with a multicast remote", `{"remote": "239.1.1.1"}`, "must be a unicast address"),
+		Entry("with an invalid local", `{"remote": "10.0.0.2", "local": "foo"}`, `invalid local address "foo"`),
+		Entry("with an invalid TTL", `{"remote": "10.0.0.2", "ttl": 256}`, "invalid TTL 256"),
+		Entry("with a negative MTU", `{"remote": "10.0.0.2", "mtu": -1}`, "invalid MTU -1"),
+		Entry("with 6rd in ipip mode", `{"6rd": {"prefix": "2001:db8::/32"}}`, "6rd requires mode sit"),
+		Entry("with 6rd and a remote", `{"mode": "sit", "remote": "10.0.0.2", "6rd": {"prefix": "2001:db8::/32"}}`, `"remote" must not be set with 6rd`),
+		Entry("with an IPv4 6rd prefix", `{"mode": "sit", "6rd": {"prefix": "10.0.0.0/8"}}`, `invalid 6rd prefix "10.0.0.0/8"`),
+		Entry("with an IPv6 relay prefix", `{"mode": "sit", "6rd": {"prefix": "2001:db8::/32", "relayPrefix": "2001:db8::/64"}}`, `invalid 6rd relayPrefix "2001:db8::/64"`),
+		Entry("with delegated prefixes longer than /64", `{"mode": "sit", "6rd": {"prefix": "2001:db8::/48"}}`, "longer than /64"),
+	)
+})
+
+var _ = Describe("ipip Operations", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir, err = os.MkdirTemp("", "ipip_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			// The underlay is a veth towards the remote endpoint
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = UNDERLAY_NAME
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: linkAttrs,
+				PeerName:  "peer0",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(UNDERLAY_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			addr, err := netlink.ParseAddr("10.0.0.1/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("creates a sit link whose endpoint is the host", func() {
+		conf, err := loadConf([]byte(`{"mode": "sit", "remote": "10.0.0.2", "local": "10.0.0.1", "ttl": 64}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			iface, err := createTunnel(conf, IFNAME, targetNS)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(iface.Name).To(Equal(IFNAME))
+			Expect(iface.Mac).To(BeEmpty())
+			Expect(iface.Sandbox).To(Equal(targetNS.Path()))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			sit, ok := link.(*netlink.Sittun)
+			Expect(ok).To(BeTrue())
+			Expect(sit.Remote.Equal(net.ParseIP("10.0.0.2"))).To(BeTrue())
+			Expect(sit.Local.Equal(net.ParseIP("10.0.0.1"))).To(BeTrue())
+			Expect(sit.Ttl).To(BeEquivalentTo(64))
+			// The underlay of the tunnel is in another namespace
+			Expect(link.Attrs().NetNsID).NotTo(Equal(-1))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("creates a 6rd sit link", func() {
+		conf, err := loadConf([]byte(`{"mode": "sit", "local": "10.0.0.1", "6rd": {"prefix": "2001:db8::/32", "relayPrefix": "10.0.0.0/8"}}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := createTunnel(conf, IFNAME, targetNS)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			sit, ok := link.(*netlink.Sittun)
+			Expect(ok).To(BeTrue())
+			Expect(sit.Remote.IsUnspecified()).To(BeTrue())
+			Expect(sit.Local.Equal(net.ParseIP("10.0.0.1"))).To(BeTrue())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails to create a second tunnel with the same endpoints", func() {
+		conf, err := loadConf([]byte(`{"remote": "10.0.0.2", "local": "10.0.0.1"}`))
+		Expect(err).NotTo(HaveOccurred())
+		otherNS, err := testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(otherNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(otherNS)).To(Succeed())
+		}()
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := createTunnel(conf, IFNAME, targetNS)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = createTunnel(conf, IFNAME, otherNS)
+			return err
+		})
+		Expect(err).To(MatchError(ContainSubstring("a tunnel from 10.0.0.1 to 10.0.0.2 already exists")))
+	})
+
+	for _, ver := range testutils.AllSpecVersions {
+		// Redefine ver inside for scope so real value is picked up by each dynamically defined It()
+		// See Gingkgo's "Patterns for dynamically generating tests" documentation.
+		ver := ver
+
+		It(fmt.Sprintf("[%s] configures and deconfigures an ipip link with ADD/CHECK/DEL", ver), func() {
+			conf := fmt.Sprintf(`{
+				"cniVersion": "%s",
+				"name": "ipipTest",
+				"type": "ipip",
+				"remote": "10.0.0.2",
+				"mtu": 1400,
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.1.2.0/24",
+					"dataDir": "%s"
+				}
+			}`, ver, dataDir)
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       targetNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   []byte(conf),
+			}
+
+			var result types.Result
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				var err error
+				if testutils.SpecVersionHasSTATUS(ver) {
+					err = testutils.CmdStatus(func() error {
+						return cmdStatus(args)
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				result, _, err = testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Type()).To(Equal("ipip"))
+				Expect(link.Attrs().NetNsID).NotTo(Equal(-1))
+				Expect(link.Attrs().MTU).To(Equal(1400))
+				Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+				addrs, err := netlinksafe.AddrList(link, unix.AF_INET)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(addrs).To(HaveLen(1))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// CHECK against the result converted to the current version
+			r, err := types100.GetResult(result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.IPs).To(HaveLen(1))
+			confMap := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+			prevResult, err := r.GetAsVersion(ver)
+			Expect(err).NotTo(HaveOccurred())
+			confMap["prevResult"] = prevResult
+			args.StdinData, err = json.Marshal(confMap)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+			})
+			if testutils.SpecVersionHasCHECK(ver) {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError("config version does not allow CHECK"))
+			}
+
+			args.StdinData = []byte(conf)
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				_, err := netlinksafe.LinkByName(IFNAME)
+				return err
+			})
+			Expect(err).To(HaveOccurred())
+
+			// DEL can be called multiple times
+			err = originalNS.Do(func(ns.NetNS) error {
+				return testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	}
+})
@@ -0,0 +1,411 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating an IPoIB child interface of an InfiniBand
+// device in the container, on the partition of its PKey.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+// fullMembership is the bit of the PKey of the full members of a
+// partition, which the kernel sets on the PKey of the children
+const fullMembership = 0x8000
+
+// PKey is an InfiniBand partition key, given as a number or a string such
+// as "0x8001"
+type PKey uint16
+
+func (p *PKey) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid pkey %s, must be a 16 bits number", data)
+	}
+	*p = PKey(v)
+	return nil
+}
+
+type NetConf struct {
+	types.NetConf
+	// Master is the InfiniBand device the child is created on
+	Master string `json:"master"`
+	PKey   *PKey  `json:"pkey"`
+	// Mode is datagram (default) or connected
+	Mode string `json:"mode,omitempty"`
+	// Umcast allows the user space to receive the multicast packets of
+	// the partition
+	Umcast bool `json:"umcast,omitempty"`
+	MTU    int  `json:"mtu,omitempty"`
+
+	mode netlink.IPoIBMode
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	if n.Master == "" {
+		return nil, fmt.Errorf(`"master" field is required. It specifies the InfiniBand device to create the child interface on`)
+	}
+	if n.PKey == nil {
+		return nil, fmt.Errorf(`"pkey" field is required. It specifies the partition of the child interface`)
+	}
+	// The PKeys 0x0000 and 0x8000 are invalid, whatever the membership
+	if *n.PKey&^fullMembership == 0 {
+		return nil, fmt.Errorf("invalid pkey %#04x", uint16(*n.PKey))
+	}
+	switch n.Mode {
+	case "", "datagram":
+		n.Mode = "datagram"
+		n.mode = netlink.IPOIB_MODE_DATAGRAM
+	case "connected":
+		n.mode = netlink.IPOIB_MODE_CONNECTED
+	default:
+		return nil, fmt.Errorf("invalid mode %q, must be datagram or connected", n.Mode)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the device
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// pkey is the PKey of the children, full members of their partition
+func (n *NetConf) pkey() uint16 {
+	return uint16(*n.PKey) | fullMembership
+}
+
+func createIPoIB(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	ipoib := &current.Interface{}
+
+	m, err := netlinksafe.LinkByName(conf.Master)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup master %q: %v", conf.Master, err)
+	}
+	if m.Attrs().EncapType != "infiniband" {
+		return nil, fmt.Errorf("master %q is not an InfiniBand device", conf.Master)
+	}
+
+	// due to kernel bug we have to create with tmpname or it might
+	// collide with the name on the host and error out
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.MTU = conf.MTU
+	linkAttrs.Name = tmpName
+	linkAttrs.ParentIndex = m.Attrs().Index
+	linkAttrs.Namespace = netlink.NsFd(int(netns.Fd()))
+
+	umcast := uint16(0)
+	if conf.Umcast {
+		umcast = 1
+	}
+	child := &netlink.IPoIB{
+		LinkAttrs: linkAttrs,
+		Pkey:      conf.pkey(),
+		Mode:      conf.mode,
+		Umcast:    umcast,
+	}
+	if err := netlink.LinkAdd(child); err != nil {
+		return nil, fmt.Errorf("failed to create ipoib: %v", err)
+	}
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		err := ip.RenameLink(tmpName, ifName)
+		if err != nil {
+			_ = ip.DelLinkByName(tmpName)
+			return fmt.Errorf("failed to rename ipoib to %q: %v", ifName, err)
+		}
+		ipoib.Name = ifName
+
+		// Re-fetch interface to get all properties/attributes
+		contIPoIB, err := netlinksafe.LinkByName(ipoib.Name)
+		if err != nil {
+			return fmt.Errorf("failed to refetch ipoib %q: %v", ipoib.Name, err)
+		}
+		ipoib.Mac = contIPoIB.Attrs().HardwareAddr.String()
+		ipoib.Sandbox = netns.Path()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ipoib, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	ipoibInterface, err := createIPoIB(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{ipoibInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the ipoib interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("ipoib: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if contMap.Name == "" {
+			return fmt.Errorf("Container interface name missing in prevResult: %v", contMap.Name)
+		}
+		link, err := netlinksafe.LinkByName(contMap.Name)
+		if err != nil {
+			return fmt.Errorf("ipoib: Container Interface name in prevResult: %s not found", contMap.Name)
+		}
+		if err := validateCniContainerInterface(contMap, link, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, link netlink.Link, n *NetConf) error {
+	ipoib, ok := link.(*netlink.IPoIB)
+	if !ok {
+		return fmt.Errorf("ipoib: Container interface %s not of type ipoib", intf.Name)
+	}
+	if ipoib.Pkey != n.pkey() {
+		return fmt.Errorf("ipoib: Interface %s pkey %#04x doesn't match configured pkey %#04x", intf.Name, ipoib.Pkey, n.pkey())
+	}
+	if ipoib.Mode != n.mode {
+		return fmt.Errorf("ipoib: Interface %s mode %s doesn't match configured mode %s", intf.Name, ipoib.Mode.String(), n.Mode)
+	}
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("ipoib: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("ipoib: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("ipoib"))
+}
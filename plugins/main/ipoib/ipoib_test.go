@@ -0,0 +1,206 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	MASTER_NAME = "eth0"
+	IFNAME      = "ib0"
+)
+
+var _ = Describe("ipoib configuration", func() {
+	It("requires a master and a pkey", func() {
+		_, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "ipoib", "pkey": 1}`))
+		Expect(err).To(MatchError(ContainSubstring(`"master" field is required`)))
+
+		_, err = loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "ipoib", "master": "ib0"}`))
+		Expect(err).To(MatchError(ContainSubstring(`"pkey" field is required`)))
+	})
+
+	DescribeTable("parses the pkey as a full member of the partition",
+		func(pkey string, expected uint16) {
+			n, err := loadConf([]byte(fmt.Sprintf(`{"master": "ib0", "pkey": %s}`, pkey)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n.pkey()).To(Equal(expected))
+		},
+		Entry("from a number", "32769", uint16(0x8001)),
+		Entry("from a hex string", `"0x7fff"`, uint16(0xffff)),
+		Entry("from a limited member", `"0x0010"`, uint16(0x8010)),
+	)
+
+	It("defaults to the datagram mode", func() {
+		n, err := loadConf([]byte(`{"master": "ib0", "pkey": "0x8001"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Mode).To(Equal("datagram"))
+		Expect(n.mode).To(BeEquivalentTo(netlink.IPOIB_MODE_DATAGRAM))
+		Expect(n.hasIPAM()).To(BeFalse())
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with a pkey out of range", `{"master": "ib0", "pkey": 65536}`, "invalid pkey 65536"),
+		Entry("with a malformed pkey", `{"master": "ib0", "pkey": "default"}`, `invalid pkey "default"`),
+		Entry("with the invalid pkey", `{"master": "ib0", "pkey": "0x8000"}`, "invalid pkey 0x8000"),
+		Entry("with an invalid mode", `{"master": "ib0", "pkey": 1, "mode": "bridge"}`, `invalid mode "bridge"`),
+		Entry("with an invalid MTU", `{"master": "ib0", "pkey": 1, "mtu": -1}`, "invalid MTU -1"),
+	)
+})
+
+var _ = Describe("ipoib validation", func() {
+	var (
+		n     *NetConf
+		intf  current.Interface
+		child *netlink.IPoIB
+	)
+
+	BeforeEach(func() {
+		var err error
+		n, err = loadConf([]byte(`{"master": "ib0", "pkey": "0x0001", "mode": "connected", "mtu": 65520}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		mac, err := net.ParseMAC("00:00:10:49:fe:80:00:00:00:00:00:00:00:02:c9:03:00:a1:b2:c3")
+		Expect(err).NotTo(HaveOccurred())
+		linkAttrs := netlink.NewLinkAttrs()
+		linkAttrs.Name = IFNAME
+		linkAttrs.MTU = 65520
+		linkAttrs.HardwareAddr = mac
+		child = &netlink.IPoIB{
+			LinkAttrs: linkAttrs,
+			Pkey:      0x8001,
+			Mode:      netlink.IPOIB_MODE_CONNECTED,
+		}
+		intf = current.Interface{Name: IFNAME, Mac: mac.String()}
+	})
+
+	It("accepts the child interface of the configuration", func() {
+		Expect(validateCniContainerInterface(intf, child, n)).To(Succeed())
+	})
+
+	It("rejects an interface of another type", func() {
+		Expect(validateCniContainerInterface(intf, &netlink.Dummy{LinkAttrs: child.LinkAttrs}, n)).
+			To(MatchError(ContainSubstring("not of type ipoib")))
+	})
+
+	It("rejects a child of another partition", func() {
+		child.Pkey = 0x8002
+		Expect(validateCniContainerInterface(intf, child, n)).
+			To(MatchError(ContainSubstring("pkey 0x8002 doesn't match configured pkey 0x8001")))
+	})
+
+	It("rejects a child in another mode", func() {
+		child.Mode = netlink.IPOIB_MODE_DATAGRAM
+		Expect(validateCniContainerInterface(intf, child, n)).
+			To(MatchError(ContainSubstring("mode datagram doesn't match configured mode connected")))
+	})
+
+	It("rejects a child with another MTU", func() {
+		child.MTU = 2044
+		Expect(validateCniContainerInterface(intf, child, n)).
+			To(MatchError(ContainSubstring("MTU 2044 doesn't match configured MTU 65520")))
+	})
+})
+
+var _ = Describe("ipoib Operations", func() {
+	var originalNS, targetNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = MASTER_NAME
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: linkAttrs,
+				PeerName:  "peer0",
+			})).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("refuses to create a child on a master which is not an InfiniBand device", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData: []byte(fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "ipoib",
+				"type": "ipoib",
+				"master": "%s",
+				"pkey": "0x8001"
+			}`, MASTER_NAME)),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			return err
+		})
+		Expect(err).To(MatchError(fmt.Sprintf("master %q is not an InfiniBand device", MASTER_NAME)))
+	})
+
+	It("deletes nothing when the child is already gone", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData: []byte(fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "ipoib",
+				"type": "ipoib",
+				"master": "%s",
+				"pkey": "0x8001"
+			}`, MASTER_NAME)),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -40,6 +40,12 @@ type NetConf struct {
 	Mode       string `json:"mode"`
 	MTU        int    `json:"mtu"`
 	LinkContNs bool   `json:"linkInContainer,omitempty"`
+	// Flags is the ipvlan internal mode: "bridge" (default), "private"
+	// or "vepa"
+	Flags string `json:"flags,omitempty"`
+	// HostShim makes the pods reachable from the host namespace
+	HostShim *HostShim `json:"hostShim,omitempty"`
+	DataDir  string    `json:"dataDir,omitempty"`
 }
 
 func init() {
@@ -55,6 +61,21 @@ func loadConf(args *skel.CmdArgs, cmdCheck bool) (*NetConf, string, error) {
 		return nil, "", fmt.Errorf("failed to load netconf: %v", err)
 	}
 
+	if n.DataDir == "" {
+		n.DataDir = defaultDataDir
+	}
+	if n.HostShim != nil {
+		if err := n.HostShim.parse(); err != nil {
+			return nil, "", err
+		}
+		if n.LinkContNs {
+			return nil, "", fmt.Errorf("hostShim is not supported with linkInContainer")
+		}
+		if n.Flags == "private" {
+			return nil, "", fmt.Errorf("hostShim cannot reach the pods with private flags")
+		}
+	}
+
 	if cmdCheck {
 		return n, n.CNIVersion, nil
 	}
@@ -81,16 +102,43 @@ func loadConf(args *skel.CmdArgs, cmdCheck bool) (*NetConf, string, error) {
 			}
 			n.Master = defaultRouteInterface
 		} else {
-			if len(result.Interfaces) == 1 && result.Interfaces[0].Name != "" {
-				n.Master = result.Interfaces[0].Name
-			} else {
-				return nil, "", fmt.Errorf("chained master failure. PrevResult lacks a single named interface")
+			master, err := chainedMaster(result, args, n.LinkContNs)
+			if err != nil {
+				return nil, "", err
 			}
+			n.Master = master
 		}
 	}
 	return n, n.CNIVersion, nil
 }
 
+// chainedMaster returns the master set up by a previous plugin: the single
+// interface of its result, or with linkInContainer the single interface it
+// placed in the container, as it may also report host-side interfaces.
+func chainedMaster(result *current.Result, args *skel.CmdArgs, inContainer bool) (string, error) {
+	if !inContainer {
+		if len(result.Interfaces) == 1 && result.Interfaces[0].Name != "" {
+			return result.Interfaces[0].Name, nil
+		}
+		return "", fmt.Errorf("chained master failure. PrevResult lacks a single named interface")
+	}
+
+	master := ""
+	for _, intf := range result.Interfaces {
+		if intf.Name == "" || intf.Sandbox != args.Netns || intf.Name == args.IfName {
+			continue
+		}
+		if master != "" {
+			return "", fmt.Errorf("chained master failure. PrevResult has several interfaces in the container")
+		}
+		master = intf.Name
+	}
+	if master == "" {
+		return "", fmt.Errorf("chained master failure. PrevResult lacks a named interface in the container")
+	}
+	return master, nil
+}
+
 func modeFromString(s string) (netlink.IPVlanMode, error) {
 	switch s {
 	case "", "l2":
@@ -117,6 +165,32 @@ func modeToString(mode netlink.IPVlanMode) (string, error) {
 	}
 }
 
+func flagFromString(s string) (netlink.IPVlanFlag, error) {
+	switch s {
+	case "", "bridge":
+		return netlink.IPVLAN_FLAG_BRIDGE, nil
+	case "private":
+		return netlink.IPVLAN_FLAG_PRIVATE, nil
+	case "vepa":
+		return netlink.IPVLAN_FLAG_VEPA, nil
+	default:
+		return 0, fmt.Errorf("unknown ipvlan flags: %q", s)
+	}
+}
+
+func flagToString(flag netlink.IPVlanFlag) (string, error) {
+	switch flag {
+	case netlink.IPVLAN_FLAG_BRIDGE:
+		return "bridge", nil
+	case netlink.IPVLAN_FLAG_PRIVATE:
+		return "private", nil
+	case netlink.IPVLAN_FLAG_VEPA:
+		return "vepa", nil
+	default:
+		return "", fmt.Errorf("unknown ipvlan flags: %q", flag)
+	}
+}
+
 func createIpvlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
 	ipvlan := &current.Interface{}
 
@@ -125,6 +199,11 @@ func createIpvlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interf
 		return nil, err
 	}
 
+	flag, err := flagFromString(conf.Flags)
+	if err != nil {
+		return nil, err
+	}
+
 	var m netlink.Link
 	if conf.LinkContNs {
 		err = netns.Do(func(_ ns.NetNS) error {
@@ -154,6 +233,7 @@ func createIpvlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interf
 	mv := &netlink.IPVlan{
 		LinkAttrs: linkAttrs,
 		Mode:      mode,
+		Flag:      flag,
 	}
 
 	if conf.LinkContNs {
@@ -161,9 +241,10 @@ func createIpvlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interf
 			return netlink.LinkAdd(mv)
 		})
 	} else {
-		if err := netlink.LinkAdd(mv); err != nil {
-			return nil, fmt.Errorf("failed to create ipvlan: %v", err)
-		}
+		err = netlink.LinkAdd(mv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ipvlan: %v", err)
 	}
 
 	err = netns.Do(func(_ ns.NetNS) error {
@@ -303,6 +384,13 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 
+	if n.HostShim != nil {
+		if err = setupHostShim(n, args.ContainerID, args.IfName, result); err != nil {
+			_ = teardownHostShim(n.DataDir, args.ContainerID, args.IfName)
+			return err
+		}
+	}
+
 	result.DNS = n.DNS
 
 	return types.PrintResult(result, cniVersion)
@@ -322,6 +410,12 @@ func cmdDel(args *skel.CmdArgs) error {
 		}
 	}
 
+	// The references are kept by attachment, the shim is cleaned up even
+	// if hostShim was removed from the configuration
+	if err := teardownHostShim(n.DataDir, args.ContainerID, args.IfName); err != nil {
+		return err
+	}
+
 	if args.Netns == "" {
 		return nil
 	}
@@ -410,23 +504,37 @@ func cmdCheck(args *skel.CmdArgs) error {
 			contMap.Sandbox, args.Netns)
 	}
 
-	if n.LinkContNs {
-		err = netns.Do(func(_ ns.NetNS) error {
-			_, err = netlinksafe.LinkByName(n.Master)
+	// Without a configured master, the default route interface is used
+	// unless a previous plugin provided it, which the result of the whole
+	// chain no longer tells, so the parent is only verified in the former
+	// case
+	masterIndex := 0
+	if n.Master == "" && len(result.Interfaces) == 1 {
+		n.Master, err = getNamespacedDefaultRouteInterfaceName(args.Netns, n.LinkContNs)
+		if err != nil {
 			return err
-		})
-	} else {
-		_, err = netlinksafe.LinkByName(n.Master)
+		}
 	}
-
-	if err != nil {
-		return fmt.Errorf("failed to lookup master %q: %v", n.Master, err)
+	if n.Master != "" {
+		var m netlink.Link
+		if n.LinkContNs {
+			err = netns.Do(func(_ ns.NetNS) error {
+				m, err = netlinksafe.LinkByName(n.Master)
+				return err
+			})
+		} else {
+			m, err = netlinksafe.LinkByName(n.Master)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lookup master %q: %v", n.Master, err)
+		}
+		masterIndex = m.Attrs().Index
 	}
 
 	// Check prevResults for ips, routes and dns against values found in the container
 	if err := netns.Do(func(_ ns.NetNS) error {
 		// Check interface against values found in the container
-		err := validateCniContainerInterface(contMap, n.Mode)
+		err := validateCniContainerInterface(contMap, n, masterIndex)
 		if err != nil {
 			return err
 		}
@@ -448,7 +556,10 @@ func cmdCheck(args *skel.CmdArgs) error {
 	return nil
 }
 
-func validateCniContainerInterface(intf current.Interface, modeExpected string) error {
+// validateCniContainerInterface verifies that the container interface is
+// still an ipvlan of the expected master, unless masterIndex is 0, in the
+// configured mode, flags and MTU
+func validateCniContainerInterface(intf current.Interface, n *NetConf, masterIndex int) error {
 	var link netlink.Link
 	var err error
 
@@ -468,7 +579,11 @@ func validateCniContainerInterface(intf current.Interface, modeExpected string)
 		return fmt.Errorf("Error: Container interface %s not of type ipvlan", link.Attrs().Name)
 	}
 
-	mode, err := modeFromString(modeExpected)
+	if masterIndex != 0 && ipv.ParentIndex != masterIndex {
+		return fmt.Errorf("Container IPVlan %s is not a slave of master %s", link.Attrs().Name, n.Master)
+	}
+
+	mode, err := modeFromString(n.Mode)
 	if err != nil {
 		return err
 	}
@@ -484,6 +599,26 @@ func validateCniContainerInterface(intf current.Interface, modeExpected string)
 		return fmt.Errorf("Container IPVlan mode %s does not match expected value: %s", currString, confString)
 	}
 
+	flag, err := flagFromString(n.Flags)
+	if err != nil {
+		return err
+	}
+	if ipv.Flag != flag {
+		currString, err := flagToString(ipv.Flag)
+		if err != nil {
+			return err
+		}
+		confString, err := flagToString(flag)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("Container IPVlan flags %s does not match expected value: %s", currString, confString)
+	}
+
+	if n.MTU != 0 && ipv.MTU != n.MTU {
+		return fmt.Errorf("Container IPVlan MTU %d does not match expected value: %d", ipv.MTU, n.MTU)
+	}
+
 	if intf.Mac != "" {
 		if intf.Mac != link.Attrs().HardwareAddr.String() {
 			return fmt.Errorf("Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -48,6 +49,7 @@ type Net struct {
 	Type          string                 `json:"type,omitempty"`
 	Master        string                 `json:"master"`
 	Mode          string                 `json:"mode"`
+	Flags         string                 `json:"flags,omitempty"`
 	IPAM          *allocator.IPAMConfig  `json:"ipam"`
 	DNS           types.DNS              `json:"dns"`
 	RawPrevResult map[string]interface{} `json:"prevResult,omitempty"`
@@ -376,6 +378,68 @@ var _ = Describe("ipvlan Operations", func() {
 				Expect(err).NotTo(HaveOccurred())
 			})
 
+			It(fmt.Sprintf("[%s] creates an ipvlan link with the configured flags", ver), func() {
+				conf := &NetConf{
+					NetConf: types.NetConf{
+						CNIVersion: ver,
+						Name:       "testConfig",
+						Type:       "ipvlan",
+					},
+					Master:     masterInterface,
+					Mode:       "l2",
+					Flags:      "private",
+					MTU:        1500,
+					LinkContNs: isInContainer,
+				}
+
+				var masterIndex int
+				err := originalNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					_, err := createIpvlan(conf, "foobar0", targetNS)
+					Expect(err).NotTo(HaveOccurred())
+
+					if !isInContainer {
+						m, err := netlinksafe.LinkByName(masterInterface)
+						Expect(err).NotTo(HaveOccurred())
+						masterIndex = m.Attrs().Index
+					}
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = targetNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					link, err := netlinksafe.LinkByName("foobar0")
+					Expect(err).NotTo(HaveOccurred())
+					ipv, ok := link.(*netlink.IPVlan)
+					Expect(ok).To(BeTrue())
+					Expect(ipv.Flag).To(Equal(netlink.IPVLAN_FLAG_PRIVATE))
+
+					if isInContainer {
+						m, err := netlinksafe.LinkByName(masterInterface)
+						Expect(err).NotTo(HaveOccurred())
+						masterIndex = m.Attrs().Index
+					}
+
+					contMap := types100.Interface{Name: "foobar0", Sandbox: targetNS.Path()}
+					Expect(validateCniContainerInterface(contMap, conf, masterIndex)).To(Succeed())
+
+					wrong := *conf
+					wrong.Flags = "vepa"
+					Expect(validateCniContainerInterface(contMap, &wrong, masterIndex)).To(MatchError(ContainSubstring("flags private does not match")))
+
+					wrong = *conf
+					wrong.MTU = 1400
+					Expect(validateCniContainerInterface(contMap, &wrong, masterIndex)).To(MatchError(ContainSubstring("MTU 1500 does not match")))
+
+					Expect(validateCniContainerInterface(contMap, conf, masterIndex+1000)).To(MatchError(ContainSubstring("is not a slave of master")))
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
 			It(fmt.Sprintf("[%s] configures and deconfigures an iplvan link with ADD/DEL", ver), func() {
 				conf := fmt.Sprintf(`{
 			    "cniVersion": "%s",
@@ -504,3 +568,175 @@ var _ = Describe("ipvlan Operations", func() {
 		}
 	}
 })
+
+var _ = Describe("ipvlan chained master", func() {
+	conf := func(linkInContainer bool, interfaces string) []byte {
+		return []byte(fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ipvlan",
+			"linkInContainer": %t,
+			"prevResult": {
+				"cniVersion": "1.0.0",
+				"interfaces": %s
+			}
+		}`, linkInContainer, interfaces))
+	}
+
+	args := func(stdin []byte) *skel.CmdArgs {
+		return &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       "/var/run/netns/test",
+			IfName:      "net1",
+			StdinData:   stdin,
+		}
+	}
+
+	It("uses the single interface of the previous result", func() {
+		n, _, err := loadConf(args(conf(false, `[{"name": "eth0"}]`)), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Master).To(Equal("eth0"))
+	})
+
+	It("uses the interface placed in the container with linkInContainer", func() {
+		n, _, err := loadConf(args(conf(true, `[
+			{"name": "veth1234"},
+			{"name": "eth0", "sandbox": "/var/run/netns/test"}
+		]`)), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Master).To(Equal("eth0"))
+	})
+
+	It("fails when the container interface is ambiguous", func() {
+		_, _, err := loadConf(args(conf(true, `[
+			{"name": "eth0", "sandbox": "/var/run/netns/test"},
+			{"name": "eth1", "sandbox": "/var/run/netns/test"}
+		]`)), false)
+		Expect(err).To(MatchError(ContainSubstring("several interfaces in the container")))
+
+		_, _, err = loadConf(args(conf(true, `[{"name": "veth1234"}]`)), false)
+		Expect(err).To(MatchError(ContainSubstring("lacks a named interface in the container")))
+	})
+})
+
+var _ = Describe("ipvlan host shim configuration", func() {
+	load := func(extra string) error {
+		_, _, err := loadConf(&skel.CmdArgs{StdinData: []byte(fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ipvlan",
+			"master": "eth0",
+			%s
+		}`, extra))}, false)
+		return err
+	}
+
+	It("validates the shim addresses", func() {
+		Expect(load(`"hostShim": {"addresses": ["10.1.0.254", "fd00::fe"]}`)).To(Succeed())
+		Expect(load(`"hostShim": {}`)).To(MatchError("hostShim requires addresses"))
+		Expect(load(`"hostShim": {"addresses": ["10.1.0.0/24"]}`)).To(MatchError(ContainSubstring("invalid hostShim address")))
+		Expect(load(`"hostShim": {"addresses": ["10.1.0.1", "10.1.0.2"]}`)).To(MatchError("hostShim has several IPv4 addresses"))
+	})
+
+	It("refuses the private flags and linkInContainer", func() {
+		Expect(load(`"flags": "private", "hostShim": {"addresses": ["10.1.0.254"]}`)).To(MatchError(ContainSubstring("private")))
+		Expect(load(`"linkInContainer": true, "hostShim": {"addresses": ["10.1.0.254"]}`)).To(MatchError(ContainSubstring("linkInContainer")))
+	})
+})
+
+var _ = Describe("ipvlan host shim", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	const masterName = "master0"
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "ipvlan_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: netlink.LinkAttrs{Name: masterName},
+				PeerName:  "peer0",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(masterName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("routes the pod addresses through a shared shim and removes it with the last pod", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ipvlan",
+			"master": %q,
+			"mode": "l3",
+			"dataDir": %q,
+			"hostShim": {"addresses": ["10.1.0.254"]},
+			"prevResult": {
+				"cniVersion": "1.0.0",
+				"ips": [{"address": "10.1.0.2/24"}]
+			}
+		}`, masterName, dataDir)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "eth0",
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+			Expect(err).NotTo(HaveOccurred())
+
+			shim, err := netlinksafe.LinkByName(shimName(masterName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shim).To(BeAssignableToTypeOf(&netlink.IPVlan{}))
+			Expect(shim.(*netlink.IPVlan).Mode).To(Equal(netlink.IPVLAN_MODE_L3))
+
+			addrs, err := netlinksafe.AddrList(shim, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(1))
+			Expect(addrs[0].IPNet.String()).To(Equal("10.1.0.254/32"))
+
+			routes, err := netlinksafe.RouteList(shim, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			found := false
+			for _, r := range routes {
+				if r.Dst != nil && r.Dst.String() == "10.1.0.2/32" {
+					Expect(r.Src.String()).To(Equal("10.1.0.254"))
+					found = true
+				}
+			}
+			Expect(found).To(BeTrue())
+
+			err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = netlinksafe.LinkByName(shimName(masterName))
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+			Expect(filepath.Join(dataDir, "shims", shimName(masterName))).NotTo(BeADirectory())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
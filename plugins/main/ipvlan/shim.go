@@ -0,0 +1,240 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/vishvananda/netlink"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/utils"
+)
+
+const defaultDataDir = "/run/cni/ipvlan"
+
+// HostShim makes the pods reachable from the host, which the ipvlan
+// driver otherwise isolates from its slaves. The shim is an ipvlan slave
+// of the master in the host namespace, shared by all the pods of the
+// master, with a /32 or /128 route to every pod address.
+type HostShim struct {
+	// Addresses are assigned to the shim, at most one per IP family. They
+	// are the source of the host routes, so that the pod replies are
+	// delivered to the shim rather than sent out of the master.
+	Addresses []string `json:"addresses"`
+
+	addrs []*net.IPNet
+}
+
+func (s *HostShim) parse() error {
+	if len(s.Addresses) == 0 {
+		return fmt.Errorf("hostShim requires addresses")
+	}
+	var v4, v6 bool
+	for _, a := range s.Addresses {
+		addr := net.ParseIP(a)
+		if addr == nil {
+			return fmt.Errorf("invalid hostShim address %q", a)
+		}
+		ipn := &net.IPNet{IP: addr.To4(), Mask: net.CIDRMask(32, 32)}
+		if ipn.IP == nil {
+			ipn = &net.IPNet{IP: addr, Mask: net.CIDRMask(128, 128)}
+			if v6 {
+				return fmt.Errorf("hostShim has several IPv6 addresses")
+			}
+			v6 = true
+		} else {
+			if v4 {
+				return fmt.Errorf("hostShim has several IPv4 addresses")
+			}
+			v4 = true
+		}
+		s.addrs = append(s.addrs, ipn)
+	}
+	return nil
+}
+
+// source returns the shim address of the family of ip, or nil
+func (s *HostShim) source(ip net.IP) net.IP {
+	for _, a := range s.addrs {
+		if (a.IP.To4() == nil) == (ip.To4() == nil) {
+			return a.IP
+		}
+	}
+	return nil
+}
+
+func shimName(master string) string {
+	return utils.MustFormatHashWithPrefix(15, "ipvsh", master)
+}
+
+// openShimStore opens the store of the shim users, a group per shim
+// holding the pod addresses routed through it for each attachment
+func openShimStore(dataDir string) (*attachments.Store, error) {
+	return attachments.Open(filepath.Join(dataDir, "shims"))
+}
+
+// ensureShim creates the shim of the master unless it exists
+func ensureShim(conf *NetConf, master netlink.Link) (netlink.Link, error) {
+	name := shimName(master.Attrs().Name)
+	shim, err := netlinksafe.LinkByName(name)
+	if err == nil {
+		return shim, nil
+	}
+	if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return nil, fmt.Errorf("failed to lookup host shim %q: %v", name, err)
+	}
+
+	mode, err := modeFromString(conf.Mode)
+	if err != nil {
+		return nil, err
+	}
+	flag, err := flagFromString(conf.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.Name = name
+	linkAttrs.ParentIndex = master.Attrs().Index
+	if err := netlink.LinkAdd(&netlink.IPVlan{LinkAttrs: linkAttrs, Mode: mode, Flag: flag}); err != nil {
+		return nil, fmt.Errorf("failed to create host shim %q: %v", name, err)
+	}
+	shim, err = netlinksafe.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup host shim %q: %v", name, err)
+	}
+
+	for _, a := range conf.HostShim.addrs {
+		if err := netlink.AddrAdd(shim, &netlink.Addr{IPNet: a}); err != nil {
+			_ = netlink.LinkDel(shim)
+			return nil, fmt.Errorf("failed to add %s to host shim %q: %v", a, name, err)
+		}
+	}
+	if err := netlink.LinkSetUp(shim); err != nil {
+		_ = netlink.LinkDel(shim)
+		return nil, fmt.Errorf("failed to set host shim %q up: %v", name, err)
+	}
+	return shim, nil
+}
+
+func shimRoute(shim netlink.Link, ip, src net.IP) *netlink.Route {
+	bits := 32
+	if ip.To4() == nil {
+		bits = 128
+	}
+	return &netlink.Route{
+		LinkIndex: shim.Attrs().Index,
+		Dst:       &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)},
+		Src:       src,
+		Scope:     netlink.SCOPE_LINK,
+	}
+}
+
+// setupHostShim routes the pod addresses of the result through the shim of
+// the master, and records the attachment as a user of the shim. It must be
+// called in the host namespace.
+func setupHostShim(conf *NetConf, containerID, ifName string, result *current.Result) error {
+	store, err := openShimStore(conf.DataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	master, err := netlinksafe.LinkByName(conf.Master)
+	if err != nil {
+		return fmt.Errorf("failed to lookup master %q: %v", conf.Master, err)
+	}
+	shim, err := ensureShim(conf, master)
+	if err != nil {
+		return err
+	}
+
+	var ips []net.IP
+	for _, ipc := range result.IPs {
+		if conf.HostShim.source(ipc.Address.IP) != nil {
+			ips = append(ips, ipc.Address.IP)
+		}
+	}
+
+	// Record the attachment first, so that a failure is cleaned up by DEL
+	if err := store.PutJSON(shim.Attrs().Name, attachments.ID(containerID, ifName), ips); err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		if err := netlink.RouteReplace(shimRoute(shim, ip, conf.HostShim.source(ip))); err != nil {
+			return fmt.Errorf("failed to route %s through host shim: %v", ip, err)
+		}
+	}
+	return nil
+}
+
+// teardownHostShim removes the routes of the attachment, and the shim once
+// it has no user left. The master is not needed as the references are
+// looked up by attachment.
+func teardownHostShim(dataDir, containerID, ifName string) error {
+	if _, err := os.Stat(filepath.Join(dataDir, "shims")); os.IsNotExist(err) {
+		return nil
+	}
+
+	store, err := openShimStore(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	id := attachments.ID(containerID, ifName)
+	names, err := store.GroupsOf(id)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		var ips []net.IP
+		if _, err := store.GetJSON(name, id, &ips); err != nil {
+			return err
+		}
+
+		shim, err := netlinksafe.LinkByName(name)
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); !ok {
+				return fmt.Errorf("failed to lookup host shim %q: %v", name, err)
+			}
+			shim = nil
+		}
+		if shim != nil {
+			for _, ip := range ips {
+				_ = netlink.RouteDel(shimRoute(shim, ip, nil))
+			}
+		}
+
+		left, err := store.Remove(name, id)
+		if err != nil {
+			return err
+		}
+		if left > 0 || shim == nil {
+			continue
+		}
+		if err := netlink.LinkDel(shim); err != nil {
+			return fmt.Errorf("failed to delete host shim %q: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"syscall"
 
 	"github.com/vishvananda/netlink"
 
@@ -31,14 +32,38 @@ import (
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 )
 
-func parseNetConf(bytes []byte) (*types.NetConf, error) {
-	conf := &types.NetConf{}
+// defaultMTU is the MTU of lo, restored on DEL
+const defaultMTU = 65536
+
+type NetConf struct {
+	types.NetConf
+	// Addresses are added to lo besides the loopback addresses, such as
+	// the service VIPs of direct server return load balancing
+	Addresses []string `json:"addresses,omitempty"`
+	MTU       int      `json:"mtu,omitempty"`
+
+	addrs []*net.IPNet
+}
+
+func parseNetConf(bytes []byte) (*NetConf, error) {
+	conf := &NetConf{}
 	if err := json.Unmarshal(bytes, conf); err != nil {
 		return nil, fmt.Errorf("failed to parse network config: %v", err)
 	}
 
+	for _, a := range conf.Addresses {
+		addr, err := netlink.ParseIPNet(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %v", a, err)
+		}
+		conf.addrs = append(conf.addrs, addr)
+	}
+	if conf.MTU < 0 {
+		return nil, fmt.Errorf("invalid mtu %d", conf.MTU)
+	}
+
 	if conf.RawPrevResult != nil {
-		if err := version.ParsePrevResult(conf); err != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
 			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
 		}
 		if _, err := current.NewResultFromResult(conf.PrevResult); err != nil {
@@ -49,6 +74,16 @@ func parseNetConf(bytes []byte) (*types.NetConf, error) {
 	return conf, nil
 }
 
+// configured reports whether the address is one of the configured ones
+func (conf *NetConf) configured(addr *net.IPNet) bool {
+	for _, a := range conf.addrs {
+		if a.IP.Equal(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
 func cmdAdd(args *skel.CmdArgs) error {
 	conf, err := parseNetConf(args.StdinData)
 	if err != nil {
@@ -64,6 +99,12 @@ func cmdAdd(args *skel.CmdArgs) error {
 			return err // not tested
 		}
 
+		if conf.MTU != 0 {
+			if err := netlink.LinkSetMTU(link, conf.MTU); err != nil {
+				return fmt.Errorf("failed to set lo MTU to %d: %v", conf.MTU, err)
+			}
+		}
+
 		err = netlink.LinkSetUp(link)
 		if err != nil {
 			return err // not tested
@@ -77,7 +118,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 			v4Addr = v4Addrs[0].IPNet
 			// sanity check that this is a loopback address
 			for _, addr := range v4Addrs {
-				if !addr.IP.IsLoopback() {
+				if !addr.IP.IsLoopback() && !conf.configured(addr.IPNet) {
 					return fmt.Errorf("loopback interface found with non-loopback address %q", addr.IP)
 				}
 			}
@@ -91,12 +132,18 @@ func cmdAdd(args *skel.CmdArgs) error {
 			v6Addr = v6Addrs[0].IPNet
 			// sanity check that this is a loopback address
 			for _, addr := range v6Addrs {
-				if !addr.IP.IsLoopback() {
+				if !addr.IP.IsLoopback() && !conf.configured(addr.IPNet) {
 					return fmt.Errorf("loopback interface found with non-loopback address %q", addr.IP)
 				}
 			}
 		}
 
+		for _, addr := range conf.addrs {
+			if err := netlink.AddrReplace(link, &netlink.Addr{IPNet: addr}); err != nil {
+				return fmt.Errorf("failed to add %s to lo: %v", addr, err)
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -134,6 +181,16 @@ func cmdAdd(args *skel.CmdArgs) error {
 			})
 		}
 
+		for _, addr := range conf.addrs {
+			if (v4Addr != nil && addr.IP.Equal(v4Addr.IP)) || (v6Addr != nil && addr.IP.Equal(v6Addr.IP)) {
+				continue
+			}
+			r.IPs = append(r.IPs, &current.IPConfig{
+				Interface: current.Int(0),
+				Address:   *addr,
+			})
+		}
+
 		result = r
 	}
 
@@ -144,13 +201,29 @@ func cmdDel(args *skel.CmdArgs) error {
 	if args.Netns == "" {
 		return nil
 	}
+	conf, err := parseNetConf(args.StdinData)
+	if err != nil {
+		return err
+	}
 	args.IfName = "lo" // ignore config, this only works for loopback
-	err := ns.WithNetNSPath(args.Netns, func(ns.NetNS) error {
+	err = ns.WithNetNSPath(args.Netns, func(ns.NetNS) error {
 		link, err := netlinksafe.LinkByName(args.IfName)
 		if err != nil {
 			return err // not tested
 		}
 
+		for _, addr := range conf.addrs {
+			err := netlink.AddrDel(link, &netlink.Addr{IPNet: addr})
+			if err != nil && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+				return fmt.Errorf("failed to delete %s from lo: %v", addr, err)
+			}
+		}
+		if conf.MTU != 0 && link.Attrs().MTU != defaultMTU {
+			if err := netlink.LinkSetMTU(link, defaultMTU); err != nil {
+				return fmt.Errorf("failed to restore lo MTU: %v", err)
+			}
+		}
+
 		err = netlink.LinkSetDown(link)
 		if err != nil {
 			return err // not tested
@@ -183,6 +256,10 @@ func main() {
 }
 
 func cmdCheck(args *skel.CmdArgs) error {
+	conf, err := parseNetConf(args.StdinData)
+	if err != nil {
+		return err
+	}
 	args.IfName = "lo" // ignore config, this only works for loopback
 
 	return ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
@@ -195,6 +272,27 @@ func cmdCheck(args *skel.CmdArgs) error {
 			return errors.New("loopback interface is down")
 		}
 
+		if conf.MTU != 0 && link.Attrs().MTU != conf.MTU {
+			return fmt.Errorf("lo MTU is %d, expected %d", link.Attrs().MTU, conf.MTU)
+		}
+
+		addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("failed to list lo addresses: %v", err)
+		}
+		for _, want := range conf.addrs {
+			found := false
+			for _, addr := range addrs {
+				if addr.IP.Equal(want.IP) && addr.Mask.String() == want.Mask.String() {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("lo is missing address %s", want)
+			}
+		}
+
 		return nil
 	})
 }
@@ -112,3 +112,102 @@ var _ = Describe("Loopback", func() {
 		})
 	}
 })
+
+var _ = Describe("Loopback addresses and MTU", func() {
+	var networkNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		networkNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(networkNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(networkNS)).To(Succeed())
+	})
+
+	run := func(command, conf string) *gexec.Session {
+		cmd := exec.Command(pathToLoPlugin)
+		cmd.Stdin = strings.NewReader(conf)
+		cmd.Env = []string{
+			"CNI_COMMAND=" + command,
+			"CNI_CONTAINERID=dummy",
+			"CNI_NETNS=" + networkNS.Path(),
+			"CNI_IFNAME=lo",
+			"CNI_PATH=/some/test/path",
+		}
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	loAddrs := func() []string {
+		var addrs []string
+		err := networkNS.Do(func(ns.NetNS) error {
+			lo, err := net.InterfaceByName("lo")
+			if err != nil {
+				return err
+			}
+			as, err := lo.Addrs()
+			for _, a := range as {
+				addrs = append(addrs, a.String())
+			}
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return addrs
+	}
+
+	loMTU := func() int {
+		var mtu int
+		err := networkNS.Do(func(ns.NetNS) error {
+			lo, err := net.InterfaceByName("lo")
+			if err != nil {
+				return err
+			}
+			mtu = lo.MTU
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return mtu
+	}
+
+	It("adds the addresses and sets the MTU with ADD/CHECK/DEL", func() {
+		conf := `{
+			"name": "loopback-test",
+			"cniVersion": "1.0.0",
+			"addresses": ["192.0.2.10/32", "2001:db8::10/128"],
+			"mtu": 9000
+		}`
+
+		session := run("ADD", conf)
+		Expect(session.ExitCode()).To(Equal(0))
+		Expect(session.Out).To(gbytes.Say(`"address": "192.0.2.10/32"`))
+		Expect(loAddrs()).To(ContainElements("192.0.2.10/32", "2001:db8::10/128"))
+		Expect(loMTU()).To(Equal(9000))
+
+		// ADD is idempotent
+		Expect(run("ADD", conf).ExitCode()).To(Equal(0))
+		Expect(run("CHECK", conf).ExitCode()).To(Equal(0))
+
+		err := networkNS.Do(func(ns.NetNS) error {
+			return exec.Command("ip", "addr", "del", "192.0.2.10/32", "dev", "lo").Run()
+		})
+		Expect(err).NotTo(HaveOccurred())
+		session = run("CHECK", conf)
+		Expect(session.ExitCode()).NotTo(Equal(0))
+		Expect(session.Out).To(gbytes.Say("lo is missing address 192.0.2.10/32"))
+
+		Expect(run("DEL", conf).ExitCode()).To(Equal(0))
+		Expect(loAddrs()).NotTo(ContainElement("2001:db8::10/128"))
+		Expect(loMTU()).To(Equal(65536))
+	})
+
+	It("rejects invalid addresses", func() {
+		session := run("ADD", `{"name": "loopback-test", "cniVersion": "1.0.0", "addresses": ["192.0.2.10"]}`)
+		Expect(session.ExitCode()).NotTo(Equal(0))
+		Expect(session.Out).To(gbytes.Say(`invalid address`))
+	})
+})
@@ -0,0 +1,142 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Keys holds the secure channels of the device and their security
+// associations: the transmit one, and one per peer it receives from
+type Keys struct {
+	TxSA  *SA    `json:"txSA,omitempty"`
+	RxSCs []RxSC `json:"rxSCs,omitempty"`
+}
+
+// RxSC is the secure channel of a peer, identified by its SCI, the MAC
+// address and port it transmits with
+type RxSC struct {
+	Address string `json:"address"`
+	// Port defaults to 1, as with iproute2
+	Port uint16 `json:"port,omitempty"`
+	SAs  []SA   `json:"sas"`
+
+	sci sci
+}
+
+// SA is a security association of a secure channel, with its key in hex
+type SA struct {
+	// AN is the association number, from 0 to 3
+	AN uint8 `json:"an"`
+	// PN is the first packet number, 1 by default
+	PN    uint32 `json:"pn,omitempty"`
+	KeyID string `json:"keyId"`
+	Key   string `json:"key"`
+
+	keyID [keyIDLen]byte
+	key   []byte
+}
+
+// loadKeysFile reads the keys of the device from the file
+func loadKeysFile(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keysFile: %v", err)
+	}
+	keys := &Keys{}
+	if err := json.Unmarshal(data, keys); err != nil {
+		return nil, fmt.Errorf("failed to parse keysFile: %v", err)
+	}
+	return keys, nil
+}
+
+// parse validates the keys for the cipher suite, whose keys are keyLen
+// bytes long
+func (k *Keys) parse(keyLen int) error {
+	if k.TxSA != nil {
+		if err := k.TxSA.parse(keyLen); err != nil {
+			return fmt.Errorf("invalid txSA: %v", err)
+		}
+	}
+	seen := map[sci]bool{}
+	for i := range k.RxSCs {
+		rxsc := &k.RxSCs[i]
+		if err := rxsc.parse(keyLen); err != nil {
+			return fmt.Errorf("invalid rxSC %d: %v", i, err)
+		}
+		if seen[rxsc.sci] {
+			return fmt.Errorf("duplicate rxSC %s", rxsc.sci)
+		}
+		seen[rxsc.sci] = true
+	}
+	return nil
+}
+
+func (r *RxSC) parse(keyLen int) error {
+	mac, err := net.ParseMAC(r.Address)
+	if err != nil || len(mac) != 6 {
+		return fmt.Errorf("invalid address %q, must be a MAC address", r.Address)
+	}
+	if r.Port == 0 {
+		r.Port = defaultPort
+	}
+	r.sci = makeSCI(mac, r.Port)
+
+	seen := map[uint8]bool{}
+	for i := range r.SAs {
+		if err := r.SAs[i].parse(keyLen); err != nil {
+			return fmt.Errorf("invalid SA %d: %v", i, err)
+		}
+		if seen[r.SAs[i].AN] {
+			return fmt.Errorf("duplicate SA with an %d", r.SAs[i].AN)
+		}
+		seen[r.SAs[i].AN] = true
+	}
+	return nil
+}
+
+func (s *SA) parse(keyLen int) error {
+	if s.AN > 3 {
+		return fmt.Errorf("invalid an %d, must be [0, 3]", s.AN)
+	}
+	if s.PN == 0 {
+		s.PN = 1
+	}
+
+	key, err := hex.DecodeString(strings.TrimPrefix(s.Key, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid key: %v", err)
+	}
+	if len(key) != keyLen {
+		return fmt.Errorf("invalid key of %d bytes, the cipher suite takes %d", len(key), keyLen)
+	}
+	s.key = key
+
+	// The key ID is padded with zeros, as with iproute2
+	keyID, err := hex.DecodeString(strings.TrimPrefix(s.KeyID, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid keyId: %v", err)
+	}
+	if len(keyID) == 0 || len(keyID) > keyIDLen {
+		return fmt.Errorf("invalid keyId of %d bytes, must be 1 to %d", len(keyID), keyIDLen)
+	}
+	copy(s.keyID[:], keyID)
+	return nil
+}
@@ -0,0 +1,533 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating a MACsec device on a host interface in the
+// container, encrypting its frames on the link.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+// cipherSuites are the cipher suites by name, with the length of their keys
+var cipherSuites = map[string]struct {
+	id     uint64
+	keyLen int
+}{
+	"gcm-aes-128": {cipherGCMAES128, 16},
+	"gcm-aes-256": {cipherGCMAES256, 32},
+}
+
+var validations = map[string]uint8{
+	"disabled": validateDisabled,
+	"check":    validateCheck,
+	"strict":   validateStrict,
+}
+
+type NetConf struct {
+	types.NetConf
+	Master string `json:"master"`
+	// Port and MAC make the SCI of the device, which must be unique among
+	// the MACsec devices of the master. MAC defaults to the one of the
+	// master.
+	Port uint16 `json:"port,omitempty"`
+	MAC  string `json:"mac,omitempty"`
+	// CipherSuite is gcm-aes-128 (default) or gcm-aes-256
+	CipherSuite string `json:"cipherSuite,omitempty"`
+	ICVLen      uint8  `json:"icvLen,omitempty"`
+	// Encrypt defaults to true, frames are only authenticated otherwise
+	Encrypt *bool `json:"encrypt,omitempty"`
+	// Validate is the validation of the received frames: strict (default),
+	// check or disabled
+	Validate      string `json:"validate,omitempty"`
+	ReplayProtect bool   `json:"replayProtect,omitempty"`
+	ReplayWindow  uint32 `json:"replayWindow,omitempty"`
+	MTU           int    `json:"mtu,omitempty"`
+	// KeysFile is the path of a file holding the secure channels and
+	// associations of the device. The ones of the runtime configuration
+	// take precedence.
+	KeysFile string `json:"keysFile,omitempty"`
+
+	RuntimeConfig struct {
+		Keys *Keys `json:"macsecKeys,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+
+	mac        net.HardwareAddr
+	cipher     uint64
+	keyLen     int
+	validation uint8
+	keys       *Keys
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	if n.Master == "" {
+		return nil, fmt.Errorf(`"master" field is required. It specifies the host interface name to create the MACsec device on`)
+	}
+	if n.Port == 0 {
+		n.Port = defaultPort
+	}
+	if n.MAC != "" {
+		mac, err := net.ParseMAC(n.MAC)
+		if err != nil || len(mac) != 6 {
+			return nil, fmt.Errorf("invalid MAC address %q", n.MAC)
+		}
+		n.mac = mac
+	}
+
+	if n.CipherSuite == "" {
+		n.CipherSuite = "gcm-aes-128"
+	}
+	suite, ok := cipherSuites[n.CipherSuite]
+	if !ok {
+		return nil, fmt.Errorf("invalid cipherSuite %q, must be gcm-aes-128 or gcm-aes-256", n.CipherSuite)
+	}
+	n.cipher, n.keyLen = suite.id, suite.keyLen
+
+	if n.ICVLen == 0 {
+		n.ICVLen = 16
+	}
+	if n.ICVLen < 8 || n.ICVLen > 16 {
+		return nil, fmt.Errorf("invalid icvLen %d, must be [8, 16]", n.ICVLen)
+	}
+	if n.Encrypt == nil {
+		encrypt := true
+		n.Encrypt = &encrypt
+	}
+	if n.Validate == "" {
+		n.Validate = "strict"
+	}
+	if n.validation, ok = validations[n.Validate]; !ok {
+		return nil, fmt.Errorf("invalid validate %q, must be strict, check or disabled", n.Validate)
+	}
+	if n.ReplayWindow != 0 && !n.ReplayProtect {
+		return nil, fmt.Errorf("replayWindow requires replayProtect")
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	return n, nil
+}
+
+// loadKeys loads the keys of the runtime configuration or else of the keys
+// file. DEL doesn't need them, and the file may be gone by then.
+func (n *NetConf) loadKeys() error {
+	keys := n.RuntimeConfig.Keys
+	if keys == nil && n.KeysFile != "" {
+		var err error
+		if keys, err = loadKeysFile(n.KeysFile); err != nil {
+			return err
+		}
+	}
+	if keys == nil {
+		// The keys are left to a key agreement daemon in the container
+		n.keys = &Keys{}
+		return nil
+	}
+	if err := keys.parse(n.keyLen); err != nil {
+		return err
+	}
+	n.keys = keys
+	return nil
+}
+
+// encodingSA is the association number of the SA the frames are sent with
+func (n *NetConf) encodingSA() uint8 {
+	if n.keys != nil && n.keys.TxSA != nil {
+		return n.keys.TxSA.AN
+	}
+	return 0
+}
+
+// hasIPAM reports whether addresses are assigned to the device
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+func createMacsec(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	macsec := &current.Interface{}
+
+	m, err := netlinksafe.LinkByName(conf.Master)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup master %q: %v", conf.Master, err)
+	}
+
+	// The device is created with a temporary name so as not to collide
+	// with the devices of the host
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addMacsec(tmpName, m.Attrs().Index, conf); err != nil {
+		if errors.Is(err, unix.EBUSY) {
+			return nil, fmt.Errorf("failed to create macsec: %q has a MACsec device with the same SCI, the port or MAC must differ: %v", conf.Master, err)
+		}
+		return nil, fmt.Errorf("failed to create macsec: %v", err)
+	}
+	link, err := netlinksafe.LinkByName(tmpName)
+	if err != nil {
+		_ = ip.DelLinkByName(tmpName)
+		return nil, fmt.Errorf("failed to lookup macsec %q: %v", tmpName, err)
+	}
+
+	// Delete the device if it can't be configured and moved
+	err = func() error {
+		if conf.MTU != 0 {
+			if err := netlink.LinkSetMTU(link, conf.MTU); err != nil {
+				return fmt.Errorf("failed to set MTU of macsec to %d: %v", conf.MTU, err)
+			}
+		}
+		if err := installKeys(link.Attrs().Index, conf.keys); err != nil {
+			return err
+		}
+		if err := netlink.LinkSetNsFd(link, int(netns.Fd())); err != nil {
+			return fmt.Errorf("failed to move macsec %q to the container: %v", tmpName, err)
+		}
+		return nil
+	}()
+	if err != nil {
+		_ = netlink.LinkDel(link)
+		return nil, err
+	}
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		err := ip.RenameLink(tmpName, ifName)
+		if err != nil {
+			_ = ip.DelLinkByName(tmpName)
+			return fmt.Errorf("failed to rename macsec to %q: %v", ifName, err)
+		}
+		macsec.Name = ifName
+
+		contMacsec, err := netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to refetch macsec %q: %v", ifName, err)
+		}
+		macsec.Mac = contMacsec.Attrs().HardwareAddr.String()
+		macsec.Sandbox = netns.Path()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return macsec, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if err := n.loadKeys(); err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	macsecInterface, err := createMacsec(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{macsecInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the macsec interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	// The secure channels and associations go with the device
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if err := n.loadKeys(); err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("macsec: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("macsec: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+	if link.Type() != "macsec" {
+		return fmt.Errorf("macsec: Container interface %s not of type macsec", intf.Name)
+	}
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("macsec: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("macsec: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+
+	secy, err := getSecY(link.Attrs().Index)
+	if err != nil {
+		return fmt.Errorf("macsec: failed to get the configuration of %s: %v", intf.Name, err)
+	}
+	return validateSecY(intf.Name, secy, n)
+}
+
+// validateSecY checks the configuration of the device, and that the secure
+// channels and associations of the keys are installed and active
+func validateSecY(name string, secy *secY, n *NetConf) error {
+	cipher := secy.cipherSuite
+	if cipher == cipherDefault {
+		cipher = cipherGCMAES128
+	}
+	if cipher != n.cipher {
+		return fmt.Errorf("macsec: Interface %s cipher suite %#x doesn't match configured cipherSuite %s", name, secy.cipherSuite, n.CipherSuite)
+	}
+	if secy.sci.port() != n.Port {
+		return fmt.Errorf("macsec: Interface %s port %d doesn't match configured port %d", name, secy.sci.port(), n.Port)
+	}
+	if secy.icvLen != n.ICVLen {
+		return fmt.Errorf("macsec: Interface %s ICV length %d doesn't match configured icvLen %d", name, secy.icvLen, n.ICVLen)
+	}
+	if secy.encrypt != *n.Encrypt {
+		return fmt.Errorf("macsec: Interface %s encrypt %t doesn't match configured encrypt %t", name, secy.encrypt, *n.Encrypt)
+	}
+	if secy.validation != n.validation {
+		return fmt.Errorf("macsec: Interface %s validation %d doesn't match configured validate %s", name, secy.validation, n.Validate)
+	}
+	if secy.replayProtect != n.ReplayProtect || (n.ReplayProtect && secy.window != n.ReplayWindow) {
+		return fmt.Errorf("macsec: Interface %s replay protection doesn't match the configuration", name)
+	}
+	if secy.encodingSA != n.encodingSA() {
+		return fmt.Errorf("macsec: Interface %s encoding SA %d doesn't match configured txSA %d", name, secy.encodingSA, n.encodingSA())
+	}
+
+	if sa := n.keys.TxSA; sa != nil && !secy.txSAs[sa.AN] {
+		return fmt.Errorf("macsec: Interface %s tx SA %d not found or inactive", name, sa.AN)
+	}
+	for _, rxsc := range n.keys.RxSCs {
+		sas, ok := secy.rxSCs[rxsc.sci]
+		if !ok {
+			return fmt.Errorf("macsec: Interface %s rx SC %s not found", name, rxsc.sci)
+		}
+		for _, sa := range rxsc.SAs {
+			if !sas[sa.AN] {
+				return fmt.Errorf("macsec: Interface %s rx SA %d of SC %s not found or inactive", name, sa.AN, rxsc.sci)
+			}
+		}
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("macsec"))
+}
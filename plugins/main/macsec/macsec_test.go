@@ -0,0 +1,334 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	MASTER_NAME = "eth0"
+	IFNAME      = "macsec0"
+)
+
+const keysConf = `{
+	"txSA": {"an": 1, "keyId": "01", "key": "0x000102030405060708090a0b0c0d0e0f"},
+	"rxSCs": [{
+		"address": "02:00:00:00:00:02",
+		"sas": [{"an": 1, "pn": 100, "keyId": "02", "key": "0x101112131415161718191a1b1c1d1e1f"}]
+	}]
+}`
+
+var _ = Describe("macsec configuration", func() {
+	It("requires a master", func() {
+		_, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "macsec"}`))
+		Expect(err).To(MatchError(ContainSubstring(`"master" field is required`)))
+	})
+
+	It("defaults to encrypting with GCM-AES-128 on port 1", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "macsec", "master": "eth0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Port).To(BeEquivalentTo(1))
+		Expect(n.cipher).To(Equal(cipherGCMAES128))
+		Expect(n.keyLen).To(Equal(16))
+		Expect(n.ICVLen).To(BeEquivalentTo(16))
+		Expect(*n.Encrypt).To(BeTrue())
+		Expect(n.validation).To(BeEquivalentTo(validateStrict))
+		Expect(n.hasIPAM()).To(BeFalse())
+
+		Expect(n.loadKeys()).To(Succeed())
+		Expect(n.encodingSA()).To(BeZero())
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid cipher suite", `{"master": "eth0", "cipherSuite": "gcm-aes-xpn-128"}`, `invalid cipherSuite "gcm-aes-xpn-128"`),
+		Entry("with an invalid ICV length", `{"master": "eth0", "icvLen": 20}`, "invalid icvLen 20"),
+		Entry("with an invalid validation", `{"master": "eth0", "validate": "loose"}`, `invalid validate "loose"`),
+		Entry("with a window without replay protection", `{"master": "eth0", "replayWindow": 32}`, "replayWindow requires replayProtect"),
+		Entry("with an invalid MAC", `{"master": "eth0", "mac": "02:00:00:00:00"}`, `invalid MAC address "02:00:00:00:00"`),
+	)
+
+	It("prefers the keys of the runtime configuration to the keys file", func() {
+		dir, err := os.MkdirTemp("", "macsec_test")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		keysFile := filepath.Join(dir, "keys.json")
+		Expect(os.WriteFile(keysFile, []byte(keysConf), 0o600)).To(Succeed())
+
+		n, err := loadConf([]byte(fmt.Sprintf(`{"master": "eth0", "keysFile": "%s"}`, keysFile)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.loadKeys()).To(Succeed())
+		Expect(n.encodingSA()).To(BeEquivalentTo(1))
+		Expect(n.keys.TxSA.PN).To(BeEquivalentTo(1))
+		Expect(n.keys.TxSA.key).To(HaveLen(16))
+		Expect(n.keys.TxSA.keyID).To(Equal([keyIDLen]byte{0x01}))
+		Expect(n.keys.RxSCs).To(HaveLen(1))
+		Expect(n.keys.RxSCs[0].sci.String()).To(Equal("0200000000020001"))
+		Expect(n.keys.RxSCs[0].SAs[0].PN).To(BeEquivalentTo(100))
+
+		n, err = loadConf([]byte(fmt.Sprintf(`{
+			"master": "eth0",
+			"keysFile": "%s",
+			"runtimeConfig": {"macsecKeys": {"txSA": {"an": 2, "keyId": "03", "key": "000102030405060708090a0b0c0d0e0f"}}}
+		}`, filepath.Join(dir, "missing.json"))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.loadKeys()).To(Succeed())
+		Expect(n.encodingSA()).To(BeEquivalentTo(2))
+		Expect(n.keys.RxSCs).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid keys",
+		func(keys, msg string) {
+			k := &Keys{}
+			Expect(json.Unmarshal([]byte(keys), k)).To(Succeed())
+			Expect(k.parse(16)).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid an", `{"txSA": {"an": 4, "keyId": "01", "key": "000102030405060708090a0b0c0d0e0f"}}`, "invalid txSA: invalid an 4"),
+		Entry("with a key of another cipher suite", `{"txSA": {"an": 0, "keyId": "01", "key": "0001"}}`, "invalid key of 2 bytes, the cipher suite takes 16"),
+		Entry("without key ID", `{"txSA": {"an": 0, "key": "000102030405060708090a0b0c0d0e0f"}}`, "invalid keyId of 0 bytes"),
+		Entry("with an invalid address", `{"rxSCs": [{"address": "foo"}]}`, `invalid rxSC 0: invalid address "foo"`),
+		Entry("with duplicate channels", `{"rxSCs": [{"address": "02:00:00:00:00:02"}, {"address": "02:00:00:00:00:02", "port": 1}]}`, "duplicate rxSC 0200000000020001"),
+		Entry("with duplicate associations", `{"rxSCs": [{"address": "02:00:00:00:00:02", "sas": [
+			{"an": 1, "keyId": "01", "key": "000102030405060708090a0b0c0d0e0f"},
+			{"an": 1, "keyId": "02", "key": "000102030405060708090a0b0c0d0e0f"}]}]}`, "duplicate SA with an 1"),
+	)
+
+	It("parses the configuration of a device from its dump", func() {
+		n, err := loadConf([]byte(`{"master": "eth0", "port": 7}`))
+		Expect(err).NotTo(HaveOccurred())
+		n.RuntimeConfig.Keys = &Keys{}
+		Expect(json.Unmarshal([]byte(keysConf), n.RuntimeConfig.Keys)).To(Succeed())
+		Expect(n.loadKeys()).To(Succeed())
+
+		mac, _ := net.ParseMAC("02:00:00:00:00:01")
+		local := makeSCI(mac, 7)
+		peer := n.keys.RxSCs[0].sci
+
+		msg := make([]byte, nl.SizeofGenlmsg)
+		msg = append(msg, nl.NewRtAttr(attrIfIndex, nl.Uint32Attr(12)).Serialize()...)
+		secyAttr := nl.NewRtAttr(attrSecY|int(nl.NLA_F_NESTED), nil)
+		secyAttr.AddRtAttr(secYAttrSCI, local[:])
+		secyAttr.AddRtAttr(secYAttrCipherSuite, nl.Uint64Attr(cipherDefault))
+		secyAttr.AddRtAttr(secYAttrICVLen, nl.Uint8Attr(16))
+		secyAttr.AddRtAttr(secYAttrEncodingSA, nl.Uint8Attr(1))
+		secyAttr.AddRtAttr(secYAttrEncrypt, nl.Uint8Attr(1))
+		secyAttr.AddRtAttr(secYAttrValidate, nl.Uint8Attr(validateStrict))
+		secyAttr.AddRtAttr(secYAttrReplay, nl.Uint8Attr(0))
+		msg = append(msg, secyAttr.Serialize()...)
+		txSAs := nl.NewRtAttr(attrTxSAList|int(nl.NLA_F_NESTED), nil)
+		txSA := txSAs.AddRtAttr(1|int(nl.NLA_F_NESTED), nil)
+		txSA.AddRtAttr(saAttrAN, nl.Uint8Attr(1))
+		txSA.AddRtAttr(saAttrActive, nl.Uint8Attr(1))
+		msg = append(msg, txSAs.Serialize()...)
+		rxSCs := nl.NewRtAttr(attrRxSCList|int(nl.NLA_F_NESTED), nil)
+		rxSC := rxSCs.AddRtAttr(1|int(nl.NLA_F_NESTED), nil)
+		rxSC.AddRtAttr(rxSCAttrActive, nl.Uint8Attr(1))
+		rxSC.AddRtAttr(rxSCAttrSCI, peer[:])
+		rxSA := rxSC.AddRtAttr(rxSCAttrSAList|int(nl.NLA_F_NESTED), nil).AddRtAttr(1|int(nl.NLA_F_NESTED), nil)
+		rxSA.AddRtAttr(saAttrAN, nl.Uint8Attr(1))
+		rxSA.AddRtAttr(saAttrActive, nl.Uint8Attr(0))
+		msg = append(msg, rxSCs.Serialize()...)
+
+		index, secy, err := parseSecYMsg(msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(12))
+		Expect(secy.sci.port()).To(BeEquivalentTo(7))
+		Expect(secy.txSAs).To(Equal(map[uint8]bool{1: true}))
+		Expect(secy.rxSCs).To(HaveKeyWithValue(peer, map[uint8]bool{1: false}))
+
+		// The association of the peer is inactive
+		Expect(validateSecY(IFNAME, secy, n)).To(MatchError(ContainSubstring("rx SA 1 of SC 0200000000020001 not found or inactive")))
+		secy.rxSCs[peer][1] = true
+		Expect(validateSecY(IFNAME, secy, n)).To(Succeed())
+
+		n.ICVLen = 8
+		Expect(validateSecY(IFNAME, secy, n)).To(MatchError(ContainSubstring("ICV length 16 doesn't match configured icvLen 8")))
+	})
+})
+
+var _ = Describe("macsec Operations", func() {
+	var originalNS, targetNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = MASTER_NAME
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: linkAttrs,
+				PeerName:  "peer0",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(MASTER_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("configures, checks and deletes a MACsec device with its keys", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "macsec",
+			"type": "macsec",
+			"master": "%s",
+			"port": 2,
+			"mtu": 1400,
+			"runtimeConfig": {"macsecKeys": %s},
+			"ipam": {
+				"type": "static",
+				"addresses": [{"address": "10.1.2.2/24"}]
+			}
+		}`, MASTER_NAME, keysConf)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces).To(HaveLen(1))
+			Expect(result.Interfaces[0].Name).To(Equal(IFNAME))
+			Expect(result.Interfaces[0].Sandbox).To(Equal(targetNS.Path()))
+			Expect(result.IPs).To(HaveLen(1))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Type()).To(Equal("macsec"))
+			Expect(link.Attrs().MTU).To(Equal(1400))
+			Expect(link.Attrs().HardwareAddr.String()).To(Equal(result.Interfaces[0].Mac))
+
+			secy, err := getSecY(link.Attrs().Index)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secy.sci.port()).To(BeEquivalentTo(2))
+			Expect(secy.encodingSA).To(BeEquivalentTo(1))
+			Expect(secy.txSAs).To(HaveKeyWithValue(uint8(1), true))
+			Expect(secy.rxSCs).To(HaveLen(1))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var confMap map[string]interface{}
+		Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+		resultBytes, err := json.Marshal(result)
+		Expect(err).NotTo(HaveOccurred())
+		var prevResult map[string]interface{}
+		Expect(json.Unmarshal(resultBytes, &prevResult)).To(Succeed())
+		confMap["prevResult"] = prevResult
+		checkConf, err := json.Marshal(confMap)
+		Expect(err).NotTo(HaveOccurred())
+		args.StdinData = checkConf
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })).To(Succeed())
+			Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("refuses a second device with the same SCI on the master", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "macsec",
+			"type": "macsec",
+			"master": "%s"
+		}`, MASTER_NAME)
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       targetNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   []byte(conf),
+			}
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			args.IfName = "macsec1"
+			_, _, err = testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(ContainSubstring("the port or MAC must differ")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,402 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// The netlink library has no support for MACsec. The secure channels and
+// associations are configured with the generic netlink family of the
+// kernel, see include/uapi/linux/if_macsec.h.
+const (
+	genlName    = "macsec"
+	genlVersion = 1
+
+	keyIDLen = 16
+	// defaultPort is the port of the SCIs, as with iproute2
+	defaultPort = 1
+
+	cipherGCMAES128 uint64 = 0x0080C20001000001
+	cipherGCMAES256 uint64 = 0x0080C20001000002
+	// cipherDefault is reported by the kernel for GCM-AES-128
+	cipherDefault uint64 = 0x0080020001000001
+)
+
+const (
+	cmdGetTxSC = 0
+	cmdAddRxSC = 1
+	cmdAddTxSA = 4
+	cmdAddRxSA = 7
+)
+
+const (
+	attrIfIndex    = 1
+	attrRxSCConfig = 2
+	attrSAConfig   = 3
+	attrSecY       = 4
+	attrTxSAList   = 5
+	attrRxSCList   = 6
+)
+
+const (
+	secYAttrSCI         = 1
+	secYAttrEncodingSA  = 2
+	secYAttrWindow      = 3
+	secYAttrCipherSuite = 4
+	secYAttrICVLen      = 5
+	secYAttrReplay      = 7
+	secYAttrValidate    = 9
+	secYAttrEncrypt     = 10
+)
+
+const (
+	rxSCAttrSCI    = 1
+	rxSCAttrActive = 2
+	rxSCAttrSAList = 3
+)
+
+const (
+	saAttrAN     = 1
+	saAttrActive = 2
+	saAttrPN     = 3
+	saAttrKey    = 4
+	saAttrKeyID  = 5
+)
+
+// The validation modes of the received frames
+const (
+	validateDisabled = 0
+	validateCheck    = 1
+	validateStrict   = 2
+)
+
+// sci is a secure channel identifier, the MAC address of the transmitter
+// followed by its port, in network order
+type sci [8]byte
+
+func makeSCI(mac net.HardwareAddr, port uint16) sci {
+	var s sci
+	copy(s[:6], mac)
+	binary.BigEndian.PutUint16(s[6:], port)
+	return s
+}
+
+func (s sci) port() uint16 {
+	return binary.BigEndian.Uint16(s[6:])
+}
+
+func (s sci) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func boolAttr(v bool) []byte {
+	if v {
+		return nl.Uint8Attr(1)
+	}
+	return nl.Uint8Attr(0)
+}
+
+// addMacsec creates the MACsec device on the parent in the current
+// namespace
+func addMacsec(name string, parentIndex int, n *NetConf) error {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(name)))
+	req.AddData(nl.NewRtAttr(unix.IFLA_LINK, nl.Uint32Attr(uint32(parentIndex))))
+	if n.mac != nil {
+		req.AddData(nl.NewRtAttr(unix.IFLA_ADDRESS, []byte(n.mac)))
+	}
+
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated("macsec"))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, n.Port)
+	data.AddRtAttr(unix.IFLA_MACSEC_PORT, port)
+	data.AddRtAttr(unix.IFLA_MACSEC_CIPHER_SUITE, nl.Uint64Attr(n.cipher))
+	data.AddRtAttr(unix.IFLA_MACSEC_ICV_LEN, nl.Uint8Attr(n.ICVLen))
+	data.AddRtAttr(unix.IFLA_MACSEC_ENCODING_SA, nl.Uint8Attr(n.encodingSA()))
+	data.AddRtAttr(unix.IFLA_MACSEC_ENCRYPT, boolAttr(*n.Encrypt))
+	data.AddRtAttr(unix.IFLA_MACSEC_VALIDATION, nl.Uint8Attr(n.validation))
+	data.AddRtAttr(unix.IFLA_MACSEC_REPLAY_PROTECT, boolAttr(n.ReplayProtect))
+	if n.ReplayProtect {
+		data.AddRtAttr(unix.IFLA_MACSEC_WINDOW, nl.Uint32Attr(n.ReplayWindow))
+	}
+
+	req.AddData(linkInfo)
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func macsecRequest(cmd uint8, flags int) (*nl.NetlinkRequest, error) {
+	family, err := netlink.GenlFamilyGet(genlName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the %s generic netlink family: %v", genlName, err)
+	}
+	req := nl.NewNetlinkRequest(int(family.ID), flags)
+	req.AddData(&nl.Genlmsg{Command: cmd, Version: genlVersion})
+	return req, nil
+}
+
+func saConfig(sa *SA) *nl.RtAttr {
+	attr := nl.NewRtAttr(attrSAConfig, nil)
+	attr.AddRtAttr(saAttrAN, nl.Uint8Attr(sa.AN))
+	attr.AddRtAttr(saAttrPN, nl.Uint32Attr(sa.PN))
+	attr.AddRtAttr(saAttrKey, sa.key)
+	attr.AddRtAttr(saAttrKeyID, sa.keyID[:])
+	attr.AddRtAttr(saAttrActive, nl.Uint8Attr(1))
+	return attr
+}
+
+func rxSCConfig(s sci, active bool) *nl.RtAttr {
+	attr := nl.NewRtAttr(attrRxSCConfig, nil)
+	attr.AddRtAttr(rxSCAttrSCI, s[:])
+	if active {
+		attr.AddRtAttr(rxSCAttrActive, nl.Uint8Attr(1))
+	}
+	return attr
+}
+
+func addTxSA(ifIndex int, sa *SA) error {
+	req, err := macsecRequest(cmdAddTxSA, unix.NLM_F_ACK)
+	if err != nil {
+		return err
+	}
+	req.AddData(nl.NewRtAttr(attrIfIndex, nl.Uint32Attr(uint32(ifIndex))))
+	req.AddData(saConfig(sa))
+	_, err = req.Execute(unix.NETLINK_GENERIC, 0)
+	return err
+}
+
+func addRxSC(ifIndex int, s sci) error {
+	req, err := macsecRequest(cmdAddRxSC, unix.NLM_F_ACK)
+	if err != nil {
+		return err
+	}
+	req.AddData(nl.NewRtAttr(attrIfIndex, nl.Uint32Attr(uint32(ifIndex))))
+	req.AddData(rxSCConfig(s, true))
+	_, err = req.Execute(unix.NETLINK_GENERIC, 0)
+	return err
+}
+
+func addRxSA(ifIndex int, s sci, sa *SA) error {
+	req, err := macsecRequest(cmdAddRxSA, unix.NLM_F_ACK)
+	if err != nil {
+		return err
+	}
+	req.AddData(nl.NewRtAttr(attrIfIndex, nl.Uint32Attr(uint32(ifIndex))))
+	req.AddData(rxSCConfig(s, false))
+	req.AddData(saConfig(sa))
+	_, err = req.Execute(unix.NETLINK_GENERIC, 0)
+	return err
+}
+
+// installKeys adds the secure channels and associations to the device
+func installKeys(ifIndex int, keys *Keys) error {
+	if keys.TxSA != nil {
+		if err := addTxSA(ifIndex, keys.TxSA); err != nil {
+			return fmt.Errorf("failed to add tx SA %d: %v", keys.TxSA.AN, err)
+		}
+	}
+	for i := range keys.RxSCs {
+		rxsc := &keys.RxSCs[i]
+		if err := addRxSC(ifIndex, rxsc.sci); err != nil {
+			return fmt.Errorf("failed to add rx SC %s: %v", rxsc.sci, err)
+		}
+		for j := range rxsc.SAs {
+			if err := addRxSA(ifIndex, rxsc.sci, &rxsc.SAs[j]); err != nil {
+				return fmt.Errorf("failed to add rx SA %d of SC %s: %v", rxsc.SAs[j].AN, rxsc.sci, err)
+			}
+		}
+	}
+	return nil
+}
+
+// secY is the configuration of a MACsec device as dumped by the kernel.
+// The SAs are their active flag by association number.
+type secY struct {
+	sci           sci
+	cipherSuite   uint64
+	icvLen        uint8
+	encodingSA    uint8
+	encrypt       bool
+	validation    uint8
+	replayProtect bool
+	window        uint32
+	txSAs         map[uint8]bool
+	rxSCs         map[sci]map[uint8]bool
+}
+
+// getSecY returns the configuration of the MACsec device in the current
+// namespace
+func getSecY(ifIndex int) (*secY, error) {
+	req, err := macsecRequest(cmdGetTxSC, unix.NLM_F_DUMP)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		index, secy, err := parseSecYMsg(msg)
+		if err != nil {
+			return nil, err
+		}
+		if index == ifIndex {
+			return secy, nil
+		}
+	}
+	return nil, fmt.Errorf("MACsec device %d not found", ifIndex)
+}
+
+// parseSecYMsg parses a message of the dump of the MACsec devices, made of
+// the index of a device and its configuration
+func parseSecYMsg(msg []byte) (int, *secY, error) {
+	if len(msg) < nl.SizeofGenlmsg {
+		return 0, nil, fmt.Errorf("short MACsec message")
+	}
+	list, err := parseAttrs(msg[nl.SizeofGenlmsg:])
+	if err != nil {
+		return 0, nil, err
+	}
+	attrs := map[uint16]syscall.NetlinkRouteAttr{}
+	for _, attr := range list {
+		attrs[attr.Attr.Type] = attr
+	}
+	index, ok := attrs[attrIfIndex]
+	if !ok {
+		return 0, nil, fmt.Errorf("MACsec message without device index")
+	}
+	secy, err := parseSecY(attrs)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int(native.Uint32(index.Value)), secy, nil
+}
+
+var native = nl.NativeEndian()
+
+// parseAttrs parses nested attributes, masking the flags of their types
+func parseAttrs(b []byte) ([]syscall.NetlinkRouteAttr, error) {
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, err
+	}
+	for i := range attrs {
+		attrs[i].Attr.Type &= nl.NLA_TYPE_MASK
+	}
+	return attrs, nil
+}
+
+func parseSecY(msg map[uint16]syscall.NetlinkRouteAttr) (*secY, error) {
+	s := &secY{
+		txSAs: map[uint8]bool{},
+		rxSCs: map[sci]map[uint8]bool{},
+	}
+
+	attrs, err := parseAttrs(msg[attrSecY].Value)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case secYAttrSCI:
+			copy(s.sci[:], attr.Value)
+		case secYAttrCipherSuite:
+			s.cipherSuite = native.Uint64(attr.Value)
+		case secYAttrICVLen:
+			s.icvLen = attr.Value[0]
+		case secYAttrEncodingSA:
+			s.encodingSA = attr.Value[0]
+		case secYAttrEncrypt:
+			s.encrypt = attr.Value[0] != 0
+		case secYAttrValidate:
+			s.validation = attr.Value[0]
+		case secYAttrReplay:
+			s.replayProtect = attr.Value[0] != 0
+		case secYAttrWindow:
+			s.window = native.Uint32(attr.Value)
+		}
+	}
+
+	if list, ok := msg[attrTxSAList]; ok {
+		if s.txSAs, err = parseSAList(list.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	if list, ok := msg[attrRxSCList]; ok {
+		rxscs, err := parseAttrs(list.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, rxsc := range rxscs {
+			attrs, err := parseAttrs(rxsc.Value)
+			if err != nil {
+				return nil, err
+			}
+			var id sci
+			sas := map[uint8]bool{}
+			for _, attr := range attrs {
+				switch attr.Attr.Type {
+				case rxSCAttrSCI:
+					copy(id[:], attr.Value)
+				case rxSCAttrSAList:
+					if sas, err = parseSAList(attr.Value); err != nil {
+						return nil, err
+					}
+				}
+			}
+			s.rxSCs[id] = sas
+		}
+	}
+	return s, nil
+}
+
+func parseSAList(b []byte) (map[uint8]bool, error) {
+	sas := map[uint8]bool{}
+	list, err := parseAttrs(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, sa := range list {
+		attrs, err := parseAttrs(sa.Value)
+		if err != nil {
+			return nil, err
+		}
+		var an uint8
+		active := false
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case saAttrAN:
+				an = attr.Value[0]
+			case saAttrActive:
+				active = attr.Value[0] != 0
+			}
+		}
+		sas[an] = active
+	}
+	return sas, nil
+}
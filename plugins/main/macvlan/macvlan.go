@@ -20,8 +20,10 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"time"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -29,12 +31,37 @@ import (
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/macpool"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 	"github.com/containernetworking/plugins/pkg/utils/sysctl"
 )
 
+const (
+	deviceTypeMacvlan = "macvlan"
+	deviceTypeMacvtap = "macvtap"
+)
+
+// Bounds of the address announcements, in milliseconds for the interval,
+// keeping ADD from blocking for long
+const (
+	maxAnnounceCount        = 10
+	defaultAnnounceInterval = 200
+	maxAnnounceInterval     = 2000
+)
+
+// Policies selecting the master among the candidates listed in masters
+const (
+	// masterPolicyExists picks the first candidate that exists
+	masterPolicyExists = "exists"
+	// masterPolicyCarrier picks the first candidate with carrier
+	masterPolicyCarrier = "carrier"
+	// masterPolicyDefaultRoute picks the first candidate with carrier and
+	// a default route
+	masterPolicyDefaultRoute = "defaultRoute"
+)
+
 type NetConf struct {
 	types.NetConf
 	Master     string `json:"master"`
@@ -43,10 +70,39 @@ type NetConf struct {
 	Mac        string `json:"mac,omitempty"`
 	LinkContNs bool   `json:"linkInContainer,omitempty"`
 	BcQueueLen uint32 `json:"bcqueuelen,omitempty"`
+	// Masters is an ordered list of candidate masters, of which the first
+	// satisfying MasterPolicy is used
+	Masters      []string `json:"masters,omitempty"`
+	MasterPolicy string   `json:"masterPolicy,omitempty"`
+	// DeviceType is either "macvlan" (default) or "macvtap"
+	DeviceType string `json:"deviceType,omitempty"`
+	// SourceMACs are the source MAC addresses accepted in "source" mode
+	SourceMACs []string `json:"sourceMACs,omitempty"`
+	// AutoVlanMaster creates a master named <parent>.<vlan id> as a VLAN
+	// interface of parent when missing, and removes it with its last macvlan
+	AutoVlanMaster bool   `json:"autoVlanMaster,omitempty"`
+	DataDir        string `json:"dataDir,omitempty"`
+	// AutoPromisc turns promiscuous mode on for the master while it has
+	// macvlans, restoring it with the last one. Defaults to true in source
+	// mode.
+	AutoPromisc *bool `json:"autoPromisc,omitempty"`
+	// MacPool allocates the MAC address when none is given
+	MacPool *macpool.Pool `json:"macPool,omitempty"`
+	// AnnounceCount is the number of gratuitous ARPs and unsolicited
+	// neighbor advertisements sent for the addresses after ADD, spaced by
+	// AnnounceInterval milliseconds
+	AnnounceCount    int `json:"announceCount,omitempty"`
+	AnnounceInterval int `json:"announceInterval,omitempty"`
+	// L2Only leaves the addressing to the container, e.g. a DHCP or PPPoE
+	// client: no IPAM is run and no address-dependent sysctl is set, and
+	// the interface is reported in the result with its MTU and no address
+	L2Only bool `json:"l2Only,omitempty"`
 
 	RuntimeConfig struct {
 		Mac string `json:"mac,omitempty"`
 	} `json:"runtimeConfig,omitempty"`
+
+	sourceMACs []net.HardwareAddr
 }
 
 // MacEnvArgs represents CNI_ARG
@@ -104,11 +160,124 @@ func getNamespacedDefaultRouteInterfaceName(namespace string, inContainer bool)
 	return defaultRouteInterface, nil
 }
 
+// hasCarrier reports whether the lower layer of the link is up
+func hasCarrier(link netlink.Link) bool {
+	return link.Attrs().RawFlags&unix.IFF_LOWER_UP != 0
+}
+
+func hasDefaultRoute(link netlink.Link) (bool, error) {
+	routes, err := netlinksafe.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return false, fmt.Errorf("failed to list routes of %q: %v", link.Attrs().Name, err)
+	}
+	for _, r := range routes {
+		if ip.IsIPNetZero(r.Dst) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getMasterByPolicy returns the first of the candidates satisfying policy
+func getMasterByPolicy(candidates []string, policy string) (string, error) {
+	for _, name := range candidates {
+		link, err := netlinksafe.LinkByName(name)
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				continue
+			}
+			return "", fmt.Errorf("failed to lookup master candidate %q: %v", name, err)
+		}
+
+		switch policy {
+		case "", masterPolicyExists:
+			return name, nil
+		case masterPolicyCarrier:
+			if hasCarrier(link) {
+				return name, nil
+			}
+		case masterPolicyDefaultRoute:
+			if !hasCarrier(link) {
+				continue
+			}
+			ok, err := hasDefaultRoute(link)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return name, nil
+			}
+		default:
+			return "", fmt.Errorf("unknown master policy: %q", policy)
+		}
+	}
+
+	if policy == "" {
+		policy = masterPolicyExists
+	}
+	return "", fmt.Errorf("no master among %v satisfies policy %q", candidates, policy)
+}
+
+func getNamespacedMasterByPolicy(namespace string, inContainer bool, candidates []string, policy string) (string, error) {
+	if !inContainer {
+		return getMasterByPolicy(candidates, policy)
+	}
+	netns, err := ns.GetNS(namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to open netns %q: %v", namespace, err)
+	}
+	defer netns.Close()
+	var master string
+	err = netns.Do(func(_ ns.NetNS) error {
+		master, err = getMasterByPolicy(candidates, policy)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return master, nil
+}
+
+// selectMaster returns the master recorded for the attachment when it is
+// still one of the candidates, or else the one satisfying the policy
+func selectMaster(args *skel.CmdArgs, n *NetConf) (string, error) {
+	if args.ContainerID != "" {
+		master, err := recordedMaster(n.DataDir, args.ContainerID, args.IfName)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the selected master: %v", err)
+		}
+		for _, candidate := range n.Masters {
+			if master == candidate {
+				return master, nil
+			}
+		}
+	}
+	return getNamespacedMasterByPolicy(args.Netns, n.LinkContNs, n.Masters, n.MasterPolicy)
+}
+
 func loadConf(args *skel.CmdArgs, envArgs string) (*NetConf, string, error) {
 	n := &NetConf{}
 	if err := json.Unmarshal(args.StdinData, n); err != nil {
 		return nil, "", fmt.Errorf("failed to load netconf: %v", err)
 	}
+	if n.DataDir == "" {
+		n.DataDir = defaultDataDir
+	}
+	if len(n.Masters) > 0 {
+		if n.Master != "" {
+			return nil, "", fmt.Errorf("master and masters are mutually exclusive")
+		}
+		if n.AutoVlanMaster {
+			return nil, "", fmt.Errorf("masters is not supported with autoVlanMaster")
+		}
+		master, err := selectMaster(args, n)
+		if err != nil {
+			return nil, "", err
+		}
+		n.Master = master
+	} else if n.MasterPolicy != "" {
+		return nil, "", fmt.Errorf("masterPolicy requires masters")
+	}
 	if n.Master == "" {
 		defaultRouteInterface, err := getNamespacedDefaultRouteInterfaceName(args.Netns, n.LinkContNs)
 		if err != nil {
@@ -117,8 +286,22 @@ func loadConf(args *skel.CmdArgs, envArgs string) (*NetConf, string, error) {
 		n.Master = defaultRouteInterface
 	}
 
-	// check existing and MTU of master interface
-	masterMTU, err := getMTUByName(n.Master, args.Netns, n.LinkContNs)
+	// check existing and MTU of master interface, or of its parent when it
+	// is yet to be created as it inherits the parent MTU
+	mtuIfName := n.Master
+	if n.AutoVlanMaster {
+		if n.LinkContNs {
+			return nil, "", fmt.Errorf("autoVlanMaster is not supported with linkInContainer")
+		}
+		parent, _, err := parseVlanMaster(n.Master)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := netlinksafe.LinkByName(n.Master); err != nil {
+			mtuIfName = parent
+		}
+	}
+	masterMTU, err := getMTUByName(mtuIfName, args.Netns, n.LinkContNs)
 	if err != nil {
 		return nil, "", err
 	}
@@ -142,9 +325,66 @@ func loadConf(args *skel.CmdArgs, envArgs string) (*NetConf, string, error) {
 		n.Mac = n.RuntimeConfig.Mac
 	}
 
+	if len(n.SourceMACs) > 0 && n.Mode != "source" {
+		return nil, "", fmt.Errorf("sourceMACs requires source mode")
+	}
+	for _, mac := range n.SourceMACs {
+		addr, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid source MAC address %q: %v", mac, err)
+		}
+		n.sourceMACs = append(n.sourceMACs, addr)
+	}
+
+	if n.AnnounceCount < 0 || n.AnnounceCount > maxAnnounceCount {
+		return nil, "", fmt.Errorf("invalid announceCount %d, must be [0, %d]", n.AnnounceCount, maxAnnounceCount)
+	}
+	if n.AnnounceInterval < 0 || n.AnnounceInterval > maxAnnounceInterval {
+		return nil, "", fmt.Errorf("invalid announceInterval %d, must be [0, %d]", n.AnnounceInterval, maxAnnounceInterval)
+	}
+	if n.AnnounceInterval == 0 {
+		n.AnnounceInterval = defaultAnnounceInterval
+	}
+
+	if n.L2Only {
+		if n.IPAM.Type != "" {
+			return nil, "", fmt.Errorf("l2Only and ipam are mutually exclusive")
+		}
+		if n.AnnounceCount > 0 {
+			return nil, "", fmt.Errorf("announceCount is not supported with l2Only")
+		}
+	}
+
+	if n.MacPool != nil {
+		if err := n.MacPool.Canonicalize(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if n.AutoPromisc != nil && *n.AutoPromisc && n.LinkContNs {
+		return nil, "", fmt.Errorf("autoPromisc is not supported with linkInContainer")
+	}
+
+	switch n.DeviceType {
+	case "":
+		n.DeviceType = deviceTypeMacvlan
+	case deviceTypeMacvlan, deviceTypeMacvtap:
+	default:
+		return nil, "", fmt.Errorf("unknown device type: %q", n.DeviceType)
+	}
+
 	return n, n.CNIVersion, nil
 }
 
+// promiscRequired reports whether the master must be put in promiscuous
+// mode for the macvlan to receive its traffic
+func (n *NetConf) promiscRequired() bool {
+	if n.AutoPromisc != nil {
+		return *n.AutoPromisc
+	}
+	return n.Mode == "source" && !n.LinkContNs
+}
+
 func getMTUByName(ifName string, namespace string, inContainer bool) (int, error) {
 	var link netlink.Link
 	var err error
@@ -179,6 +419,8 @@ func modeFromString(s string) (netlink.MacvlanMode, error) {
 		return netlink.MACVLAN_MODE_VEPA, nil
 	case "passthru":
 		return netlink.MACVLAN_MODE_PASSTHRU, nil
+	case "source":
+		return netlink.MACVLAN_MODE_SOURCE, nil
 	default:
 		return 0, fmt.Errorf("unknown macvlan mode: %q", s)
 	}
@@ -194,6 +436,8 @@ func modeToString(mode netlink.MacvlanMode) (string, error) {
 		return "vepa", nil
 	case netlink.MACVLAN_MODE_PASSTHRU:
 		return "passthru", nil
+	case netlink.MACVLAN_MODE_SOURCE:
+		return "source", nil
 	default:
 		return "", fmt.Errorf("unknown macvlan mode: %q", mode)
 	}
@@ -248,24 +492,29 @@ func createMacvlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Inter
 
 	mv.BCQueueLen = conf.BcQueueLen
 
+	var link netlink.Link = mv
+	if conf.DeviceType == deviceTypeMacvtap {
+		link = &netlink.Macvtap{Macvlan: *mv}
+	}
+
 	if conf.LinkContNs {
 		err = netns.Do(func(_ ns.NetNS) error {
-			return netlink.LinkAdd(mv)
+			return netlink.LinkAdd(link)
 		})
 	} else {
-		if err = netlink.LinkAdd(mv); err != nil {
-			return nil, fmt.Errorf("failed to create macvlan: %v", err)
+		if err = netlink.LinkAdd(link); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", conf.DeviceType, err)
 		}
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create macvlan: %v", err)
+		return nil, fmt.Errorf("failed to create %s: %v", conf.DeviceType, err)
 	}
 
 	err = netns.Do(func(_ ns.NetNS) error {
 		err := ip.RenameLink(tmpName, ifName)
 		if err != nil {
-			_ = netlink.LinkDel(mv)
-			return fmt.Errorf("failed to rename macvlan to %q: %v", ifName, err)
+			_ = netlink.LinkDel(link)
+			return fmt.Errorf("failed to rename %s to %q: %v", conf.DeviceType, ifName, err)
 		}
 		macvlan.Name = ifName
 
@@ -276,6 +525,12 @@ func createMacvlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Inter
 		}
 		macvlan.Mac = contMacvlan.Attrs().HardwareAddr.String()
 		macvlan.Sandbox = netns.Path()
+		// In source mode only frames from the listed MACs are received
+		if mode == netlink.MACVLAN_MODE_SOURCE && len(conf.sourceMACs) > 0 {
+			if err := netlink.MacvlanMACAddrSet(contMacvlan, conf.sourceMACs); err != nil {
+				return fmt.Errorf("failed to set source MAC addresses of %q: %v", ifName, err)
+			}
+		}
 
 		return nil
 	})
@@ -300,8 +555,24 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	defer netns.Close()
 
-	macvlanInterface, err := createMacvlan(n, args.IfName, netns)
+	if n.MacPool != nil && n.Mac == "" {
+		mac, err := n.MacPool.Allocate(args.ContainerID, args.IfName)
+		if err != nil {
+			return err
+		}
+		n.Mac = mac.String()
+	}
+
+	var macvlanInterface *current.Interface
+	if n.AutoVlanMaster {
+		macvlanInterface, err = createMacvlanOnVlanMaster(n, args, netns)
+	} else {
+		macvlanInterface, err = createMacvlan(n, args.IfName, netns)
+	}
 	if err != nil {
+		if n.MacPool != nil {
+			_ = n.MacPool.Release(args.ContainerID, args.IfName)
+		}
 		return err
 	}
 
@@ -311,9 +582,29 @@ func cmdAdd(args *skel.CmdArgs) error {
 			netns.Do(func(_ ns.NetNS) error {
 				return ip.DelLinkByName(args.IfName)
 			})
+			if n.MacPool != nil {
+				_ = n.MacPool.Release(args.ContainerID, args.IfName)
+			}
+			if n.AutoVlanMaster {
+				_ = releaseVlanMaster(n.DataDir, n.Master, args.ContainerID, args.IfName)
+			}
+			if n.DeviceType == deviceTypeMacvtap {
+				_ = unpublishTapDevice(n.DataDir, args.ContainerID, args.IfName)
+			}
 		}
 	}()
 
+	if n.promiscRequired() {
+		if err = acquirePromisc(n.DataDir, n.Master, args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = releasePromisc(n.DataDir, args.ContainerID, args.IfName)
+			}
+		}()
+	}
+
 	// Assume L2 interface only
 	result := &current.Result{
 		CNIVersion: current.ImplementedSpecVersion,
@@ -356,7 +647,19 @@ func cmdAdd(args *skel.CmdArgs) error {
 			_, _ = sysctl.Sysctl(fmt.Sprintf("net/ipv4/conf/%s/arp_notify", args.IfName), "1")
 			_, _ = sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/ndisc_notify", args.IfName), "1")
 
-			return ipam.ConfigureIface(args.IfName, result)
+			if err := ipam.ConfigureIface(args.IfName, result); err != nil {
+				return err
+			}
+
+			if n.AnnounceCount > 0 {
+				ips := make([]net.IP, 0, len(result.IPs))
+				for _, ipc := range result.IPs {
+					ips = append(ips, ipc.Address.IP)
+				}
+				interval := time.Duration(n.AnnounceInterval) * time.Millisecond
+				return ip.AnnounceIPsRepeatedly(args.IfName, ips, n.AnnounceCount, interval)
+			}
+			return nil
 		})
 		if err != nil {
 			return err
@@ -373,6 +676,9 @@ func cmdAdd(args *skel.CmdArgs) error {
 				return fmt.Errorf("failed to set %q UP: %v", args.IfName, err)
 			}
 
+			if n.L2Only {
+				macvlanInterface.Mtu = macvlanInterfaceLink.Attrs().MTU
+			}
 			return nil
 		})
 		if err != nil {
@@ -380,6 +686,24 @@ func cmdAdd(args *skel.CmdArgs) error {
 		}
 	}
 
+	if n.DeviceType == deviceTypeMacvtap {
+		// Consumers open the tap character device rather than the
+		// interface, so it is published in the device info file
+		dev, err := readTapDevice(netns, args.IfName)
+		if err != nil {
+			return err
+		}
+		if err = publishTapDevice(n.DataDir, args.ContainerID, args.IfName, dev); err != nil {
+			return fmt.Errorf("failed to publish the tap device: %v", err)
+		}
+	}
+
+	if len(n.Masters) > 0 {
+		if err = recordMaster(n.DataDir, n.Master, args.ContainerID, args.IfName); err != nil {
+			return fmt.Errorf("failed to record the selected master: %v", err)
+		}
+	}
+
 	result.DNS = n.DNS
 
 	return types.PrintResult(result, cniVersion)
@@ -400,32 +724,58 @@ func cmdDel(args *skel.CmdArgs) error {
 		}
 	}
 
-	if args.Netns == "" {
-		return nil
-	}
-
-	// There is a netns so try to clean up. Delete can be called multiple times
-	// so don't return an error if the device is already removed.
-	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
-		if err := ip.DelLinkByName(args.IfName); err != nil {
-			if err != ip.ErrLinkNotFound {
+	if args.Netns != "" {
+		// There is a netns so try to clean up. Delete can be called multiple times
+		// so don't return an error if the device is already removed.
+		err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+			if err := ip.DelLinkByName(args.IfName); err != nil {
+				if err != ip.ErrLinkNotFound {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+			// so don't return an error if the device is already removed.
+			// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+			if _, ok := err.(ns.NSPathNotExistErr); !ok {
 				return err
 			}
 		}
-		return nil
-	})
-	if err != nil {
-		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
-		// so don't return an error if the device is already removed.
-		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
-		_, ok := err.(ns.NSPathNotExistErr)
-		if ok {
-			return nil
+	}
+
+	// The macvlan is gone, possibly with its netns, so the master may be
+	// released
+	dataDir := n.DataDir
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+	if n.promiscRequired() {
+		if err := releasePromisc(dataDir, args.ContainerID, args.IfName); err != nil {
+			return err
 		}
-		return err
+	}
+	if n.MacPool != nil {
+		if err := n.MacPool.Release(args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+	}
+	if n.DeviceType == deviceTypeMacvtap {
+		if err := unpublishTapDevice(dataDir, args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+	}
+	if len(n.Masters) > 0 {
+		if err := forgetMaster(dataDir, args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+	}
+	if n.AutoVlanMaster {
+		return releaseVlanMaster(dataDir, n.Master, args.ContainerID, args.IfName)
 	}
 
-	return err
+	return nil
 }
 
 func main() {
@@ -475,10 +825,12 @@ func cmdCheck(args *skel.CmdArgs) error {
 
 	var contMap current.Interface
 	// Find interfaces for names whe know, macvlan device name inside container
-	for _, intf := range result.Interfaces {
+	contIndex := -1
+	for i, intf := range result.Interfaces {
 		if args.IfName == intf.Name {
 			if args.Netns == intf.Sandbox {
 				contMap = *intf
+				contIndex = i
 				continue
 			}
 		}
@@ -490,6 +842,15 @@ func cmdCheck(args *skel.CmdArgs) error {
 			contMap.Sandbox, args.Netns)
 	}
 
+	// The addresses of a l2Only interface are the container's own business
+	if n.L2Only {
+		for _, ipc := range result.IPs {
+			if ipc.Interface != nil && *ipc.Interface == contIndex {
+				return fmt.Errorf("l2Only interface %s has address %s in prevResult", args.IfName, ipc.Address.String())
+			}
+		}
+	}
+
 	if n.LinkContNs {
 		err = netns.Do(func(_ ns.NetNS) error {
 			_, err = netlinksafe.LinkByName(n.Master)
@@ -502,10 +863,27 @@ func cmdCheck(args *skel.CmdArgs) error {
 		return fmt.Errorf("failed to lookup master %q: %v", n.Master, err)
 	}
 
+	if n.DeviceType == deviceTypeMacvtap {
+		published, err := publishedTapDevice(n.DataDir, args.ContainerID, args.IfName)
+		if err != nil {
+			return err
+		}
+		if published != nil {
+			dev, err := readTapDevice(netns, args.IfName)
+			if err != nil {
+				return err
+			}
+			if *dev != *published {
+				return fmt.Errorf("interface %s tap device %s (%d:%d) doesn't match the published %s (%d:%d)",
+					args.IfName, dev.Path, dev.Major, dev.Minor, published.Path, published.Major, published.Minor)
+			}
+		}
+	}
+
 	// Check prevResults for ips, routes and dns against values found in the container
 	if err := netns.Do(func(_ ns.NetNS) error {
 		// Check interface against values found in the container
-		err := validateCniContainerInterface(contMap, n.Mode)
+		err := validateCniContainerInterface(contMap, n)
 		if err != nil {
 			return err
 		}
@@ -527,7 +905,7 @@ func cmdCheck(args *skel.CmdArgs) error {
 	return nil
 }
 
-func validateCniContainerInterface(intf current.Interface, modeExpected string) error {
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
 	var link netlink.Link
 	var err error
 
@@ -542,12 +920,18 @@ func validateCniContainerInterface(intf current.Interface, modeExpected string)
 		return fmt.Errorf("error: Container interface %s should not be in host namespace", link.Attrs().Name)
 	}
 
-	macv, isMacvlan := link.(*netlink.Macvlan)
-	if !isMacvlan {
-		return fmt.Errorf("error: Container interface %s not of type macvlan", link.Attrs().Name)
+	if link.Type() != n.DeviceType {
+		return fmt.Errorf("error: Container interface %s not of type %s", link.Attrs().Name, n.DeviceType)
+	}
+	var macv *netlink.Macvlan
+	switch l := link.(type) {
+	case *netlink.Macvlan:
+		macv = l
+	case *netlink.Macvtap:
+		macv = &l.Macvlan
 	}
 
-	mode, err := modeFromString(modeExpected)
+	mode, err := modeFromString(n.Mode)
 	if err != nil {
 		return err
 	}
@@ -563,6 +947,10 @@ func validateCniContainerInterface(intf current.Interface, modeExpected string)
 		return fmt.Errorf("container macvlan mode %s does not match expected value: %s", currString, confString)
 	}
 
+	if mode == netlink.MACVLAN_MODE_SOURCE && !sameMACs(macv.MACAddrs, n.sourceMACs) {
+		return fmt.Errorf("container macvlan source MAC addresses %v do not match expected value: %v", macv.MACAddrs, n.sourceMACs)
+	}
+
 	if intf.Mac != "" {
 		if intf.Mac != link.Attrs().HardwareAddr.String() {
 			return fmt.Errorf("interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
@@ -572,6 +960,24 @@ func validateCniContainerInterface(intf current.Interface, modeExpected string)
 	return nil
 }
 
+// sameMACs reports whether both lists hold the same addresses in any order
+func sameMACs(a, b []net.HardwareAddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int, len(a))
+	for _, mac := range a {
+		seen[mac.String()]++
+	}
+	for _, mac := range b {
+		if seen[mac.String()] == 0 {
+			return false
+		}
+		seen[mac.String()]--
+	}
+	return true
+}
+
 func cmdStatus(args *skel.CmdArgs) error {
 	conf := NetConf{}
 	if err := json.Unmarshal(args.StdinData, &conf); err != nil {
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -246,6 +247,235 @@ var _ = Describe("macvlan Operations", func() {
 		Expect(targetNS.Close()).To(Succeed())
 		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
 	})
+
+	It("creates the VLAN master on ADD and removes it with the last macvlan on DEL", func() {
+		master := MASTER_NAME + ".100"
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "macvlan",
+		    "master": "%s",
+		    "autoVlanMaster": true,
+		    "dataDir": "%s"
+		}`, master, dataDir)
+
+		argsFor := func(containerID string) *skel.CmdArgs {
+			return &skel.CmdArgs{
+				ContainerID: containerID,
+				Netns:       targetNS.Path(),
+				IfName:      "macvl-" + containerID,
+				StdinData:   []byte(conf),
+			}
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			for _, id := range []string{"a", "b"} {
+				args := argsFor(id)
+				_, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			link, err := netlinksafe.LinkByName(master)
+			Expect(err).NotTo(HaveOccurred())
+			vlan, ok := link.(*netlink.Vlan)
+			Expect(ok).To(BeTrue())
+			Expect(vlan.VlanId).To(Equal(100))
+
+			args := argsFor("a")
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+			_, err = netlinksafe.LinkByName(master)
+			Expect(err).NotTo(HaveOccurred())
+
+			args = argsFor("b")
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+			_, err = netlinksafe.LinkByName(master)
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reports a l2Only macvlan without addresses with ADD/CHECK/DEL", func() {
+		const IFNAME = "macvl0"
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "macvlan",
+		    "master": "%s",
+		    "mtu": 1400,
+		    "l2Only": true
+		}`, MASTER_NAME)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Interfaces).To(HaveLen(1))
+		Expect(result.Interfaces[0].Name).To(Equal(IFNAME))
+		Expect(result.Interfaces[0].Mtu).To(Equal(1400))
+		Expect(result.Interfaces[0].Sandbox).To(Equal(targetNS.Path()))
+		Expect(result.IPs).To(BeEmpty())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		checkArgs := func(prevResult *types100.Result) *skel.CmdArgs {
+			prev, err := json.Marshal(prevResult)
+			Expect(err).NotTo(HaveOccurred())
+			a := *args
+			a.StdinData = []byte(fmt.Sprintf(`{
+			    "cniVersion": "1.0.0",
+			    "name": "mynet",
+			    "type": "macvlan",
+			    "master": "%s",
+			    "mtu": 1400,
+			    "l2Only": true,
+			    "prevResult": %s
+			}`, MASTER_NAME, prev))
+			return &a
+		}
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			cargs := checkArgs(result)
+			Expect(testutils.CmdCheckWithArgs(cargs, func() error {
+				return cmdCheck(cargs)
+			})).To(Succeed())
+
+			// The addresses are left to the container
+			withIP := *result
+			withIP.IPs = []*types100.IPConfig{{
+				Interface: types100.Int(0),
+				Address:   net.IPNet{IP: net.ParseIP("10.1.2.3"), Mask: net.CIDRMask(24, 32)},
+			}}
+			cargs = checkArgs(&withIP)
+			err := testutils.CmdCheckWithArgs(cargs, func() error {
+				return cmdCheck(cargs)
+			})
+			Expect(err).To(MatchError("l2Only interface macvl0 has address 10.1.2.3/24 in prevResult"))
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("holds the master in promiscuous mode while it has source mode macvlans", func() {
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "macvlan",
+		    "master": "%s",
+		    "mode": "source",
+		    "dataDir": "%s"
+		}`, MASTER_NAME, dataDir)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "macvl0",
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			master, err := netlinksafe.LinkByName(MASTER_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(master.Attrs().Promisc).NotTo(BeZero())
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+
+			master, err = netlinksafe.LinkByName(MASTER_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(master.Attrs().Promisc).To(BeZero())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("uses the first existing master of the masters list", func() {
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "macvlan",
+		    "masters": ["missing0", "%s"]
+		}`, MASTER_NAME)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "macvl0",
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			master, err := netlinksafe.LinkByName(MASTER_NAME)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName(args.IfName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Attrs().ParentIndex).To(Equal(master.Attrs().Index))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
 	f, t := false, true
 	for _, inContainer := range []*bool{&f, &t, nil} {
 		isInContainer := inContainer
@@ -296,6 +526,90 @@ var _ = Describe("macvlan Operations", func() {
 				Expect(err).NotTo(HaveOccurred())
 			})
 
+			It(fmt.Sprintf("[%s] creates a macvtap link in a non-default namespace", ver), func() {
+				conf := &NetConf{
+					NetConf: types.NetConf{
+						CNIVersion: ver,
+						Name:       "testConfig",
+						Type:       "macvlan",
+					},
+					Master:     masterInterface,
+					Mode:       "bridge",
+					MTU:        1500,
+					LinkContNs: isInContainer != nil && *isInContainer,
+					DeviceType: "macvtap",
+				}
+
+				var iface *types100.Interface
+				err := originalNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					var err error
+					iface, err = createMacvlan(conf, "foobar0", targetNS)
+					Expect(err).NotTo(HaveOccurred())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				// Make sure macvtap link exists in the target namespace
+				err = targetNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					link, err := netlinksafe.LinkByName("foobar0")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(link).To(BeAssignableToTypeOf(&netlink.Macvtap{}))
+					Expect(iface.SocketPath).To(BeEmpty())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				dev, err := readTapDevice(targetNS, "foobar0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dev.Path).To(HavePrefix("/dev/tap"))
+				Expect(dev.Major).NotTo(BeZero())
+			})
+
+			It(fmt.Sprintf("[%s] creates a source mode macvlan link with allowed source MACs", ver), func() {
+				sourceMAC, err := net.ParseMAC("c2:11:22:33:44:55")
+				Expect(err).NotTo(HaveOccurred())
+
+				conf := &NetConf{
+					NetConf: types.NetConf{
+						CNIVersion: ver,
+						Name:       "testConfig",
+						Type:       "macvlan",
+					},
+					Master:     masterInterface,
+					Mode:       "source",
+					MTU:        1500,
+					LinkContNs: isInContainer != nil && *isInContainer,
+					sourceMACs: []net.HardwareAddr{sourceMAC},
+				}
+
+				err = originalNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					_, err := createMacvlan(conf, "foobar0", targetNS)
+					Expect(err).NotTo(HaveOccurred())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = targetNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					link, err := netlinksafe.LinkByName("foobar0")
+					Expect(err).NotTo(HaveOccurred())
+					macv, ok := link.(*netlink.Macvlan)
+					Expect(ok).To(BeTrue())
+					Expect(macv.Mode).To(Equal(netlink.MACVLAN_MODE_SOURCE))
+					Expect(macv.MACAddrs).To(HaveLen(1))
+					Expect(macv.MACAddrs[0].String()).To(Equal(sourceMAC.String()))
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
 			It(fmt.Sprintf("[%s] configures and deconfigures a macvlan link with ADD/DEL", ver), func() {
 				const IFNAME = "macvl0"
 
@@ -912,3 +1226,311 @@ var _ = Describe("macvlan Operations", func() {
 		}
 	}
 })
+
+var _ = Describe("macvlan VLAN master", func() {
+	It("parses VLAN master names", func() {
+		parent, vlanID, err := parseVlanMaster("eth0.100")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent).To(Equal("eth0"))
+		Expect(vlanID).To(Equal(100))
+
+		parent, vlanID, err = parseVlanMaster("bond0.2.300")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent).To(Equal("bond0.2"))
+		Expect(vlanID).To(Equal(300))
+
+		for _, name := range []string{"eth0", "eth0.", ".100", "eth0.0", "eth0.4095", "eth0.x"} {
+			_, _, err = parseVlanMaster(name)
+			Expect(err).To(HaveOccurred(), name)
+		}
+	})
+})
+
+var _ = Describe("macvlan master selection", func() {
+	var testNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		testNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(testNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(testNS)).To(Succeed())
+	})
+
+	It("picks the first candidate satisfying the policy", func() {
+		err := testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			candidates := []string{"missing0", "lo"}
+
+			master, err := getMasterByPolicy(candidates, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(master).To(Equal("lo"))
+
+			// lo is down in a fresh netns
+			_, err = getMasterByPolicy(candidates, masterPolicyCarrier)
+			Expect(err).To(MatchError(ContainSubstring(`satisfies policy "carrier"`)))
+
+			lo, err := netlinksafe.LinkByName("lo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(lo)).To(Succeed())
+
+			master, err = getMasterByPolicy(candidates, masterPolicyCarrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(master).To(Equal("lo"))
+
+			_, err = getMasterByPolicy(candidates, masterPolicyDefaultRoute)
+			Expect(err).To(HaveOccurred())
+
+			_, err = getMasterByPolicy(candidates, "fastest")
+			Expect(err).To(MatchError(ContainSubstring("unknown master policy")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects masterPolicy without masters", func() {
+		conf := `{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "macvlan",
+			"master": "lo",
+			"masterPolicy": "carrier"
+		}`
+		_, _, err := loadConf(&skel.CmdArgs{StdinData: []byte(conf)}, "")
+		Expect(err).To(MatchError("masterPolicy requires masters"))
+
+		conf = `{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "macvlan",
+			"master": "lo",
+			"masters": ["lo"]
+		}`
+		_, _, err = loadConf(&skel.CmdArgs{StdinData: []byte(conf)}, "")
+		Expect(err).To(MatchError("master and masters are mutually exclusive"))
+	})
+
+	It("keeps the master selected at ADD", func() {
+		dataDir, err := os.MkdirTemp("", "macvlan_test")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dataDir)
+
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "macvlan",
+			"masters": ["lo"],
+			"masterPolicy": "carrier",
+			"dataDir": %q
+		}`, dataDir)
+		args := &skel.CmdArgs{ContainerID: "a", IfName: "net1", StdinData: []byte(conf)}
+
+		err = testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			// lo is down in a fresh netns, so it no longer satisfies the
+			// policy but stays the master of the attachment
+			_, _, err := loadConf(args, "")
+			Expect(err).To(MatchError(ContainSubstring(`satisfies policy "carrier"`)))
+
+			Expect(recordMaster(dataDir, "lo", "a", "net1")).To(Succeed())
+			n, _, err := loadConf(args, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n.Master).To(Equal("lo"))
+
+			// A recorded master that is no longer a candidate is ignored
+			Expect(recordMaster(dataDir, "eth9", "a", "net1")).To(Succeed())
+			_, _, err = loadConf(args, "")
+			Expect(err).To(MatchError(ContainSubstring(`satisfies policy "carrier"`)))
+
+			Expect(forgetMaster(dataDir, "a", "net1")).To(Succeed())
+			master, err := recordedMaster(dataDir, "a", "net1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(master).To(BeEmpty())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("macvlan promiscuous master", func() {
+	var testNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		testNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "macvlan_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(testNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(testNS)).To(Succeed())
+	})
+
+	promisc := func() bool {
+		link, err := netlinksafe.LinkByName("lo")
+		Expect(err).NotTo(HaveOccurred())
+		return link.Attrs().Promisc != 0
+	}
+
+	It("keeps promiscuous mode on until the last attachment is released", func() {
+		err := testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(promisc()).To(BeFalse())
+			Expect(acquirePromisc(dataDir, "lo", "a", "net1")).To(Succeed())
+			Expect(acquirePromisc(dataDir, "lo", "b", "net1")).To(Succeed())
+			Expect(promisc()).To(BeTrue())
+
+			Expect(releasePromisc(dataDir, "a", "net1")).To(Succeed())
+			Expect(promisc()).To(BeTrue())
+			Expect(releasePromisc(dataDir, "b", "net1")).To(Succeed())
+			Expect(promisc()).To(BeFalse())
+
+			// Releasing again is a no-op
+			Expect(releasePromisc(dataDir, "b", "net1")).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("leaves a master promiscuous beforehand untouched", func() {
+		err := testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			lo, err := netlinksafe.LinkByName("lo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.SetPromiscOn(lo)).To(Succeed())
+
+			Expect(acquirePromisc(dataDir, "lo", "a", "net1")).To(Succeed())
+			Expect(releasePromisc(dataDir, "a", "net1")).To(Succeed())
+			Expect(promisc()).To(BeTrue())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("macvlan macvtap device info", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "macvlan_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	It("reads the tap device from sysfs", func() {
+		sysDir := filepath.Join(dataDir, "sys")
+		tapDir := filepath.Join(sysDir, "class", "net", "net1", "macvtap", "tap12")
+		Expect(os.MkdirAll(tapDir, 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tapDir, "dev"), []byte("237:3\n"), 0o644)).To(Succeed())
+
+		dev, err := tapDeviceFromSysfs(sysDir, "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*dev).To(Equal(tapDevice{IfName: "net1", Path: "/dev/tap12", Major: 237, Minor: 3}))
+
+		_, err = tapDeviceFromSysfs(sysDir, "net2")
+		Expect(err).To(MatchError(ContainSubstring(`failed to find the tap device of "net2"`)))
+	})
+
+	It("reads sysfs from the network namespace of the interface", func() {
+		testNS, err := testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(testNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(testNS)).To(Succeed())
+		}()
+
+		// lo of the namespace is found, but it has no tap device
+		_, err = readTapDevice(testNS, "lo")
+		Expect(err).To(MatchError(ContainSubstring(`failed to find the tap device of "lo"`)))
+		Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+
+		_, err = readTapDevice(testNS, "missing0")
+		Expect(err).To(MatchError(ContainSubstring(`failed to find the tap device of "missing0"`)))
+	})
+
+	It("publishes the tap device of the attachment", func() {
+		dev, err := publishedTapDevice(dataDir, "a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dev).To(BeNil())
+
+		published := &tapDevice{IfName: "net1", Path: "/dev/tap12", Major: 237, Minor: 3}
+		Expect(publishTapDevice(dataDir, "a", "net1", published)).To(Succeed())
+		Expect(filepath.Join(dataDir, "devinfo", "macvtap", "a_net1")).To(BeAnExistingFile())
+
+		dev, err = publishedTapDevice(dataDir, "a", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dev).To(Equal(published))
+
+		Expect(unpublishTapDevice(dataDir, "a", "net1")).To(Succeed())
+		Expect(filepath.Join(dataDir, "devinfo", "macvtap")).NotTo(BeADirectory())
+		Expect(unpublishTapDevice(dataDir, "a", "net1")).To(Succeed())
+	})
+})
+
+var _ = Describe("macvlan announcements", func() {
+	It("bounds the announcement settings", func() {
+		confFor := func(count, interval int) []byte {
+			return []byte(fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "mynet",
+				"type": "macvlan",
+				"master": "lo",
+				"announceCount": %d,
+				"announceInterval": %d
+			}`, count, interval))
+		}
+
+		n, _, err := loadConf(&skel.CmdArgs{StdinData: confFor(3, 0)}, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.AnnounceCount).To(Equal(3))
+		Expect(n.AnnounceInterval).To(Equal(defaultAnnounceInterval))
+
+		_, _, err = loadConf(&skel.CmdArgs{StdinData: confFor(maxAnnounceCount+1, 0)}, "")
+		Expect(err).To(MatchError(ContainSubstring("invalid announceCount")))
+
+		_, _, err = loadConf(&skel.CmdArgs{StdinData: confFor(1, maxAnnounceInterval+1)}, "")
+		Expect(err).To(MatchError(ContainSubstring("invalid announceInterval")))
+	})
+})
+
+var _ = Describe("macvlan l2Only", func() {
+	confFor := func(extra string) *skel.CmdArgs {
+		return &skel.CmdArgs{StdinData: []byte(fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "macvlan",
+			"master": "lo",
+			%s
+			"l2Only": true
+		}`, extra))}
+	}
+
+	It("is accepted without IPAM", func() {
+		n, _, err := loadConf(confFor(`"ipam": {},`), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.L2Only).To(BeTrue())
+	})
+
+	It("rejects the address settings", func() {
+		_, _, err := loadConf(confFor(`"ipam": {"type": "host-local", "subnet": "10.1.2.0/24"},`), "")
+		Expect(err).To(MatchError("l2Only and ipam are mutually exclusive"))
+
+		_, _, err = loadConf(confFor(`"announceCount": 3,`), "")
+		Expect(err).To(MatchError("announceCount is not supported with l2Only"))
+	})
+})
@@ -0,0 +1,158 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// tapDevice is the character device of a macvtap, which its consumer opens
+// rather than the interface. It is published in the device info file of
+// the attachment, <dataDir>/devinfo/macvtap/<containerID>_<ifName>.
+type tapDevice struct {
+	IfName string `json:"ifName"`
+	// Path is the device node, which the kernel names after the interface
+	// index in the network namespace of the interface
+	Path string `json:"path"`
+	// Major and Minor identify the device, e.g. to create its node in the
+	// container
+	Major uint32 `json:"major"`
+	Minor uint32 `json:"minor"`
+}
+
+const tapDevicesGroup = "macvtap"
+
+func openDeviceInfo(dataDir string) (*attachments.Store, error) {
+	return attachments.Open(filepath.Join(dataDir, "devinfo"))
+}
+
+// readTapDevice looks up the character device of the macvtap in a sysfs
+// mounted from the network namespace of the interface, as the sysfs of the
+// plugin only shows the interfaces of its own namespace. The mount lives in
+// a mount namespace of a thread that is left locked, so that it exits with
+// its goroutine rather than running other goroutines there.
+func readTapDevice(netns ns.NetNS, ifName string) (*tapDevice, error) {
+	type tapResult struct {
+		dev *tapDevice
+		err error
+	}
+	done := make(chan tapResult, 1)
+	go func() {
+		runtime.LockOSThread()
+		dev, err := func() (*tapDevice, error) {
+			if err := netns.Set(); err != nil {
+				return nil, fmt.Errorf("failed to enter netns %q: %v", netns.Path(), err)
+			}
+			if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+				return nil, fmt.Errorf("failed to unshare the mount namespace: %v", err)
+			}
+			if err := unix.Mount("", "/", "", unix.MS_PRIVATE|unix.MS_REC, ""); err != nil {
+				return nil, fmt.Errorf("failed to make the mounts private: %v", err)
+			}
+			dir, err := os.MkdirTemp("", "cni-sys-")
+			if err != nil {
+				return nil, fmt.Errorf("failed to create the private sysfs directory: %v", err)
+			}
+			defer os.Remove(dir)
+			if err := unix.Mount("sysfs", dir, "sysfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+				return nil, fmt.Errorf("failed to mount a private sysfs: %v", err)
+			}
+			defer unix.Unmount(dir, unix.MNT_DETACH)
+
+			return tapDeviceFromSysfs(dir, ifName)
+		}()
+		done <- tapResult{dev: dev, err: err}
+	}()
+	r := <-done
+	return r.dev, r.err
+}
+
+// tapDeviceFromSysfs reads the character device of the macvtap from a
+// sysfs mounted at sysDir
+func tapDeviceFromSysfs(sysDir, ifName string) (*tapDevice, error) {
+	entries, err := os.ReadDir(filepath.Join(sysDir, "class", "net", ifName, "macvtap"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the tap device of %q: %v", ifName, err)
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("failed to find the tap device of %q: %d candidates", ifName, len(entries))
+	}
+	name := entries[0].Name()
+	data, err := os.ReadFile(filepath.Join(sysDir, "class", "net", ifName, "macvtap", name, "dev"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the tap device of %q: %v", ifName, err)
+	}
+	dev := &tapDevice{IfName: ifName, Path: "/dev/" + name}
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "%d:%d", &dev.Major, &dev.Minor); err != nil {
+		return nil, fmt.Errorf("invalid tap device number %q of %q", data, ifName)
+	}
+	return dev, nil
+}
+
+// publishTapDevice writes the device info file of the attachment
+func publishTapDevice(dataDir, containerID, ifName string, dev *tapDevice) error {
+	store, err := openDeviceInfo(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.PutJSON(tapDevicesGroup, attachments.ID(containerID, ifName), dev)
+}
+
+// publishedTapDevice returns the device published for the attachment, or
+// nil when there is none
+func publishedTapDevice(dataDir, containerID, ifName string) (*tapDevice, error) {
+	if _, err := os.Stat(filepath.Join(dataDir, "devinfo")); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	store, err := openDeviceInfo(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	dev := &tapDevice{}
+	found, err := store.GetJSON(tapDevicesGroup, attachments.ID(containerID, ifName), dev)
+	if err != nil || !found {
+		return nil, err
+	}
+	return dev, nil
+}
+
+// unpublishTapDevice removes the device info file of the attachment
+func unpublishTapDevice(dataDir, containerID, ifName string) error {
+	if _, err := os.Stat(filepath.Join(dataDir, "devinfo")); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	store, err := openDeviceInfo(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	_, err = store.Remove(tapDevicesGroup, attachments.ID(containerID, ifName))
+	return err
+}
@@ -0,0 +1,223 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+const defaultDataDir = "/run/cni/macvlan"
+
+// parseVlanMaster splits a master name of the form <parent>.<vlan id>
+func parseVlanMaster(master string) (string, int, error) {
+	i := strings.LastIndex(master, ".")
+	if i <= 0 || i == len(master)-1 {
+		return "", 0, fmt.Errorf("master %q is not of the form <parent>.<vlan id>", master)
+	}
+	vlanID, err := strconv.Atoi(master[i+1:])
+	if err != nil || vlanID < 1 || vlanID > 4094 {
+		return "", 0, fmt.Errorf("master %q has an invalid VLAN ID", master)
+	}
+	return master[:i], vlanID, nil
+}
+
+// vlanMaster keeps track of the attachments using an auto-created VLAN
+// master, as a group named after the master. The group only exists for
+// masters created by the plugin, so that a pre-provisioned VLAN interface is
+// never removed.
+type vlanMaster struct {
+	name  string
+	store *attachments.Store
+}
+
+func lockVlanMaster(dataDir, name string) (*vlanMaster, error) {
+	store, err := attachments.Open(filepath.Join(dataDir, "vlan"))
+	if err != nil {
+		return nil, err
+	}
+	return &vlanMaster{name: name, store: store}, nil
+}
+
+func (m *vlanMaster) Unlock() {
+	m.store.Close()
+}
+
+// Acquire creates the VLAN master unless it exists and records the
+// attachment as one of its users
+func (m *vlanMaster) Acquire(attachment string) error {
+	_, err := netlinksafe.LinkByName(m.name)
+	if err == nil {
+		owned, err := m.store.HasGroup(m.name)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			// Provisioned by someone else, not ours to manage
+			return nil
+		}
+	} else {
+		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+			return fmt.Errorf("failed to lookup master %q: %v", m.name, err)
+		}
+		if err := createVlanMaster(m.name); err != nil {
+			return err
+		}
+	}
+	return m.store.Put(m.name, attachment, nil)
+}
+
+// Release drops the attachment and deletes the VLAN master once it was the
+// last one
+func (m *vlanMaster) Release(attachment string) error {
+	owned, err := m.store.HasGroup(m.name)
+	if err != nil || !owned {
+		return err
+	}
+	left, err := m.store.Remove(m.name, attachment)
+	if err != nil || left > 0 {
+		return err
+	}
+
+	link, err := netlinksafe.LinkByName(m.name)
+	if err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			return fmt.Errorf("failed to delete master %q: %v", m.name, err)
+		}
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return fmt.Errorf("failed to lookup master %q: %v", m.name, err)
+	}
+	return nil
+}
+
+func createVlanMaster(name string) error {
+	parentName, vlanID, err := parseVlanMaster(name)
+	if err != nil {
+		return err
+	}
+	parent, err := netlinksafe.LinkByName(parentName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup parent %q of master %q: %v", parentName, name, err)
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.Name = name
+	linkAttrs.ParentIndex = parent.Attrs().Index
+	vlan := &netlink.Vlan{
+		LinkAttrs: linkAttrs,
+		VlanId:    vlanID,
+	}
+	if err := netlink.LinkAdd(vlan); err != nil {
+		return fmt.Errorf("failed to create master %q: %v", name, err)
+	}
+	if err := netlink.LinkSetUp(vlan); err != nil {
+		_ = netlink.LinkDel(vlan)
+		return fmt.Errorf("failed to set master %q up: %v", name, err)
+	}
+	return nil
+}
+
+// createMacvlanOnVlanMaster creates the VLAN master when needed and the
+// macvlan on top of it, holding the lock so that a concurrent DEL cannot
+// remove the master in between
+func createMacvlanOnVlanMaster(conf *NetConf, args *skel.CmdArgs, netns ns.NetNS) (*current.Interface, error) {
+	m, err := lockVlanMaster(conf.DataDir, conf.Master)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Unlock()
+
+	id := attachments.ID(args.ContainerID, args.IfName)
+	if err := m.Acquire(id); err != nil {
+		return nil, err
+	}
+	macvlan, err := createMacvlan(conf, args.IfName, netns)
+	if err != nil {
+		_ = m.Release(id)
+		return nil, err
+	}
+	return macvlan, nil
+}
+
+func releaseVlanMaster(dataDir, master, containerID, ifName string) error {
+	m, err := lockVlanMaster(dataDir, master)
+	if err != nil {
+		return err
+	}
+	defer m.Unlock()
+
+	return m.Release(attachments.ID(containerID, ifName))
+}
+
+// selectedMasters records the master picked among the candidates of masters
+// for each attachment, so that CHECK and a repeated ADD use it rather than
+// evaluating the policy again against a changed carrier or default route
+const selectedMasters = "selected"
+
+func openSelectedMasters(dataDir string) (*attachments.Store, error) {
+	return attachments.Open(filepath.Join(dataDir, "masters"))
+}
+
+func recordMaster(dataDir, master, containerID, ifName string) error {
+	store, err := openSelectedMasters(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.Put(selectedMasters, attachments.ID(containerID, ifName), []byte(master))
+}
+
+// recordedMaster returns the master selected for the attachment, or "" when
+// none was recorded
+func recordedMaster(dataDir, containerID, ifName string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dataDir, "masters")); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	store, err := openSelectedMasters(dataDir)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	master, _, err := store.Get(selectedMasters, attachments.ID(containerID, ifName))
+	return string(master), err
+}
+
+func forgetMaster(dataDir, containerID, ifName string) error {
+	if _, err := os.Stat(filepath.Join(dataDir, "masters")); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	store, err := openSelectedMasters(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	_, err = store.Remove(selectedMasters, attachments.ID(containerID, ifName))
+	return err
+}
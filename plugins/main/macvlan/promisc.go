@@ -0,0 +1,119 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// promiscMaster keeps track of the attachments requiring the master in
+// promiscuous mode, as a group named after the master. The group only
+// exists while the plugin holds promiscuous mode on, so that a master
+// already promiscuous beforehand is left as it is.
+type promiscMaster struct {
+	name  string
+	store *attachments.Store
+}
+
+func openPromiscStore(dataDir string) (*attachments.Store, error) {
+	return attachments.Open(filepath.Join(dataDir, "promisc"))
+}
+
+// Acquire turns promiscuous mode on unless it already was, and records the
+// attachment as one of its users
+func (m *promiscMaster) Acquire(attachment string) error {
+	link, err := netlinksafe.LinkByName(m.name)
+	if err != nil {
+		return fmt.Errorf("failed to lookup master %q: %v", m.name, err)
+	}
+
+	owned, err := m.store.HasGroup(m.name)
+	if err != nil {
+		return err
+	}
+	if !owned && link.Attrs().Promisc != 0 {
+		// Enabled by someone else, not ours to manage
+		return nil
+	}
+	if err := m.store.Put(m.name, attachment, nil); err != nil {
+		return err
+	}
+
+	if link.Attrs().Promisc == 0 {
+		if err := netlink.SetPromiscOn(link); err != nil {
+			return fmt.Errorf("failed to set promiscuous mode on master %q: %v", m.name, err)
+		}
+	}
+	return nil
+}
+
+// Release drops the attachment and restores promiscuous mode off once it
+// was the last one
+func (m *promiscMaster) Release(attachment string) error {
+	left, err := m.store.Remove(m.name, attachment)
+	if err != nil || left > 0 {
+		return err
+	}
+
+	link, err := netlinksafe.LinkByName(m.name)
+	if err == nil {
+		if err := netlink.SetPromiscOff(link); err != nil {
+			return fmt.Errorf("failed to restore promiscuous mode on master %q: %v", m.name, err)
+		}
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return fmt.Errorf("failed to lookup master %q: %v", m.name, err)
+	}
+	return nil
+}
+
+func acquirePromisc(dataDir, master, containerID, ifName string) error {
+	store, err := openPromiscStore(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	m := &promiscMaster{name: master, store: store}
+	return m.Acquire(attachments.ID(containerID, ifName))
+}
+
+// releasePromisc releases the master the attachment was recorded on, which
+// is looked up as the master may have been selected among several ones
+func releasePromisc(dataDir, containerID, ifName string) error {
+	store, err := openPromiscStore(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	id := attachments.ID(containerID, ifName)
+	masters, err := store.GroupsOf(id)
+	if err != nil {
+		return err
+	}
+	for _, master := range masters {
+		m := &promiscMaster{name: master, store: store}
+		if err := m.Release(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
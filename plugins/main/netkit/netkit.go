@@ -0,0 +1,606 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	cniutils "github.com/containernetworking/cni/pkg/utils"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	modeL2 = "l2"
+	modeL3 = "l3"
+
+	policyForward   = "forward"
+	policyBlackhole = "blackhole"
+)
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+type NetConf struct {
+	types.NetConf
+	IPMasq        bool    `json:"ipMasq"`
+	IPMasqBackend *string `json:"ipMasqBackend,omitempty"`
+	MTU           int     `json:"mtu"`
+
+	// Mode is the mode of the netkit pair, "l3" (default) or "l2"
+	Mode string `json:"mode"`
+	// Policy is the default policy of the primary device in the host,
+	// applied when no BPF program is attached to it: "forward" (default)
+	// or "blackhole"
+	Policy string `json:"policy"`
+	// PeerPolicy is the default policy of the peer device in the container
+	PeerPolicy string `json:"peerPolicy"`
+
+	// HostName names the primary device, instead of a random name
+	HostName string `json:"hostName,omitempty"`
+
+	mode       netlink.NetkitMode
+	policy     netlink.NetkitPolicy
+	peerPolicy netlink.NetkitPolicy
+}
+
+func parsePolicy(field, policy string) (netlink.NetkitPolicy, error) {
+	switch policy {
+	case "", policyForward:
+		return netlink.NETKIT_POLICY_FORWARD, nil
+	case policyBlackhole:
+		return netlink.NETKIT_POLICY_BLACKHOLE, nil
+	}
+	return 0, fmt.Errorf("invalid %s %q, must be %s or %s", field, policy, policyForward, policyBlackhole)
+}
+
+func policyName(policy netlink.NetkitPolicy) string {
+	switch policy {
+	case netlink.NETKIT_POLICY_FORWARD:
+		return policyForward
+	case netlink.NETKIT_POLICY_BLACKHOLE:
+		return policyBlackhole
+	}
+	return fmt.Sprintf("%d", policy)
+}
+
+func modeName(mode netlink.NetkitMode) string {
+	switch mode {
+	case netlink.NETKIT_MODE_L2:
+		return modeL2
+	case netlink.NETKIT_MODE_L3:
+		return modeL3
+	}
+	return fmt.Sprintf("%d", mode)
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	switch n.Mode {
+	case "":
+		n.Mode = modeL3
+		n.mode = netlink.NETKIT_MODE_L3
+	case modeL3:
+		n.mode = netlink.NETKIT_MODE_L3
+	case modeL2:
+		n.mode = netlink.NETKIT_MODE_L2
+	default:
+		return nil, fmt.Errorf("invalid mode %q, must be %s or %s", n.Mode, modeL3, modeL2)
+	}
+
+	var err error
+	if n.policy, err = parsePolicy("policy", n.Policy); err != nil {
+		return nil, err
+	}
+	if n.peerPolicy, err = parsePolicy("peerPolicy", n.PeerPolicy); err != nil {
+		return nil, err
+	}
+
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d, must be positive", n.MTU)
+	}
+	if n.HostName != "" {
+		if err := cniutils.ValidateInterfaceName(n.HostName); err != nil {
+			return nil, fmt.Errorf("invalid hostName %q: %v", n.HostName, err)
+		}
+	}
+	if n.IPAM.Type == "" {
+		return nil, errors.New(`"ipam" is required, the container is routed through the host`)
+	}
+	return n, nil
+}
+
+// randomHostName returns a random name for the primary device, "nk"
+// followed by 8 hex characters
+func randomHostName() (string, error) {
+	entropy := make([]byte, 4)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", fmt.Errorf("failed to generate random netkit name: %v", err)
+	}
+	return fmt.Sprintf("nk%x", entropy), nil
+}
+
+// createNetkit creates the netkit pair, with the primary device in the host
+// namespace and the peer device named ifName in the container namespace.
+// The primary device holds the BPF programs of both devices.
+func createNetkit(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, *current.Interface, error) {
+	// The peer is created in the container, so an existing name there
+	// can't be told apart from a taken host name afterwards
+	err := netns.Do(func(_ ns.NetNS) error {
+		if _, err := netlinksafe.LinkByName(ifName); err == nil {
+			return fmt.Errorf("container interface %q already exists", ifName)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hostName string
+	for i := 0; i < 10; i++ {
+		hostName = conf.HostName
+		if hostName == "" {
+			if hostName, err = randomHostName(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		linkAttrs := netlink.NewLinkAttrs()
+		linkAttrs.Name = hostName
+		linkAttrs.MTU = conf.MTU
+		nk := &netlink.Netkit{
+			LinkAttrs:  linkAttrs,
+			Mode:       conf.mode,
+			Policy:     conf.policy,
+			PeerPolicy: conf.peerPolicy,
+		}
+		peerAttrs := netlink.NewLinkAttrs()
+		peerAttrs.Name = ifName
+		peerAttrs.MTU = conf.MTU
+		peerAttrs.Namespace = netlink.NsFd(int(netns.Fd()))
+		nk.SetPeerAttrs(&peerAttrs)
+
+		err = netlink.LinkAdd(nk)
+		// Only a random name is tried again
+		if err == nil || !os.IsExist(err) || conf.HostName != "" {
+			break
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create netkit pair %q: %v", hostName, err)
+	}
+
+	primary, err := netlinksafe.LinkByName(hostName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lookup %q: %v", hostName, err)
+	}
+	// Deleting the primary device deletes the pair
+	defer func() {
+		if err != nil {
+			netlink.LinkDel(primary)
+		}
+	}()
+	if err = netlink.LinkSetUp(primary); err != nil {
+		return nil, nil, fmt.Errorf("failed to set %q up: %v", hostName, err)
+	}
+	hostInterface := &current.Interface{Name: hostName}
+	if len(primary.Attrs().HardwareAddr) != 0 {
+		hostInterface.Mac = primary.Attrs().HardwareAddr.String()
+	}
+
+	containerInterface := &current.Interface{Name: ifName, Sandbox: netns.Path()}
+	err = netns.Do(func(_ ns.NetNS) error {
+		peer, err := netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+		}
+		if err := netlink.LinkSetUp(peer); err != nil {
+			return fmt.Errorf("failed to set %q up: %v", ifName, err)
+		}
+		if len(peer.Attrs().HardwareAddr) != 0 {
+			containerInterface.Mac = peer.Attrs().HardwareAddr.String()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return hostInterface, containerInterface, nil
+}
+
+// configureContainer configures the addresses and routes of the peer device.
+// As in ptp, the subnet route added with the addresses is replaced by a
+// route to the gateway only, through which the rest of the subnet is
+// routed: the container only talks to the host.
+func configureContainer(netns ns.NetNS, ifName string, result *current.Result) error {
+	return netns.Do(func(_ ns.NetNS) error {
+		peer, err := net.InterfaceByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to look up %q: %v", ifName, err)
+		}
+
+		if err := ipam.ConfigureIface(ifName, result); err != nil {
+			return err
+		}
+
+		for _, ipc := range result.IPs {
+			route := netlink.Route{
+				LinkIndex: peer.Index,
+				Dst: &net.IPNet{
+					IP:   ipc.Address.IP.Mask(ipc.Address.Mask),
+					Mask: ipc.Address.Mask,
+				},
+				Scope: netlink.SCOPE_NOWHERE,
+			}
+			if err := netlink.RouteDel(&route); err != nil {
+				return fmt.Errorf("failed to delete route %v: %v", route, err)
+			}
+
+			addrBits := 32
+			if ipc.Address.IP.To4() == nil {
+				addrBits = 128
+			}
+			for _, r := range []netlink.Route{
+				{
+					LinkIndex: peer.Index,
+					Dst: &net.IPNet{
+						IP:   ipc.Gateway,
+						Mask: net.CIDRMask(addrBits, addrBits),
+					},
+					Scope: netlink.SCOPE_LINK,
+					Src:   ipc.Address.IP,
+				},
+				{
+					LinkIndex: peer.Index,
+					Dst: &net.IPNet{
+						IP:   ipc.Address.IP.Mask(ipc.Address.Mask),
+						Mask: ipc.Address.Mask,
+					},
+					Scope: netlink.SCOPE_UNIVERSE,
+					Gw:    ipc.Gateway,
+					Src:   ipc.Address.IP,
+				},
+			} {
+				if err := netlink.RouteAdd(&r); err != nil {
+					return fmt.Errorf("failed to add route %v: %v", r, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// configureHost adds the gateways to the primary device, and the routes
+// to the container addresses through it
+func configureHost(hostName string, result *current.Result) error {
+	primary, err := netlinksafe.LinkByName(hostName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", hostName, err)
+	}
+
+	for _, ipc := range result.IPs {
+		maskLen := 128
+		if ipc.Address.IP.To4() != nil {
+			maskLen = 32
+		}
+
+		gw := &net.IPNet{IP: ipc.Gateway, Mask: net.CIDRMask(maskLen, maskLen)}
+		if err := netlink.AddrAdd(primary, &netlink.Addr{IPNet: gw}); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to add IP addr %s to %q: %v", gw, hostName, err)
+		}
+
+		dst := &net.IPNet{IP: ipc.Address.IP, Mask: net.CIDRMask(maskLen, maskLen)}
+		if err := ip.AddHostRoute(dst, nil, primary); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to add route on host: %v", err)
+		}
+	}
+	return nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(conf.IPAM.Type, args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(conf.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	result, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+	if len(result.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range result.IPs {
+		if ipc.Gateway == nil {
+			err = fmt.Errorf("IPAM plugin returned no gateway for %s, the container is routed through it", ipc.Address.String())
+			return err
+		}
+	}
+
+	if err = ip.EnableForward(result.IPs); err != nil {
+		return fmt.Errorf("Could not enable IP forwarding: %v", err)
+	}
+
+	hostInterface, containerInterface, err := createNetkit(conf, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+	// Delete the pair if the attachment fails past this point
+	defer func() {
+		if err != nil {
+			if link, lookupErr := netlinksafe.LinkByName(hostInterface.Name); lookupErr == nil {
+				netlink.LinkDel(link)
+			}
+		}
+	}()
+
+	result.Interfaces = []*current.Interface{hostInterface, containerInterface}
+	for _, ipc := range result.IPs {
+		// All addresses apply to the container netkit device
+		ipc.Interface = current.Int(1)
+	}
+
+	if err = configureContainer(netns, args.IfName, result); err != nil {
+		return err
+	}
+	if err = configureHost(hostInterface.Name, result); err != nil {
+		return err
+	}
+
+	if conf.IPMasq {
+		ipns := []*net.IPNet{}
+		for _, ipc := range result.IPs {
+			ipns = append(ipns, &ipc.Address)
+		}
+		if err = ip.SetupIPMasqForNetworks(conf.IPMasqBackend, ipns, conf.Name, args.IfName, args.ContainerID); err != nil {
+			return err
+		}
+	}
+
+	if conf.DNS.Nameservers != nil || conf.DNS.Search != nil || conf.DNS.Options != nil || conf.DNS.Domain != "" {
+		result.DNS = conf.DNS
+	}
+
+	return types.PrintResult(result, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if err := ipam.ExecDel(conf.IPAM.Type, args.StdinData); err != nil {
+		return err
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	// There is a netns so try to clean up. Delete can be called multiple times
+	// so don't return an error if the device is already removed.
+	// If the device isn't there then don't try to clean up IP masq either.
+	var ipnets []*net.IPNet
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		var err error
+		ipnets, err = ip.DelLinkByNameAddr(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	if len(ipnets) != 0 && conf.IPMasq {
+		if err := ip.TeardownIPMasqForNetworks(ipnets, conf.Name, args.IfName, args.ContainerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("netkit"))
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	// run the IPAM plugin and get back the config to apply
+	err = ipam.ExecCheck(conf.IPAM.Type, args.StdinData)
+	if err != nil {
+		return err
+	}
+	if conf.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("netkit: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+		return err
+	}
+	// Convert whatever the IPAM result was into the current Result type
+	result, err := current.NewResultFromResult(conf.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap, hostMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+			continue
+		}
+		if intf.Sandbox == "" && hostMap.Name == "" {
+			hostMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+	if conf.HostName != "" && hostMap.Name != conf.HostName {
+		return fmt.Errorf("netkit: host interface %q in prevResult doesn't match configured name %q", hostMap.Name, conf.HostName)
+	}
+
+	// The policies are only reported by the primary device
+	if err := validateHostInterface(conf, hostMap); err != nil {
+		return err
+	}
+
+	//
+	// Check prevResults for ips, routes and dns against values found in the container
+	return netns.Do(func(_ ns.NetNS) error {
+		// Check interface against values found in the container
+		if err := validateCniContainerInterface(conf, contMap); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateHostInterface(conf *NetConf, intf current.Interface) error {
+	if intf.Name == "" {
+		return fmt.Errorf("netkit: host interface name missing in prevResult")
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("netkit: host interface %q in prevResult not found: %v", intf.Name, err)
+	}
+	nk, ok := link.(*netlink.Netkit)
+	if !ok || !nk.IsPrimary() {
+		return fmt.Errorf("netkit: host interface %q is not a netkit primary device", intf.Name)
+	}
+	if nk.Policy != conf.policy {
+		return fmt.Errorf("netkit: host interface %q policy %s doesn't match configured policy %s", intf.Name, policyName(nk.Policy), policyName(conf.policy))
+	}
+	if nk.PeerPolicy != conf.peerPolicy {
+		return fmt.Errorf("netkit: host interface %q peer policy %s doesn't match configured peer policy %s", intf.Name, policyName(nk.PeerPolicy), policyName(conf.peerPolicy))
+	}
+	return nil
+}
+
+func validateCniContainerInterface(conf *NetConf, intf current.Interface) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("netkit: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+	if intf.Sandbox == "" {
+		return fmt.Errorf("netkit: Error: Container interface %s should not be in host namespace", link.Attrs().Name)
+	}
+
+	nk, ok := link.(*netlink.Netkit)
+	if !ok {
+		return fmt.Errorf("Error: Container interface %s not of type netkit", link.Attrs().Name)
+	}
+	if nk.Mode != conf.mode {
+		return fmt.Errorf("netkit: Container interface %s mode %s doesn't match configured mode %s", intf.Name, modeName(nk.Mode), conf.Mode)
+	}
+
+	if intf.Mac != "" {
+		if intf.Mac != link.Attrs().HardwareAddr.String() {
+			return fmt.Errorf("netkit: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+		}
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if err := ipam.ExecStatus(conf.IPAM.Type, args.StdinData); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const IFNAME = "eth0"
+
+var _ = Describe("netkit configuration", func() {
+	It("applies the defaults", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "netkit", "ipam": {"type": "host-local"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Mode).To(Equal(modeL3))
+		Expect(n.mode).To(Equal(netlink.NETKIT_MODE_L3))
+		Expect(n.policy).To(Equal(netlink.NETKIT_POLICY_FORWARD))
+		Expect(n.peerPolicy).To(Equal(netlink.NETKIT_POLICY_FORWARD))
+	})
+
+	It("parses the mode and policies", func() {
+		n, err := loadConf([]byte(`{"mode": "l2", "policy": "forward", "peerPolicy": "blackhole", "ipam": {"type": "host-local"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.mode).To(Equal(netlink.NETKIT_MODE_L2))
+		Expect(n.policy).To(Equal(netlink.NETKIT_POLICY_FORWARD))
+		Expect(n.peerPolicy).To(Equal(netlink.NETKIT_POLICY_BLACKHOLE))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid mode", `{"mode": "l4", "ipam": {"type": "host-local"}}`, `invalid mode "l4"`),
+		Entry("with an invalid policy", `{"policy": "drop", "ipam": {"type": "host-local"}}`, `invalid policy "drop"`),
+		Entry("with an invalid peer policy", `{"peerPolicy": "drop", "ipam": {"type": "host-local"}}`, `invalid peerPolicy "drop"`),
+		Entry("with a negative MTU", `{"mtu": -1, "ipam": {"type": "host-local"}}`, "invalid MTU -1"),
+		Entry("with an invalid host name", `{"hostName": "a/b", "ipam": {"type": "host-local"}}`, `invalid hostName "a/b"`),
+		Entry("without IPAM", `{}`, `"ipam" is required`),
+	)
+})
+
+var _ = Describe("netkit Operations", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir, err = os.MkdirTemp("", "netkit_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	for _, mode := range []string{modeL3, modeL2} {
+		mode := mode
+
+		It(fmt.Sprintf("configures, checks and deletes an %s netkit pair", mode), func() {
+			conf := fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "mynet",
+				"type": "netkit",
+				"mode": "%s",
+				"peerPolicy": "blackhole",
+				"hostName": "nk-test",
+				"mtu": 1400,
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.1.2.0/24",
+					"dataDir": "%s"
+				}
+			}`, mode, dataDir)
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       targetNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   []byte(conf),
+			}
+
+			var result *types100.Result
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				r, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+				result, err = types100.GetResult(r)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Interfaces).To(HaveLen(2))
+				Expect(result.Interfaces[0].Name).To(Equal("nk-test"))
+				Expect(result.Interfaces[1].Name).To(Equal(IFNAME))
+				Expect(result.Interfaces[1].Sandbox).To(Equal(targetNS.Path()))
+				Expect(result.IPs).To(HaveLen(1))
+				Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.2/24"))
+
+				primary, err := netlinksafe.LinkByName("nk-test")
+				Expect(err).NotTo(HaveOccurred())
+				nk, ok := primary.(*netlink.Netkit)
+				Expect(ok).To(BeTrue())
+				Expect(nk.IsPrimary()).To(BeTrue())
+				Expect(nk.PeerPolicy).To(Equal(netlink.NETKIT_POLICY_BLACKHOLE))
+				Expect(primary.Attrs().MTU).To(Equal(1400))
+
+				addrs, err := netlinksafe.AddrList(primary, netlink.FAMILY_V4)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(addrs).To(HaveLen(1))
+				Expect(addrs[0].IPNet.String()).To(Equal("10.1.2.1/32"))
+
+				routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{
+					LinkIndex: primary.Attrs().Index,
+					Dst:       &net.IPNet{IP: net.ParseIP("10.1.2.2").To4(), Mask: net.CIDRMask(32, 32)},
+				}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(routes).To(HaveLen(1))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				nk, ok := link.(*netlink.Netkit)
+				Expect(ok).To(BeTrue())
+				Expect(nk.IsPrimary()).To(BeFalse())
+				Expect(modeName(nk.Mode)).To(Equal(mode))
+				Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+				if mode == modeL3 {
+					Expect(link.Attrs().HardwareAddr).To(BeEmpty())
+				}
+
+				routes, err := netlinksafe.RouteList(link, netlink.FAMILY_V4)
+				Expect(err).NotTo(HaveOccurred())
+				var dsts []string
+				for _, r := range routes {
+					dsts = append(dsts, r.Dst.String())
+				}
+				Expect(dsts).To(ConsistOf("10.1.2.1/32", "10.1.2.0/24"))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// CHECK with the result of ADD
+			var confMap map[string]interface{}
+			Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+			resultBytes, err := json.Marshal(result)
+			Expect(err).NotTo(HaveOccurred())
+			var prevResult map[string]interface{}
+			Expect(json.Unmarshal(resultBytes, &prevResult)).To(Succeed())
+			confMap["prevResult"] = prevResult
+			checkConf, err := json.Marshal(confMap)
+			Expect(err).NotTo(HaveOccurred())
+			args.StdinData = checkConf
+
+			err = originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				Expect(testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })).To(Succeed())
+
+				// A different peer policy is reported
+				confMap["peerPolicy"] = policyForward
+				otherConf, err := json.Marshal(confMap)
+				Expect(err).NotTo(HaveOccurred())
+				otherArgs := *args
+				otherArgs.StdinData = otherConf
+				err = testutils.CmdCheckWithArgs(&otherArgs, func() error { return cmdCheck(&otherArgs) })
+				Expect(err).To(MatchError(ContainSubstring("peer policy blackhole doesn't match configured peer policy forward")))
+
+				Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+
+				// Deleting the peer deleted the primary device
+				_, err = netlinksafe.LinkByName("nk-test")
+				Expect(err).To(HaveOccurred())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	}
+
+	It("fails when the container interface already exists", func() {
+		err := targetNS.Do(func(ns.NetNS) error {
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = IFNAME
+			return netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: "peer0"})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		conf, err := loadConf([]byte(`{"ipam": {"type": "host-local"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		err = originalNS.Do(func(ns.NetNS) error {
+			_, _, err := createNetkit(conf, IFNAME, targetNS)
+			return err
+		})
+		Expect(err).To(MatchError(`container interface "eth0" already exists`))
+	})
+})
@@ -0,0 +1,503 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin attaching the container to an existing Open vSwitch
+// bridge, through a veth pair whose host end is a port of the bridge.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const defaultSocketFile = "/var/run/openvswitch/db.sock"
+
+type NetConf struct {
+	types.NetConf
+	// Bridge names the OVS bridge the container is attached to, which must
+	// exist
+	Bridge string `json:"bridge"`
+	// SocketFile is the unix socket of ovsdb-server
+	SocketFile string `json:"socketFile,omitempty"`
+	// VLAN is the access tag of the port, untagged by default
+	VLAN int `json:"vlan,omitempty"`
+	// Trunks are the VLANs trunked on the port, all by default
+	Trunks []int `json:"trunks,omitempty"`
+	MTU    int   `json:"mtu,omitempty"`
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	if n.Bridge == "" {
+		return nil, errors.New(`"bridge" field is required. It specifies the OVS bridge to attach to`)
+	}
+	if n.SocketFile == "" {
+		n.SocketFile = defaultSocketFile
+	}
+	if n.VLAN < 0 || n.VLAN > 4094 {
+		return nil, fmt.Errorf("invalid VLAN ID %d (must be between 0 and 4094)", n.VLAN)
+	}
+	for _, t := range n.Trunks {
+		if t < 0 || t > 4094 {
+			return nil, fmt.Errorf("invalid trunk VLAN ID %d (must be between 0 and 4094)", t)
+		}
+	}
+	sort.Ints(n.Trunks)
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d, must be positive", n.MTU)
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the container interface
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// setupVeth creates the veth pair in the container and moves its host end
+// to the host namespace
+func setupVeth(netns ns.NetNS, ifName string, mtu int) (*current.Interface, *current.Interface, error) {
+	contIface := &current.Interface{}
+	hostIface := &current.Interface{}
+
+	err := netns.Do(func(hostNS ns.NetNS) error {
+		hostVeth, containerVeth, err := ip.SetupVeth(ifName, mtu, "", hostNS)
+		if err != nil {
+			return err
+		}
+		contIface.Name = containerVeth.Name
+		contIface.Mac = containerVeth.HardwareAddr.String()
+		contIface.Sandbox = netns.Path()
+		hostIface.Name = hostVeth.Name
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// need to lookup hostVeth again as its index has changed during ns move
+	hostVeth, err := netlinksafe.LinkByName(hostIface.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lookup %q: %v", hostIface.Name, err)
+	}
+	hostIface.Mac = hostVeth.Attrs().HardwareAddr.String()
+
+	return hostIface, contIface, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	ovsdb, err := dialOVSDB(n.SocketFile)
+	if err != nil {
+		return err
+	}
+	defer ovsdb.Close()
+
+	hostInterface, containerInterface, err := setupVeth(netns, args.IfName, n.MTU)
+	if err != nil {
+		return err
+	}
+	// Delete the pair if the attachment fails past this point
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	externalIDs := attachmentIDs(n.Name, args.ContainerID, args.IfName)
+	externalIDs[externalIDNetns] = args.Netns
+	err = addPort(ovsdb, n.Bridge, hostInterface.Name, n.VLAN, n.Trunks, containerInterface.Mac, externalIDs)
+	if err != nil {
+		return err
+	}
+	// The port is left behind by the deletion of its interface
+	defer func() {
+		if err != nil {
+			if ports, findErr := findPorts(ovsdb, attachmentIDs(n.Name, args.ContainerID, args.IfName)); findErr == nil {
+				removePorts(ovsdb, ports)
+			}
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{hostInterface, containerInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses apply to the container veth interface
+		ipc.Interface = current.Int(1)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	// The port outlives the veth pair, which is gone with the namespace
+	ovsdb, err := dialOVSDB(n.SocketFile)
+	if err != nil {
+		return err
+	}
+	defer ovsdb.Close()
+
+	ports, err := findPorts(ovsdb, attachmentIDs(n.Name, args.ContainerID, args.IfName))
+	if err != nil {
+		return err
+	}
+	if err := removePorts(ovsdb, ports); err != nil {
+		return err
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err := ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// cmdGC removes the ports of the attachments of the network that are not in
+// the list of valid attachments, with their veth pairs
+func cmdGC(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecGC(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	valid := make(map[types.GCAttachment]bool, len(n.ValidAttachments))
+	for _, a := range n.ValidAttachments {
+		valid[a] = true
+	}
+
+	ovsdb, err := dialOVSDB(n.SocketFile)
+	if err != nil {
+		return err
+	}
+	defer ovsdb.Close()
+
+	ports, err := findPorts(ovsdb, map[string]string{externalIDNetwork: n.Name})
+	if err != nil {
+		return err
+	}
+	stale := []port{}
+	for _, p := range ports {
+		attachment := types.GCAttachment{
+			ContainerID: p.externalIDs[externalIDContainerID],
+			IfName:      p.externalIDs[externalIDIfName],
+		}
+		if !valid[attachment] {
+			stale = append(stale, p)
+		}
+	}
+	if err := removePorts(ovsdb, stale); err != nil {
+		return err
+	}
+
+	// The pair of a stale port whose namespace is still around is deleted
+	// through its host end
+	var errs []error
+	for _, p := range stale {
+		if err := ip.DelLinkByName(p.name); err != nil && err != ip.ErrLinkNotFound {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("ovs-bridge: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap, hostMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+		if intf.Sandbox == "" {
+			hostMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	ovsdb, err := dialOVSDB(n.SocketFile)
+	if err != nil {
+		return err
+	}
+	defer ovsdb.Close()
+
+	if err := validatePort(ovsdb, n, args, hostMap); err != nil {
+		return err
+	}
+
+	hostLink, err := netlinksafe.LinkByName(hostMap.Name)
+	if err != nil {
+		return fmt.Errorf("ovs-bridge: Host interface %s not found: %v", hostMap.Name, err)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, hostLink.Attrs().Index); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+// validatePort verifies that the port of the attachment is the host
+// interface, on the bridge, with the configured VLANs
+func validatePort(ovsdb *ovsdbClient, n *NetConf, args *skel.CmdArgs, hostIntf current.Interface) error {
+	ports, err := findPorts(ovsdb, attachmentIDs(n.Name, args.ContainerID, args.IfName))
+	if err != nil {
+		return err
+	}
+	if len(ports) != 1 {
+		return fmt.Errorf("ovs-bridge: found %d ports for %s/%s, expected 1", len(ports), args.ContainerID, args.IfName)
+	}
+	p := ports[0]
+
+	if p.name != hostIntf.Name {
+		return fmt.Errorf("ovs-bridge: port %s doesn't match host interface %s in prevResult", p.name, hostIntf.Name)
+	}
+	onBridge, err := bridgeHasPort(ovsdb, n.Bridge, p)
+	if err != nil {
+		return err
+	}
+	if !onBridge {
+		return fmt.Errorf("ovs-bridge: port %s isn't on bridge %s", p.name, n.Bridge)
+	}
+	if p.tag != n.VLAN {
+		return fmt.Errorf("ovs-bridge: port %s tag %d doesn't match configured VLAN %d", p.name, p.tag, n.VLAN)
+	}
+	if !slices.Equal(p.trunks, n.Trunks) {
+		return fmt.Errorf("ovs-bridge: port %s trunks %v don't match configured trunks %v", p.name, p.trunks, n.Trunks)
+	}
+	return nil
+}
+
+func validateCniContainerInterface(intf current.Interface, hostIndex int) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("ovs-bridge: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	if _, isVeth := link.(*netlink.Veth); !isVeth {
+		return fmt.Errorf("ovs-bridge: Container interface %s not of type veth", intf.Name)
+	}
+	_, peerIndex, err := ip.GetVethPeerIfindex(intf.Name)
+	if err != nil {
+		return fmt.Errorf("ovs-bridge: Unable to obtain veth peer index for veth %s: %v", intf.Name, err)
+	}
+	if peerIndex != hostIndex {
+		return fmt.Errorf("ovs-bridge: Container interface %s isn't paired with the port", intf.Name)
+	}
+
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("ovs-bridge: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	ovsdb, err := dialOVSDB(n.SocketFile)
+	if err != nil {
+		return err
+	}
+	defer ovsdb.Close()
+
+	exists, err := bridgeExists(ovsdb, n.Bridge)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bridge %q not found", n.Bridge)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		GC:     cmdGC,
+		Status: cmdStatus,
+	}, version.All, bv.BuildString("ovs-bridge"))
+}
@@ -0,0 +1,343 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const IFNAME = "eth0"
+
+var _ = Describe("ovs-bridge configuration", func() {
+	It("applies the defaults", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "ovs-bridge", "bridge": "br0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.SocketFile).To(Equal(defaultSocketFile))
+		Expect(n.VLAN).To(BeZero())
+		Expect(n.Trunks).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("without a bridge", `{}`, `"bridge" field is required`),
+		Entry("with an invalid VLAN", `{"bridge": "br0", "vlan": 4095}`, "invalid VLAN ID 4095"),
+		Entry("with an invalid trunk", `{"bridge": "br0", "trunks": [10, -1]}`, "invalid trunk VLAN ID -1"),
+		Entry("with a negative MTU", `{"bridge": "br0", "mtu": -1}`, "invalid MTU -1"),
+	)
+})
+
+var _ = Describe("ovs-bridge Operations", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+	var ovsdb *fakeOVSDB
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir, err = os.MkdirTemp("", "ovs_bridge_test")
+		Expect(err).NotTo(HaveOccurred())
+		ovsdb = newFakeOVSDB(dataDir, "br0", "br1")
+	})
+
+	AfterEach(func() {
+		ovsdb.Close()
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	// addAttachment runs ADD for the interface, with the configuration
+	// without IPAM
+	addAttachment := func(containerID, ifName string) *types100.Result {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ovs-bridge",
+			"bridge": "br0",
+			"socketFile": "%s"
+		}`, ovsdb.socketFile)
+		args := &skel.CmdArgs{
+			ContainerID: containerID,
+			Netns:       targetNS.Path(),
+			IfName:      ifName,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	It("attaches, checks and detaches a container", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ovs-bridge",
+			"bridge": "br0",
+			"socketFile": "%s",
+			"vlan": 100,
+			"trunks": [20, 10],
+			"mtu": 1400,
+			"ipam": {
+				"type": "host-local",
+				"subnet": "10.1.2.0/24",
+				"dataDir": "%s"
+			}
+		}`, ovsdb.socketFile, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Interfaces).To(HaveLen(2))
+			Expect(result.Interfaces[1].Name).To(Equal(IFNAME))
+			Expect(result.Interfaces[1].Sandbox).To(Equal(targetNS.Path()))
+			Expect(result.IPs).To(HaveLen(1))
+			Expect(*result.IPs[0].Interface).To(Equal(1))
+			Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.2/24"))
+
+			hostName := result.Interfaces[0].Name
+			hostVeth, err := netlinksafe.LinkByName(hostName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostVeth.Attrs().MTU).To(Equal(1400))
+
+			Expect(ovsdb.portBridges(hostName)).To(Equal([]string{"br0"}))
+			p := ovsdb.port(hostName)
+			Expect(p["tag"]).To(BeEquivalentTo(100))
+			Expect(elements(p["trunks"])).To(ConsistOf(BeEquivalentTo(10), BeEquivalentTo(20)))
+			Expect(p["external_ids"]).To(ContainElement(ContainElements(
+				[]interface{}{externalIDContainerID, "dummy"},
+				[]interface{}{externalIDIfName, IFNAME},
+				[]interface{}{externalIDNetwork, "mynet"},
+				[]interface{}{externalIDNetns, targetNS.Path()},
+			)))
+			Expect(ovsdb.interfaceOf(hostName)["external_ids"]).To(Equal(
+				ovsMap(map[string]string{externalIDAttachedMac: result.Interfaces[1].Mac}),
+			))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			_, isVeth := link.(*netlink.Veth)
+			Expect(isVeth).To(BeTrue())
+			Expect(link.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+			Expect(link.Attrs().MTU).To(Equal(1400))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// CHECK with the result of ADD
+		var confMap map[string]interface{}
+		Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+		resultBytes, err := json.Marshal(result)
+		Expect(err).NotTo(HaveOccurred())
+		var prevResult map[string]interface{}
+		Expect(json.Unmarshal(resultBytes, &prevResult)).To(Succeed())
+		confMap["prevResult"] = prevResult
+		checkConf, err := json.Marshal(confMap)
+		Expect(err).NotTo(HaveOccurred())
+		args.StdinData = checkConf
+
+		hostName := result.Interfaces[0].Name
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })).To(Succeed())
+
+			// A port retagged behind the plugin's back is reported
+			ovsdb.setPort(hostName, "tag", 200)
+			err := testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+			Expect(err).To(MatchError(ContainSubstring("tag 200 doesn't match configured VLAN 100")))
+			ovsdb.setPort(hostName, "tag", 100)
+
+			// So are other trunks
+			ovsdb.setPort(hostName, "trunks", ovsSet(10))
+			err = testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })
+			Expect(err).To(MatchError(ContainSubstring("trunks [10] don't match configured trunks [10 20]")))
+
+			Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+
+			Expect(ovsdb.port(hostName)).To(BeNil())
+			_, err = netlinksafe.LinkByName(hostName)
+			Expect(err).To(HaveOccurred())
+
+			// DEL is idempotent
+			Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails on a missing bridge and leaves no veth behind", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ovs-bridge",
+			"bridge": "br-missing",
+			"socketFile": "%s"
+		}`, ovsdb.socketFile)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(`bridge "br-missing" not found`))
+
+			err = testutils.CmdStatus(func() error { return cmdStatus(args) })
+			Expect(err).To(MatchError(`bridge "br-missing" not found`))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("removes the port on DEL once the namespace is gone", func() {
+		result := addAttachment("dummy", IFNAME)
+		hostName := result.Interfaces[0].Name
+
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "mynet",
+			"type": "ovs-bridge",
+			"bridge": "br0",
+			"socketFile": "%s"
+		}`, ovsdb.socketFile)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+			Expect(ovsdb.port(hostName)).To(BeNil())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("removes the ports of stale attachments on GC", func() {
+		valid := addAttachment("valid", "eth0")
+		stale := addAttachment("stale", "eth1")
+		validName := valid.Interfaces[0].Name
+		staleName := stale.Interfaces[0].Name
+
+		gcConf := fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "mynet",
+			"type": "ovs-bridge",
+			"bridge": "br0",
+			"socketFile": "%s",
+			"cni.dev/valid-attachments": [{"containerID": "valid", "ifname": "eth0"}]
+		}`, ovsdb.socketFile)
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(cmdGC(&skel.CmdArgs{StdinData: []byte(gcConf)})).To(Succeed())
+
+			Expect(ovsdb.port(validName)).NotTo(BeNil())
+			_, err := netlinksafe.LinkByName(validName)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ovsdb.port(staleName)).To(BeNil())
+			_, err = netlinksafe.LinkByName(staleName)
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = netlinksafe.LinkByName("eth1")
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,265 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// This is a minimal client of the OVSDB management protocol (RFC 7047),
+// enough to run transactions on the Open_vSwitch database over its unix
+// socket, as ovs-vsctl does.
+
+const (
+	ovsDatabase = "Open_vSwitch"
+
+	ovsdbTimeout = 30 * time.Second
+)
+
+// operation is an operation of a transaction. Only the members used by the
+// op are set.
+type operation struct {
+	Op        string                   `json:"op"`
+	Table     string                   `json:"table"`
+	Row       map[string]interface{}   `json:"row,omitempty"`
+	Rows      []map[string]interface{} `json:"rows,omitempty"`
+	Where     []interface{}            `json:"where,omitempty"`
+	Columns   []string                 `json:"columns,omitempty"`
+	Mutations []interface{}            `json:"mutations,omitempty"`
+	UUIDName  string                   `json:"uuid-name,omitempty"`
+	Until     string                   `json:"until,omitempty"`
+	Timeout   *int                     `json:"timeout,omitempty"`
+}
+
+// opResult is the result of an operation, or its error
+type opResult struct {
+	UUID    []string                     `json:"uuid,omitempty"`
+	Rows    []map[string]json.RawMessage `json:"rows,omitempty"`
+	Count   int                          `json:"count,omitempty"`
+	Error   string                       `json:"error,omitempty"`
+	Details string                       `json:"details,omitempty"`
+}
+
+type rpcRequest struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     interface{}   `json:"id"`
+}
+
+type rpcMessage struct {
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  interface{}     `json:"error,omitempty"`
+	ID     interface{}     `json:"id"`
+}
+
+type ovsdbClient struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+	id   int
+}
+
+func dialOVSDB(socketFile string) (*ovsdbClient, error) {
+	conn, err := net.DialTimeout("unix", socketFile, ovsdbTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ovsdb at %s: %v", socketFile, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(ovsdbTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &ovsdbClient{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}, nil
+}
+
+func (c *ovsdbClient) Close() error {
+	return c.conn.Close()
+}
+
+// transact runs the operations as a single transaction. It fails if any of
+// them does, in which case none is committed.
+func (c *ovsdbClient) transact(ops ...operation) ([]opResult, error) {
+	c.id++
+	params := []interface{}{ovsDatabase}
+	for _, op := range ops {
+		params = append(params, op)
+	}
+	if err := c.enc.Encode(rpcRequest{Method: "transact", Params: params, ID: c.id}); err != nil {
+		return nil, fmt.Errorf("failed to send ovsdb transaction: %v", err)
+	}
+
+	for {
+		msg := rpcMessage{}
+		if err := c.dec.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("failed to read ovsdb reply: %v", err)
+		}
+		// The server probes the connection with echo requests
+		if msg.Method == "echo" {
+			reply := rpcMessage{Result: msg.Params, ID: msg.ID}
+			if err := c.enc.Encode(reply); err != nil {
+				return nil, fmt.Errorf("failed to reply to ovsdb echo: %v", err)
+			}
+			continue
+		}
+		if id, ok := msg.ID.(float64); !ok || int(id) != c.id {
+			continue
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("ovsdb transaction failed: %v", msg.Error)
+		}
+
+		results := []opResult{}
+		if err := json.Unmarshal(msg.Result, &results); err != nil {
+			return nil, fmt.Errorf("failed to parse ovsdb reply: %v", err)
+		}
+		// An error past the operations is that of the commit
+		for i, r := range results {
+			if r.Error != "" {
+				return results, &opError{index: i, err: r.Error, details: r.Details}
+			}
+		}
+		if len(results) < len(ops) {
+			return nil, fmt.Errorf("ovsdb returned %d results for %d operations", len(results), len(ops))
+		}
+		return results, nil
+	}
+}
+
+// opError is the error of an operation of a transaction
+type opError struct {
+	index   int
+	err     string
+	details string
+}
+
+func (e *opError) Error() string {
+	if e.details == "" {
+		return fmt.Sprintf("ovsdb: %s", e.err)
+	}
+	return fmt.Sprintf("ovsdb: %s: %s", e.err, e.details)
+}
+
+// condition returns the condition of a "where" clause
+func condition(column, function string, value interface{}) []interface{} {
+	return []interface{}{column, function, value}
+}
+
+// ovsSet returns the OVSDB notation of a set
+func ovsSet(elements ...interface{}) []interface{} {
+	if elements == nil {
+		elements = []interface{}{}
+	}
+	return []interface{}{"set", elements}
+}
+
+// ovsMap returns the OVSDB notation of a map of strings
+func ovsMap(m map[string]string) []interface{} {
+	pairs := []interface{}{}
+	for k, v := range m {
+		pairs = append(pairs, []interface{}{k, v})
+	}
+	return []interface{}{"map", pairs}
+}
+
+// ovsUUID returns the OVSDB notation of a row UUID
+func ovsUUID(uuid string) []interface{} {
+	return []interface{}{"uuid", uuid}
+}
+
+// namedUUID returns the OVSDB notation of a row inserted in the same
+// transaction
+func namedUUID(name string) []interface{} {
+	return []interface{}{"named-uuid", name}
+}
+
+// setElements returns the elements of a set value. A set of one element
+// may be sent as the bare element.
+func setElements(value json.RawMessage) ([]json.RawMessage, error) {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(value, &pair); err == nil && len(pair) == 2 {
+		var kind string
+		if err := json.Unmarshal(pair[0], &kind); err == nil && kind == "set" {
+			elements := []json.RawMessage{}
+			if err := json.Unmarshal(pair[1], &elements); err != nil {
+				return nil, fmt.Errorf("invalid set %s: %v", value, err)
+			}
+			return elements, nil
+		}
+	}
+	return []json.RawMessage{value}, nil
+}
+
+// parseUUID parses a UUID value
+func parseUUID(value json.RawMessage) (string, error) {
+	var pair []string
+	if err := json.Unmarshal(value, &pair); err != nil || len(pair) != 2 || pair[0] != "uuid" {
+		return "", fmt.Errorf("invalid uuid %s", value)
+	}
+	return pair[1], nil
+}
+
+// parseString parses a string value
+func parseString(value json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", fmt.Errorf("invalid string %s", value)
+	}
+	return s, nil
+}
+
+// parseInts parses a set of integers
+func parseInts(value json.RawMessage) ([]int, error) {
+	elements, err := setElements(value)
+	if err != nil {
+		return nil, err
+	}
+	ints := []int{}
+	for _, e := range elements {
+		var i int
+		if err := json.Unmarshal(e, &i); err != nil {
+			return nil, fmt.Errorf("invalid integer %s", e)
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// parseStringMap parses a map of strings
+func parseStringMap(value json.RawMessage) (map[string]string, error) {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(value, &pair); err != nil || len(pair) != 2 {
+		return nil, fmt.Errorf("invalid map %s", value)
+	}
+	var pairs [][]string
+	if err := json.Unmarshal(pair[1], &pairs); err != nil {
+		return nil, fmt.Errorf("invalid map %s: %v", value, err)
+	}
+	m := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		if len(p) != 2 {
+			return nil, fmt.Errorf("invalid map %s", value)
+		}
+		m[p[0]] = p[1]
+	}
+	return m, nil
+}
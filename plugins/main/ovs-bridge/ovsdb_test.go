@@ -0,0 +1,346 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeOVSDB serves the subset of the Open_vSwitch database used by the
+// plugin: bridges holding ports, each with an interface. Rows are kept in
+// the OVSDB notation.
+type fakeOVSDB struct {
+	sync.Mutex
+	socketFile string
+	listener   net.Listener
+	nextUUID   int
+
+	bridges map[string]map[string]interface{}
+	ports   map[string]map[string]interface{}
+	ifaces  map[string]map[string]interface{}
+}
+
+func newFakeOVSDB(dir string, bridges ...string) *fakeOVSDB {
+	f := &fakeOVSDB{
+		socketFile: filepath.Join(dir, "db.sock"),
+		bridges:    map[string]map[string]interface{}{},
+		ports:      map[string]map[string]interface{}{},
+		ifaces:     map[string]map[string]interface{}{},
+	}
+	for _, br := range bridges {
+		f.bridges[br] = map[string]interface{}{"name": br, "ports": ovsSet()}
+	}
+
+	var err error
+	f.listener, err = net.Listen("unix", f.socketFile)
+	Expect(err).NotTo(HaveOccurred())
+	go f.serve()
+	return f
+}
+
+func (f *fakeOVSDB) Close() {
+	f.listener.Close()
+}
+
+func (f *fakeOVSDB) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.serveConn(conn)
+	}
+}
+
+func (f *fakeOVSDB) serveConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		msg := map[string]interface{}{}
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		if msg["method"] != "transact" {
+			continue
+		}
+		// Probe the client first, as ovsdb-server does on idle connections
+		if err := enc.Encode(map[string]interface{}{"method": "echo", "params": []interface{}{}, "id": "echo"}); err != nil {
+			return
+		}
+		params := msg["params"].([]interface{})
+		results := f.transact(params[1:])
+		if err := enc.Encode(map[string]interface{}{"result": results, "error": nil, "id": msg["id"]}); err != nil {
+			return
+		}
+	}
+}
+
+// portBridges returns the names of the bridges holding the port
+func (f *fakeOVSDB) portBridges(name string) []string {
+	f.Lock()
+	defer f.Unlock()
+	bridges := []string{}
+	for uuid, p := range f.ports {
+		if p["name"] != name {
+			continue
+		}
+		for br, row := range f.bridges {
+			for _, u := range elements(row["ports"]) {
+				if u.([]interface{})[1] == uuid {
+					bridges = append(bridges, br)
+				}
+			}
+		}
+	}
+	return bridges
+}
+
+// port returns the row of the port, or nil
+func (f *fakeOVSDB) port(name string) map[string]interface{} {
+	f.Lock()
+	defer f.Unlock()
+	for _, p := range f.ports {
+		if p["name"] == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// setPort sets a column of the port
+func (f *fakeOVSDB) setPort(name, column string, value interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	for _, p := range f.ports {
+		if p["name"] == name {
+			p[column] = value
+		}
+	}
+}
+
+// interfaceOf returns the row of the interface of the port
+func (f *fakeOVSDB) interfaceOf(name string) map[string]interface{} {
+	p := f.port(name)
+	if p == nil {
+		return nil
+	}
+	f.Lock()
+	defer f.Unlock()
+	return f.ifaces[p["interfaces"].([]interface{})[1].(string)]
+}
+
+// elements returns the elements of a set in OVSDB notation
+func elements(value interface{}) []interface{} {
+	if pair, ok := value.([]interface{}); ok && len(pair) == 2 && pair[0] == "set" {
+		return pair[1].([]interface{})
+	}
+	return []interface{}{value}
+}
+
+func (f *fakeOVSDB) table(name string) map[string]map[string]interface{} {
+	switch name {
+	case "Bridge":
+		return f.bridges
+	case "Port":
+		return f.ports
+	case "Interface":
+		return f.ifaces
+	}
+	return nil
+}
+
+// matches evaluates the conditions on a row. Only the conditions used by
+// the plugin are supported.
+func matches(row map[string]interface{}, where []interface{}) bool {
+	for _, c := range where {
+		cond := c.([]interface{})
+		column, function, value := cond[0].(string), cond[1].(string), cond[2]
+		switch {
+		case function == "==":
+			if row[column] != value {
+				return false
+			}
+		case function == "includes" && column == "external_ids":
+			ids := map[string]interface{}{}
+			for _, p := range row[column].([]interface{})[1].([]interface{}) {
+				pair := p.([]interface{})
+				ids[pair[0].(string)] = pair[1]
+			}
+			for _, p := range value.([]interface{})[1].([]interface{}) {
+				pair := p.([]interface{})
+				if ids[pair[0].(string)] != pair[1] {
+					return false
+				}
+			}
+		case function == "includes":
+			have := map[interface{}]bool{}
+			for _, e := range elements(row[column]) {
+				have[e.([]interface{})[1]] = true
+			}
+			for _, e := range elements(value) {
+				if !have[e.([]interface{})[1]] {
+					return false
+				}
+			}
+		default:
+			panic(fmt.Sprintf("unsupported condition %v", cond))
+		}
+	}
+	return true
+}
+
+func (f *fakeOVSDB) transact(ops []interface{}) []interface{} {
+	f.Lock()
+	defer f.Unlock()
+
+	named := map[string]string{}
+	resolve := func(v interface{}) interface{} {
+		if pair, ok := v.([]interface{}); ok && len(pair) == 2 && pair[0] == "named-uuid" {
+			return []interface{}{"uuid", named[pair[1].(string)]}
+		}
+		return v
+	}
+
+	results := []interface{}{}
+	for _, o := range ops {
+		op := o.(map[string]interface{})
+		table := f.table(op["table"].(string))
+		where, _ := op["where"].([]interface{})
+
+		switch op["op"] {
+		case "wait":
+			found := false
+			for _, row := range table {
+				found = found || matches(row, where)
+			}
+			if !found {
+				return append(results, map[string]interface{}{"error": "timed out"})
+			}
+			results = append(results, map[string]interface{}{})
+
+		case "insert":
+			f.nextUUID++
+			uuid := fmt.Sprintf("00000000-0000-0000-0000-%012d", f.nextUUID)
+			row := map[string]interface{}{
+				"_uuid":        []interface{}{"uuid", uuid},
+				"tag":          ovsSet(),
+				"trunks":       ovsSet(),
+				"external_ids": ovsMap(nil),
+			}
+			for k, v := range op["row"].(map[string]interface{}) {
+				row[k] = resolve(v)
+			}
+			table[uuid] = row
+			if name, ok := op["uuid-name"].(string); ok {
+				named[name] = uuid
+			}
+			results = append(results, map[string]interface{}{"uuid": []interface{}{"uuid", uuid}})
+
+		case "mutate":
+			count := 0
+			for _, row := range table {
+				if !matches(row, where) {
+					continue
+				}
+				count++
+				for _, m := range op["mutations"].([]interface{}) {
+					mutation := m.([]interface{})
+					column, mutator := mutation[0].(string), mutation[1].(string)
+					kept := []interface{}{}
+					drop := map[interface{}]bool{}
+					for _, e := range elements(mutation[2]) {
+						drop[resolve(e).([]interface{})[1]] = true
+					}
+					for _, e := range elements(row[column]) {
+						if !drop[e.([]interface{})[1]] {
+							kept = append(kept, e)
+						}
+					}
+					if mutator == "insert" {
+						for _, e := range elements(mutation[2]) {
+							kept = append(kept, resolve(e))
+						}
+					}
+					row[column] = ovsSet(kept...)
+				}
+			}
+			results = append(results, map[string]interface{}{"count": count})
+
+		case "select":
+			rows := []interface{}{}
+			for _, row := range table {
+				if matches(row, where) {
+					rows = append(rows, row)
+				}
+			}
+			results = append(results, map[string]interface{}{"rows": rows})
+
+		default:
+			panic(fmt.Sprintf("unsupported operation %v", op["op"]))
+		}
+	}
+
+	// Ports and interfaces no bridge refers to are garbage collected
+	referenced := map[interface{}]bool{}
+	for _, br := range f.bridges {
+		for _, e := range elements(br["ports"]) {
+			referenced[e.([]interface{})[1]] = true
+		}
+	}
+	for uuid, p := range f.ports {
+		if !referenced[uuid] {
+			delete(f.ifaces, p["interfaces"].([]interface{})[1].(string))
+			delete(f.ports, uuid)
+		}
+	}
+	return results
+}
+
+var _ = Describe("ovsdb notation", func() {
+	It("parses sets of one element or more", func() {
+		ints, err := parseInts(json.RawMessage(`100`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ints).To(Equal([]int{100}))
+
+		ints, err = parseInts(json.RawMessage(`["set", []]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ints).To(BeEmpty())
+
+		ints, err = parseInts(json.RawMessage(`["set", [10, 20]]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ints).To(Equal([]int{10, 20}))
+	})
+
+	It("parses maps and UUIDs", func() {
+		m, err := parseStringMap(json.RawMessage(`["map", [["a", "1"], ["b", "2"]]]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m).To(Equal(map[string]string{"a": "1", "b": "2"}))
+
+		uuid, err := parseUUID(json.RawMessage(`["uuid", "36a3c4ac-44b6-4ad6-a2e8-1b1f6b6b6f3e"]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uuid).To(Equal("36a3c4ac-44b6-4ad6-a2e8-1b1f6b6b6f3e"))
+
+		_, err = parseUUID(json.RawMessage(`"36a3c4ac"`))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,214 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// The external IDs recording the attachment of a port, by which DEL, CHECK
+// and GC find it
+const (
+	externalIDNetwork     = "cni_network"
+	externalIDContainerID = "cni_container_id"
+	externalIDIfName      = "cni_ifname"
+	externalIDNetns       = "cni_netns"
+
+	// externalIDAttachedMac is the OVS convention for the MAC of the
+	// endpoint behind an interface
+	externalIDAttachedMac = "attached-mac"
+)
+
+// port is a row of the Port table
+type port struct {
+	uuid        string
+	name        string
+	tag         int
+	trunks      []int
+	externalIDs map[string]string
+}
+
+// attachmentIDs returns the external IDs identifying an attachment
+func attachmentIDs(network, containerID, ifName string) map[string]string {
+	return map[string]string{
+		externalIDNetwork:     network,
+		externalIDContainerID: containerID,
+		externalIDIfName:      ifName,
+	}
+}
+
+// addPort adds a port for the host interface to the bridge, with an access
+// tag and trunks if set. The transaction is aborted if the bridge doesn't
+// exist.
+func addPort(c *ovsdbClient, bridge, name string, tag int, trunks []int, mac string, externalIDs map[string]string) error {
+	timeout := 0
+	portRow := map[string]interface{}{
+		"name":         name,
+		"interfaces":   namedUUID("iface"),
+		"external_ids": ovsMap(externalIDs),
+	}
+	if tag != 0 {
+		portRow["tag"] = tag
+	}
+	if len(trunks) != 0 {
+		elements := []interface{}{}
+		for _, t := range trunks {
+			elements = append(elements, t)
+		}
+		portRow["trunks"] = ovsSet(elements...)
+	}
+	ifaceRow := map[string]interface{}{
+		"name": name,
+	}
+	if mac != "" {
+		ifaceRow["external_ids"] = ovsMap(map[string]string{externalIDAttachedMac: mac})
+	}
+
+	_, err := c.transact(
+		operation{
+			Op:      "wait",
+			Table:   "Bridge",
+			Where:   []interface{}{condition("name", "==", bridge)},
+			Columns: []string{"name"},
+			Until:   "==",
+			Rows:    []map[string]interface{}{{"name": bridge}},
+			Timeout: &timeout,
+		},
+		operation{
+			Op:       "insert",
+			Table:    "Interface",
+			Row:      ifaceRow,
+			UUIDName: "iface",
+		},
+		operation{
+			Op:       "insert",
+			Table:    "Port",
+			Row:      portRow,
+			UUIDName: "port",
+		},
+		operation{
+			Op:    "mutate",
+			Table: "Bridge",
+			Where: []interface{}{condition("name", "==", bridge)},
+			Mutations: []interface{}{
+				[]interface{}{"ports", "insert", ovsSet(namedUUID("port"))},
+			},
+		},
+	)
+	var opErr *opError
+	if errors.As(err, &opErr) && opErr.index == 0 {
+		return fmt.Errorf("bridge %q not found", bridge)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add port %q to bridge %q: %v", name, bridge, err)
+	}
+	return nil
+}
+
+// findPorts returns the ports whose external IDs include externalIDs
+func findPorts(c *ovsdbClient, externalIDs map[string]string) ([]port, error) {
+	results, err := c.transact(operation{
+		Op:      "select",
+		Table:   "Port",
+		Where:   []interface{}{condition("external_ids", "includes", ovsMap(externalIDs))},
+		Columns: []string{"_uuid", "name", "tag", "trunks", "external_ids"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ports: %v", err)
+	}
+
+	ports := []port{}
+	for _, row := range results[0].Rows {
+		p := port{}
+		if p.uuid, err = parseUUID(row["_uuid"]); err != nil {
+			return nil, err
+		}
+		if p.name, err = parseString(row["name"]); err != nil {
+			return nil, err
+		}
+		tags, err := parseInts(row["tag"])
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) != 0 {
+			p.tag = tags[0]
+		}
+		if p.trunks, err = parseInts(row["trunks"]); err != nil {
+			return nil, err
+		}
+		sort.Ints(p.trunks)
+		if p.externalIDs, err = parseStringMap(row["external_ids"]); err != nil {
+			return nil, err
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// removePorts removes the ports from the bridges holding them. OVS deletes
+// the ports and their interfaces once no bridge refers to them.
+func removePorts(c *ovsdbClient, ports []port) error {
+	if len(ports) == 0 {
+		return nil
+	}
+	ops := []operation{}
+	for _, p := range ports {
+		ops = append(ops, operation{
+			Op:    "mutate",
+			Table: "Bridge",
+			Where: []interface{}{condition("ports", "includes", ovsSet(ovsUUID(p.uuid)))},
+			Mutations: []interface{}{
+				[]interface{}{"ports", "delete", ovsSet(ovsUUID(p.uuid))},
+			},
+		})
+	}
+	if _, err := c.transact(ops...); err != nil {
+		return fmt.Errorf("failed to remove ports: %v", err)
+	}
+	return nil
+}
+
+// bridgeHasPort reports whether the port belongs to the bridge
+func bridgeHasPort(c *ovsdbClient, bridge string, p port) (bool, error) {
+	results, err := c.transact(operation{
+		Op:    "select",
+		Table: "Bridge",
+		Where: []interface{}{
+			condition("name", "==", bridge),
+			condition("ports", "includes", ovsSet(ovsUUID(p.uuid))),
+		},
+		Columns: []string{"name"},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up bridge %q: %v", bridge, err)
+	}
+	return len(results[0].Rows) != 0, nil
+}
+
+// bridgeExists reports whether the bridge exists
+func bridgeExists(c *ovsdbClient, bridge string) (bool, error) {
+	results, err := c.transact(operation{
+		Op:      "select",
+		Table:   "Bridge",
+		Where:   []interface{}{condition("name", "==", bridge)},
+		Columns: []string{"name"},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up bridge %q: %v", bridge, err)
+	}
+	return len(results[0].Rows) != 0, nil
+}
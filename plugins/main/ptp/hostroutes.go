@@ -0,0 +1,116 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/vishvananda/netlink"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+)
+
+// HostRoutes customizes the routes to the container programmed on the
+// host, which by default are a /32 or /128 route per container address in
+// the main table.
+type HostRoutes struct {
+	// Disable skips the routes to the container addresses, e.g. when they
+	// are programmed by a routing daemon
+	Disable bool `json:"disable,omitempty"`
+	// Metric and Table apply to all the host routes
+	Metric int  `json:"metric,omitempty"`
+	Table  *int `json:"table,omitempty"`
+	// Prefixes are extra CIDRs, such as secondary pod prefixes, routed via
+	// the container address of their IP family
+	Prefixes []string `json:"prefixes,omitempty"`
+
+	prefixes []*net.IPNet
+}
+
+func (h *HostRoutes) parse() error {
+	if h.Metric < 0 {
+		return fmt.Errorf("invalid hostRoutes metric %d", h.Metric)
+	}
+	for _, p := range h.Prefixes {
+		_, ipn, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("invalid hostRoutes prefix %q: %v", p, err)
+		}
+		h.prefixes = append(h.prefixes, ipn)
+	}
+	return nil
+}
+
+func (h *HostRoutes) route(veth netlink.Link, dst *net.IPNet, gw net.IP) *netlink.Route {
+	r := &netlink.Route{
+		LinkIndex: veth.Attrs().Index,
+		Dst:       dst,
+		Priority:  h.Metric,
+	}
+	if gw == nil {
+		r.Scope = netlink.SCOPE_HOST
+	} else {
+		// The container address is on-link even without the route to it
+		r.Gw = gw
+		r.Flags = int(netlink.FLAG_ONLINK)
+	}
+	if h.Table != nil {
+		r.Table = *h.Table
+	}
+	return r
+}
+
+// addHostRoutes programs the routes to the container addresses and the
+// extra prefixes through the host veth
+func addHostRoutes(h *HostRoutes, veth netlink.Link, result *current.Result) error {
+	if h == nil {
+		h = &HostRoutes{}
+	}
+
+	if !h.Disable {
+		for _, ipc := range result.IPs {
+			maskLen := 128
+			if ipc.Address.IP.To4() != nil {
+				maskLen = 32
+			}
+			ipn := &net.IPNet{
+				IP:   ipc.Address.IP,
+				Mask: net.CIDRMask(maskLen, maskLen),
+			}
+			if err := netlink.RouteAdd(h.route(veth, ipn, nil)); err != nil && !os.IsExist(err) {
+				return fmt.Errorf("failed to add route on host: %v", err)
+			}
+		}
+	}
+
+	for _, prefix := range h.prefixes {
+		var gw net.IP
+		for _, ipc := range result.IPs {
+			if (ipc.Address.IP.To4() == nil) == (prefix.IP.To4() == nil) {
+				gw = ipc.Address.IP
+				break
+			}
+		}
+		if gw == nil {
+			return fmt.Errorf("no container address to route %s via", prefix)
+		}
+		if err := netlink.RouteAdd(h.route(veth, prefix, gw)); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to add route %s on host: %v", prefix, err)
+		}
+	}
+	return nil
+}
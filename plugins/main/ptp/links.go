@@ -0,0 +1,279 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	cniutils "github.com/containernetworking/cni/pkg/utils"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+// Link is an additional veth pair created along with the one of the
+// invocation, e.g. to separate the control and data traffic of a pod
+type Link struct {
+	// IfName is the name of the container end of the pair
+	IfName string `json:"ifName"`
+	// MTU defaults to the mtu of the network
+	MTU int `json:"mtu,omitempty"`
+	// IPAM is the IPAM configuration of the link, in the same format as
+	// the ipam of the network
+	IPAM map[string]interface{} `json:"ipam"`
+}
+
+func (l *Link) ipamType() string {
+	t, _ := l.IPAM["type"].(string)
+	return t
+}
+
+func validateLinks(links []Link, ifName string) error {
+	names := map[string]bool{ifName: true}
+	for _, l := range links {
+		if err := cniutils.ValidateInterfaceName(l.IfName); err != nil {
+			return fmt.Errorf("invalid link ifName %q: %v", l.IfName, err)
+		}
+		if names[l.IfName] {
+			return fmt.Errorf("duplicate link ifName %q", l.IfName)
+		}
+		names[l.IfName] = true
+		if l.ipamType() == "" {
+			return fmt.Errorf("link %q has no IPAM type", l.IfName)
+		}
+	}
+	return nil
+}
+
+// linkNetConf returns the network configuration passed to the IPAM plugin
+// of the link, which is the one of the invocation with the IPAM of the link
+func linkNetConf(stdinData []byte, l *Link) ([]byte, error) {
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return nil, err
+	}
+	conf["ipam"] = l.IPAM
+	delete(conf, "links")
+	return json.Marshal(conf)
+}
+
+// execLinkIPAM runs the IPAM plugin of the link, with the link name as
+// CNI_IFNAME so that its allocations are kept apart from the ones of the
+// other interfaces
+func execLinkIPAM(command string, args *skel.CmdArgs, l *Link) (types.Result, error) {
+	netconf, err := linkNetConf(args.StdinData, l)
+	if err != nil {
+		return nil, err
+	}
+	cniPath := os.Getenv("CNI_PATH")
+	pluginPath, err := invoke.FindInPath(l.ipamType(), filepath.SplitList(cniPath))
+	if err != nil {
+		return nil, err
+	}
+	ipamArgs := &invoke.Args{
+		Command:       command,
+		ContainerID:   args.ContainerID,
+		NetNS:         args.Netns,
+		PluginArgsStr: args.Args,
+		IfName:        l.IfName,
+		Path:          cniPath,
+	}
+	if command == "ADD" {
+		return invoke.ExecPluginWithResult(context.TODO(), pluginPath, netconf, ipamArgs, nil)
+	}
+	return nil, invoke.ExecPluginWithoutResult(context.TODO(), pluginPath, netconf, ipamArgs, nil)
+}
+
+// addLinks creates the additional veth pairs and appends their interfaces,
+// addresses and routes to result
+func addLinks(conf *NetConf, args *skel.CmdArgs, netns ns.NetNS, v4gw, v6gw net.IP, result *current.Result) error {
+	var hostRoutes *HostRoutes
+	if conf.HostRoutes != nil {
+		// The extra prefixes are routed through the main link only
+		hostRoutes = &HostRoutes{
+			Disable: conf.HostRoutes.Disable,
+			Metric:  conf.HostRoutes.Metric,
+			Table:   conf.HostRoutes.Table,
+		}
+	}
+
+	for i := range conf.Links {
+		linkResult, err := addLink(conf, args, &conf.Links[i], netns, v4gw, v6gw, hostRoutes)
+		if err != nil {
+			// Release the addresses of the links added so far
+			for j := 0; j < i; j++ {
+				_, _ = execLinkIPAM("DEL", args, &conf.Links[j])
+			}
+			return err
+		}
+
+		offset := len(result.Interfaces)
+		for _, ipc := range linkResult.IPs {
+			ipc.Interface = current.Int(*ipc.Interface + offset)
+		}
+		result.Interfaces = append(result.Interfaces, linkResult.Interfaces...)
+		result.IPs = append(result.IPs, linkResult.IPs...)
+		result.Routes = append(result.Routes, linkResult.Routes...)
+	}
+	return nil
+}
+
+func addLink(conf *NetConf, args *skel.CmdArgs, l *Link, netns ns.NetNS, v4gw, v6gw net.IP, hostRoutes *HostRoutes) (*current.Result, error) {
+	r, err := execLinkIPAM("ADD", args, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate addresses of link %q: %v", l.IfName, err)
+	}
+	defer func() {
+		if err != nil {
+			_, _ = execLinkIPAM("DEL", args, l)
+		}
+	}()
+
+	var result *current.Result
+	if result, err = current.NewResultFromResult(r); err != nil {
+		return nil, err
+	}
+	if len(result.IPs) == 0 {
+		err = fmt.Errorf("IPAM plugin returned missing IP config for link %q", l.IfName)
+		return nil, err
+	}
+	if conf.Unnumbered != nil {
+		if err = borrowGateways(result, v4gw, v6gw); err != nil {
+			return nil, err
+		}
+	}
+	if err = ip.EnableForward(result.IPs); err != nil {
+		return nil, fmt.Errorf("Could not enable IP forwarding: %v", err)
+	}
+
+	var hostName string
+	if hostName, err = hostVethName(conf, args.ContainerID, l.IfName); err != nil {
+		return nil, err
+	}
+	mtu := l.MTU
+	if mtu == 0 {
+		mtu = conf.MTU
+	}
+	var hostInterface *current.Interface
+	if hostInterface, _, err = setupContainerVeth(netns, l.IfName, hostName, mtu, conf.Unnumbered != nil, result); err != nil {
+		return nil, err
+	}
+	if err = setupHostVeth(hostInterface.Name, hostRoutes, result); err != nil {
+		return nil, err
+	}
+	if err = addProxyEntries(conf.ProxyNeigh, resultAddrs(result.IPs)); err != nil {
+		return nil, err
+	}
+
+	if conf.IPMasq {
+		ipns := []*net.IPNet{}
+		for _, ipc := range result.IPs {
+			ipns = append(ipns, &ipc.Address)
+		}
+		if err = ip.SetupIPMasqForNetworks(conf.IPMasqBackend, ipns, conf.Name, l.IfName, args.ContainerID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// delLinks removes the additional veth pairs and releases their addresses,
+// carrying on after errors
+func delLinks(conf *NetConf, args *skel.CmdArgs) error {
+	var errs []error
+	for i := range conf.Links {
+		l := &conf.Links[i]
+		if _, err := execLinkIPAM("DEL", args, l); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release addresses of link %q: %v", l.IfName, err))
+		}
+		if args.Netns == "" {
+			continue
+		}
+
+		var ipnets []*net.IPNet
+		err := ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+			var err error
+			ipnets, err = ip.DelLinkByNameAddr(l.IfName)
+			if err != nil && err == ip.ErrLinkNotFound {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			if _, ok := err.(ns.NSPathNotExistErr); !ok {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := delProxyEntries(conf.ProxyNeigh, ipNetAddrs(ipnets)); err != nil {
+			errs = append(errs, err)
+		}
+		if len(ipnets) != 0 && conf.IPMasq {
+			if err := ip.TeardownIPMasqForNetworks(ipnets, conf.Name, l.IfName, args.ContainerID); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// interfaceIPs returns the addresses of the result assigned to the
+// interface ifName of the sandbox
+func interfaceIPs(result *current.Result, ifName, sandbox string) []*current.IPConfig {
+	var ips []*current.IPConfig
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil || *ipc.Interface < 0 || *ipc.Interface >= len(result.Interfaces) {
+			continue
+		}
+		intf := result.Interfaces[*ipc.Interface]
+		if intf.Name == ifName && intf.Sandbox == sandbox {
+			ips = append(ips, ipc)
+		}
+	}
+	return ips
+}
+
+// checkLinks validates the container end of the additional veth pairs
+// against the result. It must be called in the container namespace.
+func checkLinks(conf *NetConf, args *skel.CmdArgs, result *current.Result) error {
+	for _, l := range conf.Links {
+		var contMap current.Interface
+		for _, intf := range result.Interfaces {
+			if intf.Name == l.IfName && intf.Sandbox == args.Netns {
+				contMap = *intf
+				break
+			}
+		}
+		if contMap.Name == "" {
+			return fmt.Errorf("ptp: link %q missing in prevResult", l.IfName)
+		}
+		if err := validateCniContainerInterface(contMap); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(l.IfName, interfaceIPs(result, l.IfName, args.Netns)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
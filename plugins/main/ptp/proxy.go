@@ -0,0 +1,214 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/utils/sysctl"
+)
+
+// ProxyNeigh answers ARP and NDP solicitations for the container addresses
+// on host interfaces, so that the routers on the L2 of the host reach the
+// container through the host without a route to it
+type ProxyNeigh struct {
+	// ARP and NDP add proxy entries for the IPv4 and the IPv6 addresses
+	ARP bool `json:"arp,omitempty"`
+	NDP bool `json:"ndp,omitempty"`
+	// Interfaces are the host interfaces facing the routers, the interfaces
+	// of the default route of the family when empty
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+func (p *ProxyNeigh) enabled(addr net.IP) bool {
+	if addr.To4() != nil {
+		return p.ARP
+	}
+	return p.NDP
+}
+
+// links returns the host interfaces the proxy entries of the family go to
+func (p *ProxyNeigh) links(family int) ([]netlink.Link, error) {
+	var links []netlink.Link
+	if len(p.Interfaces) > 0 {
+		for _, name := range p.Interfaces {
+			link, err := netlinksafe.LinkByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to lookup proxy interface %q: %v", name, err)
+			}
+			links = append(links, link)
+		}
+		return links, nil
+	}
+
+	routes, err := netlinksafe.RouteListFiltered(family, &netlink.Route{}, netlink.RT_FILTER_DST)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list default routes: %v", err)
+	}
+	seen := map[int]bool{}
+	for _, r := range routes {
+		indexes := []int{r.LinkIndex}
+		for _, nh := range r.MultiPath {
+			indexes = append(indexes, nh.LinkIndex)
+		}
+		for _, index := range indexes {
+			if index == 0 || seen[index] {
+				continue
+			}
+			seen[index] = true
+			link, err := netlink.LinkByIndex(index)
+			if err != nil {
+				return nil, fmt.Errorf("failed to lookup default route interface %d: %v", index, err)
+			}
+			links = append(links, link)
+		}
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("no default route interface found for proxy entries")
+	}
+	return links, nil
+}
+
+func proxyEntry(link netlink.Link, addr net.IP) *netlink.Neigh {
+	return &netlink.Neigh{
+		LinkIndex: link.Attrs().Index,
+		Family:    familyOf(addr),
+		Flags:     netlink.NTF_PROXY,
+		IP:        addr,
+	}
+}
+
+func familyOf(addr net.IP) int {
+	if addr.To4() != nil {
+		return netlink.FAMILY_V4
+	}
+	return netlink.FAMILY_V6
+}
+
+// addProxyEntries publishes the container addresses on the host
+// interfaces. The kernel answers for them as the host routes them to the
+// container through another interface, with forwarding enabled.
+func addProxyEntries(p *ProxyNeigh, addrs []net.IP) error {
+	if p == nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !p.enabled(addr) {
+			continue
+		}
+		links, err := p.links(familyOf(addr))
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if addr.To4() == nil {
+				// IPv6 proxy entries are only looked up with proxy_ndp
+				name := link.Attrs().Name
+				if _, err := sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/proxy_ndp", name), "1"); err != nil {
+					return fmt.Errorf("failed to enable proxy_ndp on %s: %v", name, err)
+				}
+			}
+			if err := netlink.NeighSet(proxyEntry(link, addr)); err != nil {
+				return fmt.Errorf("failed to add proxy entry for %s on %s: %v", addr, link.Attrs().Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// delProxyEntries removes the proxy entries of the container addresses,
+// which may be gone already. proxy_ndp is left enabled, other containers
+// may rely on it.
+func delProxyEntries(p *ProxyNeigh, addrs []net.IP) error {
+	if p == nil {
+		return nil
+	}
+	var errs []error
+	for _, addr := range addrs {
+		if !p.enabled(addr) {
+			continue
+		}
+		links, err := p.links(familyOf(addr))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, link := range links {
+			err := netlink.NeighDel(proxyEntry(link, addr))
+			if err != nil && !errors.Is(err, syscall.ENOENT) {
+				errs = append(errs, fmt.Errorf("failed to delete proxy entry for %s on %s: %v", addr, link.Attrs().Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkProxyEntries checks the proxy entries of the container addresses
+func checkProxyEntries(p *ProxyNeigh, addrs []net.IP) error {
+	if p == nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !p.enabled(addr) {
+			continue
+		}
+		links, err := p.links(familyOf(addr))
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			entries, err := netlinksafe.NeighProxyList(link.Attrs().Index, familyOf(addr))
+			if err != nil {
+				return fmt.Errorf("failed to list proxy entries of %s: %v", link.Attrs().Name, err)
+			}
+			found := false
+			for _, e := range entries {
+				if e.IP.Equal(addr) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("proxy entry for %s not found on %s", addr, link.Attrs().Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ipNetAddrs returns the addresses of the IP networks
+func ipNetAddrs(ipns []*net.IPNet) []net.IP {
+	var addrs []net.IP
+	for _, ipn := range ipns {
+		addrs = append(addrs, ipn.IP)
+	}
+	return addrs
+}
+
+// resultAddrs returns the container addresses of the result
+func resultAddrs(ips []*current.IPConfig) []net.IP {
+	var addrs []net.IP
+	for _, ipc := range ips {
+		addrs = append(addrs, ipc.Address.IP)
+	}
+	return addrs
+}
@@ -19,19 +19,21 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"os"
 	"runtime"
+	"strings"
 
 	"github.com/vishvananda/netlink"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
+	cniutils "github.com/containernetworking/cni/pkg/utils"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ipam"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/utils"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 )
 
@@ -47,9 +49,45 @@ type NetConf struct {
 	IPMasq        bool    `json:"ipMasq"`
 	IPMasqBackend *string `json:"ipMasqBackend,omitempty"`
 	MTU           int     `json:"mtu"`
+
+	// HostVethName names the host end of the veth pair, instead of a
+	// random name. It may contain the placeholders {ifName}, replaced by
+	// the container interface name, and {hash}, replaced by 8 characters
+	// derived from the container ID and interface name.
+	HostVethName string `json:"hostVethName,omitempty"`
+
+	Unnumbered *Unnumbered `json:"unnumbered,omitempty"`
+	HostRoutes *HostRoutes `json:"hostRoutes,omitempty"`
+	ProxyNeigh *ProxyNeigh `json:"proxyNeigh,omitempty"`
+
+	// Links are additional veth pairs created in the same invocation, each
+	// with its own IPAM configuration
+	Links []Link `json:"links,omitempty"`
+}
+
+// Placeholders expanded in hostVethName
+const (
+	ifNamePlaceholder = "{ifName}"
+	hashPlaceholder   = "{hash}"
+)
+
+// hostVethName returns the name of the host end of the veth pair of the
+// attachment, or "" for a random name
+func hostVethName(conf *NetConf, containerID, ifName string) (string, error) {
+	if conf.HostVethName == "" {
+		return "", nil
+	}
+	name := strings.NewReplacer(
+		ifNamePlaceholder, ifName,
+		hashPlaceholder, utils.MustFormatHashWithPrefix(8, "", containerID+ifName),
+	).Replace(conf.HostVethName)
+	if err := cniutils.ValidateInterfaceName(name); err != nil {
+		return "", fmt.Errorf("invalid hostVethName %q: %v", name, err)
+	}
+	return name, nil
 }
 
-func setupContainerVeth(netns ns.NetNS, ifName string, mtu int, pr *current.Result) (*current.Interface, *current.Interface, error) {
+func setupContainerVeth(netns ns.NetNS, ifName, hostVethName string, mtu int, unnumbered bool, pr *current.Result) (*current.Interface, *current.Interface, error) {
 	// The IPAM result will be something like IP=192.168.3.5/24, GW=192.168.3.1.
 	// What we want is really a point-to-point link but veth does not support IFF_POINTTOPOINT.
 	// Next best thing would be to let it ARP but set interface to 192.168.3.5/32 and
@@ -65,7 +103,7 @@ func setupContainerVeth(netns ns.NetNS, ifName string, mtu int, pr *current.Resu
 	containerInterface := &current.Interface{}
 
 	err := netns.Do(func(hostNS ns.NetNS) error {
-		hostVeth, contVeth0, err := ip.SetupVeth(ifName, mtu, "", hostNS)
+		hostVeth, contVeth0, err := ip.SetupVethWithName(ifName, hostVethName, mtu, "", hostNS)
 		if err != nil {
 			return err
 		}
@@ -82,6 +120,10 @@ func setupContainerVeth(netns ns.NetNS, ifName string, mtu int, pr *current.Resu
 
 		pr.Interfaces = []*current.Interface{hostInterface, containerInterface}
 
+		if unnumbered {
+			return configureUnnumbered(ifName, pr)
+		}
+
 		contVeth, err := net.InterfaceByName(ifName)
 		if err != nil {
 			return fmt.Errorf("failed to look up %q: %v", ifName, err)
@@ -146,7 +188,7 @@ func setupContainerVeth(netns ns.NetNS, ifName string, mtu int, pr *current.Resu
 	return hostInterface, containerInterface, nil
 }
 
-func setupHostVeth(vethName string, result *current.Result) error {
+func setupHostVeth(vethName string, hostRoutes *HostRoutes, result *current.Result) error {
 	// hostVeth moved namespaces and may have a new ifindex
 	veth, err := netlinksafe.LinkByName(vethName)
 	if err != nil {
@@ -167,18 +209,9 @@ func setupHostVeth(vethName string, result *current.Result) error {
 		if err = netlink.AddrAdd(veth, addr); err != nil {
 			return fmt.Errorf("failed to add IP addr (%#v) to veth: %v", ipn, err)
 		}
-
-		ipn = &net.IPNet{
-			IP:   ipc.Address.IP,
-			Mask: net.CIDRMask(maskLen, maskLen),
-		}
-		// dst happens to be the same as IP/net of host veth
-		if err = ip.AddHostRoute(ipn, nil, veth); err != nil && !os.IsExist(err) {
-			return fmt.Errorf("failed to add route on host: %v", err)
-		}
 	}
 
-	return nil
+	return addHostRoutes(hostRoutes, veth, result)
 }
 
 func cmdAdd(args *skel.CmdArgs) error {
@@ -187,6 +220,26 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return fmt.Errorf("failed to load netconf: %v", err)
 	}
 
+	hostName, err := hostVethName(&conf, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if conf.HostRoutes != nil {
+		if err := conf.HostRoutes.parse(); err != nil {
+			return err
+		}
+	}
+	if err := validateLinks(conf.Links, args.IfName); err != nil {
+		return err
+	}
+
+	var v4gw, v6gw net.IP
+	if conf.Unnumbered != nil {
+		if v4gw, v6gw, err = conf.Unnumbered.gateways(); err != nil {
+			return err
+		}
+	}
+
 	// run the IPAM plugin and get back the config to apply
 	r, err := ipam.ExecAdd(conf.IPAM.Type, args.StdinData)
 	if err != nil {
@@ -210,6 +263,12 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return errors.New("IPAM plugin returned missing IP config")
 	}
 
+	if conf.Unnumbered != nil {
+		if err = borrowGateways(result, v4gw, v6gw); err != nil {
+			return err
+		}
+	}
+
 	if err := ip.EnableForward(result.IPs); err != nil {
 		return fmt.Errorf("Could not enable IP forwarding: %v", err)
 	}
@@ -220,12 +279,15 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	defer netns.Close()
 
-	hostInterface, _, err := setupContainerVeth(netns, args.IfName, conf.MTU, result)
+	hostInterface, _, err := setupContainerVeth(netns, args.IfName, hostName, conf.MTU, conf.Unnumbered != nil, result)
 	if err != nil {
 		return err
 	}
 
-	if err = setupHostVeth(hostInterface.Name, result); err != nil {
+	if err = setupHostVeth(hostInterface.Name, conf.HostRoutes, result); err != nil {
+		return err
+	}
+	if err = addProxyEntries(conf.ProxyNeigh, resultAddrs(result.IPs)); err != nil {
 		return err
 	}
 
@@ -239,6 +301,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 		}
 	}
 
+	if err = addLinks(&conf, args, netns, v4gw, v6gw, result); err != nil {
+		return err
+	}
+
 	// Only override the DNS settings in the previous result if any DNS fields
 	// were provided to the ptp plugin. This allows, for example, IPAM plugins
 	// to specify the DNS settings instead of the ptp plugin.
@@ -266,6 +332,25 @@ func cmdDel(args *skel.CmdArgs) error {
 		return err
 	}
 
+	if err := delLinks(&conf, args); err != nil {
+		return err
+	}
+
+	// The container addresses are only known from the previous result
+	// once the namespace is gone
+	if conf.ProxyNeigh != nil && conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return err
+		}
+		result, err := current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return err
+		}
+		if err := delProxyEntries(conf.ProxyNeigh, resultAddrs(result.IPs)); err != nil {
+			return err
+		}
+	}
+
 	if args.Netns == "" {
 		return nil
 	}
@@ -293,6 +378,10 @@ func cmdDel(args *skel.CmdArgs) error {
 		return err
 	}
 
+	if err := delProxyEntries(conf.ProxyNeigh, ipNetAddrs(ipnets)); err != nil {
+		return err
+	}
+
 	if len(ipnets) != 0 && conf.IPMasq {
 		if err := ip.TeardownIPMasqForNetworks(ipnets, conf.Name, args.IfName, args.ContainerID); err != nil {
 			return err
@@ -341,7 +430,7 @@ func cmdCheck(args *skel.CmdArgs) error {
 		return err
 	}
 
-	var contMap current.Interface
+	var contMap, hostMap current.Interface
 	// Find interfaces for name whe know, that of host-device inside container
 	for _, intf := range result.Interfaces {
 		if args.IfName == intf.Name {
@@ -350,6 +439,10 @@ func cmdCheck(args *skel.CmdArgs) error {
 				continue
 			}
 		}
+		// The host end of the main pair comes first
+		if intf.Sandbox == "" && hostMap.Name == "" {
+			hostMap = *intf
+		}
 	}
 
 	// The namespace must be the same as what was configured
@@ -358,6 +451,23 @@ func cmdCheck(args *skel.CmdArgs) error {
 			contMap.Sandbox, args.Netns)
 	}
 
+	if conf.HostVethName != "" {
+		hostName, err := hostVethName(&conf, args.ContainerID, args.IfName)
+		if err != nil {
+			return err
+		}
+		if hostMap.Name != hostName {
+			return fmt.Errorf("ptp: host interface %q in prevResult doesn't match configured name %q", hostMap.Name, hostName)
+		}
+		if _, err := netlinksafe.LinkByName(hostName); err != nil {
+			return fmt.Errorf("ptp: host interface %q not found: %v", hostName, err)
+		}
+	}
+
+	if err := checkProxyEntries(conf.ProxyNeigh, resultAddrs(result.IPs)); err != nil {
+		return err
+	}
+
 	//
 	// Check prevResults for ips, routes and dns against values found in the container
 	if err := netns.Do(func(_ ns.NetNS) error {
@@ -367,7 +477,16 @@ func cmdCheck(args *skel.CmdArgs) error {
 			return err
 		}
 
-		err = ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs)
+		ips := result.IPs
+		if len(conf.Links) != 0 {
+			ips = interfaceIPs(result, args.IfName, args.Netns)
+		}
+		err = ip.ValidateExpectedInterfaceIPs(args.IfName, ips)
+		if err != nil {
+			return err
+		}
+
+		err = checkLinks(&conf, args, result)
 		if err != nil {
 			return err
 		}
@@ -17,11 +17,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -31,6 +34,7 @@ import (
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/containernetworking/plugins/pkg/utils"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
 )
 
@@ -41,6 +45,7 @@ type Net struct {
 	IPMasq        bool                   `json:"ipMasq"`
 	IPMasqBackend *string                `json:"ipMasqBackend,omitempty"`
 	MTU           int                    `json:"mtu"`
+	HostVethName  string                 `json:"hostVethName,omitempty"`
 	IPAM          *allocator.IPAMConfig  `json:"ipam"`
 	DNS           types.DNS              `json:"dns"`
 	RawPrevResult map[string]interface{} `json:"prevResult,omitempty"`
@@ -602,4 +607,478 @@ var _ = Describe("ptp Operations", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 	}
+
+	It("names the host veth after hostVethName", func() {
+		const IFNAME = "ptp0"
+
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "hostVethName": "pt{hash}",
+		    "ipam": {
+			"type": "host-local",
+			"subnet": "10.1.2.0/24",
+			"dataDir": "%s"
+		    }
+		}`, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+		expected := "pt" + utils.MustFormatHashWithPrefix(8, "", "dummy"+IFNAME)
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces[0].Name).To(Equal(expected))
+
+			_, err = netlinksafe.LinkByName(expected)
+			Expect(err).NotTo(HaveOccurred())
+
+			// CHECK verifies the host interface name
+			n := &Net{}
+			Expect(json.Unmarshal([]byte(conf), n)).To(Succeed())
+			n.IPAM, _, err = allocator.LoadIPAMConfig([]byte(conf), "")
+			Expect(err).NotTo(HaveOccurred())
+			newConf, err := buildOneConfig(n.Name, "1.0.0", n, result)
+			Expect(err).NotTo(HaveOccurred())
+			newConf.HostVethName = "other{hash}"
+			confString, err := json.Marshal(newConf)
+			Expect(err).NotTo(HaveOccurred())
+			checkArgs := *args
+			checkArgs.StdinData = confString
+			err = testutils.CmdCheckWithArgs(&checkArgs, func() error { return cmdCheck(&checkArgs) })
+			Expect(err).To(MatchError(ContainSubstring("doesn't match configured name")))
+
+			err = testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = netlinksafe.LinkByName(expected)
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects a hostVethName that is too long", func() {
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "hostVethName": "host-{ifName}-{hash}",
+		    "ipam": {
+			"type": "host-local",
+			"subnet": "10.1.2.0/24",
+			"dataDir": "%s"
+		    }
+		}`, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "ptp0",
+			StdinData:   []byte(conf),
+		}
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid hostVethName")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("configures an unnumbered ptp link borrowing a loopback address", func() {
+		const IFNAME = "ptp0"
+
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "unnumbered": {},
+		    "ipam": {
+			"type": "host-local",
+			"subnet": "10.1.2.0/24",
+			"dataDir": "%s"
+		    }
+		}`, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			lo, err := netlinksafe.LinkByName("lo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(lo)).To(Succeed())
+			Expect(netlink.AddrAdd(lo, &netlink.Addr{IPNet: &net.IPNet{
+				IP:   net.ParseIP("10.255.255.1"),
+				Mask: net.CIDRMask(32, 32),
+			}})).To(Succeed())
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.IPs).To(HaveLen(1))
+		Expect(result.IPs[0].Address.Mask).To(Equal(net.CIDRMask(32, 32)))
+		Expect(result.IPs[0].Gateway.String()).To(Equal("10.255.255.1"))
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(1))
+			Expect(addrs[0].IPNet.String()).To(Equal(result.IPs[0].Address.String()))
+
+			return testutils.Ping(result.IPs[0].Address.IP.String(), "10.255.255.1", 30)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails when no unnumbered address matches the IPAM family", func() {
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "unnumbered": {
+			"addresses": ["fd00::1"]
+		    },
+		    "ipam": {
+			"type": "host-local",
+			"subnet": "10.1.2.0/24",
+			"dataDir": "%s"
+		    }
+		}`, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "ptp0",
+			StdinData:   []byte(conf),
+		}
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(ContainSubstring("no unnumbered address for 10.1.2.")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("customizes the host routes", func() {
+		const IFNAME = "ptp0"
+
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "hostRoutes": {
+			"metric": 50,
+			"table": 100,
+			"prefixes": ["10.9.0.0/24"]
+		    },
+		    "ipam": {
+			"type": "host-local",
+			"subnet": "10.1.2.0/24",
+			"dataDir": "%s"
+		    }
+		}`, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			podIP := result.IPs[0].Address.IP
+
+			veth, err := netlinksafe.LinkByName(result.Interfaces[0].Name)
+			Expect(err).NotTo(HaveOccurred())
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{
+				LinkIndex: veth.Attrs().Index,
+				Table:     100,
+			}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+			Expect(err).NotTo(HaveOccurred())
+
+			var dsts []string
+			for _, route := range routes {
+				Expect(route.Priority).To(Equal(50))
+				dsts = append(dsts, route.Dst.String())
+				if route.Dst.String() == "10.9.0.0/24" {
+					Expect(route.Gw.Equal(podIP)).To(BeTrue())
+				}
+			}
+			Expect(dsts).To(ConsistOf(podIP.String()+"/32", "10.9.0.0/24"))
+
+			// Nothing is routed to the container in the main table
+			routes, err = netlinksafe.RouteList(veth, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			for _, route := range routes {
+				Expect(route.Dst.Contains(podIP)).To(BeFalse())
+			}
+
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("publishes the container addresses with proxy ARP and NDP entries", func() {
+		const IFNAME = "ptp0"
+
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "proxyNeigh": {"arp": true, "ndp": true},
+		    "ipam": {
+			"type": "host-local",
+			"ranges": [
+				[{ "subnet": "10.1.2.0/24"}],
+				[{ "subnet": "2001:db8:1::0/66"}]
+			],
+			"dataDir": "%s"
+		    }
+		}`, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			// The uplink faces the routers, through the default routes
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "uplink0"
+			Expect(netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: "router0"})).To(Succeed())
+			uplink, err := netlinksafe.LinkByName("uplink0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(uplink)).To(Succeed())
+			for _, addr := range []string{"192.0.2.2/24", "2001:db8:ff::2/64"} {
+				ipn, err := netlink.ParseIPNet(addr)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.AddrAdd(uplink, &netlink.Addr{IPNet: ipn, Flags: unix.IFA_F_NODAD})).To(Succeed())
+			}
+			for _, gw := range []string{"192.0.2.1", "2001:db8:ff::1"} {
+				Expect(netlink.RouteAdd(&netlink.Route{
+					LinkIndex: uplink.Attrs().Index,
+					Gw:        net.ParseIP(gw),
+				})).To(Succeed())
+			}
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.IPs).To(HaveLen(2))
+			addrs := resultAddrs(result.IPs)
+
+			proxied := func() []string {
+				var ips []string
+				for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+					entries, err := netlinksafe.NeighProxyList(uplink.Attrs().Index, family)
+					Expect(err).NotTo(HaveOccurred())
+					for _, e := range entries {
+						ips = append(ips, e.IP.String())
+					}
+				}
+				return ips
+			}
+			Expect(proxied()).To(ConsistOf(addrs[0].String(), addrs[1].String()))
+			proxyNDP, err := os.ReadFile("/proc/sys/net/ipv6/conf/uplink0/proxy_ndp")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(string(proxyNDP))).To(Equal("1"))
+			Expect(checkProxyEntries(&ProxyNeigh{ARP: true, NDP: true}, addrs)).To(Succeed())
+
+			// DEL finds the addresses in the previous result once the
+			// namespace is gone
+			prevResult, err := json.Marshal(result)
+			Expect(err).NotTo(HaveOccurred())
+			delArgs := &skel.CmdArgs{
+				ContainerID: args.ContainerID,
+				IfName:      IFNAME,
+				StdinData:   []byte(strings.Replace(conf, `"type": "ptp",`, `"type": "ptp", "prevResult": `+string(prevResult)+`,`, 1)),
+			}
+			Expect(testutils.CmdDelWithArgs(delArgs, func() error {
+				return cmdDel(delArgs)
+			})).To(Succeed())
+			Expect(proxied()).To(BeEmpty())
+			Expect(checkProxyEntries(&ProxyNeigh{ARP: true}, addrs)).To(MatchError(fmt.Sprintf("proxy entry for %s not found on uplink0", addrs[0])))
+
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("creates several veth pairs in one invocation", func() {
+		const IFNAME = "ptp0"
+		const LINKNAME = "net1"
+
+		conf := fmt.Sprintf(`{
+		    "cniVersion": "1.0.0",
+		    "name": "mynet",
+		    "type": "ptp",
+		    "ipam": {
+			"type": "host-local",
+			"subnet": "10.1.2.0/24",
+			"dataDir": "%s"
+		    },
+		    "links": [{
+			"ifName": "%s",
+			"mtu": 1400,
+			"ipam": {
+			    "type": "host-local",
+			    "subnet": "10.1.3.0/24",
+			    "dataDir": "%s"
+			}
+		    }]
+		}`, dataDir, LINKNAME, dataDir)
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Interfaces).To(HaveLen(4))
+			Expect(result.Interfaces[1].Name).To(Equal(IFNAME))
+			Expect(result.Interfaces[3].Name).To(Equal(LINKNAME))
+			Expect(result.Interfaces[3].Sandbox).To(Equal(targetNS.Path()))
+			Expect(result.IPs).To(HaveLen(2))
+			Expect(*result.IPs[0].Interface).To(Equal(1))
+			Expect(result.IPs[0].Address.String()).To(HavePrefix("10.1.2."))
+			Expect(*result.IPs[1].Interface).To(Equal(3))
+			Expect(result.IPs[1].Address.String()).To(HavePrefix("10.1.3."))
+
+			// Both host ends route to their container address
+			for _, i := range []int{0, 2} {
+				veth, err := netlinksafe.LinkByName(result.Interfaces[i].Name)
+				Expect(err).NotTo(HaveOccurred())
+				routes, err := netlinksafe.RouteList(veth, netlink.FAMILY_V4)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(routes).NotTo(BeEmpty())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(LINKNAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Attrs().MTU).To(Equal(1400))
+			addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_V4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(1))
+			Expect(addrs[0].IPNet.String()).To(Equal(result.IPs[1].Address.String()))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			var err error
+			checkConf := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(conf), &checkConf)).To(Succeed())
+			checkConf["prevResult"] = result
+			args.StdinData, err = json.Marshal(checkConf)
+			Expect(err).NotTo(HaveOccurred())
+			err = testutils.CmdCheckWithArgs(args, func() error {
+				return cmdCheck(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			args.StdinData = []byte(conf)
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			for _, name := range []string{IFNAME, LINKNAME} {
+				_, err := netlinksafe.LinkByName(name)
+				Expect(err).To(HaveOccurred())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
@@ -0,0 +1,193 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// Unnumbered configures the veth pair as an unnumbered point-to-point link:
+// the container address is a /32 or /128, and the gateway is a host address
+// borrowed by every host veth, so that a pod consumes a single address
+// rather than sharing an IPAM gateway and subnet.
+type Unnumbered struct {
+	// Addresses are the borrowed host addresses, at most one per IP
+	// family. They default to the global addresses of the host loopback.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// gateways returns the borrowed address of each IP family. It must be
+// called in the host namespace.
+func (u *Unnumbered) gateways() (v4, v6 net.IP, err error) {
+	if len(u.Addresses) == 0 {
+		return loopbackAddresses()
+	}
+	for _, a := range u.Addresses {
+		addr := net.ParseIP(a)
+		if addr == nil {
+			return nil, nil, fmt.Errorf("invalid unnumbered address %q", a)
+		}
+		if addr.To4() != nil {
+			if v4 != nil {
+				return nil, nil, fmt.Errorf("unnumbered has several IPv4 addresses")
+			}
+			v4 = addr.To4()
+		} else {
+			if v6 != nil {
+				return nil, nil, fmt.Errorf("unnumbered has several IPv6 addresses")
+			}
+			v6 = addr
+		}
+	}
+	return v4, v6, nil
+}
+
+// loopbackAddresses returns the first global address of each family of
+// the loopback interface
+func loopbackAddresses() (v4, v6 net.IP, err error) {
+	lo, err := netlinksafe.LinkByName("lo")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lookup lo: %v", err)
+	}
+	addrs, err := netlinksafe.AddrList(lo, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list addresses of lo: %v", err)
+	}
+	for _, a := range addrs {
+		if a.Scope != int(netlink.SCOPE_UNIVERSE) {
+			continue
+		}
+		if a.IP.To4() != nil {
+			if v4 == nil {
+				v4 = a.IP.To4()
+			}
+		} else if v6 == nil {
+			v6 = a.IP
+		}
+	}
+	return v4, v6, nil
+}
+
+// borrowGateways replaces the IPAM gateways of the result with the
+// borrowed addresses
+func borrowGateways(result *current.Result, v4, v6 net.IP) error {
+	for _, ipc := range result.IPs {
+		gw := v4
+		if ipc.Address.IP.To4() == nil {
+			gw = v6
+		}
+		if gw == nil {
+			return fmt.Errorf("no unnumbered address for %s", ipc.Address.IP)
+		}
+		ipc.Gateway = gw
+	}
+	return nil
+}
+
+// configureUnnumbered assigns the addresses of the result to the container
+// veth as /32 or /128, and routes the IPAM subnets and routes through the
+// borrowed gateways. The result is updated with the assigned addresses.
+func configureUnnumbered(ifName string, pr *current.Result) error {
+	var subnets []net.IPNet
+	for _, ipc := range pr.IPs {
+		subnets = append(subnets, net.IPNet{
+			IP:   ipc.Address.IP.Mask(ipc.Address.Mask),
+			Mask: ipc.Address.Mask,
+		})
+		bits := 32
+		if ipc.Address.IP.To4() == nil {
+			bits = 128
+		}
+		ipc.Address.Mask = net.CIDRMask(bits, bits)
+	}
+
+	// The gateways are not reachable until the peer routes exist, so the
+	// routes of the result are added afterwards
+	addrsOnly := *pr
+	addrsOnly.Routes = nil
+	if err := ipam.ConfigureIface(ifName, &addrsOnly); err != nil {
+		return err
+	}
+
+	contVeth, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to look up %q: %v", ifName, err)
+	}
+
+	var v4gw, v6gw net.IP
+	for i, ipc := range pr.IPs {
+		if ipc.Gateway.To4() != nil {
+			v4gw = ipc.Gateway
+		} else {
+			v6gw = ipc.Gateway
+		}
+		bits := len(ipc.Address.Mask) * 8
+		for _, r := range []netlink.Route{
+			{
+				LinkIndex: contVeth.Attrs().Index,
+				Dst: &net.IPNet{
+					IP:   ipc.Gateway,
+					Mask: net.CIDRMask(bits, bits),
+				},
+				Scope: netlink.SCOPE_LINK,
+				Src:   ipc.Address.IP,
+			},
+			{
+				LinkIndex: contVeth.Attrs().Index,
+				Dst:       &subnets[i],
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Gw:        ipc.Gateway,
+				Src:       ipc.Address.IP,
+			},
+		} {
+			if err := netlink.RouteReplace(&r); err != nil {
+				return fmt.Errorf("failed to add route %v: %v", r, err)
+			}
+		}
+	}
+
+	for _, r := range pr.Routes {
+		gw := r.GW
+		if gw == nil {
+			gw = v4gw
+			if r.Dst.IP.To4() == nil {
+				gw = v6gw
+			}
+		}
+		route := netlink.Route{
+			LinkIndex: contVeth.Attrs().Index,
+			Dst:       &r.Dst,
+			Gw:        gw,
+			Priority:  r.Priority,
+		}
+		if r.Table != nil {
+			route.Table = *r.Table
+		}
+		if r.Scope != nil {
+			route.Scope = netlink.Scope(*r.Scope)
+		}
+		if err := netlink.RouteAddEcmp(&route); err != nil {
+			return fmt.Errorf("failed to add route '%v via %v dev %v': %v", r.Dst, gw, ifName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/sriov"
+)
+
+// moveVFIn moves the VF network interface into the container, renamed to
+// ifName. As in host-device, the interface is renamed in a temporary
+// namespace, since renaming it in the host races with udev and
+// NetworkManager.
+func moveVFIn(hostName string, containerNs ns.NetNS, ifName string, mtu int) (netlink.Link, error) {
+	hostDev, err := netlinksafe.LinkByName(hostName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find VF %q: %v", hostName, err)
+	}
+
+	tempNS, err := ns.TempNetNS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tempNS: %v", err)
+	}
+	defer tempNS.Close()
+
+	if err = netlink.LinkSetNsFd(hostDev, int(tempNS.Fd())); err != nil {
+		return nil, fmt.Errorf("failed to move %q to tempNS: %v", hostName, err)
+	}
+
+	err = tempNS.Do(func(hostNS ns.NetNS) error {
+		tempDev, err := netlinksafe.LinkByName(hostName)
+		if err != nil {
+			return fmt.Errorf("failed to find %q in tempNS: %v", hostName, err)
+		}
+
+		// Physical devices left in a destroyed namespace go to the initial
+		// namespace, which may not be the host one
+		defer func() {
+			if err != nil {
+				_ = netlink.LinkSetName(tempDev, hostName)
+				_ = netlink.LinkSetNsFd(tempDev, int(hostNS.Fd()))
+			}
+		}()
+
+		if err = netlink.LinkSetName(tempDev, ifName); err != nil {
+			return fmt.Errorf("failed to rename VF %q to %q: %v", hostName, ifName, err)
+		}
+		if mtu != 0 {
+			if err = netlink.LinkSetMTU(tempDev, mtu); err != nil {
+				return fmt.Errorf("failed to set MTU of %q to %d: %v", ifName, mtu, err)
+			}
+		}
+		if err = netlink.LinkSetNsFd(tempDev, int(containerNs.Fd())); err != nil {
+			return fmt.Errorf("failed to move %q to container NS: %v", ifName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var contDev netlink.Link
+	err = containerNs.Do(func(_ ns.NetNS) error {
+		var err error
+		contDev, err = netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to find %q in container NS: %v", ifName, err)
+		}
+		if err := netlink.LinkSetUp(contDev); err != nil {
+			return fmt.Errorf("failed to set %q up: %v", ifName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contDev, nil
+}
+
+// moveVFOut moves the VF network interface out of the container, renamed
+// back to hostName. The interface is left down.
+func moveVFOut(containerNs ns.NetNS, ifName, hostName string) error {
+	tempNS, err := ns.TempNetNS()
+	if err != nil {
+		return fmt.Errorf("failed to create tempNS: %v", err)
+	}
+	defer tempNS.Close()
+
+	err = containerNs.Do(func(_ ns.NetNS) error {
+		contDev, err := netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return err
+		}
+		if err := netlink.LinkSetDown(contDev); err != nil {
+			return fmt.Errorf("failed to set %q down: %v", ifName, err)
+		}
+		if err := netlink.LinkSetNsFd(contDev, int(tempNS.Fd())); err != nil {
+			return fmt.Errorf("failed to move %q to tempNS: %v", ifName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tempNS.Do(func(hostNS ns.NetNS) error {
+		tempDev, err := netlinksafe.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to find %q in tempNS: %v", ifName, err)
+		}
+		if err := netlink.LinkSetName(tempDev, hostName); err != nil {
+			_ = netlink.LinkSetNsFd(tempDev, int(containerNs.Fd()))
+			return fmt.Errorf("failed to rename %q to %q: %v", ifName, hostName, err)
+		}
+		if err := netlink.LinkSetNsFd(tempDev, int(hostNS.Fd())); err != nil {
+			_ = netlink.LinkSetName(tempDev, ifName)
+			_ = netlink.LinkSetNsFd(tempDev, int(containerNs.Fd()))
+			return fmt.Errorf("failed to move %q to hostNS: %v", hostName, err)
+		}
+		return nil
+	})
+}
+
+// renameVF renames the VF network interface in the host back to hostName.
+// The kernel returns the VF of a destroyed namespace to the host with its
+// container name, or a generated one if taken.
+func renameVF(pciAddr, hostName string) error {
+	name := sriov.VFNetdev(pciAddr)
+	if name == "" || name == hostName {
+		return nil
+	}
+	link, err := netlinksafe.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to find VF %q: %v", name, err)
+	}
+	if err := netlink.LinkSetDown(link); err != nil {
+		return fmt.Errorf("failed to set %q down: %v", name, err)
+	}
+	if err := netlink.LinkSetName(link, hostName); err != nil {
+		return fmt.Errorf("failed to rename VF %q to %q: %v", name, hostName, err)
+	}
+	return nil
+}
+
+// isLinkNotFound reports whether the error is that of a missing link
+func isLinkNotFound(err error) bool {
+	_, ok := err.(netlink.LinkNotFoundError)
+	return ok || err == ip.ErrLinkNotFound
+}
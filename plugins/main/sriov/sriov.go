@@ -0,0 +1,539 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin moving an SR-IOV VF into the container, configured
+// through its PF.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/sriov"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const defaultDataDir = "/var/lib/cni/sriov"
+
+var linkStates = map[string]uint32{
+	"auto":    netlink.VF_LINK_STATE_AUTO,
+	"enable":  netlink.VF_LINK_STATE_ENABLE,
+	"disable": netlink.VF_LINK_STATE_DISABLE,
+}
+
+type NetConf struct {
+	types.NetConf
+	// Master names the PF whose VFs are allocated
+	Master string `json:"master,omitempty"`
+	// VFIndex selects the VF of the PF, the first free one by default
+	VFIndex *int `json:"vfIndex,omitempty"`
+	// DeviceID is the PCI address of the VF, e.g. as allocated by a
+	// device plugin, instead of Master
+	DeviceID string `json:"deviceID,omitempty"`
+
+	MAC       string `json:"mac,omitempty"`
+	VLAN      *int   `json:"vlan,omitempty"`
+	VLANQoS   *int   `json:"vlanQoS,omitempty"`
+	VLANProto string `json:"vlanProto,omitempty"`
+	SpoofChk  *bool  `json:"spoofchk,omitempty"`
+	Trust     *bool  `json:"trust,omitempty"`
+	// MinTxRate and MaxTxRate are in Mbps, 0 for no limit
+	MinTxRate *int `json:"minTxRate,omitempty"`
+	MaxTxRate *int `json:"maxTxRate,omitempty"`
+	// LinkState is "auto", "enable" or "disable"
+	LinkState string `json:"linkState,omitempty"`
+	MTU       int    `json:"mtu,omitempty"`
+
+	// DataDir is where the VFs allocated and their original settings are
+	// recorded
+	DataDir string `json:"dataDir,omitempty"`
+
+	RuntimeConfig struct {
+		Mac string `json:"mac,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+
+	vlanProto int
+	linkState uint32
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	if n.Master == "" && n.DeviceID == "" {
+		return nil, errors.New(`"master" or "deviceID" is required`)
+	}
+	if n.DeviceID != "" && n.VFIndex != nil {
+		return nil, errors.New(`"vfIndex" can't be combined with "deviceID"`)
+	}
+	if n.VFIndex != nil && *n.VFIndex < 0 {
+		return nil, fmt.Errorf("invalid vfIndex %d", *n.VFIndex)
+	}
+
+	// The MAC of the runtime takes precedence
+	if n.RuntimeConfig.Mac != "" {
+		n.MAC = n.RuntimeConfig.Mac
+	}
+	if n.MAC != "" {
+		if _, err := net.ParseMAC(n.MAC); err != nil {
+			return nil, fmt.Errorf("invalid MAC address %q: %v", n.MAC, err)
+		}
+	}
+
+	if n.VLAN != nil && (*n.VLAN < 0 || *n.VLAN > 4094) {
+		return nil, fmt.Errorf("invalid VLAN %d, must be between 0 and 4094", *n.VLAN)
+	}
+	if n.VLANQoS != nil {
+		if n.VLAN == nil {
+			return nil, errors.New(`"vlanQoS" requires "vlan"`)
+		}
+		if *n.VLANQoS < 0 || *n.VLANQoS > 7 {
+			return nil, fmt.Errorf("invalid vlanQoS %d, must be between 0 and 7", *n.VLANQoS)
+		}
+	}
+	if n.VLANProto != "" {
+		if n.VLAN == nil {
+			return nil, errors.New(`"vlanProto" requires "vlan"`)
+		}
+		proto, ok := netlink.StringToVlanProtocolMap[n.VLANProto]
+		if !ok {
+			return nil, fmt.Errorf("invalid vlanProto %q, must be 802.1q or 802.1ad", n.VLANProto)
+		}
+		n.vlanProto = int(proto)
+	}
+
+	if n.MinTxRate != nil && *n.MinTxRate < 0 {
+		return nil, fmt.Errorf("invalid minTxRate %d", *n.MinTxRate)
+	}
+	if n.MaxTxRate != nil && *n.MaxTxRate < 0 {
+		return nil, fmt.Errorf("invalid maxTxRate %d", *n.MaxTxRate)
+	}
+	if n.MinTxRate != nil && n.MaxTxRate != nil && *n.MaxTxRate != 0 && *n.MinTxRate > *n.MaxTxRate {
+		return nil, fmt.Errorf("minTxRate %d is greater than maxTxRate %d", *n.MinTxRate, *n.MaxTxRate)
+	}
+
+	if n.LinkState != "" {
+		state, ok := linkStates[n.LinkState]
+		if !ok {
+			return nil, fmt.Errorf("invalid linkState %q, must be auto, enable or disable", n.LinkState)
+		}
+		n.linkState = state
+	}
+
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d, must be positive", n.MTU)
+	}
+	if n.DataDir == "" {
+		n.DataDir = defaultDataDir
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the VF
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// pfAndIndex returns the PF and the VF index selected by the configuration
+func (n *NetConf) pfAndIndex() (string, *int, error) {
+	if n.DeviceID == "" {
+		return n.Master, n.VFIndex, nil
+	}
+	pf, index, err := sriov.VFOfDevice(n.DeviceID)
+	if err != nil {
+		return "", nil, err
+	}
+	if n.Master != "" && n.Master != pf {
+		return "", nil, fmt.Errorf("%s is a VF of %q, not of master %q", n.DeviceID, pf, n.Master)
+	}
+	return pf, &index, nil
+}
+
+// allocateVF reserves the VF of the attachment, records its settings and
+// configures it through the PF
+func allocateVF(n *NetConf, containerID, ifName string) (*vfState, error) {
+	pfName, index, err := n.pfAndIndex()
+	if err != nil {
+		return nil, err
+	}
+	pf, err := netlinksafe.LinkByName(pfName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find PF %q: %v", pfName, err)
+	}
+
+	vf, pciAddr, err := sriov.ReserveVF(pfName, index, containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	state := &vfState{
+		PF:       pfName,
+		VF:       vf,
+		PCIAddr:  pciAddr,
+		HostName: sriov.VFNetdev(pciAddr),
+	}
+
+	err = func() error {
+		info := sriov.VFInfo(pf, vf)
+		if info == nil {
+			return fmt.Errorf("failed to find VF %d of %q", vf, pfName)
+		}
+		hostDev, err := netlinksafe.LinkByName(state.HostName)
+		if err != nil {
+			return fmt.Errorf("failed to find VF %q: %v", state.HostName, err)
+		}
+		state.NetdevMAC = hostDev.Attrs().HardwareAddr.String()
+		settings := n.vfSettings()
+		state.Original = sriov.Current(info, settings)
+		if err := saveState(n.DataDir, containerID, ifName, state); err != nil {
+			return err
+		}
+
+		if err := sriov.Configure(pf, vf, settings); err != nil {
+			_ = sriov.Configure(pf, vf, state.Original)
+			return err
+		}
+		// Drivers don't all update the MAC of the VF network interface
+		// with the one set through the PF
+		if n.MAC != "" {
+			mac, _ := net.ParseMAC(n.MAC)
+			if err := netlink.LinkSetHardwareAddr(hostDev, mac); err != nil {
+				_ = sriov.Configure(pf, vf, state.Original)
+				return fmt.Errorf("failed to set MAC address of %q: %v", state.HostName, err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		_ = releaseState(n.DataDir, containerID, ifName, state)
+		return nil, err
+	}
+	return state, nil
+}
+
+// freeVF restores the settings of the VF and releases it. The VF must be
+// back in the host.
+func freeVF(n *NetConf, containerID, ifName string, state *vfState) error {
+	if err := renameVF(state.PCIAddr, state.HostName); err != nil {
+		return err
+	}
+	if n.MAC != "" && state.NetdevMAC != "" {
+		if hostDev, err := netlinksafe.LinkByName(state.HostName); err == nil {
+			mac, _ := net.ParseMAC(state.NetdevMAC)
+			_ = netlink.LinkSetHardwareAddr(hostDev, mac)
+		}
+	}
+	// The VFs are gone with the PF, there is nothing to restore
+	if pf, err := netlinksafe.LinkByName(state.PF); err == nil {
+		if err := sriov.Configure(pf, state.VF, state.Original); err != nil {
+			return err
+		}
+	}
+	return releaseState(n.DataDir, containerID, ifName, state)
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	state, err := allocateVF(n, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = freeVF(n, args.ContainerID, args.IfName, state)
+		}
+	}()
+
+	contDev, err := moveVFIn(state.HostName, netns, args.IfName, n.MTU)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = moveVFOut(netns, args.IfName, state.HostName)
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{{
+			Name:    args.IfName,
+			Mac:     contDev.Attrs().HardwareAddr.String(),
+			Sandbox: netns.Path(),
+			PciID:   state.PCIAddr,
+		}},
+	}
+
+	if !n.hasIPAM() {
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the VF
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	state, err := loadState(n.DataDir, args.ContainerID, args.IfName)
+	if err != nil || state == nil {
+		return err
+	}
+
+	// The VF of a destroyed namespace is already back in the host
+	if args.Netns != "" {
+		err = ns.WithNetNSPath(args.Netns, func(netns ns.NetNS) error {
+			return moveVFOut(netns, args.IfName, state.HostName)
+		})
+		if err != nil {
+			_, nsGone := err.(ns.NSPathNotExistErr)
+			if !nsGone && !isLinkNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return freeVF(n, args.ContainerID, args.IfName, state)
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("sriov: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	state, err := loadState(n.DataDir, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("sriov: no VF recorded for %s/%s", args.ContainerID, args.IfName)
+	}
+	if contMap.PciID != "" && contMap.PciID != state.PCIAddr {
+		return fmt.Errorf("sriov: VF %s in prevResult doesn't match the allocated VF %s", contMap.PciID, state.PCIAddr)
+	}
+	if err := validateVF(n, state); err != nil {
+		return err
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+// validateVF verifies the settings of the VF against the configuration
+func validateVF(n *NetConf, state *vfState) error {
+	pf, err := netlinksafe.LinkByName(state.PF)
+	if err != nil {
+		return fmt.Errorf("sriov: PF %q not found: %v", state.PF, err)
+	}
+	info := sriov.VFInfo(pf, state.VF)
+	if info == nil {
+		return fmt.Errorf("sriov: VF %d of %q not found", state.VF, state.PF)
+	}
+
+	if n.MAC != "" && info.Mac.String() != n.MAC {
+		return fmt.Errorf("sriov: VF %d MAC %s doesn't match configured MAC %s", state.VF, info.Mac, n.MAC)
+	}
+	if n.VLAN != nil && info.Vlan != *n.VLAN {
+		return fmt.Errorf("sriov: VF %d VLAN %d doesn't match configured VLAN %d", state.VF, info.Vlan, *n.VLAN)
+	}
+	if n.VLANQoS != nil && info.Qos != *n.VLANQoS {
+		return fmt.Errorf("sriov: VF %d VLAN QoS %d doesn't match configured QoS %d", state.VF, info.Qos, *n.VLANQoS)
+	}
+	if n.SpoofChk != nil && info.Spoofchk != *n.SpoofChk {
+		return fmt.Errorf("sriov: VF %d spoofchk %t doesn't match configured spoofchk %t", state.VF, info.Spoofchk, *n.SpoofChk)
+	}
+	if n.Trust != nil && (info.Trust != 0) != *n.Trust {
+		return fmt.Errorf("sriov: VF %d trust %t doesn't match configured trust %t", state.VF, info.Trust != 0, *n.Trust)
+	}
+	if n.MinTxRate != nil && int(info.MinTxRate) != *n.MinTxRate {
+		return fmt.Errorf("sriov: VF %d minTxRate %d doesn't match configured minTxRate %d", state.VF, info.MinTxRate, *n.MinTxRate)
+	}
+	if n.MaxTxRate != nil && int(info.MaxTxRate) != *n.MaxTxRate {
+		return fmt.Errorf("sriov: VF %d maxTxRate %d doesn't match configured maxTxRate %d", state.VF, info.MaxTxRate, *n.MaxTxRate)
+	}
+	if n.LinkState != "" && info.LinkState != n.linkState {
+		return fmt.Errorf("sriov: VF %d link state %d doesn't match configured linkState %s", state.VF, info.LinkState, n.LinkState)
+	}
+	return nil
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("sriov: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("sriov: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("sriov: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.Master != "" {
+		if _, err := sriov.PFVFs(n.Master); err != nil {
+			return err
+		}
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("sriov"))
+}
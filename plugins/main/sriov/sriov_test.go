@@ -0,0 +1,181 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/sriov"
+)
+
+// fakeSysfs lays out a PF "pf0" with three VFs. VF 0 has no network
+// interface in the namespace, as if in use by a container.
+func fakeSysfs() {
+	root, err := os.MkdirTemp("", "sriov")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(os.RemoveAll, root)
+
+	for _, dir := range []string{
+		"sys/bus/pci/devices/0000:00:01.0/physfn/net/pf0",
+		"sys/bus/pci/devices/0000:00:01.1/physfn/net/pf0",
+		"sys/bus/pci/devices/0000:00:01.1/net/vf1",
+		"sys/bus/pci/devices/0000:00:01.2/physfn/net/pf0",
+		"sys/bus/pci/devices/0000:00:01.2/net/vf2",
+		"sys/bus/pci/devices/0000:00:02.0",
+		"sys/class/net/pf0/device",
+		"sys/class/net/vf1",
+		"sys/class/net/vf2",
+	} {
+		Expect(os.MkdirAll(filepath.Join(root, dir), 0o755)).To(Succeed())
+	}
+	for vf := 0; vf < 3; vf++ {
+		Expect(os.Symlink(
+			fmt.Sprintf("../../../../bus/pci/devices/0000:00:01.%d", vf),
+			filepath.Join(root, fmt.Sprintf("sys/class/net/pf0/device/virtfn%d", vf)),
+		)).To(Succeed())
+	}
+
+	origBusPCI, origClassNet, origReservations := sriov.SysBusPCI, sriov.SysClassNet, sriov.ReservationDir
+	sriov.SysBusPCI = filepath.Join(root, "sys/bus/pci/devices")
+	sriov.SysClassNet = filepath.Join(root, "sys/class/net")
+	sriov.ReservationDir = filepath.Join(root, "run/cni/vf-reservations")
+	DeferCleanup(func() {
+		sriov.SysBusPCI, sriov.SysClassNet, sriov.ReservationDir = origBusPCI, origClassNet, origReservations
+	})
+}
+
+var _ = Describe("sriov configuration", func() {
+	It("applies the defaults", func() {
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "sriov", "master": "pf0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.DataDir).To(Equal(defaultDataDir))
+		Expect(n.VFIndex).To(BeNil())
+	})
+
+	It("parses the VF settings", func() {
+		n, err := loadConf([]byte(`{
+			"master": "pf0",
+			"mac": "02:00:00:00:00:01",
+			"vlan": 100,
+			"vlanQoS": 3,
+			"vlanProto": "802.1ad",
+			"spoofchk": false,
+			"trust": true,
+			"minTxRate": 100,
+			"maxTxRate": 1000,
+			"linkState": "disable"
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.vlanProto).To(Equal(int(netlink.VLAN_PROTOCOL_8021AD)))
+		Expect(n.linkState).To(Equal(netlink.VF_LINK_STATE_DISABLE))
+	})
+
+	It("prefers the MAC of the runtime", func() {
+		n, err := loadConf([]byte(`{"master": "pf0", "mac": "02:00:00:00:00:01", "runtimeConfig": {"mac": "02:00:00:00:00:02"}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.MAC).To(Equal("02:00:00:00:00:02"))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(conf, msg string) {
+			_, err := loadConf([]byte(conf))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("without a PF or a VF", `{}`, `"master" or "deviceID" is required`),
+		Entry("with a VF index and a device", `{"deviceID": "0000:00:01.1", "vfIndex": 1}`, `"vfIndex" can't be combined with "deviceID"`),
+		Entry("with a negative VF index", `{"master": "pf0", "vfIndex": -1}`, "invalid vfIndex -1"),
+		Entry("with an invalid MAC", `{"master": "pf0", "mac": "02:00"}`, `invalid MAC address "02:00"`),
+		Entry("with an invalid VLAN", `{"master": "pf0", "vlan": 4095}`, "invalid VLAN 4095"),
+		Entry("with a QoS without VLAN", `{"master": "pf0", "vlanQoS": 1}`, `"vlanQoS" requires "vlan"`),
+		Entry("with an invalid QoS", `{"master": "pf0", "vlan": 1, "vlanQoS": 8}`, "invalid vlanQoS 8"),
+		Entry("with an invalid VLAN protocol", `{"master": "pf0", "vlan": 1, "vlanProto": "802.1x"}`, `invalid vlanProto "802.1x"`),
+		Entry("with inverted rates", `{"master": "pf0", "minTxRate": 200, "maxTxRate": 100}`, "minTxRate 200 is greater than maxTxRate 100"),
+		Entry("with an invalid link state", `{"master": "pf0", "linkState": "up"}`, `invalid linkState "up"`),
+		Entry("with a negative MTU", `{"master": "pf0", "mtu": -1}`, "invalid MTU -1"),
+	)
+})
+
+var _ = Describe("sriov VF allocation", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		fakeSysfs()
+
+		var err error
+		dataDir, err = os.MkdirTemp("", "sriov-data")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dataDir)
+	})
+
+	It("finds the PF and index of a device", func() {
+		n, err := loadConf([]byte(`{"deviceID": "0000:00:01.2"}`))
+		Expect(err).NotTo(HaveOccurred())
+		pf, index, err := n.pfAndIndex()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf).To(Equal("pf0"))
+		Expect(*index).To(Equal(2))
+
+		n.Master = "pf1"
+		_, _, err = n.pfAndIndex()
+		Expect(err).To(MatchError(`0000:00:01.2 is a VF of "pf0", not of master "pf1"`))
+
+		n, err = loadConf([]byte(`{"deviceID": "0000:00:02.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = n.pfAndIndex()
+		Expect(err).To(MatchError("0000:00:02.0 is not an SR-IOV VF with a PF network interface"))
+	})
+
+	It("records and releases the VF of an attachment", func() {
+		n, err := loadConf([]byte(`{"master": "pf0", "vlan": 100, "trust": false, "maxTxRate": 1000}`))
+		Expect(err).NotTo(HaveOccurred())
+		vf, pciAddr, err := sriov.ReserveVF("pf0", nil, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+
+		info := &netlink.VfInfo{ID: vf, Vlan: 10, Qos: 1, Spoofchk: true, Trust: 1, MaxTxRate: 500}
+		state := &vfState{PF: "pf0", VF: vf, PCIAddr: pciAddr, HostName: "vf1", Original: sriov.Current(info, n.vfSettings())}
+		Expect(saveState(dataDir, "container1", "net1", state)).To(Succeed())
+
+		loaded, err := loadState(dataDir, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(state))
+		Expect(*loaded.Original.VLAN).To(Equal(10))
+		Expect(*loaded.Original.Trust).To(BeTrue())
+		Expect(*loaded.Original.MaxTxRate).To(Equal(500))
+		Expect(loaded.Original.MAC).To(BeEmpty())
+		Expect(loaded.Original.SpoofChk).To(BeNil())
+
+		Expect(releaseState(dataDir, "container1", "net1", loaded)).To(Succeed())
+		loaded, err = loadState(dataDir, "container1", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(BeNil())
+
+		// The VF is free again
+		vf, _, err = sriov.ReserveVF("pf0", nil, "container2", "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vf).To(Equal(1))
+	})
+
+	It("does nothing on DEL without a VF recorded", func() {
+		conf := fmt.Sprintf(`{"cniVersion": "1.0.0", "name": "net", "type": "sriov", "master": "pf0", "dataDir": "%s"}`, dataDir)
+		Expect(cmdDel(&skel.CmdArgs{ContainerID: "dummy", IfName: "net1", StdinData: []byte(conf)})).To(Succeed())
+	})
+})
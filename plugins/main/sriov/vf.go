@@ -0,0 +1,108 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/sriov"
+)
+
+const vfsGroup = "vf"
+
+// vfState records the VF allocated to an attachment, and its settings
+// before ADD, which DEL restores
+type vfState struct {
+	PF      string `json:"pf"`
+	VF      int    `json:"vf"`
+	PCIAddr string `json:"pciBusID"`
+	// HostName is the name of the VF network interface in the host
+	HostName string `json:"hostName"`
+	// NetdevMAC is the MAC of the VF network interface
+	NetdevMAC string `json:"netdevMac,omitempty"`
+	// Original holds the settings changed by the configuration as they
+	// were before ADD
+	Original *sriov.Settings `json:"original,omitempty"`
+}
+
+// vfSettings returns the settings of the VF set by the configuration
+func (n *NetConf) vfSettings() *sriov.Settings {
+	s := &sriov.Settings{
+		MAC:       n.MAC,
+		VLAN:      n.VLAN,
+		VLANQoS:   n.VLANQoS,
+		VLANProto: n.vlanProto,
+		SpoofChk:  n.SpoofChk,
+		Trust:     n.Trust,
+		MinTxRate: n.MinTxRate,
+		MaxTxRate: n.MaxTxRate,
+	}
+	if n.LinkState != "" {
+		s.LinkState = &n.linkState
+	}
+	return s
+}
+
+// saveState records the VF of the attachment
+func saveState(dataDir, containerID, ifName string, state *vfState) error {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.PutJSON(vfsGroup, attachments.ID(containerID, ifName), state); err != nil {
+		return fmt.Errorf("failed to record VF %d of %q: %v", state.VF, state.PF, err)
+	}
+	return nil
+}
+
+// loadState returns the recorded VF of the attachment, or nil if none
+func loadState(dataDir, containerID, ifName string) (*vfState, error) {
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	state := &vfState{}
+	found, err := store.GetJSON(vfsGroup, attachments.ID(containerID, ifName), state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VF state: %v", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return state, nil
+}
+
+// releaseState releases the VF and drops its record
+func releaseState(dataDir, containerID, ifName string, state *vfState) error {
+	if err := sriov.ReleaseVF(state.PCIAddr, containerID, ifName); err != nil {
+		return err
+	}
+
+	store, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if _, err := store.Remove(vfsGroup, attachments.ID(containerID, ifName)); err != nil {
+		return fmt.Errorf("failed to release VF %d of %q: %v", state.VF, state.PF, err)
+	}
+	return nil
+}
@@ -50,8 +50,17 @@ type NetConf struct {
 	SelinuxContext string    `json:"selinuxContext,omitempty"`
 	Bridge         string    `json:"bridge,omitempty"`
 	Args           *struct{} `json:"args,omitempty"`
-	RuntimeConfig  struct {
-		Mac string `json:"mac,omitempty"`
+
+	// VhostNet hands the tap queues and vhost-net devices over to the
+	// runtime, for the vhost-net backend of a VMM
+	VhostNet *VhostNet `json:"vhostNet,omitempty"`
+
+	// TC attaches pinned eBPF programs to the tap before it is up
+	TC *TCPrograms `json:"tc,omitempty"`
+
+	RuntimeConfig struct {
+		Mac      string                 `json:"mac,omitempty"`
+		VhostNet *VhostNetRuntimeConfig `json:"vhostNet,omitempty"`
 	} `json:"runtimeConfig,omitempty"`
 }
 
@@ -89,6 +98,13 @@ func loadConf(args *skel.CmdArgs) (*NetConf, string, error) {
 		n.Mac = n.RuntimeConfig.Mac
 	}
 
+	if err := n.VhostNet.validate(n.MultiQueue); err != nil {
+		return nil, "", err
+	}
+	if err := n.TC.validate(); err != nil {
+		return nil, "", err
+	}
+
 	return n, n.CNIVersion, nil
 }
 
@@ -104,13 +120,16 @@ func closeFileDescriptorsOnExec() {
 
 // Due to issues with the vishvananda/netlink library (fix pending) it is not possible to create an ownerless/groupless
 // tap device. Until the issue is fixed, the workaround for creating a tap device with no owner/group is to use the iptool
-func createTapWithIptool(tmpName string, mtu int, multiqueue bool, mac string, owner *uint32, group *uint32) error {
+func createTapWithIptool(tmpName string, mtu int, multiqueue, vnetHdr bool, mac string, owner *uint32, group *uint32) error {
 	closeFileDescriptorsOnExec()
 
 	tapDeviceArgs := []string{"tuntap", "add", "mode", "tap", "name", tmpName}
 	if multiqueue {
 		tapDeviceArgs = append(tapDeviceArgs, "multi_queue")
 	}
+	if vnetHdr {
+		tapDeviceArgs = append(tapDeviceArgs, "vnet_hdr")
+	}
 
 	if owner != nil {
 		tapDeviceArgs = append(tapDeviceArgs, "user", fmt.Sprintf("%d", *owner))
@@ -179,9 +198,9 @@ func createLink(tmpName string, conf *NetConf, netns ns.NetNS) error {
 		if err := selinux.SetExecLabel(conf.SelinuxContext); err != nil {
 			return fmt.Errorf("failed set socket label: %v", err)
 		}
-		return createTapWithIptool(tmpName, conf.MTU, conf.MultiQueue, conf.Mac, conf.Owner, conf.Group)
+		return createTapWithIptool(tmpName, conf.MTU, conf.MultiQueue, conf.VhostNet != nil, conf.Mac, conf.Owner, conf.Group)
 	case conf.Owner == nil || conf.Group == nil:
-		return createTapWithIptool(tmpName, conf.MTU, conf.MultiQueue, conf.Mac, conf.Owner, conf.Group)
+		return createTapWithIptool(tmpName, conf.MTU, conf.MultiQueue, conf.VhostNet != nil, conf.Mac, conf.Owner, conf.Group)
 	default:
 		return createLinkWithNetlink(tmpName, conf.MTU, int(netns.Fd()), conf.MultiQueue, conf.Mac, conf.Owner, conf.Group)
 	}
@@ -217,6 +236,11 @@ func createTap(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface
 			return fmt.Errorf("failed to refetch tap %q: %v", ifName, err)
 		}
 
+		if err := attachTCPrograms(link, conf.TC); err != nil {
+			_ = netlink.LinkDel(link)
+			return err
+		}
+
 		if conf.Bridge != "" {
 			bridge, err := netlinksafe.LinkByName(conf.Bridge)
 			if err != nil {
@@ -338,6 +362,12 @@ func cmdAdd(args *skel.CmdArgs) error {
 		}
 	}
 
+	if n.VhostNet != nil {
+		if err = handOverVhostNet(n, args.IfName, netns, tapInterface); err != nil {
+			return err
+		}
+	}
+
 	result.DNS = n.DNS
 	return types.PrintResult(result, cniVersion)
 }
@@ -458,6 +488,14 @@ func cmdCheck(args *skel.CmdArgs) error {
 		if err != nil {
 			return err
 		}
+
+		if n.TC != nil {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to find interface name %q: %v", args.IfName, err)
+			}
+			return checkTCPrograms(link, n.TC)
+		}
 		return nil
 	})
 }
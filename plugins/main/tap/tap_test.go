@@ -19,12 +19,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
+	"unsafe"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -446,3 +450,353 @@ var _ = Describe("Add, check, remove tap plugin", func() {
 		})
 	}
 })
+
+var _ = Describe("vhost-net handover", func() {
+	var (
+		originalNS, targetNS ns.NetNS
+		tmpDir               string
+	)
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		tmpDir, err = os.MkdirTemp("", "tap-vhost")
+		Expect(err).NotTo(HaveOccurred())
+
+		// vhost-net is not available in CI, any file opens the same way
+		origVhostNetDevice := vhostNetDevice
+		vhostNetDevice = filepath.Join(tmpDir, "vhost-net")
+		Expect(os.WriteFile(vhostNetDevice, nil, 0o600)).To(Succeed())
+		DeferCleanup(func() { vhostNetDevice = origVhostNetDevice })
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("sends the tap queues and vhost-net devices to the runtime socket", func() {
+		socket := filepath.Join(tmpDir, "fds.sock")
+		listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		type message struct {
+			header vhostNetFDs
+			fds    []int
+		}
+		received := make(chan message, 1)
+		go func() {
+			defer GinkgoRecover()
+			conn, err := listener.AcceptUnix()
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			buf := make([]byte, 1024)
+			oob := make([]byte, unix.CmsgSpace(8*4))
+			n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+			Expect(err).NotTo(HaveOccurred())
+			msg := message{}
+			Expect(json.Unmarshal(buf[:n], &msg.header)).To(Succeed())
+			cmsgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmsgs).To(HaveLen(1))
+			msg.fds, err = unix.ParseUnixRights(&cmsgs[0])
+			Expect(err).NotTo(HaveOccurred())
+			received <- msg
+		}()
+
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "tapTest",
+			"type": "tap",
+			"owner": 0,
+			"group": 0,
+			"multiQueue": true,
+			"vhostNet": {"queues": 2},
+			"runtimeConfig": {"vhostNet": {"fdSocket": %q}}
+		}`, socket)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces[0].SocketPath).To(Equal(socket))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var msg message
+		Eventually(received).Should(Receive(&msg))
+		Expect(msg.header).To(Equal(vhostNetFDs{IfName: IFNAME, Queues: 2}))
+		Expect(msg.fds).To(HaveLen(4))
+		for i, fd := range msg.fds {
+			if i%2 == 0 {
+				// The tap queues report the tap they are attached to
+				ifr, err := unix.NewIfreq("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(unix.IoctlIfreq(fd, unix.TUNGETIFF, ifr)).To(Succeed())
+				Expect(ifr.Name()).To(Equal(IFNAME))
+			}
+			Expect(unix.Close(fd)).To(Succeed())
+		}
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("points the runtime to vhost-net without socket", func() {
+		conf := `{
+			"cniVersion": "1.0.0",
+			"name": "tapTest",
+			"type": "tap",
+			"owner": 0,
+			"group": 0,
+			"vhostNet": {}
+		}`
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces[0].SocketPath).To(Equal(vhostNetDevice))
+
+			Expect(os.Remove(vhostNetDevice)).To(Succeed())
+			args.IfName = "tapifc1"
+			_, _, err = testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(ContainSubstring("is vhost_net loaded?")))
+
+			// The tap of the failed ADD is removed
+			err = targetNS.Do(func(ns.NetNS) error {
+				_, err := netlinksafe.LinkByName("tapifc1")
+				return err
+			})
+			Expect(err).To(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("requires multiQueue for several queues", func() {
+		args := &skel.CmdArgs{
+			StdinData: []byte(`{"cniVersion": "1.0.0", "name": "tapTest", "type": "tap", "vhostNet": {"queues": 2}}`),
+		}
+		_, _, err := loadConf(args)
+		Expect(err).To(MatchError("vhostNet queues 2 requires multiQueue"))
+	})
+})
+
+// pinSchedCls loads a sched_cls program returning TC_ACT_OK and pins it at
+// path
+func pinSchedCls(path string) {
+	insns := []uint64{
+		0x00000000000000b7, // r0 = 0
+		0x0000000000000095, // exit
+	}
+	license := []byte("GPL\x00")
+	load := struct {
+		progType uint32
+		insnCnt  uint32
+		insns    uint64
+		license  uint64
+	}{
+		progType: unix.BPF_PROG_TYPE_SCHED_CLS,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&load)), unsafe.Sizeof(load))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	Expect(errno).To(BeZero())
+	defer unix.Close(int(fd))
+
+	p, err := unix.BytePtrFromString(path)
+	Expect(err).NotTo(HaveOccurred())
+	pin := struct {
+		pathname uint64
+		bpfFd    uint32
+		flags    uint32
+	}{pathname: uint64(uintptr(unsafe.Pointer(p))), bpfFd: uint32(fd)}
+	_, _, errno = unix.Syscall(unix.SYS_BPF, unix.BPF_OBJ_PIN, uintptr(unsafe.Pointer(&pin)), unsafe.Sizeof(pin))
+	runtime.KeepAlive(p)
+	Expect(errno).To(BeZero())
+}
+
+var _ = Describe("tc programs", func() {
+	var (
+		originalNS, targetNS ns.NetNS
+		bpffs                string
+	)
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		bpffs, err = os.MkdirTemp("", "tap-bpffs")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unix.Mount("bpffs", bpffs, "bpf", 0, "")).To(Succeed())
+
+		pinSchedCls(filepath.Join(bpffs, "ingress"))
+		pinSchedCls(filepath.Join(bpffs, "egress"))
+	})
+
+	AfterEach(func() {
+		Expect(unix.Unmount(bpffs, 0)).To(Succeed())
+		Expect(os.RemoveAll(bpffs)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("attaches the pinned programs with ADD/CHECK/DEL", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "tapTest",
+			"type": "tap",
+			"owner": 0,
+			"group": 0,
+			"tc": {"ingress": %q, "egress": %q}
+		}`, filepath.Join(bpffs, "ingress"), filepath.Join(bpffs, "egress"))
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			for _, parent := range []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS} {
+				filters, err := netlinksafe.FilterList(link, parent)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filters).To(HaveLen(1))
+				bpf, ok := filters[0].(*netlink.BpfFilter)
+				Expect(ok).To(BeTrue())
+				Expect(bpf.DirectAction).To(BeTrue())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		checkConf := map[string]interface{}{}
+		Expect(json.Unmarshal(args.StdinData, &checkConf)).To(Succeed())
+		checkConf["prevResult"] = result
+		checkArgs := *args
+		checkArgs.StdinData, err = json.Marshal(checkConf)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdCheckWithArgs(&checkArgs, func() error {
+				return cmdCheck(&checkArgs)
+			})).To(Succeed())
+
+			// Another program pinned in place of the attached one
+			Expect(os.Remove(filepath.Join(bpffs, "egress"))).To(Succeed())
+			pinSchedCls(filepath.Join(bpffs, "egress"))
+			err := testutils.CmdCheckWithArgs(&checkArgs, func() error {
+				return cmdCheck(&checkArgs)
+			})
+			Expect(err).To(MatchError(ContainSubstring("is not attached to")))
+
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("removes the tap when a program cannot be attached", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "tapTest",
+			"type": "tap",
+			"owner": 0,
+			"group": 0,
+			"tc": {"ingress": %q}
+		}`, filepath.Join(bpffs, "missing"))
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			return err
+		})
+		Expect(err).To(MatchError(ContainSubstring("failed to open pinned program")))
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			_, err := netlinksafe.LinkByName(IFNAME)
+			return err
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("requires absolute bpffs paths", func() {
+		args := &skel.CmdArgs{
+			StdinData: []byte(`{"cniVersion": "1.0.0", "name": "tapTest", "type": "tap", "tc": {"egress": "prog"}}`),
+		}
+		_, _, err := loadConf(args)
+		Expect(err).To(MatchError(`tc program "prog" must be an absolute bpffs path`))
+	})
+})
@@ -0,0 +1,209 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"unsafe"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// tcPriority is the priority of the filters running the programs
+const tcPriority = 1
+
+// TCPrograms attaches eBPF programs pinned on a bpffs to the tap through a
+// clsact qdisc. They are attached before the tap is up, so that the VM
+// never sends or receives unfiltered traffic, and go with the tap on DEL.
+// The programs must be sched_cls programs written for direct-action mode.
+type TCPrograms struct {
+	// Ingress runs on the packets the VM sends, Egress on the packets it
+	// receives
+	Ingress string `json:"ingress,omitempty"`
+	Egress  string `json:"egress,omitempty"`
+}
+
+// hooks returns the pinned programs by clsact hook
+func (t *TCPrograms) hooks() map[uint32]string {
+	hooks := map[uint32]string{}
+	if t.Ingress != "" {
+		hooks[netlink.HANDLE_MIN_INGRESS] = t.Ingress
+	}
+	if t.Egress != "" {
+		hooks[netlink.HANDLE_MIN_EGRESS] = t.Egress
+	}
+	return hooks
+}
+
+func (t *TCPrograms) validate() error {
+	if t == nil {
+		return nil
+	}
+	if t.Ingress == "" && t.Egress == "" {
+		return fmt.Errorf("tc requires an ingress or an egress program")
+	}
+	for _, path := range []string{t.Ingress, t.Egress} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("tc program %q must be an absolute bpffs path", path)
+		}
+	}
+	return nil
+}
+
+// bpfObjGet opens the eBPF object pinned at path
+func bpfObjGet(path string) (int, error) {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	attr := struct {
+		pathname  uint64
+		bpfFd     uint32
+		fileFlags uint32
+	}{pathname: uint64(uintptr(unsafe.Pointer(p)))}
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_OBJ_GET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(p)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// bpfProgInfo is the head of struct bpf_prog_info, the kernel fills in
+// what fits
+type bpfProgInfo struct {
+	typ uint32
+	id  uint32
+}
+
+func bpfProgGetInfo(fd int) (*bpfProgInfo, error) {
+	info := &bpfProgInfo{}
+	attr := struct {
+		bpfFd   uint32
+		infoLen uint32
+		info    uint64
+	}{
+		bpfFd:   uint32(fd),
+		infoLen: uint32(unsafe.Sizeof(*info)),
+		info:    uint64(uintptr(unsafe.Pointer(info))),
+	}
+	_, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_OBJ_GET_INFO_BY_FD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(info)
+	if errno != 0 {
+		return nil, errno
+	}
+	return info, nil
+}
+
+// openTCProgram opens the program pinned at path, which must be a sched_cls
+// program, and returns its file descriptor and ID
+func openTCProgram(path string) (int, uint32, error) {
+	fd, err := bpfObjGet(path)
+	if err != nil {
+		return -1, 0, fmt.Errorf("failed to open pinned program %q: %v", path, err)
+	}
+	info, err := bpfProgGetInfo(fd)
+	if err != nil {
+		unix.Close(fd)
+		return -1, 0, fmt.Errorf("failed to get info of pinned object %q: %v", path, err)
+	}
+	if info.typ != unix.BPF_PROG_TYPE_SCHED_CLS {
+		unix.Close(fd)
+		return -1, 0, fmt.Errorf("pinned object %q is not a sched_cls program", path)
+	}
+	return fd, info.id, nil
+}
+
+// attachTCPrograms adds a clsact qdisc to the tap and attaches the programs
+// to its hooks
+func attachTCPrograms(link netlink.Link, t *TCPrograms) error {
+	if t == nil {
+		return nil
+	}
+	name := link.Attrs().Name
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscAdd(qdisc); err != nil {
+		return fmt.Errorf("failed to add clsact qdisc to %q: %v", name, err)
+	}
+
+	for parent, path := range t.hooks() {
+		fd, _, err := openTCProgram(path)
+		if err != nil {
+			return err
+		}
+		filter := &netlink.BpfFilter{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: link.Attrs().Index,
+				Parent:    parent,
+				Priority:  tcPriority,
+				Protocol:  unix.ETH_P_ALL,
+			},
+			Fd:           fd,
+			Name:         filepath.Base(path),
+			DirectAction: true,
+		}
+		err = netlink.FilterAdd(filter)
+		// The filter holds its own reference on the program
+		unix.Close(fd)
+		if err != nil {
+			return fmt.Errorf("failed to attach program %q to %q: %v", path, name, err)
+		}
+	}
+	return nil
+}
+
+// checkTCPrograms checks that the programs pinned at the configured paths
+// are attached to the tap
+func checkTCPrograms(link netlink.Link, t *TCPrograms) error {
+	if t == nil {
+		return nil
+	}
+	name := link.Attrs().Name
+	for parent, path := range t.hooks() {
+		fd, id, err := openTCProgram(path)
+		if err != nil {
+			return err
+		}
+		unix.Close(fd)
+
+		filters, err := netlinksafe.FilterList(link, parent)
+		if err != nil {
+			return fmt.Errorf("failed to list filters of %q: %v", name, err)
+		}
+		found := false
+		for _, f := range filters {
+			if bpf, ok := f.(*netlink.BpfFilter); ok && uint32(bpf.Id) == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("program %q is not attached to %q", path, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+var (
+	tunDevice      = "/dev/net/tun"
+	vhostNetDevice = "/dev/vhost-net"
+)
+
+// VhostNet prepares the tap for the vhost-net backend of a VMM. vhost-net
+// devices belong to the process that calls VHOST_SET_OWNER, which must be
+// the VMM, so the plugin opens the tap queues and the vhost-net devices
+// and hands them over to the runtime, which passes them to the VMM.
+type VhostNet struct {
+	// Queues is the number of queues, 1 by default. More queues require
+	// multiQueue.
+	Queues int `json:"queues,omitempty"`
+}
+
+// VhostNetRuntimeConfig is where the runtime receives the file descriptors
+type VhostNetRuntimeConfig struct {
+	// FDSocket is a unix socket the runtime listens on. The plugin sends
+	// the tap queue and vhost-net file descriptors over it, in a single
+	// message holding a vhostNetFDs header.
+	FDSocket string `json:"fdSocket,omitempty"`
+}
+
+// vhostNetFDs is the header of the file descriptors sent to the runtime.
+// The file descriptors alternate, tap queue then vhost-net device, for each
+// queue.
+type vhostNetFDs struct {
+	IfName string `json:"ifName"`
+	Queues int    `json:"queues"`
+}
+
+func (v *VhostNet) validate(multiQueue bool) error {
+	if v == nil {
+		return nil
+	}
+	if v.Queues < 0 {
+		return fmt.Errorf("invalid vhostNet queues %d", v.Queues)
+	}
+	if v.Queues > 1 && !multiQueue {
+		return fmt.Errorf("vhostNet queues %d requires multiQueue", v.Queues)
+	}
+	return nil
+}
+
+func (v *VhostNet) queues() int {
+	if v.Queues == 0 {
+		return 1
+	}
+	return v.Queues
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// openTapQueue attaches a queue to the tap, which must be in the current
+// network namespace. The flags must match the ones of the tap.
+func openTapQueue(ifName string, multiQueue bool) (*os.File, error) {
+	fd, err := unix.Open(tunDevice, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", tunDevice, err)
+	}
+	ifr, err := unix.NewIfreq(ifName)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	flags := uint16(unix.IFF_TAP | unix.IFF_NO_PI | unix.IFF_VNET_HDR)
+	if multiQueue {
+		flags |= unix.IFF_MULTI_QUEUE
+	}
+	ifr.SetUint16(flags)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to attach a queue to tap %q: %v", ifName, err)
+	}
+	return os.NewFile(uintptr(fd), ifName), nil
+}
+
+// openVhostNetFDs opens a tap queue and a vhost-net device per queue, in
+// the order they are sent to the runtime
+func openVhostNetFDs(ifName string, v *VhostNet, multiQueue bool) ([]*os.File, error) {
+	var files []*os.File
+	for i := 0; i < v.queues(); i++ {
+		queue, err := openTapQueue(ifName, multiQueue)
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+		files = append(files, queue)
+
+		vhost, err := os.OpenFile(vhostNetDevice, os.O_RDWR, 0)
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("failed to open %s, is vhost_net loaded? %v", vhostNetDevice, err)
+		}
+		files = append(files, vhost)
+	}
+	return files, nil
+}
+
+// sendVhostNetFDs sends the file descriptors to the runtime socket
+func sendVhostNetFDs(socket string, header *vhostNetFDs, files []*os.File) error {
+	payload, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to vhostNet fdSocket %q: %v", socket, err)
+	}
+	defer conn.Close()
+
+	fds := make([]int, 0, len(files))
+	for _, f := range files {
+		fds = append(fds, int(f.Fd()))
+	}
+	if _, _, err := conn.WriteMsgUnix(payload, unix.UnixRights(fds...), nil); err != nil {
+		return fmt.Errorf("failed to send file descriptors to %q: %v", socket, err)
+	}
+	return nil
+}
+
+// checkVhostNet checks that vhost-net is available, for the runtime to
+// open it itself when no socket receives the file descriptors
+func checkVhostNet() error {
+	f, err := os.OpenFile(vhostNetDevice, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s, is vhost_net loaded? %v", vhostNetDevice, err)
+	}
+	return f.Close()
+}
+
+// handOverVhostNet sends the tap queues and the vhost-net devices to the
+// runtime socket, or only checks vhost-net without socket. The result
+// points the runtime to the socket, or to the vhost-net device to open.
+func handOverVhostNet(conf *NetConf, ifName string, netns ns.NetNS, tap *current.Interface) error {
+	socket := ""
+	if conf.RuntimeConfig.VhostNet != nil {
+		socket = conf.RuntimeConfig.VhostNet.FDSocket
+	}
+	if socket == "" {
+		if err := checkVhostNet(); err != nil {
+			return err
+		}
+		tap.SocketPath = vhostNetDevice
+		return nil
+	}
+
+	var files []*os.File
+	err := netns.Do(func(_ ns.NetNS) error {
+		var err error
+		files, err = openVhostNetFDs(ifName, conf.VhostNet, conf.MultiQueue)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// The runtime holds its own copies once sent
+	defer closeFiles(files)
+
+	header := &vhostNetFDs{IfName: ifName, Queues: conf.VhostNet.queues()}
+	if err := sendVhostNetFDs(socket, header, files); err != nil {
+		return err
+	}
+	tap.SocketPath = socket
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const defaultDataDir = "/run/cni/vlan"
+
+// parentMTU records the MTU of a master before it was raised for the VLAN
+// of an attachment. The attachments are kept as a group named after the
+// master, and the original MTU is restored once none of them is left.
+type parentMTU struct {
+	MTU int `json:"mtu"`
+}
+
+func openParentMTUStore(dataDir string) (*attachments.Store, error) {
+	return attachments.Open(filepath.Join(dataDir, "mtu"))
+}
+
+// originalMTU returns the MTU of master recorded by the attachments, or 0
+// when none is recorded
+func originalMTU(s *attachments.Store, master string) (int, error) {
+	refs, err := s.Refs(master)
+	if err != nil || len(refs) == 0 {
+		return 0, err
+	}
+	r := &parentMTU{}
+	if _, err := s.GetJSON(master, refs[0], r); err != nil {
+		return 0, err
+	}
+	return r.MTU, nil
+}
+
+// raiseParentMTU raises the MTU of master to fit a VLAN of the given MTU,
+// recording its original MTU and the attachment. The attachment is only
+// recorded when its VLAN doesn't fit in the original MTU.
+func raiseParentMTU(dataDir, master string, mtu int, containerID, ifName string) error {
+	s, err := openParentMTUStore(dataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	m, err := netlinksafe.LinkByName(master)
+	if err != nil {
+		return fmt.Errorf("failed to lookup master %q: %v", master, err)
+	}
+	original, err := originalMTU(s, master)
+	if err != nil {
+		return err
+	}
+	raised := original != 0
+	if !raised {
+		original = m.Attrs().MTU
+	}
+	if mtu <= original {
+		return nil
+	}
+
+	if mtu > m.Attrs().MTU {
+		if err := netlink.LinkSetMTU(m, mtu); err != nil {
+			return fmt.Errorf("failed to raise the MTU of master %q to %d: %v", master, mtu, err)
+		}
+	}
+	if err := s.PutJSON(master, attachments.ID(containerID, ifName), &parentMTU{MTU: original}); err != nil {
+		if !raised {
+			_ = netlink.LinkSetMTU(m, original)
+		}
+		return fmt.Errorf("failed to record the MTU of master %q: %v", master, err)
+	}
+	return nil
+}
+
+// releaseParentMTU drops the attachment from the record of master, and
+// restores the original MTU of master once no attachment is left
+func releaseParentMTU(dataDir, master, containerID, ifName string) error {
+	s, err := openParentMTUStore(dataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	id := attachments.ID(containerID, ifName)
+	r := &parentMTU{}
+	found, err := s.GetJSON(master, id, r)
+	if err != nil || !found {
+		return err
+	}
+	left, err := s.Remove(master, id)
+	if err != nil || left > 0 {
+		return err
+	}
+
+	m, err := netlinksafe.LinkByName(master)
+	if err == nil {
+		if err := netlink.LinkSetMTU(m, r.MTU); err != nil {
+			return fmt.Errorf("failed to restore the MTU of master %q to %d: %v", master, r.MTU, err)
+		}
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return fmt.Errorf("failed to lookup master %q: %v", master, err)
+	}
+	// A master deleted meanwhile has nothing to restore
+	return nil
+}
@@ -18,13 +18,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/vishvananda/netlink"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
+	cniutils "github.com/containernetworking/cni/pkg/utils"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ipam"
@@ -39,6 +43,59 @@ type NetConf struct {
 	VlanID     int    `json:"vlanId"`
 	MTU        int    `json:"mtu,omitempty"`
 	LinkContNs bool   `json:"linkInContainer,omitempty"`
+
+	// AllowedVlanIDs lists the VLAN IDs, or ranges of IDs such as
+	// "100-199", that may be selected at runtime instead of vlanId
+	AllowedVlanIDs []string `json:"allowedVlanIds,omitempty"`
+
+	RuntimeConfig struct {
+		VlanID *int `json:"vlanId,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+
+	// Protocol is the protocol of the VLAN, "802.1Q" (the default) or
+	// "802.1ad" for a service VLAN
+	Protocol string `json:"protocol,omitempty"`
+	// OuterVlanID stacks the VLAN on the 802.1ad service VLAN of that ID on
+	// master, named <master>.<outerVlanId>. The service VLAN is created on
+	// first use and shared by all the attachments, so it is never deleted.
+	OuterVlanID int `json:"outerVlanId,omitempty"`
+
+	// IngressQosMap maps the 802.1p priority (PCP) of the received frames
+	// to the priority of the packets, EgressQosMap the priority of the
+	// packets sent to the PCP of the frames
+	IngressQosMap map[uint32]uint32 `json:"ingressQosMap,omitempty"`
+	EgressQosMap  map[uint32]uint32 `json:"egressQosMap,omitempty"`
+
+	Flags *VlanFlags `json:"flags,omitempty"`
+
+	// AdjustParentMTU raises the MTU of master when mtu exceeds it, instead
+	// of failing. The original MTU is restored once no VLAN needs it.
+	AdjustParentMTU bool   `json:"adjustParentMTU,omitempty"`
+	DataDir         string `json:"dataDir,omitempty"`
+}
+
+// VlanFlags are the flags of the VLAN interface. Unset flags keep the
+// kernel defaults, where only reorderHdr is enabled.
+type VlanFlags struct {
+	// ReorderHdr presents the received frames to the stack as untagged
+	ReorderHdr *bool `json:"reorderHdr,omitempty"`
+	// Gvrp and Mvrp register the VLAN with the switch through GVRP and MVRP
+	Gvrp *bool `json:"gvrp,omitempty"`
+	Mvrp *bool `json:"mvrp,omitempty"`
+	// LooseBinding keeps the operational state of the VLAN independent of
+	// the one of master
+	LooseBinding *bool `json:"looseBinding,omitempty"`
+}
+
+const (
+	protocol8021Q  = "802.1Q"
+	protocol8021AD = "802.1ad"
+)
+
+// VlanEnvArgs represents CNI_ARG
+type VlanEnvArgs struct {
+	types.CommonArgs
+	VLAN types.UnmarshallableString `json:"vlan,omitempty"`
 }
 
 func init() {
@@ -56,21 +113,193 @@ func loadConf(args *skel.CmdArgs) (*NetConf, string, error) {
 	if n.Master == "" {
 		return nil, "", fmt.Errorf("\"master\" field is required. It specifies the host interface name to create the VLAN for")
 	}
+	if err := selectVlanID(n, args.Args); err != nil {
+		return nil, "", err
+	}
 	if n.VlanID < 0 || n.VlanID > 4094 {
 		return nil, "", fmt.Errorf("invalid VLAN ID %d (must be between 0 and 4095 inclusive)", n.VlanID)
 	}
+	if err := validateProtocol(n); err != nil {
+		return nil, "", err
+	}
+	if err := validateQosMaps(n); err != nil {
+		return nil, "", err
+	}
 
 	// check existing and MTU of master interface
 	masterMTU, err := getMTUByName(n.Master, args.Netns, n.LinkContNs)
 	if err != nil {
 		return nil, "", err
 	}
-	if n.MTU < 0 || n.MTU > masterMTU {
+	if n.MTU < 0 || (n.MTU > masterMTU && !n.AdjustParentMTU) {
 		return nil, "", fmt.Errorf("invalid MTU %d, must be [0, master MTU(%d)]", n.MTU, masterMTU)
 	}
+	if n.AdjustParentMTU && (n.LinkContNs || n.OuterVlanID != 0) {
+		return nil, "", fmt.Errorf("adjustParentMTU only applies to a master in the host namespace without outerVlanId")
+	}
+	if n.DataDir == "" {
+		n.DataDir = defaultDataDir
+	}
 	return n, n.CNIVersion, nil
 }
 
+// selectVlanID overrides vlanId with the ID selected at runtime, through
+// runtimeConfig or else CNI_ARGS, provided it is allowed by allowedVlanIds
+func selectVlanID(n *NetConf, envArgs string) error {
+	var selected *int
+	if envArgs != "" {
+		e := VlanEnvArgs{}
+		if err := types.LoadArgs(envArgs, &e); err != nil {
+			return err
+		}
+		if e.VLAN != "" {
+			id, err := strconv.Atoi(string(e.VLAN))
+			if err != nil {
+				return fmt.Errorf("invalid VLAN ID %q in CNI_ARGS", e.VLAN)
+			}
+			selected = &id
+		}
+	}
+	if n.RuntimeConfig.VlanID != nil {
+		selected = n.RuntimeConfig.VlanID
+	}
+	if selected == nil {
+		return nil
+	}
+
+	if len(n.AllowedVlanIDs) == 0 {
+		return fmt.Errorf("VLAN ID %d selected at runtime but no allowedVlanIds configured", *selected)
+	}
+	allowed, err := vlanIDAllowed(*selected, n.AllowedVlanIDs)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("VLAN ID %d is not allowed, must be one of %v", *selected, n.AllowedVlanIDs)
+	}
+	n.VlanID = *selected
+	return nil
+}
+
+func vlanIDAllowed(id int, allowed []string) (bool, error) {
+	for _, a := range allowed {
+		first, last, isRange := strings.Cut(a, "-")
+		low, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return false, fmt.Errorf("invalid allowedVlanIds entry %q", a)
+		}
+		high := low
+		if isRange {
+			if high, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || high < low {
+				return false, fmt.Errorf("invalid allowedVlanIds entry %q", a)
+			}
+		}
+		if id >= low && id <= high {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func validateProtocol(n *NetConf) error {
+	switch n.Protocol {
+	case "", protocol8021Q:
+	case protocol8021AD:
+		if n.OuterVlanID != 0 {
+			return fmt.Errorf("an %s VLAN can't be stacked on outerVlanId", protocol8021AD)
+		}
+	default:
+		return fmt.Errorf("invalid protocol %q, must be %s or %s", n.Protocol, protocol8021Q, protocol8021AD)
+	}
+	if n.OuterVlanID < 0 || n.OuterVlanID > 4094 {
+		return fmt.Errorf("invalid outer VLAN ID %d (must be between 1 and 4094 inclusive)", n.OuterVlanID)
+	}
+	return nil
+}
+
+// maxPCP is the highest 802.1p priority code point
+const maxPCP = 7
+
+func validateQosMaps(n *NetConf) error {
+	for pcp := range n.IngressQosMap {
+		if pcp > maxPCP {
+			return fmt.Errorf("invalid ingressQosMap priority code point %d, must be [0, %d]", pcp, maxPCP)
+		}
+	}
+	for _, pcp := range n.EgressQosMap {
+		if pcp > maxPCP {
+			return fmt.Errorf("invalid egressQosMap priority code point %d, must be [0, %d]", pcp, maxPCP)
+		}
+	}
+	return nil
+}
+
+// qosMapsEqual compares a configured QoS map with the one of a link. The
+// kernel only reports the mappings to a non-zero priority.
+func qosMapsEqual(configured, actual map[uint32]uint32) bool {
+	for from, to := range configured {
+		if to != actual[from] {
+			return false
+		}
+	}
+	for from, to := range actual {
+		if to != configured[from] {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *NetConf) vlanProtocol() netlink.VlanProtocol {
+	if n.Protocol == protocol8021AD {
+		return netlink.VLAN_PROTOCOL_8021AD
+	}
+	return netlink.VLAN_PROTOCOL_8021Q
+}
+
+func outerVlanName(master string, outerVlanID int) string {
+	return fmt.Sprintf("%s.%d", master, outerVlanID)
+}
+
+// ensureOuterVlan returns the 802.1ad service VLAN of master, creating it
+// if it does not exist yet. It must be called in the namespace of master.
+func ensureOuterVlan(master netlink.Link, outerVlanID int) (netlink.Link, error) {
+	name := outerVlanName(master.Attrs().Name, outerVlanID)
+	if err := cniutils.ValidateInterfaceName(name); err != nil {
+		return nil, fmt.Errorf("invalid outer VLAN name %q: %v", name, err)
+	}
+
+	link, err := netlinksafe.LinkByName(name)
+	if _, ok := err.(netlink.LinkNotFoundError); ok {
+		linkAttrs := netlink.NewLinkAttrs()
+		linkAttrs.Name = name
+		linkAttrs.ParentIndex = master.Attrs().Index
+		err = netlink.LinkAdd(&netlink.Vlan{
+			LinkAttrs:    linkAttrs,
+			VlanId:       outerVlanID,
+			VlanProtocol: netlink.VLAN_PROTOCOL_8021AD,
+		})
+		// Another attachment may have created it concurrently
+		if err != nil && !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create outer vlan %q: %v", name, err)
+		}
+		link, err = netlinksafe.LinkByName(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup outer vlan %q: %v", name, err)
+	}
+
+	outer, ok := link.(*netlink.Vlan)
+	if !ok || outer.VlanId != outerVlanID || outer.VlanProtocol != netlink.VLAN_PROTOCOL_8021AD ||
+		outer.ParentIndex != master.Attrs().Index {
+		return nil, fmt.Errorf("interface %q exists but is not the %s VLAN %d of %q", name, protocol8021AD, outerVlanID, master.Attrs().Name)
+	}
+	if err := netlink.LinkSetUp(outer); err != nil {
+		return nil, fmt.Errorf("failed to set %q up: %v", name, err)
+	}
+	return outer, nil
+}
+
 func getMTUByName(ifName string, namespace string, inContainer bool) (int, error) {
 	var link netlink.Link
 	var err error
@@ -100,17 +329,25 @@ func createVlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interfac
 
 	var m netlink.Link
 	var err error
+	lookupMaster := func() error {
+		m, err = netlinksafe.LinkByName(conf.Master)
+		if err != nil {
+			return fmt.Errorf("failed to lookup master %q: %v", conf.Master, err)
+		}
+		if conf.OuterVlanID != 0 {
+			m, err = ensureOuterVlan(m, conf.OuterVlanID)
+		}
+		return err
+	}
 	if conf.LinkContNs {
 		err = netns.Do(func(_ ns.NetNS) error {
-			m, err = netlinksafe.LinkByName(conf.Master)
-			return err
+			return lookupMaster()
 		})
 	} else {
-		m, err = netlinksafe.LinkByName(conf.Master)
+		err = lookupMaster()
 	}
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to lookup master %q: %v", conf.Master, err)
+		return nil, err
 	}
 
 	// due to kernel bug we have to create with tmpname or it might
@@ -127,8 +364,17 @@ func createVlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interfac
 	linkAttrs.Namespace = netlink.NsFd(int(netns.Fd()))
 
 	v := &netlink.Vlan{
-		LinkAttrs: linkAttrs,
-		VlanId:    conf.VlanID,
+		LinkAttrs:     linkAttrs,
+		VlanId:        conf.VlanID,
+		VlanProtocol:  conf.vlanProtocol(),
+		IngressQosMap: conf.IngressQosMap,
+		EgressQosMap:  conf.EgressQosMap,
+	}
+	if conf.Flags != nil {
+		v.ReorderHdr = conf.Flags.ReorderHdr
+		v.Gvrp = conf.Flags.Gvrp
+		v.Mvrp = conf.Flags.Mvrp
+		v.LooseBinding = conf.Flags.LooseBinding
 	}
 
 	if conf.LinkContNs {
@@ -166,7 +412,16 @@ func createVlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interfac
 	return vlan, nil
 }
 
-func cmdAdd(args *skel.CmdArgs) error {
+// restoreParentMTU releases the MTU of master raised for the VLAN of the
+// attachment, if any
+func (n *NetConf) restoreParentMTU(containerID, ifName string) error {
+	if !n.AdjustParentMTU {
+		return nil
+	}
+	return releaseParentMTU(n.DataDir, n.Master, containerID, ifName)
+}
+
+func cmdAdd(args *skel.CmdArgs) (err error) {
 	n, cniVersion, err := loadConf(args)
 	if err != nil {
 		return err
@@ -178,6 +433,17 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	defer netns.Close()
 
+	if n.AdjustParentMTU && n.MTU > 0 {
+		if err := raiseParentMTU(n.DataDir, n.Master, n.MTU, args.ContainerID, args.IfName); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = n.restoreParentMTU(args.ContainerID, args.IfName)
+			}
+		}()
+	}
+
 	vlanInterface, err := createVlan(n, args.IfName, netns)
 	if err != nil {
 		return err
@@ -186,7 +452,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 	// run the IPAM plugin and get back the config to apply
 	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
 	if err != nil {
-		return fmt.Errorf("failed to execute IPAM delegate: %v", err)
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
 	}
 
 	// Invoke ipam del if err to avoid ip leak
@@ -236,7 +502,7 @@ func cmdDel(args *skel.CmdArgs) error {
 	}
 
 	if args.Netns == "" {
-		return nil
+		return n.restoreParentMTU(args.ContainerID, args.IfName)
 	}
 
 	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
@@ -252,12 +518,12 @@ func cmdDel(args *skel.CmdArgs) error {
 		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
 		_, ok := err.(ns.NSPathNotExistErr)
 		if ok {
-			return nil
+			return n.restoreParentMTU(args.ContainerID, args.IfName)
 		}
 		return err
 	}
 
-	return err
+	return n.restoreParentMTU(args.ContainerID, args.IfName)
 }
 
 func main() {
@@ -275,6 +541,15 @@ func cmdCheck(args *skel.CmdArgs) error {
 	if err := json.Unmarshal(args.StdinData, &conf); err != nil {
 		return fmt.Errorf("failed to load netconf: %v", err)
 	}
+	if err := selectVlanID(&conf, args.Args); err != nil {
+		return err
+	}
+	if err := validateProtocol(&conf); err != nil {
+		return err
+	}
+	if err := validateQosMaps(&conf); err != nil {
+		return err
+	}
 
 	netns, err := ns.GetNS(args.Netns)
 	if err != nil {
@@ -316,24 +591,33 @@ func cmdCheck(args *skel.CmdArgs) error {
 			contMap.Sandbox, args.Netns)
 	}
 
+	master := conf.Master
+	if conf.OuterVlanID != 0 {
+		master = outerVlanName(conf.Master, conf.OuterVlanID)
+	}
 	if conf.LinkContNs {
 		err = netns.Do(func(_ ns.NetNS) error {
-			_, err = netlinksafe.LinkByName(conf.Master)
+			_, err = netlinksafe.LinkByName(master)
 			return err
 		})
 	} else {
-		_, err = netlinksafe.LinkByName(conf.Master)
+		_, err = netlinksafe.LinkByName(master)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to lookup master %q: %v", conf.Master, err)
+		return fmt.Errorf("failed to lookup master %q: %v", master, err)
 	}
 
 	//
 	// Check prevResults for ips, routes and dns against values found in the container
 	if err := netns.Do(func(_ ns.NetNS) error {
 		// Check interface against values found in the container
-		err := validateCniContainerInterface(contMap, conf.VlanID, conf.MTU)
+		err := validateCniContainerInterface(contMap, conf.VlanID, conf.vlanProtocol(), conf.MTU, conf.IngressQosMap, conf.EgressQosMap)
+		if err != nil {
+			return err
+		}
+
+		err = validateVlanFlags(contMap.Name, conf.Flags)
 		if err != nil {
 			return err
 		}
@@ -355,7 +639,7 @@ func cmdCheck(args *skel.CmdArgs) error {
 	return nil
 }
 
-func validateCniContainerInterface(intf current.Interface, vlanID int, mtu int) error {
+func validateCniContainerInterface(intf current.Interface, vlanID int, protocol netlink.VlanProtocol, mtu int, ingressQosMap, egressQosMap map[uint32]uint32) error {
 	var link netlink.Link
 	var err error
 
@@ -391,6 +675,11 @@ func validateCniContainerInterface(intf current.Interface, vlanID int, mtu int)
 			intf.Name, vlanID, vlan.VlanId)
 	}
 
+	if protocol != vlan.VlanProtocol {
+		return fmt.Errorf("vlan: Interface %s protocol %s doesn't match configured protocol %s",
+			intf.Name, vlan.VlanProtocol, protocol)
+	}
+
 	if mtu != 0 {
 		if mtu != link.Attrs().MTU {
 			return fmt.Errorf("Error: Tuning configured MTU of %s is %d, current value is %d",
@@ -398,6 +687,47 @@ func validateCniContainerInterface(intf current.Interface, vlanID int, mtu int)
 		}
 	}
 
+	if !qosMapsEqual(ingressQosMap, vlan.IngressQosMap) {
+		return fmt.Errorf("vlan: Interface %s ingress QoS map %v doesn't match configured map %v",
+			intf.Name, vlan.IngressQosMap, ingressQosMap)
+	}
+	if !qosMapsEqual(egressQosMap, vlan.EgressQosMap) {
+		return fmt.Errorf("vlan: Interface %s egress QoS map %v doesn't match configured map %v",
+			intf.Name, vlan.EgressQosMap, egressQosMap)
+	}
+
+	return nil
+}
+
+func validateVlanFlags(ifName string, flags *VlanFlags) error {
+	if flags == nil {
+		return nil
+	}
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("vlan: Container Interface name in prevResult: %s not found", ifName)
+	}
+	vlan, isVlan := link.(*netlink.Vlan)
+	if !isVlan {
+		return fmt.Errorf("Error: Container interface %s not of type vlan", ifName)
+	}
+	for _, f := range []struct {
+		name       string
+		configured *bool
+		actual     *bool
+	}{
+		{"reorderHdr", flags.ReorderHdr, vlan.ReorderHdr},
+		{"gvrp", flags.Gvrp, vlan.Gvrp},
+		{"mvrp", flags.Mvrp, vlan.Mvrp},
+		{"looseBinding", flags.LooseBinding, vlan.LooseBinding},
+	} {
+		if f.configured == nil {
+			continue
+		}
+		if f.actual == nil || *f.actual != *f.configured {
+			return fmt.Errorf("vlan: Interface %s flag %s doesn't match configured value %v", ifName, f.name, *f.configured)
+		}
+	}
 	return nil
 }
 
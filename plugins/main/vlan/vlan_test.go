@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -323,6 +324,156 @@ var _ = Describe("vlan Operations", func() {
 				Expect(err).NotTo(HaveOccurred())
 			})
 
+			It(fmt.Sprintf("[%s] stacks a vlan link on an 802.1ad outer vlan", ver), func() {
+				conf := &NetConf{
+					NetConf: types.NetConf{
+						CNIVersion: ver,
+						Name:       "testConfig",
+						Type:       "vlan",
+					},
+					Master:      masterInterface,
+					VlanID:      33,
+					OuterVlanID: 100,
+					LinkContNs:  isInContainer,
+				}
+
+				otherNs := originalNS
+				if isInContainer {
+					otherNs = targetNS
+				}
+
+				// The outer vlan is shared by the attachments
+				for _, ifName := range []string{"foobar0", "foobar1"} {
+					err := originalNS.Do(func(ns.NetNS) error {
+						defer GinkgoRecover()
+
+						_, err := createVlan(conf, ifName, targetNS)
+						Expect(err).NotTo(HaveOccurred())
+						return nil
+					})
+					Expect(err).NotTo(HaveOccurred())
+					conf.VlanID++
+				}
+
+				var outerIndex int
+				err := otherNs.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					m, err := netlinksafe.LinkByName(masterInterface)
+					Expect(err).NotTo(HaveOccurred())
+					link, err := netlinksafe.LinkByName(masterInterface + ".100")
+					Expect(err).NotTo(HaveOccurred())
+					outer, ok := link.(*netlink.Vlan)
+					Expect(ok).To(BeTrue())
+					Expect(outer.VlanId).To(Equal(100))
+					Expect(outer.VlanProtocol).To(Equal(netlink.VLAN_PROTOCOL_8021AD))
+					Expect(outer.ParentIndex).To(Equal(m.Attrs().Index))
+					outerIndex = outer.Index
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = targetNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					link, err := netlinksafe.LinkByName("foobar0")
+					Expect(err).NotTo(HaveOccurred())
+					inner, ok := link.(*netlink.Vlan)
+					Expect(ok).To(BeTrue())
+					Expect(inner.VlanId).To(Equal(33))
+					Expect(inner.VlanProtocol).To(Equal(netlink.VLAN_PROTOCOL_8021Q))
+					if isInContainer {
+						Expect(inner.ParentIndex).To(Equal(outerIndex))
+					}
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It(fmt.Sprintf("[%s] creates a vlan link with priority mappings", ver), func() {
+				conf := &NetConf{
+					NetConf: types.NetConf{
+						CNIVersion: ver,
+						Name:       "testConfig",
+						Type:       "vlan",
+					},
+					Master:        masterInterface,
+					VlanID:        33,
+					LinkContNs:    isInContainer,
+					IngressQosMap: map[uint32]uint32{5: 2, 7: 6},
+					EgressQosMap:  map[uint32]uint32{2: 5, 6: 7},
+				}
+
+				err := originalNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					_, err := createVlan(conf, "foobar0", targetNS)
+					Expect(err).NotTo(HaveOccurred())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = targetNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					link, err := netlinksafe.LinkByName("foobar0")
+					Expect(err).NotTo(HaveOccurred())
+					vlan, ok := link.(*netlink.Vlan)
+					Expect(ok).To(BeTrue())
+					Expect(qosMapsEqual(conf.IngressQosMap, vlan.IngressQosMap)).To(BeTrue())
+					Expect(qosMapsEqual(conf.EgressQosMap, vlan.EgressQosMap)).To(BeTrue())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It(fmt.Sprintf("[%s] creates a vlan link with flags", ver), func() {
+				enabled, disabled := true, false
+				conf := &NetConf{
+					NetConf: types.NetConf{
+						CNIVersion: ver,
+						Name:       "testConfig",
+						Type:       "vlan",
+					},
+					Master:     masterInterface,
+					VlanID:     33,
+					LinkContNs: isInContainer,
+					Flags: &VlanFlags{
+						ReorderHdr:   &disabled,
+						Mvrp:         &enabled,
+						LooseBinding: &enabled,
+					},
+				}
+
+				err := originalNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					_, err := createVlan(conf, "foobar0", targetNS)
+					Expect(err).NotTo(HaveOccurred())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = targetNS.Do(func(ns.NetNS) error {
+					defer GinkgoRecover()
+
+					link, err := netlinksafe.LinkByName("foobar0")
+					Expect(err).NotTo(HaveOccurred())
+					vlan, ok := link.(*netlink.Vlan)
+					Expect(ok).To(BeTrue())
+					Expect(*vlan.ReorderHdr).To(BeFalse())
+					Expect(*vlan.Mvrp).To(BeTrue())
+					Expect(*vlan.LooseBinding).To(BeTrue())
+					Expect(*vlan.Gvrp).To(BeFalse())
+					Expect(validateVlanFlags("foobar0", conf.Flags)).To(Succeed())
+
+					conf.Flags.Gvrp = &enabled
+					Expect(validateVlanFlags("foobar0", conf.Flags)).To(HaveOccurred())
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
 			It(fmt.Sprintf("[%s] configures and deconfigures a vlan link with ADD/CHECK/DEL", ver), func() {
 				const IFNAME = "ethX"
 
@@ -542,3 +693,202 @@ var _ = Describe("vlan Operations", func() {
 		}
 	}
 })
+
+var _ = Describe("vlan runtime VLAN ID selection", func() {
+	newConf := func(allowed ...string) *NetConf {
+		return &NetConf{VlanID: 10, AllowedVlanIDs: allowed}
+	}
+
+	It("keeps vlanId when nothing is selected at runtime", func() {
+		n := newConf()
+		Expect(selectVlanID(n, "")).To(Succeed())
+		Expect(n.VlanID).To(Equal(10))
+	})
+
+	It("selects an allowed VLAN ID from runtimeConfig", func() {
+		n := newConf("100-199", "300")
+		n.RuntimeConfig.VlanID = new(int)
+		*n.RuntimeConfig.VlanID = 150
+		Expect(selectVlanID(n, "")).To(Succeed())
+		Expect(n.VlanID).To(Equal(150))
+	})
+
+	It("selects an allowed VLAN ID from CNI_ARGS", func() {
+		n := newConf("100-199", "300")
+		Expect(selectVlanID(n, "IgnoreUnknown=1;VLAN=300")).To(Succeed())
+		Expect(n.VlanID).To(Equal(300))
+	})
+
+	It("prefers runtimeConfig over CNI_ARGS", func() {
+		n := newConf("100-199")
+		n.RuntimeConfig.VlanID = new(int)
+		*n.RuntimeConfig.VlanID = 101
+		Expect(selectVlanID(n, "VLAN=102")).To(Succeed())
+		Expect(n.VlanID).To(Equal(101))
+	})
+
+	It("rejects a VLAN ID outside of allowedVlanIds", func() {
+		n := newConf("100-199", "300")
+		err := selectVlanID(n, "VLAN=200")
+		Expect(err).To(MatchError("VLAN ID 200 is not allowed, must be one of [100-199 300]"))
+	})
+
+	It("rejects a runtime VLAN ID without allowedVlanIds", func() {
+		n := newConf()
+		err := selectVlanID(n, "VLAN=200")
+		Expect(err).To(MatchError("VLAN ID 200 selected at runtime but no allowedVlanIds configured"))
+	})
+
+	It("rejects an invalid allowedVlanIds entry", func() {
+		n := newConf("199-100")
+		err := selectVlanID(n, "VLAN=150")
+		Expect(err).To(MatchError(`invalid allowedVlanIds entry "199-100"`))
+	})
+})
+
+var _ = Describe("vlan protocol validation", func() {
+	It("defaults to 802.1Q", func() {
+		n := &NetConf{}
+		Expect(validateProtocol(n)).To(Succeed())
+		Expect(n.vlanProtocol()).To(Equal(netlink.VLAN_PROTOCOL_8021Q))
+	})
+
+	It("accepts 802.1ad", func() {
+		n := &NetConf{Protocol: "802.1ad"}
+		Expect(validateProtocol(n)).To(Succeed())
+		Expect(n.vlanProtocol()).To(Equal(netlink.VLAN_PROTOCOL_8021AD))
+	})
+
+	It("rejects an unknown protocol", func() {
+		n := &NetConf{Protocol: "802.1x"}
+		Expect(validateProtocol(n)).To(MatchError(`invalid protocol "802.1x", must be 802.1Q or 802.1ad`))
+	})
+
+	It("rejects an 802.1ad vlan stacked on an outer vlan", func() {
+		n := &NetConf{Protocol: "802.1ad", OuterVlanID: 100}
+		Expect(validateProtocol(n)).To(MatchError("an 802.1ad VLAN can't be stacked on outerVlanId"))
+	})
+
+	It("rejects an invalid outer VLAN ID", func() {
+		n := &NetConf{OuterVlanID: 4095}
+		Expect(validateProtocol(n)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("vlan QoS maps", func() {
+	It("parses the maps from the configuration", func() {
+		n := &NetConf{}
+		Expect(json.Unmarshal([]byte(`{"ingressQosMap": {"5": 2}, "egressQosMap": {"2": 5}}`), n)).To(Succeed())
+		Expect(n.IngressQosMap).To(Equal(map[uint32]uint32{5: 2}))
+		Expect(n.EgressQosMap).To(Equal(map[uint32]uint32{2: 5}))
+		Expect(validateQosMaps(n)).To(Succeed())
+	})
+
+	It("rejects an invalid priority code point", func() {
+		Expect(validateQosMaps(&NetConf{IngressQosMap: map[uint32]uint32{8: 1}})).To(
+			MatchError("invalid ingressQosMap priority code point 8, must be [0, 7]"))
+		Expect(validateQosMaps(&NetConf{EgressQosMap: map[uint32]uint32{1: 8}})).To(
+			MatchError("invalid egressQosMap priority code point 8, must be [0, 7]"))
+	})
+
+	It("ignores the mappings to priority 0 when comparing", func() {
+		Expect(qosMapsEqual(map[uint32]uint32{1: 0, 2: 3}, map[uint32]uint32{2: 3})).To(BeTrue())
+		Expect(qosMapsEqual(nil, nil)).To(BeTrue())
+		Expect(qosMapsEqual(map[uint32]uint32{2: 3}, map[uint32]uint32{2: 4})).To(BeFalse())
+		Expect(qosMapsEqual(nil, map[uint32]uint32{2: 3})).To(BeFalse())
+	})
+})
+
+var _ = Describe("vlan parent MTU adjustment", func() {
+	var originalNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "vlan_mtu_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = MASTER_NAME
+			linkAttrs.MTU = 1500
+			return netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: "peer0"})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+	})
+
+	masterMTU := func() int {
+		link, err := netlinksafe.LinkByName(MASTER_NAME)
+		Expect(err).NotTo(HaveOccurred())
+		return link.Attrs().MTU
+	}
+
+	It("accepts an MTU larger than master's", func() {
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			conf := fmt.Sprintf(`{"name": "mynet", "master": %q, "vlanId": 100, "mtu": 9000, "adjustParentMTU": %%t}`, MASTER_NAME)
+			n, _, err := loadConf(&skel.CmdArgs{StdinData: []byte(fmt.Sprintf(conf, true))})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n.DataDir).To(Equal(defaultDataDir))
+			_, _, err = loadConf(&skel.CmdArgs{StdinData: []byte(fmt.Sprintf(conf, false))})
+			Expect(err).To(MatchError("invalid MTU 9000, must be [0, master MTU(1500)]"))
+
+			conf = fmt.Sprintf(`{"name": "mynet", "master": %q, "vlanId": 100, "outerVlanId": 10, "adjustParentMTU": true}`, MASTER_NAME)
+			_, _, err = loadConf(&skel.CmdArgs{StdinData: []byte(conf)})
+			Expect(err).To(MatchError(ContainSubstring("adjustParentMTU only applies")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("restores the MTU of master once the last VLAN needing it is gone", func() {
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(raiseParentMTU(dataDir, MASTER_NAME, 9000, "c1", "net1")).To(Succeed())
+			Expect(masterMTU()).To(Equal(9000))
+			Expect(raiseParentMTU(dataDir, MASTER_NAME, 4000, "c2", "net1")).To(Succeed())
+			Expect(masterMTU()).To(Equal(9000))
+			// A VLAN fitting in the original MTU does not hold it
+			Expect(raiseParentMTU(dataDir, MASTER_NAME, 1400, "c3", "net1")).To(Succeed())
+
+			Expect(releaseParentMTU(dataDir, MASTER_NAME, "c3", "net1")).To(Succeed())
+			Expect(releaseParentMTU(dataDir, MASTER_NAME, "c1", "net1")).To(Succeed())
+			Expect(masterMTU()).To(Equal(9000))
+			// DEL may be called multiple times
+			Expect(releaseParentMTU(dataDir, MASTER_NAME, "c1", "net1")).To(Succeed())
+			Expect(masterMTU()).To(Equal(9000))
+
+			Expect(releaseParentMTU(dataDir, MASTER_NAME, "c2", "net1")).To(Succeed())
+			Expect(masterMTU()).To(Equal(1500))
+			Expect(filepath.Join(dataDir, "mtu", MASTER_NAME)).NotTo(BeADirectory())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("forgets the MTU of a deleted master", func() {
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(raiseParentMTU(dataDir, MASTER_NAME, 9000, "c1", "net1")).To(Succeed())
+			link, err := netlinksafe.LinkByName(MASTER_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkDel(link)).To(Succeed())
+
+			Expect(releaseParentMTU(dataDir, MASTER_NAME, "c1", "net1")).To(Succeed())
+			Expect(filepath.Join(dataDir, "mtu", MASTER_NAME)).NotTo(BeADirectory())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,610 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating a VXLAN device in the container, attaching it
+// to an overlay whose tunnel endpoint is the host.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	// defaultDstPort is the IANA assigned VXLAN port
+	defaultDstPort = 4789
+	maxVNI         = 1<<24 - 1
+
+	// The encapsulation overhead: outer Ethernet, IP, UDP and VXLAN headers
+	overheadIPv4 = 50
+	overheadIPv6 = 70
+)
+
+type NetConf struct {
+	types.NetConf
+	// VNI is the VXLAN network identifier
+	VNI int `json:"vni"`
+	// Remote is the unicast address of the remote endpoint, Group the
+	// multicast group the device joins. Without either, the packets are
+	// sent to the endpoints of the FDB entries.
+	Remote string `json:"remote,omitempty"`
+	Group  string `json:"group,omitempty"`
+	// Local is the source address of the encapsulated packets
+	Local string `json:"local,omitempty"`
+	// DstPort is the UDP port of the remote endpoints, 4789 by default
+	DstPort int `json:"dstPort,omitempty"`
+	// Master is the host underlay device. It defaults to the device of the
+	// route to the remote, the group or the first FDB entry.
+	Master string `json:"master,omitempty"`
+	// MTU defaults to the MTU of the underlay device minus the overhead
+	MTU int `json:"mtu,omitempty"`
+	TTL int `json:"ttl,omitempty"`
+	// Learning fills the FDB from the received packets
+	Learning bool `json:"learning,omitempty"`
+	// FDB are static forwarding entries added to the device
+	FDB []FDBEntry `json:"fdb,omitempty"`
+
+	remote, group, local net.IP
+}
+
+// FDBEntry forwards the frames to a MAC to a remote endpoint. Without MAC,
+// the frames to unknown or broadcast MACs are replicated to every endpoint
+// of such entries.
+type FDBEntry struct {
+	Mac string `json:"mac,omitempty"`
+	Dst string `json:"dst"`
+
+	mac net.HardwareAddr
+	dst net.IP
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func parseIP(field, s string) (net.IP, error) {
+	if s == "" {
+		return nil, nil
+	}
+	addr := net.ParseIP(s)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid %s address %q", field, s)
+	}
+	return addr, nil
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	if n.VNI <= 0 || n.VNI > maxVNI {
+		return nil, fmt.Errorf("invalid VNI %d, must be [1, %d]", n.VNI, maxVNI)
+	}
+	if n.DstPort == 0 {
+		n.DstPort = defaultDstPort
+	}
+	if n.DstPort < 0 || n.DstPort > 65535 {
+		return nil, fmt.Errorf("invalid dstPort %d", n.DstPort)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	if n.TTL < 0 || n.TTL > 255 {
+		return nil, fmt.Errorf("invalid TTL %d, must be [0, 255]", n.TTL)
+	}
+
+	var err error
+	if n.remote, err = parseIP("remote", n.Remote); err != nil {
+		return nil, err
+	}
+	if n.group, err = parseIP("group", n.Group); err != nil {
+		return nil, err
+	}
+	if n.local, err = parseIP("local", n.Local); err != nil {
+		return nil, err
+	}
+	if n.remote != nil && n.group != nil {
+		return nil, fmt.Errorf("remote and group are mutually exclusive")
+	}
+	if n.remote != nil && n.remote.IsMulticast() {
+		return nil, fmt.Errorf("remote %s is a multicast address, use group", n.remote)
+	}
+	if n.group != nil && !n.group.IsMulticast() {
+		return nil, fmt.Errorf("group %s is not a multicast address", n.group)
+	}
+
+	addrs := []net.IP{n.remote, n.group, n.local}
+	for i := range n.FDB {
+		e := &n.FDB[i]
+		if e.dst, err = parseIP("fdb dst", e.Dst); err != nil {
+			return nil, err
+		}
+		if e.dst == nil {
+			return nil, fmt.Errorf("fdb entry %d has no dst", i)
+		}
+		if e.Mac == "" {
+			e.mac = make(net.HardwareAddr, 6)
+		} else if e.mac, err = net.ParseMAC(e.Mac); err != nil {
+			return nil, fmt.Errorf("invalid fdb MAC %q: %v", e.Mac, err)
+		}
+		addrs = append(addrs, e.dst)
+	}
+
+	// The tunnel runs over IPv4 or IPv6, not both
+	isV4 := -1
+	for _, addr := range addrs {
+		if addr == nil {
+			continue
+		}
+		v4 := 0
+		if addr.To4() != nil {
+			v4 = 1
+		}
+		if isV4 != -1 && v4 != isV4 {
+			return nil, fmt.Errorf("the remote, group, local and fdb addresses must be of the same family")
+		}
+		isV4 = v4
+	}
+	return n, nil
+}
+
+// hasIPAM reports whether addresses are assigned to the device. Without
+// IPAM the plugin only provides L2 connectivity.
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// underlayDst returns the address the underlay device is looked up for
+func (n *NetConf) underlayDst() net.IP {
+	switch {
+	case n.remote != nil:
+		return n.remote
+	case n.group != nil:
+		return n.group
+	case len(n.FDB) > 0:
+		return n.FDB[0].dst
+	}
+	return nil
+}
+
+// lookupUnderlay returns the host underlay device, or nil if none is
+// configured nor can be found
+func lookupUnderlay(n *NetConf) (netlink.Link, error) {
+	if n.Master != "" {
+		m, err := netlinksafe.LinkByName(n.Master)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup master %q: %v", n.Master, err)
+		}
+		return m, nil
+	}
+
+	dst := n.underlayDst()
+	if dst == nil {
+		return nil, nil
+	}
+	routes, err := netlink.RouteGet(dst)
+	if err != nil || len(routes) == 0 || routes[0].LinkIndex == 0 {
+		if n.group != nil {
+			return nil, fmt.Errorf("no route to group %s, master is required: %v", n.group, err)
+		}
+		return nil, nil
+	}
+	m, err := netlink.LinkByIndex(routes[0].LinkIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup the device of the route to %s: %v", dst, err)
+	}
+	return m, nil
+}
+
+// mtu returns the MTU of the device, which fits in the one of the underlay
+func (n *NetConf) mtu(underlay netlink.Link) (int, error) {
+	if underlay == nil {
+		return n.MTU, nil
+	}
+	overhead := overheadIPv4
+	if dst := n.underlayDst(); dst != nil && dst.To4() == nil {
+		overhead = overheadIPv6
+	}
+	maxMTU := underlay.Attrs().MTU - overhead
+	if n.MTU > maxMTU {
+		return 0, fmt.Errorf("invalid MTU %d, must be [0, master MTU(%d) - %d]", n.MTU, underlay.Attrs().MTU, overhead)
+	}
+	if n.MTU == 0 {
+		return maxMTU, nil
+	}
+	return n.MTU, nil
+}
+
+func fdbNeigh(index int, e *FDBEntry) *netlink.Neigh {
+	return &netlink.Neigh{
+		LinkIndex:    index,
+		Family:       unix.AF_BRIDGE,
+		State:        netlink.NUD_PERMANENT | netlink.NUD_NOARP,
+		Flags:        netlink.NTF_SELF,
+		IP:           e.dst,
+		HardwareAddr: e.mac,
+	}
+}
+
+// addFDB adds the static FDB entries to the device. It must be called in
+// the container namespace.
+func addFDB(link netlink.Link, entries []FDBEntry) error {
+	for i := range entries {
+		if err := netlink.NeighAppend(fdbNeigh(link.Attrs().Index, &entries[i])); err != nil {
+			return fmt.Errorf("failed to add fdb entry %s to %s: %v", entries[i].mac, entries[i].dst, err)
+		}
+	}
+	return nil
+}
+
+func createVxlan(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	vxlan := &current.Interface{}
+
+	underlay, err := lookupUnderlay(conf)
+	if err != nil {
+		return nil, err
+	}
+	mtu, err := conf.mtu(underlay)
+	if err != nil {
+		return nil, err
+	}
+
+	// due to kernel bug we have to create with tmpname or it might
+	// collide with the name on the host and error out
+	tmpName, err := ip.RandomVethName()
+	if err != nil {
+		return nil, err
+	}
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.MTU = mtu
+	linkAttrs.Name = tmpName
+	linkAttrs.Namespace = netlink.NsFd(int(netns.Fd()))
+
+	v := &netlink.Vxlan{
+		LinkAttrs: linkAttrs,
+		VxlanId:   conf.VNI,
+		SrcAddr:   conf.local,
+		TTL:       conf.TTL,
+		Learning:  conf.Learning,
+		Port:      conf.DstPort,
+	}
+	if underlay != nil {
+		v.VtepDevIndex = underlay.Attrs().Index
+	}
+	if conf.remote != nil {
+		v.Group = conf.remote
+	} else {
+		v.Group = conf.group
+	}
+
+	// The device is created in the host namespace, where its socket stays,
+	// and moved to the container in the same request
+	if err := netlink.LinkAdd(v); err != nil {
+		if errors.Is(err, unix.EEXIST) {
+			return nil, fmt.Errorf("failed to create vxlan: VNI %d is already in use on port %d: %v", conf.VNI, conf.DstPort, err)
+		}
+		return nil, fmt.Errorf("failed to create vxlan: %v", err)
+	}
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		err := ip.RenameLink(tmpName, ifName)
+		if err != nil {
+			_ = ip.DelLinkByName(tmpName)
+			return fmt.Errorf("failed to rename vxlan to %q: %v", ifName, err)
+		}
+		vxlan.Name = ifName
+
+		// Re-fetch interface to get all properties/attributes
+		contVxlan, err := netlinksafe.LinkByName(vxlan.Name)
+		if err != nil {
+			return fmt.Errorf("failed to refetch vxlan %q: %v", vxlan.Name, err)
+		}
+		vxlan.Mac = contVxlan.Attrs().HardwareAddr.String()
+		vxlan.Sandbox = netns.Path()
+
+		if err := addFDB(contVxlan, conf.FDB); err != nil {
+			_ = netlink.LinkDel(contVxlan)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vxlan, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	vxlanInterface, err := createVxlan(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return ip.DelLinkByName(args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{vxlanInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the vxlan interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		err = ip.DelLinkByName(args.IfName)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("vxlan: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("vxlan: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	vxlan, isVxlan := link.(*netlink.Vxlan)
+	if !isVxlan {
+		return fmt.Errorf("vxlan: Container interface %s not of type vxlan", intf.Name)
+	}
+	if intf.Mac != "" && intf.Mac != link.Attrs().HardwareAddr.String() {
+		return fmt.Errorf("vxlan: Interface %s Mac %s doesn't match container Mac: %s", intf.Name, intf.Mac, link.Attrs().HardwareAddr)
+	}
+	if vxlan.VxlanId != n.VNI {
+		return fmt.Errorf("vxlan: Interface %s VNI %d doesn't match configured VNI %d", intf.Name, vxlan.VxlanId, n.VNI)
+	}
+	if vxlan.Port != n.DstPort {
+		return fmt.Errorf("vxlan: Interface %s port %d doesn't match configured port %d", intf.Name, vxlan.Port, n.DstPort)
+	}
+	remote := n.remote
+	if remote == nil {
+		remote = n.group
+	}
+	mismatch := !remote.Equal(vxlan.Group)
+	if remote == nil {
+		mismatch = vxlan.Group != nil && !vxlan.Group.IsUnspecified()
+	}
+	if mismatch {
+		return fmt.Errorf("vxlan: Interface %s remote %s doesn't match configured remote %s", intf.Name, vxlan.Group, remote)
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("vxlan: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+
+	if len(n.FDB) == 0 {
+		return nil
+	}
+	neighs, err := netlinksafe.NeighList(link.Attrs().Index, unix.AF_BRIDGE)
+	if err != nil {
+		return fmt.Errorf("failed to list fdb of %s: %v", intf.Name, err)
+	}
+	for i := range n.FDB {
+		e := &n.FDB[i]
+		found := false
+		for _, neigh := range neighs {
+			if neigh.IP.Equal(e.dst) && neigh.HardwareAddr.String() == e.mac.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("vxlan: Interface %s has no fdb entry %s to %s", intf.Name, e.mac, e.dst)
+		}
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("vxlan"))
+}
@@ -0,0 +1,327 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// IPsecConfig holds the security associations and policies installed in
+// the container for the device. They are bound to the interface ID of the
+// device, which is set on each of them.
+type IPsecConfig struct {
+	States   []State  `json:"states"`
+	Policies []Policy `json:"policies"`
+}
+
+// State is an IPsec security association
+type State struct {
+	Src   string `json:"src"`
+	Dst   string `json:"dst"`
+	Proto string `json:"proto,omitempty"`
+	SPI   uint32 `json:"spi"`
+	Mode  string `json:"mode,omitempty"`
+	Reqid int    `json:"reqid,omitempty"`
+	Auth  *Algo  `json:"auth,omitempty"`
+	Crypt *Algo  `json:"crypt,omitempty"`
+	Aead  *Algo  `json:"aead,omitempty"`
+}
+
+// Algo is an algorithm of a security association, as named by the kernel,
+// e.g. "rfc4106(gcm(aes))", with its key in hex
+type Algo struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// TruncLen is the length in bits of the truncated authentication
+	// digest, for auth only
+	TruncLen int `json:"truncLen,omitempty"`
+	// ICVLen is the length in bits of the integrity check value, for
+	// aead only
+	ICVLen int `json:"icvLen,omitempty"`
+}
+
+// Policy selects the traffic between two prefixes to go through the
+// security associations of its templates
+type Policy struct {
+	Src      string     `json:"src"`
+	Dst      string     `json:"dst"`
+	Dir      string     `json:"dir"`
+	Priority int        `json:"priority,omitempty"`
+	Tmpls    []Template `json:"tmpls"`
+}
+
+// Template matches the security associations of a policy
+type Template struct {
+	Src   string `json:"src"`
+	Dst   string `json:"dst"`
+	Proto string `json:"proto,omitempty"`
+	Mode  string `json:"mode,omitempty"`
+	SPI   uint32 `json:"spi,omitempty"`
+	Reqid int    `json:"reqid,omitempty"`
+}
+
+// loadIPsecConfig reads the IPsec configuration file and returns its states
+// and policies bound to ifID
+func loadIPsecConfig(path string, ifID uint32) ([]netlink.XfrmState, []netlink.XfrmPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read ipsecConfig: %v", err)
+	}
+	return parseIPsecConfig(data, ifID)
+}
+
+func parseIPsecConfig(data []byte, ifID uint32) ([]netlink.XfrmState, []netlink.XfrmPolicy, error) {
+	conf := IPsecConfig{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ipsecConfig: %v", err)
+	}
+
+	states := make([]netlink.XfrmState, 0, len(conf.States))
+	for i, s := range conf.States {
+		state, err := s.xfrm(ifID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid state %d: %v", i, err)
+		}
+		states = append(states, *state)
+	}
+	policies := make([]netlink.XfrmPolicy, 0, len(conf.Policies))
+	for i, p := range conf.Policies {
+		policy, err := p.xfrm(ifID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid policy %d: %v", i, err)
+		}
+		policies = append(policies, *policy)
+	}
+	return states, policies, nil
+}
+
+// parseEndpoints parses the source and destination addresses of a state or
+// template, which must be of the same family
+func parseEndpoints(src, dst string) (net.IP, net.IP, error) {
+	srcIP := net.ParseIP(src)
+	if srcIP == nil {
+		return nil, nil, fmt.Errorf("invalid src address %q", src)
+	}
+	dstIP := net.ParseIP(dst)
+	if dstIP == nil {
+		return nil, nil, fmt.Errorf("invalid dst address %q", dst)
+	}
+	if (srcIP.To4() == nil) != (dstIP.To4() == nil) {
+		return nil, nil, fmt.Errorf("the src and dst addresses must be of the same family")
+	}
+	return srcIP, dstIP, nil
+}
+
+func parseProto(proto string) (netlink.Proto, error) {
+	switch proto {
+	case "", "esp":
+		return netlink.XFRM_PROTO_ESP, nil
+	case "ah":
+		return netlink.XFRM_PROTO_AH, nil
+	}
+	return 0, fmt.Errorf("invalid proto %q, must be esp or ah", proto)
+}
+
+func parseMode(mode string) (netlink.Mode, error) {
+	switch mode {
+	case "", "tunnel":
+		return netlink.XFRM_MODE_TUNNEL, nil
+	case "transport":
+		return netlink.XFRM_MODE_TRANSPORT, nil
+	}
+	return 0, fmt.Errorf("invalid mode %q, must be tunnel or transport", mode)
+}
+
+func (a *Algo) xfrm(kind string) (*netlink.XfrmStateAlgo, error) {
+	if a == nil {
+		return nil, nil
+	}
+	if a.Name == "" {
+		return nil, fmt.Errorf("%s algorithm name missing", kind)
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(a.Key, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key: %v", kind, err)
+	}
+	return &netlink.XfrmStateAlgo{
+		Name:        a.Name,
+		Key:         key,
+		TruncateLen: a.TruncLen,
+		ICVLen:      a.ICVLen,
+	}, nil
+}
+
+func (s *State) xfrm(ifID uint32) (*netlink.XfrmState, error) {
+	src, dst, err := parseEndpoints(s.Src, s.Dst)
+	if err != nil {
+		return nil, err
+	}
+	state := &netlink.XfrmState{
+		Src:   src,
+		Dst:   dst,
+		Spi:   int(s.SPI),
+		Reqid: s.Reqid,
+		Ifid:  int(ifID),
+	}
+	if state.Proto, err = parseProto(s.Proto); err != nil {
+		return nil, err
+	}
+	if state.Mode, err = parseMode(s.Mode); err != nil {
+		return nil, err
+	}
+	if s.SPI == 0 {
+		return nil, fmt.Errorf("spi is required")
+	}
+	if state.Auth, err = s.Auth.xfrm("auth"); err != nil {
+		return nil, err
+	}
+	if state.Crypt, err = s.Crypt.xfrm("crypt"); err != nil {
+		return nil, err
+	}
+	if state.Aead, err = s.Aead.xfrm("aead"); err != nil {
+		return nil, err
+	}
+	if state.Aead != nil && (state.Auth != nil || state.Crypt != nil) {
+		return nil, fmt.Errorf("aead can't be combined with auth or crypt")
+	}
+	if state.Aead == nil && state.Auth == nil && state.Crypt == nil {
+		return nil, fmt.Errorf("one of aead, auth or crypt is required")
+	}
+	return state, nil
+}
+
+func (p *Policy) xfrm(ifID uint32) (*netlink.XfrmPolicy, error) {
+	_, src, err := net.ParseCIDR(p.Src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid src prefix %q: %v", p.Src, err)
+	}
+	_, dst, err := net.ParseCIDR(p.Dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dst prefix %q: %v", p.Dst, err)
+	}
+	if (src.IP.To4() == nil) != (dst.IP.To4() == nil) {
+		return nil, fmt.Errorf("the src and dst prefixes must be of the same family")
+	}
+	policy := &netlink.XfrmPolicy{
+		Src:      src,
+		Dst:      dst,
+		Priority: p.Priority,
+		Ifid:     int(ifID),
+	}
+	switch p.Dir {
+	case "in":
+		policy.Dir = netlink.XFRM_DIR_IN
+	case "out":
+		policy.Dir = netlink.XFRM_DIR_OUT
+	case "fwd":
+		policy.Dir = netlink.XFRM_DIR_FWD
+	default:
+		return nil, fmt.Errorf("invalid dir %q, must be in, out or fwd", p.Dir)
+	}
+	if len(p.Tmpls) == 0 {
+		return nil, fmt.Errorf("at least one template is required")
+	}
+	for i, t := range p.Tmpls {
+		tmplSrc, tmplDst, err := parseEndpoints(t.Src, t.Dst)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %d: %v", i, err)
+		}
+		tmpl := netlink.XfrmPolicyTmpl{
+			Src:   tmplSrc,
+			Dst:   tmplDst,
+			Spi:   int(t.SPI),
+			Reqid: t.Reqid,
+		}
+		if tmpl.Proto, err = parseProto(t.Proto); err != nil {
+			return nil, fmt.Errorf("invalid template %d: %v", i, err)
+		}
+		if tmpl.Mode, err = parseMode(t.Mode); err != nil {
+			return nil, fmt.Errorf("invalid template %d: %v", i, err)
+		}
+		policy.Tmpls = append(policy.Tmpls, tmpl)
+	}
+	return policy, nil
+}
+
+// installIPsec adds the states and policies in the current namespace
+func installIPsec(states []netlink.XfrmState, policies []netlink.XfrmPolicy) error {
+	for i := range states {
+		if err := netlink.XfrmStateAdd(&states[i]); err != nil {
+			return fmt.Errorf("failed to add state %s to %s spi 0x%x: %v", states[i].Src, states[i].Dst, states[i].Spi, err)
+		}
+	}
+	for i := range policies {
+		if err := netlink.XfrmPolicyAdd(&policies[i]); err != nil {
+			return fmt.Errorf("failed to add policy %s %s to %s: %v", policies[i].Dir, policies[i].Src, policies[i].Dst, err)
+		}
+	}
+	return nil
+}
+
+// removeIPsec deletes the states and policies bound to ifID in the current
+// namespace
+func removeIPsec(ifID uint32) error {
+	policies, err := netlinksafe.XfrmPolicyList(netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list policies: %v", err)
+	}
+	for i := range policies {
+		if policies[i].Ifid != int(ifID) {
+			continue
+		}
+		if err := netlink.XfrmPolicyDel(&policies[i]); err != nil {
+			return fmt.Errorf("failed to delete policy %s %s to %s: %v", policies[i].Dir, policies[i].Src, policies[i].Dst, err)
+		}
+	}
+
+	states, err := netlinksafe.XfrmStateList(netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list states: %v", err)
+	}
+	for i := range states {
+		if states[i].Ifid != int(ifID) {
+			continue
+		}
+		if err := netlink.XfrmStateDel(&states[i]); err != nil {
+			return fmt.Errorf("failed to delete state %s to %s spi 0x%x: %v", states[i].Src, states[i].Dst, states[i].Spi, err)
+		}
+	}
+	return nil
+}
+
+// checkIPsec verifies that the states and policies are installed in the
+// current namespace
+func checkIPsec(states []netlink.XfrmState, policies []netlink.XfrmPolicy) error {
+	for i := range states {
+		if _, err := netlink.XfrmStateGet(&states[i]); err != nil {
+			return fmt.Errorf("state %s to %s spi 0x%x not found: %v", states[i].Src, states[i].Dst, states[i].Spi, err)
+		}
+	}
+	for i := range policies {
+		if _, err := netlink.XfrmPolicyGet(&policies[i]); err != nil {
+			return fmt.Errorf("policy %s %s to %s not found: %v", policies[i].Dir, policies[i].Src, policies[i].Dst, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a plugin creating an xfrm interface in the container, so that
+// IPsec tunnels terminate in the container.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+type NetConf struct {
+	types.NetConf
+	// IfID ties the device to the states and policies with the same
+	// interface ID in the container
+	IfID uint32 `json:"ifId"`
+	// Link names the interface of the container the encapsulated packets
+	// are sent out of, as routed by default
+	Link string `json:"link,omitempty"`
+	MTU  int    `json:"mtu,omitempty"`
+	// IPsecConfig is the path of a file holding the states and policies to
+	// install in the container, none by default
+	IPsecConfig string `json:"ipsecConfig,omitempty"`
+
+	states   []netlink.XfrmState
+	policies []netlink.XfrmPolicy
+}
+
+func init() {
+	// this ensures that main runs only on main thread (thread group leader).
+	// since namespace ops (unshare, setns) are done for a single thread, we
+	// must ensure that the goroutine does not jump from OS thread to thread
+	runtime.LockOSThread()
+}
+
+func loadConf(bytes []byte) (*NetConf, error) {
+	n := &NetConf{}
+	if err := json.Unmarshal(bytes, n); err != nil {
+		return nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+	// The kernel doesn't match the interface ID 0
+	if n.IfID == 0 {
+		return nil, fmt.Errorf(`"ifId" field is required. It ties the device to its IPsec states and policies`)
+	}
+	if n.MTU < 0 {
+		return nil, fmt.Errorf("invalid MTU %d", n.MTU)
+	}
+	return n, nil
+}
+
+// loadIPsec loads the states and policies of the IPsec configuration file.
+// DEL doesn't need them, and the file may be gone by then.
+func (n *NetConf) loadIPsec() error {
+	if n.IPsecConfig == "" {
+		return nil
+	}
+	var err error
+	n.states, n.policies, err = loadIPsecConfig(n.IPsecConfig, n.IfID)
+	return err
+}
+
+// hasIPAM reports whether addresses are assigned to the device
+func (n *NetConf) hasIPAM() bool {
+	return n.IPAM.Type != ""
+}
+
+// createXfrm creates the xfrm interface in the container, and installs the
+// states and policies of the configuration there
+func createXfrm(conf *NetConf, ifName string, netns ns.NetNS) (*current.Interface, error) {
+	xfrm := &current.Interface{}
+
+	err := netns.Do(func(_ ns.NetNS) error {
+		linkAttrs := netlink.NewLinkAttrs()
+		linkAttrs.Name = ifName
+		linkAttrs.MTU = conf.MTU
+		if conf.Link != "" {
+			link, err := netlinksafe.LinkByName(conf.Link)
+			if err != nil {
+				return fmt.Errorf("failed to lookup link %q: %v", conf.Link, err)
+			}
+			linkAttrs.ParentIndex = link.Attrs().Index
+		}
+
+		if err := netlink.LinkAdd(&netlink.Xfrmi{LinkAttrs: linkAttrs, Ifid: conf.IfID}); err != nil {
+			return fmt.Errorf("failed to create xfrm interface: %v", err)
+		}
+		xfrm.Name = ifName
+		xfrm.Sandbox = netns.Path()
+
+		if err := installIPsec(conf.states, conf.policies); err != nil {
+			_ = removeIPsec(conf.IfID)
+			_ = ip.DelLinkByName(ifName)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return xfrm, nil
+}
+
+// deleteXfrm deletes the xfrm interface, and the states and policies of the
+// configuration, in the current namespace
+func deleteXfrm(conf *NetConf, ifName string) error {
+	if conf.IPsecConfig != "" {
+		if err := removeIPsec(conf.IfID); err != nil {
+			return err
+		}
+	}
+	err := ip.DelLinkByName(ifName)
+	if err != nil && err == ip.ErrLinkNotFound {
+		return nil
+	}
+	return err
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if err := n.loadIPsec(); err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	xfrmInterface, err := createXfrm(n, args.IfName, netns)
+	if err != nil {
+		return err
+	}
+
+	// Delete the device if the addresses can't be configured
+	defer func() {
+		if err != nil {
+			netns.Do(func(_ ns.NetNS) error {
+				return deleteXfrm(n, args.IfName)
+			})
+		}
+	}()
+
+	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		Interfaces: []*current.Interface{xfrmInterface},
+	}
+
+	if !n.hasIPAM() {
+		err = netns.Do(func(_ ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(args.IfName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+			}
+			return netlink.LinkSetUp(link)
+		})
+		if err != nil {
+			return err
+		}
+		return types.PrintResult(result, n.CNIVersion)
+	}
+
+	// run the IPAM plugin and get back the config to apply
+	r, err := ipam.ExecAdd(n.IPAM.Type, args.StdinData)
+	if err != nil {
+		return ipam.WrapError(err, "failed to execute IPAM delegate")
+	}
+
+	// Invoke ipam del if err to avoid ip leak
+	defer func() {
+		if err != nil {
+			ipam.ExecDel(n.IPAM.Type, args.StdinData)
+		}
+	}()
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return err
+	}
+
+	if len(ipamResult.IPs) == 0 {
+		err = errors.New("IPAM plugin returned missing IP config")
+		return err
+	}
+	for _, ipc := range ipamResult.IPs {
+		// All addresses belong to the xfrm interface
+		ipc.Interface = current.Int(0)
+	}
+	result.IPs = ipamResult.IPs
+	result.Routes = ipamResult.Routes
+
+	err = netns.Do(func(_ ns.NetNS) error {
+		return ipam.ConfigureIface(args.IfName, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.DNS = n.DNS
+
+	return types.PrintResult(result, n.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecDel(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return deleteXfrm(n, args.IfName)
+	})
+	if err != nil {
+		//  if NetNs is passed down by the Cloud Orchestration Engine, or if it called multiple times
+		// so don't return an error if the device is already removed.
+		// https://github.com/kubernetes/kubernetes/issues/43014#issuecomment-287164444
+		_, ok := err.(ns.NSPathNotExistErr)
+		if ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if err := n.loadIPsec(); err != nil {
+		return err
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	if n.hasIPAM() {
+		if err := ipam.ExecCheck(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	if n.NetConf.RawPrevResult == nil {
+		return fmt.Errorf("xfrm: Required prevResult missing")
+	}
+	if err := version.ParsePrevResult(&n.NetConf); err != nil {
+		return err
+	}
+	result, err := current.NewResultFromResult(n.PrevResult)
+	if err != nil {
+		return err
+	}
+
+	var contMap current.Interface
+	for _, intf := range result.Interfaces {
+		if args.IfName == intf.Name && args.Netns == intf.Sandbox {
+			contMap = *intf
+		}
+	}
+
+	// The namespace must be the same as what was configured
+	if args.Netns != contMap.Sandbox {
+		return fmt.Errorf("Sandbox in prevResult %s doesn't match configured netns: %s",
+			contMap.Sandbox, args.Netns)
+	}
+
+	return netns.Do(func(_ ns.NetNS) error {
+		if err := validateCniContainerInterface(contMap, n); err != nil {
+			return err
+		}
+		if err := checkIPsec(n.states, n.policies); err != nil {
+			return fmt.Errorf("xfrm: %v", err)
+		}
+		if err := ip.ValidateExpectedInterfaceIPs(args.IfName, result.IPs); err != nil {
+			return err
+		}
+		return ip.ValidateExpectedRoute(result.Routes)
+	})
+}
+
+func validateCniContainerInterface(intf current.Interface, n *NetConf) error {
+	if intf.Name == "" {
+		return fmt.Errorf("Container interface name missing in prevResult: %v", intf.Name)
+	}
+	link, err := netlinksafe.LinkByName(intf.Name)
+	if err != nil {
+		return fmt.Errorf("xfrm: Container Interface name in prevResult: %s not found", intf.Name)
+	}
+
+	xfrmi, ok := link.(*netlink.Xfrmi)
+	if !ok {
+		return fmt.Errorf("xfrm: Container interface %s not of type xfrm", intf.Name)
+	}
+	if xfrmi.Ifid != n.IfID {
+		return fmt.Errorf("xfrm: Interface %s ifId %d doesn't match configured ifId %d", intf.Name, xfrmi.Ifid, n.IfID)
+	}
+	if n.Link != "" {
+		parent, err := netlinksafe.LinkByName(n.Link)
+		if err != nil {
+			return fmt.Errorf("xfrm: link %q not found: %v", n.Link, err)
+		}
+		if xfrmi.ParentIndex != parent.Attrs().Index {
+			return fmt.Errorf("xfrm: Interface %s isn't bound to link %s", intf.Name, n.Link)
+		}
+	}
+	if n.MTU != 0 && n.MTU != link.Attrs().MTU {
+		return fmt.Errorf("xfrm: Interface %s MTU %d doesn't match configured MTU %d", intf.Name, link.Attrs().MTU, n.MTU)
+	}
+	return nil
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	n, err := loadConf(args.StdinData)
+	if err != nil {
+		return fmt.Errorf("failed to load netconf: %w", err)
+	}
+
+	if n.hasIPAM() {
+		if err := ipam.ExecStatus(n.IPAM.Type, args.StdinData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		Status: cmdStatus,
+		/* FIXME GC */
+	}, version.All, bv.BuildString("xfrm"))
+}
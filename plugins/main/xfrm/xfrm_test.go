@@ -0,0 +1,274 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	UNDERLAY_NAME = "eth0"
+	IFNAME        = "xfrm1"
+)
+
+const ipsecConf = `{
+	"states": [
+		{"src": "192.0.2.1", "dst": "192.0.2.2", "spi": 256, "reqid": 1,
+		 "aead": {"name": "rfc4106(gcm(aes))", "key": "0x0102030405060708090a0b0c0d0e0f1011121314", "icvLen": 128}},
+		{"src": "192.0.2.2", "dst": "192.0.2.1", "spi": 257, "reqid": 1,
+		 "aead": {"name": "rfc4106(gcm(aes))", "key": "0x1102030405060708090a0b0c0d0e0f1011121314", "icvLen": 128}}
+	],
+	"policies": [
+		{"src": "10.0.1.0/24", "dst": "10.0.2.0/24", "dir": "out",
+		 "tmpls": [{"src": "192.0.2.1", "dst": "192.0.2.2", "reqid": 1}]},
+		{"src": "10.0.2.0/24", "dst": "10.0.1.0/24", "dir": "in",
+		 "tmpls": [{"src": "192.0.2.2", "dst": "192.0.2.1", "reqid": 1}]}
+	]
+}`
+
+var _ = Describe("xfrm configuration", func() {
+	It("requires an interface ID", func() {
+		_, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "xfrm"}`))
+		Expect(err).To(MatchError(ContainSubstring(`"ifId" field is required`)))
+
+		n, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "net", "type": "xfrm", "ifId": 7}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.IfID).To(BeEquivalentTo(7))
+		Expect(n.hasIPAM()).To(BeFalse())
+	})
+
+	It("binds the IPsec configuration to the interface ID", func() {
+		states, policies, err := parseIPsecConfig([]byte(ipsecConf), 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(states).To(HaveLen(2))
+		Expect(states[0].Ifid).To(Equal(7))
+		Expect(states[0].Proto).To(Equal(netlink.XFRM_PROTO_ESP))
+		Expect(states[0].Mode).To(Equal(netlink.XFRM_MODE_TUNNEL))
+		Expect(states[0].Spi).To(Equal(256))
+		Expect(states[0].Aead.Key).To(HaveLen(20))
+		Expect(states[0].Aead.ICVLen).To(Equal(128))
+		Expect(policies).To(HaveLen(2))
+		Expect(policies[0].Ifid).To(Equal(7))
+		Expect(policies[0].Dir).To(Equal(netlink.XFRM_DIR_OUT))
+		Expect(policies[1].Dir).To(Equal(netlink.XFRM_DIR_IN))
+		Expect(policies[0].Tmpls).To(HaveLen(1))
+		Expect(policies[0].Tmpls[0].Reqid).To(Equal(1))
+	})
+
+	DescribeTable("rejects invalid IPsec configurations",
+		func(conf, msg string) {
+			_, _, err := parseIPsecConfig([]byte(conf), 7)
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid state address", `{"states": [{"src": "foo", "dst": "192.0.2.2", "spi": 1}]}`, `invalid state 0: invalid src address "foo"`),
+		Entry("with mixed families", `{"states": [{"src": "192.0.2.1", "dst": "2001:db8::2", "spi": 1}]}`, "same family"),
+		Entry("without spi", `{"states": [{"src": "192.0.2.1", "dst": "192.0.2.2", "crypt": {"name": "cbc(aes)", "key": "00"}}]}`, "spi is required"),
+		Entry("with an invalid proto", `{"states": [{"src": "192.0.2.1", "dst": "192.0.2.2", "spi": 1, "proto": "comp"}]}`, `invalid proto "comp"`),
+		Entry("with an invalid key", `{"states": [{"src": "192.0.2.1", "dst": "192.0.2.2", "spi": 1, "crypt": {"name": "cbc(aes)", "key": "xyz"}}]}`, "invalid crypt key"),
+		Entry("without algorithm", `{"states": [{"src": "192.0.2.1", "dst": "192.0.2.2", "spi": 1}]}`, "one of aead, auth or crypt is required"),
+		Entry("with aead and crypt", `{"states": [{"src": "192.0.2.1", "dst": "192.0.2.2", "spi": 1, "crypt": {"name": "cbc(aes)", "key": "00"}, "aead": {"name": "rfc4106(gcm(aes))", "key": "00"}}]}`, "aead can't be combined"),
+		Entry("with an invalid policy prefix", `{"policies": [{"src": "10.0.0.1", "dst": "10.0.2.0/24", "dir": "out"}]}`, `invalid policy 0: invalid src prefix "10.0.0.1"`),
+		Entry("with an invalid direction", `{"policies": [{"src": "10.0.1.0/24", "dst": "10.0.2.0/24", "dir": "up"}]}`, `invalid dir "up"`),
+		Entry("without templates", `{"policies": [{"src": "10.0.1.0/24", "dst": "10.0.2.0/24", "dir": "out"}]}`, "at least one template is required"),
+		Entry("with an invalid template mode", `{"policies": [{"src": "10.0.1.0/24", "dst": "10.0.2.0/24", "dir": "out", "tmpls": [{"src": "192.0.2.1", "dst": "192.0.2.2", "mode": "beet"}]}]}`, `invalid template 0: invalid mode "beet"`),
+	)
+})
+
+var _ = Describe("xfrm Operations", func() {
+	var originalNS, targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		originalNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir, err = os.MkdirTemp("", "xfrm_test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(dataDir, "ipsec.json"), []byte(ipsecConf), 0o600)).To(Succeed())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			// The underlay of the container the tunnel terminates on
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = UNDERLAY_NAME
+			Expect(netlink.LinkAdd(&netlink.Veth{
+				LinkAttrs: linkAttrs,
+				PeerName:  "peer0",
+			})).To(Succeed())
+			link, err := netlinksafe.LinkByName(UNDERLAY_NAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			addr, err := netlink.ParseAddr("192.0.2.1/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(originalNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(originalNS)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("installs, checks and removes the IPsec configuration", func() {
+		states, policies, err := parseIPsecConfig([]byte(ipsecConf), 7)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(installIPsec(states, policies)).To(Succeed())
+			Expect(checkIPsec(states, policies)).To(Succeed())
+
+			// Another interface ID is left alone
+			other, otherPolicies, err := parseIPsecConfig([]byte(`{
+				"states": [{"src": "192.0.2.1", "dst": "192.0.2.3", "spi": 300,
+				            "crypt": {"name": "cbc(aes)", "key": "0x000102030405060708090a0b0c0d0e0f"}}],
+				"policies": [{"src": "10.0.1.0/24", "dst": "10.0.3.0/24", "dir": "out",
+				              "tmpls": [{"src": "192.0.2.1", "dst": "192.0.2.3"}]}]
+			}`), 8)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(installIPsec(other, otherPolicies)).To(Succeed())
+
+			Expect(removeIPsec(7)).To(Succeed())
+			Expect(checkIPsec(states[:1], nil)).To(MatchError(ContainSubstring("not found")))
+			Expect(checkIPsec(nil, policies[:1])).To(MatchError(ContainSubstring("not found")))
+			Expect(checkIPsec(other, otherPolicies)).To(Succeed())
+
+			leftStates, err := netlinksafe.XfrmStateList(netlink.FAMILY_ALL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(leftStates).To(HaveLen(1))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("configures, checks and deletes an xfrm interface with its IPsec configuration", func() {
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "ipsec",
+			"type": "xfrm",
+			"ifId": 7,
+			"link": "%s",
+			"mtu": 1400,
+			"ipsecConfig": "%s",
+			"ipam": {
+				"type": "static",
+				"addresses": [{"address": "10.0.1.2/24"}],
+				"routes": [{"dst": "10.0.2.0/24"}]
+			}
+		}`, UNDERLAY_NAME, filepath.Join(dataDir, "ipsec.json"))
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   []byte(conf),
+		}
+
+		var result *types100.Result
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			result, err = types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces).To(HaveLen(1))
+			Expect(result.Interfaces[0].Name).To(Equal(IFNAME))
+			Expect(result.Interfaces[0].Sandbox).To(Equal(targetNS.Path()))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			xfrmi, ok := link.(*netlink.Xfrmi)
+			Expect(ok).To(BeTrue())
+			Expect(xfrmi.Ifid).To(BeEquivalentTo(7))
+			Expect(link.Attrs().MTU).To(Equal(1400))
+
+			states, err := netlinksafe.XfrmStateList(netlink.FAMILY_ALL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(states).To(HaveLen(2))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var confMap map[string]interface{}
+		Expect(json.Unmarshal([]byte(conf), &confMap)).To(Succeed())
+		resultBytes, err := json.Marshal(result)
+		Expect(err).NotTo(HaveOccurred())
+		var prevResult map[string]interface{}
+		Expect(json.Unmarshal(resultBytes, &prevResult)).To(Succeed())
+		confMap["prevResult"] = prevResult
+		checkConf, err := json.Marshal(confMap)
+		Expect(err).NotTo(HaveOccurred())
+		args.StdinData = checkConf
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })).To(Succeed())
+
+			// The IPsec configuration may be gone by DEL
+			Expect(os.Remove(filepath.Join(dataDir, "ipsec.json"))).To(Succeed())
+			Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).To(HaveOccurred())
+			states, err := netlinksafe.XfrmStateList(netlink.FAMILY_ALL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(states).To(BeEmpty())
+			policies, err := netlinksafe.XfrmPolicyList(netlink.FAMILY_ALL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policies).To(BeEmpty())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
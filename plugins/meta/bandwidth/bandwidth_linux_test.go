@@ -289,6 +289,89 @@ var _ = Describe("bandwidth test", func() {
 				})).To(Succeed())
 			})
 
+			It(fmt.Sprintf("[%s] polices egress without an IFB device when asked to", ver), func() {
+				conf := fmt.Sprintf(`{
+					"cniVersion": "%s",
+					"name": "cni-plugin-bandwidth-test",
+					"type": "bandwidth",
+					"egressRate": 8000,
+					"egressBurst": 80,
+					"egressPolicer": true,
+					"prevResult": {
+						"interfaces": [
+							{
+								"name": "%s",
+								"sandbox": ""
+							},
+							{
+								"name": "%s",
+								"sandbox": "%s"
+							}
+						],
+						"ips": [
+							{
+								"version": "4",
+								"address": "%s/24",
+								"gateway": "10.0.0.1",
+								"interface": 1
+							}
+						],
+						"routes": []
+					}
+				}`, ver, hostIfname, containerIfname, containerNs.Path(), containerIP.String())
+
+				args := &skel.CmdArgs{
+					ContainerID: "dummy",
+					Netns:       containerNs.Path(),
+					IfName:      containerIfname,
+					StdinData:   []byte(conf),
+				}
+
+				Expect(hostNs.Do(func(_ ns.NetNS) error {
+					defer GinkgoRecover()
+
+					_, out, err := testutils.CmdAdd(containerNs.Path(), args.ContainerID, ifbDeviceName, []byte(conf), func() error { return cmdAdd(args) })
+					Expect(err).NotTo(HaveOccurred(), string(out))
+
+					_, err = netlinksafe.LinkByName(ifbDeviceName)
+					Expect(err).To(HaveOccurred())
+					return nil
+				})).To(Succeed())
+
+				Expect(hostNs.Do(func(_ ns.NetNS) error {
+					defer GinkgoRecover()
+
+					hostIfLink, err := netlinksafe.LinkByName(hostIfname)
+					Expect(err).NotTo(HaveOccurred())
+
+					qdiscs, err := netlinksafe.QdiscList(hostIfLink)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(qdiscs).To(HaveLen(2))
+					Expect(qdiscs[0]).NotTo(BeAssignableToTypeOf(&netlink.Tbf{}))
+					Expect(qdiscs[1]).NotTo(BeAssignableToTypeOf(&netlink.Tbf{}))
+
+					filters, err := netlinksafe.FilterList(hostIfLink, netlink.MakeHandle(0xffff, 0))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(filters).To(HaveLen(1))
+					Expect(filters[0].(*netlink.U32).Actions).To(HaveLen(1))
+					police, ok := filters[0].(*netlink.U32).Actions[0].(*netlink.PoliceAction)
+					Expect(ok).To(BeTrue())
+					Expect(police.Rate).To(Equal(uint32(1000)))
+					Expect(police.ExceedAction).To(Equal(netlink.TC_POLICE_SHOT))
+
+					return nil
+				})).To(Succeed())
+
+				if testutils.SpecVersionHasCHECK(ver) {
+					Expect(hostNs.Do(func(_ ns.NetNS) error {
+						defer GinkgoRecover()
+						Expect(cmdCheck(args)).To(Succeed())
+						return nil
+					})).To(Succeed())
+				}
+			})
+
 			It(fmt.Sprintf("[%s] does not apply egress when disabled", ver), func() {
 				conf := fmt.Sprintf(`{
 					"cniVersion": "%s",
@@ -1044,6 +1127,168 @@ var _ = Describe("bandwidth test", func() {
 		})
 	}
 
+	Describe("cmdGC", func() {
+		It("deletes the IFB devices of the stale attachments of the network", func() {
+			conf := []byte(`{
+				"cniVersion": "1.1.0",
+				"name": "cni-plugin-bandwidth-test",
+				"type": "bandwidth",
+				"cni.dev/valid-attachments": [{"containerID": "container-a", "ifname": "eth0"}]
+			}`)
+
+			Expect(hostNs.Do(func(_ ns.NetNS) error {
+				defer GinkgoRecover()
+
+				Expect(CreateIfb("bwp-valid", 1500, getIfbAlias("cni-plugin-bandwidth-test", "container-a"))).To(Succeed())
+				Expect(CreateIfb("bwp-stale", 1500, getIfbAlias("cni-plugin-bandwidth-test", "container-b"))).To(Succeed())
+				Expect(CreateIfb("bwp-other", 1500, getIfbAlias("other-network", "container-b"))).To(Succeed())
+
+				Expect(cmdGC(&skel.CmdArgs{StdinData: conf})).To(Succeed())
+
+				_, err := netlinksafe.LinkByName("bwp-valid")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = netlinksafe.LinkByName("bwp-stale")
+				Expect(err).To(HaveOccurred())
+				_, err = netlinksafe.LinkByName("bwp-other")
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})).To(Succeed())
+		})
+	})
+
+	Describe("conflicting with existing qdiscs", func() {
+		conf := func(policy string) []byte {
+			return []byte(fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "cni-plugin-bandwidth-test",
+				"type": "bandwidth",
+				"ingressRate": 8,
+				"ingressBurst": 8,
+				"egressRate": 16,
+				"egressBurst": 8,
+				"conflictPolicy": %q,
+				"prevResult": {
+					"cniVersion": "1.0.0",
+					"interfaces": [
+						{"name": "%s", "sandbox": ""},
+						{"name": "%s", "sandbox": "%s"}
+					]
+				}
+			}`, policy, hostIfname, containerIfname, containerNs.Path()))
+		}
+
+		BeforeEach(func() {
+			// Mimic a node agent shaping the traffic with HTB and
+			// filtering it with clsact
+			Expect(hostNs.Do(func(_ ns.NetNS) error {
+				defer GinkgoRecover()
+				link, err := netlinksafe.LinkByName(hostIfname)
+				Expect(err).NotTo(HaveOccurred())
+				index := link.Attrs().Index
+
+				Expect(netlink.QdiscAdd(netlink.NewHtb(netlink.QdiscAttrs{
+					LinkIndex: index,
+					Handle:    netlink.MakeHandle(1, 0),
+					Parent:    netlink.HANDLE_ROOT,
+				}))).To(Succeed())
+				Expect(netlink.ClassAdd(netlink.NewHtbClass(netlink.ClassAttrs{
+					LinkIndex: index,
+					Handle:    netlink.MakeHandle(1, 1),
+					Parent:    netlink.MakeHandle(1, 0),
+				}, netlink.HtbClassAttrs{Rate: 1000000}))).To(Succeed())
+				Expect(netlink.ClassAdd(netlink.NewHtbClass(netlink.ClassAttrs{
+					LinkIndex: index,
+					Handle:    netlink.MakeHandle(1, 0x10),
+					Parent:    netlink.MakeHandle(1, 1),
+				}, netlink.HtbClassAttrs{Rate: 500000}))).To(Succeed())
+				Expect(netlink.QdiscAdd(&netlink.Clsact{QdiscAttrs: netlink.QdiscAttrs{
+					LinkIndex: index,
+					Handle:    netlink.MakeHandle(0xffff, 0),
+					Parent:    netlink.HANDLE_CLSACT,
+				}})).To(Succeed())
+				return nil
+			})).To(Succeed())
+		})
+
+		It("fails by default", func() {
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       containerNs.Path(),
+				IfName:      containerIfname,
+				StdinData:   conf(""),
+			}
+			Expect(hostNs.Do(func(_ ns.NetNS) error {
+				defer GinkgoRecover()
+				_, _, err := testutils.CmdAdd(containerNs.Path(), args.ContainerID, "", args.StdinData, func() error { return cmdAdd(args) })
+				Expect(err).To(MatchError(fmt.Sprintf(`host device %q already has root qdisc htb 1:0, set conflictPolicy to "graft" to shape under it`, hostIfname)))
+				return nil
+			})).To(Succeed())
+		})
+
+		It("grafts the shaper under the existing qdiscs", func() {
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       containerNs.Path(),
+				IfName:      containerIfname,
+				StdinData:   conf("graft"),
+			}
+			Expect(hostNs.Do(func(_ ns.NetNS) error {
+				defer GinkgoRecover()
+				_, out, err := testutils.CmdAdd(containerNs.Path(), args.ContainerID, "", args.StdinData, func() error { return cmdAdd(args) })
+				Expect(err).NotTo(HaveOccurred(), string(out))
+
+				link, err := netlinksafe.LinkByName(hostIfname)
+				Expect(err).NotTo(HaveOccurred())
+				qdiscs, err := netlinksafe.QdiscList(link)
+				Expect(err).NotTo(HaveOccurred())
+				parents := []uint32{}
+				for _, q := range qdiscs {
+					if tbf, ok := q.(*netlink.Tbf); ok {
+						Expect(tbf.Rate).To(Equal(uint64(1)))
+						parents = append(parents, tbf.Parent)
+					}
+				}
+				Expect(parents).To(ConsistOf(netlink.MakeHandle(1, 0x10)))
+
+				filters, err := netlinksafe.FilterList(link, netlink.HANDLE_MIN_INGRESS)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filters).To(HaveLen(1))
+				ifbLink, err := netlinksafe.LinkByName(ifbDeviceName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filters[0].(*netlink.U32).Actions[0].(*netlink.MirredAction).Ifindex).To(Equal(ifbLink.Attrs().Index))
+				return nil
+			})).To(Succeed())
+		})
+
+		It("refuses to graft the shaper under several leaf classes", func() {
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       containerNs.Path(),
+				IfName:      containerIfname,
+				StdinData:   conf("graft"),
+			}
+			Expect(hostNs.Do(func(_ ns.NetNS) error {
+				defer GinkgoRecover()
+				link, err := netlinksafe.LinkByName(hostIfname)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.ClassAdd(netlink.NewHtbClass(netlink.ClassAttrs{
+					LinkIndex: link.Attrs().Index,
+					Handle:    netlink.MakeHandle(1, 0x20),
+					Parent:    netlink.MakeHandle(1, 1),
+				}, netlink.HtbClassAttrs{Rate: 500000}))).To(Succeed())
+
+				_, _, err = testutils.CmdAdd(containerNs.Path(), args.ContainerID, "", args.StdinData, func() error { return cmdAdd(args) })
+				Expect(err).To(MatchError(fmt.Sprintf("root qdisc htb 1:0 of %q has 2 leaf classes, the shaper can only be grafted under one", hostIfname)))
+				return nil
+			})).To(Succeed())
+		})
+
+		It("rejects unknown policies", func() {
+			_, err := parseConfig(conf("replace"))
+			Expect(err).To(MatchError(`invalid conflictPolicy "replace", must be "fail" or "graft"`))
+		})
+	})
+
 	Describe("Validating input", func() {
 		It("Should allow only 4GB burst rate", func() {
 			err := validateRateAndBurst(5000, 4*1024*1024*1024*8-16) // 2 bytes less than the max should pass
@@ -0,0 +1,118 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// rootTBFHandle is the handle of the TBF the plugin adds at the root
+var rootTBFHandle = netlink.MakeHandle(1, 0)
+
+const (
+	// conflictPolicyFail fails when the host device already has qdiscs
+	// installed by someone else, such as a node agent
+	conflictPolicyFail = "fail"
+	// conflictPolicyGraft shapes the traffic under the existing qdiscs: the
+	// TBF is grafted under the single leaf class of the root qdisc, and the
+	// redirect filter is added to the existing ingress or clsact qdisc
+	conflictPolicyGraft = "graft"
+)
+
+func validateConflictPolicy(policy string) error {
+	switch policy {
+	case "", conflictPolicyFail, conflictPolicyGraft:
+		return nil
+	}
+	return fmt.Errorf("invalid conflictPolicy %q, must be %q or %q", policy, conflictPolicyFail, conflictPolicyGraft)
+}
+
+// ownsRootQdisc reports whether the root qdisc was added by the plugin
+func ownsRootQdisc(q netlink.Qdisc) bool {
+	if _, ok := q.(*netlink.Tbf); ok && q.Attrs().Handle == rootTBFHandle {
+		return true
+	}
+	return ip.OwnsQdisc(q)
+}
+
+// foreignRootQdisc returns the root qdisc of the link when it was installed
+// by someone else. The default qdiscs of the kernel have no handle.
+func foreignRootQdisc(link netlink.Link) (netlink.Qdisc, error) {
+	qdiscs, err := netlinksafe.QdiscList(link)
+	if err != nil {
+		return nil, fmt.Errorf("list qdiscs: %s", err)
+	}
+	for _, q := range qdiscs {
+		if q.Attrs().Parent == netlink.HANDLE_ROOT && q.Attrs().Handle != 0 && !ownsRootQdisc(q) {
+			return q, nil
+		}
+	}
+	return nil, nil
+}
+
+// existingIngressQdisc returns the ingress or clsact qdisc of the link, if
+// any
+func existingIngressQdisc(link netlink.Link) (netlink.Qdisc, error) {
+	qdiscs, err := netlinksafe.QdiscList(link)
+	if err != nil {
+		return nil, fmt.Errorf("list qdiscs: %s", err)
+	}
+	for _, q := range qdiscs {
+		if q.Attrs().Parent == netlink.HANDLE_INGRESS {
+			return q, nil
+		}
+	}
+	return nil, nil
+}
+
+// leafClasses returns the classes of the qdisc without child classes
+func leafClasses(link netlink.Link, qdisc netlink.Qdisc) ([]netlink.Class, error) {
+	classes, err := netlinksafe.ClassList(link, 0)
+	if err != nil {
+		return nil, fmt.Errorf("list classes: %s", err)
+	}
+	major, _ := netlink.MajorMinor(qdisc.Attrs().Handle)
+	parents := map[uint32]bool{}
+	for _, c := range classes {
+		parents[c.Attrs().Parent] = true
+	}
+	var leaves []netlink.Class
+	for _, c := range classes {
+		if m, _ := netlink.MajorMinor(c.Attrs().Handle); m == major && !parents[c.Attrs().Handle] {
+			leaves = append(leaves, c)
+		}
+	}
+	return leaves, nil
+}
+
+// graftTBF replaces the qdisc of the leaf class of the root qdisc by the
+// TBF. Shaping each of several leaves at the rate would let the traffic
+// through at a multiple of it, so the root qdisc must have a single leaf.
+func graftTBF(rateInBits, burstInBits uint64, link netlink.Link, root netlink.Qdisc) error {
+	leaves, err := leafClasses(link, root)
+	if err != nil {
+		return err
+	}
+	if len(leaves) != 1 {
+		return fmt.Errorf("root qdisc %s %s of %q has %d leaf classes, the shaper can only be grafted under one",
+			root.Type(), netlink.HandleStr(root.Attrs().Handle), link.Attrs().Name, len(leaves))
+	}
+	return addTBF(rateInBits, burstInBits, link.Attrs().Index, leaves[0].Attrs().Handle)
+}
@@ -15,7 +15,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"syscall"
 
@@ -27,7 +29,7 @@ import (
 
 const latencyInMillis = 25
 
-func CreateIfb(ifbDeviceName string, mtu int) error {
+func CreateIfb(ifbDeviceName string, mtu int, alias string) error {
 	// do not set TxQLen > 0 nor TxQLen == -1 until issues have been fixed with numrxqueues / numtxqueues across interfaces
 	// which needs to get set on IFB devices via upstream library: see hint https://github.com/containernetworking/plugins/pull/1097
 	err := netlink.LinkAdd(&netlink.Ifb{
@@ -42,6 +44,15 @@ func CreateIfb(ifbDeviceName string, mtu int) error {
 		return fmt.Errorf("adding link: %s", err)
 	}
 
+	// the alias is not taken into account when adding the link
+	ifbDevice, err := netlinksafe.LinkByName(ifbDeviceName)
+	if err != nil {
+		return fmt.Errorf("get ifb device: %s", err)
+	}
+	if err := netlink.LinkSetAlias(ifbDevice, alias); err != nil {
+		return fmt.Errorf("setting alias: %s", err)
+	}
+
 	return nil
 }
 
@@ -53,24 +64,29 @@ func TeardownIfb(deviceName string) error {
 	return err
 }
 
-func CreateIngressQdisc(rateInBits, burstInBits uint64, hostDeviceName string) error {
+func CreateIngressQdisc(rateInBits, burstInBits uint64, hostDeviceName string, conflictPolicy string) error {
 	hostDevice, err := netlinksafe.LinkByName(hostDeviceName)
 	if err != nil {
 		return fmt.Errorf("get host device: %s", err)
 	}
-	return createTBF(rateInBits, burstInBits, hostDevice.Attrs().Index)
-}
-
-func CreateEgressQdisc(rateInBits, burstInBits uint64, hostDeviceName string, ifbDeviceName string) error {
-	ifbDevice, err := netlinksafe.LinkByName(ifbDeviceName)
+	root, err := foreignRootQdisc(hostDevice)
 	if err != nil {
-		return fmt.Errorf("get ifb device: %s", err)
+		return err
 	}
-	hostDevice, err := netlinksafe.LinkByName(hostDeviceName)
-	if err != nil {
-		return fmt.Errorf("get host device: %s", err)
+	if root != nil {
+		if conflictPolicy != conflictPolicyGraft {
+			return fmt.Errorf("host device %q already has root qdisc %s %s, set conflictPolicy to %q to shape under it",
+				hostDeviceName, root.Type(), netlink.HandleStr(root.Attrs().Handle), conflictPolicyGraft)
+		}
+		return graftTBF(rateInBits, burstInBits, hostDevice, root)
 	}
+	return createTBF(rateInBits, burstInBits, hostDevice.Attrs().Index)
+}
 
+// ingressFilterParent returns the parent of the filters of the traffic
+// leaving the container, adding an ingress qdisc to the host device unless
+// conflictPolicy lets the filters go under an existing one
+func ingressFilterParent(hostDevice netlink.Link, conflictPolicy string) (netlink.Qdisc, uint32, error) {
 	// add qdisc ingress on host device
 	ingress := &netlink.Ingress{
 		QdiscAttrs: netlink.QdiscAttrs{
@@ -80,16 +96,47 @@ func CreateEgressQdisc(rateInBits, burstInBits uint64, hostDeviceName string, if
 		},
 	}
 
-	err = netlink.QdiscAdd(ingress)
+	existing, err := existingIngressQdisc(hostDevice)
 	if err != nil {
-		return fmt.Errorf("create ingress qdisc: %s", err)
+		return nil, 0, err
+	}
+	switch {
+	case existing == nil:
+		err = netlink.QdiscAdd(ingress)
+		if err != nil {
+			return nil, 0, fmt.Errorf("create ingress qdisc: %s", err)
+		}
+		return ingress, ingress.QdiscAttrs.Handle, nil
+	case conflictPolicy != conflictPolicyGraft:
+		return nil, 0, fmt.Errorf("host device %q already has %s qdisc, set conflictPolicy to %q to redirect through it",
+			hostDevice.Attrs().Name, existing.Type(), conflictPolicyGraft)
+	case existing.Type() == "clsact":
+		return nil, netlink.HANDLE_MIN_INGRESS, nil
+	default:
+		return nil, existing.Attrs().Handle, nil
+	}
+}
+
+func CreateEgressQdisc(rateInBits, burstInBits uint64, hostDeviceName string, ifbDeviceName string, conflictPolicy string) error {
+	ifbDevice, err := netlinksafe.LinkByName(ifbDeviceName)
+	if err != nil {
+		return fmt.Errorf("get ifb device: %s", err)
+	}
+	hostDevice, err := netlinksafe.LinkByName(hostDeviceName)
+	if err != nil {
+		return fmt.Errorf("get host device: %s", err)
+	}
+
+	_, filterParent, err := ingressFilterParent(hostDevice, conflictPolicy)
+	if err != nil {
+		return err
 	}
 
 	// add filter on host device to mirror traffic to ifb device
 	filter := &netlink.U32{
 		FilterAttrs: netlink.FilterAttrs{
 			LinkIndex: hostDevice.Attrs().Index,
-			Parent:    ingress.QdiscAttrs.Handle,
+			Parent:    filterParent,
 			Priority:  1,
 			Protocol:  syscall.ETH_P_ALL,
 		},
@@ -116,11 +163,74 @@ func CreateEgressQdisc(rateInBits, burstInBits uint64, hostDeviceName string, if
 	return nil
 }
 
+// canPolice reports whether the rate fits the policer, whose rate is in
+// bytes per second on 32 bits
+func canPolice(rateInBits uint64) bool {
+	return rateInBits/8 <= math.MaxUint32
+}
+
+// policerMTU is the largest packet the policer lets through, sized for the
+// GSO packets of the veth
+const policerMTU = 64 * 1024
+
+// CreateEgressPolicer limits the traffic leaving the container with a
+// policer on the ingress of the host device, which spares the IFB device.
+// The policer drops the packets over the rate rather than queueing them, so
+// it is only used when the configuration asks for it.
+func CreateEgressPolicer(rateInBits, burstInBits uint64, hostDeviceName string, conflictPolicy string) error {
+	if rateInBits <= 0 {
+		return fmt.Errorf("invalid rate: %d", rateInBits)
+	}
+	if burstInBits <= 0 {
+		return fmt.Errorf("invalid burst: %d", burstInBits)
+	}
+	hostDevice, err := netlinksafe.LinkByName(hostDeviceName)
+	if err != nil {
+		return fmt.Errorf("get host device: %s", err)
+	}
+
+	added, filterParent, err := ingressFilterParent(hostDevice, conflictPolicy)
+	if err != nil {
+		return err
+	}
+
+	police := netlink.NewPoliceAction()
+	police.Rate = uint32(rateInBits / 8)
+	police.Burst = uint32(burstInBits / 8)
+	police.Mtu = policerMTU
+	police.ExceedAction = netlink.TC_POLICE_SHOT
+	filter := &netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: hostDevice.Attrs().Index,
+			Parent:    filterParent,
+			Priority:  1,
+			Protocol:  syscall.ETH_P_ALL,
+		},
+		Actions: []netlink.Action{police},
+	}
+	if err := netlink.FilterAdd(filter); err != nil {
+		if errors.Is(err, syscall.ENOENT) {
+			if added != nil {
+				_ = netlink.QdiscDel(added)
+			}
+			return fmt.Errorf("add filter: police action unavailable: %s", err)
+		}
+		return fmt.Errorf("add filter: %s", err)
+	}
+	return nil
+}
+
 func createTBF(rateInBits, burstInBits uint64, linkIndex int) error {
 	// Equivalent to
 	// tc qdisc add dev link root tbf
 	//		rate netConf.BandwidthLimits.Rate
 	//		burst netConf.BandwidthLimits.Burst
+	return addTBF(rateInBits, burstInBits, linkIndex, netlink.HANDLE_ROOT)
+}
+
+// addTBF adds the TBF at the root of the link, or replaces the qdisc of the
+// parent class with it
+func addTBF(rateInBits, burstInBits uint64, linkIndex int, parent uint32) error {
 	if rateInBits <= 0 {
 		return fmt.Errorf("invalid rate: %d", rateInBits)
 	}
@@ -133,17 +243,33 @@ func createTBF(rateInBits, burstInBits uint64, linkIndex int) error {
 	latency := latencyInUsec(latencyInMillis)
 	limitInBytes := limit(rateInBytes, latency, uint32(burstInBytes))
 
+	// The TBF at the root keeps the handle of the previous versions, which
+	// CHECK and DEL of their attachments rely on
+	tbfHandle := rootTBFHandle
+	if parent != netlink.HANDLE_ROOT {
+		var err error
+		tbfHandle, err = ip.OwnedQdiscHandle(0)
+		if err != nil {
+			return err
+		}
+	}
+
 	qdisc := &netlink.Tbf{
 		QdiscAttrs: netlink.QdiscAttrs{
 			LinkIndex: linkIndex,
-			Handle:    netlink.MakeHandle(1, 0),
-			Parent:    netlink.HANDLE_ROOT,
+			Handle:    tbfHandle,
+			Parent:    parent,
 		},
 		Limit:  limitInBytes,
 		Rate:   rateInBytes,
 		Buffer: bufferInBytes,
 	}
-	err := netlink.QdiscAdd(qdisc)
+	var err error
+	if parent == netlink.HANDLE_ROOT {
+		err = netlink.QdiscAdd(qdisc)
+	} else {
+		err = netlink.QdiscReplace(qdisc)
+	}
 	if err != nil {
 		return fmt.Errorf("create qdisc: %s", err)
 	}
@@ -16,8 +16,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 
 	"github.com/vishvananda/netlink"
 
@@ -35,6 +37,9 @@ import (
 const (
 	maxIfbDeviceLength = 15
 	ifbDevicePrefix    = "bwp"
+	// ifbAliasPrefix starts the alias of the IFB devices, which names the
+	// network and the container they shape so that GC can find them
+	ifbAliasPrefix = "cni-bandwidth:"
 )
 
 // BandwidthEntry corresponds to a single entry in the bandwidth argument,
@@ -51,6 +56,16 @@ func (bw *BandwidthEntry) isZero() bool {
 	return bw.IngressBurst == 0 && bw.IngressRate == 0 && bw.EgressBurst == 0 && bw.EgressRate == 0
 }
 
+// hasIngress reports whether the traffic to the container is limited
+func (bw *BandwidthEntry) hasIngress() bool {
+	return bw.IngressRate > 0 && bw.IngressBurst > 0
+}
+
+// hasEgress reports whether the traffic from the container is limited
+func (bw *BandwidthEntry) hasEgress() bool {
+	return bw.EgressRate > 0 && bw.EgressBurst > 0
+}
+
 type PluginConf struct {
 	types.NetConf
 
@@ -59,6 +74,15 @@ type PluginConf struct {
 	} `json:"runtimeConfig,omitempty"`
 
 	*BandwidthEntry
+
+	// ConflictPolicy is what to do when the host device already has qdiscs
+	// installed by someone else, "fail" (default) or "graft"
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// EgressPolicer polices the traffic leaving the container on the host
+	// device instead of shaping it through an IFB device. The packets over
+	// the rate are dropped rather than queued.
+	EgressPolicer bool `json:"egressPolicer,omitempty"`
 }
 
 // parseConfig parses the supplied configuration (and prevResult) from stdin.
@@ -69,6 +93,10 @@ func parseConfig(stdin []byte) (*PluginConf, error) {
 		return nil, fmt.Errorf("failed to parse network configuration: %v", err)
 	}
 
+	if err := validateConflictPolicy(conf.ConflictPolicy); err != nil {
+		return nil, err
+	}
+
 	bandwidth := getBandwidth(&conf)
 	if bandwidth != nil {
 		err := validateRateAndBurst(bandwidth.IngressRate, bandwidth.IngressBurst)
@@ -79,6 +107,9 @@ func parseConfig(stdin []byte) (*PluginConf, error) {
 		if err != nil {
 			return nil, err
 		}
+		if conf.EgressPolicer && bandwidth.hasEgress() && !canPolice(bandwidth.EgressRate) {
+			return nil, fmt.Errorf("egress rate %d is too high for the policer", bandwidth.EgressRate)
+		}
 	}
 
 	if conf.RawPrevResult != nil {
@@ -120,6 +151,10 @@ func getIfbDeviceName(networkName string, containerID string) string {
 	return utils.MustFormatHashWithPrefix(maxIfbDeviceLength, ifbDevicePrefix, networkName+containerID)
 }
 
+func getIfbAlias(networkName string, containerID string) string {
+	return ifbAliasPrefix + networkName + ":" + containerID
+}
+
 func getMTU(deviceName string) (int, error) {
 	link, err := netlinksafe.LinkByName(deviceName)
 	if err != nil {
@@ -191,14 +226,21 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 
-	if bandwidth.IngressRate > 0 && bandwidth.IngressBurst > 0 {
-		err = CreateIngressQdisc(bandwidth.IngressRate, bandwidth.IngressBurst, hostInterface.Name)
+	if bandwidth.hasIngress() {
+		err = CreateIngressQdisc(bandwidth.IngressRate, bandwidth.IngressBurst, hostInterface.Name, conf.ConflictPolicy)
 		if err != nil {
 			return err
 		}
 	}
 
-	if bandwidth.EgressRate > 0 && bandwidth.EgressBurst > 0 {
+	if bandwidth.hasEgress() && conf.EgressPolicer {
+		err = CreateEgressPolicer(bandwidth.EgressRate, bandwidth.EgressBurst, hostInterface.Name, conf.ConflictPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	if bandwidth.hasEgress() && !conf.EgressPolicer {
 		mtu, err := getMTU(hostInterface.Name)
 		if err != nil {
 			return err
@@ -206,7 +248,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 		ifbDeviceName := getIfbDeviceName(conf.Name, args.ContainerID)
 
-		err = CreateIfb(ifbDeviceName, mtu)
+		err = CreateIfb(ifbDeviceName, mtu, getIfbAlias(conf.Name, args.ContainerID))
 		if err != nil {
 			return err
 		}
@@ -220,7 +262,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 			Name: ifbDeviceName,
 			Mac:  ifbDevice.Attrs().HardwareAddr.String(),
 		})
-		err = CreateEgressQdisc(bandwidth.EgressRate, bandwidth.EgressBurst, hostInterface.Name, ifbDeviceName)
+		err = CreateEgressQdisc(bandwidth.EgressRate, bandwidth.EgressBurst, hostInterface.Name, ifbDeviceName, conf.ConflictPolicy)
 		if err != nil {
 			return err
 		}
@@ -240,12 +282,43 @@ func cmdDel(args *skel.CmdArgs) error {
 	return TeardownIfb(ifbDeviceName)
 }
 
+// cmdGC deletes the IFB devices of the network whose containers are not in
+// the list of valid attachments
+func cmdGC(args *skel.CmdArgs) error {
+	conf, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[string]bool, len(conf.ValidAttachments))
+	for _, a := range conf.ValidAttachments {
+		valid[getIfbAlias(conf.Name, a.ContainerID)] = true
+	}
+
+	links, err := netlinksafe.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links: %v", err)
+	}
+	prefix := getIfbAlias(conf.Name, "")
+	var errs []error
+	for _, link := range links {
+		alias := link.Attrs().Alias
+		if link.Type() != "ifb" || !strings.HasPrefix(alias, prefix) || valid[alias] {
+			continue
+		}
+		if err := TeardownIfb(link.Attrs().Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func main() {
 	skel.PluginMainFuncs(skel.CNIFuncs{
 		Add:   cmdAdd,
 		Check: cmdCheck,
 		Del:   cmdDel,
-		/* FIXME GC */
+		GC:    cmdGC,
 		/* FIXME Status */
 	}, version.VersionsStartingFrom("0.3.0"), bv.BuildString("bandwidth"))
 }
@@ -304,76 +377,103 @@ func cmdCheck(args *skel.CmdArgs) error {
 		return nil
 	}
 
-	if bandwidth.IngressRate > 0 && bandwidth.IngressBurst > 0 {
-		rateInBytes := bandwidth.IngressRate / 8
-		burstInBytes := bandwidth.IngressBurst / 8
-		bufferInBytes := buffer(rateInBytes, uint32(burstInBytes))
-		latency := latencyInUsec(latencyInMillis)
-		limitInBytes := limit(rateInBytes, latency, uint32(burstInBytes))
-
-		qdiscs, err := SafeQdiscList(link)
-		if err != nil {
+	if bandwidth.hasIngress() {
+		if err := checkTBF(link, bandwidth.IngressRate, bandwidth.IngressBurst); err != nil {
 			return err
 		}
-		if len(qdiscs) == 0 {
-			return fmt.Errorf("Failed to find qdisc")
-		}
-
-		for _, qdisc := range qdiscs {
-			tbf, isTbf := qdisc.(*netlink.Tbf)
-			if !isTbf {
-				break
-			}
-			if tbf.Rate != rateInBytes {
-				return fmt.Errorf("Rate doesn't match")
-			}
-			if tbf.Limit != limitInBytes {
-				return fmt.Errorf("Limit doesn't match")
-			}
-			if tbf.Buffer != bufferInBytes {
-				return fmt.Errorf("Buffer doesn't match")
-			}
-		}
 	}
 
-	if bandwidth.EgressRate > 0 && bandwidth.EgressBurst > 0 {
-		rateInBytes := bandwidth.EgressRate / 8
-		burstInBytes := bandwidth.EgressBurst / 8
-		bufferInBytes := buffer(rateInBytes, uint32(burstInBytes))
-		latency := latencyInUsec(latencyInMillis)
-		limitInBytes := limit(rateInBytes, latency, uint32(burstInBytes))
+	if bandwidth.hasEgress() && bwConf.EgressPolicer {
+		return checkPolicer(link, bandwidth.EgressRate, bandwidth.EgressBurst)
+	}
 
+	if bandwidth.hasEgress() {
 		ifbDeviceName := getIfbDeviceName(bwConf.Name, args.ContainerID)
 
 		ifbDevice, err := netlinksafe.LinkByName(ifbDeviceName)
 		if err != nil {
 			return fmt.Errorf("get ifb device: %s", err)
 		}
-
-		qdiscs, err := SafeQdiscList(ifbDevice)
-		if err != nil {
+		if err := checkTBF(ifbDevice, bandwidth.EgressRate, bandwidth.EgressBurst); err != nil {
 			return err
 		}
-		if len(qdiscs) == 0 {
-			return fmt.Errorf("Failed to find qdisc")
+	}
+
+	return nil
+}
+
+// checkTBF verifies the TBF qdiscs of the link against the rate and burst
+func checkTBF(link netlink.Link, rateInBits, burstInBits uint64) error {
+	rateInBytes := rateInBits / 8
+	burstInBytes := burstInBits / 8
+	bufferInBytes := buffer(rateInBytes, uint32(burstInBytes))
+	latency := latencyInUsec(latencyInMillis)
+	limitInBytes := limit(rateInBytes, latency, uint32(burstInBytes))
+
+	qdiscs, err := SafeQdiscList(link)
+	if err != nil {
+		return err
+	}
+	if len(qdiscs) == 0 {
+		return fmt.Errorf("Failed to find qdisc")
+	}
+
+	for _, qdisc := range qdiscs {
+		tbf, isTbf := qdisc.(*netlink.Tbf)
+		if !isTbf {
+			break
 		}
+		if tbf.Rate != rateInBytes {
+			return fmt.Errorf("Rate doesn't match")
+		}
+		if tbf.Limit != limitInBytes {
+			return fmt.Errorf("Limit doesn't match")
+		}
+		if tbf.Buffer != bufferInBytes {
+			return fmt.Errorf("Buffer doesn't match")
+		}
+	}
+	return nil
+}
+
+// checkPolicer verifies the policer of the traffic leaving the container
+// against the rate and burst
+func checkPolicer(link netlink.Link, rateInBits, burstInBits uint64) error {
+	ingress, err := existingIngressQdisc(link)
+	if err != nil {
+		return err
+	}
+	if ingress == nil {
+		return fmt.Errorf("Failed to find ingress qdisc")
+	}
+	parent := ingress.Attrs().Handle
+	if ingress.Type() == "clsact" {
+		parent = netlink.HANDLE_MIN_INGRESS
+	}
 
-		for _, qdisc := range qdiscs {
-			tbf, isTbf := qdisc.(*netlink.Tbf)
-			if !isTbf {
-				break
+	filters, err := netlinksafe.FilterList(link, parent)
+	if err != nil {
+		return fmt.Errorf("list filters: %s", err)
+	}
+	for _, filter := range filters {
+		u32, ok := filter.(*netlink.U32)
+		if !ok {
+			continue
+		}
+		for _, action := range u32.Actions {
+			police, ok := action.(*netlink.PoliceAction)
+			if !ok {
+				continue
 			}
-			if tbf.Rate != rateInBytes {
+			if police.Rate != uint32(rateInBits/8) {
 				return fmt.Errorf("Rate doesn't match")
 			}
-			if tbf.Limit != limitInBytes {
-				return fmt.Errorf("Limit doesn't match")
-			}
-			if tbf.Buffer != bufferInBytes {
-				return fmt.Errorf("Buffer doesn't match")
+			// The burst comes back through the ticks of the kernel
+			if police.Burst != netlink.Xmitsize(uint64(police.Rate), netlink.Xmittime(uint64(police.Rate), uint32(burstInBits/8))) {
+				return fmt.Errorf("Burst doesn't match")
 			}
+			return nil
 		}
 	}
-
-	return nil
+	return fmt.Errorf("Failed to find policer")
 }
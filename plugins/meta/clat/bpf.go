@@ -0,0 +1,292 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The helpers called by the programs, of enum bpf_func_id
+const (
+	fnSkbStoreBytes  = 9
+	fnL4CsumReplace  = 11
+	fnRedirect       = 23
+	fnSkbLoadBytes   = 26
+	fnCsumDiff       = 28
+	fnSkbChangeProto = 31
+	fnCsumUpdate     = 40
+	fnSkbChangeHead  = 43
+	fnRedirectNeigh  = 152
+)
+
+// The verdicts of the sched_cls programs in direct-action mode
+const (
+	tcActOK       = 0
+	tcActShot     = 2
+	tcActRedirect = 7
+)
+
+// skbProtocolOffset is the offset of the protocol of struct __sk_buff
+const skbProtocolOffset = 16
+
+// reg is an eBPF register. r0 holds the return values, r1 to r5 the
+// arguments of the helpers, which clobber them, r6 to r9 are preserved
+// across calls and r10 is the read-only frame pointer.
+type reg uint8
+
+const (
+	r0 reg = iota
+	r1
+	r2
+	r3
+	r4
+	r5
+	r6
+	r7
+	r8
+	r9
+	r10
+)
+
+// insn is an eBPF instruction, struct bpf_insn
+type insn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// be16 and be32 return the value of the bytes in network order as loaded
+// by the programs, in native order
+func be16(b ...byte) int32 {
+	return int32(binary.NativeEndian.Uint16(b))
+}
+
+func be32(b []byte) int32 {
+	return int32(binary.NativeEndian.Uint32(b))
+}
+
+// program assembles the instructions of an eBPF program. The jumps refer to
+// labels, resolved once the program is complete.
+type program struct {
+	insns  []insn
+	labels map[string]int
+	jumps  map[int]string
+}
+
+func newProgram() *program {
+	return &program{labels: map[string]int{}, jumps: map[int]string{}}
+}
+
+func (p *program) emit(code uint8, dst, src reg, off int16, imm int32) {
+	// The register fields are bit-fields, dst_reg comes first
+	regs := uint8(dst) | uint8(src)<<4
+	if !littleEndian {
+		regs = uint8(src) | uint8(dst)<<4
+	}
+	p.insns = append(p.insns, insn{code: code, regs: regs, off: off, imm: imm})
+}
+
+func (p *program) movImm(dst reg, imm int32) {
+	p.emit(unix.BPF_ALU64|unix.BPF_MOV|unix.BPF_K, dst, 0, 0, imm)
+}
+
+func (p *program) mov(dst, src reg) {
+	p.emit(unix.BPF_ALU64|unix.BPF_MOV|unix.BPF_X, dst, src, 0, 0)
+}
+
+// alu applies the operation with the immediate to the register
+func (p *program) alu(op uint8, dst reg, imm int32) {
+	p.emit(unix.BPF_ALU64|op|unix.BPF_K, dst, 0, 0, imm)
+}
+
+func (p *program) aluReg(op uint8, dst, src reg) {
+	p.emit(unix.BPF_ALU64|op|unix.BPF_X, dst, src, 0, 0)
+}
+
+// swap converts the lower bits of the register between native and network
+// order, clearing the upper bits
+func (p *program) swap(dst reg, bits int32) {
+	p.emit(unix.BPF_ALU|unix.BPF_END|unix.BPF_TO_BE, dst, 0, 0, bits)
+}
+
+// load loads the register from memory, size is unix.BPF_B, BPF_H, BPF_W or
+// BPF_DW
+func (p *program) load(size uint8, dst, src reg, off int16) {
+	p.emit(unix.BPF_LDX|unix.BPF_MEM|size, dst, src, off, 0)
+}
+
+func (p *program) store(size uint8, dst reg, off int16, src reg) {
+	p.emit(unix.BPF_STX|unix.BPF_MEM|size, dst, src, off, 0)
+}
+
+func (p *program) storeImm(size uint8, dst reg, off int16, imm int32) {
+	p.emit(unix.BPF_ST|unix.BPF_MEM|size, dst, 0, off, imm)
+}
+
+// jump jumps to the label if the comparison of the register with the
+// immediate holds
+func (p *program) jump(op uint8, dst reg, imm int32, label string) {
+	p.jumps[len(p.insns)] = label
+	p.emit(unix.BPF_JMP|op|unix.BPF_K, dst, 0, 0, imm)
+}
+
+// jump32 compares the lower 32 bits of the register
+func (p *program) jump32(op uint8, dst reg, imm int32, label string) {
+	p.jumps[len(p.insns)] = label
+	p.emit(unix.BPF_JMP32|op|unix.BPF_K, dst, 0, 0, imm)
+}
+
+func (p *program) goTo(label string) {
+	p.jumps[len(p.insns)] = label
+	p.emit(unix.BPF_JMP|unix.BPF_JA, 0, 0, 0, 0)
+}
+
+func (p *program) call(fn int32) {
+	p.emit(unix.BPF_JMP|unix.BPF_CALL, 0, 0, 0, fn)
+}
+
+// ret returns the value
+func (p *program) ret(value int32) {
+	p.movImm(r0, value)
+	p.emit(unix.BPF_JMP|unix.BPF_EXIT, 0, 0, 0, 0)
+}
+
+// exit returns r0
+func (p *program) exit() {
+	p.emit(unix.BPF_JMP|unix.BPF_EXIT, 0, 0, 0, 0)
+}
+
+func (p *program) label(name string) {
+	p.labels[name] = len(p.insns)
+}
+
+// stackAddr sets the register to the address at off of the frame pointer
+func (p *program) stackAddr(dst reg, off int16) {
+	p.mov(dst, r10)
+	p.alu(unix.BPF_ADD, dst, int32(off))
+}
+
+// assemble resolves the jumps
+func (p *program) assemble() ([]insn, error) {
+	insns := append([]insn(nil), p.insns...)
+	for i, label := range p.jumps {
+		target, ok := p.labels[label]
+		if !ok {
+			return nil, fmt.Errorf("undefined label %q", label)
+		}
+		insns[i].off = int16(target - i - 1)
+	}
+	return insns, nil
+}
+
+// bpfProgLoadAttr is the head of the attr of BPF_PROG_LOAD
+type bpfProgLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+	progName    [unix.BPF_OBJ_NAME_LEN]byte
+}
+
+func bpfProgLoad(insns []insn, name string, log []byte) (int, error) {
+	license := []byte("Apache-2.0\x00")
+	attr := bpfProgLoadAttr{
+		progType: unix.BPF_PROG_TYPE_SCHED_CLS,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	copy(attr.progName[:unix.BPF_OBJ_NAME_LEN-1], name)
+	if len(log) > 0 {
+		attr.logLevel = 1
+		attr.logSize = uint32(len(log))
+		attr.logBuf = uint64(uintptr(unsafe.Pointer(&log[0])))
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	runtime.KeepAlive(log)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// loadProgram loads the program as a sched_cls program and returns its file
+// descriptor. The error holds the log of the verifier when it rejects it.
+func (p *program) loadProgram(name string) (int, error) {
+	insns, err := p.assemble()
+	if err != nil {
+		return -1, fmt.Errorf("failed to assemble program %s: %v", name, err)
+	}
+	fd, err := bpfProgLoad(insns, name, nil)
+	if err == nil {
+		return fd, nil
+	}
+	if err == unix.EACCES || err == unix.EINVAL {
+		log := make([]byte, 1<<16)
+		if _, logErr := bpfProgLoad(insns, name, log); logErr != nil {
+			n := 0
+			for n < len(log) && log[n] != 0 {
+				n++
+			}
+			return -1, fmt.Errorf("failed to load program %s: %v: %s", name, err, log[:n])
+		}
+	}
+	return -1, fmt.Errorf("failed to load program %s: %v", name, err)
+}
+
+// bpfProgInfo is the head of struct bpf_prog_info, the kernel fills in what
+// fits
+type bpfProgInfo struct {
+	typ uint32
+	id  uint32
+	tag [unix.BPF_TAG_SIZE]byte
+}
+
+// progTag returns the tag of the program, the hash of its instructions, as
+// reported for the tc filters
+func progTag(fd int) (string, error) {
+	info := &bpfProgInfo{}
+	attr := struct {
+		bpfFd   uint32
+		infoLen uint32
+		info    uint64
+	}{
+		bpfFd:   uint32(fd),
+		infoLen: uint32(unsafe.Sizeof(*info)),
+		info:    uint64(uintptr(unsafe.Pointer(info))),
+	}
+	_, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_OBJ_GET_INFO_BY_FD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(info)
+	if errno != 0 {
+		return "", errno
+	}
+	return hex.EncodeToString(info.tag[:]), nil
+}
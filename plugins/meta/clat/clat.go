@@ -0,0 +1,345 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const (
+	// headerGrowth is the growth of the packets translated to IPv6: the
+	// IPv6 header is 20 bytes longer, and a fragment header may be added
+	headerGrowth = 28
+
+	// filterName names the filters of the CLAT, so that DEL finds them
+	filterName = "clat"
+	tcPriority = 1
+
+	egressProgramName  = "clat_egress"
+	ingressProgramName = "clat_ingress"
+)
+
+// clatDeviceName returns the name of the CLAT device of the interface,
+// which carries the IPv4 address and routes of the container
+func clatDeviceName(ifName string) string {
+	name := "v4-" + ifName
+	if len(name) > unix.IFNAMSIZ-1 {
+		name = name[:unix.IFNAMSIZ-1]
+	}
+	return name
+}
+
+func ipv4Host(addr net.IP) *net.IPNet {
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(32, 32)}
+}
+
+func ipv6Host(addr net.IP) *net.IPNet {
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(128, 128)}
+}
+
+func defaultIPv4Route(link netlink.Link) *netlink.Route {
+	return &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+		Scope:     netlink.SCOPE_LINK,
+	}
+}
+
+// hasAddr reports whether the link has the address, with any prefix
+func hasAddr(link netlink.Link, addr net.IP) (bool, error) {
+	addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return false, fmt.Errorf("failed to list addresses of %q: %v", link.Attrs().Name, err)
+	}
+	for _, a := range addrs {
+		if a.IP.Equal(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// l3Offset returns the offset of the IPv6 header in the packets seen at
+// the ingress of the interface, which must be an ethernet one
+func l3Offset(link netlink.Link) (int32, error) {
+	if link.Attrs().EncapType != "ether" {
+		return 0, fmt.Errorf("clat requires an ethernet interface, %q is %s", link.Attrs().Name, link.Attrs().EncapType)
+	}
+	return etherHeaderLen, nil
+}
+
+// programs returns the programs of the CLAT device and of the interface
+func programs(conf *CLATConf, clat, link netlink.Link) (egress, ingress *program, err error) {
+	l3, err := l3Offset(link)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The packets leaving the CLAT device have no link layer header
+	egress = egressProgram(conf, 0, link.Attrs().Index)
+	ingress = ingressProgram(conf, l3, clat.Attrs().Index)
+	return egress, ingress, nil
+}
+
+// addClsact adds a clsact qdisc to the link, unless it has one
+func addClsact(link netlink.Link) error {
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscAdd(qdisc); err != nil && !errors.Is(err, syscall.EEXIST) {
+		return fmt.Errorf("failed to add clsact qdisc to %q: %v", link.Attrs().Name, err)
+	}
+	return nil
+}
+
+// attachProgram loads the program and attaches it to a hook of the link
+func attachProgram(link netlink.Link, parent uint32, prog *program, name string) error {
+	if err := addClsact(link); err != nil {
+		return err
+	}
+	fd, err := prog.loadProgram(name)
+	if err != nil {
+		return err
+	}
+	// The filter holds its own reference on the program
+	defer unix.Close(fd)
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    parent,
+			Priority:  tcPriority,
+			Protocol:  unix.ETH_P_ALL,
+		},
+		Fd:           fd,
+		Name:         filterName,
+		DirectAction: true,
+	}
+	if err := netlink.FilterAdd(filter); err != nil {
+		return fmt.Errorf("failed to attach program %s to %q: %v", name, link.Attrs().Name, err)
+	}
+	return nil
+}
+
+// detachPrograms removes the filters of the CLAT from a hook of the link
+func detachPrograms(link netlink.Link, parent uint32) error {
+	filters, err := netlinksafe.FilterList(link, parent)
+	if err != nil {
+		return fmt.Errorf("failed to list filters of %q: %v", link.Attrs().Name, err)
+	}
+	for _, f := range filters {
+		if bpf, ok := f.(*netlink.BpfFilter); ok && bpf.Name == filterName {
+			if err := netlink.FilterDel(f); err != nil {
+				return fmt.Errorf("failed to remove filter of %q: %v", link.Attrs().Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkProgram checks that the program is the one attached to a hook of
+// the link, comparing their tags
+func checkProgram(link netlink.Link, parent uint32, prog *program, name string) error {
+	fd, err := prog.loadProgram(name)
+	if err != nil {
+		return err
+	}
+	tag, err := progTag(fd)
+	unix.Close(fd)
+	if err != nil {
+		return fmt.Errorf("failed to get the tag of program %s: %v", name, err)
+	}
+
+	filters, err := netlinksafe.FilterList(link, parent)
+	if err != nil {
+		return fmt.Errorf("failed to list filters of %q: %v", link.Attrs().Name, err)
+	}
+	for _, f := range filters {
+		if bpf, ok := f.(*netlink.BpfFilter); ok && bpf.Name == filterName {
+			if bpf.Tag != tag {
+				return fmt.Errorf("program %s of %q doesn't translate for the configuration", name, link.Attrs().Name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("program %s is not attached to %q", name, link.Attrs().Name)
+}
+
+// setupCLAT creates the CLAT device of the interface, with the IPv4 address
+// and default route of the container, and attaches the programs. It must
+// be called from the container namespace.
+func setupCLAT(conf *CLATConf, ifName string) (_ *current.Interface, err error) {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	name := clatDeviceName(ifName)
+	mtu := conf.MTU
+	if mtu == 0 {
+		mtu = link.Attrs().MTU - headerGrowth
+	}
+
+	// The IPv6 address is added only if the interface lacks it
+	var addedIPv6 net.IP
+	defer func() {
+		if err != nil {
+			_ = teardownCLAT(ifName, addedIPv6)
+		}
+	}()
+
+	linkAttrs := netlink.NewLinkAttrs()
+	linkAttrs.Name = name
+	tun := &netlink.Tuntap{
+		LinkAttrs: linkAttrs,
+		Mode:      netlink.TUNTAP_MODE_TUN,
+		Flags:     netlink.TUNTAP_DEFAULTS | netlink.TUNTAP_NO_PI,
+	}
+	if err := netlink.LinkAdd(tun); err != nil {
+		return nil, fmt.Errorf("failed to create %q: %v", name, err)
+	}
+	clat, err := netlinksafe.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup %q: %v", name, err)
+	}
+	// The MTU is not applied when creating a tun
+	if err := netlink.LinkSetMTU(clat, mtu); err != nil {
+		return nil, fmt.Errorf("failed to set MTU of %q to %d: %v", name, mtu, err)
+	}
+	if err := netlink.AddrAdd(clat, &netlink.Addr{IPNet: ipv4Host(conf.clatIPv4)}); err != nil {
+		return nil, fmt.Errorf("failed to add %s to %q: %v", conf.clatIPv4, name, err)
+	}
+	if err := netlink.LinkSetUp(clat); err != nil {
+		return nil, fmt.Errorf("failed to set %q up: %v", name, err)
+	}
+	if err := netlink.RouteAdd(defaultIPv4Route(clat)); err != nil {
+		return nil, fmt.Errorf("failed to add default route via %q: %v", name, err)
+	}
+
+	found, err := hasAddr(link, conf.clatIPv6)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// The NAT64 only sends the translated packets there, no DAD
+		addr := &netlink.Addr{IPNet: ipv6Host(conf.clatIPv6), Flags: unix.IFA_F_NODAD}
+		if err := netlink.AddrAdd(link, addr); err != nil {
+			return nil, fmt.Errorf("failed to add %s to %q: %v", conf.clatIPv6, ifName, err)
+		}
+		addedIPv6 = conf.clatIPv6
+	}
+
+	egress, ingress, err := programs(conf, clat, link)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachProgram(clat, netlink.HANDLE_MIN_EGRESS, egress, egressProgramName); err != nil {
+		return nil, err
+	}
+	if err := attachProgram(link, netlink.HANDLE_MIN_INGRESS, ingress, ingressProgramName); err != nil {
+		return nil, err
+	}
+
+	return &current.Interface{Name: name}, nil
+}
+
+// teardownCLAT undoes setupCLAT, removing addedIPv6 from the interface if
+// set. It must be called from the container namespace.
+func teardownCLAT(ifName string, addedIPv6 net.IP) error {
+	// The programs of the CLAT device go with it
+	clat, err := netlinksafe.LinkByName(clatDeviceName(ifName))
+	if err == nil {
+		if err := netlink.LinkDel(clat); err != nil {
+			return fmt.Errorf("failed to delete %q: %v", clat.Attrs().Name, err)
+		}
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return fmt.Errorf("failed to lookup %q: %v", clatDeviceName(ifName), err)
+	}
+
+	link, err := netlinksafe.LinkByName(ifName)
+	if err == nil {
+		if err := detachPrograms(link, netlink.HANDLE_MIN_INGRESS); err != nil {
+			return err
+		}
+		if addedIPv6 != nil {
+			err := netlink.AddrDel(link, &netlink.Addr{IPNet: ipv6Host(addedIPv6)})
+			if err != nil && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+				return fmt.Errorf("failed to remove %s from %q: %v", addedIPv6, ifName, err)
+			}
+		}
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	return nil
+}
+
+// checkCLAT verifies the CLAT device of the interface and its programs. It
+// must be called from the container namespace.
+func checkCLAT(conf *CLATConf, ifName string) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	name := clatDeviceName(ifName)
+	clat, err := netlinksafe.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", name, err)
+	}
+	if clat.Attrs().Flags&net.FlagUp == 0 {
+		return fmt.Errorf("%q is down", name)
+	}
+
+	for _, a := range []struct {
+		link netlink.Link
+		addr net.IP
+	}{{clat, conf.clatIPv4}, {link, conf.clatIPv6}} {
+		found, err := hasAddr(a.link, a.addr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%q doesn't have the address %s", a.link.Attrs().Name, a.addr)
+		}
+	}
+
+	routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V4, defaultIPv4Route(clat),
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of %q: %v", name, err)
+	}
+	if len(routes) == 0 {
+		return fmt.Errorf("default route via %q not found", name)
+	}
+
+	egress, ingress, err := programs(conf, clat, link)
+	if err != nil {
+		return err
+	}
+	if err := checkProgram(clat, netlink.HANDLE_MIN_EGRESS, egress, egressProgramName); err != nil {
+		return err
+	}
+	return checkProgram(link, netlink.HANDLE_MIN_INGRESS, ingress, ingressProgramName)
+}
@@ -0,0 +1,651 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+func clatConf(netns, extra, ips string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "clat-test",
+		"type": "clat",
+		%s
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [{"name": "eth0", "sandbox": %q}],
+			"ips": [%s]
+		}
+	}`, extra, netns, ips))
+}
+
+var _ = Describe("clat configuration", func() {
+	const ipv6 = `{"interface": 0, "address": "2001:db8::2/64"}`
+
+	It("defaults the prefix and the addresses", func() {
+		conf, result, err := parseConf(clatConf("/var/run/netns/test", "", ipv6))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conf.nat64Prefix.String()).To(Equal("64:ff9b::/96"))
+		Expect(conf.clatIPv4.String()).To(Equal("192.0.0.1"))
+
+		_, ips, err := interfaceIPs(result, "eth0", "/var/run/netns/test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolveCLATIPv6(conf, ips, "eth0")).To(Succeed())
+		Expect(conf.clatIPv6.String()).To(Equal("2001:db8::2"))
+	})
+
+	It("requires an IPv6-only interface", func() {
+		conf, result, err := parseConf(clatConf("/var/run/netns/test", "",
+			ipv6+`, {"interface": 0, "address": "10.1.2.3/24"}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, ips, err := interfaceIPs(result, "eth0", "/var/run/netns/test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolveCLATIPv6(conf, ips, "eth0")).To(MatchError("clat requires an IPv6-only interface, eth0 has 10.1.2.3/24"))
+
+		conf, result, err = parseConf(clatConf("/var/run/netns/test", "", ""))
+		Expect(err).NotTo(HaveOccurred())
+		_, ips, err = interfaceIPs(result, "eth0", "/var/run/netns/test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolveCLATIPv6(conf, ips, "eth0")).To(MatchError("clat requires clatIPv6 or a global IPv6 address on eth0"))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(extra, msg string) {
+			_, _, err := parseConf(clatConf("/var/run/netns/test", extra, ipv6))
+			Expect(err).To(MatchError(msg))
+		},
+		Entry("with an IPv4 prefix", `"nat64Prefix": "10.0.0.0/8",`, `invalid nat64Prefix "10.0.0.0/8"`),
+		Entry("with a /64 prefix", `"nat64Prefix": "64:ff9b::/64",`, `nat64Prefix "64:ff9b::/64" must be a /96 prefix`),
+		Entry("with an IPv6 clatIPv4", `"clatIPv4": "2001:db8::1",`, `invalid clatIPv4 "2001:db8::1"`),
+		Entry("with an IPv4 clatIPv6", `"clatIPv6": "10.1.2.3",`, `invalid clatIPv6 "10.1.2.3"`),
+		Entry("with a negative MTU", `"mtu": -1,`, "invalid mtu -1"),
+	)
+
+	It("names the CLAT device after the interface", func() {
+		Expect(clatDeviceName("eth0")).To(Equal("v4-eth0"))
+		Expect(clatDeviceName("net1234567890ab")).To(Equal("v4-net123456789"))
+	})
+})
+
+// checksum returns the internet checksum of the data, zero when the data
+// holds a valid checksum
+func checksum(data ...[]byte) uint16 {
+	var b []byte
+	for _, d := range data {
+		b = append(b, d...)
+	}
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+	var sum uint32
+	for i := 0; i < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func pseudoHeader(src, dst net.IP, proto byte, length int) []byte {
+	if src.To4() != nil {
+		return append(append(append([]byte{}, src.To4()...), dst.To4()...), 0, proto, byte(length>>8), byte(length))
+	}
+	b := append(append([]byte{}, src.To16()...), dst.To16()...)
+	return append(b, 0, 0, byte(length>>8), byte(length), 0, 0, 0, proto)
+}
+
+// l4Packet returns a TCP, UDP or ICMP message with a valid checksum, ICMP
+// being an echo message of the type
+func l4Packet(src, dst net.IP, proto, icmpType byte) []byte {
+	var b []byte
+	csumOffset := 0
+	switch proto {
+	case protoTCP:
+		b = make([]byte, 20)
+		binary.BigEndian.PutUint16(b[0:], 40000)
+		binary.BigEndian.PutUint16(b[2:], 80)
+		b[12] = 5 << 4
+		b[13] = 0x02 // SYN
+		csumOffset = tcpCsumOffset
+	case protoUDP:
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint16(b[0:], 40000)
+		binary.BigEndian.PutUint16(b[2:], 53)
+		csumOffset = udpCsumOffset
+	default:
+		b = make([]byte, 8)
+		b[0] = icmpType
+		binary.BigEndian.PutUint16(b[4:], 0x1234)
+		binary.BigEndian.PutUint16(b[6:], 1)
+		csumOffset = icmpCsumOffset
+	}
+	b = append(b, []byte("hello clat")...)
+	if proto == protoUDP {
+		binary.BigEndian.PutUint16(b[4:], uint16(len(b)))
+	}
+	var csum uint16
+	if proto == protoICMP {
+		csum = checksum(b)
+	} else {
+		csum = checksum(pseudoHeader(src, dst, proto, len(b)), b)
+	}
+	binary.BigEndian.PutUint16(b[csumOffset:], csum)
+	return b
+}
+
+var etherHeader = []byte{0x02, 0, 0, 0, 0, 1, 0x02, 0, 0, 0, 0, 2}
+
+func ipv4Packet(src, dst net.IP, proto byte, payload []byte) []byte {
+	b := append(append([]byte{}, etherHeader...), 0x08, 0x00)
+	ip := make([]byte, ipv4HeaderLen)
+	ip[0] = 0x45
+	ip[1] = 0x28
+	binary.BigEndian.PutUint16(ip[2:], uint16(ipv4HeaderLen+len(payload)))
+	binary.BigEndian.PutUint16(ip[6:], 0x4000)
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:], src.To4())
+	copy(ip[16:], dst.To4())
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+	return append(append(b, ip...), payload...)
+}
+
+func ipv6Packet(src, dst net.IP, nextHeader byte, payload []byte) []byte {
+	b := append(append([]byte{}, etherHeader...), 0x86, 0xdd)
+	ip := make([]byte, ipv6HeaderLen)
+	ip[0] = 0x62
+	ip[1] = 0x80
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(payload)))
+	ip[6] = nextHeader
+	ip[7] = 64
+	copy(ip[8:], src.To16())
+	copy(ip[24:], dst.To16())
+	return append(append(b, ip...), payload...)
+}
+
+// testRun runs the program on the packet and returns its verdict and the
+// packet it leaves
+func testRun(prog *program, packet []byte) (uint32, []byte) {
+	fd, err := prog.loadProgram("clat_test")
+	Expect(err).NotTo(HaveOccurred())
+	defer unix.Close(fd)
+
+	out := make([]byte, 2048)
+	attr := struct {
+		progFd      uint32
+		retval      uint32
+		dataSizeIn  uint32
+		dataSizeOut uint32
+		dataIn      uint64
+		dataOut     uint64
+		repeat      uint32
+		duration    uint32
+	}{
+		progFd:      uint32(fd),
+		dataSizeIn:  uint32(len(packet)),
+		dataSizeOut: uint32(len(out)),
+		dataIn:      uint64(uintptr(unsafe.Pointer(&packet[0]))),
+		dataOut:     uint64(uintptr(unsafe.Pointer(&out[0]))),
+		repeat:      1,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_TEST_RUN, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(packet)
+	runtime.KeepAlive(out)
+	Expect(errno).To(BeZero())
+	return attr.retval, out[:attr.dataSizeOut]
+}
+
+var _ = Describe("clat programs", func() {
+	var (
+		conf    *CLATConf
+		local4  = net.ParseIP("192.0.0.1")
+		local6  = net.ParseIP("2001:db8::2")
+		remote4 = net.ParseIP("192.0.2.1")
+		remote6 = net.ParseIP("64:ff9b::c000:201")
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, _, err = parseConf(clatConf("/var/run/netns/test", "", ""))
+		Expect(err).NotTo(HaveOccurred())
+		conf.clatIPv6 = local6
+	})
+
+	DescribeTable("translate the packets of the container to IPv6",
+		func(proto, icmpType, nextHeader, icmpv6Type byte) {
+			payload := l4Packet(local4, remote4, proto, icmpType)
+			verdict, out := testRun(egressProgram(conf, etherHeaderLen, 1), ipv4Packet(local4, remote4, proto, payload))
+			Expect(verdict).To(Equal(uint32(tcActRedirect)))
+
+			Expect(out).To(HaveLen(etherHeaderLen + ipv6HeaderLen + len(payload)))
+			ip := out[etherHeaderLen:]
+			Expect(ip[0]).To(Equal(byte(0x62)))
+			Expect(ip[1]).To(Equal(byte(0x80)))
+			Expect(binary.BigEndian.Uint16(ip[4:])).To(Equal(uint16(len(payload))))
+			Expect(ip[6]).To(Equal(nextHeader))
+			Expect(ip[7]).To(Equal(byte(64)))
+			Expect(net.IP(ip[8:24]).Equal(local6)).To(BeTrue())
+			Expect(net.IP(ip[24:40]).Equal(remote6)).To(BeTrue())
+
+			l4 := ip[ipv6HeaderLen:]
+			Expect(checksum(pseudoHeader(local6, remote6, nextHeader, len(l4)), l4)).To(BeZero())
+			if proto == protoICMP {
+				Expect(l4[0]).To(Equal(icmpv6Type))
+			}
+		},
+		Entry("with TCP", byte(protoTCP), byte(0), byte(protoTCP), byte(0)),
+		Entry("with UDP", byte(protoUDP), byte(0), byte(protoUDP), byte(0)),
+		Entry("with an echo request", byte(protoICMP), byte(icmpEchoRequest), byte(protoICMPv6), byte(icmpv6EchoRequest)),
+		Entry("with an echo reply", byte(protoICMP), byte(icmpEchoReply), byte(protoICMPv6), byte(icmpv6EchoReply)),
+	)
+
+	It("drops the packets of the container it doesn't translate", func() {
+		egress := egressProgram(conf, etherHeaderLen, 1)
+
+		payload := l4Packet(remote4, local4, protoUDP, 0)
+		verdict, _ := testRun(egress, ipv4Packet(remote4, local4, protoUDP, payload))
+		Expect(verdict).To(Equal(uint32(tcActShot)))
+
+		// UDP without checksum
+		payload = l4Packet(local4, remote4, protoUDP, 0)
+		binary.BigEndian.PutUint16(payload[udpCsumOffset:], 0)
+		verdict, _ = testRun(egress, ipv4Packet(local4, remote4, protoUDP, payload))
+		Expect(verdict).To(Equal(uint32(tcActShot)))
+
+		// ICMP destination unreachable
+		payload = l4Packet(local4, remote4, protoICMP, 3)
+		verdict, _ = testRun(egress, ipv4Packet(local4, remote4, protoICMP, payload))
+		Expect(verdict).To(Equal(uint32(tcActShot)))
+	})
+
+	DescribeTable("translate the packets from the NAT64 back to IPv4",
+		func(nextHeader, icmpv6Type, proto, icmpType byte) {
+			payload := l4Packet(remote6, local6, nextHeader, icmpv6Type)
+			if nextHeader == protoICMPv6 {
+				// The ICMPv6 checksum covers the pseudo header
+				binary.BigEndian.PutUint16(payload[icmpCsumOffset:], 0)
+				binary.BigEndian.PutUint16(payload[icmpCsumOffset:],
+					checksum(pseudoHeader(remote6, local6, protoICMPv6, len(payload)), payload))
+			}
+			verdict, out := testRun(ingressProgram(conf, etherHeaderLen, 1), ipv6Packet(remote6, local6, nextHeader, payload))
+			Expect(verdict).To(Equal(uint32(tcActRedirect)))
+
+			Expect(out).To(HaveLen(etherHeaderLen + ipv4HeaderLen + len(payload)))
+			ip := out[etherHeaderLen : etherHeaderLen+ipv4HeaderLen]
+			Expect(ip[0]).To(Equal(byte(0x45)))
+			Expect(ip[1]).To(Equal(byte(0x28)))
+			Expect(binary.BigEndian.Uint16(ip[2:])).To(Equal(uint16(ipv4HeaderLen + len(payload))))
+			Expect(binary.BigEndian.Uint16(ip[6:])).To(Equal(uint16(0x4000)))
+			Expect(ip[8]).To(Equal(byte(64)))
+			Expect(ip[9]).To(Equal(proto))
+			Expect(net.IP(ip[12:16]).Equal(remote4)).To(BeTrue())
+			Expect(net.IP(ip[16:20]).Equal(local4)).To(BeTrue())
+			Expect(checksum(ip)).To(BeZero())
+
+			l4 := out[etherHeaderLen+ipv4HeaderLen:]
+			if proto == protoICMP {
+				Expect(l4[0]).To(Equal(icmpType))
+				Expect(checksum(l4)).To(BeZero())
+			} else {
+				Expect(checksum(pseudoHeader(remote4, local4, proto, len(l4)), l4)).To(BeZero())
+			}
+		},
+		Entry("with TCP", byte(protoTCP), byte(0), byte(protoTCP), byte(0)),
+		Entry("with UDP", byte(protoUDP), byte(0), byte(protoUDP), byte(0)),
+		Entry("with an echo request", byte(protoICMPv6), byte(icmpv6EchoRequest), byte(protoICMP), byte(icmpEchoRequest)),
+		Entry("with an echo reply", byte(protoICMPv6), byte(icmpv6EchoReply), byte(protoICMP), byte(icmpEchoReply)),
+	)
+
+	It("passes the other packets of the interface", func() {
+		ingress := ingressProgram(conf, etherHeaderLen, 1)
+
+		for _, src := range []net.IP{net.ParseIP("2001:db8::1"), remote6} {
+			for _, dst := range []net.IP{local6, net.ParseIP("2001:db8::3")} {
+				if src.Equal(remote6) && dst.Equal(local6) {
+					continue
+				}
+				packet := ipv6Packet(src, dst, protoUDP, l4Packet(src, dst, protoUDP, 0))
+				verdict, out := testRun(ingress, packet)
+				Expect(verdict).To(Equal(uint32(tcActOK)))
+				Expect(out).To(Equal(packet))
+			}
+		}
+
+		packet := ipv4Packet(remote4, local4, protoUDP, l4Packet(remote4, local4, protoUDP, 0))
+		verdict, _ := testRun(ingress, packet)
+		Expect(verdict).To(Equal(uint32(tcActOK)))
+	})
+})
+
+var _ = Describe("clat operations", func() {
+	var containerNS, peerNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		containerNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		peerNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "eth0"
+			Expect(netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: "peer0"})).To(Succeed())
+			link, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			addr, err := netlink.ParseAddr("2001:db8::2/64")
+			Expect(err).NotTo(HaveOccurred())
+			addr.Flags = unix.IFA_F_NODAD
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+
+			peer, err := netlinksafe.LinkByName("peer0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetNsFd(peer, int(peerNS.Fd()))).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, netns := range []ns.NetNS{containerNS, peerNS} {
+			Expect(netns.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(netns)).To(Succeed())
+		}
+	})
+
+	It("sets up the CLAT with ADD/CHECK/DEL", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData:   clatConf(containerNS.Path(), "", `{"interface": 0, "address": "2001:db8::2/64"}`),
+		}
+
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := types100.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Interfaces).To(HaveLen(2))
+		Expect(result.Interfaces[1].Name).To(Equal("v4-eth0"))
+		Expect(result.Interfaces[1].Sandbox).To(Equal(containerNS.Path()))
+		Expect(result.IPs).To(HaveLen(2))
+		Expect(*result.IPs[1].Interface).To(Equal(1))
+		Expect(result.IPs[1].Address.String()).To(Equal("192.0.0.1/32"))
+		Expect(result.Routes).To(HaveLen(1))
+		Expect(result.Routes[0].Dst.String()).To(Equal("0.0.0.0/0"))
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			clat, err := netlinksafe.LinkByName("v4-eth0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clat.Type()).To(Equal("tuntap"))
+			Expect(clat.Attrs().MTU).To(Equal(1500 - headerGrowth))
+			Expect(clat.Attrs().Flags & net.FlagUp).To(Equal(net.FlagUp))
+
+			filters, err := netlinksafe.FilterList(clat, netlink.HANDLE_MIN_EGRESS)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filters).To(HaveLen(1))
+			link, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			filters, err = netlinksafe.FilterList(link, netlink.HANDLE_MIN_INGRESS)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filters).To(HaveLen(1))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		prevResult, err := json.Marshal(result)
+		Expect(err).NotTo(HaveOccurred())
+		checkConf := func(extra string) []byte {
+			return []byte(fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "clat-test",
+				"type": "clat",
+				%s
+				"prevResult": %s
+			}`, extra, prevResult))
+		}
+		checkArgs := *args
+		checkArgs.StdinData = checkConf("")
+		Expect(testutils.CmdCheckWithArgs(&checkArgs, func() error {
+			return cmdCheck(&checkArgs)
+		})).To(Succeed())
+
+		// The programs translate for another prefix
+		otherArgs := *args
+		otherArgs.StdinData = checkConf(`"nat64Prefix": "2001:db8:64::/96",`)
+		err = testutils.CmdCheckWithArgs(&otherArgs, func() error {
+			return cmdCheck(&otherArgs)
+		})
+		Expect(err).To(MatchError(`program clat_egress of "v4-eth0" doesn't translate for the configuration`))
+
+		Expect(testutils.CmdDelWithArgs(&checkArgs, func() error {
+			return cmdDel(&checkArgs)
+		})).To(Succeed())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, err := netlinksafe.LinkByName("v4-eth0")
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+			link, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			filters, err := netlinksafe.FilterList(link, netlink.HANDLE_MIN_INGRESS)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filters).To(BeEmpty())
+			// The address of the interface is left
+			found, err := hasAddr(link, net.ParseIP("2001:db8::2"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// DEL is idempotent
+		Expect(testutils.CmdDelWithArgs(&checkArgs, func() error {
+			return cmdDel(&checkArgs)
+		})).To(Succeed())
+	})
+
+	It("adds and removes a dedicated IPv6 address", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData: clatConf(containerNS.Path(), `"clatIPv6": "2001:db8::464",`,
+				`{"interface": 0, "address": "2001:db8::2/64"}`),
+		}
+
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		hasCLATIPv6 := func() bool {
+			var found bool
+			err := containerNS.Do(func(ns.NetNS) error {
+				link, err := netlinksafe.LinkByName("eth0")
+				if err != nil {
+					return err
+				}
+				found, err = hasAddr(link, net.ParseIP("2001:db8::464"))
+				return err
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return found
+		}
+		Expect(hasCLATIPv6()).To(BeTrue())
+
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+		Expect(hasCLATIPv6()).To(BeFalse())
+	})
+
+	It("gives the container IPv4 connectivity through the NAT64", func() {
+		var eth0MAC, peerMAC net.HardwareAddr
+		err := containerNS.Do(func(ns.NetNS) error {
+			link, err := netlinksafe.LinkByName("eth0")
+			eth0MAC = link.Attrs().HardwareAddr
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// The peer stands for the NAT64, as 192.0.2.1 in the prefix
+		err = peerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			peer, err := netlinksafe.LinkByName("peer0")
+			Expect(err).NotTo(HaveOccurred())
+			peerMAC = peer.Attrs().HardwareAddr
+			Expect(netlink.LinkSetUp(peer)).To(Succeed())
+			for _, a := range []string{"2001:db8::1/64", "64:ff9b::c000:201/96"} {
+				addr, err := netlink.ParseAddr(a)
+				Expect(err).NotTo(HaveOccurred())
+				addr.Flags = unix.IFA_F_NODAD
+				Expect(netlink.AddrAdd(peer, addr)).To(Succeed())
+			}
+			return netlink.NeighAdd(&netlink.Neigh{
+				LinkIndex:    peer.Attrs().Index,
+				Family:       netlink.FAMILY_V6,
+				State:        netlink.NUD_PERMANENT,
+				IP:           net.ParseIP("2001:db8::2"),
+				HardwareAddr: eth0MAC,
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+		err = containerNS.Do(func(ns.NetNS) error {
+			link, err := netlinksafe.LinkByName("eth0")
+			if err != nil {
+				return err
+			}
+			_, prefix, _ := net.ParseCIDR("64:ff9b::/96")
+			if err := netlink.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: prefix}); err != nil {
+				return err
+			}
+			return netlink.NeighAdd(&netlink.Neigh{
+				LinkIndex:    link.Attrs().Index,
+				Family:       netlink.FAMILY_V6,
+				State:        netlink.NUD_PERMANENT,
+				IP:           net.ParseIP("64:ff9b::c000:201"),
+				HardwareAddr: peerMAC,
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData:   clatConf(containerNS.Path(), "", `{"interface": 0, "address": "2001:db8::2/64"}`),
+		}
+		_, _, err = testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var server, client *net.UDPConn
+		err = peerNS.Do(func(ns.NetNS) error {
+			server, err = net.ListenUDP("udp6", &net.UDPAddr{IP: net.ParseIP("64:ff9b::c000:201"), Port: 5353})
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer server.Close()
+		err = containerNS.Do(func(ns.NetNS) error {
+			client, err = net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353})
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		_, err = client.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+		buf := make([]byte, 64)
+		Expect(server.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		n, from, err := server.ReadFromUDP(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(buf[:n])).To(Equal("ping"))
+		Expect(from.IP.String()).To(Equal("2001:db8::2"))
+
+		_, err = server.WriteToUDP([]byte("pong"), from)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		n, err = client.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(buf[:n])).To(Equal("pong"))
+	})
+
+	It("requires an ethernet interface", func() {
+		err := containerNS.Do(func(ns.NetNS) error {
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "tun0"
+			return netlink.LinkAdd(&netlink.Tuntap{LinkAttrs: linkAttrs, Mode: netlink.TUNTAP_MODE_TUN})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "tun0",
+			StdinData: []byte(fmt.Sprintf(`{
+				"cniVersion": "1.0.0",
+				"name": "clat-test",
+				"type": "clat",
+				"prevResult": {
+					"cniVersion": "1.0.0",
+					"interfaces": [{"name": "tun0", "sandbox": %q}],
+					"ips": [{"interface": 0, "address": "2001:db8::2/64"}]
+				}
+			}`, containerNS.Path())),
+		}
+		_, _, err = testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError(`clat requires an ethernet interface, "tun0" is none`))
+
+		// Nothing is left behind
+		err = containerNS.Do(func(ns.NetNS) error {
+			_, err := netlinksafe.LinkByName("v4-tun0")
+			return err
+		})
+		Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+	})
+})
@@ -0,0 +1,262 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin giving the containers of an IPv6-only network
+// IPv4 connectivity through a NAT64, with a 464XLAT customer-side
+// translator (CLAT) made of eBPF programs it loads itself.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	// defaultNAT64Prefix is the well-known prefix of RFC 6052
+	defaultNAT64Prefix = "64:ff9b::/96"
+	// defaultCLATIPv4 is from the range RFC 7335 reserves for the CLAT
+	defaultCLATIPv4 = "192.0.0.1"
+)
+
+// CLATConf is the chained plugin configuration
+type CLATConf struct {
+	types.NetConf
+
+	// NAT64Prefix is the /96 prefix the NAT64 maps the IPv4 addresses into
+	NAT64Prefix string `json:"nat64Prefix,omitempty"`
+	// CLATIPv4 is the IPv4 address of the container
+	CLATIPv4 string `json:"clatIPv4,omitempty"`
+	// CLATIPv6 is the IPv6 address the IPv4 address is translated to,
+	// the one of the interface by default
+	CLATIPv6 string `json:"clatIPv6,omitempty"`
+	// MTU of the CLAT device, the MTU of the interface less the growth
+	// of the headers by default
+	MTU int `json:"mtu,omitempty"`
+
+	nat64Prefix *net.IPNet
+	clatIPv4    net.IP
+	clatIPv6    net.IP
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		/* FIXME GC */
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("clat"))
+}
+
+func parseConf(data []byte) (*CLATConf, *current.Result, error) {
+	conf := CLATConf{
+		NAT64Prefix: defaultNAT64Prefix,
+		CLATIPv4:    defaultCLATIPv4,
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	_, prefix, err := net.ParseCIDR(conf.NAT64Prefix)
+	if err != nil || prefix.IP.To4() != nil {
+		return nil, nil, fmt.Errorf("invalid nat64Prefix %q", conf.NAT64Prefix)
+	}
+	if ones, _ := prefix.Mask.Size(); ones != 96 {
+		return nil, nil, fmt.Errorf("nat64Prefix %q must be a /96 prefix", conf.NAT64Prefix)
+	}
+	conf.nat64Prefix = prefix
+
+	conf.clatIPv4 = net.ParseIP(conf.CLATIPv4).To4()
+	if conf.clatIPv4 == nil {
+		return nil, nil, fmt.Errorf("invalid clatIPv4 %q", conf.CLATIPv4)
+	}
+	if conf.CLATIPv6 != "" {
+		conf.clatIPv6 = net.ParseIP(conf.CLATIPv6)
+		if conf.clatIPv6 == nil || conf.clatIPv6.To4() != nil {
+			return nil, nil, fmt.Errorf("invalid clatIPv6 %q", conf.CLATIPv6)
+		}
+	}
+	if conf.MTU < 0 {
+		return nil, nil, fmt.Errorf("invalid mtu %d", conf.MTU)
+	}
+
+	return &conf, result, nil
+}
+
+// interfaceIPs returns the index of the interface in the result and its
+// addresses
+func interfaceIPs(result *current.Result, ifName, netns string) (int, []*current.IPConfig, error) {
+	index := -1
+	for i, intf := range result.Interfaces {
+		if intf.Name == ifName && intf.Sandbox == netns {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return -1, nil, fmt.Errorf("interface %s not found in prevResult", ifName)
+	}
+	var ips []*current.IPConfig
+	for _, ipc := range result.IPs {
+		if ipc.Interface != nil && *ipc.Interface == index {
+			ips = append(ips, ipc)
+		}
+	}
+	return index, ips, nil
+}
+
+// resolveCLATIPv6 defaults the IPv6 address of the CLAT to the global
+// address of the interface, which must have no IPv4 address
+func resolveCLATIPv6(conf *CLATConf, ips []*current.IPConfig, ifName string) error {
+	for _, ipc := range ips {
+		if ipc.Address.IP.To4() != nil {
+			return fmt.Errorf("clat requires an IPv6-only interface, %s has %s", ifName, ipc.Address.String())
+		}
+	}
+	if conf.clatIPv6 != nil {
+		return nil
+	}
+	for _, ipc := range ips {
+		if ipc.Address.IP.IsGlobalUnicast() {
+			conf.clatIPv6 = ipc.Address.IP
+			return nil
+		}
+	}
+	return fmt.Errorf("clat requires clatIPv6 or a global IPv6 address on %s", ifName)
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	_, ips, err := interfaceIPs(result, args.IfName, args.Netns)
+	if err != nil {
+		return err
+	}
+	if err := resolveCLATIPv6(conf, ips, args.IfName); err != nil {
+		return err
+	}
+
+	var clatIntf *current.Interface
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		clatIntf, err = setupCLAT(conf, args.IfName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	clatIntf.Sandbox = args.Netns
+	result.Interfaces = append(result.Interfaces, clatIntf)
+	result.IPs = append(result.IPs, &current.IPConfig{
+		Interface: current.Int(len(result.Interfaces) - 1),
+		Address:   net.IPNet{IP: conf.clatIPv4, Mask: net.CIDRMask(32, 32)},
+	})
+	result.Routes = append(result.Routes, &types.Route{
+		Dst: net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+	})
+
+	return types.PrintResult(result, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if args.Netns == "" {
+		return nil
+	}
+
+	// The address the CLAT added, if it is not one of the interface
+	var addedIPv6 net.IP
+	if conf.clatIPv6 != nil {
+		addedIPv6 = conf.clatIPv6
+		if result != nil {
+			if _, ips, err := interfaceIPs(result, args.IfName, args.Netns); err == nil {
+				for _, ipc := range ips {
+					if ipc.Address.IP.Equal(conf.clatIPv6) {
+						addedIPv6 = nil
+					}
+				}
+			}
+		}
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return teardownCLAT(args.IfName, addedIPv6)
+	})
+	if err != nil {
+		// The CLAT device went with the namespace
+		if _, ok := err.(ns.NSPathNotExistErr); ok {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	_, ips, err := interfaceIPs(result, args.IfName, args.Netns)
+	if err != nil {
+		return err
+	}
+	clatIndex, clatIPs, err := interfaceIPs(result, clatDeviceName(args.IfName), args.Netns)
+	if err != nil {
+		return err
+	}
+	if len(clatIPs) != 1 || !clatIPs[0].Address.IP.Equal(conf.clatIPv4) {
+		return fmt.Errorf("interface %s of prevResult doesn't have the address %s", result.Interfaces[clatIndex].Name, conf.clatIPv4)
+	}
+	if err := resolveCLATIPv6(conf, ips, args.IfName); err != nil {
+		return err
+	}
+
+	return ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return checkCLAT(conf, args.IfName)
+	})
+}
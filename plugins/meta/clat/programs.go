@@ -0,0 +1,447 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// The programs translate the packets statelessly, as the SIIT of RFC 7915
+// does for a single IPv4 address. They carry their configuration as
+// constants, so each CLAT has its own programs and nothing to look up.
+//
+// The programs translate TCP, UDP and the ICMP echo messages. Options,
+// fragments and the other ICMP messages are not translated: the egress
+// program drops them and the ingress program passes them to the stack.
+// A packet is read and built on the stack of the program:
+//
+//	egress:  fp-24 IPv4 header        ingress: fp-48 IPv6 header
+//	         fp-72 IPv6 header                 fp-8  pseudo header tail
+//	         fp-32 pseudo header tail          fp-72 IPv4 header
+//	         fp-80 ICMP type and code          fp-80 ICMP type and code
+//	                                           fp-88 sum of the IPv6 header
+//
+// The IPv6 pseudo header of the checksums is made of the addresses of the
+// IPv6 header followed by the tail, the upper-layer length and next header.
+
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	// maxIPv4Payload is the largest payload of an IPv4 packet
+	maxIPv4Payload = 0xffff - ipv4HeaderLen
+
+	// The offsets of the checksums in the TCP, UDP and ICMP headers
+	tcpCsumOffset  = 16
+	udpCsumOffset  = 6
+	icmpCsumOffset = 2
+
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+
+	// etherHeaderLen is the offset of the IPv6 header in the packets seen
+	// at the ingress of an ethernet interface
+	etherHeaderLen = 14
+)
+
+// egressProgram returns the program of the egress of the CLAT device. It
+// translates the IPv4 packets of the container to IPv6, from clatIPv6 to
+// the NAT64 prefix, and redirects them to the egress of the interface of
+// index oif. The IPv4 header starts at l3 in the packets.
+func egressProgram(conf *CLATConf, l3 int32, oif int) *program {
+	local6 := conf.clatIPv6.To16()
+	prefix := conf.nat64Prefix.IP.To16()
+
+	p := newProgram()
+	p.mov(r6, r1)
+	p.load(unix.BPF_W, r2, r6, skbProtocolOffset)
+	p.jump32(unix.BPF_JNE, r2, be16(0x08, 0x00), "drop")
+
+	p.mov(r1, r6)
+	p.movImm(r2, l3)
+	p.stackAddr(r3, -24)
+	p.movImm(r4, ipv4HeaderLen)
+	p.call(fnSkbLoadBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+
+	// Only the IPv4 packets of the container without options or fragments
+	p.load(unix.BPF_B, r2, r10, -24)
+	p.jump(unix.BPF_JNE, r2, 0x45, "drop")
+	p.load(unix.BPF_H, r2, r10, -18)
+	p.alu(unix.BPF_AND, r2, be16(0x3f, 0xff))
+	p.jump(unix.BPF_JNE, r2, 0, "drop")
+	p.load(unix.BPF_W, r2, r10, -12)
+	p.jump32(unix.BPF_JNE, r2, be32(conf.clatIPv4.To4()), "drop")
+	// r9 is the payload length
+	p.load(unix.BPF_H, r9, r10, -22)
+	p.swap(r9, 16)
+	p.jump(unix.BPF_JLE, r9, ipv4HeaderLen, "drop")
+	p.alu(unix.BPF_SUB, r9, ipv4HeaderLen)
+
+	// The IPv6 header, with the traffic class of the type of service, and
+	// the tail of the pseudo header
+	p.load(unix.BPF_B, r2, r10, -23)
+	p.mov(r3, r2)
+	p.alu(unix.BPF_RSH, r3, 4)
+	p.alu(unix.BPF_OR, r3, 0x60)
+	p.store(unix.BPF_B, r10, -72, r3)
+	p.alu(unix.BPF_AND, r2, 0x0f)
+	p.alu(unix.BPF_LSH, r2, 4)
+	p.store(unix.BPF_B, r10, -71, r2)
+	p.storeImm(unix.BPF_H, r10, -70, 0)
+	p.mov(r2, r9)
+	p.swap(r2, 16)
+	p.store(unix.BPF_H, r10, -68, r2)
+	p.load(unix.BPF_B, r2, r10, -16)
+	p.store(unix.BPF_B, r10, -65, r2)
+	for i := 0; i < 4; i++ {
+		p.storeImm(unix.BPF_W, r10, int16(-64+4*i), be32(local6[4*i:]))
+	}
+	for i := 0; i < 3; i++ {
+		p.storeImm(unix.BPF_W, r10, int16(-48+4*i), be32(prefix[4*i:]))
+	}
+	p.load(unix.BPF_W, r2, r10, -8)
+	p.store(unix.BPF_W, r10, -36, r2)
+	p.mov(r2, r9)
+	p.swap(r2, 32)
+	p.store(unix.BPF_W, r10, -32, r2)
+
+	// r7 is the next header, r8 the offset of the checksum once translated
+	p.load(unix.BPF_B, r7, r10, -15)
+	p.movImm(r8, l3+ipv6HeaderLen+tcpCsumOffset)
+	p.jump(unix.BPF_JEQ, r7, protoTCP, "l4")
+	p.movImm(r8, l3+ipv6HeaderLen+udpCsumOffset)
+	p.jump(unix.BPF_JEQ, r7, protoUDP, "udp")
+	p.movImm(r8, l3+ipv6HeaderLen+icmpCsumOffset)
+	p.jump(unix.BPF_JEQ, r7, protoICMP, "icmp")
+	p.goTo("drop")
+
+	// The checksum of UDP is optional with IPv4 only
+	p.label("udp")
+	p.mov(r1, r6)
+	p.movImm(r2, l3+ipv4HeaderLen+udpCsumOffset)
+	p.stackAddr(r3, -80)
+	p.movImm(r4, 2)
+	p.call(fnSkbLoadBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+	p.load(unix.BPF_H, r2, r10, -80)
+	p.jump(unix.BPF_JEQ, r2, 0, "drop")
+	p.goTo("l4")
+
+	// r9 is the ICMP type and code before translation
+	p.label("icmp")
+	p.movImm(r7, protoICMPv6)
+	p.mov(r1, r6)
+	p.movImm(r2, l3+ipv4HeaderLen)
+	p.stackAddr(r3, -80)
+	p.movImm(r4, 2)
+	p.call(fnSkbLoadBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+	p.load(unix.BPF_H, r9, r10, -80)
+	p.load(unix.BPF_B, r2, r10, -80)
+	p.storeImm(unix.BPF_B, r10, -80, icmpv6EchoRequest)
+	p.jump(unix.BPF_JEQ, r2, icmpEchoRequest, "l4")
+	p.storeImm(unix.BPF_B, r10, -80, icmpv6EchoReply)
+	p.jump(unix.BPF_JEQ, r2, icmpEchoReply, "l4")
+	p.goTo("drop")
+
+	p.label("l4")
+	p.store(unix.BPF_B, r10, -66, r7)
+	p.mov(r2, r7)
+	p.swap(r2, 32)
+	p.store(unix.BPF_W, r10, -28, r2)
+
+	p.mov(r1, r6)
+	p.movImm(r2, be16(0x86, 0xdd))
+	p.movImm(r3, 0)
+	p.call(fnSkbChangeProto)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+	p.mov(r1, r6)
+	p.movImm(r2, l3)
+	p.stackAddr(r3, -72)
+	p.movImm(r4, ipv6HeaderLen)
+	p.movImm(r5, 0)
+	p.call(fnSkbStoreBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+
+	p.jump(unix.BPF_JEQ, r7, protoICMPv6, "icmpsum")
+	// The addresses of the pseudo header change
+	p.stackAddr(r1, -12)
+	p.movImm(r2, 8)
+	p.stackAddr(r3, -64)
+	p.movImm(r4, 32)
+	p.movImm(r5, 0)
+	p.call(fnCsumDiff)
+	p.l4CsumReplace()
+	p.goTo("redirect")
+
+	// ICMPv6 adds the pseudo header to the checksum, and the type changes
+	p.label("icmpsum")
+	p.movImm(r1, 0)
+	p.movImm(r2, 0)
+	p.stackAddr(r3, -64)
+	p.movImm(r4, 40)
+	p.movImm(r5, 0)
+	p.call(fnCsumDiff)
+	p.icmpCsumReplace(l3 + ipv6HeaderLen)
+
+	p.label("redirect")
+	if l3 == 0 {
+		// The redirection takes an ethernet header off the packet before
+		// filling in the one of the neighbor
+		p.mov(r1, r6)
+		p.movImm(r2, etherHeaderLen)
+		p.movImm(r3, 0)
+		p.call(fnSkbChangeHead)
+		p.jump(unix.BPF_JNE, r0, 0, "drop")
+	}
+	p.movImm(r1, int32(oif))
+	p.movImm(r2, 0)
+	p.movImm(r3, 0)
+	p.movImm(r4, 0)
+	p.call(fnRedirectNeigh)
+	p.exit()
+
+	p.label("drop")
+	p.ret(tcActShot)
+	return p
+}
+
+// ingressProgram returns the program of the ingress of the interface. It
+// translates the IPv6 packets from the NAT64 prefix to clatIPv6 back to
+// IPv4, and redirects them to the ingress of the CLAT device of index
+// clatIndex. The other packets are left to the stack. The IPv6 header
+// starts at l3 in the packets.
+func ingressProgram(conf *CLATConf, l3 int32, clatIndex int) *program {
+	local6 := conf.clatIPv6.To16()
+	prefix := conf.nat64Prefix.IP.To16()
+
+	p := newProgram()
+	p.mov(r6, r1)
+	p.load(unix.BPF_W, r2, r6, skbProtocolOffset)
+	p.jump32(unix.BPF_JNE, r2, be16(0x86, 0xdd), "pass")
+
+	p.mov(r1, r6)
+	p.movImm(r2, l3)
+	p.stackAddr(r3, -48)
+	p.movImm(r4, ipv6HeaderLen)
+	p.call(fnSkbLoadBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "pass")
+
+	// Only the IPv6 packets from the NAT64 prefix to clatIPv6
+	p.load(unix.BPF_B, r2, r10, -48)
+	p.alu(unix.BPF_AND, r2, 0xf0)
+	p.jump(unix.BPF_JNE, r2, 0x60, "pass")
+	for i := 0; i < 4; i++ {
+		p.load(unix.BPF_W, r2, r10, int16(-24+4*i))
+		p.jump32(unix.BPF_JNE, r2, be32(local6[4*i:]), "pass")
+	}
+	for i := 0; i < 3; i++ {
+		p.load(unix.BPF_W, r2, r10, int16(-40+4*i))
+		p.jump32(unix.BPF_JNE, r2, be32(prefix[4*i:]), "pass")
+	}
+	// r9 is the payload length
+	p.load(unix.BPF_H, r9, r10, -44)
+	p.swap(r9, 16)
+	p.jump(unix.BPF_JGT, r9, maxIPv4Payload, "pass")
+
+	// The IPv4 header, with the type of service of the traffic class and
+	// the don't fragment bit, and the tail of the pseudo header
+	p.storeImm(unix.BPF_B, r10, -72, 0x45)
+	p.load(unix.BPF_B, r2, r10, -48)
+	p.alu(unix.BPF_AND, r2, 0x0f)
+	p.alu(unix.BPF_LSH, r2, 4)
+	p.load(unix.BPF_B, r3, r10, -47)
+	p.alu(unix.BPF_RSH, r3, 4)
+	p.aluReg(unix.BPF_OR, r2, r3)
+	p.store(unix.BPF_B, r10, -71, r2)
+	p.mov(r2, r9)
+	p.alu(unix.BPF_ADD, r2, ipv4HeaderLen)
+	p.swap(r2, 16)
+	p.store(unix.BPF_H, r10, -70, r2)
+	p.storeImm(unix.BPF_H, r10, -68, 0)
+	p.storeImm(unix.BPF_H, r10, -66, be16(0x40, 0x00))
+	p.load(unix.BPF_B, r2, r10, -41)
+	p.store(unix.BPF_B, r10, -64, r2)
+	p.storeImm(unix.BPF_H, r10, -62, 0)
+	p.load(unix.BPF_W, r2, r10, -28)
+	p.store(unix.BPF_W, r10, -60, r2)
+	p.storeImm(unix.BPF_W, r10, -56, be32(conf.clatIPv4.To4()))
+	p.mov(r2, r9)
+	p.swap(r2, 32)
+	p.store(unix.BPF_W, r10, -8, r2)
+
+	// r7 is the protocol, r8 the offset of the checksum once translated
+	p.load(unix.BPF_B, r7, r10, -42)
+	p.mov(r2, r7)
+	p.swap(r2, 32)
+	p.store(unix.BPF_W, r10, -4, r2)
+	p.movImm(r8, l3+ipv4HeaderLen+tcpCsumOffset)
+	p.jump(unix.BPF_JEQ, r7, protoTCP, "l4")
+	p.movImm(r8, l3+ipv4HeaderLen+udpCsumOffset)
+	p.jump(unix.BPF_JEQ, r7, protoUDP, "l4")
+	p.movImm(r8, l3+ipv4HeaderLen+icmpCsumOffset)
+	p.jump(unix.BPF_JEQ, r7, protoICMPv6, "icmp")
+	p.goTo("pass")
+
+	// r9 is the ICMPv6 type and code before translation
+	p.label("icmp")
+	p.movImm(r7, protoICMP)
+	p.mov(r1, r6)
+	p.movImm(r2, l3+ipv6HeaderLen)
+	p.stackAddr(r3, -80)
+	p.movImm(r4, 2)
+	p.call(fnSkbLoadBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "pass")
+	p.load(unix.BPF_H, r9, r10, -80)
+	p.load(unix.BPF_B, r2, r10, -80)
+	p.storeImm(unix.BPF_B, r10, -80, icmpEchoRequest)
+	p.jump(unix.BPF_JEQ, r2, icmpv6EchoRequest, "l4")
+	p.storeImm(unix.BPF_B, r10, -80, icmpEchoReply)
+	p.jump(unix.BPF_JEQ, r2, icmpv6EchoReply, "l4")
+	p.goTo("pass")
+
+	p.label("l4")
+	p.store(unix.BPF_B, r10, -63, r7)
+	p.movImm(r1, 0)
+	p.movImm(r2, 0)
+	p.stackAddr(r3, -72)
+	p.movImm(r4, ipv4HeaderLen)
+	p.movImm(r5, 0)
+	p.call(fnCsumDiff)
+	// Fold the sum of the header into its checksum
+	p.mov(r2, r0)
+	p.alu(unix.BPF_RSH, r2, 16)
+	p.alu(unix.BPF_AND, r0, 0xffff)
+	p.aluReg(unix.BPF_ADD, r0, r2)
+	p.mov(r2, r0)
+	p.alu(unix.BPF_RSH, r2, 16)
+	p.aluReg(unix.BPF_ADD, r0, r2)
+	p.alu(unix.BPF_XOR, r0, 0xffff)
+	p.alu(unix.BPF_AND, r0, 0xffff)
+	p.store(unix.BPF_H, r10, -62, r0)
+
+	// The checksum of a complete packet loses the IPv6 header, and gains
+	// the IPv4 header which sums to zero
+	p.stackAddr(r1, -48)
+	p.movImm(r2, ipv6HeaderLen)
+	p.movImm(r3, 0)
+	p.movImm(r4, 0)
+	p.movImm(r5, 0)
+	p.call(fnCsumDiff)
+	p.store(unix.BPF_DW, r10, -88, r0)
+
+	// The packet is left untouched when the translation can't start
+	p.mov(r1, r6)
+	p.movImm(r2, be16(0x08, 0x00))
+	p.movImm(r3, 0)
+	p.call(fnSkbChangeProto)
+	p.jump(unix.BPF_JNE, r0, 0, "pass")
+	p.mov(r1, r6)
+	p.load(unix.BPF_DW, r2, r10, -88)
+	p.call(fnCsumUpdate)
+	p.mov(r1, r6)
+	p.movImm(r2, l3)
+	p.stackAddr(r3, -72)
+	p.movImm(r4, ipv4HeaderLen)
+	p.movImm(r5, 0)
+	p.call(fnSkbStoreBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+
+	p.jump(unix.BPF_JEQ, r7, protoICMP, "icmpsum")
+	// The addresses of the pseudo header change
+	p.stackAddr(r1, -40)
+	p.movImm(r2, 32)
+	p.stackAddr(r3, -60)
+	p.movImm(r4, 8)
+	p.movImm(r5, 0)
+	p.call(fnCsumDiff)
+	p.l4CsumReplace()
+	p.goTo("redirect")
+
+	// ICMP drops the pseudo header from the checksum, and the type changes
+	p.label("icmpsum")
+	p.stackAddr(r1, -40)
+	p.movImm(r2, 40)
+	p.movImm(r3, 0)
+	p.movImm(r4, 0)
+	p.movImm(r5, 0)
+	p.call(fnCsumDiff)
+	p.icmpCsumReplace(l3 + ipv4HeaderLen)
+
+	p.label("redirect")
+	p.movImm(r1, int32(clatIndex))
+	p.movImm(r2, unix.BPF_F_INGRESS)
+	p.call(fnRedirect)
+	p.exit()
+
+	p.label("pass")
+	p.ret(tcActOK)
+	p.label("drop")
+	p.ret(tcActShot)
+	return p
+}
+
+// l4CsumReplace applies the difference of the pseudo header in r0 to the
+// TCP or UDP checksum at r8, r7 being the protocol. It jumps to "drop" on
+// failure.
+func (p *program) l4CsumReplace() {
+	p.mov(r1, r6)
+	p.mov(r2, r8)
+	p.movImm(r3, 0)
+	p.mov(r4, r0)
+	p.movImm(r5, unix.BPF_F_PSEUDO_HDR)
+	p.jump(unix.BPF_JEQ, r7, protoTCP, "csum")
+	// A zero UDP checksum would mean none
+	p.movImm(r5, unix.BPF_F_PSEUDO_HDR|unix.BPF_F_MARK_MANGLED_0)
+	p.label("csum")
+	p.call(fnL4CsumReplace)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+}
+
+// icmpCsumReplace applies the difference of the pseudo header in r0 to the
+// ICMP checksum at r8, then replaces the type and code in r9 by the ones at
+// fp-80 in the header at offset. It jumps to "drop" on failure.
+func (p *program) icmpCsumReplace(offset int32) {
+	p.mov(r1, r6)
+	p.mov(r2, r8)
+	p.movImm(r3, 0)
+	p.mov(r4, r0)
+	p.movImm(r5, unix.BPF_F_PSEUDO_HDR)
+	p.call(fnL4CsumReplace)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+	// The checksum compensates the change of the type, the sum of the
+	// packet is unchanged
+	p.mov(r1, r6)
+	p.mov(r2, r8)
+	p.mov(r3, r9)
+	p.load(unix.BPF_H, r4, r10, -80)
+	p.movImm(r5, 2)
+	p.call(fnL4CsumReplace)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+	p.mov(r1, r6)
+	p.movImm(r2, offset)
+	p.stackAddr(r3, -80)
+	p.movImm(r4, 1)
+	p.movImm(r5, 0)
+	p.call(fnSkbStoreBytes)
+	p.jump(unix.BPF_JNE, r0, 0, "drop")
+}
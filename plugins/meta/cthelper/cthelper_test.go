@@ -0,0 +1,215 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/knftables"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+func ctHelperConf(helpers string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "cthelper-test",
+		"type": "cthelper",
+		"helpers": %s,
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [
+				{"name": "eth0", "sandbox": "/var/run/netns/test"}
+			],
+			"ips": [
+				{"interface": 0, "address": "10.1.2.3/24"}
+			]
+		}
+	}`, helpers))
+}
+
+var _ = Describe("cthelper configuration", func() {
+	It("defaults to the well-known port of the helpers", func() {
+		conf, result, err := parseConf(ctHelperConf(`[{"name": "ftp"}, {"name": "sip", "protocol": "tcp"}, {"name": "tftp", "port": 1069}]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(BeNil())
+		Expect(conf.Helpers).To(Equal([]Helper{
+			{Name: "ftp", Protocol: "tcp", Port: 21},
+			{Name: "sip", Protocol: "tcp", Port: 5060},
+			{Name: "tftp", Protocol: "udp", Port: 1069},
+		}))
+	})
+
+	It("rejects invalid configurations", func() {
+		for _, helpers := range []string{
+			`[]`,
+			`[{"name": "irc"}]`,
+			`[{"name": "ftp", "protocol": "sctp"}]`,
+			`[{"name": "ftp", "port": 65536}]`,
+			`[{"name": "ftp"}, {"name": "ftp", "port": 21}]`,
+		} {
+			_, _, err := parseConf(ctHelperConf(helpers))
+			Expect(err).To(HaveOccurred(), helpers)
+		}
+	})
+
+	It("renders a table per attachment", func() {
+		table := tableName("cthelper-test", "dummy", "eth0")
+		Expect(table).To(HavePrefix(tablePrefix))
+		Expect(table).To(HaveLen(tableNameLength))
+		Expect(tableName("cthelper-test", "dummy", "eth1")).NotTo(Equal(table))
+
+		script := helperScript("t", []Helper{{Name: "ftp", Protocol: "tcp", Port: 21}, {Name: "sip", Protocol: "udp", Port: 5060}})
+		Expect(script).To(Equal(`add ct helper inet t ftp_tcp_21 { type "ftp" protocol tcp ; l3proto inet ; }
+add ct helper inet t sip_udp_5060 { type "sip" protocol udp ; l3proto inet ; }
+`))
+	})
+})
+
+var _ = Describe("cthelper operations", func() {
+	var (
+		targetNS ns.NetNS
+		fakes    map[string]*knftables.Fake
+		helpers  map[string][]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		// nft is not available in CI, the ct helper objects the fake tables
+		// lack are kept aside
+		fakes = map[string]*knftables.Fake{}
+		helpers = map[string][]string{}
+		origNewNFT, origAddHelperObjects, origListHelperObjects := newNFT, addHelperObjects, listHelperObjects
+		newNFT = func(table string) (knftables.Interface, error) {
+			if fakes[table] == nil {
+				fakes[table] = knftables.NewFake(knftables.InetFamily, table)
+			}
+			return fakes[table], nil
+		}
+		addHelperObjects = func(table string, hs []Helper) error {
+			helpers[table] = nil
+			for _, h := range hs {
+				helpers[table] = append(helpers[table], h.objectName())
+			}
+			return nil
+		}
+		listHelperObjects = func(nft knftables.Interface) ([]string, error) {
+			fake := nft.(*knftables.Fake)
+			if fake.Table == nil {
+				return nil, fmt.Errorf("no such table")
+			}
+			for table, f := range fakes {
+				if f == fake {
+					return helpers[table], nil
+				}
+			}
+			return nil, nil
+		}
+		DeferCleanup(func() {
+			newNFT, addHelperObjects, listHelperObjects = origNewNFT, origAddHelperObjects, origListHelperObjects
+		})
+	})
+
+	AfterEach(func() {
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	It("assigns the helpers with ADD/CHECK/DEL", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "eth0",
+			Netns:       targetNS.Path(),
+			StdinData:   ctHelperConf(`[{"name": "ftp"}, {"name": "tftp"}]`),
+		}
+		table := tableName("cthelper-test", args.ContainerID, args.IfName)
+
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		fake := fakes[table]
+		Expect(fake.Table).NotTo(BeNil())
+		Expect(helpers[table]).To(ConsistOf("ftp_tcp_21", "tftp_udp_69"))
+		rules, err := fake.ListRules(context.TODO(), outputChain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(HaveLen(2))
+		Expect(rules[1].Rule).To(Equal(`oifname "eth0" udp dport 69 ct helper set "tftp_udp_69"`))
+		Expect(*rules[1].Comment).To(Equal("tftp_udp_69"))
+
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(Succeed())
+
+		// CHECK notices a missing rule
+		fake.Table.Chains[preroutingChain].Rules = fake.Table.Chains[preroutingChain].Rules[:1]
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(MatchError(fmt.Sprintf("rule assigning ct helper tftp_udp_69 not found in chain prerouting of table %s", table)))
+
+		// ADD again replaces the table
+		_, _, err = testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(Succeed())
+
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+		Expect(fake.Table).To(BeNil())
+
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(MatchError(fmt.Sprintf("failed to list the ct helpers of table %s: no such table", table)))
+
+		// DEL is idempotent, also once the namespace is gone
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+		args.Netns = ""
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+	})
+
+	It("requires a previous result", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "eth0",
+			Netns:       targetNS.Path(),
+			StdinData: []byte(`{
+				"cniVersion": "1.0.0",
+				"name": "cthelper-test",
+				"type": "cthelper",
+				"helpers": [{"name": "sip"}]
+			}`),
+		}
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError("must be called as chained plugin"))
+	})
+})
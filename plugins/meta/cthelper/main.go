@@ -0,0 +1,189 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin that assigns conntrack helpers to the traffic of
+// the container interface, through nftables ct helper objects. The kernel
+// no longer assigns helpers automatically, which breaks the protocols
+// opening related connections, such as active FTP.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+// defaultHelpers are the supported conntrack helpers with the protocol and
+// port of their control connection
+var defaultHelpers = map[string]Helper{
+	"ftp":  {Protocol: "tcp", Port: 21},
+	"tftp": {Protocol: "udp", Port: 69},
+	"sip":  {Protocol: "udp", Port: 5060},
+}
+
+// CTHelperConf is the chained plugin configuration
+type CTHelperConf struct {
+	types.NetConf
+
+	// Helpers are the conntrack helpers assigned to the container traffic
+	Helpers []Helper `json:"helpers"`
+}
+
+// Helper assigns a conntrack helper to the connections to a port
+type Helper struct {
+	// Name is the conntrack helper, "ftp", "tftp" or "sip"
+	Name string `json:"name"`
+	// Protocol is "tcp" or "udp", defaulting to the protocol of the helper
+	Protocol string `json:"protocol,omitempty"`
+	// Port defaults to the well-known port of the helper
+	Port int `json:"port,omitempty"`
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		/* FIXME GC */
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.4.0"), bv.BuildString("cthelper"))
+}
+
+func parseConf(data []byte) (*CTHelperConf, *current.Result, error) {
+	conf := CTHelperConf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	if len(conf.Helpers) == 0 {
+		return nil, nil, fmt.Errorf(`"helpers" is required`)
+	}
+	seen := map[string]bool{}
+	for i := range conf.Helpers {
+		h := &conf.Helpers[i]
+		def, ok := defaultHelpers[h.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported conntrack helper %q, must be \"ftp\", \"tftp\" or \"sip\"", h.Name)
+		}
+		switch h.Protocol {
+		case "":
+			h.Protocol = def.Protocol
+		case "tcp", "udp":
+		default:
+			return nil, nil, fmt.Errorf("helper %s: invalid protocol %q, must be \"tcp\" or \"udp\"", h.Name, h.Protocol)
+		}
+		if h.Port == 0 {
+			h.Port = def.Port
+		}
+		if h.Port < 0 || h.Port > 65535 {
+			return nil, nil, fmt.Errorf("helper %s: invalid port %d", h.Name, h.Port)
+		}
+		if seen[h.objectName()] {
+			return nil, nil, fmt.Errorf("helper %s: duplicate %s port %d", h.Name, h.Protocol, h.Port)
+		}
+		seen[h.objectName()] = true
+	}
+
+	return &conf, result, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	table := tableName(conf.Name, args.ContainerID, args.IfName)
+	err = netns.Do(func(_ ns.NetNS) error {
+		return setupTable(table, args.IfName, conf.Helpers)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to assign conntrack helpers: %v", err)
+	}
+
+	return types.PrintResult(conf.PrevResult, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	// The table goes with the namespace
+	if args.Netns == "" {
+		return nil
+	}
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		if _, ok := err.(ns.NSPathNotExistErr); ok {
+			return nil
+		}
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	table := tableName(conf.Name, args.ContainerID, args.IfName)
+	return netns.Do(func(_ ns.NetNS) error {
+		return deleteTable(table)
+	})
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	table := tableName(conf.Name, args.ContainerID, args.IfName)
+	return netns.Do(func(_ ns.NetNS) error {
+		return checkTable(table, conf.Helpers)
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/knftables"
+
+	"github.com/containernetworking/plugins/pkg/utils"
+)
+
+// Each attachment gets a table in the container namespace, which is
+// replaced on ADD and deleted on DEL. knftables has no ct helper objects,
+// so the plugin declares them with the nft command, while the table, its
+// chains and the rules assigning the helpers go through knftables
+// transactions. The rules carry the name of their helper as comment, by
+// which CHECK finds them.
+
+const (
+	tablePrefix = "cni_cthelper_"
+	// tableNameLength is the prefix followed by 16 hex digits of hash
+	tableNameLength = len(tablePrefix) + 16
+
+	preroutingChain = "prerouting"
+	outputChain     = "output"
+)
+
+func tableName(networkName, containerID, ifName string) string {
+	return utils.MustFormatHashWithPrefix(tableNameLength, tablePrefix, networkName+containerID+ifName)
+}
+
+// objectName is the name of the ct helper object of the helper in the table
+func (h *Helper) objectName() string {
+	return fmt.Sprintf("%s_%s_%d", h.Name, h.Protocol, h.Port)
+}
+
+// newNFT returns the knftables interface of the table in the current
+// network namespace
+var newNFT = func(table string) (knftables.Interface, error) {
+	return knftables.New(knftables.InetFamily, table)
+}
+
+// helperScript returns the nft script declaring the ct helper objects of
+// the helpers in the table
+func helperScript(table string, helpers []Helper) string {
+	b := &strings.Builder{}
+	for _, h := range helpers {
+		fmt.Fprintf(b, "add ct helper inet %s %s { type %q protocol %s ; l3proto inet ; }\n", table, h.objectName(), h.Name, h.Protocol)
+	}
+	return b.String()
+}
+
+// addHelperObjects declares the ct helper objects in the table, in the
+// current network namespace
+var addHelperObjects = func(table string, helpers []Helper) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(helperScript(table, helpers))
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nft failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// listHelperObjects returns the names of the ct helper objects of the table
+var listHelperObjects = func(nft knftables.Interface) ([]string, error) {
+	return nft.List(context.TODO(), "ct helpers")
+}
+
+// setupTable replaces the table of the attachment. The helpers are assigned
+// to the connections the container accepts in prerouting and to those it
+// opens in output.
+func setupTable(table, ifName string, helpers []Helper) error {
+	nft, err := newNFT(table)
+	if err != nil {
+		return err
+	}
+
+	// Adding the table first makes deleting it succeed on the first ADD
+	tx := nft.NewTransaction()
+	tx.Add(&knftables.Table{})
+	tx.Delete(&knftables.Table{})
+	tx.Add(&knftables.Table{
+		Comment: knftables.PtrTo("CNI cthelper plugin"),
+	})
+	if err := nft.Run(context.TODO(), tx); err != nil {
+		return fmt.Errorf("failed to create table %s: %v", table, err)
+	}
+
+	if err := addHelperObjects(table, helpers); err != nil {
+		return fmt.Errorf("failed to declare the ct helpers in table %s: %v", table, err)
+	}
+
+	tx = nft.NewTransaction()
+	for _, c := range []struct {
+		chain string
+		hook  knftables.BaseChainHook
+		match string
+	}{
+		{preroutingChain, knftables.PreroutingHook, "iifname"},
+		{outputChain, knftables.OutputHook, "oifname"},
+	} {
+		tx.Add(&knftables.Chain{
+			Name:     c.chain,
+			Type:     knftables.PtrTo(knftables.FilterType),
+			Hook:     knftables.PtrTo(c.hook),
+			Priority: knftables.PtrTo(knftables.FilterPriority),
+		})
+		for _, h := range helpers {
+			tx.Add(&knftables.Rule{
+				Chain: c.chain,
+				Rule: knftables.Concat(
+					c.match, strconv.Quote(ifName),
+					h.Protocol, "dport", h.Port,
+					"ct", "helper", "set", strconv.Quote(h.objectName()),
+				),
+				Comment: knftables.PtrTo(h.objectName()),
+			})
+		}
+	}
+	if err := nft.Run(context.TODO(), tx); err != nil {
+		return fmt.Errorf("failed to assign the ct helpers in table %s: %v", table, err)
+	}
+	return nil
+}
+
+// deleteTable deletes the table of the attachment, which succeeds when the
+// table does not exist
+func deleteTable(table string) error {
+	nft, err := newNFT(table)
+	if err != nil {
+		return err
+	}
+	tx := nft.NewTransaction()
+	tx.Add(&knftables.Table{})
+	tx.Delete(&knftables.Table{})
+	return nft.Run(context.TODO(), tx)
+}
+
+// checkTable checks that the table holds the ct helper objects and, in
+// both chains, the rules assigning them
+func checkTable(table string, helpers []Helper) error {
+	nft, err := newNFT(table)
+	if err != nil {
+		return err
+	}
+
+	objects, err := listHelperObjects(nft)
+	if err != nil {
+		return fmt.Errorf("failed to list the ct helpers of table %s: %v", table, err)
+	}
+	declared := make(map[string]bool, len(objects))
+	for _, name := range objects {
+		declared[name] = true
+	}
+	for _, h := range helpers {
+		if !declared[h.objectName()] {
+			return fmt.Errorf("ct helper %s not found in table %s", h.objectName(), table)
+		}
+	}
+
+	for _, chain := range []string{preroutingChain, outputChain} {
+		rules, err := nft.ListRules(context.TODO(), chain)
+		if err != nil {
+			return fmt.Errorf("failed to list chain %s of table %s: %v", chain, table, err)
+		}
+		assigned := make(map[string]bool, len(rules))
+		for _, r := range rules {
+			if r.Comment != nil {
+				assigned[*r.Comment] = true
+			}
+		}
+		for _, h := range helpers {
+			if !assigned[h.objectName()] {
+				return fmt.Errorf("rule assigning ct helper %s not found in chain %s of table %s", h.objectName(), chain, table)
+			}
+		}
+	}
+	return nil
+}
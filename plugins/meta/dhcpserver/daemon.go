@@ -0,0 +1,196 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+)
+
+// DHCPServer is the RPC object exposed by the daemon. It keeps the
+// bindings registered by the plugin and one responder per bridge.
+type DHCPServer struct {
+	mux        sync.Mutex
+	bindings   map[string]*Binding
+	servers    map[string]*ifaceServer
+	raInterval time.Duration
+}
+
+func newDHCPServer(raInterval time.Duration) *DHCPServer {
+	return &DHCPServer{
+		bindings:   make(map[string]*Binding),
+		servers:    make(map[string]*ifaceServer),
+		raInterval: raInterval,
+	}
+}
+
+// Register adds or refreshes a binding and makes sure its bridge is served
+func (d *DHCPServer) Register(b *Binding, _ *struct{}) error {
+	if _, err := net.ParseMAC(b.MAC); err != nil {
+		return fmt.Errorf("invalid MAC address %q: %v", b.MAC, err)
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	srv, ok := d.servers[b.Bridge]
+	if !ok {
+		var err error
+		srv, err = startIfaceServer(b.Bridge, d)
+		if err != nil {
+			return err
+		}
+		d.servers[b.Bridge] = srv
+	}
+
+	d.bindings[b.ID] = b
+	if b.RA {
+		srv.triggerRA()
+	}
+	return nil
+}
+
+// Unregister removes a binding, and stops serving its bridge when it was
+// the last one there
+func (d *DHCPServer) Unregister(id string, _ *struct{}) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	b, ok := d.bindings[id]
+	if !ok {
+		return nil
+	}
+	delete(d.bindings, id)
+
+	for _, other := range d.bindings {
+		if other.Bridge == b.Bridge {
+			return nil
+		}
+	}
+	if srv, ok := d.servers[b.Bridge]; ok {
+		srv.Stop()
+		delete(d.servers, b.Bridge)
+	}
+	return nil
+}
+
+// lookup returns the binding for the given MAC address on a bridge
+func (d *DHCPServer) lookup(bridge string, mac net.HardwareAddr) *Binding {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	for _, b := range d.bindings {
+		if b.Bridge == bridge && strings.EqualFold(b.MAC, mac.String()) {
+			return b
+		}
+	}
+	return nil
+}
+
+// bridgeBindings returns all bindings served on a bridge
+func (d *DHCPServer) bridgeBindings(bridge string) []*Binding {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	var bs []*Binding
+	for _, b := range d.bindings {
+		if b.Bridge == bridge {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
+
+func getListener(socketPath string) (net.Listener, error) {
+	l, err := activation.Listeners()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(l) == 0:
+		if err := os.MkdirAll(filepath.Dir(socketPath), 0o700); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", socketPath)
+
+	case len(l) == 1:
+		if l[0] == nil {
+			return nil, fmt.Errorf("LISTEN_FDS=1 but no FD found")
+		}
+		return l[0], nil
+
+	default:
+		return nil, fmt.Errorf("Too many (%v) FDs passed through socket activation", len(l))
+	}
+}
+
+func runDaemon(pidfilePath, socketPath string, raInterval time.Duration) error {
+	if pidfilePath != "" {
+		if !filepath.IsAbs(pidfilePath) {
+			return fmt.Errorf("Error writing pidfile %q: path not absolute", pidfilePath)
+		}
+		if err := os.WriteFile(pidfilePath, []byte(fmt.Sprintf("%d", os.Getpid())), 0o644); err != nil {
+			return fmt.Errorf("Error writing pidfile %q: %v", pidfilePath, err)
+		}
+	}
+
+	l, err := getListener(socketPath)
+	if err != nil {
+		return fmt.Errorf("Error getting listener: %v", err)
+	}
+
+	d := newDHCPServer(raInterval)
+
+	srv := http.Server{}
+	exit := make(chan os.Signal, 1)
+	done := make(chan bool, 1)
+	signal.Notify(exit, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-exit
+		srv.Shutdown(context.TODO())
+		d.mux.Lock()
+		for _, s := range d.servers {
+			s.Stop()
+		}
+		d.mux.Unlock()
+		os.Remove(socketPath)
+		os.Remove(pidfilePath)
+
+		done <- true
+	}()
+
+	rpc.Register(d)
+	rpc.HandleHTTP()
+	log.Printf("DHCP server daemon listening on %s", socketPath)
+	srv.Serve(l)
+
+	<-done
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/cni/pkg/skel"
+)
+
+var _ = Describe("dhcpserver", func() {
+	const conf = `{
+		"cniVersion": "1.0.0",
+		"name": "testnet",
+		"type": "dhcpserver",
+		"leaseTime": 600,
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [
+				{"name": "cni0", "mac": "0a:58:0a:01:02:01"},
+				{"name": "veth1234", "mac": "0a:58:0a:01:02:ff"},
+				{"name": "eth0", "mac": "0a:58:0a:01:02:03", "sandbox": "/var/run/netns/test"}
+			],
+			"ips": [
+				{"interface": 2, "address": "10.1.2.3/24", "gateway": "10.1.2.1"},
+				{"interface": 2, "address": "2001:db8::3/64", "gateway": "2001:db8::1"}
+			],
+			"routes": [
+				{"dst": "0.0.0.0/0"},
+				{"dst": "192.168.0.0/16", "gw": "10.1.2.254"}
+			],
+			"dns": {"nameservers": ["10.1.2.53", "2001:db8::53"], "domain": "example.com"}
+		}
+	}`
+
+	args := &skel.CmdArgs{ContainerID: "dummy", IfName: "eth0", StdinData: []byte(conf)}
+
+	It("builds a binding from the previous result", func() {
+		n, err := parseConfig([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+
+		b, err := newBinding(n, args)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.ID).To(Equal("dummy/testnet/eth0"))
+		Expect(b.Bridge).To(Equal("cni0"))
+		Expect(b.MAC).To(Equal("0a:58:0a:01:02:03"))
+		Expect(b.IPs).To(HaveLen(2))
+		Expect(b.LeaseTime).To(Equal(600 * time.Second))
+	})
+
+	It("fails without a previous result", func() {
+		n, err := parseConfig([]byte(`{"cniVersion": "1.0.0", "name": "testnet", "type": "dhcpserver"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = newBinding(n, args)
+		Expect(err).To(MatchError("must be called as a chained plugin"))
+	})
+
+	Context("answering requests", func() {
+		var b *Binding
+		mac, _ := net.ParseMAC("0a:58:0a:01:02:03")
+		serverID := net.IPv4(10, 1, 2, 1).To4()
+
+		BeforeEach(func() {
+			n, err := parseConfig([]byte(conf))
+			Expect(err).NotTo(HaveOccurred())
+			b, err = newBinding(n, args)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("offers the allocated address on DISCOVER", func() {
+			req, err := dhcpv4.NewDiscovery(mac)
+			Expect(err).NotTo(HaveOccurred())
+
+			reply, err := buildReply(req, b, serverID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.MessageType()).To(Equal(dhcpv4.MessageTypeOffer))
+			Expect(reply.YourIPAddr.Equal(net.IPv4(10, 1, 2, 3))).To(BeTrue())
+			Expect(reply.SubnetMask()).To(Equal(net.CIDRMask(24, 32)))
+			Expect(reply.Router()).To(HaveLen(1))
+			Expect(reply.Router()[0].Equal(net.IPv4(10, 1, 2, 1))).To(BeTrue())
+			Expect(reply.DNS()).To(HaveLen(1))
+			Expect(reply.DNS()[0].Equal(net.IPv4(10, 1, 2, 53))).To(BeTrue())
+			Expect(reply.DomainName()).To(Equal("example.com"))
+			Expect(reply.IPAddressLeaseTime(0)).To(Equal(600 * time.Second))
+			Expect(reply.ClasslessStaticRoute()).To(HaveLen(2))
+		})
+
+		It("acknowledges a REQUEST for the allocated address", func() {
+			req, err := dhcpv4.NewDiscovery(mac,
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+				dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.IPv4(10, 1, 2, 3))),
+				dhcpv4.WithOption(dhcpv4.OptServerIdentifier(serverID)))
+			Expect(err).NotTo(HaveOccurred())
+
+			reply, err := buildReply(req, b, serverID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.MessageType()).To(Equal(dhcpv4.MessageTypeAck))
+		})
+
+		It("refuses a REQUEST for another address", func() {
+			req, err := dhcpv4.NewDiscovery(mac,
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+				dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.IPv4(10, 1, 2, 4))))
+			Expect(err).NotTo(HaveOccurred())
+
+			reply, err := buildReply(req, b, serverID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.MessageType()).To(Equal(dhcpv4.MessageTypeNak))
+		})
+
+		It("ignores a REQUEST for another server", func() {
+			req, err := dhcpv4.NewDiscovery(mac,
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+				dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.IPv4(10, 9, 9, 9))))
+			Expect(err).NotTo(HaveOccurred())
+
+			reply, err := buildReply(req, b, serverID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply).To(BeNil())
+		})
+	})
+
+	It("builds a router advertisement", func() {
+		hwAddr, _ := net.ParseMAC("0a:58:0a:01:02:01")
+		_, prefix, _ := net.ParseCIDR("2001:db8::/64")
+
+		ra := buildRA(hwAddr, []net.IPNet{*prefix}, raRouterLifetime)
+		Expect(ra).To(HaveLen(16 + 8 + 32))
+		Expect(ra[0]).To(Equal(byte(134)))
+		Expect(ra[6:8]).To(Equal([]byte{0x07, 0x08}))
+		Expect(net.HardwareAddr(ra[18:24])).To(Equal(hwAddr))
+		Expect(ra[24]).To(Equal(byte(3)))
+		Expect(ra[26]).To(Equal(byte(64)))
+		Expect(net.IP(ra[40:56]).Equal(prefix.IP)).To(BeTrue())
+	})
+
+	It("tracks bindings per bridge", func() {
+		d := newDHCPServer(time.Minute)
+		d.bindings["a"] = &Binding{ID: "a", Bridge: "br0", MAC: "0a:58:0a:01:02:03"}
+		d.bindings["b"] = &Binding{ID: "b", Bridge: "br1", MAC: "0a:58:0a:01:02:03"}
+
+		mac, _ := net.ParseMAC("0A:58:0A:01:02:03")
+		Expect(d.lookup("br1", mac).ID).To(Equal("b"))
+		Expect(d.bridgeBindings("br0")).To(HaveLen(1))
+
+		Expect(d.Unregister("a", &struct{}{})).To(Succeed())
+		Expect(d.bridgeBindings("br0")).To(BeEmpty())
+	})
+})
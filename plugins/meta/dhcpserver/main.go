@@ -0,0 +1,259 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin that serves the addresses allocated by the
+// previous plugin (typically bridge + host-local) over DHCPv4 and IPv6
+// router advertisements, for guests that insist on in-guest DHCP.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	defaultSocketPath = "/run/cni/dhcpserver.sock"
+	defaultLeaseTime  = time.Hour
+)
+
+// NetConf is the chained plugin configuration
+type NetConf struct {
+	types.NetConf
+
+	RawPrevResult *map[string]interface{} `json:"prevResult"`
+	PrevResult    *current.Result         `json:"-"`
+
+	DaemonSocketPath string `json:"daemonSocketPath,omitempty"`
+	// Bridge is the host interface to serve on. Defaults to the first
+	// host-side interface of the previous result.
+	Bridge string `json:"bridge,omitempty"`
+	// LeaseTime is the DHCPv4 lease time in seconds
+	LeaseTime int `json:"leaseTime,omitempty"`
+	// RouterAdvertisements enables sending IPv6 RAs on the bridge
+	RouterAdvertisements bool `json:"routerAdvertisements,omitempty"`
+}
+
+// Binding associates a container MAC address with the configuration
+// served to it
+type Binding struct {
+	ID        string
+	Bridge    string
+	MAC       string
+	IPs       []*current.IPConfig
+	Routes    []*types.Route
+	DNS       types.DNS
+	LeaseTime time.Duration
+	RA        bool
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		var pidfilePath string
+		var socketPath string
+		var raInterval time.Duration
+		daemonFlags := flag.NewFlagSet("daemon", flag.ExitOnError)
+		daemonFlags.StringVar(&pidfilePath, "pidfile", "", "optional path to write daemon PID to")
+		daemonFlags.StringVar(&socketPath, "socketpath", defaultSocketPath, "optional daemon socket path")
+		daemonFlags.DurationVar(&raInterval, "rainterval", defaultRAInterval, "interval between unsolicited router advertisements")
+		daemonFlags.Parse(os.Args[2:])
+
+		if err := runDaemon(pidfilePath, socketPath, raInterval); err != nil {
+			log.Print(err.Error())
+			os.Exit(1)
+		}
+	} else {
+		skel.PluginMainFuncs(skel.CNIFuncs{
+			Add:    cmdAdd,
+			Check:  cmdCheck,
+			Del:    cmdDel,
+			Status: cmdStatus,
+			/* FIXME GC */
+		}, version.All, bv.BuildString("dhcpserver"))
+	}
+}
+
+func parseConfig(stdin []byte) (*NetConf, error) {
+	conf := NetConf{}
+	if err := json.Unmarshal(stdin, &conf); err != nil {
+		return nil, fmt.Errorf("failed to parse network configuration: %v", err)
+	}
+
+	if conf.RawPrevResult != nil {
+		resultBytes, err := json.Marshal(conf.RawPrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("could not serialize prevResult: %v", err)
+		}
+		res, err := version.NewResult(conf.CNIVersion, resultBytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		conf.RawPrevResult = nil
+		conf.PrevResult, err = current.NewResultFromResult(res)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	if conf.LeaseTime < 0 {
+		return nil, fmt.Errorf("invalid leaseTime %d", conf.LeaseTime)
+	}
+	if conf.DaemonSocketPath == "" {
+		conf.DaemonSocketPath = defaultSocketPath
+	}
+
+	return &conf, nil
+}
+
+func bindingID(containerID, netName, ifName string) string {
+	return containerID + "/" + netName + "/" + ifName
+}
+
+// newBinding extracts the container MAC address and its configuration
+// from the previous result
+func newBinding(conf *NetConf, args *skel.CmdArgs) (*Binding, error) {
+	result := conf.PrevResult
+	if result == nil {
+		return nil, fmt.Errorf("must be called as a chained plugin")
+	}
+
+	b := &Binding{
+		ID:        bindingID(args.ContainerID, conf.Name, args.IfName),
+		Bridge:    conf.Bridge,
+		Routes:    result.Routes,
+		DNS:       result.DNS,
+		LeaseTime: defaultLeaseTime,
+		RA:        conf.RouterAdvertisements,
+	}
+	if conf.LeaseTime != 0 {
+		b.LeaseTime = time.Duration(conf.LeaseTime) * time.Second
+	}
+
+	contIdx := -1
+	for i, iface := range result.Interfaces {
+		if iface.Sandbox != "" && iface.Name == args.IfName {
+			contIdx = i
+			b.MAC = iface.Mac
+		} else if iface.Sandbox == "" && b.Bridge == "" {
+			b.Bridge = iface.Name
+		}
+	}
+	if contIdx < 0 || b.MAC == "" {
+		return nil, fmt.Errorf("could not find the MAC address of container interface %q in prevResult", args.IfName)
+	}
+	if b.Bridge == "" {
+		return nil, fmt.Errorf("could not determine the bridge to serve on")
+	}
+
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil || *ipc.Interface == contIdx {
+			b.IPs = append(b.IPs, ipc)
+		}
+	}
+	if len(b.IPs) == 0 {
+		return nil, fmt.Errorf("no IP addresses for container interface %q in prevResult", args.IfName)
+	}
+
+	return b, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	b, err := newBinding(conf, args)
+	if err != nil {
+		return err
+	}
+
+	if err := rpcCall(conf.DaemonSocketPath, "DHCPServer.Register", b, &struct{}{}); err != nil {
+		return err
+	}
+
+	return types.PrintResult(conf.PrevResult, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	client, err := rpc.DialHTTP("unix", conf.DaemonSocketPath)
+	if err != nil {
+		// Without a daemon there is no binding left to remove
+		return nil
+	}
+	defer client.Close()
+
+	id := bindingID(args.ContainerID, conf.Name, args.IfName)
+	if err := client.Call("DHCPServer.Unregister", id, &struct{}{}); err != nil {
+		return fmt.Errorf("error calling DHCPServer.Unregister: %v", err)
+	}
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	b, err := newBinding(conf, args)
+	if err != nil {
+		return err
+	}
+
+	// Registering is idempotent, and restores the binding should the
+	// daemon have been restarted since ADD
+	return rpcCall(conf.DaemonSocketPath, "DHCPServer.Register", b, &struct{}{})
+}
+
+func cmdStatus(args *skel.CmdArgs) error {
+	conf, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	client, err := rpc.DialHTTP("unix", conf.DaemonSocketPath)
+	if err != nil {
+		return fmt.Errorf("error dialing DHCP server daemon: %v", err)
+	}
+	return client.Close()
+}
+
+func rpcCall(socketPath, method string, args, result interface{}) error {
+	client, err := rpc.DialHTTP("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("error dialing DHCP server daemon: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Call(method, args, result); err != nil {
+		return fmt.Errorf("error calling %v: %v", method, err)
+	}
+	return nil
+}
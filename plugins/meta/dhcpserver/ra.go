@@ -0,0 +1,165 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const (
+	defaultRAInterval = 200 * time.Second
+
+	// Lifetimes advertised for the router and its prefixes, in seconds
+	raRouterLifetime = 1800
+	raValidLifetime  = 2592000
+	raPrefLifetime   = 604800
+)
+
+func (s *ifaceServer) triggerRA() {
+	select {
+	case s.raTrigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *ifaceServer) serveRA() {
+	ticker := time.NewTicker(s.d.raInterval)
+	defer ticker.Stop()
+	defer func() {
+		if s.raFd >= 0 {
+			unix.Close(s.raFd)
+		}
+	}()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.raTrigger:
+		}
+		if err := s.sendRA(); err != nil {
+			log.Printf("%s: %v", s.name, err)
+		}
+	}
+}
+
+// raPrefixes collects the on-link IPv6 prefixes, and whether a default
+// router should be announced, from the bindings asking for RAs
+func (s *ifaceServer) raPrefixes() ([]net.IPNet, bool) {
+	var prefixes []net.IPNet
+	isRouter := false
+	seen := map[string]bool{}
+	for _, b := range s.d.bridgeBindings(s.name) {
+		if !b.RA {
+			continue
+		}
+		for _, ipc := range b.IPs {
+			if ipc.Address.IP.To4() != nil {
+				continue
+			}
+			if ipc.Gateway != nil {
+				isRouter = true
+			}
+			prefix := net.IPNet{IP: ipc.Address.IP.Mask(ipc.Address.Mask), Mask: ipc.Address.Mask}
+			if !seen[prefix.String()] {
+				seen[prefix.String()] = true
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes, isRouter
+}
+
+func (s *ifaceServer) sendRA() error {
+	prefixes, isRouter := s.raPrefixes()
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	link, err := netlinksafe.LinkByName(s.name)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", s.name, err)
+	}
+
+	if s.raFd < 0 {
+		fd, err := unix.Socket(unix.AF_INET6, unix.SOCK_RAW, unix.IPPROTO_ICMPV6)
+		if err != nil {
+			return fmt.Errorf("failed to open ICMPv6 socket: %v", err)
+		}
+		if err := unix.BindToDevice(fd, s.name); err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("failed to bind ICMPv6 socket to %q: %v", s.name, err)
+		}
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_HOPS, 255); err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("failed to set multicast hop limit: %v", err)
+		}
+		s.raFd = fd
+	}
+
+	lifetime := uint16(0)
+	if isRouter {
+		lifetime = raRouterLifetime
+	}
+	msg := buildRA(link.Attrs().HardwareAddr, prefixes, lifetime)
+
+	sa := &unix.SockaddrInet6{ZoneId: uint32(link.Attrs().Index)}
+	copy(sa.Addr[:], net.IPv6linklocalallnodes)
+	if err := unix.Sendto(s.raFd, msg, 0, sa); err != nil {
+		return fmt.Errorf("failed to send router advertisement: %v", err)
+	}
+	return nil
+}
+
+// buildRA builds an ICMPv6 router advertisement announcing the given
+// prefixes as on-link. Addresses are not autoconfigured from them since
+// they are handed out by IPAM. The kernel fills in the checksum.
+func buildRA(hwAddr net.HardwareAddr, prefixes []net.IPNet, routerLifetime uint16) []byte {
+	b := make([]byte, 16, 16+8+32*len(prefixes))
+	b[0] = 134 // router advertisement
+	b[4] = 64  // current hop limit
+	binary.BigEndian.PutUint16(b[6:8], routerLifetime)
+
+	if len(hwAddr) == 6 {
+		lla := make([]byte, 8)
+		lla[0] = 1 // source link-layer address
+		lla[1] = 1
+		copy(lla[2:], hwAddr)
+		b = append(b, lla...)
+	}
+
+	for _, p := range prefixes {
+		ones, _ := p.Mask.Size()
+		pi := make([]byte, 32)
+		pi[0] = 3 // prefix information
+		pi[1] = 4
+		pi[2] = byte(ones)
+		pi[3] = 0x80 // on-link
+		binary.BigEndian.PutUint32(pi[4:8], raValidLifetime)
+		binary.BigEndian.PutUint32(pi[8:12], raPrefLifetime)
+		copy(pi[16:32], p.IP.To16())
+		b = append(b, pi...)
+	}
+	return b
+}
@@ -0,0 +1,278 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"syscall"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// ifaceServer answers DHCPv4 requests and sends router advertisements on a
+// single bridge
+type ifaceServer struct {
+	name      string
+	d         *DHCPServer
+	conn      net.PacketConn
+	raFd      int
+	raTrigger chan struct{}
+	stop      chan struct{}
+}
+
+func startIfaceServer(name string, d *DHCPServer) (*ifaceServer, error) {
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); sockErr != nil {
+					return
+				}
+				if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1); sockErr != nil {
+					return
+				}
+				sockErr = unix.BindToDevice(int(fd), name)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", dhcpv4.ServerPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for DHCP on %q: %v", name, err)
+	}
+
+	s := &ifaceServer{
+		name:      name,
+		d:         d,
+		conn:      conn,
+		raFd:      -1,
+		raTrigger: make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	go s.serveDHCP()
+	go s.serveRA()
+	return s, nil
+}
+
+// Stop closes the sockets of the server; it must not wait for the serving
+// goroutines as they may be blocked on the daemon lock held by the caller
+func (s *ifaceServer) Stop() {
+	close(s.stop)
+	s.conn.Close()
+}
+
+func (s *ifaceServer) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ifaceServer) serveDHCP() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if s.stopped() {
+				return
+			}
+			log.Printf("%s: error reading DHCP request: %v", s.name, err)
+			continue
+		}
+
+		req, err := dhcpv4.FromBytes(buf[:n])
+		if err != nil {
+			log.Printf("%s: ignoring malformed DHCP packet from %v: %v", s.name, peer, err)
+			continue
+		}
+		if req.OpCode != dhcpv4.OpcodeBootRequest {
+			continue
+		}
+
+		if err := s.handle(req); err != nil {
+			log.Printf("%s: %v", s.name, err)
+		}
+	}
+}
+
+func (s *ifaceServer) handle(req *dhcpv4.DHCPv4) error {
+	b := s.d.lookup(s.name, req.ClientHWAddr)
+	if b == nil {
+		// Not one of ours, another server may answer
+		return nil
+	}
+
+	serverID, err := s.serverIP(b)
+	if err != nil {
+		return err
+	}
+
+	reply, err := buildReply(req, b, serverID)
+	if err != nil || reply == nil {
+		return err
+	}
+
+	dst := &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}
+	switch {
+	case req.GatewayIPAddr != nil && !req.GatewayIPAddr.IsUnspecified():
+		dst = &net.UDPAddr{IP: req.GatewayIPAddr, Port: dhcpv4.ServerPort}
+	case req.ClientIPAddr != nil && !req.ClientIPAddr.IsUnspecified() && reply.MessageType() != dhcpv4.MessageTypeNak:
+		dst = &net.UDPAddr{IP: req.ClientIPAddr, Port: dhcpv4.ClientPort}
+	}
+
+	if _, err := s.conn.WriteTo(reply.ToBytes(), dst); err != nil {
+		return fmt.Errorf("failed to send DHCP %s to %s: %v", reply.MessageType(), req.ClientHWAddr, err)
+	}
+	return nil
+}
+
+// serverIP returns the address used as DHCP server identifier: the
+// binding's gateway when set, else the first IPv4 address of the bridge
+func (s *ifaceServer) serverIP(b *Binding) (net.IP, error) {
+	if ipc := b.ipv4(); ipc != nil && ipc.Gateway.To4() != nil {
+		return ipc.Gateway.To4(), nil
+	}
+
+	link, err := netlinksafe.LinkByName(s.name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup %q: %v", s.name, err)
+	}
+	addrs, err := netlinksafe.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of %q: %v", s.name, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%q has no IPv4 address to serve DHCP from", s.name)
+	}
+	return addrs[0].IP.To4(), nil
+}
+
+// ipv4 returns the first IPv4 configuration of the binding
+func (b *Binding) ipv4() *current.IPConfig {
+	for _, ipc := range b.IPs {
+		if ipc.Address.IP.To4() != nil {
+			return ipc
+		}
+	}
+	return nil
+}
+
+// buildReply answers a client request with the binding's configuration.
+// A nil reply means the request is not to be answered.
+func buildReply(req *dhcpv4.DHCPv4, b *Binding, serverID net.IP) (*dhcpv4.DHCPv4, error) {
+	ipc := b.ipv4()
+	if ipc == nil {
+		return nil, nil
+	}
+	addr := ipc.Address.IP.To4()
+
+	var msgType dhcpv4.MessageType
+	switch req.MessageType() {
+	case dhcpv4.MessageTypeDiscover:
+		msgType = dhcpv4.MessageTypeOffer
+	case dhcpv4.MessageTypeRequest:
+		if sid := req.ServerIdentifier(); sid != nil && !sid.Equal(serverID) {
+			// The client selected another server
+			return nil, nil
+		}
+		requested := req.RequestedIPAddress()
+		if requested == nil {
+			requested = req.ClientIPAddr
+		}
+		msgType = dhcpv4.MessageTypeAck
+		if !requested.Equal(addr) {
+			msgType = dhcpv4.MessageTypeNak
+		}
+	case dhcpv4.MessageTypeInform:
+		msgType = dhcpv4.MessageTypeAck
+	default:
+		// Release and decline are meaningless as the address is owned by
+		// the CNI attachment
+		return nil, nil
+	}
+
+	mods := []dhcpv4.Modifier{
+		dhcpv4.WithMessageType(msgType),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(serverID)),
+	}
+	if msgType == dhcpv4.MessageTypeNak {
+		return dhcpv4.NewReplyFromRequest(req, mods...)
+	}
+
+	if req.MessageType() != dhcpv4.MessageTypeInform {
+		mods = append(mods,
+			dhcpv4.WithYourIP(addr),
+			dhcpv4.WithLeaseTime(uint32(b.LeaseTime.Seconds())),
+		)
+	}
+	mods = append(mods, dhcpv4.WithNetmask(ipc.Address.Mask))
+
+	gw := ipc.Gateway.To4()
+	if gw != nil {
+		mods = append(mods, dhcpv4.WithRouter(gw))
+	}
+
+	// Clients honoring classless static routes ignore the router option,
+	// so the default route must be repeated there
+	var routes []*dhcpv4.Route
+	for _, r := range b.Routes {
+		if r.Dst.IP.To4() == nil {
+			continue
+		}
+		rgw := r.GW.To4()
+		if rgw == nil {
+			rgw = gw
+		}
+		if rgw == nil {
+			continue
+		}
+		dst := r.Dst
+		routes = append(routes, &dhcpv4.Route{Dest: &dst, Router: rgw})
+	}
+	if len(routes) > 0 {
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptClasslessStaticRoute(routes...)))
+	}
+
+	var dns []net.IP
+	for _, ns := range b.DNS.Nameservers {
+		if nsIP := net.ParseIP(ns).To4(); nsIP != nil {
+			dns = append(dns, nsIP)
+		}
+	}
+	if len(dns) > 0 {
+		mods = append(mods, dhcpv4.WithDNS(dns...))
+	}
+	if b.DNS.Domain != "" {
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptDomainName(b.DNS.Domain)))
+	}
+	if len(b.DNS.Search) > 0 {
+		mods = append(mods, dhcpv4.WithDomainSearchList(b.DNS.Search...))
+	}
+
+	return dhcpv4.NewReplyFromRequest(req, mods...)
+}
@@ -0,0 +1,199 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const netnsPath = "/var/run/netns/cni-test"
+
+func dnsConf(extra string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "dns-test",
+		"type": "dns",
+		%s
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [{"name": "eth0", "sandbox": %q}],
+			"ips": [{"interface": 0, "address": "10.1.2.3/24"}],
+			"dns": {"nameservers": ["10.1.2.1"]}
+		}
+	}`, extra, netnsPath))
+}
+
+func runAdd(args *skel.CmdArgs) *types100.Result {
+	r, _, err := testutils.CmdAddWithArgs(args, func() error {
+		return cmdAdd(args)
+	})
+	Expect(err).NotTo(HaveOccurred())
+	result, err := types100.GetResult(r)
+	Expect(err).NotTo(HaveOccurred())
+	return result
+}
+
+var _ = Describe("dns plugin", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "dns-test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	newArgs := func(conf []byte) *skel.CmdArgs {
+		return &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       netnsPath,
+			IfName:      "eth0",
+			StdinData:   conf,
+		}
+	}
+
+	It("keeps the DNS of the previous result without a source", func() {
+		result := runAdd(newArgs(dnsConf("")))
+		Expect(result.DNS).To(Equal(types.DNS{Nameservers: []string{"10.1.2.1"}}))
+	})
+
+	It("sets the DNS of the configuration", func() {
+		result := runAdd(newArgs(dnsConf(`
+			"dns": {"nameservers": ["10.0.0.53"], "domain": "example.com", "search": ["example.com"]},`)))
+		Expect(result.DNS).To(Equal(types.DNS{
+			Nameservers: []string{"10.0.0.53"},
+			Domain:      "example.com",
+			Search:      []string{"example.com"},
+		}))
+	})
+
+	It("prefers the DNS file over the configuration", func() {
+		dnsFile := filepath.Join(tmpDir, "resolv.conf")
+		Expect(os.WriteFile(dnsFile, []byte(`# comment
+nameserver 10.0.0.54
+nameserver 2001:db8::53
+search a.example.com b.example.com
+options ndots:2 edns0
+`), 0o644)).To(Succeed())
+
+		result := runAdd(newArgs(dnsConf(fmt.Sprintf(`
+			"dns": {"nameservers": ["10.0.0.53"]},
+			"dnsFile": %q,`, dnsFile))))
+		Expect(result.DNS).To(Equal(types.DNS{
+			Nameservers: []string{"10.0.0.54", "2001:db8::53"},
+			Search:      []string{"a.example.com", "b.example.com"},
+			Options:     []string{"ndots:2", "edns0"},
+		}))
+	})
+
+	It("prefers the DNS of the runtime", func() {
+		result := runAdd(newArgs(dnsConf(`
+			"dns": {"nameservers": ["10.0.0.53"]},
+			"runtimeConfig": {"dns": {"servers": ["10.0.0.55"], "searches": ["pod.example.com"], "options": ["ndots:5"]}},`)))
+		Expect(result.DNS).To(Equal(types.DNS{
+			Nameservers: []string{"10.0.0.55"},
+			Search:      []string{"pod.example.com"},
+			Options:     []string{"ndots:5"},
+		}))
+	})
+
+	It("fails when the DNS file is missing", func() {
+		args := newArgs(dnsConf(fmt.Sprintf(`"dnsFile": %q,`, filepath.Join(tmpDir, "missing"))))
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError(ContainSubstring("failed to read DNS file")))
+	})
+
+	It("fails when not chained", func() {
+		args := newArgs([]byte(`{"cniVersion": "1.0.0", "name": "dns-test", "type": "dns"}`))
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError("must be called as chained plugin"))
+	})
+
+	It("writes the resolv.conf of the namespace with ADD/CHECK/DEL", func() {
+		args := newArgs(dnsConf(fmt.Sprintf(`
+			"dns": {"nameservers": ["10.0.0.53"], "search": ["example.com"]},
+			"writeResolvConf": true,
+			"resolvConfDir": %q,`, tmpDir)))
+
+		result := runAdd(args)
+		resolvConf := filepath.Join(tmpDir, "cni-test", "resolv.conf")
+		data, err := os.ReadFile(resolvConf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(`# Generated by the dns CNI plugin
+search example.com
+nameserver 10.0.0.53
+`))
+
+		// CHECK is passed the result of the chain
+		checkConf := fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "dns-test",
+			"type": "dns",
+			"dns": {"nameservers": ["10.0.0.53"], "search": ["example.com"]},
+			"writeResolvConf": true,
+			"resolvConfDir": %q,
+			"prevResult": {
+				"cniVersion": "1.0.0",
+				"dns": {"nameservers": %q, "search": %q}
+			}
+		}`, tmpDir, result.DNS.Nameservers, result.DNS.Search)
+		args.StdinData = []byte(checkConf)
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(Succeed())
+
+		Expect(os.WriteFile(resolvConf, []byte("nameserver 8.8.8.8\n"), 0o644)).To(Succeed())
+		err = testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})
+		Expect(err).To(MatchError(ContainSubstring("doesn't match the DNS of the result")))
+
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+		Expect(filepath.Join(tmpDir, "cni-test")).NotTo(BeADirectory())
+
+		// DEL is idempotent
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+	})
+
+	It("requires a named namespace to write the resolv.conf", func() {
+		args := newArgs(dnsConf(`"writeResolvConf": true,`))
+		args.Netns = "/proc/1234/ns/net"
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError(ContainSubstring("writeResolvConf requires a named network namespace")))
+	})
+})
@@ -0,0 +1,211 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin setting the DNS of the result from its
+// configuration, a resolv.conf file or the runtime, and optionally writing
+// it to the resolv.conf of the network namespace.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/resolvconf"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const defaultResolvConfDir = "/etc/netns"
+
+// DNSConf is the chained plugin configuration. The DNS is taken from the
+// runtime configuration, else from DNSFile, else from the dns of the
+// configuration, else left as set by the previous plugins.
+type DNSConf struct {
+	types.NetConf
+
+	// DNSFile is a file in the resolv.conf format
+	DNSFile string `json:"dnsFile,omitempty"`
+	// WriteResolvConf writes the DNS to the resolv.conf of the namespace,
+	// under ResolvConfDir, which "ip netns exec" uses instead of
+	// /etc/resolv.conf
+	WriteResolvConf bool   `json:"writeResolvConf,omitempty"`
+	ResolvConfDir   string `json:"resolvConfDir,omitempty"`
+
+	RuntimeConfig struct {
+		DNS *RuntimeDNS `json:"dns,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+}
+
+// RuntimeDNS is the DNS passed by the runtime with the dns capability
+type RuntimeDNS struct {
+	Servers  []string `json:"servers,omitempty"`
+	Searches []string `json:"searches,omitempty"`
+	Options  []string `json:"options,omitempty"`
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		/* FIXME GC */
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("dns"))
+}
+
+func parseConf(data []byte) (*DNSConf, *current.Result, error) {
+	conf := DNSConf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	if conf.ResolvConfDir == "" {
+		conf.ResolvConfDir = defaultResolvConfDir
+	}
+	return &conf, result, nil
+}
+
+// dns returns the DNS of the attachment, or nil when the one of the
+// previous result is kept
+func (c *DNSConf) dns() (*types.DNS, error) {
+	if rc := c.RuntimeConfig.DNS; rc != nil {
+		return &types.DNS{
+			Nameservers: rc.Servers,
+			Search:      rc.Searches,
+			Options:     rc.Options,
+		}, nil
+	}
+	if c.DNSFile != "" {
+		dns, err := resolvconf.ParseFile(c.DNSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DNS file: %v", err)
+		}
+		return dns, nil
+	}
+	if !c.DNS.IsEmpty() {
+		return &c.DNS, nil
+	}
+	return nil, nil
+}
+
+// resolvConfPath returns the resolv.conf of the named network namespace,
+// the ones created by "ip netns add" or the runtimes under /run/netns
+func (c *DNSConf) resolvConfPath(netns string) (string, error) {
+	if filepath.Base(filepath.Dir(netns)) != "netns" {
+		return "", fmt.Errorf("writeResolvConf requires a named network namespace, not %q", netns)
+	}
+	return filepath.Join(c.ResolvConfDir, filepath.Base(netns), "resolv.conf"), nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	dns, err := conf.dns()
+	if err != nil {
+		return err
+	}
+	if dns != nil {
+		result.DNS = *dns
+	}
+
+	if conf.WriteResolvConf {
+		path, err := conf.resolvConfPath(args.Netns)
+		if err != nil {
+			return err
+		}
+		if err := writeResolvConf(path, &result.DNS); err != nil {
+			return err
+		}
+	}
+
+	return types.PrintResult(result, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if !conf.WriteResolvConf || args.Netns == "" {
+		return nil
+	}
+	path, err := conf.resolvConfPath(args.Netns)
+	if err != nil {
+		return err
+	}
+	return removeResolvConf(path)
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	dns, err := conf.dns()
+	if err != nil {
+		return err
+	}
+	if dns != nil && !sameDNS(dns, &result.DNS) {
+		return fmt.Errorf("dns: DNS of the result %+v doesn't match the configured %+v", result.DNS, *dns)
+	}
+
+	if conf.WriteResolvConf {
+		path, err := conf.resolvConfPath(args.Netns)
+		if err != nil {
+			return err
+		}
+		written, err := resolvconf.ParseFile(path)
+		if err != nil {
+			return fmt.Errorf("dns: failed to read %s: %v", path, err)
+		}
+		if !sameDNS(written, &result.DNS) {
+			return fmt.Errorf("dns: %s doesn't match the DNS of the result", path)
+		}
+	}
+	return nil
+}
+
+func sameDNS(a, b *types.DNS) bool {
+	return slices.Equal(a.Nameservers, b.Nameservers) &&
+		a.Domain == b.Domain &&
+		slices.Equal(a.Search, b.Search) &&
+		slices.Equal(a.Options, b.Options)
+}
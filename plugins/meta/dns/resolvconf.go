@@ -0,0 +1,69 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/pkg/resolvconf"
+)
+
+// formatResolvConf renders the DNS in the resolv.conf format
+func formatResolvConf(dns *types.DNS) []byte {
+	return append([]byte("# Generated by the dns CNI plugin\n"), resolvconf.Format(dns)...)
+}
+
+// writeResolvConf replaces the file atomically, the processes of the
+// namespace may be reading it
+func writeResolvConf(path string, dns *types.DNS) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %q: %v", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".resolv.conf-")
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(formatResolvConf(dns)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	return nil
+}
+
+// removeResolvConf removes the file, and its directory once empty
+func removeResolvConf(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %q: %v", path, err)
+	}
+	// Other files of the namespace, such as hosts, keep the directory
+	_ = os.Remove(filepath.Dir(path))
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+
+	"github.com/containernetworking/plugins/pkg/utils"
+)
+
+const bypassComment = "CNI firewall plugin bypass"
+
+// Bypass lists the traffic which is not subject to the plugin's chains,
+// such as monitoring scrapers or kubelet probes, so that a restrictive
+// admin chain or ingress policy cannot lock it out.
+type Bypass struct {
+	// Sources are CIDRs whose traffic, in both directions, bypasses the
+	// plugin's chains
+	Sources []string `json:"sources,omitempty"`
+	// Marks are packet marks, as value or value/mask, bypassing the
+	// plugin's chains
+	Marks []string `json:"marks,omitempty"`
+}
+
+func (b *Bypass) empty() bool {
+	return b == nil || (len(b.Sources) == 0 && len(b.Marks) == 0)
+}
+
+func (b *Bypass) validate() error {
+	if b == nil {
+		return nil
+	}
+	for _, src := range b.Sources {
+		if _, _, err := net.ParseCIDR(src); err != nil {
+			return fmt.Errorf("invalid bypass source %q: %v", src, err)
+		}
+	}
+	for _, mark := range b.Marks {
+		if err := validateMark(mark); err != nil {
+			return fmt.Errorf("invalid bypass mark %q: %v", mark, err)
+		}
+	}
+	return nil
+}
+
+func validateMark(mark string) error {
+	value, mask, hasMask := strings.Cut(mark, "/")
+	if _, err := strconv.ParseUint(value, 0, 32); err != nil {
+		return err
+	}
+	if hasMask {
+		if _, err := strconv.ParseUint(mask, 0, 32); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bypassMatches returns the iptables matches of the bypassed traffic for
+// the given IP family
+func bypassMatches(b *Bypass, proto iptables.Protocol) [][]string {
+	if b == nil {
+		return nil
+	}
+
+	var matches [][]string
+	for _, src := range b.Sources {
+		_, ipn, _ := net.ParseCIDR(src)
+		if protoForIP(*ipn) != proto {
+			continue
+		}
+		matches = append(matches,
+			[]string{"-s", ipn.String()},
+			[]string{"-d", ipn.String()},
+		)
+	}
+	for _, mark := range b.Marks {
+		matches = append(matches, []string{"-m", "mark", "--mark", mark})
+	}
+	return matches
+}
+
+// bypassRules returns the rules jumping to target for the bypassed traffic
+func bypassRules(b *Bypass, proto iptables.Protocol, target string) [][]string {
+	var rules [][]string
+	for _, match := range bypassMatches(b, proto) {
+		rule := append(match, "-j", target)
+		rules = append(rules, withComment(rule, bypassComment))
+	}
+	return rules
+}
+
+// ensureBypassRules prepends the bypass rules to chain, so that they come
+// before any rule installed by the plugin or the admin
+func ensureBypassRules(ipt *iptables.IPTables, chain string, rules [][]string) error {
+	// Insert in reverse order so that the rules keep the configured order
+	for i := len(rules) - 1; i >= 0; i-- {
+		if err := utils.InsertUnique(ipt, filterTableName, chain, true, rules[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkBypassRules(ipt *iptables.IPTables, chain string, rules [][]string) error {
+	for _, rule := range rules {
+		exists, err := ipt.Exists(filterTableName, chain, rule...)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("expected %v bypass rule %v not found", chain, rule)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+)
+
+// IptablesMode selects the iptables variant the rules are added with
+type IptablesMode = string
+
+const (
+	// IptablesModeAuto ("auto"): the variant already holding the rules of
+	// the node, or the one installed as iptables when none does.
+	// IptablesModeAuto is the default mode.
+	IptablesModeAuto IptablesMode = "auto"
+
+	// IptablesModeLegacy ("legacy"): iptables-legacy, on top of x_tables
+	IptablesModeLegacy IptablesMode = "legacy"
+
+	// IptablesModeNft ("nft"): iptables-nft, on top of nf_tables
+	IptablesModeNft IptablesMode = "nft"
+)
+
+// iptablesVariant is an iptables implementation installed on the node.
+//
+// Both variants can be installed at once, and the kernel then evaluates the
+// rules of each separately: an ACCEPT in one doesn't override a DROP in the
+// other, so the rules must be added with the variant the rest of the node
+// uses.
+type iptablesVariant struct {
+	mode IptablesMode
+	// suffix is the suffix of its commands, e.g. "-nft" for iptables-nft,
+	// and empty when it is only installed as iptables
+	suffix string
+	// inUse is whether its filter table holds the chains of the plugin
+	inUse bool
+}
+
+func (v *iptablesVariant) String() string {
+	return "iptables-" + v.mode
+}
+
+// command returns the name of the tool of the variant for the IP family,
+// e.g. "ip6tables-nft-restore" for the "-restore" tool
+func (v *iptablesVariant) command(proto iptables.Protocol, tool string) string {
+	cmd := "iptables"
+	if proto == iptables.ProtocolIPv6 {
+		cmd = "ip6tables"
+	}
+	return cmd + v.suffix + tool
+}
+
+func (v *iptablesVariant) newIPTables(proto iptables.Protocol) (*iptables.IPTables, error) {
+	return iptables.New(iptables.IPFamily(proto), iptables.Timeout(0), iptables.Path(v.command(proto, "")))
+}
+
+// hasPluginChains reports whether the IPv4 filter table of the variant
+// holds the private chain of the plugin, which is only looked up rather
+// than dumped with the rest of the table
+func (v *iptablesVariant) hasPluginChains() bool {
+	ipt, err := v.newIPTables(iptables.ProtocolIPv4)
+	if err != nil {
+		return false
+	}
+	exists, err := ipt.ChainExists(filterTableName, privChainName)
+	return err == nil && exists
+}
+
+// modeOfVersion returns the mode of the iptables printing the version, e.g.
+// "iptables v1.8.7 (nf_tables)". Versions before 1.8 only exist in legacy
+// mode and don't print it.
+func modeOfVersion(version string) IptablesMode {
+	if strings.Contains(version, "(nf_tables)") {
+		return IptablesModeNft
+	}
+	return IptablesModeLegacy
+}
+
+// defaultIptablesMode returns the mode of the variant installed as iptables
+func defaultIptablesMode() (IptablesMode, error) {
+	out, err := exec.Command("iptables", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return modeOfVersion(string(out)), nil
+}
+
+// iptablesInstalled reports whether any iptables variant is installed,
+// without running it
+func iptablesInstalled() bool {
+	for _, cmd := range []string{"iptables", "iptables-" + IptablesModeLegacy, "iptables-" + IptablesModeNft} {
+		if _, err := exec.LookPath(cmd); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// findIptablesVariants returns the iptables variants installed on the node,
+// starting with the one installed as iptables
+func findIptablesVariants() []iptablesVariant {
+	defaultMode, err := defaultIptablesMode()
+	if err != nil {
+		defaultMode = ""
+	}
+
+	var variants []iptablesVariant
+	for _, mode := range []IptablesMode{IptablesModeLegacy, IptablesModeNft} {
+		v := iptablesVariant{mode: mode, suffix: "-" + mode}
+		if _, err := exec.LookPath(v.command(iptables.ProtocolIPv4, "")); err != nil {
+			continue
+		}
+		if mode == defaultMode {
+			variants = append([]iptablesVariant{v}, variants...)
+		} else {
+			variants = append(variants, v)
+		}
+	}
+	// Older distributions only install iptables itself
+	if len(variants) == 0 && defaultMode != "" {
+		variants = append(variants, iptablesVariant{mode: defaultMode})
+	}
+	return variants
+}
+
+// variantCacheFile records the variant found holding the chains of the
+// plugin, so that the variants are only probed until the first attachment
+// of the boot. It lives on tmpfs, as the chains do.
+var variantCacheFile = "/run/cni/firewall/iptables-mode"
+
+// markCachedVariant marks the variant recorded in the cache as in use. It
+// returns false when the cache doesn't name one of the variants.
+func markCachedVariant(variants []iptablesVariant) bool {
+	data, err := os.ReadFile(variantCacheFile)
+	if err != nil {
+		return false
+	}
+	mode := strings.TrimSpace(string(data))
+	for i := range variants {
+		if variants[i].mode == mode {
+			variants[i].inUse = true
+			return true
+		}
+	}
+	return false
+}
+
+// cacheVariant records the variant holding the chains of the plugin. The
+// cache is only an optimization, so failing to write it is not an error.
+func cacheVariant(v *iptablesVariant) {
+	if err := os.MkdirAll(filepath.Dir(variantCacheFile), 0o755); err != nil {
+		return
+	}
+	_ = os.WriteFile(variantCacheFile, []byte(v.mode+"\n"), 0o644)
+}
+
+// probeVariants marks the variant holding the chains of the plugin as in
+// use, from the cache or else by looking the chains up in each variant
+func probeVariants(variants []iptablesVariant) {
+	if markCachedVariant(variants) {
+		return
+	}
+	for i := range variants {
+		if variants[i].hasPluginChains() {
+			variants[i].inUse = true
+			cacheVariant(&variants[i])
+			return
+		}
+	}
+}
+
+// selectIptablesVariant returns the variant of the mode among the installed
+// variants. In auto mode this is the variant holding the chains of the
+// plugin, set up along with the rest of the node, or else the first one. A
+// variant requested while the chains are in the other one is refused,
+// since the rules added would be evaluated apart from them.
+func selectIptablesVariant(mode IptablesMode, variants []iptablesVariant) (*iptablesVariant, error) {
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("iptables is not installed: use the nftables or firewalld backend")
+	}
+
+	if mode == "" || mode == IptablesModeAuto {
+		for i := range variants {
+			if variants[i].inUse {
+				return &variants[i], nil
+			}
+		}
+		return &variants[0], nil
+	}
+
+	var selected *iptablesVariant
+	for i := range variants {
+		if variants[i].mode == mode {
+			selected = &variants[i]
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("iptablesMode %q requires iptables-%s, which is not installed", mode, mode)
+	}
+	for i := range variants {
+		if other := &variants[i]; other != selected && other.inUse && !selected.inUse {
+			return nil, fmt.Errorf("the rules of the node are in %s, rules added with %s would be evaluated apart from them: use iptablesMode %q",
+				other, selected, other.mode)
+		}
+	}
+	return selected, nil
+}
+
+// detectIptablesVariant returns the variant of the node to add the rules
+// with in the mode
+func detectIptablesVariant(mode IptablesMode) (*iptablesVariant, error) {
+	variants := findIptablesVariants()
+	probeVariants(variants)
+	return selectIptablesVariant(mode, variants)
+}
+
+func validateIptablesMode(mode IptablesMode) error {
+	switch mode {
+	case "", IptablesModeAuto, IptablesModeLegacy, IptablesModeNft:
+		return nil
+	}
+	return fmt.Errorf("invalid iptablesMode %q, must be %q, %q or %q", mode, IptablesModeAuto, IptablesModeLegacy, IptablesModeNft)
+}
@@ -22,10 +22,14 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/vishvananda/netlink"
+
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/utils"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 )
 
@@ -34,9 +38,14 @@ type FirewallNetConf struct {
 	types.NetConf
 
 	// Backend is the firewall type to add rules to.  Allowed values are
-	// 'iptables' and 'firewalld'.
+	// 'iptables', 'nftables' and 'firewalld'.
 	Backend string `json:"backend"`
 
+	// IptablesMode is the optional iptables variant the rules are added
+	// with, "legacy" or "nft". Defaults to "auto", which detects the one
+	// the node uses.
+	IptablesMode IptablesMode `json:"iptablesMode,omitempty"`
+
 	// IptablesAdminChainName is an optional name to use instead of the default
 	// admin rules override chain name that includes the interface name.
 	IptablesAdminChainName string `json:"iptablesAdminChainName,omitempty"`
@@ -49,6 +58,15 @@ type FirewallNetConf struct {
 	// IngressPolicy is an optional ingress policy.
 	// Defaults to "open".
 	IngressPolicy IngressPolicy `json:"ingressPolicy,omitempty"`
+
+	// MatchInterface additionally anchors the rules on the host-side
+	// interface of the container, so that they keep applying when the
+	// container has many or changing (e.g. SLAAC) addresses.
+	MatchInterface bool `json:"matchInterface,omitempty"`
+
+	// Bypass is the optional traffic which is accepted ahead of the
+	// plugin's chains, the admin chain and the ingress policy
+	Bypass *Bypass `json:"bypass,omitempty"`
 }
 
 // IngressPolicy is an ingress policy string.
@@ -86,6 +104,40 @@ func ipString(ip net.IPNet) string {
 	return ip.IP.String() + "/32"
 }
 
+// hostPort is a host-side interface of the container
+type hostPort struct {
+	name string
+	// found is false when the interface does not exist anymore
+	found bool
+	// bridgePort is true when the interface is enslaved to a bridge
+	bridgePort bool
+}
+
+// hostPorts returns the host-side veths of the result, along with the
+// host interfaces that can no longer be found, as happens on DEL
+func hostPorts(result *current.Result) []hostPort {
+	var ports []hostPort
+	for _, iface := range result.Interfaces {
+		if iface.Sandbox != "" || iface.Name == "" {
+			continue
+		}
+		link, err := netlinksafe.LinkByName(iface.Name)
+		if err != nil {
+			ports = append(ports, hostPort{name: iface.Name})
+			continue
+		}
+		if _, ok := link.(*netlink.Veth); !ok {
+			continue
+		}
+		ports = append(ports, hostPort{
+			name:       iface.Name,
+			found:      true,
+			bridgePort: link.Attrs().MasterIndex != 0,
+		})
+	}
+	return ports
+}
+
 func parseConf(data []byte) (*FirewallNetConf, *current.Result, error) {
 	conf := FirewallNetConf{}
 	if err := json.Unmarshal(data, &conf); err != nil {
@@ -97,6 +149,14 @@ func parseConf(data []byte) (*FirewallNetConf, *current.Result, error) {
 		conf.FirewalldZone = "trusted"
 	}
 
+	if err := conf.Bypass.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateIptablesMode(conf.IptablesMode); err != nil {
+		return nil, nil, err
+	}
+
 	// Parse previous result.
 	if conf.RawPrevResult == nil {
 		// return early if there was no previous result, which is allowed for DEL calls
@@ -122,19 +182,32 @@ func getBackend(conf *FirewallNetConf) (FirewallBackend, error) {
 	switch conf.Backend {
 	case "iptables":
 		return newIptablesBackend(conf)
+	case "nftables":
+		return newNftablesBackend(conf)
 	case "firewalld":
-		return newFirewalldBackend()
+		return newFirewalldBackendForConf(conf)
 	}
 
 	// Default to firewalld if it's running
 	if isFirewalldRunning() {
-		return newFirewalldBackend()
+		return newFirewalldBackendForConf(conf)
 	}
 
-	// Otherwise iptables
+	// Otherwise iptables, unless it is not installed (and nftables is
+	// available)
+	if !iptablesInstalled() && utils.SupportsNFTables() {
+		return newNftablesBackend(conf)
+	}
 	return newIptablesBackend(conf)
 }
 
+func newFirewalldBackendForConf(conf *FirewallNetConf) (FirewallBackend, error) {
+	if !conf.Bypass.empty() {
+		return nil, fmt.Errorf("bypass is not supported by the firewalld backend")
+	}
+	return newFirewalldBackend()
+}
+
 func cmdAdd(args *skel.CmdArgs) error {
 	conf, result, err := parseConf(args.StdinData)
 	if err != nil {
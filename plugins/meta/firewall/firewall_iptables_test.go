@@ -17,6 +17,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/coreos/go-iptables/iptables"
@@ -399,3 +400,153 @@ var _ = Describe("firewall plugin iptables backend", func() {
 		})
 	}
 })
+
+var _ = Describe("firewall interface rules", func() {
+	It("matches bridge ports with physdev", func() {
+		rules := getIfaceChainRules("veth1234", true)
+		Expect(rules).To(HaveLen(2))
+		Expect(rules[0]).To(ContainElements("--physdev-out", "veth1234", "RELATED,ESTABLISHED"))
+		Expect(rules[1]).To(ContainElements("--physdev-in", "veth1234"))
+	})
+
+	It("matches routed ports by interface name", func() {
+		rules := getIfaceChainRules("veth1234", false)
+		Expect(rules).To(Equal([][]string{
+			{"-o", "veth1234", "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+			{"-i", "veth1234", "-j", "ACCEPT"},
+		}))
+	})
+
+	It("returns no rules unless matchInterface is set", func() {
+		result := &current.Result{Interfaces: []*current.Interface{{Name: "veth1234"}}}
+		Expect(ifaceRules(&FirewallNetConf{}, result)).To(BeEmpty())
+		Expect(ifaceRules(&FirewallNetConf{MatchInterface: true}, result)).To(HaveLen(4))
+	})
+})
+
+var _ = Describe("firewall bypass", func() {
+	bypass := &Bypass{
+		Sources: []string{"10.0.0.5/8", "fd00::/64"},
+		Marks:   []string{"0x4000/0x4000"},
+	}
+
+	It("matches the sources in both directions and the marks", func() {
+		Expect(bypassRules(bypass, iptables.ProtocolIPv4, "ACCEPT")).To(Equal([][]string{
+			{"-s", "10.0.0.0/8", "-j", "ACCEPT", "-m", "comment", "--comment", bypassComment},
+			{"-d", "10.0.0.0/8", "-j", "ACCEPT", "-m", "comment", "--comment", bypassComment},
+			{"-m", "mark", "--mark", "0x4000/0x4000", "-j", "ACCEPT", "-m", "comment", "--comment", bypassComment},
+		}))
+		Expect(bypassRules(bypass, iptables.ProtocolIPv6, "RETURN")).To(HaveLen(3))
+		Expect(bypassRules(nil, iptables.ProtocolIPv4, "ACCEPT")).To(BeEmpty())
+	})
+
+	It("rejects invalid sources and marks", func() {
+		Expect(bypass.validate()).To(Succeed())
+		Expect((&Bypass{Sources: []string{"10.0.0.5"}}).validate()).To(MatchError(ContainSubstring("invalid bypass source")))
+		Expect((&Bypass{Marks: []string{"0x4000/mask"}}).validate()).To(MatchError(ContainSubstring("invalid bypass mark")))
+	})
+
+	It("is refused by the firewalld backend", func() {
+		_, err := getBackend(&FirewallNetConf{Backend: "firewalld", Bypass: bypass})
+		Expect(err).To(MatchError("bypass is not supported by the firewalld backend"))
+	})
+})
+
+var _ = Describe("firewall rule batches", func() {
+	It("formats rules as iptables-restore lines", func() {
+		rule := withComment([]string{"-s", "10.0.0.0/8", "-j", "ACCEPT"}, bypassComment)
+		Expect(ruleSpec("-A", "CNI-FORWARD", rule)).To(Equal(
+			`-A CNI-FORWARD -s 10.0.0.0/8 -j ACCEPT -m comment --comment "CNI firewall plugin bypass"`))
+	})
+
+	It("adds or deletes repeated rules once", func() {
+		rules := append(getPrivChainRules("10.0.0.2/32"), getPrivChainRules("10.0.0.2/32")...)
+		Expect(uniqueRules(rules)).To(Equal(getPrivChainRules("10.0.0.2/32")))
+	})
+
+	It("builds a single iptables-restore transaction", func() {
+		batch := &ruleBatch{}
+		Expect(batch.empty()).To(BeTrue())
+		for _, rule := range getPrivChainRules("10.0.0.2/32") {
+			batch.append("CNI-FORWARD", rule)
+		}
+		batch.delete("CNI-FORWARD", []string{"-i", "veth1234", "-j", "ACCEPT"})
+		Expect(string(batch.payload())).To(Equal(`*filter
+-A CNI-FORWARD -d 10.0.0.2/32 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A CNI-FORWARD -s 10.0.0.2/32 -j ACCEPT
+-D CNI-FORWARD -i veth1234 -j ACCEPT
+COMMIT
+`))
+	})
+
+	It("uses the restore command of the IP family and variant", func() {
+		variant := &iptablesVariant{mode: IptablesModeLegacy}
+		Expect(variant.command(iptables.ProtocolIPv4, "-restore")).To(Equal("iptables-restore"))
+		Expect(variant.command(iptables.ProtocolIPv6, "-restore")).To(Equal("ip6tables-restore"))
+		variant = &iptablesVariant{mode: IptablesModeNft, suffix: "-nft"}
+		Expect(variant.command(iptables.ProtocolIPv6, "-restore")).To(Equal("ip6tables-nft-restore"))
+	})
+})
+
+var _ = Describe("firewall iptables variant detection", func() {
+	legacy := iptablesVariant{mode: IptablesModeLegacy, suffix: "-legacy"}
+	nft := iptablesVariant{mode: IptablesModeNft, suffix: "-nft"}
+	inUse := func(v iptablesVariant) iptablesVariant {
+		v.inUse = true
+		return v
+	}
+
+	It("reads the mode from the version", func() {
+		Expect(modeOfVersion("iptables v1.8.7 (nf_tables)")).To(Equal(IptablesModeNft))
+		Expect(modeOfVersion("iptables v1.8.7 (legacy)")).To(Equal(IptablesModeLegacy))
+		Expect(modeOfVersion("iptables v1.6.1")).To(Equal(IptablesModeLegacy))
+	})
+
+	It("caches the variant holding the chains", func() {
+		defaultCacheFile := variantCacheFile
+		DeferCleanup(func() { variantCacheFile = defaultCacheFile })
+		variantCacheFile = filepath.Join(GinkgoT().TempDir(), "firewall", "iptables-mode")
+
+		variants := []iptablesVariant{legacy, nft}
+		Expect(markCachedVariant(variants)).To(BeFalse())
+
+		cacheVariant(&nft)
+		Expect(markCachedVariant(variants)).To(BeTrue())
+		Expect(variants[0].inUse).To(BeFalse())
+		Expect(variants[1].inUse).To(BeTrue())
+
+		// A cached variant which is no longer installed is probed again
+		Expect(markCachedVariant([]iptablesVariant{legacy})).To(BeFalse())
+	})
+
+	DescribeTable("selects the variant of the mode",
+		func(mode IptablesMode, variants []iptablesVariant, expected IptablesMode) {
+			variant, err := selectIptablesVariant(mode, variants)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(variant.mode).To(Equal(expected))
+		},
+		Entry("the installed one", "", []iptablesVariant{nft}, IptablesModeNft),
+		Entry("the default one without the chains", IptablesModeAuto, []iptablesVariant{legacy, nft}, IptablesModeLegacy),
+		Entry("the one holding the chains", IptablesModeAuto, []iptablesVariant{nft, inUse(legacy)}, IptablesModeLegacy),
+		Entry("the requested one", IptablesModeNft, []iptablesVariant{legacy, nft}, IptablesModeNft),
+		Entry("the requested one holding the chains", IptablesModeLegacy, []iptablesVariant{nft, inUse(legacy)}, IptablesModeLegacy),
+	)
+
+	DescribeTable("fails when the rules would not be consulted with the rules of the node",
+		func(mode IptablesMode, variants []iptablesVariant, msg string) {
+			_, err := selectIptablesVariant(mode, variants)
+			Expect(err).To(MatchError(msg))
+		},
+		Entry("without iptables", IptablesModeAuto, nil,
+			"iptables is not installed: use the nftables or firewalld backend"),
+		Entry("without the requested variant", IptablesModeLegacy, []iptablesVariant{nft},
+			`iptablesMode "legacy" requires iptables-legacy, which is not installed`),
+		Entry("with the rules in the other variant", IptablesModeNft, []iptablesVariant{inUse(legacy), nft},
+			`the rules of the node are in iptables-legacy, rules added with iptables-nft would be evaluated apart from them: use iptablesMode "legacy"`),
+	)
+
+	It("rejects an invalid mode", func() {
+		_, _, err := parseConf([]byte(`{"cniVersion": "1.0.0", "name": "test", "type": "firewall", "iptablesMode": "nftables"}`))
+		Expect(err).To(MatchError(`invalid iptablesMode "nftables", must be "auto", "legacy" or "nft"`))
+	})
+})
@@ -0,0 +1,128 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/knftables"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+)
+
+var _ = Describe("firewall nftables backend", func() {
+	var (
+		fake    *knftables.Fake
+		backend *nftablesBackend
+		conf    *FirewallNetConf
+		result  *current.Result
+	)
+
+	BeforeEach(func() {
+		fake = knftables.NewFake(knftables.InetFamily, nftTableName)
+		backend = &nftablesBackend{nft: fake}
+
+		conf = &FirewallNetConf{
+			Bypass: &Bypass{
+				Sources: []string{"192.168.10.0/24"},
+				Marks:   []string{"0x4000/0x4000"},
+			},
+		}
+
+		ip4, err := types.ParseCIDR("10.0.0.2/24")
+		Expect(err).NotTo(HaveOccurred())
+		ip6, err := types.ParseCIDR("2001:db8::2/64")
+		Expect(err).NotTo(HaveOccurred())
+		result = &current.Result{
+			Interfaces: []*current.Interface{{Name: "eth0", Sandbox: "/var/run/netns/test"}},
+			IPs: []*current.IPConfig{
+				{Address: *ip4},
+				{Address: *ip6},
+			},
+		}
+	})
+
+	It("adds the rules of the attachment once", func() {
+		Expect(backend.Add(conf, result)).To(Succeed())
+		expected := strings.TrimSpace(`
+add table inet cni_firewall { comment "CNI firewall plugin" ; }
+add chain inet cni_firewall admin
+add chain inet cni_firewall attachments
+add chain inet cni_firewall forward { type filter hook forward priority 0 ; }
+add rule inet cni_firewall attachments ip daddr 10.0.0.2/32 ct state related,established accept comment "10.0.0.2/32"
+add rule inet cni_firewall attachments ip saddr 10.0.0.2/32 accept comment "10.0.0.2/32"
+add rule inet cni_firewall attachments ip6 daddr 2001:db8::2/128 ct state related,established accept comment "2001:db8::2/128"
+add rule inet cni_firewall attachments ip6 saddr 2001:db8::2/128 accept comment "2001:db8::2/128"
+add rule inet cni_firewall forward meta mark and 0x4000 == 0x4000 accept comment "CNI firewall plugin bypass: mark 0x4000/0x4000"
+add rule inet cni_firewall forward ip daddr 192.168.10.0/24 accept comment "CNI firewall plugin bypass: daddr 192.168.10.0/24"
+add rule inet cni_firewall forward ip saddr 192.168.10.0/24 accept comment "CNI firewall plugin bypass: saddr 192.168.10.0/24"
+add rule inet cni_firewall forward jump admin comment "CNI firewall plugin admin overrides"
+add rule inet cni_firewall forward jump attachments comment "CNI firewall plugin rules"
+`)
+		Expect(strings.TrimSpace(fake.Dump())).To(Equal(expected))
+		Expect(backend.Check(conf, result)).To(Succeed())
+
+		// Adding the attachment again leaves the rules as they are
+		Expect(backend.Add(conf, result)).To(Succeed())
+		Expect(strings.TrimSpace(fake.Dump())).To(Equal(expected))
+	})
+
+	It("deletes the rules of the attachment only", func() {
+		other, err := types.ParseCIDR("10.0.0.3/24")
+		Expect(err).NotTo(HaveOccurred())
+		otherResult := &current.Result{IPs: []*current.IPConfig{{Address: *other}}}
+
+		Expect(backend.Add(conf, result)).To(Succeed())
+		Expect(backend.Add(conf, otherResult)).To(Succeed())
+
+		Expect(backend.Del(conf, result)).To(Succeed())
+		Expect(backend.Check(conf, result)).To(MatchError(ContainSubstring("missing rules for")))
+		Expect(backend.Check(conf, otherResult)).To(Succeed())
+
+		rules, err := fake.ListRules(context.Background(), nftAttachmentsChain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(HaveLen(2))
+
+		// Deleting it again is a no-op
+		Expect(backend.Del(conf, result)).To(Succeed())
+	})
+
+	It("does nothing on delete without the table", func() {
+		Expect(backend.Del(conf, result)).To(Succeed())
+	})
+
+	It("accepts the traffic of the host-side interface", func() {
+		conf.MatchInterface = true
+		conf.Bypass = nil
+		result.IPs = nil
+		result.Interfaces = append(result.Interfaces, &current.Interface{Name: "veth-missing"})
+
+		Expect(backend.Add(conf, result)).To(Succeed())
+		rules, err := fake.ListRules(context.Background(), nftAttachmentsChain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(HaveLen(2))
+		Expect(rules[0].Rule).To(Equal("oifname veth-missing ct state related,established accept"))
+		Expect(rules[1].Rule).To(Equal("iifname veth-missing accept"))
+
+		Expect(backend.Del(conf, result)).To(Succeed())
+		rules, err = fake.ListRules(context.Background(), nftAttachmentsChain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(BeEmpty())
+	})
+})
@@ -35,6 +35,10 @@ const (
 	firewalldRemoveSourceMethod = "removeSource"
 	firewalldQuerySourceMethod  = "querySource"
 
+	firewalldAddInterfaceMethod    = "addInterface"
+	firewalldRemoveInterfaceMethod = "removeInterface"
+	firewalldQueryInterfaceMethod  = "queryInterface"
+
 	errZoneAlreadySet = "ZONE_ALREADY_SET"
 )
 
@@ -95,6 +99,21 @@ func (fb *fwdBackend) Add(conf *FirewallNetConf, result *current.Result) error {
 			}
 		}
 	}
+	if conf.MatchInterface {
+		for _, port := range hostPorts(result) {
+			if !port.found {
+				return fmt.Errorf("host interface %v not found", port.name)
+			}
+			ifName := port.name
+			firewalldObj := fb.conn.Object(firewalldName, firewalldPath)
+			var res string
+			if err := firewalldObj.Call(firewalldZoneInterface+"."+firewalldAddInterfaceMethod, 0, conf.FirewalldZone, ifName).Store(&res); err != nil {
+				if !strings.Contains(err.Error(), errZoneAlreadySet) {
+					return fmt.Errorf("failed to add the interface %v to %v zone: %v", ifName, conf.FirewalldZone, err)
+				}
+			}
+		}
+	}
 	return nil
 }
 
@@ -106,6 +125,13 @@ func (fb *fwdBackend) Del(conf *FirewallNetConf, result *current.Result) error {
 		var res string
 		firewalldObj.Call(firewalldZoneInterface+"."+firewalldRemoveSourceMethod, 0, conf.FirewalldZone, ipStr).Store(&res)
 	}
+	if conf.MatchInterface {
+		for _, port := range hostPorts(result) {
+			firewalldObj := fb.conn.Object(firewalldName, firewalldPath)
+			var res string
+			firewalldObj.Call(firewalldZoneInterface+"."+firewalldRemoveInterfaceMethod, 0, conf.FirewalldZone, port.name).Store(&res)
+		}
+	}
 	return nil
 }
 
@@ -119,5 +145,15 @@ func (fb *fwdBackend) Check(conf *FirewallNetConf, result *current.Result) error
 			return fmt.Errorf("failed to find the address %v in %v zone", ipStr, conf.FirewalldZone)
 		}
 	}
+	if conf.MatchInterface {
+		for _, port := range hostPorts(result) {
+			ifName := port.name
+			firewalldObj := fb.conn.Object(firewalldName, firewalldPath)
+			var res bool
+			if err := firewalldObj.Call(firewalldZoneInterface+"."+firewalldQueryInterfaceMethod, 0, conf.FirewalldZone, ifName).Store(&res); err != nil {
+				return fmt.Errorf("failed to find the interface %v in %v zone", ifName, conf.FirewalldZone)
+			}
+		}
+	}
 	return nil
 }
@@ -52,12 +52,16 @@ func setupIngressPolicyBridgeIsolation(conf *FirewallNetConf, prevResult *types1
 	if bridgeName == "" {
 		return fmt.Errorf("got empty bridge name")
 	}
+	variant, err := detectIptablesVariant(conf.IptablesMode)
+	if err != nil {
+		return err
+	}
 	for _, iptProto := range findProtos(conf) {
-		ipt, err := iptables.NewWithProtocol(iptProto)
+		ipt, err := variant.newIPTables(iptProto)
 		if err != nil {
 			return err
 		}
-		if err := setupIsolationChains(ipt, bridgeName, isolated); err != nil {
+		if err := setupIsolationChains(ipt, bridgeName, isolated, bypassRules(conf.Bypass, iptProto, "RETURN")); err != nil {
 			return err
 		}
 	}
@@ -96,8 +100,9 @@ const (
 // iptables -A CNI-ISOLATION-STAGE-1 -j RETURN
 // iptables -A CNI-ISOLATION-STAGE-2 -o ${bridgeName} -j DROP
 // iptables -A CNI-ISOLATION-STAGE-2 -j RETURN
+// [bypass] iptables -I CNI-ISOLATION-STAGE-1 ${bypassMatch} -j RETURN
 // ```
-func setupIsolationChains(ipt *iptables.IPTables, bridgeName string, isolated bool) error {
+func setupIsolationChains(ipt *iptables.IPTables, bridgeName string, isolated bool, bypass [][]string) error {
 	const (
 		// Future version may support custom chain names
 		stage1Chain = "CNI-ISOLATION-STAGE-1"
@@ -169,7 +174,16 @@ func setupIsolationChains(ipt *iptables.IPTables, bridgeName string, isolated bo
 		return err
 	}
 	stage2Return := withDefaultComment([]string{"-j", "RETURN"})
-	return utils.InsertUnique(ipt, filterTableName, stage2Chain, false, stage2Return)
+	if err := utils.InsertUnique(ipt, filterTableName, stage2Chain, false, stage2Return); err != nil {
+		return err
+	}
+
+	// Commands:
+	// ```
+	// iptables -I CNI-ISOLATION-STAGE-1 ${bypassMatch} -j RETURN
+	// ```
+	// The bypassed traffic skips the isolation, and is accepted by CNI-FORWARD
+	return ensureBypassRules(ipt, stage1Chain, bypass)
 }
 
 func isolationStage1BridgeRule(bridgeName, stage2Chain string) []string {
@@ -27,6 +27,9 @@ import (
 	"github.com/containernetworking/plugins/pkg/utils"
 )
 
+// privChainName is the private chain of the plugin in the filter table
+const privChainName = "CNI-FORWARD"
+
 func getPrivChainRules(ip string) [][]string {
 	var rules [][]string
 	rules = append(rules, []string{"-d", ip, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"})
@@ -34,6 +37,42 @@ func getPrivChainRules(ip string) [][]string {
 	return rules
 }
 
+// getIfaceChainRules returns the rules accepting the traffic of a
+// container through its host-side interface. Ports of a bridge are matched
+// with physdev since iptables only sees the bridge device itself.
+func getIfaceChainRules(ifName string, bridgePort bool) [][]string {
+	if bridgePort {
+		return [][]string{
+			{"-m", "physdev", "--physdev-out", ifName, "--physdev-is-bridged", "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+			{"-m", "physdev", "--physdev-in", ifName, "-j", "ACCEPT"},
+		}
+	}
+	return [][]string{
+		{"-o", ifName, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		{"-i", ifName, "-j", "ACCEPT"},
+	}
+}
+
+// ifaceRules returns the interface rules for the host-side veths of the
+// result. When the interface is already gone the rules for both kinds of
+// ports are returned so that they can be cleaned up.
+func ifaceRules(conf *FirewallNetConf, result *current.Result) [][]string {
+	if !conf.MatchInterface {
+		return nil
+	}
+
+	var rules [][]string
+	for _, port := range hostPorts(result) {
+		if !port.found {
+			rules = append(rules, getIfaceChainRules(port.name, true)...)
+			rules = append(rules, getIfaceChainRules(port.name, false)...)
+			continue
+		}
+		rules = append(rules, getIfaceChainRules(port.name, port.bridgePort)...)
+	}
+	return rules
+}
+
 func generateFilterRule(privChainName string) []string {
 	return []string{"-m", "comment", "--comment", "CNI firewall plugin rules", "-j", privChainName}
 }
@@ -42,12 +81,6 @@ func generateAdminRule(adminChainName string) []string {
 	return []string{"-m", "comment", "--comment", "CNI firewall plugin admin overrides", "-j", adminChainName}
 }
 
-func cleanupRules(ipt *iptables.IPTables, privChainName string, rules [][]string) {
-	for _, rule := range rules {
-		ipt.Delete("filter", privChainName, rule...)
-	}
-}
-
 func ensureFirstChainRule(ipt *iptables.IPTables, chain string, rule []string) error {
 	exists, err := ipt.Exists("filter", chain, rule...)
 	if !exists && err == nil {
@@ -56,7 +89,7 @@ func ensureFirstChainRule(ipt *iptables.IPTables, chain string, rule []string) e
 	return err
 }
 
-func (ib *iptablesBackend) setupChains(ipt *iptables.IPTables) error {
+func (ib *iptablesBackend) setupChains(ipt *iptables.IPTables, bypass [][]string) error {
 	privRule := generateFilterRule(ib.privChainName)
 	adminRule := generateAdminRule(ib.adminChainName)
 
@@ -74,7 +107,12 @@ func (ib *iptablesBackend) setupChains(ipt *iptables.IPTables) error {
 	}
 
 	// Ensure our admin override chain rule exists in our private chain
-	return ensureFirstChainRule(ipt, ib.privChainName, adminRule)
+	if err := ensureFirstChainRule(ipt, ib.privChainName, adminRule); err != nil {
+		return err
+	}
+
+	// Accept the bypassed traffic before the admin overrides
+	return ensureBypassRules(ipt, ib.privChainName, bypass)
 }
 
 func protoForIP(ip net.IPNet) iptables.Protocol {
@@ -84,57 +122,74 @@ func protoForIP(ip net.IPNet) iptables.Protocol {
 	return iptables.ProtocolIPv6
 }
 
-func (ib *iptablesBackend) addRules(_ *FirewallNetConf, result *current.Result, ipt *iptables.IPTables, proto iptables.Protocol) error {
+// attachmentRules returns the rules of the private chain for the given IP
+// family of the attachment
+func attachmentRules(conf *FirewallNetConf, result *current.Result, proto iptables.Protocol) [][]string {
 	rules := make([][]string, 0)
 	for _, ip := range result.IPs {
 		if protoForIP(ip.Address) == proto {
 			rules = append(rules, getPrivChainRules(ipString(ip.Address))...)
 		}
 	}
+	return append(rules, ifaceRules(conf, result)...)
+}
 
-	if len(rules) > 0 {
-		if err := ib.setupChains(ipt); err != nil {
-			return err
-		}
+// addRules appends the rules of the attachment missing from the private
+// chain with a single iptables-restore, which adds them all or none
+func (ib *iptablesBackend) addRules(conf *FirewallNetConf, result *current.Result, ipt *iptables.IPTables, proto iptables.Protocol) error {
+	rules := attachmentRules(conf, result, proto)
+	if len(rules) == 0 {
+		return nil
+	}
 
-		// Clean up on any errors
-		var err error
-		defer func() {
-			if err != nil {
-				cleanupRules(ipt, ib.privChainName, rules)
-			}
-		}()
+	if err := ib.setupChains(ipt, bypassRules(conf.Bypass, proto, "ACCEPT")); err != nil {
+		return err
+	}
 
-		for _, rule := range rules {
-			err = ipt.AppendUnique("filter", ib.privChainName, rule...)
-			if err != nil {
-				return err
-			}
+	batch := &ruleBatch{}
+	for _, rule := range uniqueRules(rules) {
+		exists, err := ipt.Exists(filterTableName, ib.privChainName, rule...)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			batch.append(ib.privChainName, rule)
 		}
 	}
-
-	return nil
+	return applyBatch(ipt, ib.variant, batch)
 }
 
-func (ib *iptablesBackend) delRules(_ *FirewallNetConf, result *current.Result, ipt *iptables.IPTables, proto iptables.Protocol) {
-	rules := make([][]string, 0)
-	for _, ip := range result.IPs {
-		if protoForIP(ip.Address) == proto {
-			rules = append(rules, getPrivChainRules(ipString(ip.Address))...)
-		}
-	}
-	if len(rules) > 0 {
-		cleanupRules(ipt, ib.privChainName, rules)
+// delRules deletes the rules of the attachment present in the private chain
+// with a single iptables-restore
+func (ib *iptablesBackend) delRules(conf *FirewallNetConf, result *current.Result, ipt *iptables.IPTables, proto iptables.Protocol) error {
+	rules := attachmentRules(conf, result, proto)
+	if len(rules) == 0 {
+		return nil
 	}
-}
 
-func (ib *iptablesBackend) checkRules(_ *FirewallNetConf, result *current.Result, ipt *iptables.IPTables, proto iptables.Protocol) error {
-	rules := make([][]string, 0)
-	for _, ip := range result.IPs {
-		if protoForIP(ip.Address) == proto {
-			rules = append(rules, getPrivChainRules(ipString(ip.Address))...)
+	chainExists, err := ipt.ChainExists(filterTableName, ib.privChainName)
+	if err != nil {
+		return err
+	}
+	if !chainExists {
+		// There is nothing to delete
+		return nil
+	}
+	batch := &ruleBatch{}
+	for _, rule := range uniqueRules(rules) {
+		exists, err := ipt.Exists(filterTableName, ib.privChainName, rule...)
+		if err != nil {
+			return err
+		}
+		if exists {
+			batch.delete(ib.privChainName, rule)
 		}
 	}
+	return applyBatch(ipt, ib.variant, batch)
+}
+
+func (ib *iptablesBackend) checkRules(conf *FirewallNetConf, result *current.Result, ipt *iptables.IPTables, proto iptables.Protocol) error {
+	rules := attachmentRules(conf, result, proto)
 
 	if len(rules) == 0 {
 		return nil
@@ -168,6 +223,10 @@ func (ib *iptablesBackend) checkRules(_ *FirewallNetConf, result *current.Result
 		return fmt.Errorf("expected %v rule %v not found", ib.privChainName, adminRule)
 	}
 
+	if err := checkBypassRules(ipt, ib.privChainName, bypassRules(conf.Bypass, proto, "ACCEPT")); err != nil {
+		return err
+	}
+
 	// ensure rules for this IP address exist
 	for _, rule := range rules {
 		// Ensure our rule exists in our private chain
@@ -202,6 +261,7 @@ func findProtos(conf *FirewallNetConf) []iptables.Protocol {
 }
 
 type iptablesBackend struct {
+	variant        *iptablesVariant
 	protos         map[iptables.Protocol]*iptables.IPTables
 	privChainName  string
 	adminChainName string
@@ -216,16 +276,22 @@ func newIptablesBackend(conf *FirewallNetConf) (FirewallBackend, error) {
 		adminChainName = "CNI-ADMIN"
 	}
 
+	variant, err := detectIptablesVariant(conf.IptablesMode)
+	if err != nil {
+		return nil, err
+	}
+
 	backend := &iptablesBackend{
-		privChainName:  "CNI-FORWARD",
+		variant:        variant,
+		privChainName:  privChainName,
 		adminChainName: adminChainName,
 		protos:         make(map[iptables.Protocol]*iptables.IPTables),
 	}
 
 	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
-		ipt, err := iptables.NewWithProtocol(proto)
+		ipt, err := variant.newIPTables(proto)
 		if err != nil {
-			return nil, fmt.Errorf("could not initialize iptables protocol %v: %v", proto, err)
+			return nil, fmt.Errorf("could not initialize %s protocol %v: %v", variant, proto, err)
 		}
 		backend.protos[proto] = ipt
 	}
@@ -244,7 +310,9 @@ func (ib *iptablesBackend) Add(conf *FirewallNetConf, result *current.Result) er
 
 func (ib *iptablesBackend) Del(conf *FirewallNetConf, result *current.Result) error {
 	for proto, ipt := range ib.protos {
-		ib.delRules(conf, result, ipt, proto)
+		if err := ib.delRules(conf, result, ipt, proto); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,317 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"sigs.k8s.io/knftables"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+)
+
+const (
+	nftTableName = "cni_firewall"
+
+	// Base chain of the forwarded traffic, jumping to the admin chain and
+	// then to the chain of the attachments, after the bypassed traffic
+	nftForwardChain = "forward"
+	// Chain for the admin overrides, which the plugin never changes
+	nftAdminChain = "admin"
+	// Chain containing the rules of the attachments
+	nftAttachmentsChain = "attachments"
+
+	nftAdminComment = "CNI firewall plugin admin overrides"
+	nftRulesComment = "CNI firewall plugin rules"
+)
+
+// The nftables backend mirrors the chains of the iptables backend in a
+// table of its own. Each rule of an attachment carries as comment the
+// address or interface it accepts the traffic of, so that the rules are
+// looked up by comment rather than by their text, which nft prints in its
+// own way.
+//
+// As with iptables-nft and iptables-legacy, the tables of nftables are
+// evaluated apart: an accept in this table doesn't override a drop in
+// another one.
+type nftablesBackend struct {
+	nft knftables.Interface
+}
+
+// nftablesBackend implements the FirewallBackend interface
+var _ FirewallBackend = &nftablesBackend{}
+
+func newNftablesBackend(conf *FirewallNetConf) (FirewallBackend, error) {
+	if conf.IptablesAdminChainName != "" {
+		return nil, fmt.Errorf("iptablesAdminChainName is only supported by the iptables backend")
+	}
+	nft, err := knftables.New(knftables.InetFamily, nftTableName)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize nftables: %v", err)
+	}
+	return &nftablesBackend{nft: nft}, nil
+}
+
+// nftRule is a rule with the comment it is looked up by
+type nftRule struct {
+	key  string
+	rule string
+}
+
+// nftAttachmentRules returns the rules of the attachment, mirroring
+// attachmentRules
+func nftAttachmentRules(conf *FirewallNetConf, result *current.Result) ([]nftRule, error) {
+	var rules []nftRule
+	for _, ip := range result.IPs {
+		ipX := "ip"
+		if ip.Address.IP.To4() == nil {
+			ipX = "ip6"
+		}
+		addr := ipString(ip.Address)
+		rules = append(rules,
+			nftRule{key: addr, rule: knftables.Concat(ipX, "daddr", addr, "ct state related,established accept")},
+			nftRule{key: addr, rule: knftables.Concat(ipX, "saddr", addr, "accept")},
+		)
+	}
+
+	if !conf.MatchInterface {
+		return rules, nil
+	}
+	for _, port := range hostPorts(result) {
+		if port.bridgePort {
+			return nil, fmt.Errorf("matchInterface is not supported on bridge ports by the nftables backend")
+		}
+		key := "iface " + port.name
+		rules = append(rules,
+			nftRule{key: key, rule: knftables.Concat("oifname", port.name, "ct state related,established accept")},
+			nftRule{key: key, rule: knftables.Concat("iifname", port.name, "accept")},
+		)
+	}
+	return rules, nil
+}
+
+// nftAttachmentKeys returns the keys of the rules of the attachment with
+// the number of rules of each
+func nftAttachmentKeys(rules []nftRule) map[string]int {
+	keys := make(map[string]int)
+	for _, r := range rules {
+		keys[r.key]++
+	}
+	return keys
+}
+
+// nftBypassRules returns the rules accepting the bypassed traffic, keyed by
+// the traffic they match
+func nftBypassRules(b *Bypass) []nftRule {
+	if b == nil {
+		return nil
+	}
+
+	var rules []nftRule
+	for _, src := range b.Sources {
+		_, ipn, _ := net.ParseCIDR(src)
+		ipX := "ip"
+		if ipn.IP.To4() == nil {
+			ipX = "ip6"
+		}
+		for _, dir := range []string{"saddr", "daddr"} {
+			rules = append(rules, nftRule{
+				key:  bypassComment + ": " + dir + " " + ipn.String(),
+				rule: knftables.Concat(ipX, dir, ipn.String(), "accept"),
+			})
+		}
+	}
+	for _, mark := range b.Marks {
+		match := knftables.Concat("meta mark", mark)
+		if value, mask, hasMask := strings.Cut(mark, "/"); hasMask {
+			match = knftables.Concat("meta mark and", mask, "==", value)
+		}
+		rules = append(rules, nftRule{
+			key:  bypassComment + ": mark " + mark,
+			rule: knftables.Concat(match, "accept"),
+		})
+	}
+	return rules
+}
+
+// comments returns the rules of the chain by comment. A missing chain has
+// no rules.
+func (nb *nftablesBackend) comments(chain string) (map[string][]*knftables.Rule, error) {
+	rules, err := nb.nft.ListRules(context.TODO(), chain)
+	if err != nil {
+		if knftables.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not list the rules of chain %s: %v", chain, err)
+	}
+	byComment := make(map[string][]*knftables.Rule)
+	for _, r := range rules {
+		if r.Comment != nil {
+			byComment[*r.Comment] = append(byComment[*r.Comment], r)
+		}
+	}
+	return byComment, nil
+}
+
+func (nb *nftablesBackend) Add(conf *FirewallNetConf, result *current.Result) error {
+	rules, err := nftAttachmentRules(conf, result)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	forward, err := nb.comments(nftForwardChain)
+	if err != nil {
+		return err
+	}
+	attachments, err := nb.comments(nftAttachmentsChain)
+	if err != nil {
+		return err
+	}
+
+	tx := nb.nft.NewTransaction()
+	tx.Add(&knftables.Table{
+		Comment: knftables.PtrTo("CNI firewall plugin"),
+	})
+	tx.Add(&knftables.Chain{
+		Name:     nftForwardChain,
+		Type:     knftables.PtrTo(knftables.FilterType),
+		Hook:     knftables.PtrTo(knftables.ForwardHook),
+		Priority: knftables.PtrTo(knftables.FilterPriority),
+	})
+	tx.Add(&knftables.Chain{
+		Name: nftAdminChain,
+	})
+	tx.Add(&knftables.Chain{
+		Name: nftAttachmentsChain,
+	})
+
+	// Jump to the admin overrides, then to the attachments
+	for _, jump := range []nftRule{
+		{key: nftAdminComment, rule: knftables.Concat("jump", nftAdminChain)},
+		{key: nftRulesComment, rule: knftables.Concat("jump", nftAttachmentsChain)},
+	} {
+		if len(forward[jump.key]) == 0 {
+			tx.Add(&knftables.Rule{
+				Chain:   nftForwardChain,
+				Rule:    jump.rule,
+				Comment: knftables.PtrTo(jump.key),
+			})
+		}
+	}
+
+	// Accept the bypassed traffic before the admin overrides
+	for _, bypass := range nftBypassRules(conf.Bypass) {
+		if len(forward[bypass.key]) == 0 {
+			tx.Insert(&knftables.Rule{
+				Chain:   nftForwardChain,
+				Rule:    bypass.rule,
+				Comment: knftables.PtrTo(bypass.key),
+			})
+		}
+	}
+
+	// Replace the rules of the keys of the attachment, so that adding the
+	// attachment again doesn't duplicate them
+	for key := range nftAttachmentKeys(rules) {
+		for _, r := range attachments[key] {
+			tx.Delete(r)
+		}
+	}
+	for _, r := range rules {
+		tx.Add(&knftables.Rule{
+			Chain:   nftAttachmentsChain,
+			Rule:    r.rule,
+			Comment: knftables.PtrTo(r.key),
+		})
+	}
+
+	if err := nb.nft.Run(context.TODO(), tx); err != nil {
+		return fmt.Errorf("unable to set up nftables rules for the firewall: %v", err)
+	}
+	return nil
+}
+
+func (nb *nftablesBackend) Del(conf *FirewallNetConf, result *current.Result) error {
+	attachments, err := nb.comments(nftAttachmentsChain)
+	if err != nil {
+		return err
+	}
+
+	tx := nb.nft.NewTransaction()
+	for _, ip := range result.IPs {
+		for _, r := range attachments[ipString(ip.Address)] {
+			tx.Delete(r)
+		}
+	}
+	// The interface may be gone, so its rules are looked up by name only
+	for _, iface := range result.Interfaces {
+		if iface.Sandbox != "" || iface.Name == "" {
+			continue
+		}
+		for _, r := range attachments["iface "+iface.Name] {
+			tx.Delete(r)
+		}
+	}
+	if tx.NumOperations() == 0 {
+		return nil
+	}
+
+	if err := nb.nft.Run(context.TODO(), tx); err != nil {
+		return fmt.Errorf("error deleting nftables rules: %v", err)
+	}
+	return nil
+}
+
+func (nb *nftablesBackend) Check(conf *FirewallNetConf, result *current.Result) error {
+	rules, err := nftAttachmentRules(conf, result)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	forward, err := nb.comments(nftForwardChain)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{nftAdminComment, nftRulesComment} {
+		if len(forward[key]) == 0 {
+			return fmt.Errorf("expected %s rule %q not found", nftForwardChain, key)
+		}
+	}
+	for _, bypass := range nftBypassRules(conf.Bypass) {
+		if len(forward[bypass.key]) == 0 {
+			return fmt.Errorf("expected %s bypass rule %q not found", nftForwardChain, bypass.rule)
+		}
+	}
+
+	attachments, err := nb.comments(nftAttachmentsChain)
+	if err != nil {
+		return err
+	}
+	for key, n := range nftAttachmentKeys(rules) {
+		if len(attachments[key]) < n {
+			return fmt.Errorf("missing rules for %s in %q chain", key, nftAttachmentsChain)
+		}
+	}
+	return nil
+}
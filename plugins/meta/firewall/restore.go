@@ -0,0 +1,116 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+)
+
+// ruleBatch is a set of changes to the filter table applied with a single
+// iptables-restore, which commits them in one transaction instead of an
+// iptables exec, and a full ruleset reload, per rule
+type ruleBatch struct {
+	lines []string
+}
+
+func (b *ruleBatch) empty() bool {
+	return len(b.lines) == 0
+}
+
+func (b *ruleBatch) append(chain string, rule []string) {
+	b.lines = append(b.lines, ruleSpec("-A", chain, rule))
+}
+
+func (b *ruleBatch) delete(chain string, rule []string) {
+	b.lines = append(b.lines, ruleSpec("-D", chain, rule))
+}
+
+// payload returns the batch in the iptables-restore format
+func (b *ruleBatch) payload() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%s\n", filterTableName)
+	for _, line := range b.lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("COMMIT\n")
+	return buf.Bytes()
+}
+
+// ruleSpec formats the rule as a line of iptables-restore
+func ruleSpec(op, chain string, rule []string) string {
+	args := make([]string, 0, len(rule)+2)
+	args = append(args, op, chain)
+	for _, arg := range rule {
+		args = append(args, quoteArg(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// uniqueRules drops the repeated rules, which a batch would otherwise add
+// or delete twice
+func uniqueRules(rules [][]string) [][]string {
+	seen := make(map[string]bool, len(rules))
+	unique := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		spec := strings.Join(rule, "\x00")
+		if !seen[spec] {
+			seen[spec] = true
+			unique = append(unique, rule)
+		}
+	}
+	return unique
+}
+
+// applyBatch applies the batch with the iptables-restore of the variant,
+// leaving the rest of the table as is. The batch is applied as a whole or
+// not at all.
+func applyBatch(ipt *iptables.IPTables, variant *iptablesVariant, b *ruleBatch) error {
+	if b.empty() {
+		return nil
+	}
+	restore := variant.command(ipt.Proto(), "-restore")
+	path, err := exec.LookPath(restore)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"--noflush"}
+	// iptables-restore waits for the xtables lock since v1.6.2
+	if v1, v2, v3 := ipt.GetIptablesVersion(); v1 > 1 || (v1 == 1 && (v2 > 6 || (v2 == 6 && v3 >= 2))) {
+		args = append(args, "--wait")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(b.payload())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", restore, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
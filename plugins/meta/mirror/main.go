@@ -0,0 +1,270 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin that mirrors the traffic of the container host
+// interface to a remote collector over an ERSPAN or VXLAN tunnel. Mirroring
+// is opt-in per attachment through runtimeConfig.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/utils"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	encapERSPAN = "erspan"
+	encapVXLAN  = "vxlan"
+
+	// directionEgress mirrors the traffic sent by the container,
+	// directionIngress the traffic it receives
+	directionBoth    = "both"
+	directionEgress  = "egress"
+	directionIngress = "ingress"
+
+	defaultVXLANPort = 4789
+
+	maxTunnelNameLength = 15
+	tunnelNamePrefix    = "mir"
+)
+
+// MirrorConf is the chained plugin configuration
+type MirrorConf struct {
+	types.NetConf
+
+	// Collector is the address of the remote collector
+	Collector string `json:"collector"`
+	// Encap is either "erspan" (default) or "vxlan"
+	Encap string `json:"encap,omitempty"`
+	// Local is the source address of the tunnel, selected by routing when
+	// unset
+	Local string `json:"local,omitempty"`
+	// SessionID is the ERSPAN session ID or the VXLAN VNI
+	SessionID uint32 `json:"sessionID,omitempty"`
+	// Port is the VXLAN destination port
+	Port int `json:"port,omitempty"`
+	// Direction is "both" (default), "egress" or "ingress", from the
+	// point of view of the container
+	Direction string `json:"direction,omitempty"`
+
+	RuntimeConfig struct {
+		Mirror *MirrorRuntimeConfig `json:"mirror,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+
+	collector net.IP
+	local     net.IP
+}
+
+// MirrorRuntimeConfig enables mirroring for an attachment
+type MirrorRuntimeConfig struct {
+	Enabled bool `json:"enabled"`
+	// Direction overrides the direction of the network configuration
+	Direction string `json:"direction,omitempty"`
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		/* FIXME GC */
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("mirror"))
+}
+
+func parseConf(data []byte) (*MirrorConf, *current.Result, error) {
+	conf := MirrorConf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	conf.collector = net.ParseIP(conf.Collector)
+	if conf.collector == nil {
+		return nil, nil, fmt.Errorf("invalid collector address %q", conf.Collector)
+	}
+	if conf.Local != "" {
+		conf.local = net.ParseIP(conf.Local)
+		if conf.local == nil {
+			return nil, nil, fmt.Errorf("invalid local address %q", conf.Local)
+		}
+		if (conf.local.To4() == nil) != (conf.collector.To4() == nil) {
+			return nil, nil, fmt.Errorf("local address %s and collector %s are of different families", conf.Local, conf.Collector)
+		}
+	}
+
+	switch conf.Encap {
+	case "":
+		conf.Encap = encapERSPAN
+		fallthrough
+	case encapERSPAN:
+		if conf.SessionID > maxERSPANSessionID {
+			return nil, nil, fmt.Errorf("invalid ERSPAN session ID %d, must be [0, %d]", conf.SessionID, maxERSPANSessionID)
+		}
+	case encapVXLAN:
+		if conf.SessionID > maxVNI {
+			return nil, nil, fmt.Errorf("invalid VNI %d, must be [0, %d]", conf.SessionID, maxVNI)
+		}
+		if conf.Port == 0 {
+			conf.Port = defaultVXLANPort
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown encap %q", conf.Encap)
+	}
+
+	if rc := conf.RuntimeConfig.Mirror; rc != nil && rc.Direction != "" {
+		conf.Direction = rc.Direction
+	}
+	switch conf.Direction {
+	case "":
+		conf.Direction = directionBoth
+	case directionBoth, directionEgress, directionIngress:
+	default:
+		return nil, nil, fmt.Errorf("unknown direction %q", conf.Direction)
+	}
+
+	return &conf, result, nil
+}
+
+func (c *MirrorConf) enabled() bool {
+	return c.RuntimeConfig.Mirror != nil && c.RuntimeConfig.Mirror.Enabled
+}
+
+func tunnelName(networkName, containerID, ifName string) string {
+	return utils.MustFormatHashWithPrefix(maxTunnelNameLength, tunnelNamePrefix, networkName+containerID+ifName)
+}
+
+// hostVeth returns the host side veth of the container in the previous
+// result
+func hostVeth(result *current.Result) (netlink.Link, error) {
+	for _, intf := range result.Interfaces {
+		if intf.Sandbox != "" {
+			continue
+		}
+		link, err := netlinksafe.LinkByName(intf.Name)
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				continue
+			}
+			return nil, fmt.Errorf("failed to lookup %q: %v", intf.Name, err)
+		}
+		if _, ok := link.(*netlink.Veth); ok {
+			return link, nil
+		}
+	}
+	return nil, fmt.Errorf("no host-side veth found in prevResult")
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	if !conf.enabled() {
+		return types.PrintResult(conf.PrevResult, conf.CNIVersion)
+	}
+
+	veth, err := hostVeth(result)
+	if err != nil {
+		return err
+	}
+
+	name := tunnelName(conf.Name, args.ContainerID, args.IfName)
+	tunnel, err := createTunnel(conf, name)
+	if err != nil {
+		return err
+	}
+	if err := mirrorTo(veth, tunnel, conf.Direction); err != nil {
+		_ = netlink.LinkDel(tunnel)
+		return err
+	}
+
+	return types.PrintResult(conf.PrevResult, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	// The mirroring filters go with the host veth, or with the clsact
+	// qdisc when the veth outlives the attachment
+	if result != nil {
+		if veth, err := hostVeth(result); err == nil {
+			if err := unmirror(veth); err != nil {
+				return err
+			}
+		}
+	}
+
+	link, err := netlinksafe.LinkByName(tunnelName(conf.Name, args.ContainerID, args.IfName))
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	return netlink.LinkDel(link)
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	if !conf.enabled() {
+		return nil
+	}
+
+	veth, err := hostVeth(result)
+	if err != nil {
+		return err
+	}
+	name := tunnelName(conf.Name, args.ContainerID, args.IfName)
+	tunnel, err := netlinksafe.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to lookup mirror tunnel %q: %v", name, err)
+	}
+	return checkMirror(veth, tunnel, conf.Direction)
+}
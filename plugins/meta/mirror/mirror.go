@@ -0,0 +1,216 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const (
+	maxERSPANSessionID = 1023
+	maxVNI             = 1<<24 - 1
+
+	// Not defined by the netlink library
+	iflaGreERSPANIndex = 21
+	iflaGreERSPANVer   = 22
+
+	// mirrorPriority is the priority of the mirroring filters, kept
+	// distinct to recognize them in CHECK
+	mirrorPriority = 49152
+)
+
+func createTunnel(conf *MirrorConf, name string) (netlink.Link, error) {
+	var err error
+	switch conf.Encap {
+	case encapERSPAN:
+		err = addERSPAN(name, conf.local, conf.collector, conf.SessionID)
+	case encapVXLAN:
+		linkAttrs := netlink.NewLinkAttrs()
+		linkAttrs.Name = name
+		err = netlink.LinkAdd(&netlink.Vxlan{
+			LinkAttrs: linkAttrs,
+			VxlanId:   int(conf.SessionID),
+			SrcAddr:   conf.local,
+			Group:     conf.collector,
+			Port:      conf.Port,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s tunnel %q: %v", conf.Encap, name, err)
+	}
+
+	link, err := netlinksafe.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup %q: %v", name, err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		_ = netlink.LinkDel(link)
+		return nil, fmt.Errorf("failed to set %q up: %v", name, err)
+	}
+	return link, nil
+}
+
+// addERSPAN creates an ERSPAN type II tunnel, which the netlink library
+// has no link type for
+func addERSPAN(name string, local, remote net.IP, sessionID uint32) error {
+	kind := "ip6erspan"
+	if remote.To4() != nil {
+		kind = "erspan"
+	}
+
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(name)))
+
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated(kind))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+
+	addr := func(ip net.IP) []byte {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+		return ip.To16()
+	}
+	if local != nil {
+		data.AddRtAttr(nl.IFLA_GRE_LOCAL, addr(local))
+	}
+	data.AddRtAttr(nl.IFLA_GRE_REMOTE, addr(remote))
+
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, sessionID)
+	flags := make([]byte, 2)
+	binary.BigEndian.PutUint16(flags, nl.GRE_KEY|nl.GRE_SEQ)
+	data.AddRtAttr(nl.IFLA_GRE_IKEY, key)
+	data.AddRtAttr(nl.IFLA_GRE_OKEY, key)
+	data.AddRtAttr(nl.IFLA_GRE_IFLAGS, flags)
+	data.AddRtAttr(nl.IFLA_GRE_OFLAGS, flags)
+	data.AddRtAttr(iflaGreERSPANVer, nl.Uint8Attr(1))
+	data.AddRtAttr(iflaGreERSPANIndex, nl.Uint32Attr(0))
+
+	req.AddData(linkInfo)
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func clsactHandle() uint32 {
+	return netlink.MakeHandle(0xffff, 0)
+}
+
+// mirrorParents returns the clsact hooks to mirror for a direction
+func mirrorParents(direction string) []uint32 {
+	switch direction {
+	case directionEgress:
+		// Sent by the container, so received by the host veth
+		return []uint32{netlink.HANDLE_MIN_INGRESS}
+	case directionIngress:
+		return []uint32{netlink.HANDLE_MIN_EGRESS}
+	default:
+		return []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS}
+	}
+}
+
+// mirrorTo mirrors the traffic of veth to the tunnel through filters on a
+// clsact qdisc, which leaves the root qdisc of the veth alone
+func mirrorTo(veth, tunnel netlink.Link, direction string) error {
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: veth.Attrs().Index,
+			Handle:    clsactHandle(),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscAdd(qdisc); err != nil {
+		if err == syscall.EEXIST {
+			return fmt.Errorf("%q already has an ingress or clsact qdisc, which mirror cannot share", veth.Attrs().Name)
+		}
+		return fmt.Errorf("failed to add clsact qdisc to %q: %v", veth.Attrs().Name, err)
+	}
+
+	for _, parent := range mirrorParents(direction) {
+		// A u32 filter without selector matches all packets
+		filter := &netlink.U32{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: veth.Attrs().Index,
+				Parent:    parent,
+				Priority:  mirrorPriority,
+				Protocol:  unix.ETH_P_ALL,
+			},
+			Actions: []netlink.Action{
+				&netlink.MirredAction{
+					ActionAttrs:  netlink.ActionAttrs{Action: netlink.TC_ACT_PIPE},
+					MirredAction: netlink.TCA_EGRESS_MIRROR,
+					Ifindex:      tunnel.Attrs().Index,
+				},
+			},
+		}
+		if err := netlink.FilterAdd(filter); err != nil {
+			_ = netlink.QdiscDel(qdisc)
+			return fmt.Errorf("failed to add mirror filter to %q: %v", veth.Attrs().Name, err)
+		}
+	}
+	return nil
+}
+
+// unmirror removes the clsact qdisc, and the mirroring filters with it
+func unmirror(veth netlink.Link) error {
+	qdiscs, err := netlinksafe.QdiscList(veth)
+	if err != nil {
+		return fmt.Errorf("failed to list qdiscs of %q: %v", veth.Attrs().Name, err)
+	}
+	for _, q := range qdiscs {
+		if q.Type() == "clsact" {
+			if err := netlink.QdiscDel(q); err != nil {
+				return fmt.Errorf("failed to delete clsact qdisc of %q: %v", veth.Attrs().Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkMirror(veth, tunnel netlink.Link, direction string) error {
+	for _, parent := range mirrorParents(direction) {
+		filters, err := netlinksafe.FilterList(veth, parent)
+		if err != nil {
+			return fmt.Errorf("failed to list filters of %q: %v", veth.Attrs().Name, err)
+		}
+		found := false
+		for _, f := range filters {
+			m, ok := f.(*netlink.U32)
+			if !ok || m.Priority != mirrorPriority {
+				continue
+			}
+			for _, a := range m.Actions {
+				if mirred, ok := a.(*netlink.MirredAction); ok && mirred.Ifindex == tunnel.Attrs().Index {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("no filter mirroring %q to %q", veth.Attrs().Name, tunnel.Attrs().Name)
+		}
+	}
+	return nil
+}
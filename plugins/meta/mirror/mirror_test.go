@@ -0,0 +1,222 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+func mirrorConf(extra string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "mirror-test",
+		"type": "mirror",
+		"collector": "192.0.2.10",
+		%s
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [
+				{"name": "hostveth0"},
+				{"name": "eth0", "sandbox": "/var/run/netns/test"}
+			],
+			"ips": [
+				{"interface": 1, "address": "10.1.2.3/24"}
+			]
+		}
+	}`, extra))
+}
+
+var _ = Describe("mirror configuration", func() {
+	It("defaults to ERSPAN in both directions", func() {
+		conf, result, err := parseConf(mirrorConf(""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(BeNil())
+		Expect(conf.Encap).To(Equal(encapERSPAN))
+		Expect(conf.Direction).To(Equal(directionBoth))
+		Expect(conf.enabled()).To(BeFalse())
+	})
+
+	It("lets runtimeConfig enable mirroring and override the direction", func() {
+		conf, _, err := parseConf(mirrorConf(`
+			"encap": "vxlan",
+			"direction": "both",
+			"runtimeConfig": {"mirror": {"enabled": true, "direction": "egress"}},`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conf.enabled()).To(BeTrue())
+		Expect(conf.Direction).To(Equal(directionEgress))
+		Expect(conf.Port).To(Equal(defaultVXLANPort))
+	})
+
+	It("rejects invalid configurations", func() {
+		for _, extra := range []string{
+			`"encap": "gre",`,
+			`"direction": "sideways",`,
+			`"sessionID": 1024,`,
+			`"encap": "vxlan", "sessionID": 16777216,`,
+			`"local": "2001:db8::1",`,
+		} {
+			_, _, err := parseConf(mirrorConf(extra))
+			Expect(err).To(HaveOccurred(), extra)
+		}
+	})
+})
+
+var _ = Describe("mirror operations", func() {
+	var testNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		testNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "hostveth0"
+			veth := &netlink.Veth{LinkAttrs: linkAttrs, PeerName: "peer0"}
+			Expect(netlink.LinkAdd(veth)).To(Succeed())
+			Expect(netlink.LinkSetUp(veth)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(testNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(testNS)).To(Succeed())
+	})
+
+	It("mirrors the host veth to a VXLAN tunnel with ADD/CHECK/DEL", func() {
+		conf := mirrorConf(`
+			"encap": "vxlan",
+			"sessionID": 42,
+			"runtimeConfig": {"mirror": {"enabled": true}},`)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "eth0",
+			StdinData:   conf,
+		}
+		name := tunnelName("mirror-test", args.ContainerID, args.IfName)
+
+		err := testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			link, err := netlinksafe.LinkByName(name)
+			Expect(err).NotTo(HaveOccurred())
+			vxlan, ok := link.(*netlink.Vxlan)
+			Expect(ok).To(BeTrue())
+			Expect(vxlan.VxlanId).To(Equal(42))
+
+			Expect(testutils.CmdCheckWithArgs(args, func() error {
+				return cmdCheck(args)
+			})).To(Succeed())
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+
+			_, err = netlinksafe.LinkByName(name)
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+
+			veth, err := netlinksafe.LinkByName("hostveth0")
+			Expect(err).NotTo(HaveOccurred())
+			qdiscs, err := netlinksafe.QdiscList(veth)
+			Expect(err).NotTo(HaveOccurred())
+			for _, q := range qdiscs {
+				Expect(q.Type()).NotTo(Equal("clsact"))
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("mirrors the traffic sent by the container to an ERSPAN tunnel", func() {
+		conf := mirrorConf(`
+			"sessionID": 7,
+			"direction": "egress",
+			"runtimeConfig": {"mirror": {"enabled": true}},`)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "eth0",
+			StdinData:   conf,
+		}
+		name := tunnelName("mirror-test", args.ContainerID, args.IfName)
+
+		err := testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			link, err := netlinksafe.LinkByName(name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link.Type()).To(Equal("erspan"))
+
+			veth, err := netlinksafe.LinkByName("hostveth0")
+			Expect(err).NotTo(HaveOccurred())
+			filters, err := netlinksafe.FilterList(veth, netlink.HANDLE_MIN_EGRESS)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filters).To(BeEmpty())
+
+			Expect(testutils.CmdCheckWithArgs(args, func() error {
+				return cmdCheck(args)
+			})).To(Succeed())
+
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("passes the result through when mirroring is not enabled", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			IfName:      "eth0",
+			StdinData:   mirrorConf(""),
+		}
+
+		err := testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = netlinksafe.LinkByName(tunnelName("mirror-test", args.ContainerID, args.IfName))
+			Expect(err).To(BeAssignableToTypeOf(netlink.LinkNotFoundError{}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
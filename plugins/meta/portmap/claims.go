@@ -0,0 +1,145 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+const defaultDataDir = "/run/cni/portmap"
+
+// portClaim is the set of host ports mapped for one attachment, recorded
+// in the claims group of the attachment store
+type portClaim struct {
+	Network     string         `json:"network"`
+	ContainerID string         `json:"containerID"`
+	IfName      string         `json:"ifName"`
+	PortMaps    []PortMapEntry `json:"portMappings"`
+}
+
+const claimsGroup = "claims"
+
+// portsConflict reports whether two mappings capture the same traffic. An
+// empty host IP stands for all addresses.
+func portsConflict(a, b PortMapEntry) bool {
+	if a.HostPort != b.HostPort || !strings.EqualFold(protocolOf(a), protocolOf(b)) {
+		return false
+	}
+	if a.HostIP == "" || b.HostIP == "" {
+		return true
+	}
+	return net.ParseIP(a.HostIP).Equal(net.ParseIP(b.HostIP))
+}
+
+func protocolOf(pm PortMapEntry) string {
+	if pm.Protocol == "" {
+		return "tcp"
+	}
+	return pm.Protocol
+}
+
+// claimPorts records the host ports of the attachment, failing when one of
+// them is already mapped by another attachment
+func claimPorts(dataDir, network, containerID, ifName string, portMaps []PortMapEntry) error {
+	s, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	own := attachments.ID(containerID, ifName)
+	ids, err := s.Refs(claimsGroup)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == own {
+			continue
+		}
+		other := portClaim{}
+		if _, err := s.GetJSON(claimsGroup, id, &other); err != nil {
+			return fmt.Errorf("failed to read port claim: %v", err)
+		}
+		for _, pm := range portMaps {
+			for _, opm := range other.PortMaps {
+				if portsConflict(pm, opm) {
+					return fmt.Errorf("host port %d/%s is in use by container %s", pm.HostPort, protocolOf(pm), other.ContainerID)
+				}
+			}
+		}
+	}
+
+	return s.PutJSON(claimsGroup, own, &portClaim{
+		Network:     network,
+		ContainerID: containerID,
+		IfName:      ifName,
+		PortMaps:    portMaps,
+	})
+}
+
+// releasePorts drops the host ports claimed by the attachment
+func releasePorts(dataDir, containerID, ifName string) error {
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		return nil
+	}
+	s, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	_, err = s.Remove(claimsGroup, attachments.ID(containerID, ifName))
+	return err
+}
+
+// pruneClaims drops the claims of the attachments of the network which are
+// not valid anymore
+func pruneClaims(dataDir, network string, valid map[types.GCAttachment]bool) error {
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		return nil
+	}
+	s, err := attachments.Open(dataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ids, err := s.Refs(claimsGroup)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, id := range ids {
+		c := portClaim{}
+		if _, err := s.GetJSON(claimsGroup, id, &c); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if c.Network != network || valid[types.GCAttachment{ContainerID: c.ContainerID, IfName: c.IfName}] {
+			continue
+		}
+		if _, err := s.Remove(claimsGroup, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
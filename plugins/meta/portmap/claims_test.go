@@ -0,0 +1,94 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/cni/pkg/skel"
+)
+
+var _ = Describe("host port claims", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "portmap_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	It("detects conflicting mappings", func() {
+		tcp8080 := PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}
+
+		Expect(portsConflict(tcp8080, PortMapEntry{HostPort: 8080})).To(BeTrue())
+		Expect(portsConflict(tcp8080, PortMapEntry{HostPort: 8080, Protocol: "udp"})).To(BeFalse())
+		Expect(portsConflict(tcp8080, PortMapEntry{HostPort: 8081, Protocol: "tcp"})).To(BeFalse())
+
+		onIP := PortMapEntry{HostPort: 8080, Protocol: "tcp", HostIP: "192.168.0.1"}
+		Expect(portsConflict(tcp8080, onIP)).To(BeTrue())
+		Expect(portsConflict(onIP, PortMapEntry{HostPort: 8080, Protocol: "tcp", HostIP: "192.168.0.2"})).To(BeFalse())
+		Expect(portsConflict(onIP, PortMapEntry{HostPort: 8080, Protocol: "TCP", HostIP: "192.168.0.1"})).To(BeTrue())
+	})
+
+	It("rejects ports claimed by another attachment until released", func() {
+		portMaps := []PortMapEntry{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}
+
+		Expect(claimPorts(dataDir, "mynet", "container-a", "eth0", portMaps)).To(Succeed())
+		// Claiming again for the same attachment is idempotent
+		Expect(claimPorts(dataDir, "mynet", "container-a", "eth0", portMaps)).To(Succeed())
+
+		err := claimPorts(dataDir, "mynet", "container-b", "eth0", portMaps)
+		Expect(err).To(MatchError("host port 8080/tcp is in use by container container-a"))
+
+		Expect(releasePorts(dataDir, "container-a", "eth0")).To(Succeed())
+		Expect(claimPorts(dataDir, "mynet", "container-b", "eth0", portMaps)).To(Succeed())
+
+		Expect(releasePorts(dataDir, "container-a", "eth0")).To(Succeed())
+	})
+
+	It("prunes the claims of the stale attachments of the network on GC", func() {
+		Expect(claimPorts(dataDir, "mynet", "container-a", "eth0", []PortMapEntry{{HostPort: 8080, ContainerPort: 80}})).To(Succeed())
+		Expect(claimPorts(dataDir, "mynet", "container-b", "eth0", []PortMapEntry{{HostPort: 8081, ContainerPort: 80}})).To(Succeed())
+		Expect(claimPorts(dataDir, "othernet", "container-c", "eth0", []PortMapEntry{{HostPort: 8082, ContainerPort: 80}})).To(Succeed())
+
+		conf := fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "mynet",
+			"type": "portmap",
+			"backend": "iptables",
+			"rejectHostPortConflicts": true,
+			"dataDir": %q,
+			"cni.dev/valid-attachments": [{"containerID": "container-b", "ifname": "eth0"}]
+		}`, dataDir)
+		args := &skel.CmdArgs{StdinData: []byte(conf)}
+		Expect(cmdGC(args)).To(Succeed())
+
+		// The ports of the stale attachment are free again
+		Expect(claimPorts(dataDir, "mynet", "container-d", "eth0", []PortMapEntry{{HostPort: 8080, ContainerPort: 80}})).To(Succeed())
+		Expect(claimPorts(dataDir, "mynet", "container-d", "eth0", []PortMapEntry{{HostPort: 8081, ContainerPort: 80}})).To(
+			MatchError("host port 8081/tcp is in use by container container-b"))
+		// The claims of other networks are left alone
+		Expect(claimPorts(dataDir, "mynet", "container-d", "eth0", []PortMapEntry{{HostPort: 8082, ContainerPort: 80}})).To(
+			MatchError("host port 8082/tcp is in use by container container-c"))
+	})
+})
@@ -21,8 +21,9 @@
 //
 // This has one notable limitation: it does not perform any kind of reservation
 // of the actual host port. If there is a service on the host, it will have all
-// its traffic captured by the container. If another container also claims a given
-// port, it will caputure the traffic - it is last-write-wins.
+// its traffic captured by the container. With rejectHostPortConflicts set,
+// the ports mapped by other containers are tracked in dataDir, and claiming
+// one of them fails.
 package main
 
 import (
@@ -74,10 +75,16 @@ type PortMapConf struct {
 	ConditionsV6  *[]string `json:"conditionsV6"`
 	MasqAll       bool      `json:"masqAll,omitempty"`
 	MarkMasqBit   *int      `json:"markMasqBit"`
+	DataDir       string    `json:"dataDir,omitempty"`
 	RuntimeConfig struct {
 		PortMaps []PortMapEntry `json:"portMappings,omitempty"`
 	} `json:"runtimeConfig,omitempty"`
 
+	// RejectHostPortConflicts fails ADD when a host port is already mapped
+	// by another attachment, rather than letting the last mapping capture
+	// the traffic
+	RejectHostPortConflicts bool `json:"rejectHostPortConflicts,omitempty"`
+
 	// iptables-backend-specific config
 	ExternalSetMarkChain *string `json:"externalSetMarkChain"`
 
@@ -108,6 +115,24 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 	netConf.ContainerID = args.ContainerID
 
+	if netConf.RejectHostPortConflicts {
+		if err := claimPorts(netConf.DataDir, netConf.Name, args.ContainerID, args.IfName, netConf.RuntimeConfig.PortMaps); err != nil {
+			return err
+		}
+	}
+	if err := forwardPorts(netConf); err != nil {
+		if netConf.RejectHostPortConflicts {
+			_ = releasePorts(netConf.DataDir, args.ContainerID, args.IfName)
+		}
+		return err
+	}
+
+	// Pass through the previous result
+	return types.PrintResult(netConf.PrevResult, netConf.CNIVersion)
+}
+
+// forwardPorts maps the ports to the addresses of the container
+func forwardPorts(netConf *PortMapConf) error {
 	if netConf.ContIPv4.IP != nil {
 		if err := netConf.mapper.forwardPorts(netConf, netConf.ContIPv4); err != nil {
 			return err
@@ -142,9 +167,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 			log.Printf("failed to delete stale UDP conntrack entries for %s: %v", netConf.ContIPv6.IP, err)
 		}
 	}
-
-	// Pass through the previous result
-	return types.PrintResult(netConf.PrevResult, netConf.CNIVersion)
+	return nil
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -161,7 +184,10 @@ func cmdDel(args *skel.CmdArgs) error {
 
 	// We don't need to parse out whether or not we're using v6 or snat,
 	// deletion is idempotent
-	return netConf.mapper.unforwardPorts(netConf)
+	if err := netConf.mapper.unforwardPorts(netConf); err != nil {
+		return err
+	}
+	return releasePorts(netConf.DataDir, args.ContainerID, args.IfName)
 }
 
 func main() {
@@ -169,11 +195,26 @@ func main() {
 		Add:   cmdAdd,
 		Check: cmdCheck,
 		Del:   cmdDel,
-		/* FIXME GC */
+		GC:    cmdGC,
 		/* FIXME Status */
 	}, version.All, bv.BuildString("portmap"))
 }
 
+// cmdGC drops the host port claims of the attachments of the network that
+// are not in the list of valid attachments
+func cmdGC(args *skel.CmdArgs) error {
+	conf, _, err := parseConfig(args.StdinData, args.IfName)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	valid := make(map[types.GCAttachment]bool, len(conf.ValidAttachments))
+	for _, a := range conf.ValidAttachments {
+		valid[a] = true
+	}
+	return pruneClaims(conf.DataDir, conf.Name, valid)
+}
+
 func cmdCheck(args *skel.CmdArgs) error {
 	conf, result, err := parseConfig(args.StdinData, args.IfName)
 	if err != nil {
@@ -230,6 +271,10 @@ func parseConfig(stdin []byte, ifName string) (*PortMapConf, *current.Result, er
 
 	conf.mapper = &portMapperIPTables{}
 
+	if conf.DataDir == "" {
+		conf.DataDir = defaultDataDir
+	}
+
 	if conf.SNAT == nil {
 		tvar := true
 		conf.SNAT = &tvar
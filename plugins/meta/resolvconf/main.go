@@ -0,0 +1,247 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin that merges the DNS configuration of all the
+// attachments of a container, so that the DNS of a network is not lost when
+// the container is attached to another one. Each ADD records the DNS of the
+// attachment and returns the merge of the DNS of all the attachments.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+// ResolvConfConf is the chained plugin configuration
+type ResolvConfConf struct {
+	types.NetConf
+
+	// Priority orders the DNS configuration of the attachment relative to
+	// the other attachments of the container, higher first
+	Priority int `json:"priority,omitempty"`
+	// Policy is how the nameservers of the attachments are merged,
+	// "priority" (default) or "interleave"
+	Policy string `json:"policy,omitempty"`
+	// MaxNameservers caps the number of merged nameservers, 3 by default
+	MaxNameservers int `json:"maxNameservers,omitempty"`
+	// DataDir is where the DNS of the attachments is recorded
+	DataDir string `json:"dataDir,omitempty"`
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		GC:    cmdGC,
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("resolvconf"))
+}
+
+func parseConf(data []byte) (*ResolvConfConf, *current.Result, error) {
+	conf := ResolvConfConf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	switch conf.Policy {
+	case "":
+		conf.Policy = policyPriority
+	case policyPriority, policyInterleave:
+	default:
+		return nil, nil, fmt.Errorf("invalid policy %q, must be %s or %s", conf.Policy, policyPriority, policyInterleave)
+	}
+	if conf.MaxNameservers < 0 {
+		return nil, nil, fmt.Errorf("invalid maxNameservers %d", conf.MaxNameservers)
+	}
+	if conf.MaxNameservers == 0 {
+		conf.MaxNameservers = defaultMaxNameservers
+	}
+	if conf.DataDir == "" {
+		conf.DataDir = defaultDataDir
+	}
+	return &conf, result, nil
+}
+
+func dnsConfSet(dnsConf types.DNS) bool {
+	return dnsConf.Nameservers != nil ||
+		dnsConf.Search != nil ||
+		dnsConf.Options != nil ||
+		dnsConf.Domain != ""
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	// The DNS settings of the plugin take precedence over the ones of the
+	// previous result, as in the main plugins
+	dns := result.DNS
+	if dnsConfSet(conf.DNS) {
+		dns = conf.DNS
+	}
+
+	s, err := openStore(conf.DataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	attachments, err := s.load(args.ContainerID)
+	if err != nil {
+		return err
+	}
+	seq := 0
+	kept := attachments[:0]
+	for _, a := range attachments {
+		if a.IfName == args.IfName {
+			continue
+		}
+		if a.Seq >= seq {
+			seq = a.Seq + 1
+		}
+		kept = append(kept, a)
+	}
+	added := attachment{
+		Network:  conf.Name,
+		IfName:   args.IfName,
+		Priority: conf.Priority,
+		Seq:      seq,
+		DNS:      dns,
+	}
+	attachments = append(kept, added)
+	if err := s.put(args.ContainerID, added); err != nil {
+		return fmt.Errorf("failed to record DNS of %s/%s: %v", conf.Name, args.IfName, err)
+	}
+
+	result.DNS = mergeDNS(attachments, conf.Policy, conf.MaxNameservers)
+	return types.PrintResult(result, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore(conf.DataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	attachments, err := s.load(args.ContainerID)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if a.Network == conf.Name && a.IfName == args.IfName {
+			return s.remove(args.ContainerID, a)
+		}
+	}
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	s, err := openStore(conf.DataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	attachments, err := s.load(args.ContainerID)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if a.Network == conf.Name && a.IfName == args.IfName {
+			return nil
+		}
+	}
+	return fmt.Errorf("resolvconf: no DNS recorded for %s/%s", conf.Name, args.IfName)
+}
+
+// cmdGC drops the records of the attachments of the network that are not in
+// the list of valid attachments
+func cmdGC(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[types.GCAttachment]bool, len(conf.ValidAttachments))
+	for _, a := range conf.ValidAttachments {
+		valid[a] = true
+	}
+
+	s, err := openStore(conf.DataDir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ids, err := s.containers()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, id := range ids {
+		attachments, err := s.load(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, a := range attachments {
+			if a.Network != conf.Name || valid[types.GCAttachment{ContainerID: id, IfName: a.IfName}] {
+				continue
+			}
+			if err := s.remove(id, a); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/pkg/resolvconf"
+)
+
+const (
+	// policyPriority lists the nameservers of an attachment before the ones
+	// of the attachments of lower priority
+	policyPriority = "priority"
+	// policyInterleave takes the nameservers of the attachments in turn, so
+	// that every network gets a nameserver within the limit
+	policyInterleave = "interleave"
+
+	// defaultMaxNameservers is the number of nameservers used by the glibc
+	// resolver (MAXNS)
+	defaultMaxNameservers = 3
+)
+
+// attachment is the DNS configuration recorded for an attachment of the
+// container
+type attachment struct {
+	Network  string    `json:"network"`
+	IfName   string    `json:"ifName"`
+	Priority int       `json:"priority"`
+	Seq      int       `json:"seq"`
+	DNS      types.DNS `json:"dns"`
+}
+
+// mergeDNS merges the DNS configuration of the attachments. Attachments of
+// higher priority come first, and attachments of the same priority in the
+// order they were added. The search domains and options are merged in that
+// order whatever the policy; for options, the first value of an option wins.
+func mergeDNS(attachments []attachment, policy string, maxNameservers int) types.DNS {
+	sorted := make([]attachment, len(attachments))
+	copy(sorted, attachments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].Seq < sorted[j].Seq
+	})
+
+	configs := make([]types.DNS, 0, len(sorted))
+	for _, a := range sorted {
+		configs = append(configs, a.DNS)
+	}
+	merged := resolvconf.Merge(configs...)
+
+	if policy == policyInterleave {
+		merged.Nameservers = nil
+		for i := 0; ; i++ {
+			more := false
+			for _, dns := range configs {
+				if i < len(dns.Nameservers) {
+					merged.Nameservers = resolvconf.AppendUnique(merged.Nameservers, dns.Nameservers[i])
+					more = true
+				}
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	if len(merged.Nameservers) > maxNameservers {
+		merged.Nameservers = merged.Nameservers[:maxNameservers]
+	}
+	return merged
+}
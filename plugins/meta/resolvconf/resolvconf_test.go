@@ -0,0 +1,176 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+var _ = Describe("resolvconf DNS merge", func() {
+	a := attachment{
+		Priority: 0,
+		Seq:      0,
+		DNS: types.DNS{
+			Nameservers: []string{"10.0.0.1", "10.0.0.2"},
+			Domain:      "a.example",
+			Search:      []string{"a.example", "example"},
+			Options:     []string{"ndots:5"},
+		},
+	}
+	b := attachment{
+		Priority: 0,
+		Seq:      1,
+		DNS: types.DNS{
+			Nameservers: []string{"10.1.0.1", "10.1.0.2", "10.0.0.1"},
+			Domain:      "b.example",
+			Search:      []string{"b.example", "example"},
+			Options:     []string{"ndots:2", "rotate"},
+		},
+	}
+
+	It("keeps the attachments in the order they were added", func() {
+		dns := mergeDNS([]attachment{b, a}, policyPriority, 10)
+		Expect(dns).To(Equal(types.DNS{
+			Nameservers: []string{"10.0.0.1", "10.0.0.2", "10.1.0.1", "10.1.0.2"},
+			Domain:      "a.example",
+			Search:      []string{"a.example", "example", "b.example"},
+			Options:     []string{"ndots:5", "rotate"},
+		}))
+	})
+
+	It("puts the attachments of higher priority first", func() {
+		b := b
+		b.Priority = 10
+		dns := mergeDNS([]attachment{a, b}, policyPriority, 3)
+		Expect(dns.Nameservers).To(Equal([]string{"10.1.0.1", "10.1.0.2", "10.0.0.1"}))
+		Expect(dns.Domain).To(Equal("b.example"))
+		Expect(dns.Search).To(Equal([]string{"b.example", "example", "a.example"}))
+		Expect(dns.Options).To(Equal([]string{"ndots:2", "rotate"}))
+	})
+
+	It("interleaves the nameservers of the attachments", func() {
+		dns := mergeDNS([]attachment{a, b}, policyInterleave, 3)
+		Expect(dns.Nameservers).To(Equal([]string{"10.0.0.1", "10.1.0.1", "10.0.0.2"}))
+	})
+})
+
+var _ = Describe("resolvconf chained plugin", func() {
+	const containerID = "dummy"
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "resolvconf_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	netConf := func(name, nameserver string, priority int) []byte {
+		return []byte(fmt.Sprintf(`{
+			"cniVersion": "1.0.0",
+			"name": "%s",
+			"type": "resolvconf",
+			"priority": %d,
+			"dataDir": "%s",
+			"prevResult": {
+				"cniVersion": "1.0.0",
+				"dns": {"nameservers": ["%s"], "search": ["%s.example"]}
+			}
+		}`, name, priority, dataDir, nameserver, name))
+	}
+
+	add := func(name, ifName, nameserver string, priority int) types.DNS {
+		args := &skel.CmdArgs{
+			ContainerID: containerID,
+			IfName:      ifName,
+			StdinData:   netConf(name, nameserver, priority),
+		}
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := current.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		return result.DNS
+	}
+
+	It("merges the DNS of the attachments of the container", func() {
+		Expect(add("net1", "eth0", "10.0.0.1", 0).Nameservers).To(Equal([]string{"10.0.0.1"}))
+		dns := add("net2", "net1", "10.1.0.1", 10)
+		Expect(dns.Nameservers).To(Equal([]string{"10.1.0.1", "10.0.0.1"}))
+		Expect(dns.Search).To(Equal([]string{"net2.example", "net1.example"}))
+
+		// A repeated ADD replaces the record of the attachment
+		dns = add("net1", "eth0", "10.0.0.2", 0)
+		Expect(dns.Nameservers).To(Equal([]string{"10.1.0.1", "10.0.0.2"}))
+
+		args := &skel.CmdArgs{
+			ContainerID: containerID,
+			IfName:      "net1",
+			StdinData:   netConf("net2", "10.1.0.1", 10),
+		}
+		Expect(cmdCheck(args)).To(Succeed())
+		err := testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdCheck(args)).To(MatchError("resolvconf: no DNS recorded for net2/net1"))
+
+		dns = add("net3", "net2", "10.2.0.1", 0)
+		Expect(dns.Nameservers).To(Equal([]string{"10.0.0.2", "10.2.0.1"}))
+
+		for _, a := range []struct{ name, ifName string }{{"net1", "eth0"}, {"net3", "net2"}} {
+			args := &skel.CmdArgs{
+				ContainerID: containerID,
+				IfName:      a.ifName,
+				StdinData:   netConf(a.name, "", 0),
+			}
+			Expect(cmdDel(args)).To(Succeed())
+		}
+		_, err = os.Stat(filepath.Join(dataDir, containerID))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("drops the records of invalid attachments on GC", func() {
+		add("net1", "eth0", "10.0.0.1", 0)
+		add("net2", "net1", "10.1.0.1", 0)
+
+		gcConf := fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "net1",
+			"type": "resolvconf",
+			"dataDir": "%s",
+			"cni.dev/valid-attachments": []
+		}`, dataDir)
+		Expect(cmdGC(&skel.CmdArgs{StdinData: []byte(gcConf)})).To(Succeed())
+
+		// Only the attachment of net2 is left
+		dns := add("net3", "net2", "10.2.0.1", 0)
+		Expect(dns.Nameservers).To(Equal([]string{"10.1.0.1", "10.2.0.1"}))
+	})
+})
@@ -0,0 +1,73 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+)
+
+const defaultDataDir = "/var/lib/cni/resolvconf"
+
+// store records the attachments of each container in the attachment store
+// of the data directory, in a group named after the container ID and
+// under the name of the interface. The whole store is locked, as the
+// attachments of a pod may be added concurrently.
+type store struct {
+	*attachments.Store
+}
+
+func openStore(dir string) (*store, error) {
+	s, err := attachments.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &store{s}, nil
+}
+
+func (s *store) load(containerID string) ([]attachment, error) {
+	ifNames, err := s.Refs(containerID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]attachment, 0, len(ifNames))
+	for _, ifName := range ifNames {
+		a := attachment{}
+		if _, err := s.GetJSON(containerID, ifName, &a); err != nil {
+			return nil, fmt.Errorf("failed to read DNS of %s/%s: %v", containerID, ifName, err)
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// put records the attachment, replacing the previous record of its
+// interface
+func (s *store) put(containerID string, a attachment) error {
+	return s.PutJSON(containerID, a.IfName, &a)
+}
+
+// remove drops the record of the attachment, and the group of the
+// container with its last attachment
+func (s *store) remove(containerID string, a attachment) error {
+	_, err := s.Remove(containerID, a.IfName)
+	return err
+}
+
+// containers returns the IDs of the containers with recorded attachments
+func (s *store) containers() ([]string, error) {
+	return s.Groups()
+}
@@ -0,0 +1,159 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin overriding the routes the previous plugins
+// configured on the container interface: it flushes, deletes, adds or
+// replaces routes and the default gateways, and updates the result.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+// RouteOverrideConf is the chained plugin configuration. The changes are
+// applied in the order of the fields.
+type RouteOverrideConf struct {
+	types.NetConf
+
+	// FlushRoutes deletes all the routes of the interface but the ones
+	// the kernel derives from its addresses
+	FlushRoutes bool `json:"flushRoutes,omitempty"`
+	// FlushGateway deletes the default routes of the interface
+	FlushGateway bool `json:"flushGateway,omitempty"`
+	// FlushPrefixes deletes the routes to the prefixes, or within them
+	FlushPrefixes []string `json:"flushPrefixes,omitempty"`
+	// DelRoutes deletes the routes to the destinations
+	DelRoutes []types.Route `json:"delRoutes,omitempty"`
+	// AddRoutes adds the routes, replacing the ones to the same
+	// destinations
+	AddRoutes []types.Route `json:"addRoutes,omitempty"`
+	// Gateways replace the default route of their family
+	Gateways []string `json:"gateways,omitempty"`
+
+	flushPrefixes []*net.IPNet
+	gateways      []net.IP
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		/* FIXME GC */
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("route-override"))
+}
+
+func parseConf(data []byte) (*RouteOverrideConf, *current.Result, error) {
+	conf := RouteOverrideConf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	for _, p := range conf.FlushPrefixes {
+		_, prefix, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid flush prefix %q: %v", p, err)
+		}
+		conf.flushPrefixes = append(conf.flushPrefixes, prefix)
+	}
+	for _, r := range conf.DelRoutes {
+		if r.Dst.IP == nil {
+			return nil, nil, fmt.Errorf("delRoutes: route without dst")
+		}
+	}
+	for _, r := range conf.AddRoutes {
+		if r.Dst.IP == nil {
+			return nil, nil, fmt.Errorf("addRoutes: route without dst")
+		}
+		if r.GW != nil && (r.GW.To4() == nil) != (r.Dst.IP.To4() == nil) {
+			return nil, nil, fmt.Errorf("addRoutes: gateway %s and dst %s are of different families", r.GW, r.Dst.String())
+		}
+	}
+	families := make(map[bool]bool)
+	for _, g := range conf.Gateways {
+		gw := net.ParseIP(g)
+		if gw == nil {
+			return nil, nil, fmt.Errorf("invalid gateway %q", g)
+		}
+		if families[gw.To4() != nil] {
+			return nil, nil, fmt.Errorf("more than one gateway of the family of %s", g)
+		}
+		families[gw.To4() != nil] = true
+		conf.gateways = append(conf.gateways, gw)
+	}
+
+	return &conf, result, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return override(conf, args.IfName)
+	})
+	if err != nil {
+		return err
+	}
+
+	result.Routes = overrideResult(conf, result.Routes)
+	return types.PrintResult(result, conf.CNIVersion)
+}
+
+// cmdDel has nothing to undo, the routes go with the interface
+func cmdDel(args *skel.CmdArgs) error {
+	_, _, err := parseConf(args.StdinData)
+	return err
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	return ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return check(conf, args.IfName)
+	})
+}
@@ -0,0 +1,236 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+func isDefault(dst *net.IPNet) bool {
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+func sameFamily(a, b net.IP) bool {
+	return (a.To4() == nil) == (b.To4() == nil)
+}
+
+// within reports whether dst is the prefix or a part of it
+func within(dst, prefix *net.IPNet) bool {
+	dstOnes, _ := dst.Mask.Size()
+	prefixOnes, _ := prefix.Mask.Size()
+	return sameFamily(dst.IP, prefix.IP) && dstOnes >= prefixOnes && prefix.Contains(dst.IP)
+}
+
+// sameDst compares the prefixes, the dst of the routes of a result may
+// have host bits set
+func sameDst(a, b *net.IPNet) bool {
+	aOnes, _ := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	return sameFamily(a.IP, b.IP) && aOnes == bOnes && a.IP.Mask(a.Mask).Equal(b.IP.Mask(b.Mask))
+}
+
+// deleted reports whether the route to dst is deleted or replaced
+// explicitly
+func (c *RouteOverrideConf) deleted(dst *net.IPNet) bool {
+	for _, r := range slices.Concat(c.DelRoutes, c.AddRoutes) {
+		if sameDst(dst, &r.Dst) {
+			return true
+		}
+	}
+	if isDefault(dst) {
+		for _, gw := range c.gateways {
+			if sameFamily(dst.IP, gw) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flushed reports whether the route to dst goes away: flushed, deleted, or
+// replaced by a route of AddRoutes or a gateway. Flushing leaves the
+// link-local and multicast routes the kernel adds for IPv6.
+func (c *RouteOverrideConf) flushed(dst *net.IPNet) bool {
+	if c.deleted(dst) {
+		return true
+	}
+	if dst.IP.IsLinkLocalUnicast() || dst.IP.IsMulticast() {
+		return false
+	}
+	if c.FlushRoutes || (c.FlushGateway && isDefault(dst)) {
+		return true
+	}
+	for _, prefix := range c.flushPrefixes {
+		if within(dst, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// routes returns the routes to add, with the default routes through the
+// gateways
+func (c *RouteOverrideConf) routes() []types.Route {
+	routes := append([]types.Route{}, c.AddRoutes...)
+	for _, gw := range c.gateways {
+		dst := net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+		if gw.To4() == nil {
+			dst = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+		}
+		routes = append(routes, types.Route{Dst: dst, GW: gw})
+	}
+	return routes
+}
+
+func netlinkRoute(r types.Route, linkIndex int) *netlink.Route {
+	dst := r.Dst
+	route := &netlink.Route{
+		LinkIndex: linkIndex,
+		Dst:       &dst,
+		Gw:        r.GW,
+		MTU:       r.MTU,
+		AdvMSS:    r.AdvMSS,
+		Priority:  r.Priority,
+	}
+	if r.Table != nil {
+		route.Table = *r.Table
+	}
+	if r.Scope != nil {
+		route.Scope = netlink.Scope(*r.Scope)
+	}
+	return route
+}
+
+// linkRoutes lists the routes of the interface in the main table
+func linkRoutes(link netlink.Link) ([]netlink.Route, error) {
+	routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Table:     unix.RT_TABLE_MAIN,
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes of %q: %v", link.Attrs().Name, err)
+	}
+	return routes, nil
+}
+
+// override applies the configuration to the routes of the interface in the
+// current namespace
+func override(c *RouteOverrideConf, ifName string) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	routes, err := linkRoutes(link)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		// The routes the kernel derives from the addresses are only
+		// deleted explicitly
+		if route.Protocol == unix.RTPROT_KERNEL && !c.deleted(route.Dst) {
+			continue
+		}
+		if !c.flushed(route.Dst) {
+			continue
+		}
+		if err := netlink.RouteDel(&route); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("failed to delete route %s: %v", route, err)
+		}
+	}
+
+	for _, r := range c.routes() {
+		if err := netlink.RouteAdd(netlinkRoute(r, link.Attrs().Index)); err != nil {
+			return fmt.Errorf("failed to add route %s via %s dev %s: %v", r.Dst.String(), r.GW, ifName, err)
+		}
+	}
+	return nil
+}
+
+// overrideResult applies the configuration to the routes of the result
+func overrideResult(c *RouteOverrideConf, routes []*types.Route) []*types.Route {
+	overridden := []*types.Route{}
+	for _, r := range routes {
+		if !c.flushed(&r.Dst) {
+			overridden = append(overridden, r)
+		}
+	}
+	for _, r := range c.routes() {
+		overridden = append(overridden, &r)
+	}
+	return overridden
+}
+
+// added reports whether a route to dst is added
+func (c *RouteOverrideConf) added(dst *net.IPNet) bool {
+	for _, r := range c.routes() {
+		if sameDst(dst, &r.Dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// check verifies the routes to add are installed and the deleted ones are
+// gone from the interface in the current namespace
+func check(c *RouteOverrideConf, ifName string) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	routes, err := linkRoutes(link)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range c.DelRoutes {
+		if c.added(&r.Dst) {
+			continue
+		}
+		for _, route := range routes {
+			if sameDst(route.Dst, &r.Dst) {
+				return fmt.Errorf("route to %s of %s not deleted", r.Dst.String(), ifName)
+			}
+		}
+	}
+
+	for _, r := range c.routes() {
+		if r.Table != nil && *r.Table != unix.RT_TABLE_MAIN {
+			// Not in the main table, checked by the kernel on ADD
+			continue
+		}
+		found := false
+		for _, route := range routes {
+			if sameDst(route.Dst, &r.Dst) && (r.GW == nil || r.GW.Equal(route.Gw)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("route to %s via %s not found on %s", r.Dst.String(), r.GW, ifName)
+		}
+	}
+	return nil
+}
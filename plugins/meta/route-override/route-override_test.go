@@ -0,0 +1,239 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+func routeOverrideConf(netns, extra string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "route-override-test",
+		"type": "route-override",
+		%s
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [{"name": "eth0", "sandbox": %q}],
+			"ips": [{"interface": 0, "address": "10.1.2.3/24", "gateway": "10.1.2.1"}],
+			"routes": [
+				{"dst": "0.0.0.0/0", "gw": "10.1.2.1"},
+				{"dst": "10.10.0.0/16", "gw": "10.1.2.1"},
+				{"dst": "10.20.0.0/16", "gw": "10.1.2.1"},
+				{"dst": "10.20.5.0/24", "gw": "10.1.2.1"}
+			]
+		}
+	}`, extra, netns))
+}
+
+// routeDsts returns the destinations of the routes of eth0 in the main
+// table, but the IPv6 ones the kernel adds
+func routeDsts() map[string]string {
+	link, err := netlinksafe.LinkByName("eth0")
+	Expect(err).NotTo(HaveOccurred())
+	routes, err := linkRoutes(link)
+	Expect(err).NotTo(HaveOccurred())
+	dsts := make(map[string]string)
+	for _, r := range routes {
+		if r.Family == netlink.FAMILY_V6 {
+			continue
+		}
+		dsts[r.Dst.String()] = r.Gw.String()
+	}
+	return dsts
+}
+
+var _ = Describe("route-override configuration", func() {
+	It("parses the prefixes and gateways", func() {
+		conf, result, err := parseConf(routeOverrideConf("/var/run/netns/test", `
+			"flushPrefixes": ["10.20.0.0/16"],
+			"gateways": ["10.1.2.254", "2001:db8::1"],`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Routes).To(HaveLen(4))
+		Expect(conf.flushPrefixes).To(HaveLen(1))
+		Expect(conf.routes()).To(HaveLen(2))
+	})
+
+	It("flushes the routes within the prefixes", func() {
+		conf, _, err := parseConf(routeOverrideConf("/var/run/netns/test", `
+			"flushPrefixes": ["10.20.0.0/16"],`))
+		Expect(err).NotTo(HaveOccurred())
+		for dst, flushed := range map[string]bool{
+			"10.20.0.0/16":  true,
+			"10.20.5.0/24":  true,
+			"10.0.0.0/8":    false,
+			"0.0.0.0/0":     false,
+			"2001:db8::/64": false,
+		} {
+			_, ipn, err := net.ParseCIDR(dst)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.flushed(ipn)).To(Equal(flushed), dst)
+		}
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(extra, msg string) {
+			_, _, err := parseConf(routeOverrideConf("/var/run/netns/test", extra))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid prefix", `"flushPrefixes": ["10.20.0.0"],`, `invalid flush prefix "10.20.0.0"`),
+		Entry("with an invalid gateway", `"gateways": ["10.1.2"],`, `invalid gateway "10.1.2"`),
+		Entry("with two gateways of a family", `"gateways": ["10.1.2.1", "10.1.2.2"],`, "more than one gateway of the family of 10.1.2.2"),
+		Entry("with a route of mixed families", `"addRoutes": [{"dst": "10.0.0.0/8", "gw": "2001:db8::1"}],`, "are of different families"),
+	)
+})
+
+var _ = Describe("route-override operations", func() {
+	var containerNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		containerNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "eth0"
+			Expect(netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: "peer0"})).To(Succeed())
+			link, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			peer, err := netlinksafe.LinkByName("peer0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			Expect(netlink.LinkSetUp(peer)).To(Succeed())
+
+			addr, err := netlink.ParseAddr("10.1.2.3/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+
+			gw := net.ParseIP("10.1.2.1")
+			for _, dst := range []string{"0.0.0.0/0", "10.10.0.0/16", "10.20.0.0/16", "10.20.5.0/24"} {
+				_, ipn, err := net.ParseCIDR(dst)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: ipn, Gw: gw})).To(Succeed())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(containerNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(containerNS)).To(Succeed())
+	})
+
+	It("overrides the routes and the gateway with ADD/CHECK/DEL", func() {
+		conf := routeOverrideConf(containerNS.Path(), `
+			"flushPrefixes": ["10.20.0.0/16"],
+			"delRoutes": [{"dst": "10.10.0.0/16"}],
+			"addRoutes": [{"dst": "192.168.0.0/16", "gw": "10.1.2.254"}],
+			"gateways": ["10.1.2.254"],`)
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData:   conf,
+		}
+
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := types100.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		routes := make(map[string]string)
+		for _, route := range result.Routes {
+			routes[route.Dst.String()] = route.GW.String()
+		}
+		Expect(routes).To(Equal(map[string]string{
+			"192.168.0.0/16": "10.1.2.254",
+			"0.0.0.0/0":      "10.1.2.254",
+		}))
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(routeDsts()).To(Equal(map[string]string{
+				"10.1.2.0/24":    "<nil>",
+				"192.168.0.0/16": "10.1.2.254",
+				"0.0.0.0/0":      "10.1.2.254",
+			}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})).To(Succeed())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			_, ipn, _ := net.ParseCIDR("192.168.0.0/16")
+			link, err := netlinksafe.LinkByName("eth0")
+			if err != nil {
+				return err
+			}
+			return netlink.RouteDel(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: ipn, Table: unix.RT_TABLE_MAIN})
+		})
+		Expect(err).NotTo(HaveOccurred())
+		err = testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})
+		Expect(err).To(MatchError("route to 192.168.0.0/16 via 10.1.2.254 not found on eth0"))
+
+		Expect(testutils.CmdDelWithArgs(args, func() error {
+			return cmdDel(args)
+		})).To(Succeed())
+	})
+
+	It("flushes all the routes but the ones of the addresses", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData:   routeOverrideConf(containerNS.Path(), `"flushRoutes": true,`),
+		}
+
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := types100.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Routes).To(BeEmpty())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(routeDsts()).To(Equal(map[string]string{"10.1.2.0/24": "<nil>"}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -49,6 +49,12 @@ type PluginConf struct {
 
 	// Add plugin-specific flags here
 	Table *int `json:"table,omitempty"`
+
+	// Mark adds rules routing the packets carrying this firewall mark,
+	// e.g. set by a chained plugin, through the table of the attachment,
+	// whatever their source address. MarkMask defaults to 0xffffffff.
+	Mark     *uint32 `json:"mark,omitempty"`
+	MarkMask *uint32 `json:"markMask,omitempty"`
 }
 
 // Wrapper that does a lock before and unlock after operations to serialise
@@ -104,6 +110,14 @@ func parseConfig(stdin []byte) (*PluginConf, error) {
 	}
 	// End previous result parsing
 
+	if conf.Mark != nil && *conf.Mark == 0 {
+		return nil, fmt.Errorf("mark must be non-zero")
+	}
+	if conf.MarkMask == nil {
+		mask := uint32(0xffffffff)
+		conf.MarkMask = &mask
+	}
+
 	return &conf, nil
 }
 
@@ -166,9 +180,9 @@ func cmdAdd(args *skel.CmdArgs) error {
 	// Do the actual work.
 	err = withLockAndNetNS(args.Netns, func(_ ns.NetNS) error {
 		if conf.Table != nil {
-			return doRoutesWithTable(ipCfgs, *conf.Table)
+			return doRoutesWithTable(ipCfgs, *conf.Table, conf)
 		}
-		return doRoutes(ipCfgs, args.IfName)
+		return doRoutes(ipCfgs, args.IfName, conf)
 	})
 	if err != nil {
 		return err
@@ -206,8 +220,44 @@ func getNextTableID(rules []netlink.Rule, routes []netlink.Route, candidateID in
 	return table
 }
 
+// markRules adds the rules routing the marked packets of an IP family
+// through the table of the first address of that family.
+type markRules struct {
+	conf   *PluginConf
+	marked map[int]bool
+}
+
+func newMarkRules(conf *PluginConf) *markRules {
+	return &markRules{conf: conf, marked: map[int]bool{}}
+}
+
+func (m *markRules) add(ipCfg *current.IPConfig, table int) error {
+	if m.conf.Mark == nil {
+		return nil
+	}
+	family := netlink.FAMILY_V6
+	if ipCfg.Address.IP.To4() != nil {
+		family = netlink.FAMILY_V4
+	}
+	if m.marked[family] {
+		return nil
+	}
+
+	log.Printf("Set rule for mark %#x/%#x", *m.conf.Mark, *m.conf.MarkMask)
+	rule := netlink.NewRule()
+	rule.Family = family
+	rule.Table = table
+	rule.Mark = *m.conf.Mark
+	rule.Mask = m.conf.MarkMask
+	if err := netlink.RuleAdd(rule); err != nil {
+		return fmt.Errorf("failed to add rule for mark %#x: %v", *m.conf.Mark, err)
+	}
+	m.marked[family] = true
+	return nil
+}
+
 // doRoutes does all the work to set up routes and rules during an add.
-func doRoutes(ipCfgs []*current.IPConfig, iface string) error {
+func doRoutes(ipCfgs []*current.IPConfig, iface string, conf *PluginConf) error {
 	// Get a list of rules and routes ready.
 	rules, err := netlinksafe.RuleList(netlink.FAMILY_ALL)
 	if err != nil {
@@ -231,6 +281,7 @@ func doRoutes(ipCfgs []*current.IPConfig, iface string) error {
 	}
 
 	linkIndex := link.Attrs().Index
+	marks := newMarkRules(conf)
 
 	// Get all routes for the interface in the default routing table
 	routes, err = netlinksafe.RouteList(link, netlink.FAMILY_ALL)
@@ -259,6 +310,9 @@ func doRoutes(ipCfgs []*current.IPConfig, iface string) error {
 		if err = netlink.RuleAdd(rule); err != nil {
 			return fmt.Errorf("Failed to add rule: %v", err)
 		}
+		if err = marks.add(ipCfg, table); err != nil {
+			return err
+		}
 
 		// Add a default route, since this may have been removed by previous
 		// plugin.
@@ -335,7 +389,8 @@ func doRoutes(ipCfgs []*current.IPConfig, iface string) error {
 	return nil
 }
 
-func doRoutesWithTable(ipCfgs []*current.IPConfig, table int) error {
+func doRoutesWithTable(ipCfgs []*current.IPConfig, table int, conf *PluginConf) error {
+	marks := newMarkRules(conf)
 	for _, ipCfg := range ipCfgs {
 		log.Printf("Set rule for source %s", ipCfg.String())
 		rule := netlink.NewRule()
@@ -356,6 +411,9 @@ func doRoutesWithTable(ipCfgs []*current.IPConfig, table int) error {
 		if err := netlink.RuleAdd(rule); err != nil {
 			return fmt.Errorf("failed to add rule: %v", err)
 		}
+		if err := marks.add(ipCfg, table); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -371,18 +429,19 @@ func cmdDel(args *skel.CmdArgs) error {
 
 	log.Printf("Cleaning up SBR for %s", args.IfName)
 	err = withLockAndNetNS(args.Netns, func(_ ns.NetNS) error {
-		return tidyRules(args.IfName, conf.Table)
+		return tidyRules(args.IfName, conf)
 	})
 
 	return err
 }
 
 // Tidy up the rules for the deleted interface
-func tidyRules(iface string, table *int) error {
+func tidyRules(iface string, conf *PluginConf) error {
 	// We keep on going on rule deletion error, but return the last failure.
 	var errReturn error
 	var err error
 	var rules []netlink.Rule
+	table := conf.Table
 
 	if table != nil {
 		rules, err = netlinksafe.RuleListFiltered(
@@ -411,7 +470,7 @@ func tidyRules(iface string, table *int) error {
 		// https://github.com/containernetworking/cni/blob/main/SPEC.md#del-remove-container-from-network-or-un-apply-modifications
 		_, notFound := err.(netlink.LinkNotFoundError)
 		if notFound {
-			return nil
+			return errReturn
 		}
 		log.Printf("Failed to get link %s: %v", iface, err)
 		return fmt.Errorf("Failed to get link %s: %v", iface, err)
@@ -423,6 +482,9 @@ func tidyRules(iface string, table *int) error {
 		return fmt.Errorf("Failed to list all addrs: %v", err)
 	}
 
+	// The mark rules lead to the tables of the source rules of the interface
+	tables := map[int]bool{}
+
 RULE_LOOP:
 	for _, rule := range rules {
 		log.Printf("Check rule: %v", rule)
@@ -432,6 +494,7 @@ RULE_LOOP:
 
 		for _, addr := range addrs {
 			if rule.Src.IP.Equal(addr.IP) {
+				tables[rule.Table] = true
 				log.Printf("Delete rule %v", rule)
 				err := netlink.RuleDel(&rule)
 				if err != nil {
@@ -444,6 +507,19 @@ RULE_LOOP:
 
 	}
 
+	if conf.Mark != nil {
+		for _, rule := range rules {
+			if rule.Src != nil || rule.Mark != *conf.Mark || !tables[rule.Table] {
+				continue
+			}
+			log.Printf("Delete rule %v", rule)
+			if err := netlink.RuleDel(&rule); err != nil {
+				errReturn = fmt.Errorf("Failed to delete rule %v", err)
+				log.Printf("... Failed! %v", err)
+			}
+		}
+	}
+
 	return errReturn
 }
 
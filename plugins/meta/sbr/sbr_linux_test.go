@@ -628,4 +628,83 @@ var _ = Describe("sbr test", func() {
 		Expect(rules[1].Table).To(Equal(tableID))
 		Expect(rules[1].Src.String()).To(Equal("192.168.1.209/32"))
 	})
+
+	It("Works with a mark", func() {
+		ifname := "net1"
+		conf := `{
+	"cniVersion": "0.3.0",
+	"name": "cni-plugin-sbr-test",
+	"type": "sbr",
+	"mark": 16,
+	"prevResult": {
+		"cniVersion": "0.3.0",
+		"interfaces": [
+			{
+				"name": "%s",
+				"sandbox": "%s"
+			}
+		],
+		"ips": [
+			{
+				"address": "192.168.1.209/24",
+				"interface": 0
+			},
+			{
+				"address": "192.168.101.209/24",
+				"interface": 0
+			}
+		],
+		"routes": []
+	}
+}`
+		conf = fmt.Sprintf(conf, ifname, targetNs.Path())
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNs.Path(),
+			IfName:      ifname,
+			StdinData:   []byte(conf),
+		}
+
+		err := setup(targetNs, createDefaultStatus())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = testutils.CmdAddWithArgs(args, func() error { return cmdAdd(args) })
+		Expect(err).NotTo(HaveOccurred())
+
+		markRules := func() []netlink.Rule {
+			var rules []netlink.Rule
+			err := targetNs.Do(func(_ ns.NetNS) error {
+				var err error
+				rules, err = netlinksafe.RuleListFiltered(
+					netlink.FAMILY_ALL, &netlink.Rule{
+						Mark: 16,
+					},
+					netlink.RT_FILTER_MARK,
+				)
+				return err
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return rules
+		}
+
+		// A single rule for the family, to the table of the first address
+		rules := markRules()
+		Expect(rules).To(HaveLen(1))
+		Expect(rules[0].Table).To(Equal(100))
+		Expect(*rules[0].Mask).To(Equal(uint32(0xffffffff)))
+
+		newStatus, err := readback(targetNs, []string{"net1", "eth0"})
+		Expect(err).NotTo(HaveOccurred())
+		var srcTable int
+		for _, rule := range newStatus.Rules {
+			if rule.Src != nil && rule.Src.String() == "192.168.1.209/32" {
+				srcTable = rule.Table
+			}
+		}
+		Expect(srcTable).To(Equal(rules[0].Table))
+
+		err = testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(markRules()).To(BeEmpty())
+	})
 })
@@ -0,0 +1,287 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin steering the traffic of the container to some
+// prefixes along SRv6 segment lists, with seg6 encap routes installed in
+// the container or on the host for the traffic of the container.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	modeEncap  = "encap"
+	modeInline = "inline"
+
+	sideContainer = "container"
+	sideHost      = "host"
+
+	defaultRulePriority = 1000
+)
+
+// SRv6Conf is the chained plugin configuration
+type SRv6Conf struct {
+	types.NetConf
+
+	Routes []*Route `json:"routes,omitempty"`
+	// RulePriority is the priority of the rules selecting the table of the
+	// host side routes of the container
+	RulePriority int `json:"rulePriority,omitempty"`
+
+	RuntimeConfig struct {
+		// Routes are added to the routes of the network configuration
+		Routes []*Route `json:"srv6Routes,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+
+	routes []*Route
+}
+
+// Route encapsulates the traffic to a prefix with a segment list
+type Route struct {
+	Dst string `json:"dst"`
+	// Segments are the SIDs the traffic goes through, in order
+	Segments []string `json:"segments"`
+	// Mode is "encap" (default), adding an outer IPv6 header, or "inline",
+	// inserting the segment routing header in the IPv6 packet
+	Mode string `json:"mode,omitempty"`
+	// Side is "container" (default) or "host"
+	Side string `json:"side,omitempty"`
+
+	dst      *net.IPNet
+	segments []net.IP
+	mode     int
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:   cmdAdd,
+		Check: cmdCheck,
+		Del:   cmdDel,
+		/* FIXME GC */
+		/* FIXME Status */
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("srv6"))
+}
+
+func parseConf(data []byte) (*SRv6Conf, *current.Result, error) {
+	conf := SRv6Conf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	if conf.RulePriority == 0 {
+		conf.RulePriority = defaultRulePriority
+	}
+	if conf.RulePriority < 0 {
+		return nil, nil, fmt.Errorf("invalid rulePriority %d", conf.RulePriority)
+	}
+
+	conf.routes = append(conf.Routes, conf.RuntimeConfig.Routes...)
+	for _, r := range conf.routes {
+		if err := r.parse(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &conf, result, nil
+}
+
+func (r *Route) parse() error {
+	var err error
+	_, r.dst, err = net.ParseCIDR(r.Dst)
+	if err != nil {
+		return fmt.Errorf("invalid route dst %q: %v", r.Dst, err)
+	}
+
+	if len(r.Segments) == 0 {
+		return fmt.Errorf("route to %s has no segments", r.Dst)
+	}
+	r.segments = make([]net.IP, 0, len(r.Segments))
+	for _, s := range r.Segments {
+		sid := net.ParseIP(s)
+		if sid == nil || sid.To4() != nil {
+			return fmt.Errorf("invalid segment %q of route to %s, must be an IPv6 address", s, r.Dst)
+		}
+		r.segments = append(r.segments, sid)
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = modeEncap
+		fallthrough
+	case modeEncap:
+		r.mode = nl.SEG6_IPTUN_MODE_ENCAP
+	case modeInline:
+		// The segment routing header is an IPv6 extension header
+		if r.dst.IP.To4() != nil {
+			return fmt.Errorf("route to %s: inline mode requires an IPv6 dst", r.Dst)
+		}
+		r.mode = nl.SEG6_IPTUN_MODE_INLINE
+	default:
+		return fmt.Errorf("route to %s: unknown mode %q", r.Dst, r.Mode)
+	}
+
+	switch r.Side {
+	case "":
+		r.Side = sideContainer
+	case sideContainer, sideHost:
+	default:
+		return fmt.Errorf("route to %s: unknown side %q", r.Dst, r.Side)
+	}
+
+	return nil
+}
+
+// routesOf returns the routes of the configuration on a side
+func (c *SRv6Conf) routesOf(side string) []*Route {
+	var routes []*Route
+	for _, r := range c.routes {
+		if r.Side == side {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// containerIPs returns the addresses of the container interface in the
+// previous result
+func containerIPs(result *current.Result, ifName string) []net.IP {
+	var ips []net.IP
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil {
+			continue
+		}
+		idx := *ipc.Interface
+		if idx >= 0 && idx < len(result.Interfaces) && result.Interfaces[idx].Name == ifName &&
+			result.Interfaces[idx].Sandbox != "" {
+			ips = append(ips, ipc.Address.IP)
+		}
+	}
+	return ips
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	if routes := conf.routesOf(sideContainer); len(routes) > 0 {
+		err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+			return addContainerRoutes(args.IfName, routes)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if routes := conf.routesOf(sideHost); len(routes) > 0 {
+		ips := containerIPs(result, args.IfName)
+		if len(ips) == 0 {
+			return fmt.Errorf("no address of %s found in prevResult for the host side routes", args.IfName)
+		}
+		veth, err := hostInterface(result)
+		if err != nil {
+			return err
+		}
+		if err := addHostRoutes(veth, ips, routes, conf.RulePriority); err != nil {
+			return err
+		}
+	}
+
+	return types.PrintResult(conf.PrevResult, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	// The routes in the container go with its interface, but the rules on
+	// the host outlive the host veth
+	if result != nil {
+		if ips := containerIPs(result, args.IfName); len(ips) > 0 {
+			if err := delHostRoutes(ips, conf.RulePriority); err != nil {
+				return err
+			}
+		}
+	}
+
+	if args.Netns == "" {
+		return nil
+	}
+	if routes := conf.routesOf(sideContainer); len(routes) > 0 {
+		err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+			return delContainerRoutes(args.IfName, routes)
+		})
+		if err != nil {
+			if _, ok := err.(ns.NSPathNotExistErr); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	if routes := conf.routesOf(sideContainer); len(routes) > 0 {
+		err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+			return checkContainerRoutes(args.IfName, routes)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if routes := conf.routesOf(sideHost); len(routes) > 0 {
+		return checkHostRoutes(containerIPs(result, args.IfName), routes, conf.RulePriority)
+	}
+	return nil
+}
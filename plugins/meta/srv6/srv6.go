@@ -0,0 +1,276 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+// firstTableID is the first table considered for the host side routes of
+// a container
+const firstTableID = 100
+
+func (r *Route) encap() *netlink.SEG6Encap {
+	return &netlink.SEG6Encap{Mode: r.mode, Segments: r.segments}
+}
+
+// netlinkRoute is the seg6 encap route of r through the link in the table.
+// The packets are routed again after the encapsulation, towards the first
+// segment, so the link only matters to select the route.
+func (r *Route) netlinkRoute(linkIndex, table int) *netlink.Route {
+	return &netlink.Route{
+		LinkIndex: linkIndex,
+		Dst:       r.dst,
+		Encap:     r.encap(),
+		Table:     table,
+	}
+}
+
+func addContainerRoutes(ifName string, routes []*Route) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	for _, r := range routes {
+		if err := netlink.RouteAdd(r.netlinkRoute(link.Attrs().Index, 0)); err != nil {
+			return fmt.Errorf("failed to add SRv6 route to %s via %s: %v", r.Dst, link.Attrs().Name, err)
+		}
+	}
+	return nil
+}
+
+func delContainerRoutes(ifName string, routes []*Route) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	for _, r := range routes {
+		err := netlink.RouteDel(r.netlinkRoute(link.Attrs().Index, 0))
+		if err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("failed to delete SRv6 route to %s: %v", r.Dst, err)
+		}
+	}
+	return nil
+}
+
+func checkContainerRoutes(ifName string, routes []*Route) error {
+	link, err := netlinksafe.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
+	}
+	for _, r := range routes {
+		route := r.netlinkRoute(link.Attrs().Index, unix.RT_TABLE_MAIN)
+		if err := checkRoute(route, netlink.RT_FILTER_OIF); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRoute verifies the route to the dst is installed in its table with
+// its encapsulation, and matches the other fields of the filter
+func checkRoute(route *netlink.Route, filterMask uint64) error {
+	found, err := netlinksafe.RouteListFiltered(netlink.FAMILY_ALL, route,
+		netlink.RT_FILTER_DST|netlink.RT_FILTER_TABLE|filterMask)
+	if err != nil {
+		return fmt.Errorf("failed to list routes: %v", err)
+	}
+	for _, f := range found {
+		if route.Encap.Equal(f.Encap) {
+			return nil
+		}
+	}
+	return fmt.Errorf("SRv6 route to %s with %s not found in table %d", route.Dst, route.Encap, route.Table)
+}
+
+// hostInterface returns the host interface of the container in the
+// previous result
+func hostInterface(result *current.Result) (netlink.Link, error) {
+	for _, intf := range result.Interfaces {
+		if intf.Sandbox != "" {
+			continue
+		}
+		link, err := netlinksafe.LinkByName(intf.Name)
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				continue
+			}
+			return nil, fmt.Errorf("failed to lookup %q: %v", intf.Name, err)
+		}
+		return link, nil
+	}
+	return nil, fmt.Errorf("no host interface found in prevResult for the host side routes")
+}
+
+// allRoutes lists the routes of all the tables
+func allRoutes() ([]netlink.Route, error) {
+	return netlinksafe.RouteListFiltered(netlink.FAMILY_ALL,
+		&netlink.Route{Table: unix.RT_TABLE_UNSPEC}, netlink.RT_FILTER_TABLE)
+}
+
+// nextTableID picks the first table from candidateID without rules or
+// routes
+func nextTableID(rules []netlink.Rule, routes []netlink.Route, candidateID int) int {
+	used := make(map[int]bool)
+	for _, rule := range rules {
+		used[rule.Table] = true
+	}
+	for _, route := range routes {
+		used[route.Table] = true
+	}
+	table := candidateID
+	for used[table] {
+		table++
+	}
+	return table
+}
+
+func sourceNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// containerRules returns the rules of the priority selecting the table of
+// the traffic from the addresses of a container
+func containerRules(ips []net.IP, priority int) ([]netlink.Rule, error) {
+	rules, err := netlinksafe.RuleList(netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+	var found []netlink.Rule
+	for _, rule := range rules {
+		if rule.Priority != priority || rule.Src == nil {
+			continue
+		}
+		for _, ip := range ips {
+			if rule.Src.IP.Equal(ip) {
+				found = append(found, rule)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// addHostRoutes installs the routes in a table of the container, selected
+// by the rules of its addresses
+func addHostRoutes(link netlink.Link, ips []net.IP, routes []*Route, priority int) (err error) {
+	rules, err := netlinksafe.RuleList(netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v", err)
+	}
+	existing, err := allRoutes()
+	if err != nil {
+		return fmt.Errorf("failed to list routes: %v", err)
+	}
+	table := nextTableID(rules, existing, firstTableID)
+
+	var added []*netlink.Route
+	var addedRules []*netlink.Rule
+	defer func() {
+		if err != nil {
+			for _, rule := range addedRules {
+				_ = netlink.RuleDel(rule)
+			}
+			for _, route := range added {
+				_ = netlink.RouteDel(route)
+			}
+		}
+	}()
+
+	for _, r := range routes {
+		route := r.netlinkRoute(link.Attrs().Index, table)
+		if err = netlink.RouteAdd(route); err != nil {
+			return fmt.Errorf("failed to add SRv6 route to %s in table %d: %v", r.Dst, table, err)
+		}
+		added = append(added, route)
+	}
+	for _, ip := range ips {
+		rule := netlink.NewRule()
+		rule.Src = sourceNet(ip)
+		rule.Table = table
+		rule.Priority = priority
+		if err = netlink.RuleAdd(rule); err != nil {
+			return fmt.Errorf("failed to add rule from %s to table %d: %v", ip, table, err)
+		}
+		addedRules = append(addedRules, rule)
+	}
+	return nil
+}
+
+// delHostRoutes deletes the rules of the addresses of the container and
+// the routes of their table
+func delHostRoutes(ips []net.IP, priority int) error {
+	rules, err := containerRules(ips, priority)
+	if err != nil {
+		return err
+	}
+	tables := make(map[int]bool)
+	for _, rule := range rules {
+		if err := netlink.RuleDel(&rule); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return fmt.Errorf("failed to delete rule %v: %v", rule, err)
+		}
+		tables[rule.Table] = true
+	}
+	for table := range tables {
+		routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_ALL,
+			&netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return fmt.Errorf("failed to list routes of table %d: %v", table, err)
+		}
+		for _, route := range routes {
+			if err := netlink.RouteDel(&route); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return fmt.Errorf("failed to delete route %s: %v", route, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkHostRoutes(ips []net.IP, routes []*Route, priority int) error {
+	rules, err := containerRules(ips, priority)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 || len(rules) != len(ips) {
+		return fmt.Errorf("found %d rules for the %d addresses of the container", len(rules), len(ips))
+	}
+	table := rules[0].Table
+	for _, rule := range rules[1:] {
+		if rule.Table != table {
+			return fmt.Errorf("the rules of the container select tables %d and %d", table, rule.Table)
+		}
+	}
+	for _, r := range routes {
+		if err := checkRoute(r.netlinkRoute(0, table), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
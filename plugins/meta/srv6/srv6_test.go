@@ -0,0 +1,276 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+func srv6Conf(netns, extra string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"cniVersion": "1.0.0",
+		"name": "srv6-test",
+		"type": "srv6",
+		%s
+		"prevResult": {
+			"cniVersion": "1.0.0",
+			"interfaces": [
+				{"name": "hostveth0"},
+				{"name": "eth0", "sandbox": %q}
+			],
+			"ips": [
+				{"interface": 1, "address": "10.1.2.3/24"},
+				{"interface": 1, "address": "2001:db8:1::3/64"}
+			]
+		}
+	}`, extra, netns))
+}
+
+var _ = Describe("srv6 configuration", func() {
+	It("defaults to encapsulating in the container", func() {
+		conf, result, err := parseConf(srv6Conf("/var/run/netns/test", `
+			"routes": [{"dst": "2001:db8:100::/48", "segments": ["fc00:1::1", "fc00:2::1"]}],`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(BeNil())
+		Expect(conf.RulePriority).To(Equal(defaultRulePriority))
+		Expect(conf.routesOf(sideHost)).To(BeEmpty())
+
+		routes := conf.routesOf(sideContainer)
+		Expect(routes).To(HaveLen(1))
+		Expect(routes[0].mode).To(Equal(nl.SEG6_IPTUN_MODE_ENCAP))
+		Expect(routes[0].segments).To(Equal([]net.IP{net.ParseIP("fc00:1::1"), net.ParseIP("fc00:2::1")}))
+	})
+
+	It("adds the routes of runtimeConfig", func() {
+		conf, _, err := parseConf(srv6Conf("/var/run/netns/test", `
+			"routes": [{"dst": "2001:db8:100::/48", "segments": ["fc00:1::1"]}],
+			"runtimeConfig": {"srv6Routes": [{"dst": "10.100.0.0/16", "segments": ["fc00:3::1"], "side": "host"}]},`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conf.routesOf(sideContainer)).To(HaveLen(1))
+		Expect(conf.routesOf(sideHost)).To(HaveLen(1))
+	})
+
+	It("finds the addresses of the container interface", func() {
+		_, result, err := parseConf(srv6Conf("/var/run/netns/test", ""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containerIPs(result, "eth0")).To(HaveLen(2))
+		Expect(containerIPs(result, "eth1")).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid routes",
+		func(route, msg string) {
+			_, _, err := parseConf(srv6Conf("/var/run/netns/test", fmt.Sprintf(`"routes": [%s],`, route)))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("with an invalid dst", `{"dst": "2001:db8::", "segments": ["fc00::1"]}`, `invalid route dst "2001:db8::"`),
+		Entry("without segments", `{"dst": "2001:db8::/64"}`, "route to 2001:db8::/64 has no segments"),
+		Entry("with an IPv4 segment", `{"dst": "2001:db8::/64", "segments": ["192.0.2.1"]}`, `invalid segment "192.0.2.1"`),
+		Entry("inline to IPv4", `{"dst": "10.0.0.0/8", "segments": ["fc00::1"], "mode": "inline"}`, "inline mode requires an IPv6 dst"),
+		Entry("with an unknown mode", `{"dst": "2001:db8::/64", "segments": ["fc00::1"], "mode": "l2encap"}`, `unknown mode "l2encap"`),
+		Entry("with an unknown side", `{"dst": "2001:db8::/64", "segments": ["fc00::1"], "side": "fabric"}`, `unknown side "fabric"`),
+	)
+})
+
+var _ = Describe("srv6 operations", func() {
+	var hostNS, containerNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		hostNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		containerNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = hostNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = "hostveth0"
+			veth := &netlink.Veth{LinkAttrs: linkAttrs, PeerName: "eth0"}
+			Expect(netlink.LinkAdd(veth)).To(Succeed())
+			Expect(netlink.LinkSetUp(veth)).To(Succeed())
+
+			peer, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetNsFd(peer, int(containerNS.Fd()))).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName("eth0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(hostNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(hostNS)).To(Succeed())
+		Expect(containerNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(containerNS)).To(Succeed())
+	})
+
+	It("installs the SRv6 routes in the container and on the host with ADD/CHECK/DEL", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData: srv6Conf(containerNS.Path(), `
+				"routes": [
+					{"dst": "2001:db8:100::/48", "segments": ["fc00:1::1", "fc00:2::1"]},
+					{"dst": "2001:db8:200::/48", "segments": ["fc00:1::1"], "mode": "inline"},
+					{"dst": "10.100.0.0/16", "segments": ["fc00:3::1"], "side": "host"}
+				],`),
+		}
+
+		err := hostNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			rules, err := containerRules([]net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("2001:db8:1::3")}, defaultRulePriority)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[0].Table).To(Equal(firstTableID))
+			Expect(rules[1].Table).To(Equal(firstTableID))
+
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V4,
+				&netlink.Route{Table: firstTableID}, netlink.RT_FILTER_TABLE)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Dst.String()).To(Equal("10.100.0.0/16"))
+			Expect(routes[0].Encap).To(Equal(&netlink.SEG6Encap{
+				Mode:     nl.SEG6_IPTUN_MODE_ENCAP,
+				Segments: []net.IP{net.ParseIP("fc00:3::1")},
+			}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, dst, _ := net.ParseCIDR("2001:db8:100::/48")
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V6,
+				&netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Encap).To(Equal(&netlink.SEG6Encap{
+				Mode:     nl.SEG6_IPTUN_MODE_ENCAP,
+				Segments: []net.IP{net.ParseIP("fc00:1::1"), net.ParseIP("fc00:2::1")},
+			}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = hostNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			Expect(testutils.CmdCheckWithArgs(args, func() error {
+				return cmdCheck(args)
+			})).To(Succeed())
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+
+			rules, err := containerRules([]net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("2001:db8:1::3")}, defaultRulePriority)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(BeEmpty())
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_ALL,
+				&netlink.Route{Table: firstTableID}, netlink.RT_FILTER_TABLE)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(BeEmpty())
+
+			// DEL is idempotent
+			return testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			routes, err := netlinksafe.RouteList(nil, netlink.FAMILY_V6)
+			Expect(err).NotTo(HaveOccurred())
+			for _, route := range routes {
+				Expect(route.Encap).To(BeNil())
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails CHECK when a route is missing", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       containerNS.Path(),
+			IfName:      "eth0",
+			StdinData: srv6Conf(containerNS.Path(), `
+				"routes": [{"dst": "2001:db8:100::/48", "segments": ["fc00:1::1"]}],`),
+		}
+
+		err := hostNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = containerNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			_, dst, _ := net.ParseCIDR("2001:db8:100::/48")
+			routes, err := netlinksafe.RouteListFiltered(netlink.FAMILY_V6,
+				&netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routes).To(HaveLen(1))
+			Expect(netlink.RouteDel(&routes[0])).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = hostNS.Do(func(ns.NetNS) error {
+			return testutils.CmdCheckWithArgs(args, func() error {
+				return cmdCheck(args)
+			})
+		})
+		Expect(err).To(MatchError(ContainSubstring("SRv6 route to 2001:db8:100::/48")))
+	})
+})
@@ -0,0 +1,98 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/plugins/pkg/attachments"
+	"github.com/containernetworking/plugins/pkg/macpool"
+)
+
+const (
+	// macPolicyStableHash derives the MAC from the container ID and the
+	// interface name, so that it is the same on each ADD
+	macPolicyStableHash = "stable-hash"
+	// macPolicyFromPool draws the MAC from the addresses of macPrefix,
+	// out of the MAC pools shared with the other plugins
+	macPolicyFromPool = "from-pool"
+)
+
+// validateMacPolicy verifies the MAC policy and parses its prefix
+func (conf *TuningConf) validateMacPolicy() error {
+	if conf.MacPrefix != "" {
+		var err error
+		if conf.macPrefix, err = macpool.ParsePrefix(conf.MacPrefix); err != nil {
+			return fmt.Errorf("invalid macPrefix: %v", err)
+		}
+	}
+	switch conf.MacPolicy {
+	case "", macPolicyStableHash:
+	case macPolicyFromPool:
+		if conf.macPrefix == nil {
+			return fmt.Errorf("macPolicy %s requires macPrefix", macPolicyFromPool)
+		}
+		conf.macPool = &macpool.Pool{Prefix: conf.MacPrefix, DataDir: conf.MacPoolDataDir}
+		if err := conf.macPool.Canonicalize(); err != nil {
+			return fmt.Errorf("invalid macPrefix: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid macPolicy %q, must be %s or %s", conf.MacPolicy, macPolicyStableHash, macPolicyFromPool)
+	}
+	return nil
+}
+
+// usesMacPolicy reports whether the MAC of the interface is set by the MAC
+// policy, which an explicit MAC overrides
+func (conf *TuningConf) usesMacPolicy() bool {
+	return conf.MacPolicy != "" && conf.Mac == ""
+}
+
+// stableMac derives the MAC of an attachment from its container ID and
+// interface name, following the prefix. Without a prefix the MAC is a
+// locally administered one.
+func stableMac(prefix []byte, containerID, ifName string) net.HardwareAddr {
+	sum := sha256.Sum256([]byte(attachments.ID(containerID, ifName)))
+	mac := make(net.HardwareAddr, 6)
+	copy(mac[len(prefix):], sum[:])
+	if len(prefix) == 0 {
+		mac[0] = mac[0]&^0x01 | 0x02
+	}
+	copy(mac, prefix)
+	return mac
+}
+
+// policyMac returns the MAC of the attachment under the MAC policy. A MAC
+// drawn from the pool is reserved if reserve is set, and is nil when not
+// reserved otherwise.
+func (conf *TuningConf) policyMac(containerID, ifName string, reserve bool) (net.HardwareAddr, error) {
+	if conf.MacPolicy == macPolicyStableHash {
+		return stableMac(conf.macPrefix, containerID, ifName), nil
+	}
+	if reserve {
+		return conf.macPool.Allocate(containerID, ifName)
+	}
+	return conf.macPool.Allocated(containerID, ifName)
+}
+
+// releaseMac releases the MAC of the attachment drawn from the pool
+func (conf *TuningConf) releaseMac(containerID, ifName string) error {
+	if conf.MacPolicy != macPolicyFromPool {
+		return nil
+	}
+	return conf.macPool.Release(containerID, ifName)
+}
@@ -29,6 +29,8 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/macpool"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
@@ -94,6 +96,15 @@ func createSysctlAllowFile(sysctls []string) error {
 	return nil
 }
 
+// configToRestore holds the interface attributes expected after DEL
+type configToRestore struct {
+	Mac      string
+	Promisc  *bool
+	Mtu      int
+	Allmulti *bool
+	TxQLen   *int
+}
+
 var _ = Describe("tuning plugin", func() {
 	var originalNS, targetNS ns.NetNS
 	const IFNAME string = "dummy0"
@@ -425,6 +436,80 @@ var _ = Describe("tuning plugin", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It(fmt.Sprintf("[%s] only tunes interfaces of the types in onlyIfType", ver), func() {
+			confFor := func(linkType string) []byte {
+				return []byte(fmt.Sprintf(`{
+					"name": "test",
+					"type": "iplink",
+					"cniVersion": "%s",
+					"mtu": 1454,
+					"onlyIfType": ["%s"],
+					"prevResult": {
+						"interfaces": [
+							{"name": "dummy0", "sandbox":"netns"}
+						],
+						"ips": [
+							{
+								"version": "4",
+								"address": "10.0.0.2/24",
+								"gateway": "10.0.0.1",
+								"interface": 0
+							}
+						]
+					}
+				}`, ver, linkType))
+			}
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       originalNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   confFor("veth"),
+			}
+
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				r, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				result, err := types100.GetResult(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Interfaces).To(HaveLen(1))
+
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Attrs().MTU).To(Equal(beforeConf.Mtu))
+
+				err = testutils.CmdDel(originalNS.Path(),
+					args.ContainerID, "", func() error { return cmdDel(args) })
+				Expect(err).NotTo(HaveOccurred())
+
+				args.StdinData = confFor("dummy")
+				_, _, err = testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err = netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Attrs().MTU).To(Equal(1454))
+
+				err = testutils.CmdDel(originalNS.Path(),
+					args.ContainerID, "", func() error { return cmdDel(args) })
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err = netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.Attrs().MTU).To(Equal(beforeConf.Mtu))
+
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It(fmt.Sprintf("[%s] configures and deconfigures mtu from args with ADD/DEL", ver), func() {
 			conf := []byte(fmt.Sprintf(`{
 				"name": "test",
@@ -557,6 +642,147 @@ var _ = Describe("tuning plugin", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It(fmt.Sprintf("[%s] configures and deconfigures pacing rate with ADD/DEL", ver), func() {
+			conf := []byte(fmt.Sprintf(`{
+				"name": "test",
+				"type": "iplink",
+				"cniVersion": "%s",
+				"pacingRate": 80000000,
+				"prevResult": {
+					"interfaces": [
+						{"name": "dummy0", "sandbox":"netns"}
+					],
+					"ips": [
+						{
+							"version": "4",
+							"address": "10.0.0.2/24",
+							"gateway": "10.0.0.1",
+							"interface": 0
+						}
+					]
+				}
+			}`, ver))
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       originalNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   conf,
+			}
+
+			rootFq := func() *netlink.Fq {
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				qdiscs, err := netlinksafe.QdiscList(link)
+				Expect(err).NotTo(HaveOccurred())
+				for _, q := range qdiscs {
+					if fq, ok := q.(*netlink.Fq); ok && fq.Parent == netlink.HANDLE_ROOT {
+						return fq
+					}
+				}
+				return nil
+			}
+
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				r, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				fq := rootFq()
+				Expect(fq).NotTo(BeNil())
+				Expect(fq.FlowMaxRate).To(Equal(uint32(10000000)))
+				Expect(ip.OwnsQdisc(fq)).To(BeTrue())
+
+				if testutils.SpecVersionHasCHECK(ver) {
+					n := &TuningConf{}
+					Expect(json.Unmarshal(conf, &n)).NotTo(HaveOccurred())
+
+					confString, err := buildOneConfig(ver, n, r)
+					Expect(err).NotTo(HaveOccurred())
+
+					args.StdinData = confString
+
+					Expect(testutils.CmdCheckWithArgs(args, func() error {
+						return cmdCheck(args)
+					})).NotTo(HaveOccurred())
+				}
+
+				err = testutils.CmdDel(originalNS.Path(),
+					args.ContainerID, "", func() error { return cmdDel(args) })
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(rootFq()).To(BeNil())
+
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It(fmt.Sprintf("[%s] refuses to replace a root qdisc installed by others with the pacing fq", ver), func() {
+			conf := []byte(fmt.Sprintf(`{
+				"name": "test",
+				"type": "iplink",
+				"cniVersion": "%s",
+				"pacingRate": 80000000,
+				"prevResult": {
+					"interfaces": [
+						{"name": "dummy0", "sandbox":"netns"}
+					],
+					"ips": [
+						{
+							"version": "4",
+							"address": "10.0.0.2/24",
+							"gateway": "10.0.0.1",
+							"interface": 0
+						}
+					]
+				}
+			}`, ver))
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       originalNS.Path(),
+				IfName:      IFNAME,
+				StdinData:   conf,
+			}
+
+			err := originalNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				link, err := netlinksafe.LinkByName(IFNAME)
+				Expect(err).NotTo(HaveOccurred())
+				foreign := netlink.NewFq(netlink.QdiscAttrs{
+					LinkIndex: link.Attrs().Index,
+					Handle:    netlink.MakeHandle(1, 0),
+					Parent:    netlink.HANDLE_ROOT,
+				})
+				Expect(netlink.QdiscAdd(foreign)).To(Succeed())
+
+				_, _, err = testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).To(MatchError(ContainSubstring("refusing to replace it")))
+
+				qdiscs, err := netlinksafe.QdiscList(link)
+				Expect(err).NotTo(HaveOccurred())
+				found := false
+				for _, q := range qdiscs {
+					if q.Attrs().Parent == netlink.HANDLE_ROOT {
+						Expect(q.Attrs().Handle).To(Equal(netlink.MakeHandle(1, 0)))
+						Expect(q.(*netlink.Fq).FlowMaxRate).NotTo(Equal(uint32(10000000)))
+						found = true
+					}
+				}
+				Expect(found).To(BeTrue())
+
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It(fmt.Sprintf("[%s] configures and deconfigures tx queue len from args with ADD/DEL", ver), func() {
 			conf := []byte(fmt.Sprintf(`{
 				"name": "test",
@@ -1355,3 +1581,314 @@ var _ = Describe("tuning plugin", func() {
 
 	}
 })
+
+var _ = Describe("tuning STATUS", func() {
+	It("reports the attachments pending restore", func() {
+		dataDir, err := os.MkdirTemp("", "tuning-status")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dataDir)
+
+		args := &skel.CmdArgs{
+			StdinData: []byte(fmt.Sprintf(`{
+				"cniVersion": "1.1.0",
+				"name": "test",
+				"type": "tuning",
+				"dataDir": %q
+			}`, dataDir)),
+		}
+		Expect(testutils.CmdStatus(func() error {
+			return cmdStatus(args)
+		})).To(Succeed())
+	})
+
+	It("fails when the data directory is unusable", func() {
+		dataDir, err := os.CreateTemp("", "tuning-status")
+		Expect(err).NotTo(HaveOccurred())
+		dataDir.Close()
+		defer os.Remove(dataDir.Name())
+
+		args := &skel.CmdArgs{
+			StdinData: []byte(fmt.Sprintf(`{
+				"cniVersion": "1.1.0",
+				"name": "test",
+				"type": "tuning",
+				"dataDir": %q
+			}`, dataDir.Name())),
+		}
+		err = testutils.CmdStatus(func() error {
+			return cmdStatus(args)
+		})
+		Expect(err).To(MatchError(ContainSubstring("is not a directory")))
+	})
+})
+
+var _ = Describe("tuning without prevResult", func() {
+	var targetNS ns.NetNS
+
+	BeforeEach(func() {
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+	})
+
+	AfterEach(func() {
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	newArgs := func(ver, conf string) *skel.CmdArgs {
+		return &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+				"name": "test",
+				"type": "tuning",
+				"cniVersion": "%s",
+				%s
+			}`, ver, conf)),
+		}
+	}
+
+	for _, ver := range testutils.AllSpecVersions {
+		ver := ver
+
+		if ver == "0.1.0" || ver == "0.2.0" {
+			It(fmt.Sprintf("[%s] cannot return an empty result", ver), func() {
+				args := newArgs(ver, `"requirePrevResult": false, "sysctl": {"net.ipv4.conf.all.log_martians": "1"}`)
+				_, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).To(MatchError("tuning without prevResult requires cniVersion 0.3.0 or later"))
+			})
+			continue
+		}
+
+		It(fmt.Sprintf("[%s] sets namespace-wide sysctls with requirePrevResult false", ver), func() {
+			args := newArgs(ver, `"requirePrevResult": false, "sysctl": {"net.ipv4.conf.all.log_martians": "1"}`)
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Version()).To(Equal(ver))
+
+			err = targetNS.Do(func(ns.NetNS) error {
+				value, err := os.ReadFile("/proc/sys/net/ipv4/conf/all/log_martians")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(value)).To(Equal("1\n"))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			if testutils.SpecVersionHasCHECK(ver) {
+				sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+				Expect(testutils.CmdCheckWithArgs(args, func() error {
+					return cmdCheck(args)
+				})).To(Succeed())
+			}
+
+			Expect(testutils.CmdDelWithArgs(args, func() error {
+				return cmdDel(args)
+			})).To(Succeed())
+		})
+	}
+
+	It("requires prevResult by default", func() {
+		args := newArgs("1.0.0", `"sysctl": {"net.ipv4.conf.all.log_martians": "1"}`)
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).To(MatchError("Required prevResult missing"))
+	})
+
+	It("rejects interface tuning without prevResult", func() {
+		for _, conf := range []string{
+			`"mtu": 1400`,
+			`"sysctl": {"net.ipv4.conf.IFNAME.log_martians": "1"}`,
+			`"onlyIfType": ["veth"]`,
+			`"macPolicy": "stable-hash"`,
+		} {
+			sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+			args := newArgs("1.0.0", `"requirePrevResult": false, `+conf)
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError("tuning without prevResult only sets namespace-wide sysctls"), conf)
+		}
+	})
+})
+
+var _ = Describe("tuning MAC policy", func() {
+	var targetNS ns.NetNS
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "tuning-macpolicy")
+		Expect(err).NotTo(HaveOccurred())
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			for _, name := range []string{"eth0", "net1"} {
+				linkAttrs := netlink.NewLinkAttrs()
+				linkAttrs.Name = name
+				if err := netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: name + "-peer"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	newArgs := func(ifName, conf string) *skel.CmdArgs {
+		return &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      ifName,
+			StdinData: []byte(fmt.Sprintf(`{
+				"name": "test",
+				"type": "tuning",
+				"cniVersion": "1.0.0",
+				"dataDir": %q,
+				"macPoolDataDir": %q,
+				%s,
+				"prevResult": {
+					"interfaces": [{"name": %q, "sandbox": %q}]
+				}
+			}`, dataDir, filepath.Join(dataDir, "macpool"), conf, ifName, targetNS.Path())),
+		}
+	}
+
+	linkMac := func(ifName string) string {
+		var mac string
+		err := targetNS.Do(func(ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(ifName)
+			if err != nil {
+				return err
+			}
+			mac = link.Attrs().HardwareAddr.String()
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return mac
+	}
+
+	add := func(args *skel.CmdArgs) *types100.Result {
+		r, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := types100.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	It("derives a stable MAC from the container ID and interface name", func() {
+		origMac := linkMac("eth0")
+		args := newArgs("eth0", `"macPolicy": "stable-hash", "macPrefix": "02:00:5e"`)
+		mac := stableMac([]byte{0x02, 0x00, 0x5e}, "dummy", "eth0").String()
+		Expect(mac).To(HavePrefix("02:00:5e:"))
+		Expect(stableMac([]byte{0x02, 0x00, 0x5e}, "dummy", "net1").String()).NotTo(Equal(mac))
+
+		result := add(args)
+		Expect(result.Interfaces[0].Mac).To(Equal(mac))
+		Expect(linkMac("eth0")).To(Equal(mac))
+
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		Expect(testutils.CmdCheckWithArgs(args, func() error { return cmdCheck(args) })).To(Succeed())
+
+		Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+		Expect(linkMac("eth0")).To(Equal(origMac))
+	})
+
+	It("derives a locally administered MAC without prefix", func() {
+		mac := stableMac(nil, "dummy", "eth0")
+		Expect(mac[0] & 0x01).To(BeZero())
+		Expect(mac[0] & 0x02).NotTo(BeZero())
+	})
+
+	It("draws the MACs from the pool and releases them", func() {
+		conf := `"macPolicy": "from-pool", "macPrefix": "02:00:5e:10:00"`
+		eth0Args := newArgs("eth0", conf)
+		net1Args := newArgs("net1", conf)
+
+		eth0Mac := add(eth0Args).Interfaces[0].Mac
+		Expect(eth0Mac).To(HavePrefix("02:00:5e:10:00:"))
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		net1Mac := add(net1Args).Interfaces[0].Mac
+		Expect(net1Mac).To(HavePrefix("02:00:5e:10:00:"))
+		Expect(net1Mac).NotTo(Equal(eth0Mac))
+		Expect(linkMac("net1")).To(Equal(net1Mac))
+
+		// ADD again keeps the reservation
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		Expect(add(eth0Args).Interfaces[0].Mac).To(Equal(eth0Mac))
+
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		Expect(testutils.CmdCheckWithArgs(net1Args, func() error { return cmdCheck(net1Args) })).To(Succeed())
+
+		// The MACs are kept in the shared pool, out of the tuning data
+		// directory
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		Expect(testutils.CmdDelWithArgs(eth0Args, func() error { return cmdDel(eth0Args) })).To(Succeed())
+		Expect(filepath.Join(dataDir, "macpool", "macs", eth0Mac)).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(dataDir, "macpool", "macs", net1Mac)).To(BeAnExistingFile())
+
+		// CHECK fails once the reservation is gone
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		err := testutils.CmdCheckWithArgs(eth0Args, func() error { return cmdCheck(eth0Args) })
+		Expect(err).To(MatchError(ContainSubstring("no MAC reserved for eth0")))
+	})
+
+	It("does not hand out the MACs of the macvlan pools", func() {
+		pool := &macpool.Pool{
+			Prefix:  "02:00:5e:10:00",
+			DataDir: filepath.Join(dataDir, "macpool"),
+		}
+		Expect(pool.Canonicalize()).To(Succeed())
+		for i := 0; i < 255; i++ {
+			_, err := pool.Allocate(fmt.Sprintf("container%d", i), "eth0")
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		args := newArgs("eth0", `"macPolicy": "from-pool", "macPrefix": "02:00:5e:10:00"`)
+		mac := add(args).Interfaces[0].Mac
+		allocated, err := pool.Allocated("dummy", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allocated.String()).To(Equal(mac))
+
+		sysctlDuplicatesMap = map[sysctlKey]interface{}{}
+		other := newArgs("net1", `"macPolicy": "from-pool", "macPrefix": "02:00:5e:10:00"`)
+		_, _, err = testutils.CmdAddWithArgs(other, func() error { return cmdAdd(other) })
+		Expect(err).To(MatchError("no MAC address left in pool 02:00:5e:10:00"))
+	})
+
+	It("prefers an explicit MAC", func() {
+		args := newArgs("eth0", `"macPolicy": "from-pool", "macPrefix": "02:00:5e", "mac": "c2:11:22:33:44:55"`)
+		Expect(add(args).Interfaces[0].Mac).To(Equal("c2:11:22:33:44:55"))
+		Expect(filepath.Join(dataDir, "macpool")).NotTo(BeADirectory())
+	})
+
+	DescribeTable("rejects invalid MAC policies",
+		func(conf, msg string) {
+			_, err := parseConf([]byte(fmt.Sprintf(`{"name": "test", "type": "tuning", %s}`, conf)), "")
+			Expect(err).To(MatchError(msg))
+		},
+		Entry("with an unknown policy", `"macPolicy": "random"`, `invalid macPolicy "random", must be stable-hash or from-pool`),
+		Entry("with a pool without prefix", `"macPolicy": "from-pool"`, "macPolicy from-pool requires macPrefix"),
+		Entry("with an invalid prefix", `"macPolicy": "stable-hash", "macPrefix": "02:0g"`, `invalid macPrefix: invalid MAC prefix "02:0g"`),
+		Entry("with a multicast prefix", `"macPolicy": "stable-hash", "macPrefix": "01:00:5e"`, `invalid macPrefix: MAC prefix "01:00:5e" is multicast`),
+		Entry("with a prefix too long", `"macPolicy": "from-pool", "macPrefix": "02:00:00:00:00:00"`, `invalid macPrefix: MAC prefix "02:00:00:00:00:00" is longer than 5 bytes`),
+	)
+})
@@ -0,0 +1,175 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+)
+
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+
+	// mainTableRulePriority puts the rules sending a family back to the
+	// main table right before the l3mdev rule, which the kernel adds at
+	// 1000 with the first VRF
+	mainTableRulePriority = 999
+)
+
+func validateFamilies(families []string) error {
+	for _, f := range families {
+		if f != familyIPv4 && f != familyIPv6 {
+			return fmt.Errorf("invalid family %q, must be %q or %q", f, familyIPv4, familyIPv6)
+		}
+	}
+	return nil
+}
+
+// mainTableFamilies returns the netlink families which are not moved into
+// the VRF and keep using the main table. All the families are moved when
+// none is selected.
+func mainTableFamilies(families []string) []int {
+	if len(families) == 0 {
+		return nil
+	}
+	selected := map[string]bool{}
+	for _, f := range families {
+		selected[f] = true
+	}
+	var res []int
+	if !selected[familyIPv4] {
+		res = append(res, netlink.FAMILY_V4)
+	}
+	if !selected[familyIPv6] {
+		res = append(res, netlink.FAMILY_V6)
+	}
+	return res
+}
+
+// mainTableRules returns the rules looking the traffic of the family in
+// and out of the VRF up in the main table
+func mainTableRules(vrfName string, family int) []*netlink.Rule {
+	iif := netlink.NewRule()
+	iif.Family = family
+	iif.Priority = mainTableRulePriority
+	iif.Table = unix.RT_TABLE_MAIN
+	iif.IifName = vrfName
+
+	oif := netlink.NewRule()
+	oif.Family = family
+	oif.Priority = mainTableRulePriority
+	oif.Table = unix.RT_TABLE_MAIN
+	oif.OifName = vrfName
+
+	return []*netlink.Rule{iif, oif}
+}
+
+func hasRule(rules []netlink.Rule, rule *netlink.Rule) bool {
+	for _, r := range rules {
+		if r.Priority == rule.Priority && r.Table == rule.Table && r.IifName == rule.IifName && r.OifName == rule.OifName {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureMainTableRules adds the rules sending the families back to the
+// main table. They apply to the whole VRF, not only to the interface.
+func ensureMainTableRules(vrfName string, families []int) error {
+	for _, family := range families {
+		existing, err := netlinksafe.RuleList(family)
+		if err != nil {
+			return fmt.Errorf("failed to list rules: %v", err)
+		}
+		for _, rule := range mainTableRules(vrfName, family) {
+			if hasRule(existing, rule) {
+				continue
+			}
+			if err := netlink.RuleAdd(rule); err != nil {
+				return fmt.Errorf("could not add rule %s: %v", rule, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkMainTableRules(vrfName string, families []int) error {
+	for _, family := range families {
+		existing, err := netlinksafe.RuleList(family)
+		if err != nil {
+			return fmt.Errorf("failed to list rules: %v", err)
+		}
+		for _, rule := range mainTableRules(vrfName, family) {
+			if !hasRule(existing, rule) {
+				return fmt.Errorf("rule %s not found", rule)
+			}
+		}
+	}
+	return nil
+}
+
+// deleteMainTableRules deletes the rules of the VRF of both families, which
+// outlive the VRF as they refer to it by name
+func deleteMainTableRules(vrfName string) error {
+	var errs []error
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		existing, err := netlinksafe.RuleList(family)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list rules: %v", err))
+			continue
+		}
+		for _, rule := range mainTableRules(vrfName, family) {
+			if !hasRule(existing, rule) {
+				continue
+			}
+			if err := netlink.RuleDel(rule); err != nil {
+				errs = append(errs, fmt.Errorf("could not delete rule %s: %v", rule, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyRoutesToMain copies the routes of the interface of the family, which
+// the kernel moved to the VRF table with its addresses, back to the local
+// and main tables
+func copyRoutesToMain(vrf *netlink.Vrf, link netlink.Link, family int) error {
+	routes, err := netlinksafe.RouteListFiltered(family, &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Table:     int(vrf.Table),
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return fmt.Errorf("failed getting routes for %s table %d: %v", link.Attrs().Name, vrf.Table, err)
+	}
+	for _, route := range routes {
+		r := route
+		switch r.Type {
+		case unix.RTN_LOCAL, unix.RTN_BROADCAST, unix.RTN_ANYCAST:
+			r.Table = unix.RT_TABLE_LOCAL
+		default:
+			r.Table = unix.RT_TABLE_MAIN
+		}
+		if err := netlink.RouteReplace(&r); err != nil {
+			return fmt.Errorf("could not add route '%s': %v", r, err)
+		}
+	}
+	return nil
+}
@@ -36,6 +36,15 @@ type VRFNetConf struct {
 	VRFName string `json:"vrfname"`
 	// Table is the optional name of the routing table set for the vrf
 	Table uint32 `json:"table"`
+
+	// Families restricts the VRF to the routes and addresses of the given
+	// families, "ipv4" or "ipv6". The others keep using the main table.
+	Families []string `json:"families,omitempty"`
+
+	// ReportVRF adds the VRF to the interfaces of the result, and sets the
+	// table of the routes of the result moved into it, so that the plugins
+	// chained after vrf find the association in their prevResult.
+	ReportVRF bool `json:"reportVRF,omitempty"`
 }
 
 func main() {
@@ -59,6 +68,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 
 	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		if err := validateChainOrder(result, args.IfName); err != nil {
+			return err
+		}
+
 		vrf, err := findVRF(conf.VRFName)
 
 		// If the user set a tableid and the vrf is already in the namespace
@@ -75,10 +88,16 @@ func cmdAdd(args *skel.CmdArgs) error {
 			return err
 		}
 
-		err = addInterface(vrf, args.IfName)
+		err = addInterface(vrf, args.IfName, mainTableFamilies(conf.Families))
 		if err != nil {
 			return err
 		}
+		if err := ensureMainTableRules(conf.VRFName, mainTableFamilies(conf.Families)); err != nil {
+			return err
+		}
+		if conf.ReportVRF {
+			return reportVRF(result, vrf, args.IfName, args.Netns)
+		}
 		return nil
 	})
 	if err != nil {
@@ -123,6 +142,7 @@ func cmdDel(args *skel.CmdArgs) error {
 			if err != nil {
 				return err
 			}
+			return deleteMainTableRules(conf.VRFName)
 		}
 		return nil
 	})
@@ -174,7 +194,7 @@ func cmdCheck(args *skel.CmdArgs) error {
 		if !found {
 			return fmt.Errorf("failed to find %s associated to vrf %s", args.IfName, conf.VRFName)
 		}
-		return nil
+		return checkMainTableRules(conf.VRFName, mainTableFamilies(conf.Families))
 	})
 	if err != nil {
 		return err
@@ -193,6 +213,10 @@ func parseConf(data []byte) (*VRFNetConf, *current.Result, error) {
 		return nil, nil, fmt.Errorf("configuration is expected to have a valid vrf name")
 	}
 
+	if err := validateFamilies(conf.Families); err != nil {
+		return nil, nil, err
+	}
+
 	if conf.RawPrevResult == nil {
 		// return early if there was no previous result, which is allowed for DEL calls
 		return &conf, &current.Result{}, nil
@@ -18,10 +18,14 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"slices"
 	"time"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 )
 
@@ -86,8 +90,9 @@ func assignedInterfaces(vrf *netlink.Vrf) ([]netlink.Link, error) {
 	return res, nil
 }
 
-// addInterface adds the given interface to the VRF
-func addInterface(vrf *netlink.Vrf, intf string) error {
+// addInterface adds the given interface to the VRF. The routes of the
+// mainFamilies are left in the main table.
+func addInterface(vrf *netlink.Vrf, intf string, mainFamilies []int) error {
 	i, err := netlinksafe.LinkByName(intf)
 	if err != nil {
 		return fmt.Errorf("could not get link by name %s", intf)
@@ -192,8 +197,10 @@ CONTINUE:
 	// Apply all saved routes for the interface that was moved to the VRF
 	for _, route := range globalRoutes {
 		r := route
-		// Modify original table to vrf one,
-		r.Table = int(vrf.Table)
+		if !slices.Contains(mainFamilies, route.Family) {
+			// Modify original table to vrf one,
+			r.Table = int(vrf.Table)
+		}
 		// equivalent of 'ip route replace <address> table <int>'.
 		err = netlink.RouteReplace(&r)
 		if err != nil {
@@ -201,9 +208,147 @@ CONTINUE:
 		}
 	}
 
+	for _, family := range mainFamilies {
+		if err := copyRoutesToMain(vrf, i, family); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateChainOrder detects the state left by plugins that must not run
+// before vrf, so that misordered chains fail with an actionable error
+// rather than deep in the routing setup. Attachments without addresses of
+// the interface in prevResult, e.g. L2 only ones, are not checked.
+func validateChainOrder(result *current.Result, intf string) error {
+	ifIndex := -1
+	for i, iface := range result.Interfaces {
+		if iface.Name == intf {
+			ifIndex = i
+			break
+		}
+	}
+	var ips []net.IP
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil || *ipc.Interface == ifIndex {
+			ips = append(ips, ipc.Address.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	link, err := netlinksafe.LinkByName(intf)
+	if err != nil {
+		return fmt.Errorf("interface %s not found: vrf must be chained after the plugin creating it: %v", intf, err)
+	}
+
+	// sbr moves the routes of the interface into a per-interface table
+	// selected by source rules. Those rules take precedence over the VRF
+	// and the routes would not be carried over, so sbr must come after vrf.
+	rules, err := netlinksafe.RuleList(netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v", err)
+	}
+	for _, ip := range ips {
+		for _, rule := range rules {
+			if rule.Src == nil || !rule.Src.IP.Equal(ip) {
+				continue
+			}
+			if ones, bits := rule.Src.Mask.Size(); ones != bits {
+				continue
+			}
+			switch rule.Table {
+			case unix.RT_TABLE_MAIN, unix.RT_TABLE_LOCAL, unix.RT_TABLE_DEFAULT:
+				continue
+			}
+			routes, err := netlinksafe.RouteListFiltered(
+				netlink.FAMILY_ALL,
+				&netlink.Route{Table: rule.Table, LinkIndex: link.Attrs().Index},
+				netlink.RT_FILTER_TABLE|netlink.RT_FILTER_OIF,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to list routes of table %d: %v", rule.Table, err)
+			}
+			if len(routes) == 0 {
+				// Not the table of the interface
+				continue
+			}
+			return fmt.Errorf("found source based routing rule for %s of %s (table %d): vrf must be placed before sbr in the plugin chain",
+				ip, link.Attrs().Name, rule.Table)
+		}
+	}
+	return nil
+}
+
+// reportVRF records the association of the interface with the VRF in the
+// result: the VRF device joins its interfaces, and the routes of the result
+// the kernel has in the VRF table for the interface get that table.
+func reportVRF(result *current.Result, vrf *netlink.Vrf, intf, netns string) error {
+	link, err := netlinksafe.LinkByName(intf)
+	if err != nil {
+		return fmt.Errorf("could not get link by name %s", intf)
+	}
+	routes, err := netlinksafe.RouteListFiltered(
+		netlink.FAMILY_ALL,
+		&netlink.Route{
+			Table:     int(vrf.Table),
+			LinkIndex: link.Attrs().Index,
+		},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE,
+	)
+	if err != nil {
+		return fmt.Errorf("failed getting routes for %s table %d: %v", intf, vrf.Table, err)
+	}
+	setRoutesTable(result.Routes, routes, int(vrf.Table))
+
+	for _, iface := range result.Interfaces {
+		if iface.Name == vrf.Name && iface.Sandbox == netns {
+			return nil
+		}
+	}
+	// The VRF may have just been created, without its address
+	vrfLink, err := netlinksafe.LinkByName(vrf.Name)
+	if err != nil {
+		return fmt.Errorf("could not get link by name %s", vrf.Name)
+	}
+	result.Interfaces = append(result.Interfaces, &current.Interface{
+		Name:    vrf.Name,
+		Mac:     vrfLink.Attrs().HardwareAddr.String(),
+		Sandbox: netns,
+	})
 	return nil
 }
 
+// setRoutesTable sets the table of the routes of the result which are among
+// the routes of the table
+func setRoutesTable(resultRoutes []*types.Route, tableRoutes []netlink.Route, table int) {
+	for _, r := range resultRoutes {
+		if r.Table != nil {
+			continue
+		}
+		for _, tr := range tableRoutes {
+			if routeDst(tr).String() == r.Dst.String() && (r.GW == nil || r.GW.Equal(tr.Gw)) {
+				t := table
+				r.Table = &t
+				break
+			}
+		}
+	}
+}
+
+// routeDst returns the destination of the route, the default one if unset
+func routeDst(r netlink.Route) *net.IPNet {
+	if r.Dst != nil {
+		return r.Dst
+	}
+	if r.Family == netlink.FAMILY_V6 {
+		return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+	return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+}
+
 func findFreeRoutingTableID(links []netlink.Link) (uint32, error) {
 	takenTables := make(map[uint32]struct{}, len(links))
 	for _, l := range links {
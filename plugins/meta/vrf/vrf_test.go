@@ -153,6 +153,72 @@ var _ = Describe("vrf plugin", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("reports the VRF to the plugins chained after it", func() {
+		conf := configWithRouteFor("test", IF0Name, VRF0Name, "10.0.0.2/24", "10.10.10.0/24")
+		confMap := map[string]interface{}{}
+		Expect(json.Unmarshal(conf, &confMap)).To(Succeed())
+		confMap["reportVRF"] = true
+		conf, err := json.Marshal(confMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IF0Name,
+			StdinData:   conf,
+		}
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			link, err := netlinksafe.LinkByName(IF0Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			addr, err := netlink.ParseAddr("10.0.0.2/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.AddrAdd(link, addr)).To(Succeed())
+			_, dst, err := net.ParseCIDR("10.10.10.0/24")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.RouteAdd(&netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       dst,
+				Gw:        net.ParseIP("10.0.0.1"),
+			})).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := current.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces).To(HaveLen(2))
+			Expect(result.Interfaces[1].Name).To(Equal(VRF0Name))
+			Expect(result.Interfaces[1].Sandbox).To(Equal(targetNS.Path()))
+			Expect(result.Interfaces[1].Mac).NotTo(BeEmpty())
+			Expect(result.Routes).To(HaveLen(1))
+			Expect(result.Routes[0].Table).NotTo(BeNil())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			vrf, err := findVRF(VRF0Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vrf.Table).NotTo(BeZero())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
 	It("configures a VRF and adds the interface to it", func() {
 		conf := configFor("test", IF0Name, VRF0Name, "10.0.0.2/24")
 
@@ -181,6 +247,70 @@ var _ = Describe("vrf plugin", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("fails with an actionable error when chained after sbr", func() {
+		conf := configFor("test", IF0Name, VRF0Name, "10.0.0.2/24")
+
+		err := targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			rule := netlink.NewRule()
+			rule.Table = 100
+			rule.Src = &net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(32, 32)}
+			Expect(netlink.RuleAdd(rule)).To(Succeed())
+
+			// sbr moved the routes of the interface into the table
+			link, err := netlinksafe.LinkByName(IF0Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			Expect(netlink.RouteAdd(&netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)},
+				Scope:     netlink.SCOPE_LINK,
+				Table:     100,
+			})).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IF0Name,
+			StdinData:   conf,
+		}
+
+		err = originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(ContainSubstring("vrf must be placed before sbr")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails with an actionable error when the interface does not exist yet", func() {
+		conf := configFor("test", "missing0", VRF0Name, "10.0.0.2/24")
+
+		args := &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      "missing0",
+			StdinData:   conf,
+		}
+
+		err := originalNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(MatchError(ContainSubstring("vrf must be chained after the plugin creating it")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
 	It("adds the interface and custom routing to new VRF", func() {
 		conf := configWithRouteFor("test", IF0Name, VRF0Name, "10.0.0.2/24", "10.10.10.0/24")
 
@@ -900,6 +1030,90 @@ var _ = Describe("vrf plugin", func() {
 })
 
 var _ = Describe("unit tests", func() {
+	It("sets the table of the routes of the result moved into the VRF", func() {
+		routes := []*types.Route{}
+		for _, dst := range []string{"0.0.0.0/0", "192.168.0.0/16", "10.1.0.0/16", "2001:db8::/32"} {
+			_, ipn, err := net.ParseCIDR(dst)
+			Expect(err).NotTo(HaveOccurred())
+			routes = append(routes, &types.Route{Dst: *ipn})
+		}
+		routes[1].GW = net.ParseIP("10.0.0.1")
+		routes[2].GW = net.ParseIP("10.0.0.254")
+		mainTable := 254
+		routes[3].Table = &mainTable
+
+		_, dst, err := net.ParseCIDR("192.168.0.0/16")
+		Expect(err).NotTo(HaveOccurred())
+		_, dst6, err := net.ParseCIDR("2001:db8::/32")
+		Expect(err).NotTo(HaveOccurred())
+		_, other, err := net.ParseCIDR("10.1.0.0/16")
+		Expect(err).NotTo(HaveOccurred())
+		setRoutesTable(routes, []netlink.Route{
+			{Family: netlink.FAMILY_V4, Gw: net.ParseIP("10.0.0.1")},
+			{Family: netlink.FAMILY_V4, Dst: dst, Gw: net.ParseIP("10.0.0.1")},
+			{Family: netlink.FAMILY_V4, Dst: other, Gw: net.ParseIP("10.0.0.1")},
+			{Family: netlink.FAMILY_V6, Dst: dst6},
+		}, 100)
+
+		Expect(routes[0].Table).To(HaveValue(Equal(100)))
+		Expect(routes[1].Table).To(HaveValue(Equal(100)))
+		// Another gateway, so another route
+		Expect(routes[2].Table).To(BeNil())
+		// Already in another table
+		Expect(routes[3].Table).To(HaveValue(Equal(254)))
+	})
+
+	It("validates the chain order of attachments with addresses only", func() {
+		testNS, err := testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(testNS.Close()).To(Succeed())
+			Expect(testutils.UnmountNS(testNS)).To(Succeed())
+		}()
+
+		result := &current.Result{
+			Interfaces: []*current.Interface{{Name: "eth0"}, {Name: "net1", Sandbox: testNS.Path()}},
+			IPs: []*current.IPConfig{{
+				Address:   net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(24, 32)},
+				Interface: current.Int(0),
+			}},
+		}
+
+		err = testNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			// No address of net1, e.g. L2 only
+			Expect(validateChainOrder(result, "net1")).To(Succeed())
+
+			result.IPs[0].Interface = current.Int(1)
+			Expect(validateChainOrder(result, "net1")).To(MatchError(
+				ContainSubstring("interface net1 not found: vrf must be chained after the plugin creating it")))
+
+			// lo has no route in the table of a source rule of its
+			// address, which therefore is not one of sbr
+			result.Interfaces[1].Name = "lo"
+			rule := netlink.NewRule()
+			rule.Table = 100
+			rule.Src = &net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(32, 32)}
+			Expect(netlink.RuleAdd(rule)).To(Succeed())
+			Expect(validateChainOrder(result, "lo")).To(Succeed())
+
+			// Once the table routes through lo, the rule is one of sbr
+			lo, err := netlinksafe.LinkByName("lo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(lo)).To(Succeed())
+			Expect(netlink.RouteAdd(&netlink.Route{
+				LinkIndex: lo.Attrs().Index,
+				Dst:       &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)},
+				Scope:     netlink.SCOPE_LINK,
+				Table:     100,
+			})).To(Succeed())
+			Expect(validateChainOrder(result, "lo")).To(MatchError(ContainSubstring("vrf must be placed before sbr")))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
 	DescribeTable("When looking for a table id",
 		func(links []netlink.Link, expected uint32, expectFail bool) {
 			newID, err := findFreeRoutingTableID(links)
@@ -1065,3 +1279,35 @@ func checkRoutesOnVRF(vrfName, intfName string, addrStr string, routesToCheck ..
 		Expect(route.LinkIndex).To(Equal(link.Attrs().Index))
 	}
 }
+
+var _ = Describe("vrf families", func() {
+	It("keeps the families which are not selected in the main table", func() {
+		Expect(mainTableFamilies(nil)).To(BeEmpty())
+		Expect(mainTableFamilies([]string{"ipv4", "ipv6"})).To(BeEmpty())
+		Expect(mainTableFamilies([]string{"ipv6"})).To(Equal([]int{netlink.FAMILY_V4}))
+		Expect(mainTableFamilies([]string{"ipv4"})).To(Equal([]int{netlink.FAMILY_V6}))
+	})
+
+	It("looks the traffic in and out of the VRF up in the main table", func() {
+		rules := mainTableRules("vrf0", netlink.FAMILY_V4)
+		Expect(rules).To(HaveLen(2))
+		Expect(rules[0].IifName).To(Equal("vrf0"))
+		Expect(rules[1].OifName).To(Equal("vrf0"))
+		for _, rule := range rules {
+			Expect(rule.Family).To(Equal(netlink.FAMILY_V4))
+			Expect(rule.Table).To(Equal(254))
+			Expect(rule.Priority).To(BeNumerically("<", 1000))
+		}
+	})
+
+	It("rejects unknown families", func() {
+		_, _, err := parseConf([]byte(`{
+			"cniVersion": "1.0.0",
+			"name": "test",
+			"type": "vrf",
+			"vrfname": "vrf0",
+			"families": ["ipv6", "mpls"]
+		}`))
+		Expect(err).To(MatchError(`invalid family "mpls", must be "ipv4" or "ipv6"`))
+	})
+})
@@ -0,0 +1,75 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// carrier is the carrier state and counters of a link. The counters are not
+// parsed by the netlink package, and sysfs shows the links of the namespace
+// it was mounted in, so they are read from a raw RTM_GETLINK.
+type carrier struct {
+	Up bool
+	// Changes counts the carrier changes, Downs the carrier losses, since
+	// the link was created
+	Changes uint32
+	Downs   uint32
+}
+
+// readCarrier reads the carrier of the link of that index in the current
+// network namespace
+func readCarrier(index int) (*carrier, error) {
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWLINK)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != 1 || len(msgs[0]) < unix.SizeofIfInfomsg {
+		return nil, fmt.Errorf("unexpected RTM_GETLINK reply for link %d", index)
+	}
+	attrs, err := nl.ParseRouteAttr(msgs[0][unix.SizeofIfInfomsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	c := &carrier{}
+	for _, attr := range attrs {
+		if len(attr.Value) < 1 {
+			continue
+		}
+		switch attr.Attr.Type {
+		case unix.IFLA_CARRIER:
+			c.Up = attr.Value[0] != 0
+		case unix.IFLA_CARRIER_CHANGES:
+			if len(attr.Value) >= 4 {
+				c.Changes = binary.NativeEndian.Uint32(attr.Value)
+			}
+		case unix.IFLA_CARRIER_DOWN_COUNT:
+			if len(attr.Value) >= 4 {
+				c.Downs = binary.NativeEndian.Uint32(attr.Value)
+			}
+		}
+	}
+	return c, nil
+}
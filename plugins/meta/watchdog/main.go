@@ -0,0 +1,282 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is a chained plugin that watches the carrier of the container
+// interface. ADD records the carrier counters of the interface, CHECK fails
+// once the interface has lost its carrier more than a threshold since, and
+// STATUS reports the network as limited while any attachment does, so that
+// the runtime can restart the networking of pods on bad devices.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+)
+
+const (
+	defaultMaxFlaps = 3
+
+	// errLimitedConnectivity is the STATUS error of a plugin whose existing
+	// containers may have limited connectivity
+	errLimitedConnectivity uint = 51
+)
+
+// WatchdogConf is the chained plugin configuration
+type WatchdogConf struct {
+	types.NetConf
+
+	// MaxFlaps is the number of carrier losses of the interface tolerated
+	// since ADD, 3 by default
+	MaxFlaps *int `json:"maxFlaps,omitempty"`
+	// RequireCarrier also fails CHECK and STATUS while the carrier is down
+	RequireCarrier bool `json:"requireCarrier,omitempty"`
+	// DataDir is where the counters of the attachments are recorded
+	DataDir string `json:"dataDir,omitempty"`
+}
+
+func main() {
+	skel.PluginMainFuncs(skel.CNIFuncs{
+		Add:    cmdAdd,
+		Check:  cmdCheck,
+		Del:    cmdDel,
+		GC:     cmdGC,
+		Status: cmdStatus,
+	}, version.VersionsStartingFrom("0.3.1"), bv.BuildString("watchdog"))
+}
+
+func parseConf(data []byte) (*WatchdogConf, *current.Result, error) {
+	conf := WatchdogConf{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, fmt.Errorf("failed to load netconf: %v", err)
+	}
+
+	var result *current.Result
+	if conf.RawPrevResult != nil {
+		if err := version.ParsePrevResult(&conf.NetConf); err != nil {
+			return nil, nil, fmt.Errorf("could not parse prevResult: %v", err)
+		}
+		var err error
+		result, err = current.NewResultFromResult(conf.PrevResult)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not convert result to current version: %v", err)
+		}
+	}
+
+	if conf.MaxFlaps == nil {
+		maxFlaps := defaultMaxFlaps
+		conf.MaxFlaps = &maxFlaps
+	}
+	if *conf.MaxFlaps < 0 {
+		return nil, nil, fmt.Errorf("invalid maxFlaps %d", *conf.MaxFlaps)
+	}
+	if conf.DataDir == "" {
+		conf.DataDir = defaultDataDir
+	}
+	return &conf, result, nil
+}
+
+func cmdAdd(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	s, err := newStore(conf.DataDir, conf.Name)
+	if err != nil {
+		return err
+	}
+
+	r := &record{
+		ContainerID: args.ContainerID,
+		IfName:      args.IfName,
+		Netns:       args.Netns,
+		Added:       time.Now().UTC(),
+	}
+	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		link, err := netlinksafe.LinkByName(r.IfName)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q: %v", r.IfName, err)
+		}
+		c, err := readCarrier(link.Attrs().Index)
+		if err != nil {
+			return fmt.Errorf("failed to read the carrier of %q: %v", r.IfName, err)
+		}
+		r.IfIndex = link.Attrs().Index
+		r.CarrierDowns = c.Downs
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.save(r); err != nil {
+		return fmt.Errorf("failed to record the carrier of %q: %v", r.IfName, err)
+	}
+
+	return types.PrintResult(result, conf.CNIVersion)
+}
+
+func cmdDel(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	s, err := newStore(conf.DataDir, conf.Name)
+	if err != nil {
+		return err
+	}
+	return s.remove(args.ContainerID, args.IfName)
+}
+
+// health checks the interface of a recorded attachment against the
+// configuration. It must be called in the namespace of the interface.
+func health(conf *WatchdogConf, s *store, r *record) error {
+	link, err := netlinksafe.LinkByAny(netlinksafe.LinkSelector{Name: r.IfName, Index: r.IfIndex})
+	if err != nil {
+		return fmt.Errorf("interface %s is gone: %v", r.IfName, err)
+	}
+	c, err := readCarrier(link.Attrs().Index)
+	if err != nil {
+		return fmt.Errorf("failed to read the carrier of %q: %v", r.IfName, err)
+	}
+
+	// The counters of a recreated interface restarted, from an unknown
+	// value since the creation may count as a carrier loss: the interface
+	// starts over from its current counters
+	if link.Attrs().Index != r.IfIndex || c.Downs < r.CarrierDowns {
+		r.IfIndex = link.Attrs().Index
+		r.CarrierDowns = c.Downs
+		r.Added = time.Now().UTC()
+		if err := s.save(r); err != nil {
+			return fmt.Errorf("failed to record the carrier of %q: %v", r.IfName, err)
+		}
+	}
+	if flaps := int(c.Downs - r.CarrierDowns); flaps > *conf.MaxFlaps {
+		return fmt.Errorf("interface %s lost its carrier %d times since %s, more than %d",
+			r.IfName, flaps, r.Added.Format(time.RFC3339), *conf.MaxFlaps)
+	}
+	if conf.RequireCarrier && !c.Up {
+		return fmt.Errorf("interface %s has no carrier", r.IfName)
+	}
+	return nil
+}
+
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, result, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("must be called as chained plugin")
+	}
+
+	s, err := newStore(conf.DataDir, conf.Name)
+	if err != nil {
+		return err
+	}
+	r, err := s.load(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("watchdog: no carrier recorded for %s/%s", conf.Name, args.IfName)
+	}
+
+	return ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return health(conf, s, r)
+	})
+}
+
+// cmdStatus reports the network as limited while any of its attachments is
+// unhealthy. The attachments whose namespace is gone are left to GC.
+func cmdStatus(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	s, err := newStore(conf.DataDir, conf.Name)
+	if err != nil {
+		return err
+	}
+	records, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	var unhealthy []string
+	for _, r := range records {
+		err := ns.WithNetNSPath(r.Netns, func(_ ns.NetNS) error {
+			return health(conf, s, r)
+		})
+		var gone ns.NSPathNotExistErr
+		if err == nil || errors.As(err, &gone) {
+			continue
+		}
+		unhealthy = append(unhealthy, fmt.Sprintf("%s: %v", r.ContainerID, err))
+	}
+	if len(unhealthy) > 0 {
+		return types.NewError(errLimitedConnectivity,
+			fmt.Sprintf("%d attachments of %s are unhealthy", len(unhealthy), conf.Name),
+			strings.Join(unhealthy, "; "))
+	}
+	return nil
+}
+
+// cmdGC drops the records of the attachments of the network that are not in
+// the list of valid attachments
+func cmdGC(args *skel.CmdArgs) error {
+	conf, _, err := parseConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[types.GCAttachment]bool, len(conf.ValidAttachments))
+	for _, a := range conf.ValidAttachments {
+		valid[a] = true
+	}
+
+	s, err := newStore(conf.DataDir, conf.Name)
+	if err != nil {
+		return err
+	}
+	records, err := s.list()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range records {
+		if valid[types.GCAttachment{ContainerID: r.ContainerID, IfName: r.IfName}] {
+			continue
+		}
+		if err := s.remove(r.ContainerID, r.IfName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,143 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultDataDir = "/var/lib/cni/watchdog"
+
+// record is the state of the interface of an attachment when it was added,
+// the baseline of the counters consulted by CHECK and STATUS
+type record struct {
+	ContainerID string `json:"containerID"`
+	IfName      string `json:"ifName"`
+	Netns       string `json:"netns"`
+	// IfIndex tells a recreated interface, whose counters restarted
+	IfIndex      int       `json:"ifIndex"`
+	CarrierDowns uint32    `json:"carrierDowns"`
+	Added        time.Time `json:"added"`
+}
+
+// store keeps a file per attachment, in a directory per network. The files
+// are written atomically and only by the ADD and DEL of their attachment,
+// so no lock is needed.
+type store struct {
+	dir string
+}
+
+func newStore(dataDir, network string) (*store, error) {
+	if network == "" || strings.ContainsAny(network, "/\x00") || network == "." || network == ".." {
+		return nil, fmt.Errorf("invalid network name %q", network)
+	}
+	return &store{dir: filepath.Join(dataDir, network)}, nil
+}
+
+func (s *store) path(containerID, ifName string) (string, error) {
+	for _, id := range []string{containerID, ifName} {
+		if id == "" || strings.ContainsAny(id, "/\x00") || id == "." || id == ".." {
+			return "", fmt.Errorf("invalid attachment %s/%s", containerID, ifName)
+		}
+	}
+	return filepath.Join(s.dir, containerID+"."+ifName+".json"), nil
+}
+
+func (s *store) save(r *record) error {
+	p, err := s.path(r.ContainerID, r.IfName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func readRecord(p string) (*record, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	r := &record{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %v", p, err)
+	}
+	return r, nil
+}
+
+// load returns the record of the attachment, nil if there is none
+func (s *store) load(containerID, ifName string) (*record, error) {
+	p, err := s.path(containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := readRecord(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (s *store) remove(containerID, ifName string) error {
+	p, err := s.path(containerID, ifName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// list returns the records of all the attachments of the network
+func (s *store) list() ([]*record, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []*record
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		r, err := readRecord(filepath.Join(s.dir, e.Name()))
+		if os.IsNotExist(err) {
+			// Removed by a concurrent DEL
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2026 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+)
+
+const (
+	IFNAME   = "eth0"
+	PEERNAME = "peer0"
+)
+
+var _ = Describe("watchdog chained plugin", func() {
+	var targetNS ns.NetNS
+	var dataDir string
+
+	// setPeer changes the state of the peer of the container interface,
+	// which carries the carrier of the interface
+	setPeer := func(up bool) {
+		err := targetNS.Do(func(ns.NetNS) error {
+			peer, err := netlinksafe.LinkByName(PEERNAME)
+			if err != nil {
+				return err
+			}
+			if up {
+				return netlink.LinkSetUp(peer)
+			}
+			return netlink.LinkSetDown(peer)
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	createVeth := func() {
+		err := targetNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+
+			linkAttrs := netlink.NewLinkAttrs()
+			linkAttrs.Name = IFNAME
+			Expect(netlink.LinkAdd(&netlink.Veth{LinkAttrs: linkAttrs, PeerName: PEERNAME})).To(Succeed())
+			link, err := netlinksafe.LinkByName(IFNAME)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netlink.LinkSetUp(link)).To(Succeed())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		setPeer(true)
+	}
+
+	BeforeEach(func() {
+		var err error
+		targetNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		dataDir, err = os.MkdirTemp("", "watchdog_test")
+		Expect(err).NotTo(HaveOccurred())
+		createVeth()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+		Expect(targetNS.Close()).To(Succeed())
+		Expect(testutils.UnmountNS(targetNS)).To(Succeed())
+	})
+
+	netConf := func(ver string, options string) []byte {
+		return []byte(fmt.Sprintf(`{
+			"cniVersion": "%s",
+			"name": "mynet",
+			"type": "watchdog",
+			"dataDir": "%s",
+			%s
+			"prevResult": {
+				"cniVersion": "%s",
+				"interfaces": [{"name": "%s", "sandbox": "%s"}]
+			}
+		}`, ver, dataDir, options, ver, IFNAME, targetNS.Path()))
+	}
+
+	cmdArgs := func(conf []byte) *skel.CmdArgs {
+		return &skel.CmdArgs{
+			ContainerID: "dummy",
+			Netns:       targetNS.Path(),
+			IfName:      IFNAME,
+			StdinData:   conf,
+		}
+	}
+
+	add := func(args *skel.CmdArgs) {
+		_, _, err := testutils.CmdAddWithArgs(args, func() error {
+			return cmdAdd(args)
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	check := func(args *skel.CmdArgs) error {
+		return testutils.CmdCheckWithArgs(args, func() error {
+			return cmdCheck(args)
+		})
+	}
+
+	flap := func(times int) {
+		for i := 0; i < times; i++ {
+			setPeer(false)
+			setPeer(true)
+		}
+	}
+
+	It("fails CHECK and STATUS once the interface flapped more than maxFlaps", func() {
+		args := cmdArgs(netConf("1.1.0", `"maxFlaps": 1,`))
+		add(args)
+		Expect(check(args)).To(Succeed())
+
+		flap(1)
+		Expect(check(args)).To(Succeed())
+		Expect(testutils.CmdStatus(func() error { return cmdStatus(args) })).To(Succeed())
+
+		flap(1)
+		Expect(check(args)).To(MatchError(MatchRegexp(`interface eth0 lost its carrier 2 times since .*, more than 1`)))
+
+		err := testutils.CmdStatus(func() error { return cmdStatus(args) })
+		var cniErr *types.Error
+		Expect(errors.As(err, &cniErr)).To(BeTrue())
+		Expect(cniErr.Code).To(Equal(errLimitedConnectivity))
+		Expect(cniErr.Msg).To(Equal("1 attachments of mynet are unhealthy"))
+		Expect(cniErr.Details).To(ContainSubstring("dummy: interface eth0 lost its carrier 2 times"))
+
+		// A new ADD records a new baseline
+		add(args)
+		Expect(check(args)).To(Succeed())
+
+		Expect(testutils.CmdDelWithArgs(args, func() error { return cmdDel(args) })).To(Succeed())
+		Expect(check(args)).To(MatchError("watchdog: no carrier recorded for mynet/eth0"))
+		Expect(testutils.CmdStatus(func() error { return cmdStatus(args) })).To(Succeed())
+	})
+
+	It("fails CHECK while the carrier is down with requireCarrier", func() {
+		args := cmdArgs(netConf("1.0.0", `"requireCarrier": true,`))
+		add(args)
+
+		setPeer(false)
+		Expect(check(args)).To(MatchError("interface eth0 has no carrier"))
+		setPeer(true)
+		Expect(check(args)).To(Succeed())
+	})
+
+	It("restarts the count of a recreated interface", func() {
+		args := cmdArgs(netConf("1.0.0", `"maxFlaps": 0,`))
+		flap(2)
+		add(args)
+		Expect(check(args)).To(Succeed())
+
+		err := targetNS.Do(func(ns.NetNS) error {
+			link, err := netlinksafe.LinkByName(IFNAME)
+			if err != nil {
+				return err
+			}
+			return netlink.LinkDel(link)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		createVeth()
+		Expect(check(args)).To(Succeed())
+
+		flap(1)
+		Expect(check(args)).To(MatchError(ContainSubstring("lost its carrier 1 times")))
+	})
+
+	It("drops the records of invalid attachments on GC", func() {
+		args := cmdArgs(netConf("1.1.0", ""))
+		add(args)
+
+		gcConf := fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "mynet",
+			"type": "watchdog",
+			"dataDir": "%s",
+			"cni.dev/valid-attachments": [{"containerID": "dummy", "ifname": "%s"}]
+		}`, dataDir, IFNAME)
+		Expect(cmdGC(&skel.CmdArgs{StdinData: []byte(gcConf)})).To(Succeed())
+		Expect(check(args)).To(Succeed())
+
+		gcConf = fmt.Sprintf(`{
+			"cniVersion": "1.1.0",
+			"name": "mynet",
+			"type": "watchdog",
+			"dataDir": "%s",
+			"cni.dev/valid-attachments": []
+		}`, dataDir)
+		Expect(cmdGC(&skel.CmdArgs{StdinData: []byte(gcConf)})).To(Succeed())
+		Expect(check(args)).To(MatchError("watchdog: no carrier recorded for mynet/eth0"))
+	})
+
+	It("rejects a negative maxFlaps", func() {
+		_, _, err := parseConf([]byte(`{"name": "mynet", "maxFlaps": -1}`))
+		Expect(err).To(MatchError("invalid maxFlaps -1"))
+	})
+})